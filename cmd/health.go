@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/app"
+	"github.com/iBreaker/llm-gateway/internal/upstream"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// healthCheckResult 单个上游账号的探测结果
+type healthCheckResult struct {
+	account  *types.UpstreamAccount
+	duration time.Duration
+	err      error
+}
+
+// handleHealthCheck 实时探测所有活跃上游账号并更新健康状态，存在不健康账号时返回错误（非零退出码）
+func handleHealthCheck(args []string, app *app.Application) error {
+	fs := flag.NewFlagSet("health", flag.ContinueOnError)
+	provider := fs.String("provider", "", "只检查指定提供商的账号 (anthropic, openai, google, azure, qwen)")
+	timeout := fs.Duration("timeout", upstream.DefaultProbeTimeout, "单个账号探测超时")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var results []healthCheckResult
+	for _, account := range app.UpstreamMgr.FindAccountsByTags(nil) {
+		if account.Status != "active" {
+			continue
+		}
+		if *provider != "" && string(account.Provider) != *provider {
+			continue
+		}
+
+		start := time.Now()
+		err := app.UpstreamMgr.CheckAccountHealth(account.ID, *timeout)
+		results = append(results, healthCheckResult{
+			account:  account,
+			duration: time.Since(start),
+			err:      err,
+		})
+	}
+
+	if len(results) == 0 {
+		if *provider != "" {
+			return fmt.Errorf("没有提供商为 %s 的活跃上游账号", *provider)
+		}
+		return fmt.Errorf("没有活跃的上游账号")
+	}
+
+	return printHealthCheckResults(results)
+}
+
+// printHealthCheckResults 以表格输出探测结果，存在失败账号时返回错误
+func printHealthCheckResults(results []healthCheckResult) error {
+	fmt.Println("LLM Gateway 健康检查:")
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\t名称\t提供商\t类型\t结果\t耗时\t详情")
+	failed := 0
+	for _, result := range results {
+		status, detail := "✅ PASS", ""
+		if result.err != nil {
+			failed++
+			status, detail = "❌ FAIL", result.err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%v\t%s\n",
+			result.account.ID, result.account.Name, result.account.Provider, result.account.Type,
+			status, result.duration.Round(time.Millisecond), detail)
+	}
+	_ = tw.Flush()
+
+	fmt.Printf("\n健康检查完成: 共%d个，健康%d个，不健康%d个\n", len(results), len(results)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d个上游账号不健康", failed)
+	}
+	return nil
+}
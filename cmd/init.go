@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/iBreaker/llm-gateway/internal/app"
+	"github.com/iBreaker/llm-gateway/internal/config"
+	"github.com/iBreaker/llm-gateway/internal/upstream"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// prompter 交互式输入辅助
+type prompter struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{reader: bufio.NewReader(in), out: out}
+}
+
+// ask 读取一行输入，直接回车时返回默认值
+func (p *prompter) ask(label, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", label, defaultValue)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", label)
+	}
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("读取输入失败: %w", err)
+	}
+
+	if value := strings.TrimSpace(line); value != "" {
+		return value, nil
+	}
+	return defaultValue, nil
+}
+
+// askRequired 读取必填输入，为空时重复提示
+func (p *prompter) askRequired(label string) (string, error) {
+	for {
+		value, err := p.ask(label, "")
+		if err != nil || value != "" {
+			return value, err
+		}
+		fmt.Fprintln(p.out, "  该项不能为空")
+	}
+}
+
+// askChoice 从候选项中选择，支持输入序号或名称
+func (p *prompter) askChoice(label string, options []string, defaultValue string) (string, error) {
+	for i, option := range options {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, option)
+	}
+	for {
+		value, err := p.ask(label, defaultValue)
+		if err != nil {
+			return "", err
+		}
+		if index, err := strconv.Atoi(value); err == nil && index >= 1 && index <= len(options) {
+			return options[index-1], nil
+		}
+		for _, option := range options {
+			if value == option {
+				return option, nil
+			}
+		}
+		fmt.Fprintf(p.out, "  无效的选择: %s\n", value)
+	}
+}
+
+// askBool 读取是/否
+func (p *prompter) askBool(label string, defaultValue bool) (bool, error) {
+	def := "y/N"
+	if defaultValue {
+		def = "Y/n"
+	}
+	for {
+		value, err := p.ask(label+" ("+def+")", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(value) {
+		case "":
+			return defaultValue, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(p.out, "  请输入 y 或 n")
+	}
+}
+
+func handleInit(args []string, app *app.Application) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	skipVerify := fs.Bool("skip-verify", false, "跳过上游账号凭据校验")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return runInitWizard(newPrompter(os.Stdin, os.Stdout), app, *skipVerify)
+}
+
+// runInitWizard 交互式初始化向导：服务配置 -> 第一个上游账号 -> 第一个Gateway Key
+func runInitWizard(p *prompter, app *app.Application, skipVerify bool) error {
+	fmt.Fprintln(p.out, "🚀 LLM Gateway 初始化向导")
+	fmt.Fprintf(p.out, "配置文件: %s\n", app.Config.GetConfigPath())
+	fmt.Fprintln(p.out, "直接回车使用方括号中的默认值")
+	fmt.Fprintln(p.out)
+
+	fmt.Fprintln(p.out, "步骤 1/3: 服务配置")
+	if err := initServerConfig(p, app); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(p.out)
+	fmt.Fprintln(p.out, "步骤 2/3: 添加上游账号")
+	if err := initUpstreamAccount(p, app, skipVerify); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(p.out)
+	fmt.Fprintln(p.out, "步骤 3/3: 创建Gateway API Key")
+	rawKey, err := initGatewayKey(p, app)
+	if err != nil {
+		return err
+	}
+
+	config := app.Config.Get()
+	fmt.Fprintln(p.out)
+	fmt.Fprintln(p.out, "✅ 初始化完成，配置已写入", app.Config.GetConfigPath())
+	fmt.Fprintln(p.out)
+	fmt.Fprintln(p.out, "下一步:")
+	fmt.Fprintln(p.out, "  1. 启动服务:  llm-gateway server start")
+	if rawKey != "" {
+		fmt.Fprintf(p.out, "  2. 发送请求:  curl http://%s:%d/v1/chat/completions \\\n", config.Server.Host, config.Server.Port)
+		fmt.Fprintf(p.out, "       -H \"Authorization: Bearer %s\" -H \"Content-Type: application/json\" \\\n", rawKey)
+		fmt.Fprintln(p.out, `       -d '{"model":"<model>","messages":[{"role":"user","content":"hello"}]}'`)
+	}
+	return nil
+}
+
+// initServerConfig 设置监听地址、端口和Web管理密码
+func initServerConfig(p *prompter, app *app.Application) error {
+	cfg := app.Config.Get()
+
+	host, err := p.ask("监听地址", cfg.Server.Host)
+	if err != nil {
+		return err
+	}
+
+	port := cfg.Server.Port
+	for {
+		value, err := p.ask("监听端口", strconv.Itoa(port))
+		if err != nil {
+			return err
+		}
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 && parsed <= 65535 {
+			port = parsed
+			break
+		}
+		fmt.Fprintf(p.out, "  无效的端口号: %s\n", value)
+	}
+
+	password, err := p.ask("Web管理界面密码 (回车保持不变)", "")
+	if err != nil {
+		return err
+	}
+
+	cfg.Server.Host = host
+	cfg.Server.Port = port
+	if password != "" {
+		hash, err := config.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		cfg.Server.Web.Password = hash
+	}
+
+	if err := app.Config.Save(cfg); err != nil {
+		return fmt.Errorf("保存配置失败: %w", err)
+	}
+	fmt.Fprintf(p.out, "  服务将监听 %s:%d\n", host, port)
+	return nil
+}
+
+// initUpstreamAccount 添加第一个上游账号并校验凭据
+func initUpstreamAccount(p *prompter, app *app.Application, skipVerify bool) error {
+	if existing := app.UpstreamMgr.ListAccounts(); len(existing) > 0 {
+		fmt.Fprintf(p.out, "  已存在 %d 个上游账号\n", len(existing))
+		add, err := p.askBool("是否再添加一个上游账号", false)
+		if err != nil || !add {
+			return err
+		}
+	}
+
+	for {
+		provider, err := p.askChoice("选择提供商", []string{"anthropic", "openai", "qwen", "google", "azure"}, "anthropic")
+		if err != nil {
+			return err
+		}
+
+		accountType := "api-key"
+		if provider == "anthropic" || provider == "qwen" {
+			if accountType, err = p.askChoice("选择认证方式", []string{"api-key", "oauth"}, "api-key"); err != nil {
+				return err
+			}
+		}
+
+		name, err := p.ask("账号名称", provider+"-default")
+		if err != nil {
+			return err
+		}
+
+		account := &types.UpstreamAccount{
+			Name:      name,
+			Provider:  types.Provider(provider),
+			Status:    "active",
+			CreatedBy: os.Getenv("USER"),
+		}
+
+		if accountType == "oauth" {
+			account.Type = types.UpstreamTypeOAuth
+		} else {
+			account.Type = types.UpstreamTypeAPIKey
+			if account.APIKey, err = p.askRequired("API Key"); err != nil {
+				return err
+			}
+			if account.BaseURL, err = p.ask("自定义API端点 (可选)", ""); err != nil {
+				return err
+			}
+		}
+
+		if err := app.UpstreamMgr.AddAccount(account); err != nil {
+			return fmt.Errorf("添加上游账号失败: %w", err)
+		}
+
+		if account.Type == types.UpstreamTypeOAuth {
+			fmt.Fprintln(p.out, "  🔐 开始OAuth授权流程...")
+			if err := startInteractiveOAuth(p, app, account.ID); err != nil {
+				fmt.Fprintf(p.out, "  ⚠️  授权流程失败: %v\n", err)
+				fmt.Fprintf(p.out, "  💡 稍后可运行: llm-gateway oauth start %s\n", account.ID)
+			}
+			fmt.Fprintf(p.out, "  ✅ 已添加上游账号 %s (%s)\n", account.Name, account.ID)
+			return nil
+		}
+
+		if skipVerify {
+			fmt.Fprintf(p.out, "  ✅ 已添加上游账号 %s (%s)，未校验凭据\n", account.Name, account.ID)
+			return nil
+		}
+
+		fmt.Fprintln(p.out, "  🔄 正在校验凭据...")
+		if err := app.UpstreamMgr.CheckAccountHealth(account.ID, upstream.DefaultProbeTimeout); err == nil {
+			fmt.Fprintf(p.out, "  ✅ 凭据校验通过，已添加上游账号 %s (%s)\n", account.Name, account.ID)
+			return nil
+		} else {
+			fmt.Fprintf(p.out, "  ❌ 凭据校验失败: %v\n", err)
+		}
+
+		keep, err := p.askBool("仍然保留该账号", false)
+		if err != nil {
+			return err
+		}
+		if keep {
+			fmt.Fprintf(p.out, "  ⚠️  已保留上游账号 %s (%s)，请稍后检查凭据\n", account.Name, account.ID)
+			return nil
+		}
+		if err := app.UpstreamMgr.DeleteAccount(account.ID); err != nil {
+			return fmt.Errorf("删除上游账号失败: %w", err)
+		}
+		fmt.Fprintln(p.out, "  已删除该账号，请重新输入")
+	}
+}
+
+// initGatewayKey 创建第一个Gateway API Key，返回原始密钥
+func initGatewayKey(p *prompter, app *app.Application) (string, error) {
+	if existing := app.GatewayKeyMgr.ListKeys(); len(existing) > 0 {
+		fmt.Fprintf(p.out, "  已存在 %d 个Gateway API Key\n", len(existing))
+		create, err := p.askBool("是否再创建一个Gateway API Key", false)
+		if err != nil || !create {
+			return "", err
+		}
+	}
+
+	name, err := p.ask("API Key名称", "default")
+	if err != nil {
+		return "", err
+	}
+
+	key, rawKey, err := app.GatewayKeyMgr.CreateKey(name, []types.Permission{types.PermissionRead, types.PermissionWrite})
+	if err != nil {
+		return "", fmt.Errorf("创建API Key失败: %w", err)
+	}
+
+	fmt.Fprintf(p.out, "  ✅ 已创建Gateway API Key %s (%s)\n", key.Name, key.ID)
+	fmt.Fprintf(p.out, "  密钥: %s\n", rawKey)
+	fmt.Fprintln(p.out, "  请妥善保存上述密钥，系统不会再次显示！")
+	return rawKey, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/internal/app"
+)
+
+func TestRunInitWizard(t *testing.T) {
+	application, err := app.NewApplication(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatalf("NewApplication() error = %v", err)
+	}
+	defer application.OAuthMgr.StopAutoRefresh()
+
+	input := strings.Join([]string{
+		"",        // 监听地址：默认
+		"abc",     // 无效端口
+		"9000",    // 监听端口
+		"",        // Web管理密码：保持不变
+		"2",       // 提供商：openai
+		"",        // 账号名称：默认
+		"",        // API Key为空，重复提示
+		"sk-test", // API Key
+		"",        // 自定义API端点：无
+		"",        // API Key名称：默认
+	}, "\n") + "\n"
+	var out bytes.Buffer
+
+	// 向导的所有输出都应写入prompter，而不是标准输出
+	stdout := os.Stdout
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	os.Stdout = writer
+	err = runInitWizard(newPrompter(strings.NewReader(input), &out), application, true)
+	os.Stdout = stdout
+	_ = writer.Close()
+	leaked, _ := io.ReadAll(reader)
+
+	if err != nil {
+		t.Fatalf("runInitWizard() error = %v\n%s", err, out.String())
+	}
+	if len(leaked) > 0 {
+		t.Errorf("向导不应直接写标准输出: %q", leaked)
+	}
+
+	output := out.String()
+	for _, want := range []string{"步骤 1/3", "无效的端口号: abc", "该项不能为空", "已添加上游账号 openai-default", "已创建Gateway API Key", "初始化完成"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出缺少 %q:\n%s", want, output)
+		}
+	}
+
+	if port := application.Config.Get().Server.Port; port != 9000 {
+		t.Errorf("Server.Port = %d, want 9000", port)
+	}
+	accounts := application.UpstreamMgr.ListAccounts()
+	if len(accounts) != 1 || accounts[0].APIKey != "sk-test" || accounts[0].Name != "openai-default" {
+		t.Errorf("上游账号 = %+v", accounts)
+	}
+	if keys := application.GatewayKeyMgr.ListKeys(); len(keys) != 1 || keys[0].Name != "default" {
+		t.Errorf("Gateway Key = %+v", keys)
+	}
+}
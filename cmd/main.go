@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/iBreaker/llm-gateway/internal/app"
+	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/internal/upstream"
 	"github.com/iBreaker/llm-gateway/pkg/debug"
 	"github.com/iBreaker/llm-gateway/pkg/logger"
 	"github.com/iBreaker/llm-gateway/pkg/types"
@@ -44,6 +53,9 @@ func main() {
 		if err := debug.EnableFromConfig(config.Logging.Level, config.Logging.File); err != nil {
 			log.Printf("启用调试模式失败: %v\n", err)
 		}
+		if err := debug.SetRedactionLevel(config.Logging.TraceRedaction); err != nil {
+			log.Printf("设置trace脱敏级别失败: %v\n", err)
+		}
 	}
 
 	// 运行CLI
@@ -68,6 +80,8 @@ func runCLI(args []string, app *app.Application) error {
 	}
 	
 	switch command {
+	case "init":
+		return handleInit(args[2:], app)
 	case "apikey":
 		return handleAPIKey(args[2:], app)
 	case "upstream":
@@ -96,13 +110,14 @@ func printUsage() {
 	fmt.Println("  llm-gateway <command> [arguments]")
 	fmt.Println()
 	fmt.Println("可用命令:")
+	fmt.Println("  init       交互式配置向导")
 	fmt.Println("  apikey     Gateway API Key管理")
 	fmt.Println("  upstream   上游账号管理")
 	fmt.Println("  server     服务器管理")
 	fmt.Println("  oauth      OAuth流程管理")
 	fmt.Println("  env        环境变量管理")
 	fmt.Println("  status     显示系统状态")
-	fmt.Println("  health     健康检查")
+	fmt.Println("  health     实时探测活跃上游账号 (--provider, --timeout)")
 	fmt.Println()
 	fmt.Println("使用 'llm-gateway <command> --help' 查看命令的详细帮助")
 }
@@ -127,6 +142,10 @@ func handleAPIKey(args []string, app *app.Application) error {
 		return handleAPIKeyRemove(args[1:], app)
 	case "disable":
 		return handleAPIKeyDisable(args[1:], app)
+	case "enable":
+		return handleAPIKeyEnable(args[1:], app)
+	case "price":
+		return handleAPIKeyPrice(args[1:], app)
 	default:
 		fmt.Printf("未知的apikey子命令: %s\n\n", subcommand)
 		printAPIKeyUsage()
@@ -144,12 +163,21 @@ func printAPIKeyUsage() {
 	fmt.Println("  show       显示API Key详情")
 	fmt.Println("  remove     删除API Key")
 	fmt.Println("  disable    禁用API Key")
+	fmt.Println("  enable     启用已禁用的API Key")
+	fmt.Println("  price      设置API Key价格系数")
 }
 
 func handleAPIKeyAdd(args []string, app *app.Application) error {
 	fs := flag.NewFlagSet("apikey add", flag.ContinueOnError)
 	name := fs.String("name", "", "API Key名称")
 	permissions := fs.String("permissions", "read,write", "权限列表，逗号分隔")
+	priceMultiplier := fs.Float64("price-multiplier", 0, "价格系数（如0.8表示八折，1.2表示加价20%）")
+	allowedDays := fs.String("allowed-days", "", "允许使用的星期，逗号分隔（如 mon,tue,wed,thu,fri），为空表示每天")
+	allowedHours := fs.String("allowed-hours", "", "允许使用的时间段 HH:MM-HH:MM（如 09:00-18:00，可跨午夜）")
+	timezone := fs.String("timezone", "", "时间窗口使用的IANA时区（如 Asia/Shanghai），默认服务器本地时区")
+	tenant := fs.String("tenant", "", "所属租户，只能使用同租户的上游账号 (可选, 默认default)")
+	expiresIn := fs.Duration("expires-in", 0, "有效期（如 720h），过期后Key无法通过认证，默认永不过期")
+	requestTimeout := fs.Int("request-timeout", 0, "上游请求超时（秒），覆盖全局stream_timeout，流式请求取两者中较大者，默认使用全局配置")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -159,6 +187,27 @@ func handleAPIKeyAdd(args []string, app *app.Application) error {
 		return fmt.Errorf("缺少必要参数: --name")
 	}
 
+	if *expiresIn < 0 {
+		return fmt.Errorf("有效期不能为负数: %v", *expiresIn)
+	}
+
+	if *requestTimeout < 0 {
+		return fmt.Errorf("请求超时不能为负数: %d", *requestTimeout)
+	}
+
+	if err := types.ValidateTenant(*tenant); err != nil {
+		return err
+	}
+
+	if *priceMultiplier < 0 {
+		return fmt.Errorf("价格系数不能为负数: %v", *priceMultiplier)
+	}
+
+	windows, err := parseAccessWindow(*allowedDays, *allowedHours, *timezone)
+	if err != nil {
+		return err
+	}
+
 	// 解析权限
 	permList := strings.Split(*permissions, ",")
 	var perms []types.Permission
@@ -182,20 +231,99 @@ func handleAPIKeyAdd(args []string, app *app.Application) error {
 		return fmt.Errorf("创建API Key失败: %w", err)
 	}
 
+	if *priceMultiplier > 0 {
+		if err := app.GatewayKeyMgr.UpdateKeyPriceMultiplier(key.ID, *priceMultiplier); err != nil {
+			return fmt.Errorf("设置价格系数失败: %w", err)
+		}
+	}
+
+	if len(windows) > 0 {
+		if err := app.GatewayKeyMgr.UpdateKeyAccessWindows(key.ID, windows); err != nil {
+			return fmt.Errorf("设置时间窗口失败: %w", err)
+		}
+	}
+
+	if *tenant != "" {
+		if err := app.GatewayKeyMgr.UpdateKeyTenant(key.ID, *tenant); err != nil {
+			return fmt.Errorf("设置租户失败: %w", err)
+		}
+	}
+
+	if *requestTimeout > 0 {
+		if err := app.GatewayKeyMgr.UpdateKeyRequestTimeout(key.ID, *requestTimeout); err != nil {
+			return fmt.Errorf("设置请求超时失败: %w", err)
+		}
+	}
+
+	var expiresAt *time.Time
+	if *expiresIn > 0 {
+		t := time.Now().Add(*expiresIn)
+		expiresAt = &t
+		if err := app.GatewayKeyMgr.UpdateKeyExpiresAt(key.ID, expiresAt); err != nil {
+			return fmt.Errorf("设置过期时间失败: %w", err)
+		}
+	}
+
 	fmt.Printf("成功创建Gateway API Key:\n")
 	fmt.Printf("  ID: %s\n", key.ID)
 	fmt.Printf("  名称: %s\n", key.Name)
+	fmt.Printf("  租户: %s\n", types.NormalizeTenant(*tenant))
 	fmt.Printf("  权限: %v\n", perms)
 	fmt.Printf("  密钥: %s\n", rawKey)
 	fmt.Printf("  状态: %s\n", key.Status)
+	if expiresAt != nil {
+		fmt.Printf("  过期时间: %s\n", expiresAt.Format("2006-01-02 15:04:05"))
+	}
 	fmt.Println()
 	fmt.Println("请妥善保存上述密钥，系统不会再次显示！")
 
 	return nil
 }
 
+// parseAccessWindow 根据命令行参数构造时间窗口，未指定任何限制时返回空
+func parseAccessWindow(days, hours, timezone string) ([]types.AccessWindow, error) {
+	if days == "" && hours == "" {
+		if timezone != "" {
+			return nil, fmt.Errorf("--timezone 需要与 --allowed-days 或 --allowed-hours 一起使用")
+		}
+		return nil, nil
+	}
+
+	window := types.AccessWindow{Timezone: timezone}
+	if days != "" {
+		for _, day := range strings.Split(days, ",") {
+			window.Days = append(window.Days, strings.ToLower(strings.TrimSpace(day)))
+		}
+	}
+	if hours != "" {
+		parts := strings.SplitN(hours, "-", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("无效的时间段: %s，格式应为 HH:MM-HH:MM", hours)
+		}
+		window.StartTime = strings.TrimSpace(parts[0])
+		window.EndTime = strings.TrimSpace(parts[1])
+	}
+
+	if err := window.Validate(); err != nil {
+		return nil, err
+	}
+	return []types.AccessWindow{window}, nil
+}
+
 func handleAPIKeyList(args []string, app *app.Application) error {
-	keys := app.GatewayKeyMgr.ListKeys()
+	fs := flag.NewFlagSet("apikey list", flag.ContinueOnError)
+	tenant := fs.String("tenant", "", "只列出指定租户的API Key")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var keys []*types.GatewayAPIKey
+	for _, key := range app.GatewayKeyMgr.ListKeys() {
+		if *tenant == "" || key.TenantID() == *tenant {
+			keys = append(keys, key)
+		}
+	}
 
 	if len(keys) == 0 {
 		fmt.Println("没有找到Gateway API Key")
@@ -207,6 +335,7 @@ func handleAPIKeyList(args []string, app *app.Application) error {
 	for _, key := range keys {
 		fmt.Printf("ID: %s\n", key.ID)
 		fmt.Printf("  名称: %s\n", key.Name)
+		fmt.Printf("  租户: %s\n", key.TenantID())
 		fmt.Printf("  权限: %v\n", key.Permissions)
 		fmt.Printf("  状态: %s\n", key.Status)
 		fmt.Printf("  创建时间: %s\n", key.CreatedAt.Format("2006-01-02 15:04:05"))
@@ -236,6 +365,7 @@ func handleAPIKeyShow(args []string, app *app.Application) error {
 	fmt.Printf("Gateway API Key详情:\n\n")
 	fmt.Printf("ID: %s\n", key.ID)
 	fmt.Printf("名称: %s\n", key.Name)
+	fmt.Printf("租户: %s\n", key.TenantID())
 	fmt.Printf("权限: %v\n", key.Permissions)
 	fmt.Printf("状态: %s\n", key.Status)
 	fmt.Printf("创建时间: %s\n", key.CreatedAt.Format("2006-01-02 15:04:05"))
@@ -244,6 +374,10 @@ func handleAPIKeyShow(args []string, app *app.Application) error {
 	if key.ExpiresAt != nil {
 		fmt.Printf("过期时间: %s\n", key.ExpiresAt.Format("2006-01-02 15:04:05"))
 	}
+	fmt.Printf("价格系数: %.2f\n", key.EffectivePriceMultiplier())
+	for _, window := range key.AccessWindows {
+		fmt.Printf("可用时间: %s\n", window.String())
+	}
 
 	if key.Usage != nil {
 		fmt.Println("\n使用统计:")
@@ -251,6 +385,9 @@ func handleAPIKeyShow(args []string, app *app.Application) error {
 		fmt.Printf("  成功请求: %d\n", key.Usage.SuccessfulRequests)
 		fmt.Printf("  错误请求: %d\n", key.Usage.ErrorRequests)
 		fmt.Printf("  平均延迟: %.2f ms\n", key.Usage.AvgLatency)
+		fmt.Printf("  输入Token: %d\n", key.Usage.InputTokens)
+		fmt.Printf("  输出Token: %d\n", key.Usage.OutputTokens)
+		fmt.Printf("  累计成本: %.6f\n", key.Usage.TotalCost)
 		fmt.Printf("  最后使用: %s\n", key.Usage.LastUsedAt.Format("2006-01-02 15:04:05"))
 
 		if key.Usage.LastErrorAt != nil {
@@ -299,6 +436,46 @@ func handleAPIKeyDisable(args []string, app *app.Application) error {
 	return nil
 }
 
+func handleAPIKeyEnable(args []string, app *app.Application) error {
+	if len(args) == 0 {
+		return fmt.Errorf("缺少参数: <key-id>")
+	}
+
+	keyID := args[0]
+
+	// 检查key是否存在
+	if _, err := app.GatewayKeyMgr.GetKey(keyID); err != nil {
+		return err
+	}
+
+	// 启用key
+	if err := app.GatewayKeyMgr.UpdateKeyStatus(keyID, "active"); err != nil {
+		return fmt.Errorf("启用API Key失败: %w", err)
+	}
+
+	fmt.Printf("成功启用Gateway API Key: %s\n", keyID)
+	return nil
+}
+
+func handleAPIKeyPrice(args []string, app *app.Application) error {
+	if len(args) < 2 {
+		return fmt.Errorf("用法: llm-gateway apikey price <key-id> <multiplier>")
+	}
+
+	keyID := args[0]
+	multiplier, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return fmt.Errorf("无效的价格系数: %s", args[1])
+	}
+
+	if err := app.GatewayKeyMgr.UpdateKeyPriceMultiplier(keyID, multiplier); err != nil {
+		return fmt.Errorf("设置价格系数失败: %w", err)
+	}
+
+	fmt.Printf("成功设置Gateway API Key %s 的价格系数: %.2f\n", keyID, multiplier)
+	return nil
+}
+
 // ===== 其他命令的占位符处理器 =====
 
 func handleUpstream(args []string, app *app.Application) error {
@@ -315,12 +492,22 @@ func handleUpstream(args []string, app *app.Application) error {
 		return handleUpstreamList(args[1:], app)
 	case "show":
 		return handleUpstreamShow(args[1:], app)
+	case "update":
+		return handleUpstreamUpdate(args[1:], app)
 	case "remove":
 		return handleUpstreamRemove(args[1:], app)
 	case "enable":
 		return handleUpstreamEnable(args[1:], app)
 	case "disable":
 		return handleUpstreamDisable(args[1:], app)
+	case "tag":
+		return handleUpstreamTag(args[1:], app)
+	case "health":
+		return handleUpstreamHealth(args[1:], app)
+	case "discover":
+		return handleUpstreamDiscover(args[1:], app)
+	case "test":
+		return handleUpstreamTest(args[1:], app)
 	default:
 		fmt.Printf("未知的upstream子命令: %s\n\n", subcommand)
 		printUpstreamUsage()
@@ -336,9 +523,14 @@ func printUpstreamUsage() {
 	fmt.Println("  add        添加上游账号")
 	fmt.Println("  list       列出所有上游账号")
 	fmt.Println("  show       显示上游账号详情")
+	fmt.Println("  update     修改上游账号名称、端点URL或API Key")
 	fmt.Println("  remove     删除上游账号")
-	fmt.Println("  enable     启用上游账号")
-	fmt.Println("  disable    禁用上游账号")
+	fmt.Println("  enable     启用上游账号 (<upstream-id> 或 --tag key=value 批量)")
+	fmt.Println("  disable    禁用上游账号 (<upstream-id> 或 --tag key=value 批量)")
+	fmt.Println("  tag        设置上游账号标签")
+	fmt.Println("  health     健康检查上游账号 (<upstream-id> 或 --tag key=value 批量)")
+	fmt.Println("  discover   探测上游账号的模型列表、端点及流式/工具支持")
+	fmt.Println("  test       向上游账号发送一条测试对话请求 (绕过路由)")
 }
 
 func handleUpstreamAdd(args []string, app *app.Application) error {
@@ -348,10 +540,47 @@ func handleUpstreamAdd(args []string, app *app.Application) error {
 	provider := fs.String("provider", "", "提供商 (anthropic, openai, google, azure, qwen)")
 	baseURL := fs.String("base-url", "", "自定义API端点URL (可选)")
 	apiKey := fs.String("key", "", "API密钥 (type=api-key时必需)")
+	extraKeys := fs.String("extra-keys", "", "额外的API密钥，与--key组成轮换池 (可选, 逗号分隔)")
+	keyExpiresAt := fs.String("key-expires-at", "", "API密钥到期时间 (可选, 格式: 2006-01-02 或 RFC3339)")
+	description := fs.String("description", "", "账号备注 (可选)")
+	createdBy := fs.String("created-by", os.Getenv("USER"), "创建人 (默认当前系统用户)")
+	tagsFlag := fs.String("tags", "", "账号标签 (可选, 格式: key=value,key2=value2)")
+	weight := fs.Int("weight", 0, "weighted负载均衡策略下的权重 (可选, 默认1)")
+	probePath := fs.String("probe-path", "", "健康探测路径或与BaseURL同主机的完整URL (可选, 默认/v1/models)")
+	probeMethod := fs.String("probe-method", "", "健康探测HTTP方法 (可选, 默认GET)")
+	probeBody := fs.String("probe-body", "", "健康探测JSON请求体 (可选)")
+	probeStatus := fs.String("probe-status", "", "视为健康的状态码 (可选, 逗号分隔, 默认任意2xx)")
+	tenant := fs.String("tenant", "", "所属租户，只服务同租户的API Key (可选, 默认default)")
+	deployments := fs.String("deployments", "", "Azure模型到部署名的映射 (可选, 格式: model=deployment,model2=deployment2)")
+	apiVersion := fs.String("api-version", "", "Azure api-version (可选, 默认"+converter.DefaultAzureAPIVersion+")")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	if *weight < 0 {
+		return fmt.Errorf("权重不能为负数: %d", *weight)
+	}
+	if err := types.ValidateTenant(*tenant); err != nil {
+		return err
+	}
+	if *baseURL != "" {
+		if _, err := types.NormalizeBaseURL(*baseURL); err != nil {
+			return err
+		}
+	}
+
+	healthProbe, err := parseHealthProbe(*probePath, *probeMethod, *probeBody, *probeStatus)
+	if err != nil {
+		return err
+	}
+
+	tags, err := types.ParseTags(*tagsFlag)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
 
 	if *accountType == "" {
 		return fmt.Errorf("缺少必要参数: --type")
@@ -391,6 +620,9 @@ func handleUpstreamAdd(args []string, app *app.Application) error {
 		providerType = types.ProviderGoogle
 	case "azure":
 		providerType = types.ProviderAzure
+		if *baseURL == "" {
+			return fmt.Errorf("Azure账号缺少参数: --base-url (如 https://{resource}.openai.azure.com)")
+		}
 	case "qwen":
 		providerType = types.ProviderQwen
 	default:
@@ -399,16 +631,42 @@ func handleUpstreamAdd(args []string, app *app.Application) error {
 
 	// 创建上游账号
 	account := &types.UpstreamAccount{
-		Name:     *name,
-		Type:     upstreamType,
-		Provider: providerType,
-		BaseURL:  *baseURL,
-		Status:   "active",
+		Name:        *name,
+		Type:        upstreamType,
+		Provider:    providerType,
+		BaseURL:     *baseURL,
+		Status:      "active",
+		Description: *description,
+		CreatedBy:   *createdBy,
+		Tags:        tags,
+		Weight:      *weight,
+		HealthProbe: healthProbe,
+		Tenant:      *tenant,
+		APIVersion:  *apiVersion,
+	}
+	if *deployments != "" {
+		deploymentMap, err := types.ParseTags(*deployments)
+		if err != nil {
+			return fmt.Errorf("无效的部署映射: %w", err)
+		}
+		account.DeploymentMap = deploymentMap
 	}
 
 	// 设置认证信息
 	if upstreamType == types.UpstreamTypeAPIKey {
 		account.APIKey = *apiKey
+		for _, key := range strings.Split(*extraKeys, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				account.APIKeys = append(account.APIKeys, key)
+			}
+		}
+		if *keyExpiresAt != "" {
+			expiresAt, err := parseExpiryTime(*keyExpiresAt)
+			if err != nil {
+				return err
+			}
+			account.APIKeyExpiresAt = &expiresAt
+		}
 	}
 	// OAuth账号不需要设置client credentials，使用固定配置
 
@@ -422,12 +680,13 @@ func handleUpstreamAdd(args []string, app *app.Application) error {
 	fmt.Printf("  名称: %s\n", account.Name)
 	fmt.Printf("  类型: %s\n", account.Type)
 	fmt.Printf("  提供商: %s\n", account.Provider)
+	fmt.Printf("  租户: %s\n", account.TenantID())
 	fmt.Printf("  状态: %s\n", account.Status)
 
 	// 如果是OAuth账号，启动交互式授权流程
 	if upstreamType == types.UpstreamTypeOAuth {
 		fmt.Printf("\n🔐 开始OAuth授权流程...\n")
-		if err := startInteractiveOAuth(app, account.ID); err != nil {
+		if err := startInteractiveOAuth(newPrompter(os.Stdin, os.Stdout), app, account.ID); err != nil {
 			fmt.Printf("⚠️  授权流程失败: %v\n", err)
 			fmt.Printf("💡 账号已创建但未授权，稍后可运行:\n")
 			fmt.Printf("   ./llm-gateway oauth start %s\n", account.ID)
@@ -437,8 +696,72 @@ func handleUpstreamAdd(args []string, app *app.Application) error {
 	return nil
 }
 
+// parseHealthProbe 根据命令行参数构造健康探测配置，均未指定时返回nil使用默认探测
+func parseHealthProbe(path, method, body, status string) (*types.HealthProbe, error) {
+	if path == "" && method == "" && body == "" && status == "" {
+		return nil, nil
+	}
+
+	probe := &types.HealthProbe{Path: path, Method: strings.ToUpper(method), Body: body}
+	for _, item := range strings.Split(status, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		code, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的探测状态码: %s", item)
+		}
+		probe.ExpectStatus = append(probe.ExpectStatus, code)
+	}
+	if err := probe.Validate(); err != nil {
+		return nil, err
+	}
+	return probe, nil
+}
+
+// parseExpiryTime 解析到期时间，支持日期（当天结束时到期）和RFC3339格式
+func parseExpiryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("无效的到期时间: %s (支持格式: 2006-01-02 或 RFC3339)", value)
+}
+
+// formatCredentialExpiry 格式化API Key凭据到期信息
+func formatCredentialExpiry(account *types.UpstreamAccount) string {
+	expiresAt := account.APIKeyExpiresAt.Format("2006-01-02 15:04:05")
+	now := time.Now()
+	switch {
+	case account.IsAPIKeyExpired(now):
+		return expiresAt + " (已过期，账号不可用)"
+	case account.IsAPIKeyExpiringSoon(now, types.CredentialExpiryWarning):
+		return expiresAt + " (即将到期)"
+	}
+	return expiresAt
+}
+
 func handleUpstreamList(args []string, app *app.Application) error {
-	accounts := app.UpstreamMgr.ListAccounts()
+	fs := flag.NewFlagSet("upstream list", flag.ContinueOnError)
+	tagFlag := fs.String("tag", "", "只列出包含指定标签的账号 (格式: key=value,key2=value2)")
+	tenant := fs.String("tenant", "", "只列出指定租户的账号")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	selector, err := types.ParseTags(*tagFlag)
+	if err != nil {
+		return err
+	}
+	var accounts []*types.UpstreamAccount
+	for _, account := range app.UpstreamMgr.FindAccountsByTags(selector) {
+		if *tenant == "" || account.TenantID() == *tenant {
+			accounts = append(accounts, account)
+		}
+	}
 
 	if len(accounts) == 0 {
 		fmt.Println("没有找到上游账号")
@@ -452,9 +775,22 @@ func handleUpstreamList(args []string, app *app.Application) error {
 		fmt.Printf("  名称: %s\n", account.Name)
 		fmt.Printf("  类型: %s\n", account.Type)
 		fmt.Printf("  提供商: %s\n", account.Provider)
+		fmt.Printf("  租户: %s\n", account.TenantID())
 		fmt.Printf("  状态: %s\n", account.Status)
 		fmt.Printf("  健康状态: %s\n", account.HealthStatus)
+		if account.APIKeyExpiresAt != nil {
+			fmt.Printf("  密钥到期: %s\n", formatCredentialExpiry(account))
+		}
 		fmt.Printf("  创建时间: %s\n", account.CreatedAt.Format("2006-01-02 15:04:05"))
+		if account.CreatedBy != "" {
+			fmt.Printf("  创建人: %s\n", account.CreatedBy)
+		}
+		if account.Description != "" {
+			fmt.Printf("  备注: %s\n", account.Description)
+		}
+		if len(account.Tags) > 0 {
+			fmt.Printf("  标签: %s\n", types.FormatTags(account.Tags))
+		}
 
 		if account.Usage != nil {
 			fmt.Printf("  总请求数: %d\n", account.Usage.TotalRequests)
@@ -491,24 +827,69 @@ func handleUpstreamShow(args []string, app *app.Application) error {
 	fmt.Printf("名称: %s\n", account.Name)
 	fmt.Printf("类型: %s\n", account.Type)
 	fmt.Printf("提供商: %s\n", account.Provider)
+	fmt.Printf("租户: %s\n", account.TenantID())
 	fmt.Printf("状态: %s\n", account.Status)
 	fmt.Printf("健康状态: %s\n", account.HealthStatus)
 	fmt.Printf("创建时间: %s\n", account.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("更新时间: %s\n", account.UpdatedAt.Format("2006-01-02 15:04:05"))
+	if account.CreatedBy != "" {
+		fmt.Printf("创建人: %s\n", account.CreatedBy)
+	}
+	if account.Description != "" {
+		fmt.Printf("备注: %s\n", account.Description)
+	}
+	if len(account.Tags) > 0 {
+		fmt.Printf("标签: %s\n", types.FormatTags(account.Tags))
+	}
+	if account.Weight > 0 {
+		fmt.Printf("权重: %d\n", account.Weight)
+	}
+	if account.Provider == types.ProviderAzure {
+		if len(account.DeploymentMap) > 0 {
+			fmt.Printf("部署映射: %s\n", types.FormatTags(account.DeploymentMap))
+		}
+		if account.APIVersion != "" {
+			fmt.Printf("API版本: %s\n", account.APIVersion)
+		}
+	}
+	if probe := account.HealthProbe; probe != nil {
+		method, path := probe.Method, probe.Path
+		if method == "" {
+			method = "GET"
+		}
+		if path == "" {
+			path = "/v1/models"
+		}
+		fmt.Printf("健康探测: %s %s", method, path)
+		if len(probe.ExpectStatus) > 0 {
+			fmt.Printf(" (期望状态码: %v)", probe.ExpectStatus)
+		}
+		fmt.Println()
+	}
 
 	if account.LastHealthCheck != nil {
 		fmt.Printf("最后健康检查: %s\n", account.LastHealthCheck.Format("2006-01-02 15:04:05"))
 	}
 
+	if account.Capabilities != nil {
+		printUpstreamCapabilities(account.Capabilities)
+	}
+
 	if account.Type == types.UpstreamTypeAPIKey {
-		fmt.Printf("API Key: %s***\n", account.APIKey[:8])
+		fmt.Printf("API Key: %s\n", types.MaskKey(account.APIKey))
+		if pool := account.APIKeyPool(); len(pool) > 1 {
+			fmt.Printf("API Key轮换池: %d 个\n", len(pool))
+		}
+		if account.APIKeyExpiresAt != nil {
+			fmt.Printf("API Key到期时间: %s\n", formatCredentialExpiry(account))
+		}
 	} else {
 		fmt.Printf("Client ID: %s\n", account.ClientID)
 		if account.ExpiresAt != nil {
 			fmt.Printf("Token过期时间: %s\n", account.ExpiresAt.Format("2006-01-02 15:04:05"))
 		}
 		if account.AccessToken != "" {
-			fmt.Printf("Access Token: %s***\n", account.AccessToken[:8])
+			fmt.Printf("Access Token: %s\n", types.MaskKey(account.AccessToken))
 		}
 	}
 
@@ -530,6 +911,52 @@ func handleUpstreamShow(args []string, app *app.Application) error {
 	return nil
 }
 
+func handleUpstreamUpdate(args []string, app *app.Application) error {
+	if len(args) == 0 {
+		return fmt.Errorf("缺少参数: <upstream-id>")
+	}
+
+	upstreamID := args[0]
+
+	fs := flag.NewFlagSet("upstream update", flag.ContinueOnError)
+	name := fs.String("name", "", "账号名称")
+	baseURL := fs.String("base-url", "", "自定义API端点URL (传空字符串恢复默认端点)")
+	apiKey := fs.String("key", "", "API密钥 (仅api-key类型账号)")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	// 只修改显式指定的参数
+	var update upstream.AccountUpdate
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			update.Name = name
+		case "base-url":
+			update.BaseURL = baseURL
+		case "key":
+			update.APIKey = apiKey
+		}
+	})
+	if update.Name == nil && update.BaseURL == nil && update.APIKey == nil {
+		return fmt.Errorf("缺少必要参数: --name、--base-url 或 --key")
+	}
+
+	if err := app.UpstreamMgr.UpdateAccount(upstreamID, update); err != nil {
+		return fmt.Errorf("更新上游账号失败: %w", err)
+	}
+
+	account, err := app.UpstreamMgr.GetAccount(upstreamID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("成功更新上游账号 %s:\n", upstreamID)
+	fmt.Printf("  名称: %s\n", account.Name)
+	fmt.Printf("  端点: %s\n", app.UpstreamMgr.GetBaseURL(account))
+	return nil
+}
+
 func handleUpstreamRemove(args []string, app *app.Application) error {
 	if len(args) == 0 {
 		return fmt.Errorf("缺少参数: <upstream-id>")
@@ -554,7 +981,11 @@ func handleUpstreamRemove(args []string, app *app.Application) error {
 
 func handleUpstreamEnable(args []string, app *app.Application) error {
 	if len(args) == 0 {
-		return fmt.Errorf("缺少参数: <upstream-id>")
+		return fmt.Errorf("缺少参数: <upstream-id> 或 --tag key=value")
+	}
+
+	if isFlagArg(args[0]) {
+		return handleUpstreamBatchStatus("upstream enable", args, "active", app)
 	}
 
 	upstreamID := args[0]
@@ -570,7 +1001,11 @@ func handleUpstreamEnable(args []string, app *app.Application) error {
 
 func handleUpstreamDisable(args []string, app *app.Application) error {
 	if len(args) == 0 {
-		return fmt.Errorf("缺少参数: <upstream-id>")
+		return fmt.Errorf("缺少参数: <upstream-id> 或 --tag key=value")
+	}
+
+	if isFlagArg(args[0]) {
+		return handleUpstreamBatchStatus("upstream disable", args, "disabled", app)
 	}
 
 	upstreamID := args[0]
@@ -584,6 +1019,248 @@ func handleUpstreamDisable(args []string, app *app.Application) error {
 	return nil
 }
 
+// isFlagArg 判断参数是否为命令行选项（而非账号ID）
+func isFlagArg(arg string) bool {
+	return strings.HasPrefix(arg, "-")
+}
+
+// parseTagSelector 解析批量操作的 --tag 参数
+func parseTagSelector(name string, args []string, extra func(fs *flag.FlagSet)) (map[string]string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	tagFlag := fs.String("tag", "", "按标签批量操作 (格式: key=value,key2=value2)")
+	if extra != nil {
+		extra(fs)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *tagFlag == "" {
+		return nil, fmt.Errorf("缺少必要参数: --tag")
+	}
+	return types.ParseTags(*tagFlag)
+}
+
+// printBatchResults 打印批量操作结果，有失败时返回错误
+func printBatchResults(action string, results []upstream.BatchResult) error {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("  ❌ %s (%s): %v\n", result.Name, result.UpstreamID, result.Err)
+		} else {
+			fmt.Printf("  ✅ %s (%s)\n", result.Name, result.UpstreamID)
+		}
+	}
+
+	fmt.Printf("\n%s完成: 共%d个，成功%d个，失败%d个\n", action, len(results), len(results)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d个账号%s失败", failed, action)
+	}
+	return nil
+}
+
+// handleUpstreamBatchStatus 按标签批量启用/禁用账号
+func handleUpstreamBatchStatus(name string, args []string, status string, app *app.Application) error {
+	selector, err := parseTagSelector(name, args, nil)
+	if err != nil {
+		return err
+	}
+
+	results, err := app.UpstreamMgr.BatchUpdateStatus(selector, status)
+	if err != nil {
+		return err
+	}
+
+	action := "启用"
+	if status == "disabled" {
+		action = "禁用"
+	}
+	fmt.Printf("按标签 %s 批量%s上游账号:\n", types.FormatTags(selector), action)
+	return printBatchResults(action, results)
+}
+
+func handleUpstreamTag(args []string, app *app.Application) error {
+	if len(args) == 0 {
+		return fmt.Errorf("缺少参数: <upstream-id>")
+	}
+
+	upstreamID := args[0]
+
+	fs := flag.NewFlagSet("upstream tag", flag.ContinueOnError)
+	setFlag := fs.String("set", "", "添加或修改标签 (格式: key=value,key2=value2)")
+	removeFlag := fs.String("remove", "", "删除标签 (格式: key1,key2)")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *setFlag == "" && *removeFlag == "" {
+		return fmt.Errorf("缺少必要参数: --set 或 --remove")
+	}
+
+	tags, err := types.ParseTags(*setFlag)
+	if err != nil {
+		return err
+	}
+	for _, key := range strings.Split(*removeFlag, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			tags[key] = ""
+		}
+	}
+
+	if err := app.UpstreamMgr.UpdateAccountTags(upstreamID, tags); err != nil {
+		return fmt.Errorf("更新上游账号标签失败: %w", err)
+	}
+
+	account, err := app.UpstreamMgr.GetAccount(upstreamID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("成功更新上游账号 %s 的标签: %s\n", upstreamID, types.FormatTags(account.Tags))
+	return nil
+}
+
+func handleUpstreamHealth(args []string, app *app.Application) error {
+	if len(args) == 0 {
+		return fmt.Errorf("缺少参数: <upstream-id> 或 --tag key=value")
+	}
+
+	var timeout time.Duration
+	withTimeout := func(fs *flag.FlagSet) {
+		fs.DurationVar(&timeout, "timeout", upstream.DefaultProbeTimeout, "单个账号探测超时")
+	}
+
+	if !isFlagArg(args[0]) {
+		upstreamID := args[0]
+		fs := flag.NewFlagSet("upstream health", flag.ContinueOnError)
+		withTimeout(fs)
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		if err := app.UpstreamMgr.CheckAccountHealth(upstreamID, timeout); err != nil {
+			return fmt.Errorf("上游账号 %s 健康检查失败: %w", upstreamID, err)
+		}
+		fmt.Printf("上游账号 %s 健康\n", upstreamID)
+		return nil
+	}
+
+	selector, err := parseTagSelector("upstream health", args, withTimeout)
+	if err != nil {
+		return err
+	}
+
+	results, err := app.UpstreamMgr.BatchCheckHealth(selector, timeout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("按标签 %s 批量健康检查上游账号:\n", types.FormatTags(selector))
+	return printBatchResults("健康检查", results)
+}
+
+func handleUpstreamDiscover(args []string, app *app.Application) error {
+	if len(args) == 0 {
+		return fmt.Errorf("缺少参数: <upstream-id>")
+	}
+
+	upstreamID := args[0]
+
+	fs := flag.NewFlagSet("upstream discover", flag.ContinueOnError)
+	model := fs.String("model", "", "探测使用的模型 (默认取模型列表中的第一个)")
+	timeout := fs.Duration("timeout", upstream.DefaultProbeTimeout, "单次探测请求超时")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	fmt.Printf("🔍 正在探测上游账号 %s 的能力...\n", upstreamID)
+	capabilities, err := app.UpstreamMgr.DiscoverCapabilities(upstreamID, *model, *timeout)
+	if err != nil {
+		return fmt.Errorf("能力探测失败: %w", err)
+	}
+
+	printUpstreamCapabilities(capabilities)
+	if capabilities.ProbeModel == "" {
+		fmt.Println("💡 未获取到模型列表，可使用 --model 指定模型以探测对话端点")
+	}
+	return nil
+}
+
+// maxUpstreamTestOutput upstream test 打印响应体的最大字符数
+const maxUpstreamTestOutput = 500
+
+func handleUpstreamTest(args []string, app *app.Application) error {
+	if len(args) == 0 {
+		return fmt.Errorf("缺少参数: <upstream-id>")
+	}
+
+	upstreamID := args[0]
+
+	fs := flag.NewFlagSet("upstream test", flag.ContinueOnError)
+	model := fs.String("model", "", "测试使用的模型 (默认按提供商选择)")
+	timeout := fs.Duration("timeout", upstream.DefaultProbeTimeout, "请求超时")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	result, err := app.HTTPServer.CheckUpstream(upstreamID, *model, *timeout)
+	if err != nil {
+		return fmt.Errorf("测试请求失败: %w", err)
+	}
+
+	fmt.Printf("上游账号: %s\n", result.UpstreamID)
+	fmt.Printf("模型: %s\n", result.Model)
+	if result.StatusCode != 0 {
+		fmt.Printf("状态码: %d\n", result.StatusCode)
+	}
+	fmt.Printf("耗时: %s\n", result.Latency.Round(time.Millisecond))
+	if len(result.Response) > 0 {
+		fmt.Printf("响应: %s\n", truncateOutput(string(result.Response), maxUpstreamTestOutput))
+	}
+	if result.Err != nil {
+		return fmt.Errorf("上游账号 %s 测试失败: %w", upstreamID, result.Err)
+	}
+	fmt.Println("✅ 测试请求成功")
+	return nil
+}
+
+// truncateOutput 截断过长的输出，超出部分以省略号表示
+func truncateOutput(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "..."
+}
+
+// printUpstreamCapabilities 打印能力探测结果
+func printUpstreamCapabilities(capabilities *types.UpstreamCapabilities) {
+	formatSupport := func(value *bool) string {
+		switch {
+		case value == nil:
+			return "未知"
+		case *value:
+			return "支持"
+		default:
+			return "不支持"
+		}
+	}
+
+	fmt.Printf("\n能力信息 (探测于 %s):\n", capabilities.DiscoveredAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  可用端点: %s\n", strings.Join(capabilities.Endpoints, ", "))
+	fmt.Printf("  流式响应: %s\n", formatSupport(capabilities.Streaming))
+	fmt.Printf("  工具调用: %s\n", formatSupport(capabilities.Tools))
+	if capabilities.ProbeModel != "" {
+		fmt.Printf("  探测模型: %s\n", capabilities.ProbeModel)
+	}
+	fmt.Printf("  模型数量: %d\n", len(capabilities.Models))
+	for _, model := range capabilities.Models {
+		fmt.Printf("    - %s\n", model)
+	}
+}
+
 func handleServer(args []string, app *app.Application) error {
 	if len(args) == 0 {
 		printServerUsage()
@@ -636,13 +1313,32 @@ func handleServerStart(args []string, app *app.Application) error {
 	fmt.Printf("  活跃上游账号: %d个\n", activeUpstreams)
 	fmt.Println()
 
-	// 启动HTTP服务器 (这会阻塞)
+	// 启动HTTP服务器，收到SIGINT/SIGTERM后优雅关闭
 	fmt.Println("服务器启动中，按 Ctrl+C 停止...")
-	if err := app.HTTPServer.Start(); err != nil {
-		return fmt.Errorf("启动服务器失败: %w", err)
-	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- app.HTTPServer.Start() }()
 
-	return nil
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	select {
+	case err := <-errCh:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("启动服务器失败: %w", err)
+		}
+		return nil
+	case sig := <-sigCh:
+		grace := app.HTTPServer.ShutdownGracePeriod()
+		fmt.Printf("\n收到信号 %v，等待进行中的请求完成（最长%v）...\n", sig, grace)
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		if err := app.HTTPServer.Stop(ctx); err != nil {
+			fmt.Printf("宽限期内未全部完成，已强制关闭剩余连接: %v\n", err)
+		}
+		fmt.Println("服务器已停止")
+		return nil
+	}
 }
 
 func handleServerStatus(args []string, app *app.Application) error {
@@ -657,7 +1353,7 @@ func handleServerStatus(args []string, app *app.Application) error {
 	gatewayKeys := app.GatewayKeyMgr.ListKeys()
 	activeKeys := 0
 	for _, key := range gatewayKeys {
-		if key.Status == "active" {
+		if key.IsActive(time.Now()) {
 			activeKeys++
 		}
 	}
@@ -694,9 +1390,17 @@ func handleServerStatus(args []string, app *app.Application) error {
 		}
 	}
 
+	// 凭据到期提醒
+	now := time.Now()
+	for _, account := range upstreamAccounts {
+		if account.IsAPIKeyExpired(now) || account.IsAPIKeyExpiringSoon(now, types.CredentialExpiryWarning) {
+			fmt.Printf("  ⚠️  %s (%s) API Key到期: %s\n", account.Name, account.ID, formatCredentialExpiry(account))
+		}
+	}
+
 	// 负载均衡策略
 	fmt.Printf("\n负载均衡:\n")
-	fmt.Printf("  策略: health_first\n") // 硬编码，因为我们在app.go中设置的
+	fmt.Printf("  策略: %s\n", app.Router.Strategy())
 
 	return nil
 }
@@ -715,6 +1419,8 @@ func handleOAuth(args []string, app *app.Application) error {
 		return handleOAuthStatus(args[1:], app)
 	case "refresh":
 		return handleOAuthRefresh(args[1:], app)
+	case "revoke":
+		return handleOAuthRevoke(args[1:], app)
 	default:
 		fmt.Printf("未知的oauth子命令: %s\n\n", subcommand)
 		printOAuthUsage()
@@ -730,6 +1436,7 @@ func printOAuthUsage() {
 	fmt.Println("  start      启动OAuth授权流程")
 	fmt.Println("  status     查看OAuth状态")
 	fmt.Println("  refresh    刷新OAuth token")
+	fmt.Println("  revoke     清除OAuth token，账号停用直到重新授权")
 }
 
 func handleOAuthStart(args []string, app *app.Application) error {
@@ -738,7 +1445,7 @@ func handleOAuthStart(args []string, app *app.Application) error {
 	}
 
 	upstreamID := args[0]
-	return startInteractiveOAuth(app, upstreamID)
+	return startInteractiveOAuth(newPrompter(os.Stdin, os.Stdout), app, upstreamID)
 }
 
 func handleOAuthStatus(args []string, app *app.Application) error {
@@ -797,18 +1504,24 @@ func handleOAuthRefresh(args []string, app *app.Application) error {
 	return nil
 }
 
-func handleSystemStatus(args []string, app *app.Application) error {
-	fmt.Println("系统状态查询功能待实现")
-	return nil
-}
+func handleOAuthRevoke(args []string, app *app.Application) error {
+	if len(args) == 0 {
+		return fmt.Errorf("缺少参数: <upstream-id>")
+	}
+
+	upstreamID := args[0]
+	if err := app.UpstreamMgr.RevokeOAuthTokens(upstreamID); err != nil {
+		return fmt.Errorf("清除OAuth token失败: %w", err)
+	}
 
-func handleHealthCheck(args []string, app *app.Application) error {
-	fmt.Println("健康检查功能待实现")
+	fmt.Printf("✅ 已清除OAuth token: %s\n", upstreamID)
+	fmt.Printf("💡 账号已停用，运行以下命令重新授权:\n")
+	fmt.Printf("   ./llm-gateway oauth start %s\n", upstreamID)
 	return nil
 }
 
-// startInteractiveOAuth 启动交互式OAuth授权流程
-func startInteractiveOAuth(app *app.Application, upstreamID string) error {
+// startInteractiveOAuth 启动交互式OAuth授权流程，通过p读取授权码并输出提示
+func startInteractiveOAuth(p *prompter, app *app.Application, upstreamID string) error {
 	// 验证账号存在且为OAuth类型
 	account, err := app.UpstreamMgr.GetAccount(upstreamID)
 	if err != nil {
@@ -825,14 +1538,14 @@ func startInteractiveOAuth(app *app.Application, upstreamID string) error {
 		return fmt.Errorf("启动OAuth流程失败: %w", err)
 	}
 
-	fmt.Printf("🌐 请在浏览器中访问以下URL完成授权:\n")
-	fmt.Printf("%s\n\n", authURL)
+	fmt.Fprintf(p.out, "🌐 请在浏览器中访问以下URL完成授权:\n")
+	fmt.Fprintf(p.out, "%s\n\n", authURL)
 
 	// 根据provider类型决定不同的处理方式
 	if account.Provider == types.ProviderQwen {
 		// Qwen使用Device Flow，自动轮询，等待授权完成
-		fmt.Printf("⏳ 正在等待授权完成（自动轮询中）...\n")
-		fmt.Printf("💡 按 Ctrl+C 可以取消等待，授权流程会在后台继续\n\n")
+		fmt.Fprintf(p.out, "⏳ 正在等待授权完成（自动轮询中）...\n")
+		fmt.Fprintf(p.out, "💡 按 Ctrl+C 可以取消等待，授权流程会在后台继续\n\n")
 
 		// 等待足够长的时间让轮询完成（或者用户取消）
 		// 这里可以设置一个合理的等待时间，比如15分钟
@@ -841,21 +1554,18 @@ func startInteractiveOAuth(app *app.Application, upstreamID string) error {
 		return nil // 如果到达这里，通常是用户按了Ctrl+C
 	} else {
 		// Anthropic等使用Authorization Code Flow
-		fmt.Printf("⏳ 请输入授权后获得的code（或按Enter跳过）: ")
-
 		// 读取用户输入的authorization code
-		var code string
-		_, _ = fmt.Scanln(&code)
+		code, _ := p.ask("⏳ 请粘贴授权页面显示的完整code（格式为 code#state，或按Enter跳过）", "")
 
 		if code == "" {
-			fmt.Printf("⚠️  授权流程已跳过\n")
-			fmt.Printf("💡 稍后可运行以下命令完成授权:\n")
-			fmt.Printf("   ./llm-gateway oauth start %s\n", upstreamID)
+			fmt.Fprintf(p.out, "⚠️  授权流程已跳过\n")
+			fmt.Fprintf(p.out, "💡 稍后可运行以下命令完成授权:\n")
+			fmt.Fprintf(p.out, "   ./llm-gateway oauth start %s\n", upstreamID)
 			return nil
 		}
 
 		// 处理OAuth回调
-		fmt.Printf("🔄 处理授权回调...\n")
+		fmt.Fprintf(p.out, "🔄 处理授权回调...\n")
 		if err := app.OAuthMgr.HandleCallback(upstreamID, code); err != nil {
 			return fmt.Errorf("处理OAuth回调失败: %w", err)
 		}
@@ -866,18 +1576,18 @@ func startInteractiveOAuth(app *app.Application, upstreamID string) error {
 			return err
 		}
 
-		fmt.Printf("✅ 授权成功！\n")
-		fmt.Printf("🎉 OAuth账号 \"%s\" 已就绪并可用\n\n", account.Name)
+		fmt.Fprintf(p.out, "✅ 授权成功！\n")
+		fmt.Fprintf(p.out, "🎉 OAuth账号 \"%s\" 已就绪并可用\n\n", account.Name)
 
-		fmt.Printf("账号详情:\n")
-		fmt.Printf("  ID: %s\n", account.ID)
-		fmt.Printf("  名称: %s\n", account.Name)
-		fmt.Printf("  类型: %s\n", account.Type)
-		fmt.Printf("  提供商: %s\n", account.Provider)
-		fmt.Printf("  状态: %s ✅\n", account.Status)
+		fmt.Fprintf(p.out, "账号详情:\n")
+		fmt.Fprintf(p.out, "  ID: %s\n", account.ID)
+		fmt.Fprintf(p.out, "  名称: %s\n", account.Name)
+		fmt.Fprintf(p.out, "  类型: %s\n", account.Type)
+		fmt.Fprintf(p.out, "  提供商: %s\n", account.Provider)
+		fmt.Fprintf(p.out, "  状态: %s ✅\n", account.Status)
 
 		if account.ExpiresAt != nil {
-			fmt.Printf("  Token有效期: %s\n", account.ExpiresAt.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(p.out, "  Token有效期: %s\n", account.ExpiresAt.Format("2006-01-02 15:04:05"))
 		}
 
 		return nil
@@ -922,8 +1632,10 @@ func printEnvironmentUsage() {
 	fmt.Println("示例:")
 	fmt.Println("  llm-gateway env list")
 	fmt.Println("  llm-gateway env set --http-proxy=http://proxy:8080")
+	fmt.Println("  llm-gateway env set --key=ALL_PROXY --value=socks5://proxy:1080")
 	fmt.Println("  llm-gateway env show --name=http_proxy")
 	fmt.Println("  llm-gateway env unset --name=http_proxy")
+	fmt.Println("  llm-gateway env unset --name=ALL_PROXY")
 }
 
 func handleEnvList(args []string, app *app.Application) error {
@@ -933,26 +1645,56 @@ func handleEnvList(args []string, app *app.Application) error {
 	fmt.Printf("  HTTP Proxy:  %s\n", config.Environment.HTTPProxy)
 	fmt.Printf("  HTTPS Proxy: %s\n", config.Environment.HTTPSProxy)
 	fmt.Printf("  No Proxy:    %s\n", config.Environment.NoProxy)
+	extraNames := sortedEnvNames(config.Environment.Extra)
+	for _, name := range extraNames {
+		fmt.Printf("  %s: %s\n", name, config.Environment.Extra[name])
+	}
 
 	fmt.Println()
 	fmt.Println("当前运行时环境变量:")
 	fmt.Printf("  HTTP_PROXY:  %s\n", os.Getenv("HTTP_PROXY"))
 	fmt.Printf("  HTTPS_PROXY: %s\n", os.Getenv("HTTPS_PROXY"))
 	fmt.Printf("  NO_PROXY:    %s\n", os.Getenv("NO_PROXY"))
+	for _, name := range extraNames {
+		fmt.Printf("  %s: %s\n", name, os.Getenv(name))
+	}
 
 	return nil
 }
 
+// sortedEnvNames 返回额外环境变量名，按字典序排列
+func sortedEnvNames(extra map[string]string) []string {
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func handleEnvSet(args []string, app *app.Application) error {
 	fs := flag.NewFlagSet("env set", flag.ContinueOnError)
 	httpProxy := fs.String("http-proxy", "", "HTTP代理地址")
 	httpsProxy := fs.String("https-proxy", "", "HTTPS代理地址")
 	noProxy := fs.String("no-proxy", "", "不使用代理的地址列表")
+	key := fs.String("key", "", "额外环境变量名称，如 ALL_PROXY、SSL_CERT_FILE")
+	value := fs.String("value", "", "额外环境变量的值（与 --key 一起使用）")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
+	if *key != "" {
+		if err := types.ValidateEnvName(*key); err != nil {
+			return err
+		}
+		if *value == "" {
+			return fmt.Errorf("缺少必要参数: --value (清除环境变量请使用 env unset --name=%s)", *key)
+		}
+	} else if *value != "" {
+		return fmt.Errorf("缺少必要参数: --key")
+	}
+
 	config := app.Config.Get()
 	modified := false
 
@@ -974,6 +1716,15 @@ func handleEnvSet(args []string, app *app.Application) error {
 		fmt.Printf("✅ 设置 NO_PROXY = %s\n", *noProxy)
 	}
 
+	if *key != "" {
+		if config.Environment.Extra == nil {
+			config.Environment.Extra = make(map[string]string)
+		}
+		config.Environment.Extra[*key] = *value
+		modified = true
+		fmt.Printf("✅ 设置 %s = %s\n", *key, *value)
+	}
+
 	if !modified {
 		fmt.Println("❌ 未指定任何环境变量设置")
 		printEnvironmentUsage()
@@ -991,7 +1742,7 @@ func handleEnvSet(args []string, app *app.Application) error {
 
 func handleEnvUnset(args []string, app *app.Application) error {
 	fs := flag.NewFlagSet("env unset", flag.ContinueOnError)
-	name := fs.String("name", "", "要清除的环境变量名称 (http_proxy, https_proxy, no_proxy)")
+	name := fs.String("name", "", "要清除的环境变量名称 (http_proxy, https_proxy, no_proxy 或通过 --key 设置的名称)")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -1018,7 +1769,12 @@ func handleEnvUnset(args []string, app *app.Application) error {
 		modified = true
 		fmt.Println("✅ 已清除 NO_PROXY 配置")
 	default:
-		return fmt.Errorf("不支持的环境变量名称: %s (支持: http_proxy, https_proxy, no_proxy)", *name)
+		if _, ok := config.Environment.Extra[*name]; !ok {
+			return fmt.Errorf("未配置的环境变量: %s", *name)
+		}
+		delete(config.Environment.Extra, *name)
+		modified = true
+		fmt.Printf("✅ 已清除 %s 配置\n", *name)
 	}
 
 	if modified {
@@ -1034,7 +1790,7 @@ func handleEnvUnset(args []string, app *app.Application) error {
 
 func handleEnvShow(args []string, app *app.Application) error {
 	fs := flag.NewFlagSet("env show", flag.ContinueOnError)
-	name := fs.String("name", "", "要显示的环境变量名称 (http_proxy, https_proxy, no_proxy)")
+	name := fs.String("name", "", "要显示的环境变量名称 (http_proxy, https_proxy, no_proxy 或通过 --key 设置的名称)")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -1057,7 +1813,12 @@ func handleEnvShow(args []string, app *app.Application) error {
 		fmt.Printf("配置值: %s\n", config.Environment.NoProxy)
 		fmt.Printf("运行时值: %s\n", os.Getenv("NO_PROXY"))
 	default:
-		return fmt.Errorf("不支持的环境变量名称: %s (支持: http_proxy, https_proxy, no_proxy)", *name)
+		value, ok := config.Environment.Extra[*name]
+		if !ok {
+			return fmt.Errorf("未配置的环境变量: %s", *name)
+		}
+		fmt.Printf("配置值: %s\n", value)
+		fmt.Printf("运行时值: %s\n", os.Getenv(*name))
 	}
 
 	return nil
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/internal/app"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestHandleAPIKeyEnable(t *testing.T) {
+	application, err := app.NewApplication(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatalf("NewApplication() error = %v", err)
+	}
+	defer application.OAuthMgr.StopAutoRefresh()
+
+	key, _, err := application.GatewayKeyMgr.CreateKey("cli", []types.Permission{types.PermissionRead})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	if err := handleAPIKeyDisable([]string{key.ID}, application); err != nil {
+		t.Fatalf("handleAPIKeyDisable() error = %v", err)
+	}
+
+	if err := handleAPIKeyEnable([]string{key.ID}, application); err != nil {
+		t.Fatalf("handleAPIKeyEnable() error = %v", err)
+	}
+	got, err := application.GatewayKeyMgr.GetKey(key.ID)
+	if err != nil {
+		t.Fatalf("GetKey() error = %v", err)
+	}
+	if got.Status != "active" {
+		t.Errorf("Status = %q, want active", got.Status)
+	}
+
+	if err := handleAPIKeyEnable([]string{"unknown-key"}, application); err == nil {
+		t.Error("不存在的Key应返回错误")
+	}
+	if err := handleAPIKeyEnable(nil, application); err == nil {
+		t.Error("缺少key-id应返回错误")
+	}
+}
+
+func TestHandleUpstreamShow_ShortKey(t *testing.T) {
+	application, err := app.NewApplication(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatalf("NewApplication() error = %v", err)
+	}
+	defer application.OAuthMgr.StopAutoRefresh()
+
+	accounts := []*types.UpstreamAccount{
+		{ID: "up-short", Name: "short", Type: types.UpstreamTypeAPIKey, Provider: types.ProviderOpenAI, APIKey: "abc"},
+		{ID: "up-oauth", Name: "oauth", Type: types.UpstreamTypeOAuth, Provider: types.ProviderAnthropic, AccessToken: "tok"},
+	}
+	for _, account := range accounts {
+		if err := application.UpstreamMgr.AddAccount(account); err != nil {
+			t.Fatalf("AddAccount(%s) error = %v", account.ID, err)
+		}
+		// 短密钥不应导致越界panic
+		if err := handleUpstreamShow([]string{account.ID}, application); err != nil {
+			t.Errorf("handleUpstreamShow(%s) error = %v", account.ID, err)
+		}
+	}
+}
+
+func TestHandleUpstreamTest(t *testing.T) {
+	status := http.StatusOK
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			_, _ = w.Write([]byte(`{"error":{"type":"rate_limit_error","message":"slow down"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o-mini","choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	application, err := app.NewApplication(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatalf("NewApplication() error = %v", err)
+	}
+	defer application.OAuthMgr.StopAutoRefresh()
+
+	if err := application.UpstreamMgr.AddAccount(&types.UpstreamAccount{
+		ID: "up-test", Name: "test", Type: types.UpstreamTypeAPIKey, Provider: types.ProviderOpenAI, APIKey: "sk-test", BaseURL: upstreamServer.URL,
+	}); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+
+	if err := handleUpstreamTest([]string{"up-test"}, application); err != nil {
+		t.Errorf("上游正常时 handleUpstreamTest() error = %v", err)
+	}
+
+	status = http.StatusTooManyRequests
+	err = handleUpstreamTest([]string{"up-test", "--timeout", "2s"}, application)
+	if err == nil || !strings.Contains(err.Error(), "status=429") {
+		t.Errorf("上游返回错误时应报告状态码, error = %v", err)
+	}
+
+	if err := handleUpstreamTest(nil, application); err == nil {
+		t.Error("缺少upstream-id应返回错误")
+	}
+	if err := handleUpstreamTest([]string{"unknown"}, application); err == nil {
+		t.Error("不存在的账号应返回错误")
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	tests := []struct {
+		input string
+		max   int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"truncated", 5, "trunc..."},
+		{"中文内容截断", 2, "中文..."},
+	}
+	for _, tt := range tests {
+		if got := truncateOutput(tt.input, tt.max); got != tt.want {
+			t.Errorf("truncateOutput(%q, %d) = %q, want %q", tt.input, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestHandleEnvExtra(t *testing.T) {
+	application, err := app.NewApplication(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatalf("NewApplication() error = %v", err)
+	}
+	defer application.OAuthMgr.StopAutoRefresh()
+
+	if err := handleEnvSet([]string{"--key=ALL_PROXY", "--value=socks5://proxy:1080"}, application); err != nil {
+		t.Fatalf("handleEnvSet() error = %v", err)
+	}
+	if got := application.Config.Get().Environment.Extra["ALL_PROXY"]; got != "socks5://proxy:1080" {
+		t.Errorf("Extra[ALL_PROXY] = %q, want socks5://proxy:1080", got)
+	}
+	if err := handleEnvShow([]string{"--name=ALL_PROXY"}, application); err != nil {
+		t.Errorf("handleEnvShow() error = %v", err)
+	}
+	if err := handleEnvList(nil, application); err != nil {
+		t.Errorf("handleEnvList() error = %v", err)
+	}
+
+	// 配置已持久化，重新加载后仍然存在
+	reloaded, err := application.Config.Reload()
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := reloaded.Environment.Extra["ALL_PROXY"]; got != "socks5://proxy:1080" {
+		t.Errorf("重新加载后 Extra[ALL_PROXY] = %q", got)
+	}
+
+	if err := handleEnvUnset([]string{"--name=ALL_PROXY"}, application); err != nil {
+		t.Fatalf("handleEnvUnset() error = %v", err)
+	}
+	if _, ok := application.Config.Get().Environment.Extra["ALL_PROXY"]; ok {
+		t.Error("unset后不应保留ALL_PROXY")
+	}
+	if err := handleEnvShow([]string{"--name=ALL_PROXY"}, application); err == nil {
+		t.Error("未配置的环境变量show应返回错误")
+	}
+	if err := handleEnvUnset([]string{"--name=ALL_PROXY"}, application); err == nil {
+		t.Error("未配置的环境变量unset应返回错误")
+	}
+
+	invalid := [][]string{
+		{"--key=ALL_PROXY"},                  // 缺少value
+		{"--value=x"},                        // 缺少key
+		{"--key=1PROXY", "--value=x"},        // 非法名称
+		{"--key=http_proxy", "--value=x"},    // 已建模的代理变量
+		{"--key=MY-PROXY", "--value=socks5"}, // 非法字符
+	}
+	for _, args := range invalid {
+		if err := handleEnvSet(args, application); err == nil {
+			t.Errorf("handleEnvSet(%v) 应返回错误", args)
+		}
+	}
+}
+
+func TestHandleUpstreamAdd_BaseURL(t *testing.T) {
+	application, err := app.NewApplication(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatalf("NewApplication() error = %v", err)
+	}
+	defer application.OAuthMgr.StopAutoRefresh()
+
+	for _, baseURL := range []string{"api.example.com", "ftp://api.example.com", "https://"} {
+		args := []string{"--type=api-key", "--provider=openai", "--name=bad", "--key=sk-test", "--base-url=" + baseURL}
+		if err := handleUpstreamAdd(args, application); err == nil {
+			t.Errorf("无效的Base URL %q 应在添加时被拒绝", baseURL)
+		}
+	}
+	if accounts := application.UpstreamMgr.ListAccounts(); len(accounts) != 0 {
+		t.Fatalf("被拒绝的添加不应保存账号, got %d", len(accounts))
+	}
+
+	args := []string{"--type=api-key", "--provider=openai", "--name=custom", "--key=sk-test", "--base-url=https://proxy.example.com/openai/"}
+	if err := handleUpstreamAdd(args, application); err != nil {
+		t.Fatalf("handleUpstreamAdd() error = %v", err)
+	}
+	accounts := application.UpstreamMgr.ListAccounts()
+	if len(accounts) != 1 || accounts[0].BaseURL != "https://proxy.example.com/openai" {
+		t.Errorf("Base URL应规范化后保存, accounts = %+v", accounts)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/app"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// systemStatus status命令汇总的系统状态，不依赖服务器运行
+type systemStatus struct {
+	ConfigPath  string                `json:"config_path"`
+	Server      serverConfigStatus    `json:"server"`
+	GatewayKeys gatewayKeyStatus      `json:"gateway_keys"`
+	Upstreams   upstreamStatusSummary `json:"upstreams"`
+	Providers   []providerStatus      `json:"providers"`
+	Requests    requestStatusSummary  `json:"requests"`
+	Warnings    []string              `json:"warnings,omitempty"`
+}
+
+// serverConfigStatus HTTP服务器配置加载情况
+type serverConfigStatus struct {
+	Loaded     bool   `json:"loaded"`
+	Host       string `json:"host,omitempty"`
+	Port       int    `json:"port,omitempty"`
+	Timeout    int    `json:"timeout_seconds,omitempty"`
+	WebEnabled bool   `json:"web_enabled"`
+	Error      string `json:"error,omitempty"`
+}
+
+// gatewayKeyStatus Gateway API Key统计
+type gatewayKeyStatus struct {
+	Total  int `json:"total"`
+	Active int `json:"active"`
+}
+
+// upstreamStatusSummary 上游账号统计
+type upstreamStatusSummary struct {
+	Total   int `json:"total"`
+	Active  int `json:"active"`
+	Healthy int `json:"healthy"`
+}
+
+// providerStatus 单个提供商的上游账号统计
+type providerStatus struct {
+	Provider types.Provider       `json:"provider"`
+	Total    int                  `json:"total"`
+	Active   int                  `json:"active"`
+	Healthy  int                  `json:"healthy"`
+	Requests requestStatusSummary `json:"requests"`
+}
+
+// requestStatusSummary 请求计数汇总（来自上游账号Usage统计）
+type requestStatusSummary struct {
+	Total      int64   `json:"total"`
+	Successful int64   `json:"successful"`
+	Errors     int64   `json:"errors"`
+	ErrorRate  float64 `json:"error_rate"`
+}
+
+// add 累加一个上游账号的使用统计
+func (s *requestStatusSummary) add(usage *types.UpstreamUsageStats) {
+	if usage == nil {
+		return
+	}
+	s.Total += usage.TotalRequests
+	s.Successful += usage.SuccessfulRequests
+	s.Errors += usage.ErrorRequests
+	if s.Total > 0 {
+		s.ErrorRate = float64(s.Errors) / float64(s.Total)
+	}
+}
+
+func handleSystemStatus(args []string, app *app.Application) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	status := collectSystemStatus(app)
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+
+	printSystemStatus(status)
+	return nil
+}
+
+// collectSystemStatus 从配置和各管理器汇总系统状态
+func collectSystemStatus(app *app.Application) *systemStatus {
+	config := app.Config.Get()
+	status := &systemStatus{
+		ConfigPath: app.Config.GetConfigPath(),
+		Server: serverConfigStatus{
+			Loaded:     config != nil && config.Server.Port > 0,
+			WebEnabled: config != nil && config.Server.Web.Enabled,
+		},
+		Providers: []providerStatus{},
+	}
+	if config != nil {
+		status.Server.Host = config.Server.Host
+		status.Server.Port = config.Server.Port
+		status.Server.Timeout = config.Server.Timeout
+	}
+	if err := app.Config.Validate(); err != nil {
+		status.Server.Error = err.Error()
+	}
+
+	for _, key := range app.GatewayKeyMgr.ListKeys() {
+		status.GatewayKeys.Total++
+		if key.IsActive(time.Now()) {
+			status.GatewayKeys.Active++
+		}
+	}
+
+	providers := make(map[types.Provider]*providerStatus)
+	for _, account := range app.UpstreamMgr.ListAccounts() {
+		provider, exists := providers[account.Provider]
+		if !exists {
+			provider = &providerStatus{Provider: account.Provider}
+			providers[account.Provider] = provider
+		}
+
+		status.Upstreams.Total++
+		provider.Total++
+		if account.Status == "active" {
+			status.Upstreams.Active++
+			provider.Active++
+		}
+		if account.HealthStatus == "healthy" {
+			status.Upstreams.Healthy++
+			provider.Healthy++
+		}
+		status.Requests.add(account.Usage)
+		provider.Requests.add(account.Usage)
+	}
+
+	for _, provider := range providers {
+		status.Providers = append(status.Providers, *provider)
+	}
+	sort.Slice(status.Providers, func(i, j int) bool {
+		return status.Providers[i].Provider < status.Providers[j].Provider
+	})
+
+	if status.Upstreams.Active == 0 {
+		status.Warnings = append(status.Warnings, "没有活跃的上游账号")
+	}
+	if status.GatewayKeys.Active == 0 {
+		status.Warnings = append(status.Warnings, "没有活跃的Gateway API Key")
+	}
+
+	return status
+}
+
+// printSystemStatus 以文本格式输出系统状态
+func printSystemStatus(status *systemStatus) {
+	fmt.Println("LLM Gateway 系统状态:")
+	fmt.Printf("配置文件: %s\n", status.ConfigPath)
+
+	fmt.Printf("\n服务器配置:\n")
+	if status.Server.Loaded {
+		fmt.Printf("  已加载: 是\n")
+		fmt.Printf("  监听地址: %s:%d\n", status.Server.Host, status.Server.Port)
+		fmt.Printf("  请求超时: %d秒\n", status.Server.Timeout)
+	} else {
+		fmt.Printf("  已加载: 否\n")
+	}
+	if status.Server.WebEnabled {
+		fmt.Printf("  Web管理界面: 启用\n")
+	} else {
+		fmt.Printf("  Web管理界面: 禁用\n")
+	}
+	if status.Server.Error != "" {
+		fmt.Printf("  ⚠️  配置校验失败: %s\n", status.Server.Error)
+	}
+
+	fmt.Printf("\nGateway API Keys:\n")
+	fmt.Printf("  总数: %d个\n", status.GatewayKeys.Total)
+	fmt.Printf("  活跃: %d个\n", status.GatewayKeys.Active)
+
+	fmt.Printf("\n上游账号:\n")
+	fmt.Printf("  总数: %d个\n", status.Upstreams.Total)
+	fmt.Printf("  活跃: %d个\n", status.Upstreams.Active)
+	fmt.Printf("  健康: %d个\n", status.Upstreams.Healthy)
+
+	if len(status.Providers) > 0 {
+		fmt.Printf("  按提供商分布:\n")
+		for _, provider := range status.Providers {
+			fmt.Printf("    %s: %d个 (活跃 %d, 健康 %d), 请求 %d次, 错误率 %.2f%%\n",
+				provider.Provider, provider.Total, provider.Active, provider.Healthy,
+				provider.Requests.Total, provider.Requests.ErrorRate*100)
+		}
+	}
+
+	fmt.Printf("\n请求统计:\n")
+	fmt.Printf("  总请求: %d次\n", status.Requests.Total)
+	fmt.Printf("  成功: %d次\n", status.Requests.Successful)
+	fmt.Printf("  失败: %d次\n", status.Requests.Errors)
+	fmt.Printf("  错误率: %.2f%%\n", status.Requests.ErrorRate*100)
+
+	for _, warning := range status.Warnings {
+		fmt.Printf("\n⚠️  %s\n", warning)
+	}
+}
@@ -2,4 +2,7 @@ module github.com/iBreaker/llm-gateway
 
 go 1.21
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	golang.org/x/crypto v0.31.0
+	gopkg.in/yaml.v2 v2.4.0
+)
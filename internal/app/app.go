@@ -1,12 +1,15 @@
 package app
 
 import (
+	"strings"
+
 	"github.com/iBreaker/llm-gateway/internal/client"
 	"github.com/iBreaker/llm-gateway/internal/config"
 	"github.com/iBreaker/llm-gateway/internal/converter"
 	"github.com/iBreaker/llm-gateway/internal/router"
 	"github.com/iBreaker/llm-gateway/internal/server"
 	"github.com/iBreaker/llm-gateway/internal/upstream"
+	"github.com/iBreaker/llm-gateway/pkg/logger"
 )
 
 // Application 应用程序上下文
@@ -31,14 +34,23 @@ func NewApplication(configPath string) (*Application, error) {
 		return nil, err
 	}
 
+	// 将配置的代理等环境变量导出到进程环境，进程环境中已设置的变量优先
+	if applied := config.ApplyEnvironment(&cfg.Environment); len(applied) > 0 {
+		logger.Debug("已从配置设置环境变量: %s", strings.Join(applied, ", "))
+	}
+
 	// 初始化各个组件，使用ConfigManager作为数据层
 	gatewayKeyMgr := client.NewGatewayKeyManager(configMgr)
 	upstreamMgr := upstream.NewUpstreamManager(configMgr)
+	// OAuth token自动刷新只在服务器运行时启动（见HTTPServer.serve），短时运行的CLI命令不刷新，
+	// 避免与运行中的服务器同时刷新而使对方的refresh token失效
 	oauthMgr := upstream.NewOAuthManager(upstreamMgr)
 	converter := converter.NewManager()
+	converter.SetUnknownRolePolicy(cfg.Proxy.UnknownRolePolicy)
 
 	// 设置路由器策略
-	requestRouter := router.NewRequestRouter(upstreamMgr, router.StrategyHealthFirst)
+	requestRouter := router.NewRequestRouter(upstreamMgr, router.BalanceStrategy(cfg.Server.LoadBalanceStrategy))
+	requestRouter.SetCircuitBreaker(cfg.Proxy.CircuitBreaker)
 
 	// 创建HTTP服务器
 	httpServer := server.NewServer(cfg, gatewayKeyMgr, upstreamMgr, requestRouter, converter, configMgr, oauthMgr)
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/internal/config"
+)
+
+func TestNewApplication_AppliesConfiguredProxy(t *testing.T) {
+	// t.Setenv在测试结束后恢复原值，空值视为未设置
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HTTPS_PROXY", "http://real-proxy:3128")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configMgr := config.NewConfigManager(configPath)
+	cfg, err := configMgr.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	cfg.Environment.HTTPProxy = "http://config-proxy:8080"
+	cfg.Environment.HTTPSProxy = "http://config-proxy:8443"
+	if err := configMgr.Save(cfg); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	application, err := NewApplication(configPath)
+	if err != nil {
+		t.Fatalf("NewApplication() error = %v", err)
+	}
+	defer application.OAuthMgr.StopAutoRefresh()
+
+	if got := os.Getenv("HTTP_PROXY"); got != "http://config-proxy:8080" {
+		t.Errorf("仅在配置中设置的代理应导出到进程环境, HTTP_PROXY = %q", got)
+	}
+	if got := os.Getenv("HTTPS_PROXY"); got != "http://real-proxy:3128" {
+		t.Errorf("进程环境中已设置的代理应优先, HTTPS_PROXY = %q", got)
+	}
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// ResponseCache 非流式响应的内存LRU缓存
+type ResponseCache struct {
+	mutex      sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // 最近使用的在前
+	now        func() time.Time
+}
+
+type cacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewResponseCache 创建响应缓存
+func NewResponseCache(maxEntries int, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get 获取缓存的响应，过期条目视为未命中
+func (c *ResponseCache) Get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if c.now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set 写入缓存，超过容量时淘汰最久未使用的条目
+func (c *ResponseCache) Set(key string, value []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Len 返回当前缓存条目数
+func (c *ResponseCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+func (c *ResponseCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// IsCacheable 判断请求的输出是否可复现从而可以缓存：
+// 非流式，且指定了seed（不限制temperature）或显式指定temperature为0
+func IsCacheable(req *types.UnifiedRequest) bool {
+	if req == nil || (req.Stream != nil && *req.Stream) {
+		return false
+	}
+	return req.Seed != nil || (req.Temperature != nil && *req.Temperature == 0)
+}
+
+// Key 计算请求的缓存键。键覆盖客户端格式、Gateway Key、模型、消息、采样参数、seed
+// 以及未建模的provider参数（Extra），不同Key之间的缓存相互隔离。
+func Key(clientFormat string, req *types.UnifiedRequest) (string, error) {
+	// UnifiedRequest 的 JSON 序列化包含 model/messages/采样参数/tools/seed 等所有影响输出的字段
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	// Extra不参与UnifiedRequest的序列化（json:"-"），但thinking、top_k等参数同样影响输出；
+	// encoding/json按key排序序列化map，得到稳定的编码
+	extra, err := json.Marshal(req.Extra)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(clientFormat))
+	hash.Write([]byte{0})
+	hash.Write([]byte(req.GatewayKeyID))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	hash.Write([]byte{0})
+	hash.Write(extra)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func float64Ptr(v float64) *float64 { return &v }
+
+func TestResponseCache_GetSet(t *testing.T) {
+	now := time.Now()
+	c := NewResponseCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	if v, ok := c.Get("a"); !ok || string(v) != "1" {
+		t.Fatalf("Get(a) = %q, %v", v, ok)
+	}
+
+	// 容量为2，写入c时淘汰最久未使用的b
+	c.Set("c", []byte("3"))
+	if _, ok := c.Get("b"); ok {
+		t.Error("b 应被LRU淘汰")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Error("过期条目不应命中")
+	}
+}
+
+func TestIsCacheable(t *testing.T) {
+	stream := true
+	tests := []struct {
+		name string
+		req  *types.UnifiedRequest
+		want bool
+	}{
+		{"temperature为0", &types.UnifiedRequest{Temperature: float64Ptr(0)}, true},
+		{"未设置temperature", &types.UnifiedRequest{}, false},
+		{"高temperature无seed", &types.UnifiedRequest{Temperature: float64Ptr(0.8)}, false},
+		{"高temperature带seed", &types.UnifiedRequest{Temperature: float64Ptr(0.8), Seed: int64Ptr(7)}, true},
+		{"流式请求", &types.UnifiedRequest{Stream: &stream, Seed: int64Ptr(7)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCacheable(tt.req); got != tt.want {
+				t.Errorf("IsCacheable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKey_IncludesSeed(t *testing.T) {
+	newReq := func(seed *int64) *types.UnifiedRequest {
+		return &types.UnifiedRequest{
+			Model:        "gpt-4o",
+			Messages:     []types.Message{{Role: "user", Content: "hi"}},
+			Temperature:  float64Ptr(0.8),
+			Seed:         seed,
+			GatewayKeyID: "key-1",
+		}
+	}
+
+	k1, _ := Key("openai", newReq(int64Ptr(1)))
+	k1Again, _ := Key("openai", newReq(int64Ptr(1)))
+	k2, _ := Key("openai", newReq(int64Ptr(2)))
+	if k1 != k1Again {
+		t.Error("相同seed与输入应得到相同缓存键")
+	}
+	if k1 == k2 {
+		t.Error("不同seed应得到不同缓存键")
+	}
+
+	other := newReq(int64Ptr(1))
+	other.GatewayKeyID = "key-2"
+	if k, _ := Key("openai", other); k == k1 {
+		t.Error("不同Gateway Key的缓存应隔离")
+	}
+}
+
+func TestKey_IncludesExtra(t *testing.T) {
+	newReq := func(extra map[string]interface{}) *types.UnifiedRequest {
+		return &types.UnifiedRequest{
+			Model:        "claude-sonnet-4",
+			Messages:     []types.Message{{Role: "user", Content: "hi"}},
+			Temperature:  float64Ptr(0),
+			Extra:        extra,
+			GatewayKeyID: "key-1",
+		}
+	}
+
+	base, _ := Key("anthropic", newReq(map[string]interface{}{"top_k": 5, "thinking": map[string]interface{}{"type": "enabled", "budget_tokens": 1024}}))
+	reordered, _ := Key("anthropic", newReq(map[string]interface{}{"thinking": map[string]interface{}{"budget_tokens": 1024, "type": "enabled"}, "top_k": 5}))
+	if base != reordered {
+		t.Error("相同的Extra参数应得到相同缓存键")
+	}
+
+	tests := []struct {
+		name  string
+		extra map[string]interface{}
+	}{
+		{"top_k不同", map[string]interface{}{"top_k": 40, "thinking": map[string]interface{}{"type": "enabled", "budget_tokens": 1024}}},
+		{"thinking不同", map[string]interface{}{"top_k": 5, "thinking": map[string]interface{}{"type": "enabled", "budget_tokens": 2048}}},
+		{"缺少Extra", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if k, _ := Key("anthropic", newReq(tt.extra)); k == base {
+				t.Error("只有Extra参数不同的请求应得到不同缓存键")
+			}
+		})
+	}
+}
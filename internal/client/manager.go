@@ -79,6 +79,9 @@ func (m *GatewayKeyManager) ValidateKey(rawKey string) (*types.GatewayAPIKey, er
 
 	for _, key := range keys {
 		if key.KeyHash == keyHash && key.Status == "active" {
+			if key.IsExpired(time.Now()) {
+				return nil, fmt.Errorf("API密钥已过期")
+			}
 			return key, nil
 		}
 	}
@@ -137,6 +140,93 @@ func (m *GatewayKeyManager) UpdateKeyUsage(keyID string, success bool, latency t
 	})
 }
 
+// UpdateKeyPriceMultiplier 设置Gateway API Key的价格系数
+func (m *GatewayKeyManager) UpdateKeyPriceMultiplier(keyID string, multiplier float64) error {
+	if multiplier < 0 {
+		return fmt.Errorf("价格系数不能为负数: %v", multiplier)
+	}
+	return m.configMgr.UpdateGatewayKey(keyID, func(key *types.GatewayAPIKey) error {
+		key.PriceMultiplier = multiplier
+		key.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// UpdateKeyAccessWindows 设置Key的可用时间窗口，传入空列表表示不限制
+func (m *GatewayKeyManager) UpdateKeyAccessWindows(keyID string, windows []types.AccessWindow) error {
+	for i := range windows {
+		if err := windows[i].Validate(); err != nil {
+			return fmt.Errorf("时间窗口[%d] 无效: %w", i, err)
+		}
+	}
+	return m.configMgr.UpdateGatewayKey(keyID, func(key *types.GatewayAPIKey) error {
+		key.AccessWindows = windows
+		key.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// UpdateKeyExpiresAt 设置Key的过期时间，nil表示永不过期
+func (m *GatewayKeyManager) UpdateKeyExpiresAt(keyID string, expiresAt *time.Time) error {
+	return m.configMgr.UpdateGatewayKey(keyID, func(key *types.GatewayAPIKey) error {
+		key.ExpiresAt = expiresAt
+		key.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// UpdateKeyTenant 设置Key所属的租户，空值表示默认租户
+func (m *GatewayKeyManager) UpdateKeyTenant(keyID, tenant string) error {
+	if err := types.ValidateTenant(tenant); err != nil {
+		return err
+	}
+	return m.configMgr.UpdateGatewayKey(keyID, func(key *types.GatewayAPIKey) error {
+		key.Tenant = tenant
+		key.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// UpdateKeyRequestTimeout 设置Key的上游请求超时（秒），0表示使用全局超时
+func (m *GatewayKeyManager) UpdateKeyRequestTimeout(keyID string, seconds int) error {
+	if seconds < 0 {
+		return fmt.Errorf("请求超时不能为负数: %d", seconds)
+	}
+	return m.configMgr.UpdateGatewayKey(keyID, func(key *types.GatewayAPIKey) error {
+		key.RequestTimeoutSeconds = seconds
+		key.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// ResetKeyUsage 清零Key的使用统计（请求计数、延迟、token用量和成本），返回清零后的统计
+func (m *GatewayKeyManager) ResetKeyUsage(keyID string) (*types.KeyUsageStats, error) {
+	usage := &types.KeyUsageStats{}
+	err := m.configMgr.UpdateGatewayKey(keyID, func(key *types.GatewayAPIKey) error {
+		key.Usage = usage
+		key.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// RecordKeyCost 记录token用量及成本，baseCost按Key的价格系数折算后累加
+func (m *GatewayKeyManager) RecordKeyCost(keyID string, inputTokens, outputTokens int64, baseCost float64) error {
+	return m.configMgr.UpdateGatewayKey(keyID, func(key *types.GatewayAPIKey) error {
+		if key.Usage == nil {
+			key.Usage = &types.KeyUsageStats{}
+		}
+
+		key.Usage.InputTokens += inputTokens
+		key.Usage.OutputTokens += outputTokens
+		key.Usage.TotalCost += baseCost * key.EffectivePriceMultiplier()
+		return nil
+	})
+}
+
 // generateRandomKey 生成随机密钥
 func generateRandomKey(length int) (string, error) {
 	bytes := make([]byte, length)
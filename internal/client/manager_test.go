@@ -212,6 +212,43 @@ func TestGatewayKeyManager_ValidateKey_DisabledKey(t *testing.T) {
 	}
 }
 
+func TestGatewayKeyManager_ValidateKey_Expiration(t *testing.T) {
+	configMgr := NewMockConfigManager()
+	mgr := NewGatewayKeyManager(configMgr)
+
+	expired, expiredRaw, err := mgr.CreateKey("expired-key", []types.Permission{types.PermissionRead})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := mgr.UpdateKeyExpiresAt(expired.ID, &past); err != nil {
+		t.Fatalf("UpdateKeyExpiresAt() error = %v", err)
+	}
+
+	valid, validRaw, err := mgr.CreateKey("valid-key", []types.Permission{types.PermissionRead})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := mgr.UpdateKeyExpiresAt(valid.ID, &future); err != nil {
+		t.Fatalf("UpdateKeyExpiresAt() error = %v", err)
+	}
+
+	if _, err := mgr.ValidateKey(expiredRaw); err == nil {
+		t.Error("ValidateKey() should fail for expired key")
+	}
+	if got, err := mgr.ValidateKey(validRaw); err != nil || got.ID != valid.ID {
+		t.Errorf("ValidateKey() for unexpired key = %v, %v", got, err)
+	}
+
+	if expired.IsActive(time.Now()) {
+		t.Error("过期的Key不应计为活跃")
+	}
+	if !valid.IsActive(time.Now()) {
+		t.Error("未过期的Key应计为活跃")
+	}
+}
+
 func TestGatewayKeyManager_ListKeys(t *testing.T) {
 	configMgr := NewMockConfigManager()
 	mgr := NewGatewayKeyManager(configMgr)
@@ -332,3 +369,85 @@ func TestGatewayKeyManager_UpdateKeyUsage(t *testing.T) {
 		t.Errorf("Usage.AvgLatency = %f, want %f", updatedKey.Usage.AvgLatency, expectedAvg)
 	}
 }
+
+func TestGatewayKeyManager_RecordKeyCost(t *testing.T) {
+	pricing := &types.PricingConfig{
+		Models: []types.ModelPricing{
+			{Model: "claude-*", InputPrice: 3, OutputPrice: 15},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		multiplier float64
+		wantCost   float64
+	}{
+		{"未设置系数按原价", 0, 0.0105},
+		{"折扣", 0.5, 0.00525},
+		{"加价", 2, 0.021},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := NewGatewayKeyManager(NewMockConfigManager())
+			key, _, err := mgr.CreateKey("test-key", []types.Permission{types.PermissionWrite})
+			if err != nil {
+				t.Fatalf("CreateKey() error = %v", err)
+			}
+
+			if tt.multiplier > 0 {
+				if err := mgr.UpdateKeyPriceMultiplier(key.ID, tt.multiplier); err != nil {
+					t.Fatalf("UpdateKeyPriceMultiplier() error = %v", err)
+				}
+			}
+
+			// 1000输入 + 500输出: (1000*3 + 500*15) / 1e6 = 0.0105
+			baseCost := pricing.CalculateCost("claude-3-5-sonnet", 1000, 500)
+			if err := mgr.RecordKeyCost(key.ID, 1000, 500, baseCost); err != nil {
+				t.Fatalf("RecordKeyCost() error = %v", err)
+			}
+
+			updatedKey, _ := mgr.GetKey(key.ID)
+			if updatedKey.Usage.InputTokens != 1000 || updatedKey.Usage.OutputTokens != 500 {
+				t.Errorf("tokens = %d/%d, want 1000/500", updatedKey.Usage.InputTokens, updatedKey.Usage.OutputTokens)
+			}
+			if diff := updatedKey.Usage.TotalCost - tt.wantCost; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("TotalCost = %f, want %f", updatedKey.Usage.TotalCost, tt.wantCost)
+			}
+		})
+	}
+
+	t.Run("负数系数被拒绝", func(t *testing.T) {
+		mgr := NewGatewayKeyManager(NewMockConfigManager())
+		key, _, _ := mgr.CreateKey("test-key", []types.Permission{types.PermissionWrite})
+		if err := mgr.UpdateKeyPriceMultiplier(key.ID, -1); err == nil {
+			t.Error("UpdateKeyPriceMultiplier() 应拒绝负数系数")
+		}
+	})
+}
+
+func TestGatewayKeyManager_ResetKeyUsage(t *testing.T) {
+	mgr := NewGatewayKeyManager(NewMockConfigManager())
+
+	key, _, err := mgr.CreateKey("test-key", []types.Permission{types.PermissionRead})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	_ = mgr.UpdateKeyUsage(key.ID, false, 100*time.Millisecond)
+	_ = mgr.RecordKeyCost(key.ID, 10, 20, 0.5)
+
+	usage, err := mgr.ResetKeyUsage(key.ID)
+	if err != nil {
+		t.Fatalf("ResetKeyUsage() error = %v", err)
+	}
+	updatedKey, _ := mgr.GetKey(key.ID)
+	for _, u := range []*types.KeyUsageStats{usage, updatedKey.Usage} {
+		if *u != (types.KeyUsageStats{}) {
+			t.Errorf("使用统计应已清零: %+v", u)
+		}
+	}
+
+	if _, err := mgr.ResetKeyUsage("missing"); err == nil {
+		t.Error("Key不存在时应返回错误")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -39,6 +40,9 @@ func (m *ConfigManager) loadUnsafe() (*types.Config, error) {
 		// 如果配置文件不存在，创建默认配置
 		if os.IsNotExist(err) {
 			config := m.createDefaultConfig()
+			if _, err := migrateWebPassword(config); err != nil {
+				return nil, err
+			}
 			if err := m.saveUnsafe(config); err != nil {
 				return nil, fmt.Errorf("创建默认配置文件失败: %w", err)
 			}
@@ -58,8 +62,16 @@ func (m *ConfigManager) loadUnsafe() (*types.Config, error) {
 	// 设置默认值（向后兼容）
 	m.setDefaultValues(&config)
 
-	// 应用环境变量配置
-	m.applyEnvironmentConfig(&config)
+	// 旧版本配置中的明文Web密码首次加载时替换为哈希并写回
+	migrated, err := migrateWebPassword(&config)
+	if err != nil {
+		return nil, err
+	}
+	if migrated {
+		if err := m.saveUnsafe(&config); err != nil {
+			return nil, fmt.Errorf("保存迁移后的Web密码失败: %w", err)
+		}
+	}
 
 	return &config, nil
 }
@@ -115,6 +127,24 @@ func (m *ConfigManager) Validate() error {
 		return fmt.Errorf("服务器地址不能为空")
 	}
 
+	switch m.config.Server.LoadBalanceStrategy {
+	case "", types.LoadBalanceHealthFirst, types.LoadBalanceRoundRobin, types.LoadBalanceRandom, types.LoadBalanceWeighted:
+	default:
+		return fmt.Errorf("不支持的负载均衡策略: %s (支持: health_first, round_robin, random, weighted)", m.config.Server.LoadBalanceStrategy)
+	}
+
+	if m.config.Server.Web.SessionTTL < 0 {
+		return fmt.Errorf("Web会话有效期不能为负数: %d", m.config.Server.Web.SessionTTL)
+	}
+
+	if m.config.Server.OAuthRefreshInterval < 0 {
+		return fmt.Errorf("OAuth token刷新间隔不能为负数: %d", m.config.Server.OAuthRefreshInterval)
+	}
+
+	if err := m.config.Server.CORS.Validate(); err != nil {
+		return err
+	}
+
 	// 验证上游账号配置
 	for i, account := range m.config.UpstreamAccounts {
 		if err := m.validateUpstreamAccount(&account, i); err != nil {
@@ -129,6 +159,109 @@ func (m *ConfigManager) Validate() error {
 		}
 	}
 
+	// 验证重试策略
+	if err := validateRetryConfig(&m.config.Proxy); err != nil {
+		return err
+	}
+
+	// 验证上游连接池
+	if m.config.Proxy.MaxIdleConns < 0 || m.config.Proxy.MaxIdleConnsPerHost < 0 || m.config.Proxy.MaxConnsPerHost < 0 {
+		return fmt.Errorf("max_idle_conns、max_idle_conns_per_host、max_conns_per_host不能为负数")
+	}
+
+	if m.config.Proxy.Idempotency.TTLSeconds < 0 || m.config.Proxy.Idempotency.MaxEntries < 0 {
+		return fmt.Errorf("idempotency.ttl_seconds、idempotency.max_entries不能为负数")
+	}
+
+	if err := m.config.Proxy.MaxTokensLimit.Validate(); err != nil {
+		return err
+	}
+
+	if m.config.Proxy.CircuitBreaker.ErrorThreshold < -1 || m.config.Proxy.CircuitBreaker.CooldownSeconds < 0 {
+		return fmt.Errorf("circuit_breaker.error_threshold不能小于-1，circuit_breaker.cooldown_seconds不能为负数")
+	}
+
+	switch m.config.Proxy.UnknownRolePolicy {
+	case "", types.UnknownRolePassthrough, types.UnknownRoleReject:
+	default:
+		return fmt.Errorf("不支持的unknown_role_policy: %s (支持: passthrough, reject)", m.config.Proxy.UnknownRolePolicy)
+	}
+
+	if err := m.config.Proxy.SizeStats.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.config.Quotas.Validate(); err != nil {
+		return err
+	}
+
+	if m.config.Proxy.MaxStreamDuration < 0 {
+		return fmt.Errorf("max_stream_duration_seconds不能为负数: %d", m.config.Proxy.MaxStreamDuration)
+	}
+
+	// 验证定价表
+	if err := m.config.Pricing.Validate(); err != nil {
+		return err
+	}
+
+	// 验证全局模型路由（含模型别名）
+	if err := m.config.ModelRoutes.Validate(); err != nil {
+		return fmt.Errorf("模型路由配置无效: %w", err)
+	}
+
+	// 验证模型能力表
+	if err := m.config.Capabilities.Validate(); err != nil {
+		return err
+	}
+
+	// 验证额外环境变量
+	if err := m.config.Environment.Validate(); err != nil {
+		return err
+	}
+
+	// 验证trace脱敏级别
+	switch m.config.Logging.TraceRedaction {
+	case "", types.TraceRedactionFull, types.TraceRedactionPII, types.TraceRedactionMetadata:
+	default:
+		return fmt.Errorf("不支持的trace脱敏级别: %s (支持: full, pii, metadata)", m.config.Logging.TraceRedaction)
+	}
+
+	// 验证限流后端配置
+	switch m.config.RateLimit.Backend {
+	case "", "memory":
+	case "redis":
+		if m.config.RateLimit.RedisAddr == "" {
+			return fmt.Errorf("redis限流后端需要配置redis_addr")
+		}
+	default:
+		return fmt.Errorf("不支持的限流后端: %s", m.config.RateLimit.Backend)
+	}
+
+	return nil
+}
+
+// validateRetryConfig 验证上游重试退避配置
+func validateRetryConfig(proxy *types.ProxyConfig) error {
+	if proxy.MaxRetries < 0 {
+		return fmt.Errorf("max_retries不能为负数: %d", proxy.MaxRetries)
+	}
+	switch proxy.RetryBackoff {
+	case "", types.RetryBackoffFixed, types.RetryBackoffExponential:
+	default:
+		return fmt.Errorf("不支持的重试退避算法: %s", proxy.RetryBackoff)
+	}
+	if proxy.RetryBaseDelayMs < 0 || proxy.RetryMaxDelayMs < 0 {
+		return fmt.Errorf("重试延迟不能为负数")
+	}
+	if proxy.RetryMaxDelayMs > 0 && proxy.RetryBaseDelayMs > proxy.RetryMaxDelayMs {
+		return fmt.Errorf("retry_base_delay_ms(%d)不能大于retry_max_delay_ms(%d)", proxy.RetryBaseDelayMs, proxy.RetryMaxDelayMs)
+	}
+	if proxy.RetryJitter < 0 || proxy.RetryJitter > 1 {
+		return fmt.Errorf("retry_jitter必须在0到1之间: %v", proxy.RetryJitter)
+	}
+	if proxy.MaxFailovers < -1 {
+		return fmt.Errorf("max_failovers不能小于-1: %d", proxy.MaxFailovers)
+	}
 	return nil
 }
 
@@ -146,6 +279,30 @@ func (m *ConfigManager) validateUpstreamAccount(account *types.UpstreamAccount,
 		return fmt.Errorf("上游账号[%d] 提供商不能为空", index)
 	}
 
+	if account.Weight < 0 {
+		return fmt.Errorf("上游账号[%d] 权重不能为负数: %d", index, account.Weight)
+	}
+
+	if account.MaxInFlight < 0 {
+		return fmt.Errorf("上游账号[%d] 最大并发请求数不能为负数: %d", index, account.MaxInFlight)
+	}
+
+	if err := types.ValidateTenant(account.Tenant); err != nil {
+		return fmt.Errorf("上游账号[%d] %w", index, err)
+	}
+
+	if account.BaseURL != "" {
+		if _, err := types.NormalizeBaseURL(account.BaseURL); err != nil {
+			return fmt.Errorf("上游账号[%d] %w", index, err)
+		}
+	}
+
+	if account.HealthProbe != nil {
+		if err := account.HealthProbe.Validate(); err != nil {
+			return fmt.Errorf("上游账号[%d] 健康探测配置无效: %w", index, err)
+		}
+	}
+
 	switch account.Type {
 	case types.UpstreamTypeAPIKey:
 		if account.APIKey == "" {
@@ -183,6 +340,20 @@ func (m *ConfigManager) validateGatewayKey(key *types.GatewayAPIKey, index int)
 		return fmt.Errorf("gateway API Key[%d] 权限不能为空", index)
 	}
 
+	if key.PriceMultiplier < 0 {
+		return fmt.Errorf("gateway API Key[%d] 价格系数不能为负数", index)
+	}
+
+	for i := range key.AccessWindows {
+		if err := key.AccessWindows[i].Validate(); err != nil {
+			return fmt.Errorf("gateway API Key[%d] 时间窗口[%d] 无效: %w", index, i, err)
+		}
+	}
+
+	if err := types.ValidateTenant(key.Tenant); err != nil {
+		return fmt.Errorf("gateway API Key[%d] %w", index, err)
+	}
+
 	return nil
 }
 
@@ -253,6 +424,10 @@ func (m *ConfigManager) CreateGatewayKey(key *types.GatewayAPIKey) error {
 		}
 	}
 
+	if err := m.checkGatewayKeyQuotaLocked(); err != nil {
+		return err
+	}
+
 	// 添加到配置
 	m.config.GatewayKeys = append(m.config.GatewayKeys, *key)
 
@@ -362,6 +537,10 @@ func (m *ConfigManager) CreateUpstreamAccount(account *types.UpstreamAccount) er
 		}
 	}
 
+	if err := m.checkUpstreamQuotaLocked(account); err != nil {
+		return err
+	}
+
 	// 添加到配置
 	m.config.UpstreamAccounts = append(m.config.UpstreamAccounts, *account)
 
@@ -380,8 +559,7 @@ func (m *ConfigManager) GetUpstreamAccount(accountID string) (*types.UpstreamAcc
 
 	for _, account := range m.config.UpstreamAccounts {
 		if account.ID == accountID {
-			accountCopy := account // 避免返回内部数据的引用
-			return &accountCopy, nil
+			return copyUpstreamAccount(account), nil // 避免返回内部数据的引用
 		}
 	}
 
@@ -400,8 +578,7 @@ func (m *ConfigManager) ListUpstreamAccounts() []*types.UpstreamAccount {
 	// 返回副本避免外部修改内部数据
 	accounts := make([]*types.UpstreamAccount, len(m.config.UpstreamAccounts))
 	for i, account := range m.config.UpstreamAccounts {
-		accountCopy := account
-		accounts[i] = &accountCopy
+		accounts[i] = copyUpstreamAccount(account)
 	}
 
 	return accounts
@@ -433,14 +610,27 @@ func (m *ConfigManager) ListActiveUpstreamAccounts(provider types.Provider) []*t
 				}
 			}
 
-			accountCopy := account
-			activeAccounts = append(activeAccounts, &accountCopy)
+			// API Key凭据已过期的账号不可用
+			if account.IsAPIKeyExpired(time.Now()) {
+				continue
+			}
+
+			activeAccounts = append(activeAccounts, copyUpstreamAccount(account))
 		}
 	}
 
 	return activeAccounts
 }
 
+// copyUpstreamAccount 复制账号，使用统计由请求统计在锁内原地更新，需一并复制，避免调用方读取时与写入竞争
+func copyUpstreamAccount(account types.UpstreamAccount) *types.UpstreamAccount {
+	if account.Usage != nil {
+		usage := *account.Usage
+		account.Usage = &usage
+	}
+	return &account
+}
+
 // UpdateUpstreamAccount 更新上游账号
 func (m *ConfigManager) UpdateUpstreamAccount(accountID string, updater func(*types.UpstreamAccount) error) error {
 	m.mutex.Lock()
@@ -492,18 +682,38 @@ func (m *ConfigManager) GetConfigPath() string {
 	return m.configPath
 }
 
-// applyEnvironmentConfig 应用环境变量配置
-func (m *ConfigManager) applyEnvironmentConfig(config *types.Config) {
-	// 设置HTTP代理环境变量
-	if config.Environment.HTTPProxy != "" {
-		_ = os.Setenv("HTTP_PROXY", config.Environment.HTTPProxy)
+// ApplyEnvironment 将配置的代理及额外环境变量导出到进程环境，供http.ProxyFromEnvironment等读取。
+// 优先级：进程启动时已设置（非空）的环境变量优先于配置，配置只补充未设置的变量；
+// 代理变量的大写和小写形式（如HTTP_PROXY与http_proxy）任一已设置即视为已设置。返回实际设置的变量名
+func ApplyEnvironment(env *types.EnvironmentConfig) []string {
+	var applied []string
+	setIfUnset := func(name, value string, aliases ...string) {
+		if value == "" {
+			return
+		}
+		for _, existing := range append([]string{name}, aliases...) {
+			if os.Getenv(existing) != "" {
+				return
+			}
+		}
+		if err := os.Setenv(name, value); err == nil {
+			applied = append(applied, name)
+		}
 	}
 
-	if config.Environment.HTTPSProxy != "" {
-		_ = os.Setenv("HTTPS_PROXY", config.Environment.HTTPSProxy)
-	}
+	// 设置代理环境变量
+	setIfUnset("HTTP_PROXY", env.HTTPProxy, "http_proxy")
+	setIfUnset("HTTPS_PROXY", env.HTTPSProxy, "https_proxy")
+	setIfUnset("NO_PROXY", env.NoProxy, "no_proxy")
 
-	if config.Environment.NoProxy != "" {
-		_ = os.Setenv("NO_PROXY", config.Environment.NoProxy)
+	// 设置额外的环境变量
+	names := make([]string, 0, len(env.Extra))
+	for name := range env.Extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		setIfUnset(name, env.Extra[name])
 	}
+	return applied
 }
@@ -304,6 +304,123 @@ func TestConfigManager_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "Client ID不能为空",
 		},
+		{
+			name: "unknown_load_balance_strategy",
+			config: &types.Config{
+				Server: types.ServerConfig{
+					Host:                "localhost",
+					Port:                8080,
+					LoadBalanceStrategy: "least_conn",
+				},
+			},
+			wantErr: true,
+			errMsg:  "不支持的负载均衡策略",
+		},
+		{
+			name: "cors_credentials_without_origins",
+			config: &types.Config{
+				Server: types.ServerConfig{
+					Host: "localhost",
+					Port: 8080,
+					CORS: types.CORSConfig{AllowCredentials: true},
+				},
+			},
+			wantErr: true,
+			errMsg:  "需要配置明确的allowed_origins",
+		},
+		{
+			name: "cors_credentials_with_wildcard_origin",
+			config: &types.Config{
+				Server: types.ServerConfig{
+					Host: "localhost",
+					Port: 8080,
+					CORS: types.CORSConfig{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true},
+				},
+			},
+			wantErr: true,
+			errMsg:  "不能与allowed_origins中的",
+		},
+		{
+			name: "cors_credentials_with_explicit_origins",
+			config: &types.Config{
+				Server: types.ServerConfig{
+					Host: "localhost",
+					Port: 8080,
+					CORS: types.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "upstream_negative_weight",
+			config: &types.Config{
+				Server: types.ServerConfig{
+					Host: "localhost",
+					Port: 8080,
+				},
+				UpstreamAccounts: []types.UpstreamAccount{
+					{
+						ID:       "test-upstream",
+						Name:     "Test Upstream",
+						Type:     types.UpstreamTypeAPIKey,
+						Provider: types.ProviderAnthropic,
+						APIKey:   "sk-test",
+						Weight:   -1,
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "权重不能为负数",
+		},
+		{
+			name: "upstream_invalid_base_url",
+			config: &types.Config{
+				Server: types.ServerConfig{
+					Host: "localhost",
+					Port: 8080,
+				},
+				UpstreamAccounts: []types.UpstreamAccount{
+					{
+						ID:       "test-upstream",
+						Name:     "Test Upstream",
+						Type:     types.UpstreamTypeAPIKey,
+						Provider: types.ProviderOpenAI,
+						APIKey:   "sk-test",
+						BaseURL:  "ftp://api.example.com",
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "Base URL必须使用http或https协议",
+		},
+		{
+			name: "invalid_environment_extra_name",
+			config: &types.Config{
+				Server: types.ServerConfig{
+					Host: "localhost",
+					Port: 8080,
+				},
+				Environment: types.EnvironmentConfig{
+					Extra: map[string]string{"ALL-PROXY": "socks5://proxy:1080"},
+				},
+			},
+			wantErr: true,
+			errMsg:  "无效的环境变量名",
+		},
+		{
+			name: "negative_max_tokens_limit",
+			config: &types.Config{
+				Server: types.ServerConfig{
+					Host: "localhost",
+					Port: 8080,
+				},
+				Proxy: types.ProxyConfig{
+					MaxTokensLimit: types.MaxTokensLimitConfig{Providers: map[types.Provider]int{types.ProviderAnthropic: -1}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "max_tokens_limit.providers.anthropic不能为负数",
+		},
 	}
 
 	for _, tt := range tests {
@@ -378,6 +495,44 @@ func TestConfigManager_Reload(t *testing.T) {
 	}
 }
 
+func TestApplyEnvironment(t *testing.T) {
+	// t.Setenv在测试结束后恢复原值，空值视为未设置
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy", "LLM_GATEWAY_TEST_EXTRA", "LLM_GATEWAY_TEST_PRESET"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("https_proxy", "http://real-proxy:3128")
+	t.Setenv("LLM_GATEWAY_TEST_PRESET", "real")
+
+	applied := ApplyEnvironment(&types.EnvironmentConfig{
+		HTTPProxy:  "http://config-proxy:8080",
+		HTTPSProxy: "http://config-proxy:8443",
+		Extra: map[string]string{
+			"LLM_GATEWAY_TEST_EXTRA":  "enabled",
+			"LLM_GATEWAY_TEST_PRESET": "config",
+		},
+	})
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"HTTP_PROXY", "http://config-proxy:8080"}, // 仅在配置中设置
+		{"HTTPS_PROXY", ""},                        // 真实环境的小写形式已设置，不覆盖
+		{"https_proxy", "http://real-proxy:3128"},  // 真实环境的值保持不变
+		{"NO_PROXY", ""},                           // 配置为空时不设置
+		{"LLM_GATEWAY_TEST_EXTRA", "enabled"},      // 额外变量
+		{"LLM_GATEWAY_TEST_PRESET", "real"},        // 真实环境优先于额外变量配置
+	}
+	for _, tt := range tests {
+		if got := os.Getenv(tt.name); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if len(applied) != 2 || applied[0] != "HTTP_PROXY" || applied[1] != "LLM_GATEWAY_TEST_EXTRA" {
+		t.Errorf("applied = %v, want [HTTP_PROXY LLM_GATEWAY_TEST_EXTRA]", applied)
+	}
+}
+
 func TestConfigManager_GetConfigPath(t *testing.T) {
 	configPath := "/tmp/test_config.yaml"
 	mgr := NewConfigManager(configPath)
@@ -407,6 +562,74 @@ func TestConfigManager_Get(t *testing.T) {
 	}
 }
 
+func TestConfigManager_ListActiveUpstreamAccountsSkipsExpiredAPIKey(t *testing.T) {
+	mgr := NewConfigManager(filepath.Join(t.TempDir(), "config.yaml"))
+	if _, err := mgr.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(24 * time.Hour)
+	accounts := []*types.UpstreamAccount{
+		{ID: "no-expiry", Name: "a", Type: types.UpstreamTypeAPIKey, Provider: types.ProviderOpenAI, APIKey: "sk-1", Status: "active"},
+		{ID: "expired", Name: "b", Type: types.UpstreamTypeAPIKey, Provider: types.ProviderOpenAI, APIKey: "sk-2", Status: "active", APIKeyExpiresAt: &past},
+		{ID: "valid", Name: "c", Type: types.UpstreamTypeAPIKey, Provider: types.ProviderOpenAI, APIKey: "sk-3", Status: "active", APIKeyExpiresAt: &future},
+	}
+	for _, account := range accounts {
+		if err := mgr.CreateUpstreamAccount(account); err != nil {
+			t.Fatalf("CreateUpstreamAccount() error = %v", err)
+		}
+	}
+
+	active := mgr.ListActiveUpstreamAccounts(types.ProviderOpenAI)
+	if len(active) != 2 {
+		t.Fatalf("ListActiveUpstreamAccounts() = %d accounts, want 2", len(active))
+	}
+	for _, account := range active {
+		if account.ID == "expired" {
+			t.Error("API Key已过期的账号不应被选用")
+		}
+	}
+
+	if !accounts[2].IsAPIKeyExpiringSoon(time.Now(), types.CredentialExpiryWarning) {
+		t.Error("一天后到期的账号应处于提醒窗口内")
+	}
+}
+
+func TestConfigManager_UpstreamAccountCopiesUsage(t *testing.T) {
+	mgr := NewConfigManager(filepath.Join(t.TempDir(), "config.yaml"))
+	if _, err := mgr.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	err := mgr.CreateUpstreamAccount(&types.UpstreamAccount{
+		ID: "a", Name: "a", Type: types.UpstreamTypeAPIKey, Provider: types.ProviderOpenAI, APIKey: "sk-1", Status: "active",
+		Usage: &types.UpstreamUsageStats{TokensUsed: 1},
+	})
+	if err != nil {
+		t.Fatalf("CreateUpstreamAccount() error = %v", err)
+	}
+
+	got, err := mgr.GetUpstreamAccount("a")
+	if err != nil {
+		t.Fatalf("GetUpstreamAccount() error = %v", err)
+	}
+	listed := mgr.ListUpstreamAccounts()[0]
+	active := mgr.ListActiveUpstreamAccounts(types.ProviderOpenAI)[0]
+
+	// 请求统计在锁内原地更新Usage，已返回的副本不应受影响
+	if err := mgr.UpdateUpstreamAccount("a", func(account *types.UpstreamAccount) error {
+		account.Usage.TokensUsed += 10
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateUpstreamAccount() error = %v", err)
+	}
+	for name, account := range map[string]*types.UpstreamAccount{"GetUpstreamAccount": got, "ListUpstreamAccounts": listed, "ListActiveUpstreamAccounts": active} {
+		if account.Usage.TokensUsed != 1 {
+			t.Errorf("%s 返回的Usage与内部数据共享, TokensUsed = %d", name, account.Usage.TokensUsed)
+		}
+	}
+}
+
 // contains 检查字符串是否包含子字符串
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) &&
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// HashPassword 计算Web管理密码的bcrypt哈希，配置文件中只保存哈希
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("计算密码哈希失败: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword 校验密码与存储的哈希是否匹配，比较过程为常量时间
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// IsPasswordHash 判断存储的值是否已是bcrypt哈希
+func IsPasswordHash(value string) bool {
+	_, err := bcrypt.Cost([]byte(value))
+	return err == nil
+}
+
+// migrateWebPassword 将配置中的明文Web密码替换为哈希，返回是否发生了迁移
+func migrateWebPassword(config *types.Config) (bool, error) {
+	password := config.Server.Web.Password
+	if password == "" || IsPasswordHash(password) {
+		return false, nil
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+	config.Server.Web.Password = hash
+	return true, nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigManager_MigratesPlaintextWebPassword(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	legacy := "server:\n  host: 127.0.0.1\n  port: 3847\n  web:\n    enabled: true\n    password: s3cret-pass\n"
+	if err := os.WriteFile(configPath, []byte(legacy), 0600); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+
+	config, err := NewConfigManager(configPath).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	stored := config.Server.Web.Password
+	if stored == "s3cret-pass" || !IsPasswordHash(stored) {
+		t.Fatalf("加载后密码应替换为哈希, got %q", stored)
+	}
+	if !CheckPassword(stored, "s3cret-pass") || CheckPassword(stored, "wrong") {
+		t.Error("迁移后原密码应仍能通过校验")
+	}
+
+	data, _ := os.ReadFile(configPath)
+	if strings.Contains(string(data), "s3cret-pass") {
+		t.Error("配置文件中不应再出现明文密码")
+	}
+
+	// 再次加载不应重复哈希
+	reloaded, err := NewConfigManager(configPath).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if reloaded.Server.Web.Password != stored {
+		t.Error("已是哈希的密码不应再次迁移")
+	}
+}
+
+func TestConfigManager_DefaultWebPasswordHashed(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	config, err := NewConfigManager(configPath).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !CheckPassword(config.Server.Web.Password, "admin123") {
+		t.Error("默认密码应以哈希形式保存且仍为admin123")
+	}
+
+	data, _ := os.ReadFile(configPath)
+	if strings.Contains(string(data), "admin123") {
+		t.Error("默认配置文件中不应出现明文密码")
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// ErrQuotaExceeded 创建资源超出配置的配额
+var ErrQuotaExceeded = errors.New("超出资源配额")
+
+// checkGatewayKeyQuotaLocked 检查是否还能创建Gateway API Key（调用方需持有写锁）
+func (m *ConfigManager) checkGatewayKeyQuotaLocked() error {
+	limit := m.config.Quotas.MaxGatewayKeys
+	if limit > 0 && len(m.config.GatewayKeys) >= limit {
+		return fmt.Errorf("%w: Gateway API Key数量已达上限 %d", ErrQuotaExceeded, limit)
+	}
+	return nil
+}
+
+// checkUpstreamQuotaLocked 检查是否还能创建上游账号，按总数和创建人分别限制（调用方需持有写锁）
+func (m *ConfigManager) checkUpstreamQuotaLocked(account *types.UpstreamAccount) error {
+	quotas := m.config.Quotas
+	if quotas.MaxUpstreamAccounts > 0 && len(m.config.UpstreamAccounts) >= quotas.MaxUpstreamAccounts {
+		return fmt.Errorf("%w: 上游账号数量已达上限 %d", ErrQuotaExceeded, quotas.MaxUpstreamAccounts)
+	}
+
+	if quotas.MaxUpstreamAccountsPerCreator > 0 && account.CreatedBy != "" {
+		count := 0
+		for _, existing := range m.config.UpstreamAccounts {
+			if existing.CreatedBy == account.CreatedBy {
+				count++
+			}
+		}
+		if count >= quotas.MaxUpstreamAccountsPerCreator {
+			return fmt.Errorf("%w: 创建人 %s 的上游账号数量已达上限 %d", ErrQuotaExceeded, account.CreatedBy, quotas.MaxUpstreamAccountsPerCreator)
+		}
+	}
+	return nil
+}
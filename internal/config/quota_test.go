@@ -0,0 +1,47 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestConfigManager_CreationQuotas(t *testing.T) {
+	mgr := NewConfigManager(filepath.Join(t.TempDir(), "config.yaml"))
+	config, err := mgr.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	config.Quotas = types.QuotaConfig{MaxGatewayKeys: 1, MaxUpstreamAccounts: 3, MaxUpstreamAccountsPerCreator: 1}
+
+	if err := mgr.CreateGatewayKey(&types.GatewayAPIKey{ID: "gw-1", Name: "a"}); err != nil {
+		t.Fatalf("CreateGatewayKey() error = %v", err)
+	}
+	if err := mgr.CreateGatewayKey(&types.GatewayAPIKey{ID: "gw-2", Name: "b"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("超出Key配额时 error = %v, want ErrQuotaExceeded", err)
+	}
+
+	create := func(id, createdBy string) error {
+		return mgr.CreateUpstreamAccount(&types.UpstreamAccount{ID: id, Name: id, CreatedBy: createdBy})
+	}
+	if err := create("u-1", "alice"); err != nil {
+		t.Fatalf("CreateUpstreamAccount() error = %v", err)
+	}
+	if err := create("u-2", "alice"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("超出创建人配额时 error = %v, want ErrQuotaExceeded", err)
+	}
+	if err := create("u-3", "bob"); err != nil {
+		t.Fatalf("其他创建人不受影响, error = %v", err)
+	}
+	if err := create("u-4", ""); err != nil {
+		t.Fatalf("未记录创建人时只受总数限制, error = %v", err)
+	}
+	if err := create("u-5", "carol"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("超出总数配额时 error = %v, want ErrQuotaExceeded", err)
+	}
+	if got := len(mgr.ListUpstreamAccounts()); got != 3 {
+		t.Errorf("上游账号数 = %d, want 3", got)
+	}
+}
@@ -0,0 +1,429 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// StreamAggregator 消费某一格式的流式事件，组装成该格式的完整非流式响应。
+// 用于调试时对比流式与非流式结果，以及上游只支持流式时为非流式请求聚合响应
+type StreamAggregator struct {
+	format Format
+
+	// OpenAI
+	openAIBase    map[string]interface{}
+	openAIChoices map[int]*aggregatedChoice
+	openAIUsage   interface{}
+
+	// Anthropic
+	anthropicMessage map[string]interface{}
+	anthropicBlocks  map[int]map[string]interface{}
+	anthropicInputs  map[int]*strings.Builder // tool_use块累积的partial_json
+
+	// Gemini
+	geminiBase       map[string]interface{}
+	geminiCandidates map[int]*aggregatedCandidate
+}
+
+// aggregatedChoice 聚合中的OpenAI choice
+type aggregatedChoice struct {
+	role         string
+	content      strings.Builder
+	hasContent   bool
+	toolCalls    map[int]map[string]interface{}
+	toolArgs     map[int]*strings.Builder
+	finishReason interface{}
+}
+
+// aggregatedCandidate 聚合中的Gemini candidate
+type aggregatedCandidate struct {
+	parts        []map[string]interface{}
+	finishReason interface{}
+}
+
+// NewStreamAggregator 创建指定格式的流式响应聚合器
+func NewStreamAggregator(format Format) *StreamAggregator {
+	return &StreamAggregator{
+		format:           format,
+		openAIChoices:    make(map[int]*aggregatedChoice),
+		anthropicBlocks:  make(map[int]map[string]interface{}),
+		anthropicInputs:  make(map[int]*strings.Builder),
+		geminiCandidates: make(map[int]*aggregatedCandidate),
+	}
+}
+
+// AggregateStream 读取指定格式的SSE流并返回聚合后的完整JSON响应
+func AggregateStream(format Format, reader io.Reader) ([]byte, error) {
+	aggregator := NewStreamAggregator(format)
+	if err := ForwardSSEStream(reader, format == FormatAnthropic, nil, aggregator); err != nil {
+		return nil, err
+	}
+	return aggregator.Response()
+}
+
+// WriteChunk 合并一个流式数据块
+func (a *StreamAggregator) WriteChunk(chunk *StreamChunk) error {
+	if chunk == nil || chunk.Data == nil {
+		return nil
+	}
+
+	data, err := toJSONMap(chunk.Data)
+	if err != nil {
+		return fmt.Errorf("解析流式数据块失败: %w", err)
+	}
+
+	switch a.format {
+	case FormatOpenAI:
+		a.mergeOpenAI(data)
+	case FormatAnthropic:
+		a.mergeAnthropic(chunk.EventType, data)
+	case FormatGemini:
+		a.mergeGemini(data)
+	default:
+		return fmt.Errorf("不支持聚合的格式: %s", a.format)
+	}
+	return nil
+}
+
+// WriteDone 流结束，聚合器无需处理
+func (a *StreamAggregator) WriteDone() error {
+	return nil
+}
+
+// Response 返回聚合后的完整响应
+func (a *StreamAggregator) Response() ([]byte, error) {
+	switch a.format {
+	case FormatOpenAI:
+		return json.Marshal(a.openAIResponse())
+	case FormatAnthropic:
+		return json.Marshal(a.anthropicResponse())
+	case FormatGemini:
+		return json.Marshal(a.geminiResponse())
+	}
+	return nil, fmt.Errorf("不支持聚合的格式: %s", a.format)
+}
+
+// toJSONMap 将数据块内容统一转换为map，兼容透传的map和转换器构建的结构体
+func toJSONMap(data interface{}) (map[string]interface{}, error) {
+	if m, ok := data.(map[string]interface{}); ok {
+		return m, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// jsonIndex 将JSON数字解析为索引，缺失时为0
+func jsonIndex(value interface{}) int {
+	index, _ := value.(float64)
+	return int(index)
+}
+
+// sortedKeys 按升序返回map的整数key
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// mergeOpenAI 合并OpenAI chat.completion.chunk
+func (a *StreamAggregator) mergeOpenAI(data map[string]interface{}) {
+	if a.openAIBase == nil {
+		a.openAIBase = make(map[string]interface{})
+	}
+	for _, key := range []string{"id", "model", "created", "system_fingerprint"} {
+		if value, ok := data[key]; ok && value != nil {
+			if _, exists := a.openAIBase[key]; !exists {
+				a.openAIBase[key] = value
+			}
+		}
+	}
+	if usage, ok := data["usage"]; ok && usage != nil {
+		a.openAIUsage = usage
+	}
+
+	choices, _ := data["choices"].([]interface{})
+	for _, item := range choices {
+		choiceData, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		index := jsonIndex(choiceData["index"])
+		choice := a.openAIChoices[index]
+		if choice == nil {
+			choice = &aggregatedChoice{toolCalls: make(map[int]map[string]interface{}), toolArgs: make(map[int]*strings.Builder)}
+			a.openAIChoices[index] = choice
+		}
+
+		if reason, ok := choiceData["finish_reason"]; ok && reason != nil {
+			choice.finishReason = reason
+		}
+
+		delta, _ := choiceData["delta"].(map[string]interface{})
+		if role := getString(delta["role"]); role != "" {
+			choice.role = role
+		}
+		if content, ok := delta["content"].(string); ok {
+			choice.content.WriteString(content)
+			choice.hasContent = true
+		}
+
+		toolCalls, _ := delta["tool_calls"].([]interface{})
+		for _, item := range toolCalls {
+			callData, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			callIndex := jsonIndex(callData["index"])
+			call := choice.toolCalls[callIndex]
+			if call == nil {
+				call = map[string]interface{}{"type": "function"}
+				choice.toolCalls[callIndex] = call
+				choice.toolArgs[callIndex] = &strings.Builder{}
+			}
+			if id := getString(callData["id"]); id != "" {
+				call["id"] = id
+			}
+			if function, ok := callData["function"].(map[string]interface{}); ok {
+				if name := getString(function["name"]); name != "" {
+					call["name"] = name
+				}
+				choice.toolArgs[callIndex].WriteString(getString(function["arguments"]))
+			}
+		}
+	}
+}
+
+// openAIResponse 组装OpenAI chat.completion响应
+func (a *StreamAggregator) openAIResponse() map[string]interface{} {
+	response := map[string]interface{}{"object": "chat.completion"}
+	for key, value := range a.openAIBase {
+		response[key] = value
+	}
+
+	choices := make([]interface{}, 0, len(a.openAIChoices))
+	for _, index := range sortedKeys(a.openAIChoices) {
+		choice := a.openAIChoices[index]
+		role := choice.role
+		if role == "" {
+			role = "assistant"
+		}
+		message := map[string]interface{}{"role": role, "content": nil}
+		if choice.hasContent {
+			message["content"] = choice.content.String()
+		}
+
+		if len(choice.toolCalls) > 0 {
+			toolCalls := make([]interface{}, 0, len(choice.toolCalls))
+			for _, callIndex := range sortedKeys(choice.toolCalls) {
+				call := choice.toolCalls[callIndex]
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":   call["id"],
+					"type": call["type"],
+					"function": map[string]interface{}{
+						"name":      call["name"],
+						"arguments": choice.toolArgs[callIndex].String(),
+					},
+				})
+			}
+			message["tool_calls"] = toolCalls
+		}
+
+		choices = append(choices, map[string]interface{}{
+			"index":         index,
+			"message":       message,
+			"logprobs":      nil,
+			"finish_reason": choice.finishReason,
+		})
+	}
+	response["choices"] = choices
+
+	if a.openAIUsage != nil {
+		response["usage"] = a.openAIUsage
+	}
+	return response
+}
+
+// mergeAnthropic 合并Anthropic流式事件
+func (a *StreamAggregator) mergeAnthropic(eventType string, data map[string]interface{}) {
+	if eventType == "" {
+		eventType = getString(data["type"])
+	}
+
+	switch eventType {
+	case "message_start":
+		if message, ok := data["message"].(map[string]interface{}); ok {
+			a.anthropicMessage = message
+		}
+
+	case "content_block_start":
+		index := jsonIndex(data["index"])
+		block, _ := data["content_block"].(map[string]interface{})
+		if block == nil {
+			block = map[string]interface{}{}
+		}
+		a.anthropicBlocks[index] = block
+		if getString(block["type"]) == "tool_use" || getString(block["type"]) == "server_tool_use" {
+			a.anthropicInputs[index] = &strings.Builder{}
+		}
+
+	case "content_block_delta":
+		index := jsonIndex(data["index"])
+		block := a.anthropicBlocks[index]
+		delta, _ := data["delta"].(map[string]interface{})
+		if block == nil || delta == nil {
+			return
+		}
+		switch getString(delta["type"]) {
+		case "text_delta":
+			block["text"] = getString(block["text"]) + getString(delta["text"])
+		case "thinking_delta":
+			block["thinking"] = getString(block["thinking"]) + getString(delta["thinking"])
+		case "signature_delta":
+			block["signature"] = getString(block["signature"]) + getString(delta["signature"])
+		case "input_json_delta":
+			if input := a.anthropicInputs[index]; input != nil {
+				input.WriteString(getString(delta["partial_json"]))
+			}
+		}
+
+	case "message_delta":
+		if a.anthropicMessage == nil {
+			a.anthropicMessage = map[string]interface{}{}
+		}
+		if delta, ok := data["delta"].(map[string]interface{}); ok {
+			for key, value := range delta {
+				a.anthropicMessage[key] = value
+			}
+		}
+		// message_delta中的用量为累计值，覆盖message_start中的对应字段
+		if usage, ok := data["usage"].(map[string]interface{}); ok {
+			merged, _ := a.anthropicMessage["usage"].(map[string]interface{})
+			if merged == nil {
+				merged = map[string]interface{}{}
+			}
+			for key, value := range usage {
+				merged[key] = value
+			}
+			a.anthropicMessage["usage"] = merged
+		}
+	}
+}
+
+// anthropicResponse 组装Anthropic message响应
+func (a *StreamAggregator) anthropicResponse() map[string]interface{} {
+	response := map[string]interface{}{"type": "message", "role": "assistant"}
+	for key, value := range a.anthropicMessage {
+		response[key] = value
+	}
+
+	content := make([]interface{}, 0, len(a.anthropicBlocks))
+	for _, index := range sortedKeys(a.anthropicBlocks) {
+		block := a.anthropicBlocks[index]
+		if input := a.anthropicInputs[index]; input != nil {
+			var parsed interface{} = map[string]interface{}{}
+			if raw := input.String(); raw != "" {
+				if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+					parsed = raw // 参数不是合法JSON时原样保留，便于排查
+				}
+			}
+			block["input"] = parsed
+		}
+		content = append(content, block)
+	}
+	response["content"] = content
+	return response
+}
+
+// mergeGemini 合并Gemini GenerateContentResponse分片
+func (a *StreamAggregator) mergeGemini(data map[string]interface{}) {
+	if a.geminiBase == nil {
+		a.geminiBase = make(map[string]interface{})
+	}
+	for _, key := range []string{"modelVersion", "responseId"} {
+		if value, ok := data[key]; ok && value != nil {
+			a.geminiBase[key] = value
+		}
+	}
+	if usage, ok := data["usageMetadata"]; ok && usage != nil {
+		a.geminiBase["usageMetadata"] = usage
+	}
+
+	candidates, _ := data["candidates"].([]interface{})
+	for position, item := range candidates {
+		candidateData, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		index := position
+		if value, ok := candidateData["index"]; ok {
+			index = jsonIndex(value)
+		}
+		candidate := a.geminiCandidates[index]
+		if candidate == nil {
+			candidate = &aggregatedCandidate{}
+			a.geminiCandidates[index] = candidate
+		}
+
+		if reason, ok := candidateData["finishReason"]; ok && reason != nil {
+			candidate.finishReason = reason
+		}
+
+		content, _ := candidateData["content"].(map[string]interface{})
+		parts, _ := content["parts"].([]interface{})
+		for _, item := range parts {
+			part, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// 相邻的纯文本分片合并为一个part
+			if text, isText := part["text"].(string); isText && len(part) == 1 && len(candidate.parts) > 0 {
+				last := candidate.parts[len(candidate.parts)-1]
+				if lastText, ok := last["text"].(string); ok && len(last) == 1 {
+					last["text"] = lastText + text
+					continue
+				}
+			}
+			candidate.parts = append(candidate.parts, part)
+		}
+	}
+}
+
+// geminiResponse 组装Gemini GenerateContentResponse
+func (a *StreamAggregator) geminiResponse() map[string]interface{} {
+	response := make(map[string]interface{}, len(a.geminiBase)+1)
+	for key, value := range a.geminiBase {
+		response[key] = value
+	}
+
+	candidates := make([]interface{}, 0, len(a.geminiCandidates))
+	for _, index := range sortedKeys(a.geminiCandidates) {
+		candidate := a.geminiCandidates[index]
+		parts := make([]interface{}, 0, len(candidate.parts))
+		for _, part := range candidate.parts {
+			parts = append(parts, part)
+		}
+		entry := map[string]interface{}{
+			"index":   index,
+			"content": map[string]interface{}{"role": "model", "parts": parts},
+		}
+		if candidate.finishReason != nil {
+			entry["finishReason"] = candidate.finishReason
+		}
+		candidates = append(candidates, entry)
+	}
+	response["candidates"] = candidates
+	return response
+}
@@ -0,0 +1,173 @@
+package converter
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// aggregateFixture 聚合同格式透传的流式测试数据，并用该格式的非流式解析器解析结果
+func aggregateFixture(t *testing.T, fixture string, format Format) *types.UnifiedResponse {
+	t.Helper()
+	file, err := os.Open(fixture)
+	if err != nil {
+		t.Fatalf("读取测试数据失败: %v", err)
+	}
+	defer file.Close()
+
+	body, err := AggregateStream(format, file)
+	if err != nil {
+		t.Fatalf("AggregateStream() error = %v", err)
+	}
+
+	conv, _ := NewConverterRegistry().Get(format)
+	response, err := conv.ParseResponse(body)
+	if err != nil {
+		t.Fatalf("聚合结果应是合法的非流式响应: %v\n%s", err, body)
+	}
+	return response
+}
+
+func TestAggregateStream(t *testing.T) {
+	tests := []struct {
+		name         string
+		fixture      string
+		format       Format
+		wantText     string
+		wantTool     string
+		wantArgs     string
+		wantFinish   string
+		wantUsageIn  int
+		wantUsageOut int
+	}{
+		{
+			name:         "Anthropic工具调用",
+			fixture:      "testdata/stream/stream_anthropic_tool_use.txt",
+			format:       FormatAnthropic,
+			wantText:     "I'll help you get the weather information for Tokyo.",
+			wantTool:     "get_weather",
+			wantArgs:     `{"location":"Tokyo","unit":"celsius"}`,
+			wantFinish:   "tool_calls",
+			wantUsageIn:  372,
+			wantUsageOut: 77,
+		},
+		{
+			name:       "OpenAI工具调用",
+			fixture:    "testdata/stream/stream_openai_tool_calls.txt",
+			format:     FormatOpenAI,
+			wantText:   "I'll help you get the weather information.",
+			wantTool:   "get_weather",
+			wantArgs:   `{"location": "Tokyo"}`,
+			wantFinish: "tool_calls",
+		},
+		{
+			name:         "OpenAI携带usage",
+			fixture:      "testdata/stream/stream_openai_usage.txt",
+			format:       FormatOpenAI,
+			wantFinish:   "stop",
+			wantUsageIn:  12,
+			wantUsageOut: 4,
+		},
+		{
+			name:         "Gemini文本分片合并",
+			fixture:      "testdata/gemini/stream_basic.txt",
+			format:       FormatGemini,
+			wantText:     "Hello, world!",
+			wantFinish:   "stop",
+			wantUsageIn:  5,
+			wantUsageOut: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := aggregateFixture(t, tt.fixture, tt.format)
+			if len(response.Choices) != 1 {
+				t.Fatalf("choices = %d, want 1", len(response.Choices))
+			}
+			choice := response.Choices[0]
+
+			if tt.wantText != "" {
+				if text := messageText(choice.Message); text != tt.wantText {
+					t.Errorf("text = %q, want %q", text, tt.wantText)
+				}
+			}
+			if tt.wantTool != "" {
+				if len(choice.Message.ToolCalls) != 1 {
+					t.Fatalf("tool_calls = %+v", choice.Message.ToolCalls)
+				}
+				name, args := toolCallFunction(choice.Message.ToolCalls[0])
+				if name != tt.wantTool || !jsonEqual([]byte(args), []byte(tt.wantArgs)) {
+					t.Errorf("tool call = %s(%s), want %s(%s)", name, args, tt.wantTool, tt.wantArgs)
+				}
+			}
+			if choice.FinishReason != tt.wantFinish {
+				t.Errorf("finish_reason = %q, want %q", choice.FinishReason, tt.wantFinish)
+			}
+			if response.Usage.PromptTokens != tt.wantUsageIn || response.Usage.CompletionTokens != tt.wantUsageOut {
+				t.Errorf("usage = %+v, want %d/%d", response.Usage, tt.wantUsageIn, tt.wantUsageOut)
+			}
+		})
+	}
+}
+
+// toolCallFunction 提取工具调用的函数名和JSON参数
+func toolCallFunction(call map[string]interface{}) (name, arguments string) {
+	function, _ := call["function"].(map[string]interface{})
+	if args, ok := function["arguments"].(string); ok {
+		return getString(function["name"]), args
+	}
+	args, _ := json.Marshal(function["arguments"])
+	return getString(function["name"]), string(args)
+}
+
+// messageText 提取消息中的全部文本
+func messageText(message types.Message) string {
+	switch content := message.Content.(type) {
+	case string:
+		return content
+	case []interface{}:
+		var text strings.Builder
+		for _, item := range content {
+			if block, ok := item.(map[string]interface{}); ok {
+				text.WriteString(getString(block["text"]))
+			}
+		}
+		return text.String()
+	}
+	return ""
+}
+
+func TestStreamAggregator_CrossFormat(t *testing.T) {
+	const fixture = "testdata/stream/stream_anthropic_basic.txt"
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("读取测试数据失败: %v", err)
+	}
+
+	// Anthropic上游流转换为OpenAI客户端流后聚合，应与直接聚合Anthropic流的结果一致
+	aggregator := NewStreamAggregator(FormatOpenAI)
+	if err := NewManager().ProcessStream(strings.NewReader(string(data)), types.ProviderAnthropic, FormatOpenAI, aggregator); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+	body, err := aggregator.Response()
+	if err != nil {
+		t.Fatalf("Response() error = %v", err)
+	}
+	conv, _ := NewConverterRegistry().Get(FormatOpenAI)
+	converted, err := conv.ParseResponse(body)
+	if err != nil {
+		t.Fatalf("ParseResponse() error = %v\n%s", err, body)
+	}
+
+	direct := aggregateFixture(t, fixture, FormatAnthropic)
+	if got, want := messageText(converted.Choices[0].Message), messageText(direct.Choices[0].Message); got != want || got == "" {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+	if got, want := converted.Choices[0].FinishReason, direct.Choices[0].FinishReason; got != want {
+		t.Errorf("finish_reason = %q, want %q", got, want)
+	}
+}
@@ -17,6 +17,12 @@ type AnthropicConverter struct{}
 type AnthropicStreamConverter struct {
 	messageStartSent      bool
 	contentBlockStartSent bool
+	stopReason            string // message_delta中的stop_reason（统一格式），在message_stop时携带
+
+	// 作为目标格式时，结束事件缓冲到流结束再发送，使message_delta能携带上游最后报告的用量
+	pendingStop   bool
+	pendingReason string // 统一格式的结束原因
+	usage         StreamUsage
 }
 
 // NewAnthropicConverter 创建Anthropic转换器
@@ -47,13 +53,21 @@ func (c *AnthropicConverter) ParseRequest(data []byte) (*types.UnifiedRequest, e
 	// 转换消息格式
 	var messages []types.Message
 
-	// 处理system字段
-	var originalSystem *types.SystemField
+	// 处理system字段：messages中混入的system消息（不规范）合并到顶层system之后，
+	// 保证转换后只有一条system内容，不产生重复或冲突
+	var inlineSystem []string
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			if text := c.contentToString(msg.Content); text != "" {
+				inlineSystem = append(inlineSystem, text)
+			}
+		}
+	}
+	originalSystem := mergeSystemField(req.System, inlineSystem)
 	var originalMetadata map[string]interface{}
 
-	if req.System != nil {
-		originalSystem = req.System
-		systemContent := req.System.ToString()
+	if originalSystem != nil {
+		systemContent := originalSystem.ToString()
 		if systemContent != "" {
 			messages = append(messages, types.Message{
 				Role:    "system",
@@ -68,6 +82,11 @@ func (c *AnthropicConverter) ParseRequest(data []byte) (*types.UnifiedRequest, e
 
 	// 添加对话消息
 	for _, msg := range req.Messages {
+		// system消息已合并到顶层system
+		if msg.Role == "system" {
+			continue
+		}
+
 		// 检查消息内容中是否有tool_result，需要转换格式
 		if msg.Role == "user" && msg.Content != nil {
 			if hasToolResult, toolResultMsgs := c.extractToolResults(msg.Content); hasToolResult {
@@ -101,20 +120,30 @@ func (c *AnthropicConverter) ParseRequest(data []byte) (*types.UnifiedRequest, e
 		Stream:           req.Stream,
 		Tools:            req.Tools,
 		ToolChoice:       req.ToolChoice,
+		StopSequences:    req.StopSequences,
 		OriginalFormat:   string(FormatAnthropic),
 		OriginalSystem:   originalSystem,
 		OriginalMetadata: originalMetadata,
+		Extra:            extraFields(data, req),
 	}, nil
 }
 
 // BuildRequest 构建发送给上游Anthropic的请求
 func (c *AnthropicConverter) BuildRequest(request *types.UnifiedRequest) ([]byte, error) {
+	// Anthropic每次只生成一个回复，不支持n>1
+	if request.N != nil && *request.N > 1 {
+		return nil, &UnsupportedContentError{Format: FormatAnthropic, Reason: fmt.Sprintf("n=%d is not supported, only one completion per request", *request.N)}
+	}
+
 	var systemPrompt string
 	var messages []types.FlexibleMessage
 
 	// 分离系统消息和普通消息
 	for _, msg := range request.Messages {
 		if msg.Role == "system" {
+			if contentHasImage(msg.Content) {
+				return nil, &UnsupportedContentError{Format: FormatAnthropic, Reason: "system messages cannot contain images"}
+			}
 			content := c.contentToString(msg.Content)
 			if systemPrompt != "" {
 				systemPrompt += "\n\n" + content
@@ -130,23 +159,45 @@ func (c *AnthropicConverter) BuildRequest(request *types.UnifiedRequest) ([]byte
 			assistantMsg := c.convertToolCallsToAnthropic(msg)
 			messages = append(messages, assistantMsg)
 		} else {
+			content, err := c.convertImageBlocks(msg.Content)
+			if err != nil {
+				return nil, err
+			}
 			messages = append(messages, types.FlexibleMessage{
 				Role:    msg.Role,
-				Content: msg.Content,
+				Content: content,
 			})
 		}
 	}
 
+	// Anthropic没有JSON模式，response_format转换为system提示
+	formatInstruction, err := c.responseFormatInstruction(request.ResponseFormat)
+	if err != nil {
+		return nil, err
+	}
+	if formatInstruction != "" {
+		if systemPrompt != "" {
+			systemPrompt += "\n\n" + formatInstruction
+		} else {
+			systemPrompt = formatInstruction
+		}
+	}
+
 	convertedTools := c.convertTools(request.Tools)
 
 	req := types.AnthropicRequest{
-		Model:       request.Model,
-		Messages:    messages,
-		MaxTokens:   request.MaxTokens,
-		Temperature: request.Temperature,
-		Stream:      request.Stream,
-		Tools:       convertedTools,
-		// 注意：故意不设置ToolChoice字段 - Anthropic默认为auto行为
+		Model:         request.Model,
+		Messages:      messages,
+		MaxTokens:     request.MaxTokens,
+		Temperature:   request.Temperature,
+		Stream:        request.Stream,
+		Tools:         convertedTools,
+		StopSequences: request.StopSequences,
+	}
+
+	// 未指定tool_choice时不设置该字段，Anthropic默认为auto行为；没有工具时tool_choice无意义
+	if len(convertedTools) > 0 {
+		req.ToolChoice = c.convertToolChoice(request.ToolChoice)
 	}
 
 	// 设置系统字段，并确保Claude Code身份在最前面
@@ -157,7 +208,35 @@ func (c *AnthropicConverter) BuildRequest(request *types.UnifiedRequest) ([]byte
 		req.Metadata = request.OriginalMetadata
 	}
 
-	return json.Marshal(req)
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return applyExtraFields(data, request, FormatAnthropic)
+}
+
+// convertImageBlocks 将内容中的OpenAI image_url块转换为Anthropic图片块，其余内容原样保留
+func (c *AnthropicConverter) convertImageBlocks(content interface{}) (interface{}, error) {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return content, nil
+	}
+
+	converted := make([]interface{}, 0, len(blocks))
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok || getString(block["type"]) != "image_url" {
+			converted = append(converted, item)
+			continue
+		}
+
+		imageBlock, err := anthropicImageBlock(imageURLFromBlock(block))
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, imageBlock)
+	}
+	return converted, nil
 }
 
 // extractToolResults 从Anthropic消息内容中提取tool_result并转换为中间格式
@@ -215,9 +294,10 @@ func (c *AnthropicConverter) extractToolResults(content interface{}) (bool, []ty
 
 			// 创建中间格式的tool消息
 			toolMsg := types.Message{
-				Role:       "tool",
-				Content:    resultContent,
-				ToolCallID: &toolCallID,
+				Role:         "tool",
+				Content:      resultContent,
+				ToolCallID:   &toolCallID,
+				CacheControl: cacheControlOf(itemMap),
 				// Name字段需要从上下文推断，这里暂时留空
 				// 实际使用中，OpenAI API对name字段要求不严格
 			}
@@ -239,6 +319,7 @@ func (c *AnthropicConverter) extractToolUse(content interface{}) (bool, types.Me
 
 	var toolCalls []map[string]interface{}
 	var textContent string
+	var cacheControl map[string]interface{}
 	hasToolUse := false
 
 	for _, item := range contentArray {
@@ -246,6 +327,9 @@ func (c *AnthropicConverter) extractToolUse(content interface{}) (bool, types.Me
 		if !ok {
 			continue
 		}
+		if cc := cacheControlOf(itemMap); cc != nil {
+			cacheControl = cc
+		}
 
 		itemType, exists := itemMap["type"]
 		if !exists {
@@ -316,8 +400,9 @@ func (c *AnthropicConverter) extractToolUse(content interface{}) (bool, types.Me
 
 	// 创建中间格式的assistant消息
 	msg := types.Message{
-		Role:      "assistant",
-		ToolCalls: toolCalls,
+		Role:         "assistant",
+		ToolCalls:    toolCalls,
+		CacheControl: cacheControl,
 	}
 
 	// 如果有文本内容，设置content；否则设置为nil（OpenAI格式要求）
@@ -332,9 +417,15 @@ func (c *AnthropicConverter) extractToolUse(content interface{}) (bool, types.Me
 
 // convertToolMessageToAnthropic 将中间格式的tool消息转换为Anthropic的tool_result格式
 func (c *AnthropicConverter) convertToolMessageToAnthropic(msg types.Message) types.FlexibleMessage {
+	// tool_call_id缺失时保留空ID，交由上游返回校验错误而不是panic
+	toolUseID := ""
+	if msg.ToolCallID != nil {
+		toolUseID = *msg.ToolCallID
+	}
+
 	toolResult := map[string]interface{}{
 		"type":        "tool_result",
-		"tool_use_id": *msg.ToolCallID,
+		"tool_use_id": toolUseID,
 		"content": []map[string]interface{}{
 			{
 				"type": "text",
@@ -342,6 +433,9 @@ func (c *AnthropicConverter) convertToolMessageToAnthropic(msg types.Message) ty
 			},
 		},
 	}
+	if msg.CacheControl != nil {
+		toolResult["cache_control"] = msg.CacheControl
+	}
 
 	return types.FlexibleMessage{
 		Role:    "user",
@@ -367,28 +461,84 @@ func (c *AnthropicConverter) convertToolCallsToAnthropic(msg types.Message) type
 		toolUse := map[string]interface{}{
 			"type": "tool_use",
 			"id":   toolCall["id"],
-			"name": toolCall["function"].(map[string]interface{})["name"],
 		}
 
-		// 解析arguments JSON字符串为对象
+		// 解析arguments JSON字符串为对象，Anthropic要求tool_use必须带input
 		if functionData, ok := toolCall["function"].(map[string]interface{}); ok {
-			if argsStr, ok := functionData["arguments"].(string); ok {
-				var args interface{}
-				if err := json.Unmarshal([]byte(argsStr), &args); err == nil {
-					toolUse["input"] = args
-				}
-			}
+			toolUse["name"] = functionData["name"]
+			toolUse["input"] = parseToolArguments(getString(functionData["name"]), functionData["arguments"])
 		}
 
 		content = append(content, toolUse)
 	}
 
+	// 文本与tool_use块在中间格式中被拆分，cache_control缓存断点统一放回消息的最后一个块
+	if msg.CacheControl != nil && len(content) > 0 {
+		content[len(content)-1].(map[string]interface{})["cache_control"] = msg.CacheControl
+	}
+
 	return types.FlexibleMessage{
 		Role:    "assistant",
 		Content: content,
 	}
 }
 
+// cacheControlOf 返回内容块的cache_control标记，未设置时返回nil
+func cacheControlOf(block map[string]interface{}) map[string]interface{} {
+	cacheControl, _ := block["cache_control"].(map[string]interface{})
+	return cacheControl
+}
+
+// parseToolArguments 将工具调用参数（JSON字符串或对象）解析为对象。
+// 模型偶尔生成非法JSON或非对象参数，此时记录警告并返回空对象，避免tool_use缺少input导致多轮工具调用失败
+func parseToolArguments(name string, arguments interface{}) map[string]interface{} {
+	switch v := arguments.(type) {
+	case map[string]interface{}:
+		return v
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return map[string]interface{}{}
+		}
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(v), &args); err != nil || args == nil {
+			logger.Warn("工具 %s 的arguments不是合法的JSON对象，使用空对象代替: %s", name, v)
+			return map[string]interface{}{}
+		}
+		return args
+	case nil:
+		return map[string]interface{}{}
+	default:
+		logger.Warn("工具 %s 的arguments类型不支持(%T)，使用空对象代替", name, arguments)
+		return map[string]interface{}{}
+	}
+}
+
+// mergeSystemField 将messages中的system文本追加到顶层system之后：字符串格式以空行拼接，
+// 数组格式追加为文本块（保留原有块的cache_control）。没有需要合并的内容时原样返回
+func mergeSystemField(system *types.SystemField, inline []string) *types.SystemField {
+	if len(inline) == 0 {
+		return system
+	}
+
+	merged := &types.SystemField{}
+	if system == nil || system.IsString() {
+		parts := inline
+		if system != nil && system.ToString() != "" {
+			parts = append([]string{system.ToString()}, inline...)
+		}
+		jsonBytes, _ := json.Marshal(strings.Join(parts, "\n\n"))
+		_ = merged.UnmarshalJSON(jsonBytes)
+		return merged
+	}
+
+	blocks := append([]types.SystemBlock{}, system.ToArray()...)
+	for _, text := range inline {
+		blocks = append(blocks, types.SystemBlock{Type: "text", Text: text})
+	}
+	merged.SetArray(blocks)
+	return merged
+}
+
 // buildSystemField 构建system字段，确保Claude Code身份在最前面
 func (c *AnthropicConverter) buildSystemField(originalSystem *types.SystemField, systemPrompt string) *types.SystemField {
 	claudeCodeIdentity := "You are Claude Code, Anthropic's official CLI for Claude."
@@ -661,6 +811,60 @@ func (c *AnthropicConverter) convertTools(tools []map[string]interface{}) []map[
 	return converted
 }
 
+// convertToolChoice 将OpenAI/Anthropic的tool_choice转换为Anthropic格式，无法识别时返回nil（不设置该字段）
+func (c *AnthropicConverter) convertToolChoice(toolChoice interface{}) interface{} {
+	switch v := toolChoice.(type) {
+	case string:
+		switch v {
+		case "auto", "none", "any":
+			return map[string]interface{}{"type": v}
+		case "required":
+			return map[string]interface{}{"type": "any"}
+		}
+	case map[string]interface{}:
+		switch getString(v["type"]) {
+		case "auto", "none", "any", "tool":
+			// 已经是Anthropic格式，保留disable_parallel_tool_use等附加字段
+			return v
+		case "function":
+			if function, ok := v["function"].(map[string]interface{}); ok && getString(function["name"]) != "" {
+				return map[string]interface{}{"type": "tool", "name": getString(function["name"])}
+			}
+		}
+	}
+	return nil
+}
+
+// responseFormatInstruction 将OpenAI的response_format转换为system提示：json_object要求只输出JSON对象，
+// json_schema附带schema要求输出符合schema的JSON；text或未设置时返回空串，无法转换的类型返回UnsupportedContentError
+func (c *AnthropicConverter) responseFormatInstruction(responseFormat map[string]interface{}) (string, error) {
+	if responseFormat == nil {
+		return "", nil
+	}
+
+	const onlyJSON = "Do not include any explanation, markdown code fences or other text outside the JSON."
+	switch formatType := getString(responseFormat["type"]); formatType {
+	case "", "text":
+		return "", nil
+	case "json_object":
+		return "Respond only with a single valid JSON object. " + onlyJSON, nil
+	case "json_schema":
+		jsonSchema, _ := responseFormat["json_schema"].(map[string]interface{})
+		schema, ok := jsonSchema["schema"]
+		if !ok {
+			return "", &UnsupportedContentError{Format: FormatAnthropic, Reason: "response_format json_schema requires a schema"}
+		}
+		schemaJSON, err := json.Marshal(schema)
+		if err != nil {
+			return "", &UnsupportedContentError{Format: FormatAnthropic, Reason: "response_format json_schema has an invalid schema"}
+		}
+		return "Respond only with a single valid JSON value that conforms to the following JSON schema. " + onlyJSON +
+			"\n\nJSON schema:\n" + string(schemaJSON), nil
+	default:
+		return "", &UnsupportedContentError{Format: FormatAnthropic, Reason: fmt.Sprintf("response_format type %q is not supported", formatType)}
+	}
+}
+
 // convertContent 转换响应内容
 func (c *AnthropicConverter) convertContent(content interface{}, toolCalls []map[string]interface{}) []types.AnthropicContentBlock {
 	// 如果原始内容已经是Anthropic数组格式
@@ -710,7 +914,7 @@ func (c *AnthropicConverter) convertContent(content interface{}, toolCalls []map
 					Type:  "tool_use",
 					ID:    fmt.Sprintf("%v", toolCall["id"]),
 					Name:  fmt.Sprintf("%v", funcData["name"]),
-					Input: funcData["arguments"],
+					Input: parseToolArguments(getString(funcData["name"]), funcData["arguments"]),
 				})
 			}
 		}
@@ -725,32 +929,12 @@ func (c *AnthropicConverter) convertContent(content interface{}, toolCalls []map
 
 // convertStopReason 转换Anthropic停止原因到标准格式
 func (c *AnthropicConverter) convertStopReason(stopReason string) string {
-	switch stopReason {
-	case "end_turn":
-		return "stop"
-	case "max_tokens":
-		return "length"
-	case "stop_sequence":
-		return "stop"
-	case "tool_use":
-		return "tool_calls"
-	default:
-		return "stop"
-	}
+	return toUnifiedFinishReason(FormatAnthropic, stopReason)
 }
 
 // convertFinishReason 转换标准格式到Anthropic停止原因
 func (c *AnthropicConverter) convertFinishReason(finishReason string) string {
-	switch finishReason {
-	case "stop":
-		return "end_turn"
-	case "length":
-		return "max_tokens"
-	case "tool_calls":
-		return "tool_use"
-	default:
-		return "end_turn"
-	}
+	return fromUnifiedFinishReason(FormatAnthropic, finishReason)
 }
 
 // NewStreamConverter 创建新的流式转换器实例
@@ -771,11 +955,16 @@ func (sc *AnthropicStreamConverter) ParseStreamEvent(eventType string, data []by
 			id := getString(messageData["id"])
 			model := getString(messageData["model"])
 
-			return []*UnifiedStreamEvent{{
+			events := []*UnifiedStreamEvent{{
 				Type:      StreamEventMessageStart,
 				MessageID: id,
 				Model:     model,
-			}}, nil
+			}}
+			// message_start.usage 给出输入token数及初始输出token数
+			if usage := anthropicStreamUsage(messageData["usage"]); usage != nil {
+				events = append(events, usage)
+			}
+			return events, nil
 		}
 
 	case "content_block_delta":
@@ -811,16 +1000,47 @@ func (sc *AnthropicStreamConverter) ParseStreamEvent(eventType string, data []by
 			}
 		}
 
+	case "message_delta":
+		if delta, ok := eventData["delta"].(map[string]interface{}); ok {
+			if stopReason := getString(delta["stop_reason"]); stopReason != "" {
+				sc.stopReason = toUnifiedFinishReason(FormatAnthropic, stopReason)
+			}
+		}
+		// usage.output_tokens 为截至此刻的累计输出token数
+		if usage := anthropicStreamUsage(eventData["usage"]); usage != nil {
+			return []*UnifiedStreamEvent{usage}, nil
+		}
+
 	case "message_stop":
 		return []*UnifiedStreamEvent{{
-			Type:   StreamEventMessageStop,
-			IsDone: false, // 不设置IsDone，让[DONE]来触发结束
+			Type:         StreamEventMessageStop,
+			FinishReason: sc.stopReason,
+			IsDone:       false, // 不设置IsDone，让[DONE]来触发结束
 		}}, nil
 	}
 
 	return nil, nil // 跳过不识别的事件
 }
 
+// anthropicStreamUsage 将message_start/message_delta中的usage转换为统一用量事件，无用量时返回nil
+func anthropicStreamUsage(raw interface{}) *UnifiedStreamEvent {
+	usage, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, key := range []string{"input_tokens", "output_tokens"} {
+		if value, ok := usage[key].(float64); ok && value > 0 {
+			counts[key] = int(value)
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	return &UnifiedStreamEvent{Type: StreamEventUsage, Usage: counts}
+}
+
 // BuildStreamEvent 从统一内部格式构建Anthropic流式事件
 func (sc *AnthropicStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent) (*StreamChunk, error) {
 	switch event.Type {
@@ -845,7 +1065,6 @@ func (sc *AnthropicStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent)
 		return &StreamChunk{
 			EventType: "message_start",
 			Data:      messageStart,
-			Tokens:    0,
 			IsDone:    false,
 		}, nil
 
@@ -887,7 +1106,6 @@ func (sc *AnthropicStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent)
 			return &StreamChunk{
 				EventType: "content_block_start",
 				Data:      contentBlockStart,
-				Tokens:    0,
 				IsDone:    false,
 			}, nil
 		}
@@ -919,7 +1137,6 @@ func (sc *AnthropicStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent)
 			return &StreamChunk{
 				EventType: "content_block_delta",
 				Data:      contentBlockDelta,
-				Tokens:    0,
 				IsDone:    false,
 			}, nil
 		}
@@ -935,26 +1152,56 @@ func (sc *AnthropicStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent)
 		return &StreamChunk{
 			EventType: "content_block_stop",
 			Data:      contentBlockStop,
-			Tokens:    0,
 			IsDone:    false,
 		}, nil
 
 	case StreamEventMessageStop:
-		messageStop := map[string]interface{}{
-			"type": "message_stop",
-		}
+		// OpenAI在finish_reason之后的chunk中才报告用量，message_delta和message_stop在FinishStream中发送
+		sc.pendingStop = true
+		sc.pendingReason = event.FinishReason
+		return nil, nil
 
-		return &StreamChunk{
-			EventType: "message_stop",
-			Data:      messageStop,
-			Tokens:    0,
-			IsDone:    false, // 不设置IsDone，让[DONE]来触发结束
-		}, nil
+	case StreamEventUsage:
+		sc.usage.Merge(streamUsageFromEvent(event))
 	}
 
 	return nil, nil
 }
 
+// FinishStream 发送缓冲的结束事件：携带stop_reason和用量的message_delta，然后是message_stop
+func (sc *AnthropicStreamConverter) FinishStream() []*StreamChunk {
+	if !sc.pendingStop {
+		return nil
+	}
+	sc.pendingStop = false
+
+	usage := map[string]interface{}{
+		"output_tokens": sc.usage.OutputTokens,
+	}
+	if sc.usage.InputTokens > 0 {
+		usage["input_tokens"] = sc.usage.InputTokens
+	}
+
+	return []*StreamChunk{
+		{
+			EventType: "message_delta",
+			Data: map[string]interface{}{
+				"type": "message_delta",
+				"delta": map[string]interface{}{
+					"stop_reason":   fromUnifiedFinishReason(FormatAnthropic, sc.pendingReason),
+					"stop_sequence": nil,
+				},
+				"usage": usage,
+			},
+		},
+		{
+			EventType: "message_stop",
+			Data:      map[string]interface{}{"type": "message_stop"},
+			IsDone:    false, // 不设置IsDone，让[DONE]来触发结束
+		},
+	}
+}
+
 // NeedPreEvents 返回需要自动生成的前置事件
 func (sc *AnthropicStreamConverter) NeedPreEvents(event *UnifiedStreamEvent) []*UnifiedStreamEvent {
 	var events []*UnifiedStreamEvent
@@ -0,0 +1,33 @@
+package converter
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// azureDeploymentPlaceholder Azure上游路径中的部署名占位符
+	azureDeploymentPlaceholder = "{deployment}"
+	// DefaultAzureAPIVersion 账号未配置api-version时使用的Azure OpenAI API版本
+	DefaultAzureAPIVersion = "2024-06-01"
+)
+
+// azureUpstreamPath 将OpenAI上游路径转换为Azure部署路径模板，
+// 如 /v1/chat/completions -> /openai/deployments/{deployment}/chat/completions
+func azureUpstreamPath(openAIPath string) string {
+	return "/openai/deployments/" + azureDeploymentPlaceholder + strings.TrimPrefix(openAIPath, "/v1")
+}
+
+// ResolveAzurePath 替换Azure上游路径模板中的部署名，并追加api-version查询参数
+func ResolveAzurePath(path, deployment, apiVersion string) string {
+	if apiVersion == "" {
+		apiVersion = DefaultAzureAPIVersion
+	}
+	path = strings.ReplaceAll(path, azureDeploymentPlaceholder, url.PathEscape(deployment))
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "api-version=" + url.QueryEscape(apiVersion)
+}
@@ -43,6 +43,12 @@ type StreamConverter interface {
 	NeedPreEvents(event *UnifiedStreamEvent) []*UnifiedStreamEvent
 }
 
+// StreamFinisher 可选接口：目标流式转换器需要缓冲结束事件时实现，
+// 在流结束（[DONE]或上游EOF）时返回缓冲的数据块
+type StreamFinisher interface {
+	FinishStream() []*StreamChunk
+}
+
 // ConverterFactory 转换器工厂接口
 type ConverterFactory interface {
 	Converter
@@ -67,6 +73,7 @@ const (
 	StreamEventContentDelta
 	StreamEventContentStop
 	StreamEventMessageStop
+	StreamEventUsage // 上游报告的token用量（见Usage字段），本身不对应客户端可见内容
 )
 
 // UnifiedStreamContent 统一流式内容
@@ -86,15 +93,47 @@ type UnifiedStreamEvent struct {
 	MessageID string                `json:"message_id,omitempty"`
 	Model     string                `json:"model,omitempty"`
 	Usage     map[string]int        `json:"usage,omitempty"`
-	IsDone    bool                  `json:"is_done"`
+	// FinishReason 统一格式的结束原因（见FinishReason*常量），仅MessageStop事件携带，为空时按stop处理
+	FinishReason string `json:"finish_reason,omitempty"`
+	IsDone       bool   `json:"is_done"`
 }
 
 // StreamChunk 流式数据块 (保持向后兼容)
+// Data为nil且IsDone为false的数据块只携带Usage，写入器不应将其发送给客户端
 type StreamChunk struct {
-	EventType string      `json:"event_type,omitempty"` // Anthropic事件类型
-	Data      interface{} `json:"data"`                 // 事件数据
-	Tokens    int         `json:"tokens"`               // Token统计
-	IsDone    bool        `json:"is_done"`              // 是否结束
+	EventType string       `json:"event_type,omitempty"` // Anthropic事件类型
+	Data      interface{}  `json:"data"`                 // 事件数据
+	Usage     *StreamUsage `json:"usage,omitempty"`      // 上游报告的token用量（仅用量事件非nil）
+	IsDone    bool         `json:"is_done"`              // 是否结束
+}
+
+// StreamUsage 流式响应的token用量
+type StreamUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Merge 合并一次上游用量报告。各提供商流式报告的用量都是截至当前的累计值：
+// Anthropic 的 message_start 给出输入token和初始输出token，之后每个 message_delta
+// 给出累计输出token，因此非0字段覆盖已有值而不是相加，最终结果与非流式响应的usage一致
+func (u *StreamUsage) Merge(other *StreamUsage) {
+	if other == nil {
+		return
+	}
+	if other.InputTokens > 0 {
+		u.InputTokens = other.InputTokens
+	}
+	if other.OutputTokens > 0 {
+		u.OutputTokens = other.OutputTokens
+	}
+}
+
+// streamUsageFromEvent 从统一用量事件中提取token用量
+func streamUsageFromEvent(event *UnifiedStreamEvent) *StreamUsage {
+	return &StreamUsage{
+		InputTokens:  event.Usage["input_tokens"],
+		OutputTokens: event.Usage["output_tokens"],
+	}
 }
 
 // ConverterRegistry 转换器注册表接口
@@ -130,6 +169,7 @@ func NewConverterRegistry() ConverterRegistry {
 	// 注册内置转换器
 	registry.Register(FormatOpenAI, NewOpenAIConverter())
 	registry.Register(FormatAnthropic, NewAnthropicConverter())
+	registry.Register(FormatGemini, NewGeminiConverter())
 
 	return registry
 }
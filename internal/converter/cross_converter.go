@@ -126,11 +126,15 @@ func (c *crossConverter) ConvertStream(from, to Format, reader io.Reader, writer
 		targetWriter: writer,
 	}
 
-	// 使用SSE工具函数处理流式转换
-	return ProcessSSEStream(reader, fromConverter, crossWriter)
+	// 使用SSE工具函数处理流式转换；上游未发送结束标记时在EOF补发缓冲的结束事件
+	if err := ProcessSSEStream(reader, fromConverter, crossWriter); err != nil {
+		return err
+	}
+	return crossWriter.finish()
 }
 
 // forwardStream 直接转发流
+// 同格式时不经过统一格式，原样保留上游chunk（如 n>1 时的多个choice）
 func (c *crossConverter) forwardStream(from Format, reader io.Reader, writer StreamWriter) error {
 	// 获取转换器用于格式处理
 	converter, err := c.registry.Get(from)
@@ -138,8 +142,12 @@ func (c *crossConverter) forwardStream(from Format, reader io.Reader, writer Str
 		return fmt.Errorf("获取转换器失败: %w", err)
 	}
 
-	// 直接使用SSE工具函数转发
-	return ProcessSSEStream(reader, converter, writer)
+	var streamConverter StreamConverter
+	if factory, ok := converter.(ConverterFactory); ok {
+		streamConverter = factory.NewStreamConverter()
+	}
+
+	return ForwardSSEStream(reader, converter.GetFormat() == FormatAnthropic, streamConverter, writer)
 }
 
 // crossFormatWriter 跨格式流写入器
@@ -147,6 +155,7 @@ type crossFormatWriter struct {
 	sourceStream StreamConverter
 	targetStream StreamConverter
 	targetWriter StreamWriter
+	finished     bool
 }
 
 // WriteChunk 写入转换后的数据块
@@ -198,6 +207,14 @@ func (w *crossFormatWriter) WriteChunk(chunk *StreamChunk) error {
 			return fmt.Errorf("构建目标格式流事件失败: %w", err)
 		}
 
+		// 用量事件在目标格式中没有对应输出时，以空数据块单独传递用量
+		if unifiedEvent.Type == StreamEventUsage {
+			if result == nil {
+				result = &StreamChunk{}
+			}
+			result.Usage = streamUsageFromEvent(unifiedEvent)
+		}
+
 		// 如果结果不为nil，写入目标写入器
 		if result != nil {
 			if err := w.targetWriter.WriteChunk(result); err != nil {
@@ -209,7 +226,29 @@ func (w *crossFormatWriter) WriteChunk(chunk *StreamChunk) error {
 	return nil
 }
 
-// WriteDone 写入完成信号
+// WriteDone 先写出目标转换器缓冲的结束事件，再写入完成信号
 func (w *crossFormatWriter) WriteDone() error {
+	if err := w.finish(); err != nil {
+		return err
+	}
 	return w.targetWriter.WriteDone()
 }
+
+// finish 写出目标转换器缓冲的结束事件，只执行一次
+func (w *crossFormatWriter) finish() error {
+	if w.finished {
+		return nil
+	}
+	w.finished = true
+
+	finisher, ok := w.targetStream.(StreamFinisher)
+	if !ok {
+		return nil
+	}
+	for _, chunk := range finisher.FinishStream() {
+		if err := w.targetWriter.WriteChunk(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,9 +2,13 @@ package converter
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
 )
 
 // CrossFormatTestCase 跨格式转换测试用例
@@ -553,3 +557,411 @@ func validateAnthropicToolUseToOpenAIResponse(input, output []byte) error {
 
 	return nil
 }
+
+// TestStopSequencesRoundTrip 测试OpenAI stop与Anthropic/Gemini停止序列互转
+func TestStopSequencesRoundTrip(t *testing.T) {
+	manager := NewManager()
+
+	tests := []struct {
+		name   string
+		from   Format
+		to     Format
+		input  string
+		field  string
+		want   []interface{}
+		nested bool // Gemini的停止序列位于generationConfig中
+	}{
+		{"OpenAI字符串stop转Anthropic", FormatOpenAI, FormatAnthropic,
+			`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"stop":"END"}`,
+			"stop_sequences", []interface{}{"END"}, false},
+		{"OpenAI数组stop转Anthropic", FormatOpenAI, FormatAnthropic,
+			`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"stop":["a","b"]}`,
+			"stop_sequences", []interface{}{"a", "b"}, false},
+		{"Anthropic转OpenAI", FormatAnthropic, FormatOpenAI,
+			`{"model":"claude-3","max_tokens":10,"messages":[{"role":"user","content":"hi"}],"stop_sequences":["END"]}`,
+			"stop", []interface{}{"END"}, false},
+		{"OpenAI转Gemini", FormatOpenAI, FormatGemini,
+			`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"stop":"END"}`,
+			"stopSequences", []interface{}{"END"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := manager.ConvertRequest(tt.from, tt.to, []byte(tt.input))
+			if err != nil {
+				t.Fatalf("ConvertRequest() error = %v", err)
+			}
+
+			var result map[string]interface{}
+			if err := json.Unmarshal(output, &result); err != nil {
+				t.Fatalf("解析输出失败: %v", err)
+			}
+			if tt.nested {
+				result, _ = result["generationConfig"].(map[string]interface{})
+			}
+			if got := fmt.Sprint(result[tt.field]); got != fmt.Sprint(tt.want) {
+				t.Errorf("%s = %s, want %v (输出: %s)", tt.field, got, tt.want, output)
+			}
+		})
+	}
+
+	// 未指定停止序列时不输出该字段
+	output, err := manager.ConvertRequest(FormatOpenAI, FormatAnthropic, []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"stop":null}`))
+	if err != nil {
+		t.Fatalf("ConvertRequest() error = %v", err)
+	}
+	var result map[string]interface{}
+	_ = json.Unmarshal(output, &result)
+	if _, exists := result["stop_sequences"]; exists {
+		t.Errorf("stop为null时不应输出stop_sequences: %s", output)
+	}
+}
+
+// TestZeroTemperaturePreserved 测试显式的temperature=0不会被当作未设置而丢弃
+func TestZeroTemperaturePreserved(t *testing.T) {
+	manager := NewManager()
+
+	tests := []struct {
+		name   string
+		from   Format
+		to     Format
+		input  string
+		nested bool // Gemini的temperature位于generationConfig中
+	}{
+		{"OpenAI转Anthropic", FormatOpenAI, FormatAnthropic,
+			`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"temperature":0}`, false},
+		{"Anthropic转OpenAI", FormatAnthropic, FormatOpenAI,
+			`{"model":"claude-3","max_tokens":10,"messages":[{"role":"user","content":"hi"}],"temperature":0}`, false},
+		{"OpenAI转Gemini", FormatOpenAI, FormatGemini,
+			`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"temperature":0}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := manager.ConvertRequest(tt.from, tt.to, []byte(tt.input))
+			if err != nil {
+				t.Fatalf("ConvertRequest() error = %v", err)
+			}
+
+			var result map[string]interface{}
+			_ = json.Unmarshal(output, &result)
+			if tt.nested {
+				result, _ = result["generationConfig"].(map[string]interface{})
+			}
+			if temperature, exists := result["temperature"]; !exists || temperature != float64(0) {
+				t.Errorf("temperature=0应传给上游: %s", output)
+			}
+		})
+	}
+
+	// 未指定temperature时不输出该字段，由上游使用默认值
+	output, err := manager.ConvertRequest(FormatOpenAI, FormatAnthropic, []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatalf("ConvertRequest() error = %v", err)
+	}
+	var result map[string]interface{}
+	_ = json.Unmarshal(output, &result)
+	if _, exists := result["temperature"]; exists {
+		t.Errorf("未指定temperature时不应输出: %s", output)
+	}
+}
+
+func TestImageContentConversion(t *testing.T) {
+	manager := NewManager()
+
+	openAIImageRequest := func(url string) string {
+		return `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"text","text":"describe"},{"type":"image_url","image_url":{"url":"` + url + `"}}]}]}`
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		wantSource map[string]interface{}
+	}{
+		{"https URL", openAIImageRequest("https://example.com/cat.png"),
+			map[string]interface{}{"type": "url", "url": "https://example.com/cat.png"}},
+		{"data URL", openAIImageRequest("data:image/png;base64,iVBORw0KGgo="),
+			map[string]interface{}{"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := manager.ConvertRequest(FormatOpenAI, FormatAnthropic, []byte(tt.input))
+			if err != nil {
+				t.Fatalf("ConvertRequest() error = %v", err)
+			}
+
+			var result struct {
+				Messages []struct {
+					Content []map[string]interface{} `json:"content"`
+				} `json:"messages"`
+			}
+			if err := json.Unmarshal(output, &result); err != nil {
+				t.Fatalf("解析输出失败: %v", err)
+			}
+			if len(result.Messages) != 1 || len(result.Messages[0].Content) != 2 {
+				t.Fatalf("内容块数量不符: %s", output)
+			}
+			image := result.Messages[0].Content[1]
+			if image["type"] != "image" || fmt.Sprint(image["source"]) != fmt.Sprint(tt.wantSource) {
+				t.Errorf("image block = %v, want source %v", image, tt.wantSource)
+			}
+
+			// 转回OpenAI格式后图片URL保持不变
+			back, err := manager.ConvertRequest(FormatAnthropic, FormatOpenAI, output)
+			if err != nil {
+				t.Fatalf("ConvertRequest() back error = %v", err)
+			}
+			var original, roundTrip struct {
+				Messages []interface{} `json:"messages"`
+			}
+			_ = json.Unmarshal([]byte(tt.input), &original)
+			_ = json.Unmarshal(back, &roundTrip)
+			// Anthropic转换会注入system身份提示，只比较最后一条用户消息
+			if got, want := roundTrip.Messages[len(roundTrip.Messages)-1], original.Messages[0]; fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("往返转换后消息 = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestImageContentConversion_Unsupported(t *testing.T) {
+	manager := NewManager()
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"非base64的data URL", `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png,raw"}}]}]}`},
+		{"不支持的图片类型", `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/bmp;base64,Qk0="}}]}]}`},
+		{"非http协议", `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"file:///etc/cat.png"}}]}]}`},
+		{"system消息含图片", `{"model":"gpt-4o","messages":[{"role":"system","content":[{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]},{"role":"user","content":"hi"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := manager.ConvertRequest(FormatOpenAI, FormatAnthropic, []byte(tt.input))
+			var contentErr *UnsupportedContentError
+			if !errors.As(err, &contentErr) {
+				t.Errorf("error = %v, want UnsupportedContentError", err)
+			}
+		})
+	}
+}
+
+// TestToolArgumentsTolerance 测试非法的tool_call arguments转换为Anthropic时input回退为空对象
+func TestToolArgumentsTolerance(t *testing.T) {
+	manager := NewManager()
+
+	tests := []struct {
+		name      string
+		arguments string
+		want      string
+	}{
+		{"合法JSON", `{\"city\":\"Paris\"}`, `{"city":"Paris"}`},
+		{"非法JSON", `{\"city\":`, `{}`},
+		{"空字符串", ``, `{}`},
+		{"非对象", `[1,2]`, `{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `{"model":"gpt-4","messages":[{"role":"user","content":"weather?"},` +
+				`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"` + tt.arguments + `"}}]},` +
+				`{"role":"tool","tool_call_id":"call_1","content":"sunny"}]}`
+			output, err := manager.ConvertRequest(FormatOpenAI, FormatAnthropic, []byte(input))
+			if err != nil {
+				t.Fatalf("ConvertRequest() error = %v", err)
+			}
+
+			var result struct {
+				Messages []struct {
+					Content json.RawMessage `json:"content"`
+				} `json:"messages"`
+			}
+			if err := json.Unmarshal(output, &result); err != nil {
+				t.Fatalf("解析输出失败: %v", err)
+			}
+			var blocks []map[string]json.RawMessage
+			if len(result.Messages) < 2 || json.Unmarshal(result.Messages[1].Content, &blocks) != nil || len(blocks) == 0 {
+				t.Fatalf("缺少assistant tool_use消息: %s", output)
+			}
+			if got := string(blocks[len(blocks)-1]["input"]); got != tt.want {
+				t.Errorf("input = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultipleCompletions(t *testing.T) {
+	manager := NewManager()
+	input := []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"n":3}`)
+
+	// OpenAI上游原样携带n
+	output, err := manager.ConvertRequest(FormatOpenAI, FormatOpenAI, input)
+	if err != nil {
+		t.Fatalf("ConvertRequest() error = %v", err)
+	}
+	var openAIReq map[string]interface{}
+	_ = json.Unmarshal(output, &openAIReq)
+	if openAIReq["n"] != float64(3) {
+		t.Errorf("OpenAI上游应收到n=3: %s", output)
+	}
+
+	// Gemini上游映射为candidateCount
+	output, err = manager.ConvertRequest(FormatOpenAI, FormatGemini, input)
+	if err != nil {
+		t.Fatalf("ConvertRequest() error = %v", err)
+	}
+	var geminiReq map[string]interface{}
+	_ = json.Unmarshal(output, &geminiReq)
+	if config, _ := geminiReq["generationConfig"].(map[string]interface{}); config["candidateCount"] != float64(3) {
+		t.Errorf("Gemini上游应收到candidateCount=3: %s", output)
+	}
+
+	// Anthropic不支持多个候选回复，返回请求内容错误
+	_, err = manager.ConvertRequest(FormatOpenAI, FormatAnthropic, input)
+	var contentErr *UnsupportedContentError
+	if !errors.As(err, &contentErr) {
+		t.Errorf("Anthropic上游n>1应返回UnsupportedContentError, got %v", err)
+	}
+	if _, err := manager.ConvertRequest(FormatOpenAI, FormatAnthropic, []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"n":1}`)); err != nil {
+		t.Errorf("n=1应正常转换: %v", err)
+	}
+}
+
+func TestToolChoiceToAnthropic(t *testing.T) {
+	manager := NewManager()
+	tools := `"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]`
+
+	tests := []struct {
+		name       string
+		from       Format
+		toolChoice string // 为空表示请求中不带tool_choice
+		noTools    bool
+		want       string // 为空表示输出中不应有tool_choice
+	}{
+		{"auto", FormatOpenAI, `"auto"`, false, `{"type":"auto"}`},
+		{"none", FormatOpenAI, `"none"`, false, `{"type":"none"}`},
+		{"required映射为any", FormatOpenAI, `"required"`, false, `{"type":"any"}`},
+		{"指定函数映射为tool", FormatOpenAI, `{"type":"function","function":{"name":"get_weather"}}`, false, `{"type":"tool","name":"get_weather"}`},
+		{"未指定时不设置", FormatOpenAI, ``, false, ``},
+		{"没有工具时不设置", FormatOpenAI, `"required"`, true, ``},
+		{"Anthropic格式原样保留", FormatAnthropic, `{"type":"tool","name":"get_weather","disable_parallel_tool_use":true}`, false, `{"type":"tool","name":"get_weather","disable_parallel_tool_use":true}`},
+		{"Anthropic未指定时不设置", FormatAnthropic, ``, false, ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := []string{`"model":"claude-3-5-sonnet"`, `"max_tokens":100`, `"messages":[{"role":"user","content":"weather?"}]`}
+			if !tt.noTools {
+				if tt.from == FormatAnthropic {
+					fields = append(fields, `"tools":[{"name":"get_weather","input_schema":{"type":"object"}}]`)
+				} else {
+					fields = append(fields, tools)
+				}
+			}
+			if tt.toolChoice != "" {
+				fields = append(fields, `"tool_choice":`+tt.toolChoice)
+			}
+			input := "{"
+			for i, field := range fields {
+				if i > 0 {
+					input += ","
+				}
+				input += field
+			}
+			input += "}"
+
+			output, err := manager.ConvertRequest(tt.from, FormatAnthropic, []byte(input))
+			if err != nil {
+				t.Fatalf("ConvertRequest() error = %v", err)
+			}
+			var result map[string]json.RawMessage
+			if err := json.Unmarshal(output, &result); err != nil {
+				t.Fatalf("解析输出失败: %v", err)
+			}
+
+			got, exists := result["tool_choice"]
+			if tt.want == "" {
+				if exists {
+					t.Errorf("不应设置tool_choice: %s", got)
+				}
+				return
+			}
+			if !jsonEqual(got, []byte(tt.want)) {
+				t.Errorf("tool_choice = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	manager := NewManager()
+	schema := `{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]}`
+
+	// OpenAI上游原样携带response_format
+	input := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_schema","json_schema":{"name":"weather","strict":true,"schema":` + schema + `}}}`)
+	output, err := manager.ConvertRequest(FormatOpenAI, FormatOpenAI, input)
+	if err != nil {
+		t.Fatalf("ConvertRequest() error = %v", err)
+	}
+	var openAIReq map[string]json.RawMessage
+	_ = json.Unmarshal(output, &openAIReq)
+	want := `{"type":"json_schema","json_schema":{"name":"weather","strict":true,"schema":` + schema + `}}`
+	if !jsonEqual(openAIReq["response_format"], []byte(want)) {
+		t.Errorf("response_format = %s, want %s", openAIReq["response_format"], want)
+	}
+
+	tests := []struct {
+		name           string
+		responseFormat string
+		wantSystem     []string // system提示中应包含的内容，为空表示不应添加提示
+		wantErr        bool
+	}{
+		{"json_object", `{"type":"json_object"}`, []string{"You are a helpful assistant.", "single valid JSON object"}, false},
+		{"json_schema附带schema", `{"type":"json_schema","json_schema":{"name":"weather","schema":` + schema + `}}`, []string{"conforms to the following JSON schema", `"required":["city"]`}, false},
+		{"text不添加提示", `{"type":"text"}`, nil, false},
+		{"json_schema缺少schema", `{"type":"json_schema","json_schema":{"name":"weather"}}`, nil, true},
+		{"未知类型", `{"type":"xml"}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := []byte(`{"model":"claude-3-5-sonnet","max_tokens":100,"messages":[{"role":"system","content":"You are a helpful assistant."},{"role":"user","content":"weather?"}],"response_format":` + tt.responseFormat + `}`)
+			output, err := manager.ConvertRequest(FormatOpenAI, FormatAnthropic, input)
+			if tt.wantErr {
+				var contentErr *UnsupportedContentError
+				if !errors.As(err, &contentErr) {
+					t.Errorf("应返回UnsupportedContentError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConvertRequest() error = %v", err)
+			}
+
+			var result map[string]json.RawMessage
+			if err := json.Unmarshal(output, &result); err != nil {
+				t.Fatalf("解析输出失败: %v", err)
+			}
+			if _, exists := result["response_format"]; exists {
+				t.Errorf("Anthropic请求不应包含response_format: %s", output)
+			}
+			var blocks []types.SystemBlock
+			_ = json.Unmarshal(result["system"], &blocks)
+			var system string
+			for _, block := range blocks {
+				system += block.Text + "\n"
+			}
+			if tt.wantSystem == nil && strings.Contains(system, "JSON") {
+				t.Errorf("不应添加JSON提示: %s", system)
+			}
+			for _, want := range tt.wantSystem {
+				if !strings.Contains(system, want) {
+					t.Errorf("system = %s, 应包含 %q", system, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package converter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ErrorCategory 统一的错误类别，解析上游错误时归一到这组值，构建客户端错误时再映射回目标格式，
+// 服务端的重试与切换决策也基于这组值
+type ErrorCategory string
+
+const (
+	ErrorInvalidRequest ErrorCategory = "invalid_request"
+	ErrorAuthentication ErrorCategory = "authentication"
+	ErrorPermission     ErrorCategory = "permission"
+	ErrorNotFound       ErrorCategory = "not_found"
+	ErrorRateLimit      ErrorCategory = "rate_limit"
+	ErrorQuota          ErrorCategory = "quota"
+	ErrorOverloaded     ErrorCategory = "overloaded"
+	ErrorServer         ErrorCategory = "server"
+)
+
+// errorCategoryFromType 各提供商原生错误类型（小写）到统一类别的映射
+var errorCategoryFromType = map[string]ErrorCategory{
+	"invalid_request_error":   ErrorInvalidRequest,
+	"invalid_argument":        ErrorInvalidRequest,
+	"failed_precondition":     ErrorInvalidRequest,
+	"context_length_exceeded": ErrorInvalidRequest,
+	"out_of_range":            ErrorInvalidRequest,
+	"authentication_error":    ErrorAuthentication,
+	"invalid_api_key":         ErrorAuthentication,
+	"unauthenticated":         ErrorAuthentication,
+	"permission_error":        ErrorPermission,
+	"permission_denied":       ErrorPermission,
+	"not_found_error":         ErrorNotFound,
+	"model_not_found":         ErrorNotFound,
+	"not_found":               ErrorNotFound,
+	"rate_limit_error":        ErrorRateLimit,
+	"rate_limit_exceeded":     ErrorRateLimit,
+	"requests":                ErrorRateLimit,
+	"tokens":                  ErrorRateLimit,
+	"insufficient_quota":      ErrorQuota,
+	"billing_error":           ErrorQuota,
+	"resource_exhausted":      ErrorQuota,
+	"overloaded_error":        ErrorOverloaded,
+	"overloaded":              ErrorOverloaded,
+	"unavailable":             ErrorOverloaded,
+	"server_is_overloaded":    ErrorOverloaded,
+	"api_error":               ErrorServer,
+	"server_error":            ErrorServer,
+	"internal":                ErrorServer,
+	"internal_error":          ErrorServer,
+	"deadline_exceeded":       ErrorServer,
+}
+
+// errorTypeForFormat 统一类别到各客户端格式错误类型的映射
+var errorTypeForFormat = map[Format]map[ErrorCategory]string{
+	FormatOpenAI: {
+		ErrorInvalidRequest: "invalid_request_error",
+		ErrorAuthentication: "authentication_error",
+		ErrorPermission:     "permission_error",
+		ErrorNotFound:       "not_found_error",
+		ErrorRateLimit:      "rate_limit_error",
+		ErrorQuota:          "insufficient_quota",
+		ErrorOverloaded:     "server_error",
+		ErrorServer:         "server_error",
+	},
+	FormatAnthropic: {
+		ErrorInvalidRequest: "invalid_request_error",
+		ErrorAuthentication: "authentication_error",
+		ErrorPermission:     "permission_error",
+		ErrorNotFound:       "not_found_error",
+		ErrorRateLimit:      "rate_limit_error",
+		ErrorQuota:          "billing_error",
+		ErrorOverloaded:     "overloaded_error",
+		ErrorServer:         "api_error",
+	},
+	FormatGemini: {
+		ErrorInvalidRequest: "INVALID_ARGUMENT",
+		ErrorAuthentication: "UNAUTHENTICATED",
+		ErrorPermission:     "PERMISSION_DENIED",
+		ErrorNotFound:       "NOT_FOUND",
+		ErrorRateLimit:      "RESOURCE_EXHAUSTED",
+		ErrorQuota:          "RESOURCE_EXHAUSTED",
+		ErrorOverloaded:     "UNAVAILABLE",
+		ErrorServer:         "INTERNAL",
+	},
+}
+
+// errorCategoryFromStatus 错误体无法识别时按HTTP状态码推断类别
+func errorCategoryFromStatus(statusCode int) ErrorCategory {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return ErrorInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrorAuthentication
+	case http.StatusPaymentRequired:
+		return ErrorQuota
+	case http.StatusForbidden:
+		return ErrorPermission
+	case http.StatusNotFound:
+		return ErrorNotFound
+	case http.StatusTooManyRequests:
+		return ErrorRateLimit
+	case http.StatusServiceUnavailable, 529:
+		return ErrorOverloaded
+	}
+	return ErrorServer
+}
+
+// ErrorDetail 从Anthropic/OpenAI/Gemini的错误体中提取的信息
+type ErrorDetail struct {
+	Category ErrorCategory // 错误体无法识别时为空
+	Code     string        // 命中分类表的上游原始错误类型，如context_length_exceeded
+	Type     string        // 错误体中的error.type原值
+	Message  string
+}
+
+// ParseErrorBody 解析上游错误体，兼容以下结构：
+//
+//	Anthropic: {"type":"error","error":{"type":"overloaded_error","message":"..."}}
+//	OpenAI:    {"error":{"message":"...","type":"invalid_request_error","code":"..."}}
+//	Gemini:    {"error":{"code":429,"message":"...","status":"RESOURCE_EXHAUSTED"}}
+//
+// 无法识别时Category为空，由调用方按状态码推断
+func ParseErrorBody(body []byte) ErrorDetail {
+	var detail ErrorDetail
+
+	var payload struct {
+		Error struct {
+			Type    string          `json:"type"`
+			Message string          `json:"message"`
+			Code    json.RawMessage `json:"code"`
+			Status  string          `json:"status"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return detail
+	}
+	detail.Type = payload.Error.Type
+	detail.Message = payload.Error.Message
+
+	// OpenAI的code（如insufficient_quota）比type更具体；Gemini用status表示错误类别
+	var code string
+	_ = json.Unmarshal(payload.Error.Code, &code)
+	for _, candidate := range []string{code, payload.Error.Type, payload.Error.Status} {
+		if category, ok := errorCategoryFromType[strings.ToLower(candidate)]; ok {
+			detail.Category = category
+			detail.Code = candidate
+			break
+		}
+	}
+	return detail
+}
+
+// BuildClientError 将上游错误体转换为客户端格式的错误响应体，错误类型映射到目标格式的取值，
+// HTTP状态码由调用方原样返回。无法识别的格式按OpenAI格式构建
+func (m *Manager) BuildClientError(format Format, statusCode int, upstreamBody []byte) []byte {
+	detail := ParseErrorBody(upstreamBody)
+	if detail.Category == "" {
+		detail.Category = errorCategoryFromStatus(statusCode)
+	}
+	if detail.Message == "" {
+		detail.Message = strings.TrimSpace(string(upstreamBody))
+	}
+	if detail.Message == "" {
+		detail.Message = http.StatusText(statusCode)
+	}
+
+	var payload map[string]interface{}
+	switch format {
+	case FormatAnthropic:
+		payload = map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":    errorTypeForFormat[FormatAnthropic][detail.Category],
+				"message": detail.Message,
+			},
+		}
+	case FormatGemini:
+		payload = map[string]interface{}{
+			"error": map[string]interface{}{
+				"code":    statusCode,
+				"message": detail.Message,
+				"status":  errorTypeForFormat[FormatGemini][detail.Category],
+			},
+		}
+	default:
+		var code interface{}
+		if detail.Code != "" {
+			code = detail.Code
+		}
+		payload = map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": detail.Message,
+				"type":    errorTypeForFormat[FormatOpenAI][detail.Category],
+				"param":   nil,
+				"code":    code,
+			},
+		}
+	}
+
+	data, _ := json.Marshal(payload)
+	return data
+}
@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBuildClientError_Anthropic(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		wantType    string
+		wantMessage string
+	}{
+		{"OpenAI限流", http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`, "rate_limit_error", "Rate limit reached"},
+		{"OpenAI参数无效", http.StatusBadRequest, `{"error":{"message":"bad max_tokens","type":"invalid_request_error","param":"max_tokens","code":null}}`, "invalid_request_error", "bad max_tokens"},
+		{"OpenAI密钥无效", http.StatusUnauthorized, `{"error":{"message":"Incorrect API key","type":"invalid_request_error","code":"invalid_api_key"}}`, "authentication_error", "Incorrect API key"},
+		{"Gemini参数无效", http.StatusBadRequest, `{"error":{"code":400,"message":"Invalid value","status":"INVALID_ARGUMENT"}}`, "invalid_request_error", "Invalid value"},
+		{"无法解析按状态码判断", http.StatusTooManyRequests, `too many requests`, "rate_limit_error", "too many requests"},
+		{"空错误体", http.StatusUnauthorized, ``, "authentication_error", "Unauthorized"},
+	}
+
+	m := NewManager()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Type  string `json:"type"`
+				Error struct {
+					Type    string `json:"type"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			data := m.BuildClientError(FormatAnthropic, tt.statusCode, []byte(tt.body))
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("错误体不是合法JSON: %s", data)
+			}
+			if got.Type != "error" || got.Error.Type != tt.wantType || got.Error.Message != tt.wantMessage {
+				t.Errorf("BuildClientError() = %s, want type %s, message %q", data, tt.wantType, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestBuildClientError_OpenAI(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		wantType    string
+		wantCode    interface{}
+		wantMessage string
+	}{
+		{"Anthropic限流", http.StatusTooManyRequests, `{"type":"error","error":{"type":"rate_limit_error","message":"Number of requests has exceeded your rate limit"}}`, "rate_limit_error", "rate_limit_error", "Number of requests has exceeded your rate limit"},
+		{"Anthropic参数无效", http.StatusBadRequest, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: Field required"}}`, "invalid_request_error", "invalid_request_error", "max_tokens: Field required"},
+		{"Anthropic认证失败", http.StatusUnauthorized, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`, "authentication_error", "authentication_error", "invalid x-api-key"},
+		{"上下文超长保留原始code", http.StatusBadRequest, `{"error":{"message":"too long","type":"invalid_request_error","code":"context_length_exceeded"}}`, "invalid_request_error", "context_length_exceeded", "too long"},
+		{"OpenAI按requests限流", http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`, "rate_limit_error", "rate_limit_exceeded", "Rate limit reached"},
+		{"OpenAI按tokens限流", http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","type":"tokens"}}`, "rate_limit_error", "tokens", "Rate limit reached"},
+		{"无法解析按状态码判断", http.StatusBadGateway, `<html>bad gateway</html>`, "server_error", nil, "<html>bad gateway</html>"},
+	}
+
+	m := NewManager()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Error struct {
+					Type    string      `json:"type"`
+					Message string      `json:"message"`
+					Code    interface{} `json:"code"`
+				} `json:"error"`
+			}
+			data := m.BuildClientError(FormatOpenAI, tt.statusCode, []byte(tt.body))
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("错误体不是合法JSON: %s", data)
+			}
+			if got.Error.Type != tt.wantType || got.Error.Code != tt.wantCode || got.Error.Message != tt.wantMessage {
+				t.Errorf("BuildClientError() = %s, want type %s, code %v, message %q", data, tt.wantType, tt.wantCode, tt.wantMessage)
+			}
+		})
+	}
+}
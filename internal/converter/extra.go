@@ -0,0 +1,110 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// crossFormatExtraFields 跨格式转换时允许透传的未建模顶层字段，按目标格式区分。
+// 同格式透传时保留全部未建模字段；跨格式时只保留目标API同样接受的字段，其余丢弃以免上游报错
+var crossFormatExtraFields = map[Format]map[string]bool{
+	FormatAnthropic: {
+		"top_k":        true,
+		"thinking":     true,
+		"service_tier": true,
+		"container":    true,
+	},
+	FormatOpenAI: {
+		"user":                true,
+		"store":               true,
+		"metadata":            true,
+		"service_tier":        true,
+		"presence_penalty":    true,
+		"frequency_penalty":   true,
+		"logit_bias":          true,
+		"parallel_tool_calls": true,
+		"stream_options":      true,
+		// Qwen（OpenAI兼容格式）特有参数
+		"enable_search":   true,
+		"enable_thinking": true,
+		"thinking_budget": true,
+	},
+	FormatGemini: {
+		"safetySettings": true,
+		"cachedContent":  true,
+		"labels":         true,
+	},
+}
+
+// extraFields 提取请求体中未被model结构体显式建模的顶层字段，数字保留原始精度
+func extraFields(data []byte, model interface{}) map[string]interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(model))
+	var extra map[string]interface{}
+	for key, value := range raw {
+		if known[key] {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]interface{})
+		}
+		extra[key] = value
+	}
+	return extra
+}
+
+// jsonFieldNames 获取结构体所有字段的JSON名称
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// applyExtraFields 将请求的未建模字段合并到目标格式请求体中，已建模的同名字段优先
+func applyExtraFields(data []byte, request *types.UnifiedRequest, target Format) ([]byte, error) {
+	if len(request.Extra) == 0 {
+		return data, nil
+	}
+
+	sameFormat := request.OriginalFormat == string(target)
+	allowed := crossFormatExtraFields[target]
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for key, value := range request.Extra {
+		if _, exists := body[key]; exists || (!sameFormat && !allowed[key]) {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		body[key] = raw
+		changed = true
+	}
+
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(body)
+}
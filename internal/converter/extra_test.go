@@ -0,0 +1,115 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExtraFields_Passthrough(t *testing.T) {
+	manager := NewManager()
+
+	tests := []struct {
+		name     string
+		from     Format
+		to       Format
+		input    string
+		wantKeep []string
+		wantDrop []string
+	}{
+		{
+			name:     "OpenAI同格式保留全部未建模字段",
+			from:     FormatOpenAI,
+			to:       FormatOpenAI,
+			input:    `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"store":true,"metadata":{"team":"a"},"vendor_flag":9007199254740993}`,
+			wantKeep: []string{"store", "metadata", "vendor_flag"},
+		},
+		{
+			name:     "Anthropic同格式保留container和thinking",
+			from:     FormatAnthropic,
+			to:       FormatAnthropic,
+			input:    `{"model":"claude-3-5-sonnet","max_tokens":10,"messages":[{"role":"user","content":"hi"}],"container":"ctr_1","thinking":{"type":"enabled","budget_tokens":1024}}`,
+			wantKeep: []string{"container", "thinking"},
+		},
+		{
+			name:     "OpenAI转Anthropic按白名单筛选",
+			from:     FormatOpenAI,
+			to:       FormatAnthropic,
+			input:    `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"store":true,"user":"u1","top_k":5}`,
+			wantKeep: []string{"top_k"},
+			wantDrop: []string{"store", "user"},
+		},
+		{
+			name:     "Anthropic转OpenAI丢弃Anthropic特有字段",
+			from:     FormatAnthropic,
+			to:       FormatOpenAI,
+			input:    `{"model":"claude-3-5-sonnet","max_tokens":10,"messages":[{"role":"user","content":"hi"}],"container":"ctr_1","service_tier":"auto"}`,
+			wantKeep: []string{"service_tier"},
+			wantDrop: []string{"container"},
+		},
+		{
+			name:     "Gemini转OpenAI丢弃safetySettings",
+			from:     FormatGemini,
+			to:       FormatOpenAI,
+			input:    `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"safetySettings":[{"category":"HARM_CATEGORY_HARASSMENT","threshold":"BLOCK_NONE"}]}`,
+			wantDrop: []string{"safetySettings"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, _ := manager.GetRegistry().Get(tt.from)
+			to, _ := manager.GetRegistry().Get(tt.to)
+
+			request, err := from.ParseRequest([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("ParseRequest() error = %v", err)
+			}
+			output, err := to.BuildRequest(request)
+			if err != nil {
+				t.Fatalf("BuildRequest() error = %v", err)
+			}
+
+			var result, input map[string]json.RawMessage
+			if err := json.Unmarshal(output, &result); err != nil {
+				t.Fatalf("解析输出失败: %v", err)
+			}
+			_ = json.Unmarshal([]byte(tt.input), &input)
+
+			for _, key := range tt.wantKeep {
+				if !jsonEqual(result[key], input[key]) {
+					t.Errorf("%s = %s, want %s", key, result[key], input[key])
+				}
+			}
+			for _, key := range tt.wantDrop {
+				if _, exists := result[key]; exists {
+					t.Errorf("%s 不应透传到 %s: %s", key, tt.to, output)
+				}
+			}
+		})
+	}
+}
+
+// jsonEqual 按语义比较两段JSON，数字按原始文本比较以检查精度
+func jsonEqual(a, b []byte) bool {
+	decode := func(data []byte) interface{} {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var v interface{}
+		_ = decoder.Decode(&v)
+		return v
+	}
+	return a != nil && reflect.DeepEqual(decode(a), decode(b))
+}
+
+func TestExtraFields_ModeledFieldsWin(t *testing.T) {
+	extra := extraFields([]byte(`{"model":"gpt-4o","messages":[],"stop":"END","store":false}`), struct {
+		Model    string `json:"model"`
+		Messages []int  `json:"messages,omitempty"`
+		Stop     string `json:"stop"`
+	}{})
+	if len(extra) != 1 || extra["store"] != false {
+		t.Errorf("extraFields() = %v, want only store", extra)
+	}
+}
@@ -0,0 +1,82 @@
+package converter
+
+// 统一的finish_reason取值，采用OpenAI语义。各格式的结束原因在解析时归一到这组值，构建时再映射回目标格式
+const (
+	FinishReasonStop          = "stop"           // 自然结束或命中停止序列
+	FinishReasonLength        = "length"         // 达到max_tokens或上下文窗口上限
+	FinishReasonToolCalls     = "tool_calls"     // 模型请求调用工具
+	FinishReasonContentFilter = "content_filter" // 被安全策略拦截或模型拒绝回答
+)
+
+// finishReasonToUnified 各格式原生结束原因到统一finish_reason的映射，未列出的值按stop处理
+var finishReasonToUnified = map[Format]map[string]string{
+	FormatOpenAI: {
+		"stop":           FinishReasonStop,
+		"length":         FinishReasonLength,
+		"tool_calls":     FinishReasonToolCalls,
+		"function_call":  FinishReasonToolCalls, // 旧版functions API
+		"content_filter": FinishReasonContentFilter,
+	},
+	FormatAnthropic: {
+		"end_turn":                      FinishReasonStop,
+		"stop_sequence":                 FinishReasonStop,
+		"pause_turn":                    FinishReasonStop, // 服务端工具长时间运行被暂停，客户端可原样续写
+		"max_tokens":                    FinishReasonLength,
+		"model_context_window_exceeded": FinishReasonLength,
+		"tool_use":                      FinishReasonToolCalls,
+		"refusal":                       FinishReasonContentFilter,
+	},
+	FormatGemini: {
+		"STOP":                    FinishReasonStop,
+		"MAX_TOKENS":              FinishReasonLength,
+		"SAFETY":                  FinishReasonContentFilter,
+		"RECITATION":              FinishReasonContentFilter,
+		"LANGUAGE":                FinishReasonContentFilter,
+		"BLOCKLIST":               FinishReasonContentFilter,
+		"PROHIBITED_CONTENT":      FinishReasonContentFilter,
+		"SPII":                    FinishReasonContentFilter,
+		"IMAGE_SAFETY":            FinishReasonContentFilter,
+		"MALFORMED_FUNCTION_CALL": FinishReasonStop,
+		"UNEXPECTED_TOOL_CALL":    FinishReasonStop,
+		"OTHER":                   FinishReasonStop,
+	},
+}
+
+// finishReasonFromUnified 统一finish_reason到各格式原生结束原因的映射
+var finishReasonFromUnified = map[Format]map[string]string{
+	FormatOpenAI: {
+		FinishReasonStop:          "stop",
+		FinishReasonLength:        "length",
+		FinishReasonToolCalls:     "tool_calls",
+		FinishReasonContentFilter: "content_filter",
+	},
+	FormatAnthropic: {
+		FinishReasonStop:          "end_turn",
+		FinishReasonLength:        "max_tokens",
+		FinishReasonToolCalls:     "tool_use",
+		FinishReasonContentFilter: "refusal",
+	},
+	FormatGemini: {
+		FinishReasonStop:          "STOP",
+		FinishReasonLength:        "MAX_TOKENS",
+		FinishReasonToolCalls:     "STOP", // Gemini函数调用以STOP结束，通过functionCall片段表达
+		FinishReasonContentFilter: "SAFETY",
+	},
+}
+
+// toUnifiedFinishReason 将format格式的原生结束原因转换为统一finish_reason
+func toUnifiedFinishReason(format Format, reason string) string {
+	if unified, ok := finishReasonToUnified[format][reason]; ok {
+		return unified
+	}
+	return FinishReasonStop
+}
+
+// fromUnifiedFinishReason 将统一finish_reason转换为format格式的原生结束原因
+func fromUnifiedFinishReason(format Format, reason string) string {
+	// 兼容统一响应中残留的旧版function_call等取值
+	if native, ok := finishReasonFromUnified[format][toUnifiedFinishReason(FormatOpenAI, reason)]; ok {
+		return native
+	}
+	return finishReasonFromUnified[format][FinishReasonStop]
+}
@@ -0,0 +1,159 @@
+package converter
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestToUnifiedFinishReason(t *testing.T) {
+	tests := []struct {
+		format Format
+		reason string
+		want   string
+	}{
+		{FormatOpenAI, "stop", FinishReasonStop},
+		{FormatOpenAI, "length", FinishReasonLength},
+		{FormatOpenAI, "tool_calls", FinishReasonToolCalls},
+		{FormatOpenAI, "function_call", FinishReasonToolCalls},
+		{FormatOpenAI, "content_filter", FinishReasonContentFilter},
+		{FormatOpenAI, "", FinishReasonStop},
+		{FormatAnthropic, "end_turn", FinishReasonStop},
+		{FormatAnthropic, "stop_sequence", FinishReasonStop},
+		{FormatAnthropic, "pause_turn", FinishReasonStop},
+		{FormatAnthropic, "max_tokens", FinishReasonLength},
+		{FormatAnthropic, "model_context_window_exceeded", FinishReasonLength},
+		{FormatAnthropic, "tool_use", FinishReasonToolCalls},
+		{FormatAnthropic, "refusal", FinishReasonContentFilter},
+		{FormatAnthropic, "unknown_reason", FinishReasonStop},
+		{FormatGemini, "STOP", FinishReasonStop},
+		{FormatGemini, "MAX_TOKENS", FinishReasonLength},
+		{FormatGemini, "SAFETY", FinishReasonContentFilter},
+		{FormatGemini, "RECITATION", FinishReasonContentFilter},
+		{FormatGemini, "PROHIBITED_CONTENT", FinishReasonContentFilter},
+		{FormatGemini, "MALFORMED_FUNCTION_CALL", FinishReasonStop},
+		{FormatGemini, "FINISH_REASON_UNSPECIFIED", FinishReasonStop},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format)+"/"+tt.reason, func(t *testing.T) {
+			if got := toUnifiedFinishReason(tt.format, tt.reason); got != tt.want {
+				t.Errorf("toUnifiedFinishReason(%s, %q) = %q, want %q", tt.format, tt.reason, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromUnifiedFinishReason(t *testing.T) {
+	tests := []struct {
+		reason    string
+		openai    string
+		anthropic string
+		gemini    string
+	}{
+		{FinishReasonStop, "stop", "end_turn", "STOP"},
+		{FinishReasonLength, "length", "max_tokens", "MAX_TOKENS"},
+		{FinishReasonToolCalls, "tool_calls", "tool_use", "STOP"},
+		{FinishReasonContentFilter, "content_filter", "refusal", "SAFETY"},
+		{"function_call", "tool_calls", "tool_use", "STOP"},
+		{"", "stop", "end_turn", "STOP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			for format, want := range map[Format]string{FormatOpenAI: tt.openai, FormatAnthropic: tt.anthropic, FormatGemini: tt.gemini} {
+				if got := fromUnifiedFinishReason(format, tt.reason); got != want {
+					t.Errorf("fromUnifiedFinishReason(%s, %q) = %q, want %q", format, tt.reason, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFinishReason_RoundTrip(t *testing.T) {
+	// 每个统一取值映射到原生格式后再解析回来，除Gemini无法表达tool_calls外都应保持不变
+	for format, table := range finishReasonFromUnified {
+		for unified, native := range table {
+			want := unified
+			if format == FormatGemini && unified == FinishReasonToolCalls {
+				want = FinishReasonStop
+			}
+			if got := toUnifiedFinishReason(format, native); got != want {
+				t.Errorf("%s: %q -> %q -> %q, want %q", format, unified, native, got, want)
+			}
+		}
+	}
+}
+
+func TestStreamFinishReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		provider types.Provider
+		client   Format
+		want     string
+	}{
+		{"Anthropic max_tokens转OpenAI", "testdata/stream/stream_anthropic_error_case.txt", types.ProviderAnthropic, FormatOpenAI, "length"},
+		{"Anthropic tool_use转OpenAI", "testdata/stream/stream_anthropic_tool_use.txt", types.ProviderAnthropic, FormatOpenAI, "tool_calls"},
+		{"Anthropic end_turn转Gemini", "testdata/stream/stream_anthropic_basic.txt", types.ProviderAnthropic, FormatGemini, "STOP"},
+		{"Anthropic max_tokens转Gemini", "testdata/stream/stream_anthropic_error_case.txt", types.ProviderAnthropic, FormatGemini, "MAX_TOKENS"},
+		{"Gemini函数调用转OpenAI", "testdata/gemini/stream_function_call.txt", types.ProviderGoogle, FormatOpenAI, "tool_calls"},
+		{"OpenAI tool_calls转Gemini", "testdata/stream/stream_openai_tool_calls.txt", types.ProviderOpenAI, FormatGemini, "STOP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(tt.fixture)
+			if err != nil {
+				t.Fatalf("读取测试数据失败: %v", err)
+			}
+			writer := &collectStreamWriter{}
+			if err := NewManager().ProcessStream(strings.NewReader(string(data)), tt.provider, tt.client, writer); err != nil {
+				t.Fatalf("ProcessStream() error = %v", err)
+			}
+			if got := lastFinishReason(t, writer.chunks); got != tt.want {
+				t.Errorf("finish_reason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// lastFinishReason 提取OpenAI或Gemini流中最后一个非空的结束原因
+func lastFinishReason(t *testing.T, chunks []*StreamChunk) string {
+	t.Helper()
+	var last string
+	for _, chunk := range chunks {
+		if chunk.Data == nil {
+			continue
+		}
+		raw, err := json.Marshal(chunk.Data)
+		if err != nil {
+			t.Fatalf("序列化chunk失败: %v", err)
+		}
+		var parsed struct {
+			Choices []struct {
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Candidates []struct {
+				FinishReason string `json:"finishReason"`
+			} `json:"candidates"`
+		}
+		if err := json.Unmarshal(raw, &parsed); err != nil {
+			continue
+		}
+		for _, choice := range parsed.Choices {
+			if choice.FinishReason != "" {
+				last = choice.FinishReason
+			}
+		}
+		for _, candidate := range parsed.Candidates {
+			if candidate.FinishReason != "" {
+				last = candidate.FinishReason
+			}
+		}
+	}
+	return last
+}
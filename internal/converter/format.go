@@ -6,6 +6,7 @@ type Format string
 const (
 	FormatOpenAI    Format = "openai"
 	FormatAnthropic Format = "anthropic"
+	FormatGemini    Format = "gemini"
 	FormatUnknown   Format = "unknown"
 )
 
@@ -17,7 +18,7 @@ func (f Format) String() string {
 // IsValid 检查格式是否有效
 func (f Format) IsValid() bool {
 	switch f {
-	case FormatOpenAI, FormatAnthropic:
+	case FormatOpenAI, FormatAnthropic, FormatGemini:
 		return true
 	default:
 		return false
@@ -0,0 +1,102 @@
+package converter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// addSeedCorpus 将testdata目录下的样例文件加入fuzz种子语料
+func addSeedCorpus(f *testing.F, pattern string) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		f.Fatalf("读取种子语料失败: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatalf("读取种子文件 %s 失败: %v", file, err)
+		}
+		f.Add(data)
+	}
+}
+
+// 常见的畸形输入：类型错位的字段、空结构、非法JSON
+var malformedSeeds = []string{
+	``,
+	`null`,
+	`[]`,
+	`{"messages": "not-an-array"}`,
+	`{"model": 1, "messages": [{"role": "user", "content": 123}]}`,
+	`{"messages": [{"role": "user", "content": [{"type": "tool_use", "input": "x"}]}]}`,
+	`{"messages": [{"role": "user", "content": [{"type": "tool_result", "content": [1, null, {"text": 2}]}]}]}`,
+	`{"messages": [{"role": "assistant", "content": null, "tool_calls": [{"function": null}]}]}`,
+	`{"system": [{"type": "text"}], "messages": []}`,
+	`{"tools": [{"function": "x"}, {"input_schema": []}]}`,
+	`{"choices": [{"message": null}]}`,
+	`{"content": [{"type": "tool_use", "input": null}], "usage": "x"}`,
+}
+
+func FuzzParseAndBuildRequest(f *testing.F) {
+	addSeedCorpus(f, "testdata/req/*.json")
+	for _, seed := range malformedSeeds {
+		f.Add([]byte(seed))
+	}
+
+	manager := NewManager()
+	providers := []types.Provider{types.ProviderAnthropic, types.ProviderOpenAI}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, endpoint := range []string{"/v1/messages", "/v1/chat/completions"} {
+			request, _, err := manager.ParseRequest(data, endpoint)
+			if err != nil || request == nil {
+				continue
+			}
+			for _, provider := range providers {
+				// 只要求不panic，错误是允许的
+				_, _ = manager.BuildUpstreamRequest(request, provider)
+			}
+		}
+
+		_, _ = manager.ConvertRequest(FormatOpenAI, FormatAnthropic, data)
+		_, _ = manager.ConvertRequest(FormatAnthropic, FormatOpenAI, data)
+	})
+}
+
+func FuzzConvertResponse(f *testing.F) {
+	addSeedCorpus(f, "testdata/rsp/*.json")
+	for _, seed := range malformedSeeds {
+		f.Add([]byte(seed))
+	}
+
+	manager := NewManager()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = manager.ConvertResponse(FormatAnthropic, FormatOpenAI, data)
+		_, _ = manager.ConvertResponse(FormatOpenAI, FormatAnthropic, data)
+		_ = RepairResponseJSON(FormatOpenAI, data)
+		_ = RepairResponseJSON(FormatAnthropic, data)
+	})
+}
+
+func FuzzProcessStream(f *testing.F) {
+	addSeedCorpus(f, "testdata/stream/*")
+	addSeedCorpus(f, "testdata/pairs/*_stream_input.txt")
+	f.Add([]byte("event: content_block_delta\ndata: {\"delta\": null}\n\n"))
+	f.Add([]byte("data: {\"choices\": [{\"delta\": {\"tool_calls\": [{\"function\": 1}]}}]}\n\n"))
+	f.Add([]byte("event: message_start\ndata: {\"message\": \"x\"}\n\ndata: [DONE]\n\n"))
+
+	manager := NewManager()
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, provider := range []types.Provider{types.ProviderAnthropic, types.ProviderOpenAI} {
+			for _, clientFormat := range []Format{FormatAnthropic, FormatOpenAI} {
+				writer := &collectStreamWriter{}
+				_ = manager.ProcessStream(bytes.NewReader(data), provider, clientFormat, writer)
+			}
+		}
+	})
+}
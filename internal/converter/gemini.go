@@ -0,0 +1,838 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+const (
+	// geminiUpstreamPath Gemini上游路径模板，模型名称在发送请求时替换
+	geminiUpstreamPath = "/v1beta/models/{model}:generateContent"
+	// geminiModelPlaceholder 上游路径中的模型占位符
+	geminiModelPlaceholder = "{model}"
+)
+
+// GeminiConverter Gemini格式转换器工厂
+type GeminiConverter struct{}
+
+// GeminiStreamConverter Gemini流式转换器（有状态）
+type GeminiStreamConverter struct {
+	// 解析Gemini流时使用
+	blockIndex int  // 当前内容块索引
+	textOpen   bool // 当前是否有未结束的文本块
+	toolCalls  int  // 已解析的函数调用数量，用于生成工具ID
+
+	// 构建Gemini流时使用：函数调用需要累积完整参数后一次性输出
+	pendingTool *UnifiedStreamContent
+}
+
+// NewGeminiConverter 创建Gemini转换器
+func NewGeminiConverter() *GeminiConverter {
+	return &GeminiConverter{}
+}
+
+// GetFormat 获取转换器支持的格式
+func (c *GeminiConverter) GetFormat() Format {
+	return FormatGemini
+}
+
+// GetUpstreamPath 根据客户端端点获取上游路径
+func (c *GeminiConverter) GetUpstreamPath(clientEndpoint string) string {
+	// Gemini 的模型名称位于路径中，由 ResolveUpstreamPath 在发送请求时替换
+	return geminiUpstreamPath
+}
+
+// ResolveUpstreamPath 替换上游路径模板中的模型占位符，流式请求改用 streamGenerateContent 并以SSE格式返回
+func ResolveUpstreamPath(path, model string, stream bool) string {
+	if !strings.Contains(path, geminiModelPlaceholder) {
+		return path
+	}
+
+	model = strings.TrimPrefix(model, "models/")
+	path = strings.ReplaceAll(path, geminiModelPlaceholder, url.PathEscape(model))
+	if stream {
+		path = strings.TrimSuffix(path, ":generateContent") + ":streamGenerateContent?alt=sse"
+	}
+	return path
+}
+
+// ParseRequest 解析Gemini请求到内部格式（Gemini请求体不含模型名称）
+func (c *GeminiConverter) ParseRequest(data []byte) (*types.UnifiedRequest, error) {
+	var req types.GeminiRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("解析Gemini请求失败: %w", err)
+	}
+
+	var messages []types.Message
+
+	if req.SystemInstruction != nil {
+		if system := geminiPartsText(req.SystemInstruction.Parts); system != "" {
+			messages = append(messages, types.Message{
+				Role:    "system",
+				Content: system,
+			})
+		}
+	}
+
+	// Gemini函数调用没有必需的ID：按调用顺序生成ID，并按函数名与后续的functionResponse配对
+	pendingCalls := make(map[string][]string)
+	callCount := 0
+
+	for _, content := range req.Contents {
+		if content.Role == "model" {
+			msg := types.Message{
+				Role:    "assistant",
+				Content: c.partsToContent(content.Parts),
+			}
+			for _, part := range content.Parts {
+				if part.FunctionCall == nil {
+					continue
+				}
+				id := geminiToolCallID(part.FunctionCall, callCount)
+				callCount++
+				pendingCalls[part.FunctionCall.Name] = append(pendingCalls[part.FunctionCall.Name], id)
+				msg.ToolCalls = append(msg.ToolCalls, buildToolCall(id, part.FunctionCall.Name, part.FunctionCall.Args))
+			}
+			messages = append(messages, msg)
+			continue
+		}
+
+		// user内容中的functionResponse转换为中间格式的tool消息
+		var userParts []types.GeminiPart
+		for _, part := range content.Parts {
+			response := part.FunctionResponse
+			if response == nil {
+				userParts = append(userParts, part)
+				continue
+			}
+
+			id := response.ID
+			if queue := pendingCalls[response.Name]; len(queue) > 0 {
+				if id == "" {
+					id = queue[0]
+				}
+				pendingCalls[response.Name] = queue[1:]
+			}
+			name := response.Name
+			messages = append(messages, types.Message{
+				Role:       "tool",
+				Content:    geminiFunctionResponseText(response.Response),
+				ToolCallID: &id,
+				Name:       &name,
+			})
+		}
+
+		if len(userParts) > 0 {
+			messages = append(messages, types.Message{
+				Role:    "user",
+				Content: c.partsToContent(userParts),
+			})
+		}
+	}
+
+	request := &types.UnifiedRequest{
+		Messages:       messages,
+		Tools:          c.parseTools(req.Tools),
+		OriginalFormat: string(FormatGemini),
+		Extra:          extraFields(data, req),
+	}
+	if len(request.Tools) > 0 {
+		request.ToolChoice = c.parseToolConfig(req.ToolConfig)
+	}
+	if config := req.GenerationConfig; config != nil {
+		request.MaxTokens = config.MaxOutputTokens
+		request.Temperature = config.Temperature
+		request.TopP = config.TopP
+		request.Seed = config.Seed
+		request.StopSequences = config.StopSequences
+		request.N = config.CandidateCount
+	}
+
+	return request, nil
+}
+
+// BuildRequest 构建发送给上游Gemini的请求
+func (c *GeminiConverter) BuildRequest(request *types.UnifiedRequest) ([]byte, error) {
+	var req types.GeminiRequest
+	var systemParts []types.GeminiPart
+
+	// tool消息只携带tool_call_id，需要从之前的assistant消息中找回函数名
+	toolNames := make(map[string]string)
+
+	for _, msg := range request.Messages {
+		switch msg.Role {
+		case "system":
+			systemParts = append(systemParts, c.contentToParts(msg.Content)...)
+		case "assistant":
+			parts := c.contentToParts(msg.Content)
+			for _, toolCall := range msg.ToolCalls {
+				id, name, args := parseToolCall(toolCall)
+				toolNames[id] = name
+				parts = append(parts, types.GeminiPart{
+					FunctionCall: &types.GeminiFunctionCall{Name: name, Args: args},
+				})
+			}
+			req.Contents = appendGeminiContent(req.Contents, "model", parts)
+		case "tool":
+			req.Contents = appendGeminiContent(req.Contents, "user", []types.GeminiPart{c.toolMessageToPart(msg, toolNames)})
+		default:
+			req.Contents = appendGeminiContent(req.Contents, "user", c.contentToParts(msg.Content))
+		}
+	}
+
+	if len(systemParts) > 0 {
+		req.SystemInstruction = &types.GeminiContent{Parts: systemParts}
+	}
+
+	if declarations := c.convertTools(request.Tools); len(declarations) > 0 {
+		req.Tools = []types.GeminiTool{{FunctionDeclarations: declarations}}
+		req.ToolConfig = c.convertToolChoice(request.ToolChoice)
+	}
+
+	if request.MaxTokens > 0 || request.Temperature != nil || request.TopP != nil || request.Seed != nil || len(request.StopSequences) > 0 || request.N != nil {
+		req.GenerationConfig = &types.GeminiGenerationConfig{
+			MaxOutputTokens: request.MaxTokens,
+			Temperature:     request.Temperature,
+			TopP:            request.TopP,
+			Seed:            request.Seed,
+			StopSequences:   request.StopSequences,
+			CandidateCount:  request.N,
+		}
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return applyExtraFields(data, request, FormatGemini)
+}
+
+// ParseResponse 解析Gemini上游响应到内部格式
+func (c *GeminiConverter) ParseResponse(data []byte) (*types.UnifiedResponse, error) {
+	var resp types.GeminiResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("解析Gemini响应失败: %w", err)
+	}
+
+	response := &types.UnifiedResponse{
+		ID:      resp.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.ModelVersion,
+	}
+	if response.ID == "" {
+		response.ID = fmt.Sprintf("gemini-%d", time.Now().UnixNano())
+	}
+
+	for _, candidate := range resp.Candidates {
+		message := types.Message{Role: "assistant"}
+
+		var text strings.Builder
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				id := geminiToolCallID(part.FunctionCall, len(message.ToolCalls))
+				message.ToolCalls = append(message.ToolCalls, buildToolCall(id, part.FunctionCall.Name, part.FunctionCall.Args))
+			case part.Text != "" && !part.Thought:
+				text.WriteString(part.Text)
+			}
+		}
+		if text.Len() > 0 {
+			message.Content = text.String()
+		}
+
+		finishReason := c.convertFinishReason(candidate.FinishReason)
+		if len(message.ToolCalls) > 0 && finishReason == FinishReasonStop {
+			finishReason = FinishReasonToolCalls
+		}
+
+		response.Choices = append(response.Choices, types.ResponseChoice{
+			Index:        candidate.Index,
+			Message:      message,
+			FinishReason: finishReason,
+		})
+	}
+
+	if usage := resp.UsageMetadata; usage != nil {
+		response.Usage = types.ResponseUsage{
+			PromptTokens:     usage.PromptTokenCount,
+			CompletionTokens: usage.CandidatesTokenCount,
+			TotalTokens:      usage.TotalTokenCount,
+		}
+	}
+
+	return response, nil
+}
+
+// BuildResponse 构建返回给客户端的Gemini格式响应
+func (c *GeminiConverter) BuildResponse(response *types.UnifiedResponse) ([]byte, error) {
+	resp := types.GeminiResponse{
+		Candidates:   []types.GeminiCandidate{},
+		ModelVersion: response.Model,
+		ResponseID:   response.ID,
+		UsageMetadata: &types.GeminiUsageMetadata{
+			PromptTokenCount:     response.Usage.PromptTokens,
+			CandidatesTokenCount: response.Usage.CompletionTokens,
+			TotalTokenCount:      response.Usage.TotalTokens,
+		},
+	}
+
+	for _, choice := range response.Choices {
+		parts := c.contentToParts(choice.Message.Content)
+		for _, toolCall := range choice.Message.ToolCalls {
+			_, name, args := parseToolCall(toolCall)
+			parts = append(parts, types.GeminiPart{
+				FunctionCall: &types.GeminiFunctionCall{Name: name, Args: args},
+			})
+		}
+		if parts == nil {
+			parts = []types.GeminiPart{}
+		}
+
+		resp.Candidates = append(resp.Candidates, types.GeminiCandidate{
+			Content:      types.GeminiContent{Role: "model", Parts: parts},
+			FinishReason: c.toGeminiFinishReason(choice.FinishReason),
+			Index:        choice.Index,
+		})
+	}
+
+	return json.Marshal(resp)
+}
+
+// ValidateRequest 验证Gemini请求格式
+func (c *GeminiConverter) ValidateRequest(data []byte) error {
+	var req types.GeminiRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("无效的Gemini请求格式: %w", err)
+	}
+
+	if len(req.Contents) == 0 {
+		return fmt.Errorf("缺少必需字段: contents")
+	}
+
+	return nil
+}
+
+// contentToParts 将中间格式的消息内容转换为Gemini片段
+func (c *GeminiConverter) contentToParts(content interface{}) []types.GeminiPart {
+	switch v := content.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []types.GeminiPart{{Text: v}}
+	case []interface{}:
+		var parts []types.GeminiPart
+		for _, item := range v {
+			block, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			switch getString(block["type"]) {
+			case "text":
+				if text := getString(block["text"]); text != "" {
+					parts = append(parts, types.GeminiPart{Text: text})
+				}
+			case "image_url":
+				// OpenAI格式: {"type":"image_url","image_url":{"url":"..."}}
+				if imageURL := imageURLFromBlock(block); imageURL != "" {
+					parts = append(parts, geminiImagePart(imageURL, ""))
+				}
+			case "image":
+				// Anthropic格式: {"type":"image","source":{"type":"base64"|"url",...}}
+				if source, ok := block["source"].(map[string]interface{}); ok {
+					if getString(source["type"]) == "url" {
+						parts = append(parts, geminiImagePart(getString(source["url"]), ""))
+					} else {
+						parts = append(parts, types.GeminiPart{InlineData: &types.GeminiBlob{
+							MimeType: getString(source["media_type"]),
+							Data:     getString(source["data"]),
+						}})
+					}
+				}
+			}
+		}
+		return parts
+	default:
+		if data, err := json.Marshal(v); err == nil {
+			return []types.GeminiPart{{Text: string(data)}}
+		}
+		return nil
+	}
+}
+
+// partsToContent 将Gemini片段转换为中间格式的消息内容：纯文本返回字符串，含图片时返回内容块数组
+func (c *GeminiConverter) partsToContent(parts []types.GeminiPart) interface{} {
+	var blocks []interface{}
+	hasMedia := false
+
+	for _, part := range parts {
+		switch {
+		case part.Text != "" && !part.Thought:
+			blocks = append(blocks, map[string]interface{}{"type": "text", "text": part.Text})
+		case part.InlineData != nil:
+			hasMedia = true
+			blocks = append(blocks, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]interface{}{"url": "data:" + part.InlineData.MimeType + ";base64," + part.InlineData.Data},
+			})
+		case part.FileData != nil:
+			hasMedia = true
+			blocks = append(blocks, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]interface{}{"url": part.FileData.FileURI},
+			})
+		}
+	}
+
+	if len(blocks) == 0 {
+		return nil
+	}
+	if !hasMedia {
+		return geminiPartsText(parts)
+	}
+	return blocks
+}
+
+// toolMessageToPart 将中间格式的tool消息转换为functionResponse片段
+func (c *GeminiConverter) toolMessageToPart(msg types.Message, toolNames map[string]string) types.GeminiPart {
+	var name string
+	if msg.ToolCallID != nil {
+		name = toolNames[*msg.ToolCallID]
+	}
+	if name == "" && msg.Name != nil {
+		name = *msg.Name
+	}
+
+	// Gemini要求response为对象：JSON对象结果直接使用，其余包装为 {"content": ...}
+	text := geminiPartsText(c.contentToParts(msg.Content))
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &response); err != nil || response == nil {
+		response = map[string]interface{}{"content": text}
+	}
+
+	return types.GeminiPart{
+		FunctionResponse: &types.GeminiFunctionResponse{Name: name, Response: response},
+	}
+}
+
+// convertTools 将OpenAI或Anthropic格式的工具定义转换为Gemini函数声明
+func (c *GeminiConverter) convertTools(tools []map[string]interface{}) []types.GeminiFunctionDeclaration {
+	var declarations []types.GeminiFunctionDeclaration
+	for _, tool := range tools {
+		var declaration types.GeminiFunctionDeclaration
+		if function, ok := tool["function"].(map[string]interface{}); ok {
+			declaration = types.GeminiFunctionDeclaration{
+				Name:        getString(function["name"]),
+				Description: getString(function["description"]),
+				Parameters:  sanitizeGeminiSchema(function["parameters"]),
+			}
+		} else {
+			declaration = types.GeminiFunctionDeclaration{
+				Name:        getString(tool["name"]),
+				Description: getString(tool["description"]),
+				Parameters:  sanitizeGeminiSchema(tool["input_schema"]),
+			}
+		}
+		if declaration.Name != "" {
+			declarations = append(declarations, declaration)
+		}
+	}
+	return declarations
+}
+
+// parseTools 将Gemini函数声明转换为中间格式（OpenAI）的工具定义
+func (c *GeminiConverter) parseTools(tools []types.GeminiTool) []map[string]interface{} {
+	var converted []map[string]interface{}
+	for _, tool := range tools {
+		for _, declaration := range tool.FunctionDeclarations {
+			function := map[string]interface{}{
+				"name":        declaration.Name,
+				"description": declaration.Description,
+			}
+			if declaration.Parameters != nil {
+				function["parameters"] = declaration.Parameters
+			}
+			converted = append(converted, map[string]interface{}{
+				"type":     "function",
+				"function": function,
+			})
+		}
+	}
+	return converted
+}
+
+// convertToolChoice 将OpenAI/Anthropic的tool_choice转换为Gemini函数调用配置
+func (c *GeminiConverter) convertToolChoice(toolChoice interface{}) *types.GeminiToolConfig {
+	var mode, name string
+
+	switch v := toolChoice.(type) {
+	case string:
+		switch v {
+		case "auto":
+			mode = "AUTO"
+		case "none":
+			mode = "NONE"
+		case "required", "any":
+			mode = "ANY"
+		}
+	case map[string]interface{}:
+		switch getString(v["type"]) {
+		case "auto":
+			mode = "AUTO"
+		case "none":
+			mode = "NONE"
+		case "any":
+			mode = "ANY"
+		case "tool":
+			mode, name = "ANY", getString(v["name"])
+		case "function":
+			mode = "ANY"
+			if function, ok := v["function"].(map[string]interface{}); ok {
+				name = getString(function["name"])
+			}
+		}
+	}
+
+	if mode == "" {
+		return nil
+	}
+
+	config := &types.GeminiFunctionCallingConfig{Mode: mode}
+	if name != "" {
+		config.AllowedFunctionNames = []string{name}
+	}
+	return &types.GeminiToolConfig{FunctionCallingConfig: config}
+}
+
+// parseToolConfig 将Gemini函数调用配置转换为中间格式（OpenAI）的tool_choice
+func (c *GeminiConverter) parseToolConfig(config *types.GeminiToolConfig) interface{} {
+	if config == nil || config.FunctionCallingConfig == nil {
+		return nil
+	}
+
+	switch callingConfig := config.FunctionCallingConfig; callingConfig.Mode {
+	case "AUTO":
+		return "auto"
+	case "NONE":
+		return "none"
+	case "ANY":
+		if len(callingConfig.AllowedFunctionNames) == 1 {
+			return map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": callingConfig.AllowedFunctionNames[0]},
+			}
+		}
+		return "required"
+	default:
+		return nil
+	}
+}
+
+// convertFinishReason 转换Gemini结束原因到标准格式
+func (c *GeminiConverter) convertFinishReason(finishReason string) string {
+	return toUnifiedFinishReason(FormatGemini, finishReason)
+}
+
+// toGeminiFinishReason 转换标准格式到Gemini结束原因
+func (c *GeminiConverter) toGeminiFinishReason(finishReason string) string {
+	return fromUnifiedFinishReason(FormatGemini, finishReason)
+}
+
+// NewStreamConverter 创建新的流式转换器实例
+func (c *GeminiConverter) NewStreamConverter() StreamConverter {
+	return &GeminiStreamConverter{}
+}
+
+// ParseStreamEvent 解析Gemini流式事件到统一内部格式
+// Gemini的每个SSE数据块都是一个完整的GenerateContentResponse，函数调用一次性完整返回
+func (sc *GeminiStreamConverter) ParseStreamEvent(eventType string, data []byte) ([]*UnifiedStreamEvent, error) {
+	var chunk types.GeminiResponse
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil, fmt.Errorf("解析事件数据失败: %w", err)
+	}
+
+	// 统一格式只承载单个回复，多个候选时只保留首个（index 0）
+	var candidate *types.GeminiCandidate
+	for i := range chunk.Candidates {
+		if chunk.Candidates[i].Index == 0 {
+			candidate = &chunk.Candidates[i]
+			break
+		}
+	}
+	if candidate == nil {
+		return nil, nil
+	}
+
+	var events []*UnifiedStreamEvent
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			events = append(events, sc.closeTextBlock()...)
+
+			args := part.FunctionCall.Args
+			if args == nil {
+				args = map[string]interface{}{}
+			}
+			input, _ := json.Marshal(args)
+			index := sc.blockIndex
+
+			events = append(events,
+				&UnifiedStreamEvent{
+					Type: StreamEventContentStart,
+					Content: &UnifiedStreamContent{
+						Type:     "tool_use",
+						ToolID:   geminiToolCallID(part.FunctionCall, sc.toolCalls),
+						ToolName: part.FunctionCall.Name,
+						Index:    index,
+					},
+				},
+				&UnifiedStreamEvent{
+					Type: StreamEventContentDelta,
+					Content: &UnifiedStreamContent{
+						Type:      "tool_use",
+						ToolInput: string(input),
+						Index:     index,
+					},
+				},
+				&UnifiedStreamEvent{
+					Type:    StreamEventContentStop,
+					Content: &UnifiedStreamContent{Index: index},
+				},
+			)
+			sc.toolCalls++
+			sc.blockIndex++
+
+		case part.Text != "" && !part.Thought:
+			if !sc.textOpen {
+				sc.textOpen = true
+				events = append(events, &UnifiedStreamEvent{
+					Type:    StreamEventContentStart,
+					Content: &UnifiedStreamContent{Type: "text", Index: sc.blockIndex},
+				})
+			}
+			events = append(events, &UnifiedStreamEvent{
+				Type: StreamEventContentDelta,
+				Content: &UnifiedStreamContent{
+					Type:  "text",
+					Text:  part.Text,
+					Index: sc.blockIndex,
+				},
+			})
+		}
+	}
+
+	if candidate.FinishReason != "" {
+		events = append(events, sc.closeTextBlock()...)
+		// 每个数据块的usageMetadata都是累计值，只取结束块上的最终用量
+		if usage := chunk.UsageMetadata; usage != nil {
+			events = append(events, &UnifiedStreamEvent{
+				Type:  StreamEventUsage,
+				Usage: map[string]int{"input_tokens": usage.PromptTokenCount, "output_tokens": usage.CandidatesTokenCount},
+			})
+		}
+		// Gemini函数调用以STOP结束，流中出现过函数调用时视为tool_calls
+		finishReason := toUnifiedFinishReason(FormatGemini, candidate.FinishReason)
+		if sc.toolCalls > 0 && finishReason == FinishReasonStop {
+			finishReason = FinishReasonToolCalls
+		}
+		// Gemini流没有[DONE]标记，上游连接结束即流结束
+		events = append(events, &UnifiedStreamEvent{
+			Type:         StreamEventMessageStop,
+			FinishReason: finishReason,
+			IsDone:       false,
+		})
+	}
+
+	return events, nil
+}
+
+// closeTextBlock 结束当前文本块
+func (sc *GeminiStreamConverter) closeTextBlock() []*UnifiedStreamEvent {
+	if !sc.textOpen {
+		return nil
+	}
+
+	index := sc.blockIndex
+	sc.textOpen = false
+	sc.blockIndex++
+	return []*UnifiedStreamEvent{{
+		Type:    StreamEventContentStop,
+		Content: &UnifiedStreamContent{Index: index},
+	}}
+}
+
+// BuildStreamEvent 从统一内部格式构建Gemini流式事件
+func (sc *GeminiStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent) (*StreamChunk, error) {
+	switch event.Type {
+	case StreamEventContentStart:
+		if event.Content != nil && event.Content.Type == "tool_use" {
+			sc.pendingTool = &UnifiedStreamContent{
+				Type:     "tool_use",
+				ToolID:   event.Content.ToolID,
+				ToolName: event.Content.ToolName,
+			}
+		}
+
+	case StreamEventContentDelta:
+		if event.Content == nil {
+			return nil, nil
+		}
+		if event.Content.Type == "tool_use" {
+			if sc.pendingTool == nil {
+				sc.pendingTool = &UnifiedStreamContent{Type: "tool_use"}
+			}
+			sc.pendingTool.ToolInput += event.Content.ToolInput
+			return nil, nil
+		}
+		if event.Content.Text != "" {
+			return geminiStreamChunk([]types.GeminiPart{{Text: event.Content.Text}}, ""), nil
+		}
+
+	case StreamEventContentStop:
+		if sc.pendingTool == nil {
+			return nil, nil
+		}
+		tool := sc.pendingTool
+		sc.pendingTool = nil
+
+		var args map[string]interface{}
+		_ = json.Unmarshal([]byte(tool.ToolInput), &args)
+		return geminiStreamChunk([]types.GeminiPart{{
+			FunctionCall: &types.GeminiFunctionCall{Name: tool.ToolName, Args: args},
+		}}, ""), nil
+
+	case StreamEventMessageStop:
+		return geminiStreamChunk([]types.GeminiPart{}, fromUnifiedFinishReason(FormatGemini, event.FinishReason)), nil
+	}
+
+	return nil, nil
+}
+
+// NeedPreEvents 返回需要自动生成的前置事件
+func (sc *GeminiStreamConverter) NeedPreEvents(event *UnifiedStreamEvent) []*UnifiedStreamEvent {
+	// Gemini格式不需要额外的前置事件
+	return nil
+}
+
+// geminiStreamChunk 构建单个Gemini流式数据块
+func geminiStreamChunk(parts []types.GeminiPart, finishReason string) *StreamChunk {
+	return &StreamChunk{
+		Data: types.GeminiResponse{
+			Candidates: []types.GeminiCandidate{{
+				Content:      types.GeminiContent{Role: "model", Parts: parts},
+				FinishReason: finishReason,
+				Index:        0,
+			}},
+		},
+	}
+}
+
+// appendGeminiContent 追加一条内容，与上一条角色相同时合并（如并行函数调用的多个functionResponse）
+func appendGeminiContent(contents []types.GeminiContent, role string, parts []types.GeminiPart) []types.GeminiContent {
+	if len(parts) == 0 {
+		return contents
+	}
+	if last := len(contents) - 1; last >= 0 && contents[last].Role == role {
+		contents[last].Parts = append(contents[last].Parts, parts...)
+		return contents
+	}
+	return append(contents, types.GeminiContent{Role: role, Parts: parts})
+}
+
+// geminiImagePart 将图片URL转换为片段：data URL转为内联数据，其余作为文件引用
+func geminiImagePart(imageURL, mimeType string) types.GeminiPart {
+	if rest, ok := strings.CutPrefix(imageURL, "data:"); ok {
+		if meta, data, found := strings.Cut(rest, ","); found {
+			return types.GeminiPart{InlineData: &types.GeminiBlob{
+				MimeType: strings.TrimSuffix(meta, ";base64"),
+				Data:     data,
+			}}
+		}
+	}
+	return types.GeminiPart{FileData: &types.GeminiFileData{MimeType: mimeType, FileURI: imageURL}}
+}
+
+// geminiPartsText 拼接片段中的文本（忽略思考过程）
+func geminiPartsText(parts []types.GeminiPart) string {
+	var text strings.Builder
+	for _, part := range parts {
+		if !part.Thought {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String()
+}
+
+// geminiFunctionResponseText 将functionResponse转换为tool消息内容：{"content": "..."} 还原为字符串，其余序列化为JSON
+func geminiFunctionResponseText(response map[string]interface{}) string {
+	if content, ok := response["content"].(string); ok && len(response) == 1 {
+		return content
+	}
+	data, _ := json.Marshal(response)
+	return string(data)
+}
+
+// geminiToolCallID 返回函数调用ID，上游未提供时按序号生成
+func geminiToolCallID(call *types.GeminiFunctionCall, seq int) string {
+	if call.ID != "" {
+		return call.ID
+	}
+	return fmt.Sprintf("call_%s_%d", call.Name, seq)
+}
+
+// buildToolCall 构建中间格式（OpenAI）的tool_call
+func buildToolCall(id, name string, args map[string]interface{}) map[string]interface{} {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	arguments, _ := json.Marshal(args)
+	return map[string]interface{}{
+		"id":   id,
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":      name,
+			"arguments": string(arguments),
+		},
+	}
+}
+
+// parseToolCall 从中间格式的tool_call中提取ID、函数名和参数（arguments可能是JSON字符串或对象）
+func parseToolCall(toolCall map[string]interface{}) (id, name string, args map[string]interface{}) {
+	id = getString(toolCall["id"])
+	function, _ := toolCall["function"].(map[string]interface{})
+	name = getString(function["name"])
+
+	return id, name, parseToolArguments(name, function["arguments"])
+}
+
+// sanitizeGeminiSchema 移除Gemini不支持的JSON Schema关键字
+func sanitizeGeminiSchema(schema interface{}) interface{} {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		cleaned := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if key == "$schema" || key == "additionalProperties" {
+				continue
+			}
+			cleaned[key] = sanitizeGeminiSchema(value)
+		}
+		return cleaned
+	case []interface{}:
+		cleaned := make([]interface{}, len(v))
+		for i, item := range v {
+			cleaned[i] = sanitizeGeminiSchema(item)
+		}
+		return cleaned
+	default:
+		return schema
+	}
+}
@@ -0,0 +1,366 @@
+package converter
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func readGeminiFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/gemini/" + name)
+	if err != nil {
+		t.Fatalf("读取测试文件失败: %v", err)
+	}
+	return data
+}
+
+func TestGeminiRequestRoundTrip(t *testing.T) {
+	c := NewGeminiConverter()
+	input := readGeminiFixture(t, "req_tools.json")
+
+	unified, err := c.ParseRequest(input)
+	if err != nil {
+		t.Fatalf("ParseRequest() error = %v", err)
+	}
+
+	// system + user + assistant(2个tool_calls) + 2条tool消息
+	if len(unified.Messages) != 5 {
+		t.Fatalf("消息数量 = %d, want 5", len(unified.Messages))
+	}
+	if unified.Messages[0].Role != "system" || unified.Messages[2].Role != "assistant" {
+		t.Errorf("角色顺序不正确: %+v", unified.Messages)
+	}
+	calls := unified.Messages[2].ToolCalls
+	if len(calls) != 2 {
+		t.Fatalf("tool_calls数量 = %d, want 2", len(calls))
+	}
+	for i, call := range calls {
+		if id := getString(call["id"]); *unified.Messages[3+i].ToolCallID != id {
+			t.Errorf("tool消息%d的tool_call_id = %s, want %s", i, *unified.Messages[3+i].ToolCallID, id)
+		}
+	}
+	if unified.Messages[4].Content != "Rainy, 12°C" {
+		t.Errorf("functionResponse内容 = %v", unified.Messages[4].Content)
+	}
+	if unified.ToolChoice != "auto" || unified.MaxTokens != 1024 {
+		t.Errorf("ToolChoice = %v, MaxTokens = %d", unified.ToolChoice, unified.MaxTokens)
+	}
+
+	output, err := c.BuildRequest(unified)
+	if err != nil {
+		t.Fatalf("BuildRequest() error = %v", err)
+	}
+
+	var want, got interface{}
+	_ = json.Unmarshal(input, &want)
+	if err := json.Unmarshal(output, &got); err != nil {
+		t.Fatalf("解析输出失败: %v", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("往返转换结果不一致:\nwant %s\ngot  %s", input, output)
+	}
+}
+
+func TestOpenAIRequestToGemini(t *testing.T) {
+	manager := NewManager()
+	input := []byte(`{
+		"model": "gemini-2.0-flash",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [
+				{"type": "text", "text": "Describe this image"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"$schema": "http://json-schema.org/draft-07/schema#", "type": "object", "additionalProperties": false}}}],
+		"tool_choice": {"type": "function", "function": {"name": "lookup"}}
+	}`)
+
+	output, err := manager.ConvertRequest(FormatOpenAI, FormatGemini, input)
+	if err != nil {
+		t.Fatalf("ConvertRequest() error = %v", err)
+	}
+
+	var req types.GeminiRequest
+	if err := json.Unmarshal(output, &req); err != nil {
+		t.Fatalf("解析Gemini请求失败: %v", err)
+	}
+
+	if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("systemInstruction = %+v", req.SystemInstruction)
+	}
+	if len(req.Contents) != 3 {
+		t.Fatalf("contents数量 = %d, want 3", len(req.Contents))
+	}
+	if blob := req.Contents[0].Parts[1].InlineData; blob == nil || blob.MimeType != "image/png" || blob.Data != "iVBORw0KGgo=" {
+		t.Errorf("图片未转换为inlineData: %+v", req.Contents[0].Parts[1])
+	}
+	if call := req.Contents[1].Parts[0].FunctionCall; call == nil || call.Name != "lookup" || call.Args["q"] != "cat" {
+		t.Errorf("functionCall = %+v", req.Contents[1].Parts[0].FunctionCall)
+	}
+	if resp := req.Contents[2].Parts[0].FunctionResponse; resp == nil || resp.Name != "lookup" || resp.Response["content"] != "a cat" {
+		t.Errorf("functionResponse = %+v", req.Contents[2].Parts[0].FunctionResponse)
+	}
+
+	params := req.Tools[0].FunctionDeclarations[0].Parameters.(map[string]interface{})
+	if _, ok := params["$schema"]; ok {
+		t.Error("parameters中不应保留$schema")
+	}
+	if _, ok := params["additionalProperties"]; ok {
+		t.Error("parameters中不应保留additionalProperties")
+	}
+
+	config := req.ToolConfig.FunctionCallingConfig
+	if config.Mode != "ANY" || !reflect.DeepEqual(config.AllowedFunctionNames, []string{"lookup"}) {
+		t.Errorf("functionCallingConfig = %+v", config)
+	}
+}
+
+func TestAnthropicRequestToGemini(t *testing.T) {
+	manager := NewManager()
+	input, err := os.ReadFile("testdata/req/req_anthropic_tool_result.json")
+	if err != nil {
+		t.Fatalf("读取测试文件失败: %v", err)
+	}
+
+	output, err := manager.ConvertRequest(FormatAnthropic, FormatGemini, input)
+	if err != nil {
+		t.Fatalf("ConvertRequest() error = %v", err)
+	}
+
+	var req types.GeminiRequest
+	if err := json.Unmarshal(output, &req); err != nil {
+		t.Fatalf("解析Gemini请求失败: %v", err)
+	}
+
+	var calls, responses int
+	for _, content := range req.Contents {
+		if content.Role != "user" && content.Role != "model" {
+			t.Errorf("无效的role: %s", content.Role)
+		}
+		for _, part := range content.Parts {
+			if part.FunctionCall != nil {
+				calls++
+			}
+			if part.FunctionResponse != nil {
+				responses++
+				if part.FunctionResponse.Name == "" {
+					t.Error("functionResponse缺少函数名")
+				}
+			}
+		}
+	}
+	if calls == 0 || calls != responses {
+		t.Errorf("functionCall数量 = %d, functionResponse数量 = %d", calls, responses)
+	}
+}
+
+func TestGeminiResponseToClientFormats(t *testing.T) {
+	manager := NewManager()
+
+	t.Run("openai", func(t *testing.T) {
+		output, err := manager.ConvertResponse(FormatGemini, FormatOpenAI, readGeminiFixture(t, "rsp_function_call.json"))
+		if err != nil {
+			t.Fatalf("ConvertResponse() error = %v", err)
+		}
+
+		var resp types.OpenAIResponse
+		if err := json.Unmarshal(output, &resp); err != nil {
+			t.Fatalf("解析OpenAI响应失败: %v", err)
+		}
+		choice := resp.Choices[0]
+		if choice.FinishReason != "tool_calls" {
+			t.Errorf("finish_reason = %s, want tool_calls", choice.FinishReason)
+		}
+		if len(choice.Message.ToolCalls) != 1 {
+			t.Fatalf("tool_calls数量 = %d, want 1", len(choice.Message.ToolCalls))
+		}
+		function := choice.Message.ToolCalls[0]["function"].(map[string]interface{})
+		if function["name"] != "get_weather" || function["arguments"] != `{"city":"Paris"}` {
+			t.Errorf("function = %+v", function)
+		}
+		if resp.Usage.PromptTokens != 30 || resp.Usage.CompletionTokens != 15 {
+			t.Errorf("usage = %+v", resp.Usage)
+		}
+	})
+
+	t.Run("anthropic", func(t *testing.T) {
+		output, err := manager.ConvertResponse(FormatGemini, FormatAnthropic, readGeminiFixture(t, "rsp_basic.json"))
+		if err != nil {
+			t.Fatalf("ConvertResponse() error = %v", err)
+		}
+
+		var resp types.AnthropicResponse
+		if err := json.Unmarshal(output, &resp); err != nil {
+			t.Fatalf("解析Anthropic响应失败: %v", err)
+		}
+		if resp.Model != "gemini-2.0-flash" || resp.StopReason != "end_turn" {
+			t.Errorf("model = %s, stop_reason = %s", resp.Model, resp.StopReason)
+		}
+		if len(resp.Content) != 1 || resp.Content[0].Text != "Hello! How can I help you today?" {
+			t.Errorf("content = %+v", resp.Content)
+		}
+	})
+}
+
+func TestGeminiResponseRoundTrip(t *testing.T) {
+	c := NewGeminiConverter()
+	input := readGeminiFixture(t, "rsp_basic.json")
+
+	unified, err := c.ParseResponse(input)
+	if err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	output, err := c.BuildResponse(unified)
+	if err != nil {
+		t.Fatalf("BuildResponse() error = %v", err)
+	}
+
+	var resp types.GeminiResponse
+	if err := json.Unmarshal(output, &resp); err != nil {
+		t.Fatalf("解析输出失败: %v", err)
+	}
+	if resp.Candidates[0].Content.Parts[0].Text != "Hello! How can I help you today?" || resp.Candidates[0].FinishReason != "STOP" {
+		t.Errorf("candidate = %+v", resp.Candidates[0])
+	}
+	if resp.UsageMetadata.TotalTokenCount != 21 || resp.ResponseID != "resp-basic-1" {
+		t.Errorf("usageMetadata = %+v, responseId = %s", resp.UsageMetadata, resp.ResponseID)
+	}
+}
+
+func TestGeminiStreamToOpenAI(t *testing.T) {
+	manager := NewManager()
+
+	writer := &collectStreamWriter{}
+	reader := strings.NewReader(string(readGeminiFixture(t, "stream_function_call.txt")))
+	if err := manager.ProcessStream(reader, types.ProviderGoogle, FormatOpenAI, writer); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	deltas := openAIDeltas(t, writer.chunks)
+	if len(deltas) < 3 {
+		t.Fatalf("delta数量 = %d, want >= 3", len(deltas))
+	}
+	if deltas[0]["role"] != "assistant" || deltas[0]["content"] != "Checking" {
+		t.Errorf("首个delta = %+v", deltas[0])
+	}
+
+	toolCall := deltas[1]["tool_calls"].([]interface{})[0].(map[string]interface{})
+	function := toolCall["function"].(map[string]interface{})
+	if function["name"] != "get_weather" || toolCall["id"] == "" {
+		t.Errorf("工具调用起始chunk = %+v", toolCall)
+	}
+	arguments := deltas[2]["tool_calls"].([]interface{})[0].(map[string]interface{})["function"].(map[string]interface{})["arguments"]
+	if arguments != `{"city":"Paris"}` {
+		t.Errorf("arguments = %v", arguments)
+	}
+
+	if last := writer.chunks[len(writer.chunks)-1]; !last.IsDone {
+		t.Error("流结束时应输出结束标记")
+	}
+}
+
+func TestGeminiStreamToOpenAI_TextThenTools(t *testing.T) {
+	stream := `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Checking"}]},"index":0}]}` + "\n\n" +
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}},{"functionCall":{"name":"get_time","args":{}}}]},"finishReason":"STOP","index":0}]}` + "\n\n"
+
+	writer := &collectStreamWriter{}
+	if err := NewManager().ProcessStream(strings.NewReader(stream), types.ProviderGoogle, FormatOpenAI, writer); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	// 文本与工具调用属于同一个choice
+	for _, chunk := range writer.chunks {
+		data, ok := chunk.Data.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		choices, _ := data["choices"].([]interface{})
+		for _, item := range choices {
+			if index := item.(map[string]interface{})["index"]; index != 0 {
+				t.Errorf("choices[].index = %v, want 0: %+v", index, data)
+			}
+		}
+	}
+
+	// tool_calls[].index按工具调用顺序从0编号，不受前面的文本块影响
+	var names []string
+	arguments := map[int]string{}
+	for _, delta := range openAIDeltas(t, writer.chunks) {
+		toolCalls, _ := delta["tool_calls"].([]interface{})
+		for _, item := range toolCalls {
+			call := item.(map[string]interface{})
+			index := call["index"].(int)
+			function := call["function"].(map[string]interface{})
+			if name, ok := function["name"].(string); ok {
+				if index != len(names) {
+					t.Errorf("工具调用 %s 的index = %d, want %d", name, index, len(names))
+				}
+				names = append(names, name)
+			}
+			arguments[index] += function["arguments"].(string)
+		}
+	}
+	if len(names) != 2 || names[0] != "get_weather" || names[1] != "get_time" {
+		t.Errorf("工具调用 = %v, want [get_weather get_time]", names)
+	}
+	if arguments[0] != `{"city":"Paris"}` || arguments[1] != "{}" {
+		t.Errorf("工具调用参数 = %v", arguments)
+	}
+}
+
+func TestGeminiStreamToAnthropic(t *testing.T) {
+	manager := NewManager()
+
+	writer := &collectStreamWriter{}
+	reader := strings.NewReader(string(readGeminiFixture(t, "stream_basic.txt")))
+	if err := manager.ProcessStream(reader, types.ProviderGoogle, FormatAnthropic, writer); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	var eventTypes []string
+	var text strings.Builder
+	for _, chunk := range writer.chunks {
+		eventTypes = append(eventTypes, chunk.EventType)
+		data, _ := chunk.Data.(map[string]interface{})
+		if delta, ok := data["delta"].(map[string]interface{}); ok {
+			text.WriteString(getString(delta["text"]))
+		}
+	}
+
+	want := []string{"message_start", "content_block_start", "content_block_delta", "content_block_delta", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}
+	if !reflect.DeepEqual(eventTypes, want) {
+		t.Errorf("事件序列 = %v, want %v", eventTypes, want)
+	}
+	if text.String() != "Hello, world!" {
+		t.Errorf("文本 = %q, want %q", text.String(), "Hello, world!")
+	}
+}
+
+func TestResolveUpstreamPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		model  string
+		stream bool
+		want   string
+	}{
+		{"/v1/chat/completions", "gpt-4o", false, "/v1/chat/completions"},
+		{geminiUpstreamPath, "gemini-2.0-flash", false, "/v1beta/models/gemini-2.0-flash:generateContent"},
+		{geminiUpstreamPath, "models/gemini-2.0-flash", true, "/v1beta/models/gemini-2.0-flash:streamGenerateContent?alt=sse"},
+	}
+
+	for _, tt := range tests {
+		if got := ResolveUpstreamPath(tt.path, tt.model, tt.stream); got != tt.want {
+			t.Errorf("ResolveUpstreamPath(%q, %q, %v) = %q, want %q", tt.path, tt.model, tt.stream, got, tt.want)
+		}
+	}
+}
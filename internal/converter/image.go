@@ -0,0 +1,94 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// anthropicImageMediaTypes Anthropic支持的base64图片类型
+var anthropicImageMediaTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// UnsupportedContentError 请求中的内容块无法转换为目标格式（如目标不接受的图片），应作为客户端错误返回
+type UnsupportedContentError struct {
+	Format Format
+	Reason string
+}
+
+func (e *UnsupportedContentError) Error() string {
+	return fmt.Sprintf("content not supported by %s upstream: %s", e.Format, e.Reason)
+}
+
+// anthropicImageBlock 将OpenAI image_url转换为Anthropic图片块：data URL转为base64来源，http(s) URL转为url来源
+func anthropicImageBlock(imageURL string) (map[string]interface{}, error) {
+	if rest, ok := strings.CutPrefix(imageURL, "data:"); ok {
+		meta, data, found := strings.Cut(rest, ",")
+		mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+		if !found || !isBase64 || data == "" {
+			return nil, &UnsupportedContentError{Format: FormatAnthropic, Reason: "image data URL must be base64 encoded"}
+		}
+		if !anthropicImageMediaTypes[mediaType] {
+			return nil, &UnsupportedContentError{Format: FormatAnthropic, Reason: fmt.Sprintf("unsupported image media type %q", mediaType)}
+		}
+		return map[string]interface{}{
+			"type": "image",
+			"source": map[string]interface{}{
+				"type":       "base64",
+				"media_type": mediaType,
+				"data":       data,
+			},
+		}, nil
+	}
+
+	if strings.HasPrefix(imageURL, "https://") || strings.HasPrefix(imageURL, "http://") {
+		return map[string]interface{}{
+			"type":   "image",
+			"source": map[string]interface{}{"type": "url", "url": imageURL},
+		}, nil
+	}
+
+	return nil, &UnsupportedContentError{Format: FormatAnthropic, Reason: "image_url must be an http(s) URL or a base64 data URL"}
+}
+
+// openAIImageBlock 将Anthropic图片块转换为OpenAI image_url，base64来源转为data URL
+func openAIImageBlock(source map[string]interface{}) map[string]interface{} {
+	url := getString(source["url"])
+	if getString(source["type"]) == "base64" {
+		url = "data:" + getString(source["media_type"]) + ";base64," + getString(source["data"])
+	}
+	return map[string]interface{}{
+		"type":      "image_url",
+		"image_url": map[string]interface{}{"url": url},
+	}
+}
+
+// imageURLFromBlock 提取OpenAI image_url块中的URL，兼容image_url为字符串的简写
+func imageURLFromBlock(block map[string]interface{}) string {
+	switch imageURL := block["image_url"].(type) {
+	case string:
+		return imageURL
+	case map[string]interface{}:
+		return getString(imageURL["url"])
+	}
+	return ""
+}
+
+// contentHasImage 判断消息内容中是否包含图片块
+func contentHasImage(content interface{}) bool {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, item := range blocks {
+		if block, ok := item.(map[string]interface{}); ok {
+			if blockType := getString(block["type"]); blockType == "image" || blockType == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
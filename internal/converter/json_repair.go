@@ -0,0 +1,114 @@
+package converter
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// WantsStructuredOutput 检查客户端请求是否要求JSON结构化输出（response_format）
+func WantsStructuredOutput(requestBody []byte) bool {
+	var req struct {
+		ResponseFormat *struct {
+			Type string `json:"type"`
+		} `json:"response_format"`
+	}
+	if err := json.Unmarshal(requestBody, &req); err != nil || req.ResponseFormat == nil {
+		return false
+	}
+	return req.ResponseFormat.Type == "json_object" || req.ResponseFormat.Type == "json_schema"
+}
+
+// RepairJSONText 尝试从模型输出中提取纯JSON
+// 处理 markdown 代码块包裹、JSON前后多余文本等情况；无法提取出合法JSON时原样返回
+func RepairJSONText(text string) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || json.Valid([]byte(trimmed)) {
+		return text, false
+	}
+
+	// 1. markdown 代码块: ```json ... ``` 或 ``` ... ```
+	if start := strings.Index(trimmed, "```"); start >= 0 {
+		body := trimmed[start+3:]
+		if newline := strings.IndexByte(body, '\n'); newline >= 0 {
+			// 跳过语言标记（如 json）
+			if lang := strings.TrimSpace(body[:newline]); !strings.ContainsAny(lang, "{[") {
+				body = body[newline+1:]
+			}
+		}
+		if end := strings.Index(body, "```"); end >= 0 {
+			candidate := strings.TrimSpace(body[:end])
+			if json.Valid([]byte(candidate)) {
+				return candidate, true
+			}
+		}
+	}
+
+	// 2. 前后多余文本: 截取第一个 { 或 [ 到与之配对的最后一个 } 或 ]
+	start := strings.IndexAny(trimmed, "{[")
+	if start < 0 {
+		return text, false
+	}
+	closing := "}"
+	if trimmed[start] == '[' {
+		closing = "]"
+	}
+	end := strings.LastIndex(trimmed, closing)
+	if end <= start {
+		return text, false
+	}
+	candidate := trimmed[start : end+1]
+	if json.Valid([]byte(candidate)) {
+		return candidate, true
+	}
+
+	return text, false
+}
+
+// RepairResponseJSON 修复响应中的文本内容为纯JSON，format为客户端响应格式
+// 仅修改能提取出合法JSON的文本块，其余内容保持不变
+func RepairResponseJSON(format Format, data []byte) []byte {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return data
+	}
+
+	repaired := false
+	switch format {
+	case FormatOpenAI:
+		choices, _ := resp["choices"].([]interface{})
+		for _, c := range choices {
+			choice, _ := c.(map[string]interface{})
+			message, _ := choice["message"].(map[string]interface{})
+			if content, ok := message["content"].(string); ok {
+				if fixed, ok := RepairJSONText(content); ok {
+					message["content"] = fixed
+					repaired = true
+				}
+			}
+		}
+	case FormatAnthropic:
+		blocks, _ := resp["content"].([]interface{})
+		for _, b := range blocks {
+			block, _ := b.(map[string]interface{})
+			if block["type"] != "text" {
+				continue
+			}
+			if text, ok := block["text"].(string); ok {
+				if fixed, ok := RepairJSONText(text); ok {
+					block["text"] = fixed
+					repaired = true
+				}
+			}
+		}
+	}
+
+	if !repaired {
+		return data
+	}
+
+	result, err := json.Marshal(resp)
+	if err != nil {
+		return data
+	}
+	return result
+}
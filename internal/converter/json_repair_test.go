@@ -0,0 +1,120 @@
+package converter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRepairJSONText(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		expected     string
+		wantRepaired bool
+	}{
+		{
+			name:         "valid_json_untouched",
+			input:        `{"a":1}`,
+			expected:     `{"a":1}`,
+			wantRepaired: false,
+		},
+		{
+			name:         "markdown_code_block",
+			input:        "```json\n{\"a\": 1}\n```",
+			expected:     `{"a": 1}`,
+			wantRepaired: true,
+		},
+		{
+			name:         "code_block_without_lang",
+			input:        "```\n[1, 2]\n```",
+			expected:     `[1, 2]`,
+			wantRepaired: true,
+		},
+		{
+			name:         "surrounding_text",
+			input:        "Here is the result: {\"name\": \"x\"} Hope it helps!",
+			expected:     `{"name": "x"}`,
+			wantRepaired: true,
+		},
+		{
+			name:         "plain_text_untouched",
+			input:        "Hello, world",
+			expected:     "Hello, world",
+			wantRepaired: false,
+		},
+		{
+			name:         "broken_json_untouched",
+			input:        "result: {\"a\": }",
+			expected:     "result: {\"a\": }",
+			wantRepaired: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, repaired := RepairJSONText(tt.input)
+			if repaired != tt.wantRepaired {
+				t.Errorf("repaired = %v, want %v", repaired, tt.wantRepaired)
+			}
+			if result != tt.expected {
+				t.Errorf("result = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRepairResponseJSON(t *testing.T) {
+	t.Run("openai_response", func(t *testing.T) {
+		data := []byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"` + "```json\\n{\\\"ok\\\":true}\\n```" + `"}}]}`)
+		result := RepairResponseJSON(FormatOpenAI, data)
+
+		var resp map[string]interface{}
+		if err := json.Unmarshal(result, &resp); err != nil {
+			t.Fatalf("响应不是合法JSON: %v", err)
+		}
+		content := resp["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})["content"]
+		if content != `{"ok":true}` {
+			t.Errorf("content = %v", content)
+		}
+	})
+
+	t.Run("anthropic_response", func(t *testing.T) {
+		data := []byte(`{"id":"1","content":[{"type":"text","text":"Sure: {\"ok\":true}"}]}`)
+		result := RepairResponseJSON(FormatAnthropic, data)
+
+		var resp map[string]interface{}
+		if err := json.Unmarshal(result, &resp); err != nil {
+			t.Fatalf("响应不是合法JSON: %v", err)
+		}
+		text := resp["content"].([]interface{})[0].(map[string]interface{})["text"]
+		if text != `{"ok":true}` {
+			t.Errorf("text = %v", text)
+		}
+	})
+
+	t.Run("nothing_to_repair_returns_original_bytes", func(t *testing.T) {
+		data := []byte(`{"id":"1","content":[{"type":"text","text":"hello"}]}`)
+		result := RepairResponseJSON(FormatAnthropic, data)
+		if string(result) != string(data) {
+			t.Errorf("不应修改正常响应: %s", result)
+		}
+	})
+}
+
+func TestWantsStructuredOutput(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected bool
+	}{
+		{`{"response_format":{"type":"json_object"}}`, true},
+		{`{"response_format":{"type":"json_schema","json_schema":{}}}`, true},
+		{`{"response_format":{"type":"text"}}`, false},
+		{`{"model":"gpt-4o"}`, false},
+	}
+
+	for _, tt := range tests {
+		if got := WantsStructuredOutput([]byte(tt.body)); got != tt.expected {
+			t.Errorf("WantsStructuredOutput(%s) = %v, want %v", tt.body, got, tt.expected)
+		}
+	}
+}
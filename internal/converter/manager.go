@@ -10,9 +10,10 @@ import (
 
 // Manager 转换器管理器 - 系统的主要入口点
 type Manager struct {
-	registry       ConverterRegistry
-	detector       *FormatDetector
-	crossConverter CrossConverter
+	registry          ConverterRegistry
+	detector          *FormatDetector
+	crossConverter    CrossConverter
+	unknownRolePolicy string
 }
 
 // NewManager 创建转换器管理器
@@ -52,6 +53,10 @@ func (m *Manager) ParseRequestWithModelRoute(requestBody []byte, endpoint string
 		return nil, format, err
 	}
 
+	if err := normalizeMessageRoles(request.Messages, m.unknownRolePolicy); err != nil {
+		return nil, format, err
+	}
+
 	// 如果有模型路由配置，替换模型名称
 	if modelRouteContext != nil && modelRouteContext.HasModelRoute() {
 		if err := m.applyModelRouteToRequest(request, modelRouteContext); err != nil {
@@ -210,7 +215,23 @@ func (m *Manager) GetUpstreamPath(provider types.Provider, clientEndpoint string
 		return "", fmt.Errorf("获取提供商转换器失败: %w", err)
 	}
 
-	return converter.GetUpstreamPath(clientEndpoint), nil
+	path := converter.GetUpstreamPath(clientEndpoint)
+	if provider == types.ProviderAzure {
+		// Azure使用OpenAI格式，但按部署名路由，部署名由 ResolveAzurePath 在发送请求时替换
+		path = azureUpstreamPath(path)
+	}
+	return path, nil
+}
+
+// GetEmbeddingsPath 获取提供商的向量嵌入上游路径，只有OpenAI兼容的提供商支持
+func (m *Manager) GetEmbeddingsPath(provider types.Provider) (string, error) {
+	switch provider {
+	case types.ProviderOpenAI, types.ProviderQwen:
+		return "/v1/embeddings", nil
+	case types.ProviderAzure:
+		return azureUpstreamPath("/v1/embeddings"), nil
+	}
+	return "", fmt.Errorf("提供商 %s 不支持embeddings", provider)
 }
 
 // applyModelRouteToRequest 对请求应用模型路由
@@ -310,6 +331,8 @@ func (m *Manager) getProviderFormat(provider types.Provider) Format {
 		return FormatAnthropic
 	case types.ProviderOpenAI:
 		return FormatOpenAI
+	case types.ProviderGoogle:
+		return FormatGemini
 	default:
 		return FormatOpenAI // 默认OpenAI格式，Qwen等也使用此格式
 	}
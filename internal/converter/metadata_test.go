@@ -2,7 +2,12 @@ package converter
 
 import (
 	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
 )
 
 func TestMetadataPreservation(t *testing.T) {
@@ -289,3 +294,175 @@ func TestSystemFieldPreservation(t *testing.T) {
 		})
 	}
 }
+
+func TestSystemConflictMerged(t *testing.T) {
+	conv := NewManager()
+
+	tests := []struct {
+		name        string
+		input       string
+		wantContent string
+		wantSystem  string
+	}{
+		{
+			name:        "字符串system与messages中的system合并",
+			input:       `{"model":"claude-3-sonnet-20240229","max_tokens":100,"system":"Top","messages":[{"role":"system","content":"Inline"},{"role":"user","content":"Hello"}]}`,
+			wantContent: "Top\n\nInline",
+			wantSystem:  `"Top\n\nInline"`,
+		},
+		{
+			name:        "数组system追加文本块并保留cache_control",
+			input:       `{"model":"claude-3-sonnet-20240229","max_tokens":100,"system":[{"type":"text","text":"Top","cache_control":{"type":"ephemeral"}}],"messages":[{"role":"system","content":[{"type":"text","text":"Inline"}]},{"role":"user","content":"Hello"}]}`,
+			wantContent: "Top\nInline",
+			wantSystem:  `[{"type":"text","text":"Top","cache_control":{"type":"ephemeral"}},{"type":"text","text":"Inline"}]`,
+		},
+		{
+			name:        "只有messages中的system",
+			input:       `{"model":"claude-3-sonnet-20240229","max_tokens":100,"messages":[{"role":"system","content":"Inline"},{"role":"user","content":"Hello"}]}`,
+			wantContent: "Inline",
+			wantSystem:  `"Inline"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _, err := conv.ParseRequest([]byte(tt.input), "/v1/messages")
+			if err != nil {
+				t.Fatalf("ParseRequest() error = %v", err)
+			}
+
+			var systems []types.Message
+			for _, msg := range req.Messages {
+				if msg.Role == "system" {
+					systems = append(systems, msg)
+				}
+			}
+			if len(systems) != 1 || systems[0].Content != tt.wantContent {
+				t.Fatalf("应只有一条合并后的system消息, got %v", systems)
+			}
+			if original, _ := json.Marshal(req.OriginalSystem); string(original) != tt.wantSystem {
+				t.Errorf("OriginalSystem = %s, want %s", original, tt.wantSystem)
+			}
+
+			// 发往Anthropic时system内容不重复，messages中不残留system消息
+			body, err := conv.BuildUpstreamRequest(req, types.ProviderAnthropic)
+			if err != nil {
+				t.Fatalf("BuildUpstreamRequest() error = %v", err)
+			}
+			var result struct {
+				System   json.RawMessage          `json:"system"`
+				Messages []map[string]interface{} `json:"messages"`
+			}
+			_ = json.Unmarshal(body, &result)
+			if count := strings.Count(string(result.System), "Inline"); count != 1 {
+				t.Errorf("system中Inline出现 %d 次: %s", count, result.System)
+			}
+			if len(result.Messages) != 1 || result.Messages[0]["role"] != "user" {
+				t.Errorf("messages中不应残留system消息: %v", result.Messages)
+			}
+
+			// 转换为OpenAI时只产生一条system消息
+			openaiReq, err := conv.ConvertRequest(FormatAnthropic, FormatOpenAI, []byte(tt.input))
+			if err != nil {
+				t.Fatalf("转换为OpenAI失败: %v", err)
+			}
+			if count := strings.Count(string(openaiReq), `"role":"system"`); count != 1 {
+				t.Errorf("OpenAI请求应只有一条system消息, got %d: %s", count, openaiReq)
+			}
+		})
+	}
+}
+
+func TestCacheControlPassthrough(t *testing.T) {
+	conv := NewManager()
+
+	toolRequest := `{"model":"claude-3-sonnet-20240229","max_tokens":100,
+		"tools":[{"name":"get_weather","input_schema":{"type":"object"},"cache_control":{"type":"ephemeral"}}],
+		"messages":[
+			{"role":"user","content":"weather?"},
+			{"role":"assistant","content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"tu_1","name":"get_weather","input":{},"cache_control":{"type":"ephemeral"}}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu_1","content":"sunny","cache_control":{"type":"ephemeral"}}]}
+		]}`
+
+	tests := []struct {
+		name  string
+		input string
+		paths []string // 期望带有ephemeral缓存标记的块
+	}{
+		{
+			name:  "system与文本块",
+			input: "testdata/req/req_anthropic_cache_control.json",
+			paths: []string{"system[0]", "system[1]", "messages[0].content[1]"},
+		},
+		{
+			name:  "工具定义、tool_use与tool_result",
+			input: toolRequest,
+			paths: []string{"tools[0]", "messages[1].content[1]", "messages[2].content[0]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := []byte(tt.input)
+			if strings.HasPrefix(tt.input, "testdata/") {
+				data, err := os.ReadFile(tt.input)
+				if err != nil {
+					t.Fatalf("读取测试数据失败: %v", err)
+				}
+				input = data
+			}
+
+			req, _, err := conv.ParseRequest(input, "/v1/messages")
+			if err != nil {
+				t.Fatalf("ParseRequest() error = %v", err)
+			}
+			body, err := conv.BuildUpstreamRequest(req, types.ProviderAnthropic)
+			if err != nil {
+				t.Fatalf("BuildUpstreamRequest() error = %v", err)
+			}
+
+			var result map[string]interface{}
+			_ = json.Unmarshal(body, &result)
+			for _, path := range tt.paths {
+				block, _ := lookupPath(result, path).(map[string]interface{})
+				cacheControl, _ := block["cache_control"].(map[string]interface{})
+				if cacheControl["type"] != "ephemeral" {
+					t.Errorf("%s 缺少cache_control标记: %v", path, block)
+				}
+			}
+			if count := strings.Count(string(body), `"cache_control"`); count != len(tt.paths) {
+				t.Errorf("cache_control数量 = %d, want %d: %s", count, len(tt.paths), body)
+			}
+
+			// 转换为OpenAI时不应携带cache_control
+			openaiReq, err := conv.BuildUpstreamRequest(req, types.ProviderOpenAI)
+			if err != nil {
+				t.Fatalf("BuildUpstreamRequest(OpenAI) error = %v", err)
+			}
+			if strings.Contains(string(openaiReq), "cache_control") {
+				t.Errorf("OpenAI请求不应包含cache_control: %s", openaiReq)
+			}
+		})
+	}
+}
+
+// lookupPath 按 "messages[1].content[0]" 形式的路径取值
+func lookupPath(value interface{}, path string) interface{} {
+	for _, part := range strings.Split(path, ".") {
+		name, index := part, -1
+		if open := strings.Index(part, "["); open >= 0 {
+			name = part[:open]
+			index, _ = strconv.Atoi(strings.TrimSuffix(part[open+1:], "]"))
+		}
+		object, _ := value.(map[string]interface{})
+		value = object[name]
+		if index >= 0 {
+			array, _ := value.([]interface{})
+			if index >= len(array) {
+				return nil
+			}
+			value = array[index]
+		}
+	}
+	return value
+}
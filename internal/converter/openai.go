@@ -12,7 +12,32 @@ type OpenAIConverter struct{}
 
 // OpenAIStreamConverter OpenAI流式转换器（有状态）
 type OpenAIStreamConverter struct {
-	// 目前OpenAI转换器不需要保存状态，保留结构体以便将来扩展
+	roleSent bool // 是否已在首个内容chunk中输出 delta.role
+
+	// 解析上游流时的内容块状态：文本和每个工具调用依次占用递增的内容块index
+	blockCount int         // 已开始的内容块数
+	blockOpen  bool        // 是否有未结束的内容块
+	openBlock  int         // 未结束内容块的index
+	openType   string      // 未结束内容块的类型（text/tool_use）
+	toolBlocks map[int]int // tool_calls[].index -> 内容块index
+
+	// 构建客户端流时的工具调用状态：tool_calls[].index按工具调用出现顺序从0编号，与内容块index无关
+	toolCount   int         // 已输出的工具调用数
+	toolIndexes map[int]int // 内容块index -> tool_calls[].index
+}
+
+// toolCallIndex 返回内容块对应的tool_calls[].index，首次出现时分配下一个序号
+func (sc *OpenAIStreamConverter) toolCallIndex(blockIndex int) int {
+	if index, ok := sc.toolIndexes[blockIndex]; ok {
+		return index
+	}
+	if sc.toolIndexes == nil {
+		sc.toolIndexes = make(map[int]int)
+	}
+	index := sc.toolCount
+	sc.toolIndexes[blockIndex] = index
+	sc.toolCount++
+	return index
 }
 
 // NewOpenAIConverter 创建OpenAI转换器
@@ -47,24 +72,37 @@ func (c *OpenAIConverter) ParseRequest(data []byte) (*types.UnifiedRequest, erro
 		TopP:           req.TopP,
 		Tools:          req.Tools,
 		ToolChoice:     req.ToolChoice,
+		Seed:           req.Seed,
+		StopSequences:  req.Stop,
+		N:              req.N,
+		ResponseFormat: req.ResponseFormat,
 		OriginalFormat: string(FormatOpenAI),
+		Extra:          extraFields(data, req),
 	}, nil
 }
 
 // BuildRequest 构建发送给上游OpenAI的请求
 func (c *OpenAIConverter) BuildRequest(request *types.UnifiedRequest) ([]byte, error) {
 	req := types.OpenAIRequest{
-		Model:       request.Model,
-		Messages:    c.filterMessages(request.Messages),
-		MaxTokens:   request.MaxTokens,
-		Temperature: request.Temperature,
-		Stream:      request.Stream,
-		TopP:        request.TopP,
-		Tools:       c.convertTools(request.Tools),
-		ToolChoice:  request.ToolChoice,
+		Model:          request.Model,
+		Messages:       c.filterMessages(request.Messages),
+		MaxTokens:      request.MaxTokens,
+		Temperature:    request.Temperature,
+		Stream:         request.Stream,
+		TopP:           request.TopP,
+		Tools:          c.convertTools(request.Tools),
+		ToolChoice:     request.ToolChoice,
+		Seed:           request.Seed,
+		Stop:           request.StopSequences,
+		N:              request.N,
+		ResponseFormat: request.ResponseFormat,
 	}
 
-	return json.Marshal(req)
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return applyExtraFields(data, request, FormatOpenAI)
 }
 
 // ParseResponse 解析OpenAI上游响应到内部格式
@@ -132,13 +170,17 @@ func (c *OpenAIConverter) filterMessages(messages []types.Message) []types.Messa
 	return filtered
 }
 
-// filterContent 过滤内容中的cache_control等不兼容字段
+// filterContent 过滤内容中的cache_control等不兼容字段，并将Anthropic图片块转换为image_url
 func (c *OpenAIConverter) filterContent(content interface{}) interface{} {
 	switch v := content.(type) {
 	case []interface{}:
 		var filtered []interface{}
 		for _, item := range v {
 			if itemMap, ok := item.(map[string]interface{}); ok {
+				if source, ok := itemMap["source"].(map[string]interface{}); ok && getString(itemMap["type"]) == "image" {
+					filtered = append(filtered, openAIImageBlock(source))
+					continue
+				}
 				cleanItem := make(map[string]interface{})
 				for key, value := range itemMap {
 					if key != "cache_control" {
@@ -200,108 +242,188 @@ func (sc *OpenAIStreamConverter) ParseStreamEvent(eventType string, data []byte)
 		return nil, fmt.Errorf("解析事件数据失败: %w", err)
 	}
 
+	// 统一格式只承载单个回复，n>1 时跨格式转换降级为只保留首个choice（index 0）
+	events := sc.parseChoice(firstStreamChoice(eventData))
+
+	// 开启stream_options.include_usage时，最后一个chunk的choices为空，只携带usage
+	if usage, ok := eventData["usage"].(map[string]interface{}); ok {
+		promptTokens, _ := usage["prompt_tokens"].(float64)
+		if completionTokens, ok := usage["completion_tokens"].(float64); ok {
+			events = append(events, &UnifiedStreamEvent{
+				Type:  StreamEventUsage,
+				Usage: map[string]int{"input_tokens": int(promptTokens), "output_tokens": int(completionTokens)},
+			})
+		}
+	}
+
+	return events, nil
+}
+
+// parseChoice 解析单个choice的增量
+func (sc *OpenAIStreamConverter) parseChoice(choice map[string]interface{}) []*UnifiedStreamEvent {
 	// OpenAI格式没有命名事件，需要从数据结构判断事件类型
-	if choices, ok := eventData["choices"].([]interface{}); ok && len(choices) > 0 {
-		choice := choices[0].(map[string]interface{})
-
-		// 检查是否有delta
-		if delta, ok := choice["delta"].(map[string]interface{}); ok {
-			// 检查finish_reason确定是否结束
-			if finishReason, ok := choice["finish_reason"]; ok && finishReason != nil {
-				events := []*UnifiedStreamEvent{}
-
-				// 先发送ContentStop（无论是工具调用还是普通文本）
-				events = append(events, &UnifiedStreamEvent{
-					Type: StreamEventContentStop,
-					Content: &UnifiedStreamContent{
-						Index: 0,
-					},
-				})
+	if choice == nil {
+		return nil
+	}
+	delta, ok := choice["delta"].(map[string]interface{})
+	if !ok {
+		return nil // 跳过不识别的事件
+	}
 
-				// 然后发送MessageStop（不设置IsDone，让[DONE]来触发结束）
-				events = append(events, &UnifiedStreamEvent{
-					Type:   StreamEventMessageStop,
-					IsDone: false,
-				})
+	var events []*UnifiedStreamEvent
 
-				return events, nil
-			}
+	// 处理内容增量
+	if content, ok := delta["content"].(string); ok && content != "" {
+		if !sc.blockOpen || sc.openType != "text" {
+			events = append(events, sc.startBlock(&UnifiedStreamContent{Type: "text"})...)
+		}
+		events = append(events, &UnifiedStreamEvent{
+			Type: StreamEventContentDelta,
+			Content: &UnifiedStreamContent{
+				Type:  "text",
+				Text:  content,
+				Index: sc.openBlock,
+			},
+		})
+	}
 
-			// 处理内容增量
-			if content, ok := delta["content"].(string); ok && content != "" {
-				return []*UnifiedStreamEvent{{
-					Type: StreamEventContentDelta,
-					Content: &UnifiedStreamContent{
-						Type:  "text",
-						Text:  content,
-						Index: 0,
-					},
-				}}, nil
+	// 处理工具调用增量：按tool_calls[].index区分并行的多个调用，
+	// 首个分片携带id和函数名，之后的分片只有arguments片段
+	toolCalls, _ := delta["tool_calls"].([]interface{})
+	for position, item := range toolCalls {
+		toolCall, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		callIndex := position
+		if index, ok := toolCall["index"].(float64); ok {
+			callIndex = int(index)
+		}
+		function, _ := toolCall["function"].(map[string]interface{})
+		arguments, _ := function["arguments"].(string)
+
+		blockIndex, started := sc.toolBlocks[callIndex]
+		if !started {
+			toolID, _ := toolCall["id"].(string)
+			toolName, _ := function["name"].(string)
+			events = append(events, sc.startBlock(&UnifiedStreamContent{
+				Type:     "tool_use",
+				ToolID:   toolID,
+				ToolName: toolName,
+			})...)
+			blockIndex = sc.openBlock
+			if sc.toolBlocks == nil {
+				sc.toolBlocks = make(map[int]int)
 			}
+			sc.toolBlocks[callIndex] = blockIndex
+		}
 
-			// 处理工具调用增量
-			if toolCalls, ok := delta["tool_calls"].([]interface{}); ok && len(toolCalls) > 0 {
-				toolCall := toolCalls[0].(map[string]interface{})
-
-				// 提取工具调用ID（如果存在）
-				toolID, _ := toolCall["id"].(string)
-
-				if function, ok := toolCall["function"].(map[string]interface{}); ok {
-					// 提取工具名称（第一次调用时会有）
-					toolName, _ := function["name"].(string)
-					arguments, _ := function["arguments"].(string)
-
-					// 如果有工具名称，说明这是第一个chunk，需要生成ContentStart事件
-					if toolName != "" {
-						events := []*UnifiedStreamEvent{
-							{
-								Type: StreamEventContentStart,
-								Content: &UnifiedStreamContent{
-									Type:     "tool_use",
-									ToolID:   toolID,
-									ToolName: toolName,
-									Index:    0,
-								},
-							},
-						}
+		if arguments != "" {
+			events = append(events, &UnifiedStreamEvent{
+				Type: StreamEventContentDelta,
+				Content: &UnifiedStreamContent{
+					Type:      "tool_use",
+					ToolInput: arguments,
+					Index:     blockIndex,
+				},
+			})
+		}
+	}
 
-						// 如果同时有arguments，也生成ContentDelta事件
-						if arguments != "" {
-							events = append(events, &UnifiedStreamEvent{
-								Type: StreamEventContentDelta,
-								Content: &UnifiedStreamContent{
-									Type:      "tool_use",
-									ToolInput: arguments,
-									Index:     0,
-								},
-							})
-						}
+	// 检查finish_reason确定是否结束：先结束当前内容块，再发送MessageStop
+	if finishReason, ok := choice["finish_reason"].(string); ok && finishReason != "" {
+		if sc.blockOpen {
+			events = append(events, &UnifiedStreamEvent{
+				Type:    StreamEventContentStop,
+				Content: &UnifiedStreamContent{Index: sc.openBlock},
+			})
+			sc.blockOpen = false
+		}
 
-						return events, nil
-					}
+		// 不设置IsDone，让[DONE]来触发结束
+		events = append(events, &UnifiedStreamEvent{
+			Type:         StreamEventMessageStop,
+			FinishReason: toUnifiedFinishReason(FormatOpenAI, finishReason),
+			IsDone:       false,
+		})
+	}
 
-					// 只有arguments的增量更新
-					if arguments != "" {
-						return []*UnifiedStreamEvent{{
-							Type: StreamEventContentDelta,
-							Content: &UnifiedStreamContent{
-								Type:      "tool_use",
-								ToolInput: arguments,
-								Index:     0,
-							},
-						}}, nil
-					}
-				}
-			}
-		}
+	return events
+}
+
+// startBlock 结束未结束的内容块，以下一个index开始新内容块
+func (sc *OpenAIStreamConverter) startBlock(content *UnifiedStreamContent) []*UnifiedStreamEvent {
+	var events []*UnifiedStreamEvent
+	if sc.blockOpen {
+		events = append(events, &UnifiedStreamEvent{
+			Type:    StreamEventContentStop,
+			Content: &UnifiedStreamContent{Index: sc.openBlock},
+		})
 	}
 
-	return nil, nil // 跳过不识别的事件
+	content.Index = sc.blockCount
+	sc.blockOpen = true
+	sc.openBlock = sc.blockCount
+	sc.openType = content.Type
+	sc.blockCount++
+
+	return append(events, &UnifiedStreamEvent{Type: StreamEventContentStart, Content: content})
 }
 
-// BuildStreamEvent 从统一内部格式构建OpenAI流式事件
+// firstStreamChoice 返回流式chunk中index为0的choice，不存在时返回nil
+func firstStreamChoice(eventData map[string]interface{}) map[string]interface{} {
+	choices, _ := eventData["choices"].([]interface{})
+	for _, item := range choices {
+		choice, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// 缺少index时视为单choice流
+		if index, ok := choice["index"].(float64); !ok || index == 0 {
+			return choice
+		}
+	}
+	return nil
+}
+
+// BuildStreamEvent 从统一内部格式构建OpenAI流式事件。内容块合并到同一个choice（index为0）中输出
 func (sc *OpenAIStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent) (*StreamChunk, error) {
 	switch event.Type {
+	case StreamEventContentStart:
+		// 工具调用的首个chunk需要携带ID和函数名，文本块开始无需输出
+		if event.Content != nil && event.Content.Type == "tool_use" {
+			delta := map[string]interface{}{
+				"tool_calls": []interface{}{
+					map[string]interface{}{
+						"index": sc.toolCallIndex(event.Content.Index),
+						"id":    event.Content.ToolID,
+						"type":  "function",
+						"function": map[string]interface{}{
+							"name":      event.Content.ToolName,
+							"arguments": "",
+						},
+					},
+				},
+			}
+			if !sc.roleSent {
+				delta["role"] = "assistant"
+				sc.roleSent = true
+			}
+
+			return &StreamChunk{
+				EventType: "",
+				Data: map[string]interface{}{
+					"choices": []interface{}{
+						map[string]interface{}{
+							"index": 0,
+							"delta": delta,
+						},
+					},
+				},
+				IsDone: false,
+			}, nil
+		}
+
 	case StreamEventContentDelta:
 		if event.Content != nil {
 			var delta map[string]interface{}
@@ -315,7 +437,7 @@ func (sc *OpenAIStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent) (*S
 				delta = map[string]interface{}{
 					"tool_calls": []interface{}{
 						map[string]interface{}{
-							"index": event.Content.Index,
+							"index": sc.toolCallIndex(event.Content.Index),
 							"function": map[string]interface{}{
 								"arguments": event.Content.ToolInput,
 							},
@@ -324,10 +446,16 @@ func (sc *OpenAIStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent) (*S
 				}
 			}
 
+			// OpenAI规范：只有第一个内容chunk带 role，与此前收到哪些事件无关
+			if delta != nil && !sc.roleSent {
+				delta["role"] = "assistant"
+				sc.roleSent = true
+			}
+
 			openAIData := map[string]interface{}{
 				"choices": []interface{}{
 					map[string]interface{}{
-						"index": event.Content.Index,
+						"index": 0,
 						"delta": delta,
 					},
 				},
@@ -336,13 +464,12 @@ func (sc *OpenAIStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent) (*S
 			return &StreamChunk{
 				EventType: "",
 				Data:      openAIData,
-				Tokens:    0,
 				IsDone:    false,
 			}, nil
 		}
 
 	case StreamEventMessageStop:
-		finishReason := "stop"
+		finishReason := fromUnifiedFinishReason(FormatOpenAI, event.FinishReason)
 		openAIData := map[string]interface{}{
 			"choices": []interface{}{
 				map[string]interface{}{
@@ -356,7 +483,6 @@ func (sc *OpenAIStreamConverter) BuildStreamEvent(event *UnifiedStreamEvent) (*S
 		return &StreamChunk{
 			EventType: "",
 			Data:      openAIData,
-			Tokens:    0,
 			IsDone:    true,
 		}, nil
 	}
@@ -94,7 +94,7 @@ func TestTransformRequestOpenAI(t *testing.T) {
 	if proxyReq.MaxTokens != 100 {
 		t.Errorf("TransformRequest() MaxTokens = %v, want 100", proxyReq.MaxTokens)
 	}
-	if proxyReq.Temperature != 0.7 {
+	if proxyReq.Temperature == nil || *proxyReq.Temperature != 0.7 {
 		t.Errorf("TransformRequest() Temperature = %v, want 0.7", proxyReq.Temperature)
 	}
 	if len(proxyReq.Messages) != 2 {
@@ -114,6 +114,37 @@ func TestTransformRequestOpenAI(t *testing.T) {
 	}
 }
 
+func TestTransformRequestOpenAISeed(t *testing.T) {
+	input := []byte(`{
+		"model": "gpt-4o",
+		"messages": [{"role": "user", "content": "Hello"}],
+		"temperature": 0.7,
+		"seed": 42
+	}`)
+
+	transformer := NewManager()
+	proxyReq, _, err := transformer.ParseRequest(input, "")
+	if err != nil {
+		t.Fatalf("ParseRequest() error = %v", err)
+	}
+	if proxyReq.Seed == nil || *proxyReq.Seed != 42 {
+		t.Fatalf("ParseRequest() Seed = %v, want 42", proxyReq.Seed)
+	}
+
+	// seed 需透传给 OpenAI 兼容上游
+	upstreamBody, err := transformer.BuildUpstreamRequest(proxyReq, types.ProviderQwen)
+	if err != nil {
+		t.Fatalf("BuildUpstreamRequest() error = %v", err)
+	}
+	var upstreamReq map[string]interface{}
+	if err := json.Unmarshal(upstreamBody, &upstreamReq); err != nil {
+		t.Fatalf("解析上游请求失败: %v", err)
+	}
+	if upstreamReq["seed"] != float64(42) {
+		t.Errorf("上游请求 seed = %v, want 42", upstreamReq["seed"])
+	}
+}
+
 func TestTransformRequestAnthropic(t *testing.T) {
 	input := []byte(`{
 		"model": "claude-3-5-sonnet",
@@ -137,7 +168,7 @@ func TestTransformRequestAnthropic(t *testing.T) {
 	if proxyReq.MaxTokens != 100 {
 		t.Errorf("TransformRequest() MaxTokens = %v, want 100", proxyReq.MaxTokens)
 	}
-	if proxyReq.Temperature != 0.7 {
+	if proxyReq.Temperature == nil || *proxyReq.Temperature != 0.7 {
 		t.Errorf("TransformRequest() Temperature = %v, want 0.7", proxyReq.Temperature)
 	}
 	// 转换器会将system消息添加到messages开头，所以总共有2条消息
@@ -385,7 +416,7 @@ func TestTransformRequestAnthropicComplexContent(t *testing.T) {
 	if proxyReq.MaxTokens != 32000 {
 		t.Errorf("TransformRequest() MaxTokens = %v, want 32000", proxyReq.MaxTokens)
 	}
-	if proxyReq.Temperature != 1.0 {
+	if proxyReq.Temperature == nil || *proxyReq.Temperature != 1.0 {
 		t.Errorf("TransformRequest() Temperature = %v, want 1.0", proxyReq.Temperature)
 	}
 	if proxyReq.Stream == nil || !*proxyReq.Stream {
@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"fmt"
+
+	"github.com/iBreaker/llm-gateway/pkg/logger"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// knownRoles 统一格式支持的消息role
+var knownRoles = map[string]bool{
+	"system":    true,
+	"user":      true,
+	"assistant": true,
+	"tool":      true,
+}
+
+// roleAliases 客户端使用的新role到统一格式role的映射
+var roleAliases = map[string]string{
+	"developer": "system", // OpenAI o1 起以 developer 取代 system
+}
+
+// SetUnknownRolePolicy 设置未知消息role的处理策略，空字符串表示透传
+func (m *Manager) SetUnknownRolePolicy(policy string) {
+	m.unknownRolePolicy = policy
+}
+
+// normalizeMessageRoles 将已知别名映射为统一role，未知role按策略透传或报错
+func normalizeMessageRoles(messages []types.Message, policy string) error {
+	for i := range messages {
+		role := messages[i].Role
+		if knownRoles[role] {
+			continue
+		}
+
+		if mapped, ok := roleAliases[role]; ok {
+			messages[i].Role = mapped
+			continue
+		}
+
+		if policy == types.UnknownRoleReject {
+			return fmt.Errorf("不支持的消息role: %q (messages[%d])", role, i)
+		}
+		logger.Debug("未知的消息role %q 将原样透传给上游 (messages[%d])", role, i)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package converter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+const developerRoleRequest = `{"model":"gpt-4o","messages":[{"role":"developer","content":"be brief"},{"role":"user","content":"hi"}]}`
+
+const unknownRoleRequest = `{"model":"gpt-4o","messages":[{"role":"critic","content":"review"},{"role":"user","content":"hi"}]}`
+
+func TestParseRequest_DeveloperRoleMappedToSystem(t *testing.T) {
+	manager := NewManager()
+
+	req, _, err := manager.ParseRequest([]byte(developerRoleRequest), "/v1/chat/completions")
+	if err != nil {
+		t.Fatalf("ParseRequest() error = %v", err)
+	}
+	if req.Messages[0].Role != "system" {
+		t.Fatalf("developer应映射为system, got %s", req.Messages[0].Role)
+	}
+
+	// 转换到Anthropic时应进入system字段而不是作为未知role发往上游
+	body, err := manager.BuildUpstreamRequest(req, types.ProviderAnthropic)
+	if err != nil {
+		t.Fatalf("BuildUpstreamRequest() error = %v", err)
+	}
+	var anthropicReq map[string]interface{}
+	_ = json.Unmarshal(body, &anthropicReq)
+	if system, _ := json.Marshal(anthropicReq["system"]); !strings.Contains(string(system), "be brief") {
+		t.Errorf("system = %s", system)
+	}
+	if messages := anthropicReq["messages"].([]interface{}); len(messages) != 1 {
+		t.Errorf("messages = %v", messages)
+	}
+}
+
+func TestParseRequest_UnknownRolePolicy(t *testing.T) {
+	manager := NewManager()
+
+	req, _, err := manager.ParseRequest([]byte(unknownRoleRequest), "/v1/chat/completions")
+	if err != nil {
+		t.Fatalf("默认策略应透传, error = %v", err)
+	}
+	if req.Messages[0].Role != "critic" {
+		t.Errorf("透传时role不应被修改, got %s", req.Messages[0].Role)
+	}
+
+	manager.SetUnknownRolePolicy(types.UnknownRoleReject)
+	_, _, err = manager.ParseRequest([]byte(unknownRoleRequest), "/v1/chat/completions")
+	if err == nil || !strings.Contains(err.Error(), "critic") {
+		t.Errorf("reject策略应返回包含role的错误, got %v", err)
+	}
+
+	// 已知映射不受reject策略影响
+	if _, _, err := manager.ParseRequest([]byte(developerRoleRequest), "/v1/chat/completions"); err != nil {
+		t.Errorf("developer不应被拒绝: %v", err)
+	}
+}
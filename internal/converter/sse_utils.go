@@ -2,6 +2,7 @@ package converter
 
 import (
 	"bufio"
+	"encoding/json"
 	"io"
 	"strings"
 )
@@ -21,51 +22,21 @@ func ProcessSSEStream(reader io.Reader, converter Converter, writer StreamWriter
 
 	supportNamedEvents := converter.GetFormat() == FormatAnthropic
 
-	scanner := bufio.NewScanner(reader)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
-
-		if line == "" {
-			continue
+	return scanSSEEvents(reader, supportNamedEvents, func(eventType, data string) (bool, error) {
+		// 处理结束标记
+		if data == "[DONE]" {
+			return true, writer.WriteDone()
 		}
 
-		// 处理命名事件（Anthropic风格）
-		if supportNamedEvents && strings.HasPrefix(line, "event: ") {
-			eventType := line[7:] // 移除"event: "前缀
-
-			// 读取下一行的data
-			if scanner.Scan() {
-				dataLine := scanner.Text()
-				if strings.HasPrefix(dataLine, "data: ") {
-					data := dataLine[6:]
-
-					if err := processSSEEvent(eventType, []byte(data), streamConverter, writer); err != nil {
-						return err
-					}
-
-					if eventType == "message_stop" {
-						return writer.WriteDone()
-					}
-				}
-			}
-		} else if strings.HasPrefix(line, "data: ") {
-			// 处理SSE数据行
-			data := line[6:] // 移除"data: "前缀
-
-			// 处理结束标记
-			if data == "[DONE]" {
-				return writer.WriteDone()
-			}
-
-			if err := processSSEEvent("", []byte(data), streamConverter, writer); err != nil {
-				return err
-			}
+		if err := processSSEEvent(eventType, []byte(data), streamConverter, writer); err != nil {
+			return true, err
 		}
-	}
 
-	return scanner.Err()
+		if eventType == "message_stop" {
+			return true, writer.WriteDone()
+		}
+		return false, nil
+	})
 }
 
 // processSSEEvent 处理单个SSE事件
@@ -99,3 +70,120 @@ func processSSEEvent(eventType string, data []byte, streamConverter StreamConver
 
 	return nil
 }
+
+// ForwardSSEStream 同格式透传SSE流，仅解析SSE协议，事件数据原样写入writer。
+// streamConverter 非nil时用于从事件中解析上游报告的token用量，填入StreamChunk.Usage
+func ForwardSSEStream(reader io.Reader, supportNamedEvents bool, streamConverter StreamConverter, writer StreamWriter) error {
+	return scanSSEEvents(reader, supportNamedEvents, func(eventType, data string) (bool, error) {
+		if data == "[DONE]" {
+			return true, writer.WriteDone()
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &payload); err != nil {
+			return false, nil // 跳过无法解析的事件
+		}
+
+		chunk := &StreamChunk{EventType: eventType, Data: payload, Usage: streamUsage(streamConverter, eventType, []byte(data))}
+		if err := writer.WriteChunk(chunk); err != nil {
+			return true, err
+		}
+
+		if eventType == "message_stop" {
+			return true, writer.WriteDone()
+		}
+		return false, nil
+	})
+}
+
+// scanSSEEvents 按SSE规范解析事件流，每个完整事件调用一次handle，handle返回true时停止解析。
+// 以冒号开头的注释行（keepalive）被忽略，同一事件的多行data:以换行拼接。
+// 为兼容不规范的上游，只有event:没有data:时空行不结束事件；缺少空行分隔时，
+// 新的event:行或已累积的数据已是完整JSON时先分发前一个事件
+func scanSSEEvents(reader io.Reader, supportNamedEvents bool, handle func(eventType, data string) (bool, error)) error {
+	scanner := bufio.NewScanner(reader)
+	eventType := ""
+	var dataLines []string
+
+	dispatch := func() (bool, error) {
+		if len(dataLines) == 0 {
+			return false, nil
+		}
+		data := strings.Join(dataLines, "\n")
+		currentType := eventType
+		eventType, dataLines = "", nil
+		return handle(currentType, data)
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			if stop, err := dispatch(); stop || err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			if stop, err := dispatch(); stop || err != nil {
+				return err
+			}
+			if supportNamedEvents {
+				eventType = value
+			}
+		case "data":
+			if len(dataLines) > 0 && isCompleteSSEData(dataLines) {
+				if stop, err := dispatch(); stop || err != nil {
+					return err
+				}
+			}
+			dataLines = append(dataLines, value)
+		}
+		// id、retry等其他字段与网关无关，忽略
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	_, err := dispatch()
+	return err
+}
+
+// isCompleteSSEData 已累积的data行是否构成完整事件（结束标记或合法JSON）
+func isCompleteSSEData(dataLines []string) bool {
+	data := strings.Join(dataLines, "\n")
+	return data == "[DONE]" || json.Valid([]byte(data))
+}
+
+// streamUsage 解析事件中上游报告的token用量，事件不携带用量时返回nil
+func streamUsage(streamConverter StreamConverter, eventType string, data []byte) *StreamUsage {
+	if streamConverter == nil {
+		return nil
+	}
+
+	events, err := streamConverter.ParseStreamEvent(eventType, data)
+	if err != nil {
+		return nil
+	}
+
+	var usage *StreamUsage
+	for _, event := range events {
+		if event != nil && event.Type == StreamEventUsage {
+			if usage == nil {
+				usage = &StreamUsage{}
+			}
+			usage.Merge(streamUsageFromEvent(event))
+		}
+	}
+	return usage
+}
@@ -0,0 +1,423 @@
+package converter
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// collectStreamWriter 收集流式输出用于断言，与实际写入器一样不收集仅携带用量的数据块
+type collectStreamWriter struct {
+	chunks []*StreamChunk
+	usage  StreamUsage
+	done   bool
+}
+
+func (w *collectStreamWriter) WriteChunk(chunk *StreamChunk) error {
+	w.usage.Merge(chunk.Usage)
+	if chunk.Data == nil && !chunk.IsDone {
+		return nil
+	}
+	w.chunks = append(w.chunks, chunk)
+	return nil
+}
+
+func (w *collectStreamWriter) WriteDone() error {
+	w.done = true
+	return nil
+}
+
+// openAIDeltas 提取OpenAI格式chunk中choices[0].delta
+func openAIDeltas(t *testing.T, chunks []*StreamChunk) []map[string]interface{} {
+	t.Helper()
+	var deltas []map[string]interface{}
+	for _, chunk := range chunks {
+		data, ok := chunk.Data.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		choices, _ := data["choices"].([]interface{})
+		if len(choices) == 0 {
+			continue
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		if delta, ok := choice["delta"].(map[string]interface{}); ok {
+			deltas = append(deltas, delta)
+		}
+	}
+	return deltas
+}
+
+func TestAnthropicToOpenAIStreamRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+	}{
+		{
+			name: "message_start_first",
+			stream: "event: message_start\n" +
+				`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-3-5-sonnet"}}` + "\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}` + "\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}` + "\n\n" +
+				"event: message_stop\n" +
+				`data: {"type":"message_stop"}` + "\n\n",
+		},
+		{
+			name: "ping_before_message_start",
+			stream: "event: ping\n" +
+				`data: {"type":"ping"}` + "\n\n" +
+				"event: message_start\n" +
+				`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-3-5-sonnet"}}` + "\n\n" +
+				"event: content_block_start\n" +
+				`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}` + "\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}` + "\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}` + "\n\n" +
+				"event: message_stop\n" +
+				`data: {"type":"message_stop"}` + "\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager()
+			writer := &collectStreamWriter{}
+
+			if err := manager.ProcessStream(strings.NewReader(tt.stream), types.ProviderAnthropic, FormatOpenAI, writer); err != nil {
+				t.Fatalf("ProcessStream() error = %v", err)
+			}
+
+			deltas := openAIDeltas(t, writer.chunks)
+			if len(deltas) == 0 {
+				t.Fatal("没有输出任何delta")
+			}
+
+			roleCount := 0
+			for i, delta := range deltas {
+				if _, ok := delta["role"]; ok {
+					roleCount++
+					if i != 0 {
+						t.Errorf("role 出现在第 %d 个chunk，应只出现在第一个", i)
+					}
+				}
+			}
+			if roleCount != 1 {
+				t.Errorf("role 出现 %d 次, want 1", roleCount)
+			}
+			if deltas[0]["role"] != "assistant" || deltas[0]["content"] != "Hello" {
+				t.Errorf("首个delta = %v", deltas[0])
+			}
+		})
+	}
+}
+
+// multiChoiceOpenAIStream n=2 时的OpenAI流，每个chunk可能包含多个choice
+const multiChoiceOpenAIStream = `data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"A"}},{"index":1,"delta":{"role":"assistant","content":"B"}}]}` + "\n\n" +
+	`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":1,"delta":{"content":"B2"}}]}` + "\n\n" +
+	`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"A2"}}]}` + "\n\n" +
+	`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"},{"index":1,"delta":{},"finish_reason":"stop"}]}` + "\n\n" +
+	"data: [DONE]\n\n"
+
+func TestOpenAIStreamMultiChoicePassthrough(t *testing.T) {
+	manager := NewManager()
+	writer := &collectStreamWriter{}
+
+	if err := manager.ProcessStream(strings.NewReader(multiChoiceOpenAIStream), types.ProviderOpenAI, FormatOpenAI, writer); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	if !writer.done {
+		t.Error("未写入结束标记")
+	}
+	if len(writer.chunks) != 4 {
+		t.Fatalf("chunk数量 = %d, want 4", len(writer.chunks))
+	}
+
+	// 所有choice都应原样保留
+	texts := map[float64]string{}
+	for _, chunk := range writer.chunks {
+		data, ok := chunk.Data.(map[string]interface{})
+		if !ok {
+			t.Fatalf("同格式透传的chunk应为原始JSON对象, got %T", chunk.Data)
+		}
+		choices, _ := data["choices"].([]interface{})
+		for _, item := range choices {
+			choice := item.(map[string]interface{})
+			delta, _ := choice["delta"].(map[string]interface{})
+			content, _ := delta["content"].(string)
+			texts[choice["index"].(float64)] += content
+		}
+	}
+	if texts[0] != "AA2" || texts[1] != "BB2" {
+		t.Errorf("choice内容 = %v", texts)
+	}
+}
+
+func TestOpenAIToAnthropicStreamUsesFirstChoice(t *testing.T) {
+	manager := NewManager()
+	writer := &collectStreamWriter{}
+
+	if err := manager.ProcessStream(strings.NewReader(multiChoiceOpenAIStream), types.ProviderOpenAI, FormatAnthropic, writer); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	var text strings.Builder
+	for _, chunk := range writer.chunks {
+		if chunk.EventType != "content_block_delta" {
+			continue
+		}
+		data, _ := chunk.Data.(map[string]interface{})
+		delta, _ := data["delta"].(map[string]interface{})
+		if t, ok := delta["text"].(string); ok {
+			text.WriteString(t)
+		}
+	}
+	if text.String() != "AA2" {
+		t.Errorf("跨格式应只保留首个choice, got %q", text.String())
+	}
+}
+
+func TestOpenAIToAnthropicStreamToolCalls(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"Let me check."}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{\"tz\""}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":":\"CET\"}"}}]}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+
+	manager := NewManager()
+	writer := &collectStreamWriter{}
+	if err := manager.ProcessStream(strings.NewReader(stream), types.ProviderOpenAI, FormatAnthropic, writer); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	// 按内容块index重建各块，并检查开始/结束事件成对且按顺序出现
+	type block struct {
+		blockType, id, name string
+		input               strings.Builder
+		stopped             bool
+	}
+	var blocks []*block
+	for _, chunk := range writer.chunks {
+		data, _ := chunk.Data.(map[string]interface{})
+		index, _ := data["index"].(int)
+		switch chunk.EventType {
+		case "content_block_start":
+			if index != len(blocks) {
+				t.Fatalf("content_block_start index = %d, want %d", index, len(blocks))
+			}
+			if len(blocks) > 0 && !blocks[len(blocks)-1].stopped {
+				t.Fatalf("内容块%d开始前上一个块未结束", index)
+			}
+			contentBlock, _ := data["content_block"].(map[string]interface{})
+			b := &block{blockType: getString(contentBlock["type"]), id: getString(contentBlock["id"]), name: getString(contentBlock["name"])}
+			blocks = append(blocks, b)
+		case "content_block_delta":
+			if index >= len(blocks) || blocks[index].stopped {
+				t.Fatalf("内容块%d未开始或已结束时收到delta", index)
+			}
+			delta, _ := data["delta"].(map[string]interface{})
+			switch delta["type"] {
+			case "text_delta":
+				blocks[index].input.WriteString(getString(delta["text"]))
+			case "input_json_delta":
+				blocks[index].input.WriteString(getString(delta["partial_json"]))
+			}
+		case "content_block_stop":
+			if index >= len(blocks) {
+				t.Fatalf("内容块%d未开始就结束", index)
+			}
+			blocks[index].stopped = true
+		}
+	}
+
+	want := []struct{ blockType, id, name, input string }{
+		{"text", "", "", "Let me check."},
+		{"tool_use", "call_1", "get_weather", `{"city":"Paris"}`},
+		{"tool_use", "call_2", "get_time", `{"tz":"CET"}`},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("内容块数 = %d, want %d", len(blocks), len(want))
+	}
+	for i, w := range want {
+		b := blocks[i]
+		if b.blockType != w.blockType || b.id != w.id || b.name != w.name || b.input.String() != w.input || !b.stopped {
+			t.Errorf("内容块%d = {%s %s %s %s stopped=%v}, want %+v", i, b.blockType, b.id, b.name, b.input.String(), b.stopped, w)
+		}
+	}
+	if !writer.done {
+		t.Error("流应以WriteDone结束")
+	}
+}
+
+func TestOpenAIToAnthropicStreamMessageDelta(t *testing.T) {
+	// finish_reason之后的chunk才携带用量（stream_options.include_usage）
+	stream := strings.Join([]string{
+		`data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"}}]}`,
+		`data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+		`data: {"id":"c1","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":4,"total_tokens":13}}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+
+	manager := NewManager()
+	writer := &collectStreamWriter{}
+	if err := manager.ProcessStream(strings.NewReader(stream), types.ProviderOpenAI, FormatAnthropic, writer); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	var eventTypes []string
+	for _, chunk := range writer.chunks {
+		eventTypes = append(eventTypes, chunk.EventType)
+	}
+	if n := len(eventTypes); n < 2 || eventTypes[n-2] != "message_delta" || eventTypes[n-1] != "message_stop" {
+		t.Fatalf("事件序列应以message_delta, message_stop结束: %v", eventTypes)
+	}
+
+	data, _ := writer.chunks[len(writer.chunks)-2].Data.(map[string]interface{})
+	delta, _ := data["delta"].(map[string]interface{})
+	if delta["stop_reason"] != "max_tokens" {
+		t.Errorf("stop_reason = %v, want max_tokens", delta["stop_reason"])
+	}
+	usage, _ := data["usage"].(map[string]interface{})
+	if usage["output_tokens"] != 4 || usage["input_tokens"] != 9 {
+		t.Errorf("usage = %v, want input_tokens=9 output_tokens=4", usage)
+	}
+	if !writer.done {
+		t.Error("流应以WriteDone结束")
+	}
+}
+
+func TestStreamUsageTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		provider types.Provider
+		client   Format
+		want     StreamUsage
+	}{
+		{"Anthropic透传", "testdata/stream/stream_anthropic_basic.txt", types.ProviderAnthropic, FormatAnthropic, StreamUsage{InputTokens: 25, OutputTokens: 15}},
+		{"Anthropic转OpenAI", "testdata/stream/stream_anthropic_basic.txt", types.ProviderAnthropic, FormatOpenAI, StreamUsage{InputTokens: 25, OutputTokens: 15}},
+		{"Anthropic工具调用透传", "testdata/stream/stream_anthropic_usage.txt", types.ProviderAnthropic, FormatAnthropic, StreamUsage{InputTokens: 472, OutputTokens: 89}},
+		{"Anthropic工具调用转OpenAI", "testdata/stream/stream_anthropic_usage.txt", types.ProviderAnthropic, FormatOpenAI, StreamUsage{InputTokens: 472, OutputTokens: 89}},
+		{"OpenAI透传", "testdata/stream/stream_openai_usage.txt", types.ProviderOpenAI, FormatOpenAI, StreamUsage{InputTokens: 12, OutputTokens: 4}},
+		{"OpenAI转Anthropic", "testdata/stream/stream_openai_usage.txt", types.ProviderOpenAI, FormatAnthropic, StreamUsage{InputTokens: 12, OutputTokens: 4}},
+		{"OpenAI无usage", "testdata/stream/stream_openai_basic.txt", types.ProviderOpenAI, FormatAnthropic, StreamUsage{}},
+		{"Gemini转OpenAI", "testdata/gemini/stream_basic.txt", types.ProviderGoogle, FormatOpenAI, StreamUsage{InputTokens: 5, OutputTokens: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(tt.fixture)
+			if err != nil {
+				t.Fatalf("读取测试数据失败: %v", err)
+			}
+
+			writer := &collectStreamWriter{}
+			if err := NewManager().ProcessStream(strings.NewReader(string(data)), tt.provider, tt.client, writer); err != nil {
+				t.Fatalf("ProcessStream() error = %v", err)
+			}
+			if writer.usage != tt.want {
+				t.Errorf("usage = %+v, want %+v", writer.usage, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamUsage_Merge(t *testing.T) {
+	var usage StreamUsage
+
+	// message_start: 输入token及初始输出token
+	usage.Merge(&StreamUsage{InputTokens: 472, OutputTokens: 2})
+	// message_delta报告的是累计值，多次出现时不能相加
+	usage.Merge(&StreamUsage{OutputTokens: 40})
+	usage.Merge(&StreamUsage{OutputTokens: 89})
+	usage.Merge(nil)
+
+	if want := (StreamUsage{InputTokens: 472, OutputTokens: 89}); usage != want {
+		t.Errorf("usage = %+v, want %+v", usage, want)
+	}
+}
+
+func TestSSEMalformedLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider types.Provider
+		client   Format
+		stream   string
+	}{
+		{
+			name:     "keepalive注释和event与data之间的空行",
+			provider: types.ProviderAnthropic,
+			client:   FormatOpenAI,
+			stream: ": keepalive\n\n" +
+				"event: message_start\n" +
+				": ping\n" +
+				`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-3-5-sonnet"}}` + "\n\n" +
+				"event: content_block_delta\n\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}` + "\n\n" +
+				":\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}` + "\n\n" +
+				"event: message_stop\n" +
+				`data: {"type":"message_stop"}` + "\n\n",
+		},
+		{
+			name:     "多行data拼接",
+			provider: types.ProviderAnthropic,
+			client:   FormatOpenAI,
+			stream: "event: message_start\n" +
+				`data: {"type":"message_start",` + "\n" +
+				`data: "message":{"id":"msg_1","model":"claude-3-5-sonnet"}}` + "\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,` + "\n" +
+				`data:"delta":{"type":"text_delta","text":"Hello"}}` + "\n\n" +
+				"event: content_block_delta\n" +
+				"id: 3\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" world"}}` + "\n\n" +
+				"event: message_stop\n" +
+				`data: {"type":"message_stop"}` + "\n\n",
+		},
+		{
+			name:     "同格式透传keepalive和多行data",
+			provider: types.ProviderOpenAI,
+			client:   FormatOpenAI,
+			stream: ": keepalive\n\n" +
+				`data: {"id":"c1","model":"gpt-4o",` + "\n" +
+				`data: "choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}` + "\n\n" +
+				": keepalive\n\n" +
+				`data: {"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":" world"}}]}` + "\n" +
+				`data: {"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n" +
+				"data: [DONE]\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &collectStreamWriter{}
+			if err := NewManager().ProcessStream(strings.NewReader(tt.stream), tt.provider, tt.client, writer); err != nil {
+				t.Fatalf("ProcessStream() error = %v", err)
+			}
+			if !writer.done {
+				t.Error("流结束时应调用WriteDone")
+			}
+
+			text := ""
+			for _, delta := range openAIDeltas(t, writer.chunks) {
+				content, _ := delta["content"].(string)
+				text += content
+			}
+			if text != "Hello world" {
+				t.Errorf("拼接的文本 = %q, want %q", text, "Hello world")
+			}
+		})
+	}
+}
@@ -93,10 +93,17 @@ func TestManagerUpstreamPath(t *testing.T) {
 			expectError:    false,
 		},
 		{
-			name:           "Google Provider (默认OpenAI格式)",
+			name:           "Google Provider (Gemini格式)",
 			provider:       types.ProviderGoogle,
 			clientEndpoint: "/v1/chat/completions",
-			expectedPath:   "/v1/chat/completions",
+			expectedPath:   "/v1beta/models/{model}:generateContent",
+			expectError:    false,
+		},
+		{
+			name:           "Azure Provider (部署路径)",
+			provider:       types.ProviderAzure,
+			clientEndpoint: "/v1/messages",
+			expectedPath:   "/openai/deployments/{deployment}/chat/completions",
 			expectError:    false,
 		},
 	}
@@ -121,3 +128,14 @@ func TestManagerUpstreamPath(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveAzurePath(t *testing.T) {
+	path := azureUpstreamPath("/v1/chat/completions")
+
+	if got := ResolveAzurePath(path, "prod gpt", "2024-10-21"); got != "/openai/deployments/prod%20gpt/chat/completions?api-version=2024-10-21" {
+		t.Errorf("ResolveAzurePath() = %s", got)
+	}
+	if got := ResolveAzurePath(path, "gpt-4o", ""); got != "/openai/deployments/gpt-4o/chat/completions?api-version="+DefaultAzureAPIVersion {
+		t.Errorf("未配置api-version时应使用默认版本: %s", got)
+	}
+}
@@ -0,0 +1,36 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+)
+
+// KeywordModerator 基于本地关键词规则的审核后端（大小写不敏感）
+type KeywordModerator struct {
+	keywords []string
+}
+
+// NewKeywordModerator 创建关键词审核后端
+func NewKeywordModerator(keywords []string) *KeywordModerator {
+	normalized := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" {
+			normalized = append(normalized, keyword)
+		}
+	}
+	return &KeywordModerator{keywords: normalized}
+}
+
+// Check 检查文本是否包含屏蔽关键词
+func (m *KeywordModerator) Check(ctx context.Context, text string) (*Result, error) {
+	lower := strings.ToLower(text)
+	result := &Result{}
+	for _, keyword := range m.keywords {
+		if strings.Contains(lower, keyword) {
+			result.Flagged = true
+			result.Categories = append(result.Categories, "keyword:"+keyword)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,121 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// 拦截策略
+const (
+	ActionReject = "reject" // 命中则拒绝请求
+	ActionLog    = "log"    // 命中仅记录日志，放行请求
+)
+
+// Result 内容审核结果
+type Result struct {
+	Flagged    bool
+	Categories []string // 命中的类别或规则
+}
+
+// Moderator 内容审核后端接口
+type Moderator interface {
+	Check(ctx context.Context, text string) (*Result, error)
+}
+
+// Checker 请求级内容审核器，封装后端与拦截策略
+type Checker struct {
+	moderator Moderator
+	action    string
+	failOpen  bool
+}
+
+// NewChecker 根据配置创建审核器，未启用时返回nil
+func NewChecker(cfg *types.ModerationConfig) (*Checker, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+
+	var moderator Moderator
+	switch cfg.Backend {
+	case "", "keywords":
+		moderator = NewKeywordModerator(cfg.BlockedKeywords)
+	case "openai":
+		if cfg.OpenAIAPIKey == "" {
+			return nil, fmt.Errorf("openai moderation后端需要配置openai_api_key")
+		}
+		moderator = NewOpenAIModerator(cfg.OpenAIBaseURL, cfg.OpenAIAPIKey, cfg.Model)
+	default:
+		return nil, fmt.Errorf("不支持的moderation后端: %s", cfg.Backend)
+	}
+
+	action := cfg.Action
+	if action == "" {
+		action = ActionReject
+	}
+	if action != ActionReject && action != ActionLog {
+		return nil, fmt.Errorf("不支持的moderation拦截策略: %s", cfg.Action)
+	}
+
+	return &Checker{
+		moderator: moderator,
+		action:    action,
+		failOpen:  cfg.FailOpen,
+	}, nil
+}
+
+// Decision 审核决策
+type Decision struct {
+	Blocked bool    // 是否拒绝请求
+	Result  *Result // 审核结果（后端出错时为nil）
+	Err     error   // 后端错误
+}
+
+// CheckRequest 审核请求中的全部文本内容
+func (c *Checker) CheckRequest(ctx context.Context, req *types.UnifiedRequest) *Decision {
+	text := ExtractText(req)
+	if strings.TrimSpace(text) == "" {
+		return &Decision{}
+	}
+
+	result, err := c.moderator.Check(ctx, text)
+	if err != nil {
+		// 后端不可用时根据 fail_open 决定放行或拒绝
+		return &Decision{Blocked: !c.failOpen, Err: err}
+	}
+
+	return &Decision{
+		Blocked: result.Flagged && c.action == ActionReject,
+		Result:  result,
+	}
+}
+
+// ExtractText 提取请求中需要审核的文本（system已在解析时并入消息列表）
+func ExtractText(req *types.UnifiedRequest) string {
+	if req == nil {
+		return ""
+	}
+
+	var parts []string
+
+	for _, msg := range req.Messages {
+		switch content := msg.Content.(type) {
+		case string:
+			parts = append(parts, content)
+		case []interface{}:
+			for _, item := range content {
+				block, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if text, ok := block["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,164 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func newRequest(texts ...interface{}) *types.UnifiedRequest {
+	req := &types.UnifiedRequest{Model: "gpt-4o"}
+	for _, text := range texts {
+		req.Messages = append(req.Messages, types.Message{Role: "user", Content: text})
+	}
+	return req
+}
+
+func TestExtractText(t *testing.T) {
+	req := newRequest(
+		"hello",
+		[]interface{}{
+			map[string]interface{}{"type": "text", "text": "world"},
+			map[string]interface{}{"type": "image", "source": map[string]interface{}{}},
+		},
+	)
+
+	if got := ExtractText(req); got != "hello\nworld" {
+		t.Errorf("ExtractText() = %q", got)
+	}
+}
+
+func TestChecker_Keywords(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		content     string
+		wantFlagged bool
+		wantBlocked bool
+	}{
+		{"未命中", "", "normal question", false, false},
+		{"命中拒绝", "", "how to make a BOMB", true, true},
+		{"命中仅记录", ActionLog, "how to make a bomb", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, err := NewChecker(&types.ModerationConfig{
+				Enabled:         true,
+				Action:          tt.action,
+				BlockedKeywords: []string{"bomb"},
+			})
+			if err != nil {
+				t.Fatalf("NewChecker() error = %v", err)
+			}
+
+			decision := checker.CheckRequest(context.Background(), newRequest(tt.content))
+			if decision.Err != nil {
+				t.Fatalf("CheckRequest() error = %v", decision.Err)
+			}
+			if decision.Result.Flagged != tt.wantFlagged || decision.Blocked != tt.wantBlocked {
+				t.Errorf("flagged=%v blocked=%v, want %v/%v", decision.Result.Flagged, decision.Blocked, tt.wantFlagged, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestChecker_OpenAI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/moderations" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Input string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		flagged := body.Input == "bad content"
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []interface{}{
+				map[string]interface{}{
+					"flagged":    flagged,
+					"categories": map[string]bool{"violence": flagged, "hate": false},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	checker, err := NewChecker(&types.ModerationConfig{
+		Enabled:       true,
+		Backend:       "openai",
+		OpenAIAPIKey:  "sk-test",
+		OpenAIBaseURL: server.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewChecker() error = %v", err)
+	}
+
+	decision := checker.CheckRequest(context.Background(), newRequest("bad content"))
+	if !decision.Blocked || len(decision.Result.Categories) != 1 || decision.Result.Categories[0] != "violence" {
+		t.Errorf("decision = %+v, result = %+v", decision, decision.Result)
+	}
+
+	decision = checker.CheckRequest(context.Background(), newRequest("good content"))
+	if decision.Blocked || decision.Result.Flagged {
+		t.Errorf("正常内容不应被拦截: %+v", decision.Result)
+	}
+}
+
+func TestChecker_BackendFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	for _, failOpen := range []bool{true, false} {
+		checker, _ := NewChecker(&types.ModerationConfig{
+			Enabled:       true,
+			Backend:       "openai",
+			OpenAIAPIKey:  "sk-test",
+			OpenAIBaseURL: server.URL,
+			FailOpen:      failOpen,
+		})
+
+		decision := checker.CheckRequest(context.Background(), newRequest("anything"))
+		if decision.Err == nil {
+			t.Fatal("后端失败时应返回错误")
+		}
+		if decision.Blocked == failOpen {
+			t.Errorf("fail_open=%v 时 blocked=%v", failOpen, decision.Blocked)
+		}
+	}
+}
+
+func TestNewChecker(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *types.ModerationConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{"默认关闭", &types.ModerationConfig{}, true, false},
+		{"openai缺少key", &types.ModerationConfig{Enabled: true, Backend: "openai"}, true, true},
+		{"未知后端", &types.ModerationConfig{Enabled: true, Backend: "custom"}, true, true},
+		{"未知策略", &types.ModerationConfig{Enabled: true, Action: "warn"}, true, true},
+		{"关键词后端", &types.ModerationConfig{Enabled: true, BlockedKeywords: []string{"x"}}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, err := NewChecker(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewChecker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (checker == nil) != tt.wantNil {
+				t.Errorf("NewChecker() = %v, wantNil %v", checker, tt.wantNil)
+			}
+		})
+	}
+}
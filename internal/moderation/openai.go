@@ -0,0 +1,100 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenAIModerator 调用OpenAI Moderation API的审核后端
+type OpenAIModerator struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// NewOpenAIModerator 创建OpenAI审核后端
+func NewOpenAIModerator(baseURL, apiKey, model string) *OpenAIModerator {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com"
+	}
+	if model == "" {
+		model = "omni-moderation-latest"
+	}
+	return &OpenAIModerator{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+			},
+		},
+	}
+}
+
+// Check 调用 /v1/moderations 审核文本
+func (m *OpenAIModerator) Check(ctx context.Context, text string) (*Result, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": m.model,
+		"input": text,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化moderation请求失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.baseURL+"/v1/moderations", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建moderation请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("调用moderation API失败: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取moderation响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation API返回错误 %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var moderationResp struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(respBody, &moderationResp); err != nil {
+		return nil, fmt.Errorf("解析moderation响应失败: %w", err)
+	}
+
+	result := &Result{}
+	for _, r := range moderationResp.Results {
+		if !r.Flagged {
+			continue
+		}
+		result.Flagged = true
+		for category, hit := range r.Categories {
+			if hit {
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	}
+	sort.Strings(result.Categories)
+
+	return result, nil
+}
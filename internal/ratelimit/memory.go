@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryEntry 内存计数项
+type memoryEntry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryStore 进程内配额存储，仅适用于单实例部署
+type MemoryStore struct {
+	mutex   sync.Mutex
+	entries map[string]*memoryEntry
+	now     func() time.Time
+}
+
+// NewMemoryStore 创建内存配额存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+		now:     time.Now,
+	}
+}
+
+// Incr 增加计数
+func (s *MemoryStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	entry, exists := s.entries[key]
+	if !exists || now.After(entry.expiresAt) {
+		s.cleanupUnsafe(now)
+		entry = &memoryEntry{expiresAt: now.Add(ttl)}
+		s.entries[key] = entry
+	}
+
+	entry.count += delta
+	return entry.count, nil
+}
+
+// Reserve 原子地检查并占用一组计数
+func (s *MemoryStore) Reserve(ctx context.Context, counters []Counter) ([]int64, int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	counts := make([]int64, len(counters))
+	for i, counter := range counters {
+		if entry, exists := s.entries[counter.Key]; exists && !now.After(entry.expiresAt) {
+			counts[i] = entry.count
+		}
+		if counts[i]+1 > counter.Limit {
+			return counts, i, nil
+		}
+	}
+
+	for i, counter := range counters {
+		entry, exists := s.entries[counter.Key]
+		if !exists || now.After(entry.expiresAt) {
+			entry = &memoryEntry{expiresAt: now.Add(counter.TTL)}
+			s.entries[counter.Key] = entry
+		}
+		entry.count++
+		counts[i] = entry.count
+	}
+	s.cleanupUnsafe(now)
+	return counts, -1, nil
+}
+
+// Get 获取当前计数
+func (s *MemoryStore) Get(ctx context.Context, key string) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.entries[key]
+	if !exists || s.now().After(entry.expiresAt) {
+		return 0, nil
+	}
+	return entry.count, nil
+}
+
+// Close 内存存储无需释放资源
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// cleanupUnsafe 清理已过期的计数项（调用方需持有锁）
+func (s *MemoryStore) cleanupUnsafe(now time.Time) {
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
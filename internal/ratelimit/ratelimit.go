@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// QuotaStore 配额计数存储接口
+// 多实例部署时使用共享后端（如Redis），保证所有实例看到同一份计数
+type QuotaStore interface {
+	// Incr 将key的计数加delta并返回新值；key首次创建时设置过期时间ttl
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Reserve 原子地为一组计数各加1：任一计数加1后超过其上限时不修改任何计数。
+	// 返回各计数的值（允许时为加1后的值）以及超限计数的下标，全部未超限时下标为-1
+	Reserve(ctx context.Context, counters []Counter) (counts []int64, rejected int, err error)
+	// Get 获取key当前计数，不存在时返回0
+	Get(ctx context.Context, key string) (int64, error)
+	// Close 释放存储资源
+	Close() error
+}
+
+// Counter 一个需要占用配额的计数
+type Counter struct {
+	Key   string
+	Limit int64         // 计数上限
+	TTL   time.Duration // key首次创建时设置的过期时间
+}
+
+// RateLimiter 限流器接口
+type RateLimiter interface {
+	// Allow 检查并占用一次请求配额，返回是否允许以及被触发的限制窗口
+	Allow(ctx context.Context, keyID string, limit *types.RateLimitConfig) (*Result, error)
+}
+
+// Result 限流检查结果
+type Result struct {
+	Allowed    bool
+	Window     string        // 触发限制的窗口: minute/hour/day
+	Limit      int           // 窗口内允许的请求数
+	Remaining  int           // 窗口内剩余请求数（取所有窗口的最小值）
+	RetryAfter time.Duration // 被拒绝时距离窗口重置的时间
+}
+
+// window 固定窗口定义
+type window struct {
+	name     string
+	duration time.Duration
+	limit    func(*types.RateLimitConfig) int
+}
+
+var windows = []window{
+	{"minute", time.Minute, func(c *types.RateLimitConfig) int { return c.RequestsPerMinute }},
+	{"hour", time.Hour, func(c *types.RateLimitConfig) int { return c.RequestsPerHour }},
+	{"day", 24 * time.Hour, func(c *types.RateLimitConfig) int { return c.RequestsPerDay }},
+}
+
+// WindowLimiter 基于QuotaStore的固定窗口限流器
+type WindowLimiter struct {
+	store  QuotaStore
+	prefix string
+	now    func() time.Time
+}
+
+// NewWindowLimiter 创建固定窗口限流器
+func NewWindowLimiter(store QuotaStore, prefix string) *WindowLimiter {
+	if prefix == "" {
+		prefix = "llm-gateway:ratelimit"
+	}
+	return &WindowLimiter{
+		store:  store,
+		prefix: prefix,
+		now:    time.Now,
+	}
+}
+
+// Allow 一次性检查分钟/小时/天窗口，任一窗口超限即拒绝。
+// 所有窗口在存储中原子地检查并计数，被拒绝的请求不占用任何窗口的配额
+func (l *WindowLimiter) Allow(ctx context.Context, keyID string, limit *types.RateLimitConfig) (*Result, error) {
+	result := &Result{Allowed: true, Remaining: -1}
+	if limit == nil {
+		return result, nil
+	}
+
+	now := l.now()
+	var active []window
+	var counters []Counter
+	for _, w := range windows {
+		max := w.limit(limit)
+		if max <= 0 {
+			continue
+		}
+		windowStart := now.Truncate(w.duration)
+		active = append(active, w)
+		counters = append(counters, Counter{
+			Key:   fmt.Sprintf("%s:%s:%s:%d", l.prefix, keyID, w.name, windowStart.Unix()),
+			Limit: int64(max),
+			TTL:   w.duration,
+		})
+	}
+	if len(counters) == 0 {
+		return result, nil
+	}
+
+	counts, rejected, err := l.store.Reserve(ctx, counters)
+	if err != nil {
+		return nil, fmt.Errorf("更新限流计数失败: %w", err)
+	}
+
+	if rejected >= 0 {
+		w := active[rejected]
+		result.Allowed = false
+		result.Window = w.name
+		result.Limit = int(counters[rejected].Limit)
+		result.Remaining = 0
+		result.RetryAfter = now.Truncate(w.duration).Add(w.duration).Sub(now)
+		return result, nil
+	}
+
+	for i, count := range counts {
+		remaining := int(counters[i].Limit - count)
+		if remaining < 0 {
+			remaining = 0
+		}
+		if result.Remaining < 0 || remaining < result.Remaining {
+			result.Remaining = remaining
+			result.Limit = int(counters[i].Limit)
+		}
+	}
+	return result, nil
+}
+
+// NewStoreFromConfig 根据配置创建配额存储
+func NewStoreFromConfig(cfg *types.RateLimitBackendConfig) (QuotaStore, error) {
+	if cfg == nil {
+		return NewMemoryStore(), nil
+	}
+
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("redis限流后端需要配置redis_addr")
+		}
+		return NewRedisStore(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB), nil
+	default:
+		return nil, fmt.Errorf("不支持的限流后端: %s", cfg.Backend)
+	}
+}
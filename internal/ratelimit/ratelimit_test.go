@@ -0,0 +1,386 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestMemoryStore_Incr(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := int64(1); i <= 3; i++ {
+		count, err := store.Incr(ctx, "k", 1, time.Minute)
+		if err != nil {
+			t.Fatalf("Incr() error = %v", err)
+		}
+		if count != i {
+			t.Errorf("Incr() = %d, want %d", count, i)
+		}
+	}
+
+	// 过期后重新计数
+	now = now.Add(2 * time.Minute)
+	if count, _ := store.Get(ctx, "k"); count != 0 {
+		t.Errorf("过期后 Get() = %d, want 0", count)
+	}
+	if count, _ := store.Incr(ctx, "k", 1, time.Minute); count != 1 {
+		t.Errorf("过期后 Incr() = %d, want 1", count)
+	}
+}
+
+func TestWindowLimiter_Allow(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       *types.RateLimitConfig
+		requests    int
+		wantAllowed int
+		wantWindow  string
+	}{
+		{"无限制配置", nil, 5, 5, ""},
+		{"分钟限制", &types.RateLimitConfig{RequestsPerMinute: 3}, 5, 3, "minute"},
+		{"小时限制更严格", &types.RateLimitConfig{RequestsPerMinute: 10, RequestsPerHour: 2}, 5, 2, "hour"},
+		{"天限制", &types.RateLimitConfig{RequestsPerDay: 1}, 3, 1, "day"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewWindowLimiter(NewMemoryStore(), "")
+			fixed := time.Date(2024, 1, 1, 10, 30, 15, 0, time.UTC)
+			limiter.now = func() time.Time { return fixed }
+
+			allowed := 0
+			var last *Result
+			for i := 0; i < tt.requests; i++ {
+				result, err := limiter.Allow(context.Background(), "gw_1", tt.limit)
+				if err != nil {
+					t.Fatalf("Allow() error = %v", err)
+				}
+				if result.Allowed {
+					allowed++
+				}
+				last = result
+			}
+
+			if allowed != tt.wantAllowed {
+				t.Errorf("允许请求数 = %d, want %d", allowed, tt.wantAllowed)
+			}
+			if tt.wantWindow != "" {
+				if last.Allowed || last.Window != tt.wantWindow {
+					t.Errorf("最后结果 = %+v, want window %s", last, tt.wantWindow)
+				}
+				if last.RetryAfter <= 0 {
+					t.Errorf("RetryAfter 应大于0, got %v", last.RetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestWindowLimiter_RejectionDoesNotConsumeQuota(t *testing.T) {
+	// 小时窗口拒绝时，分钟窗口不应被计数
+	limit := &types.RateLimitConfig{RequestsPerMinute: 3, RequestsPerHour: 2}
+	stores := map[string]func(t *testing.T) QuotaStore{
+		"memory": func(t *testing.T) QuotaStore { return NewMemoryStore() },
+		"redis": func(t *testing.T) QuotaStore {
+			server := newFakeRedis(t, "")
+			return NewRedisStore(server.listener.Addr().String(), "", 0)
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer func() { _ = store.Close() }()
+			limiter := NewWindowLimiter(store, "")
+			fixed := time.Date(2024, 1, 1, 10, 30, 15, 0, time.UTC)
+			limiter.now = func() time.Time { return fixed }
+			ctx := context.Background()
+
+			for i := 0; i < 5; i++ {
+				if _, err := limiter.Allow(ctx, "gw_1", limit); err != nil {
+					t.Fatalf("Allow() error = %v", err)
+				}
+			}
+
+			minuteKey := fmt.Sprintf("%s:gw_1:minute:%d", limiter.prefix, fixed.Truncate(time.Minute).Unix())
+			if count, err := store.Get(ctx, minuteKey); err != nil || count != 2 {
+				t.Errorf("分钟窗口计数 = %d, %v, want 2", count, err)
+			}
+
+			result, err := limiter.Allow(ctx, "gw_1", limit)
+			if err != nil {
+				t.Fatalf("Allow() error = %v", err)
+			}
+			if result.Allowed || result.Window != "hour" || result.Limit != 2 || result.Remaining != 0 {
+				t.Errorf("Allow() = %+v, want hour窗口拒绝", result)
+			}
+		})
+	}
+}
+
+func TestWindowLimiter_SharedStore(t *testing.T) {
+	// 两个实例共享同一存储时，配额应全局生效
+	store := NewMemoryStore()
+	limit := &types.RateLimitConfig{RequestsPerMinute: 4}
+	a := NewWindowLimiter(store, "")
+	b := NewWindowLimiter(store, "")
+
+	allowed := 0
+	for i := 0; i < 4; i++ {
+		for _, limiter := range []*WindowLimiter{a, b} {
+			result, _ := limiter.Allow(context.Background(), "gw_1", limit)
+			if result.Allowed {
+				allowed++
+			}
+		}
+	}
+	if allowed != 4 {
+		t.Errorf("共享存储下允许请求数 = %d, want 4", allowed)
+	}
+}
+
+func TestRedisStore_Pool(t *testing.T) {
+	// 并发请求应使用多条连接并行执行，且连接数不超过连接池大小
+	server := newFakeRedis(t, "")
+	server.getDelay = 50 * time.Millisecond
+	store := NewRedisStore(server.listener.Addr().String(), "", 0)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < redisPoolSize*2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.Get(ctx, "k"); err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	server.mutex.Lock()
+	maxInflight, conns := server.maxInflight, server.conns
+	server.mutex.Unlock()
+	if maxInflight < 2 {
+		t.Errorf("最大并发命令数 = %d, 命令不应被串行执行", maxInflight)
+	}
+	if conns > redisPoolSize {
+		t.Errorf("连接数 = %d, 不应超过连接池大小 %d", conns, redisPoolSize)
+	}
+
+	// 关闭后不再接受命令
+	if err := store.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "k"); err == nil {
+		t.Error("关闭后 Get() 应返回错误")
+	}
+}
+
+// fakeRedis 最小化的RESP服务端，支持EVAL(限流脚本)/GET/AUTH/SELECT
+type fakeRedis struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	data     map[string]int64
+	password string
+
+	getDelay    time.Duration // GET命令的处理延迟，用于观察并发
+	inflight    int
+	maxInflight int
+	conns       int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("启动fake redis失败: %v", err)
+	}
+	f := &fakeRedis{listener: listener, data: make(map[string]int64), password: password}
+	go f.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mutex.Lock()
+		f.conns++
+		f.mutex.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	reader := bufio.NewReader(conn)
+	authed := f.password == ""
+
+	for {
+		reply, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+
+		var resp string
+		switch {
+		case args[0] == "AUTH":
+			if args[1] == f.password {
+				authed = true
+				resp = "+OK\r\n"
+			} else {
+				resp = "-ERR invalid password\r\n"
+			}
+		case !authed:
+			resp = "-NOAUTH Authentication required\r\n"
+		case args[0] == "SELECT":
+			resp = "+OK\r\n"
+		case args[0] == "EVAL" && args[1] == reserveScript:
+			resp = f.reserve(args[2:])
+		case args[0] == "EVAL":
+			delta, _ := strconv.ParseInt(args[4], 10, 64)
+			f.mutex.Lock()
+			f.data[args[3]] += delta
+			value := f.data[args[3]]
+			f.mutex.Unlock()
+			resp = ":" + strconv.FormatInt(value, 10) + "\r\n"
+		case args[0] == "GET":
+			f.mutex.Lock()
+			f.inflight++
+			if f.inflight > f.maxInflight {
+				f.maxInflight = f.inflight
+			}
+			f.mutex.Unlock()
+			time.Sleep(f.getDelay)
+			f.mutex.Lock()
+			f.inflight--
+			value, ok := f.data[args[1]]
+			f.mutex.Unlock()
+			if !ok {
+				resp = "$-1\r\n"
+			} else {
+				s := strconv.FormatInt(value, 10)
+				resp = "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+			}
+		default:
+			resp = "-ERR unknown command\r\n"
+		}
+		if _, err := conn.Write([]byte(resp)); err != nil {
+			return
+		}
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	store := NewRedisStore(server.listener.Addr().String(), "secret", 1)
+	defer func() { _ = store.Close() }()
+	ctx := context.Background()
+
+	if count, err := store.Get(ctx, "k"); err != nil || count != 0 {
+		t.Fatalf("Get() = %d, %v, want 0", count, err)
+	}
+
+	for i := int64(1); i <= 3; i++ {
+		count, err := store.Incr(ctx, "k", 1, time.Minute)
+		if err != nil {
+			t.Fatalf("Incr() error = %v", err)
+		}
+		if count != i {
+			t.Errorf("Incr() = %d, want %d", count, i)
+		}
+	}
+
+	if count, err := store.Get(ctx, "k"); err != nil || count != 3 {
+		t.Errorf("Get() = %d, %v, want 3", count, err)
+	}
+
+	t.Run("两个实例共享计数", func(t *testing.T) {
+		other := NewRedisStore(server.listener.Addr().String(), "secret", 1)
+		defer func() { _ = other.Close() }()
+		if count, err := other.Incr(ctx, "k", 1, time.Minute); err != nil || count != 4 {
+			t.Errorf("Incr() = %d, %v, want 4", count, err)
+		}
+	})
+
+	t.Run("密码错误", func(t *testing.T) {
+		bad := NewRedisStore(server.listener.Addr().String(), "wrong", 0)
+		if _, err := bad.Incr(ctx, "k", 1, time.Minute); err == nil {
+			t.Error("密码错误时应返回错误")
+		}
+	})
+}
+
+// reserve 模拟reserveScript：全部key未超限时才各加1
+func (f *fakeRedis) reserve(args []string) string {
+	numKeys, _ := strconv.Atoi(args[0])
+	keys, argv := args[1:1+numKeys], args[1+numKeys:]
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	rejected := 0
+	counts := make([]int64, numKeys)
+	for i, key := range keys {
+		counts[i] = f.data[key]
+		limit, _ := strconv.ParseInt(argv[i*2], 10, 64)
+		if counts[i]+1 > limit {
+			rejected = i + 1
+			break
+		}
+	}
+	if rejected == 0 {
+		for i, key := range keys {
+			f.data[key]++
+			counts[i] = f.data[key]
+		}
+	}
+
+	resp := "*" + strconv.Itoa(numKeys+1) + "\r\n:" + strconv.Itoa(rejected) + "\r\n"
+	for _, count := range counts {
+		resp += ":" + strconv.FormatInt(count, 10) + "\r\n"
+	}
+	return resp
+}
+
+func TestNewStoreFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *types.RateLimitBackendConfig
+		wantErr bool
+	}{
+		{"默认内存", &types.RateLimitBackendConfig{}, false},
+		{"显式内存", &types.RateLimitBackendConfig{Backend: "memory"}, false},
+		{"redis", &types.RateLimitBackendConfig{Backend: "redis", RedisAddr: "127.0.0.1:6379"}, false},
+		{"redis缺少地址", &types.RateLimitBackendConfig{Backend: "redis"}, true},
+		{"未知后端", &types.RateLimitBackendConfig{Backend: "etcd"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewStoreFromConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewStoreFromConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
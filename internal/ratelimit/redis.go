@@ -0,0 +1,303 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// incrScript 原子地增加计数，并在首次创建时设置过期时间
+const incrScript = `local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if v == tonumber(ARGV[1]) then redis.call('PEXPIRE', KEYS[1], ARGV[2]) end
+return v`
+
+// reserveScript 原子地检查并占用多个计数：KEYS为各计数的key，ARGV依次为每个key的上限和过期时间（毫秒）。
+// 返回 {超限key的下标(从1开始，0表示未超限), 各key的计数...}，超限时不修改任何计数
+const reserveScript = `local counts = {}
+for i, key in ipairs(KEYS) do
+  local current = tonumber(redis.call('GET', key) or '0')
+  counts[i] = current
+  if current + 1 > tonumber(ARGV[i * 2 - 1]) then
+    return {i, unpack(counts)}
+  end
+end
+for i, key in ipairs(KEYS) do
+  local v = redis.call('INCR', key)
+  if v == 1 then redis.call('PEXPIRE', key, ARGV[i * 2]) end
+  counts[i] = v
+end
+return {0, unpack(counts)}`
+
+// redisPoolSize Redis连接池大小，同时最多使用的连接数
+const redisPoolSize = 8
+
+// RedisStore 基于Redis的配额存储，供多个Gateway实例共享计数
+// 内置最小化的RESP客户端和连接池，避免引入额外依赖
+type RedisStore struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	slots  chan struct{} // 限制同时使用的连接数
+	mutex  sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+// redisConn 一条已完成认证/选库的Redis连接
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisStore 创建Redis配额存储（连接在首次使用时建立）
+func NewRedisStore(addr, password string, db int) *RedisStore {
+	return &RedisStore{
+		addr:     addr,
+		password: password,
+		db:       db,
+		timeout:  3 * time.Second,
+		slots:    make(chan struct{}, redisPoolSize),
+	}
+}
+
+// Incr 增加计数
+func (s *RedisStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	reply, err := s.do(ctx, "EVAL", incrScript, "1", key, strconv.FormatInt(delta, 10), strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	count, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis返回了非预期的结果: %v", reply)
+	}
+	return count, nil
+}
+
+// Reserve 在一次EVAL中原子地检查并占用一组计数
+func (s *RedisStore) Reserve(ctx context.Context, counters []Counter) ([]int64, int, error) {
+	args := []string{"EVAL", reserveScript, strconv.Itoa(len(counters))}
+	for _, counter := range counters {
+		args = append(args, counter.Key)
+	}
+	for _, counter := range counters {
+		args = append(args, strconv.FormatInt(counter.Limit, 10), strconv.FormatInt(counter.TTL.Milliseconds(), 10))
+	}
+
+	reply, err := s.do(ctx, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, 0, fmt.Errorf("redis返回了非预期的结果: %v", reply)
+	}
+	values := make([]int64, len(items))
+	for i, item := range items {
+		if values[i], ok = item.(int64); !ok {
+			return nil, 0, fmt.Errorf("redis返回了非预期的结果: %v", reply)
+		}
+	}
+
+	counts := make([]int64, len(counters))
+	copy(counts, values[1:])
+	return counts, int(values[0]) - 1, nil
+}
+
+// Get 获取当前计数
+func (s *RedisStore) Get(ctx context.Context, key string) (int64, error) {
+	reply, err := s.do(ctx, "GET", key)
+	if err != nil {
+		return 0, err
+	}
+	if reply == nil {
+		return 0, nil
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return 0, fmt.Errorf("redis返回了非预期的结果: %v", reply)
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Close 关闭连接池中的所有连接，正在使用的连接归还时关闭
+func (s *RedisStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	var firstErr error
+	for _, c := range s.idle {
+		if err := c.conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.idle = nil
+	return firstErr
+}
+
+// do 从连接池取一条连接执行命令，连接异常时丢弃该连接
+func (s *RedisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.slots }()
+
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.roundTrip(ctx, s.timeout, args...)
+	if err != nil {
+		if _, isRedisErr := err.(redisError); !isRedisErr {
+			_ = c.conn.Close()
+			return nil, err
+		}
+	}
+	s.release(c)
+	return reply, err
+}
+
+// acquire 取出一条空闲连接，没有空闲连接时新建
+func (s *RedisStore) acquire(ctx context.Context) (*redisConn, error) {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil, fmt.Errorf("redis存储已关闭")
+	}
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mutex.Unlock()
+		return c, nil
+	}
+	s.mutex.Unlock()
+
+	return s.dial(ctx)
+}
+
+// release 将连接放回连接池，存储已关闭时直接关闭连接
+func (s *RedisStore) release(c *redisConn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		_ = c.conn.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// dial 建立连接并完成认证/选库
+func (s *RedisStore) dial(ctx context.Context) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接redis失败: %w", err)
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if s.password != "" {
+		if _, err := c.roundTrip(ctx, s.timeout, "AUTH", s.password); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("redis认证失败: %w", err)
+		}
+	}
+	if s.db != 0 {
+		if _, err := c.roundTrip(ctx, s.timeout, "SELECT", strconv.Itoa(s.db)); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("redis选择数据库失败: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// roundTrip 发送命令并读取回复
+func (c *redisConn) roundTrip(ctx context.Context, timeout time.Duration, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = c.conn.SetDeadline(deadline)
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(cmd.String())); err != nil {
+		return nil, fmt.Errorf("发送redis命令失败: %w", err)
+	}
+
+	return readReply(c.reader)
+}
+
+// redisError Redis服务端返回的错误（连接本身仍可用）
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis错误: " + string(e)
+}
+
+// readReply 读取一个RESP回复
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("读取redis回复失败: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis回复为空")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("无效的redis回复: %s", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, fmt.Errorf("读取redis回复失败: %w", err)
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("无效的redis回复: %s", line)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := readReply(reader)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("无效的redis回复: %s", line)
+	}
+}
@@ -0,0 +1,145 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// 熔断默认参数
+const (
+	DefaultCircuitErrorThreshold = 5
+	DefaultCircuitCooldown       = 30 * time.Second
+)
+
+// circuitBreaker 上游账号熔断器。连续错误数记录在账号的UpstreamUsageStats中，
+// 达到阈值且最近一次错误仍在冷却期内时熔断；冷却结束后进入半开状态，只放行一个探测请求，
+// 探测成功时连续错误数清零恢复，失败时最近错误时间更新而重新熔断
+type circuitBreaker struct {
+	threshold int                  // 连续错误阈值，<=0表示不熔断
+	cooldown  time.Duration        // 熔断冷却时长
+	probes    map[string]time.Time // 半开状态下探测请求的发出时间，按账号ID
+}
+
+// newCircuitBreaker 使用默认参数创建熔断器
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		threshold: DefaultCircuitErrorThreshold,
+		cooldown:  DefaultCircuitCooldown,
+		probes:    make(map[string]time.Time),
+	}
+}
+
+// configure 应用熔断配置，未设置的值使用默认值
+func (b *circuitBreaker) configure(config types.CircuitBreakerConfig) {
+	b.threshold = DefaultCircuitErrorThreshold
+	if config.ErrorThreshold != 0 {
+		b.threshold = config.ErrorThreshold
+	}
+	b.cooldown = DefaultCircuitCooldown
+	if config.CooldownSeconds > 0 {
+		b.cooldown = time.Duration(config.CooldownSeconds) * time.Second
+	}
+}
+
+// tripped 判断账号连续错误数是否已达到熔断阈值
+func (b *circuitBreaker) tripped(account *types.UpstreamAccount) bool {
+	return b.threshold > 0 && account.Usage != nil && account.Usage.ConsecutiveErrors >= int64(b.threshold)
+}
+
+// halfOpen 判断已熔断的账号是否已过冷却期
+func (b *circuitBreaker) halfOpen(account *types.UpstreamAccount, now time.Time) bool {
+	lastError := account.Usage.LastErrorAt
+	return lastError == nil || !now.Before(lastError.Add(b.cooldown))
+}
+
+// allow 判断账号能否参与本次选择：未熔断的账号直接放行；半开状态下没有进行中的探测时放行一个探测请求。
+// 探测请求迟迟没有结果（如客户端参数错误不计入统计）时，超过冷却时长后允许再次探测
+func (b *circuitBreaker) allow(account *types.UpstreamAccount, now time.Time) bool {
+	if !b.tripped(account) {
+		return true
+	}
+	if !b.halfOpen(account, now) {
+		return false
+	}
+	probeAt, probing := b.probes[account.ID]
+	return !probing || !now.Before(probeAt.Add(b.cooldown))
+}
+
+// onSelected 半开状态的账号被选中时记录探测请求
+func (b *circuitBreaker) onSelected(account *types.UpstreamAccount, now time.Time) {
+	if b.tripped(account) {
+		b.probes[account.ID] = now
+	}
+}
+
+// onResult 账号请求有了结果，结束进行中的探测
+func (b *circuitBreaker) onResult(upstreamID string) {
+	delete(b.probes, upstreamID)
+}
+
+// SetCircuitBreaker 设置上游账号熔断参数
+func (r *RequestRouter) SetCircuitBreaker(config types.CircuitBreakerConfig) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.breaker.configure(config)
+}
+
+// ReleaseUpstream 记录账号的一个上游请求已结束，释放选择账号时预留的进行中请求名额
+func (r *RequestRouter) ReleaseUpstream(upstreamID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.releaseLocked(upstreamID)
+}
+
+// CancelUpstream 选中的账号最终未被使用（没有发出请求）时调用：释放进行中请求名额，
+// 并撤销半开状态下为其记录的探测，使该账号能立即被下一个请求用作探测
+func (r *RequestRouter) CancelUpstream(upstreamID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.releaseLocked(upstreamID)
+	r.breaker.onResult(upstreamID)
+}
+
+// releaseLocked 释放账号的一个进行中请求名额（调用方需持有锁）
+func (r *RequestRouter) releaseLocked(upstreamID string) {
+	if r.inFlight[upstreamID] <= 1 {
+		delete(r.inFlight, upstreamID)
+		return
+	}
+	r.inFlight[upstreamID]--
+}
+
+// filterAvailableAccounts 过滤掉熔断中和进行中请求数已达max_in_flight上限的账号（调用方需持有锁），
+// 返回可用账号和跳过原因
+func (r *RequestRouter) filterAvailableAccounts(accounts []*types.UpstreamAccount, now time.Time) ([]*types.UpstreamAccount, string) {
+	available := make([]*types.UpstreamAccount, 0, len(accounts))
+	var open, busy []string
+	for _, account := range accounts {
+		switch {
+		case !r.breaker.allow(account, now):
+			open = append(open, account.ID)
+		case account.MaxInFlight > 0 && r.inFlight[account.ID] >= account.MaxInFlight:
+			busy = append(busy, account.ID)
+		default:
+			available = append(available, account)
+		}
+	}
+
+	var notes []string
+	if len(open) > 0 {
+		notes = append(notes, "熔断中: "+strings.Join(open, ","))
+	}
+	if len(busy) > 0 {
+		notes = append(notes, "并发已满: "+strings.Join(busy, ","))
+	}
+	if len(notes) == 0 {
+		return available, ""
+	}
+	return available, fmt.Sprintf("跳过%s", strings.Join(notes, "; "))
+}
@@ -0,0 +1,187 @@
+package router
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/config"
+	"github.com/iBreaker/llm-gateway/internal/upstream"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestCircuitBreaker_SkipsAndReadmits(t *testing.T) {
+	r := newTestRouter(t, StrategyRoundRobin)
+	r.SetCircuitBreaker(types.CircuitBreakerConfig{ErrorThreshold: 2})
+	r.breaker.cooldown = 50 * time.Millisecond
+
+	// 未达到阈值时仍参与选择
+	r.MarkUpstreamError("a", fmt.Errorf("upstream 500"))
+	if _, counts := selectN(t, r, 6); counts["a"] == 0 {
+		t.Fatalf("连续错误未达阈值时不应熔断, counts = %v", counts)
+	}
+
+	// 达到阈值后熔断，冷却期内跳过
+	r.MarkUpstreamError("a", fmt.Errorf("upstream 500"))
+	r.MarkUpstreamError("a", fmt.Errorf("upstream 500"))
+	if _, counts := selectN(t, r, 6); counts["a"] != 0 {
+		t.Fatalf("熔断中的账号不应被选中, counts = %v", counts)
+	}
+	_, selection, err := r.SelectUpstreamWithReason(types.ProviderOpenAI, types.DefaultTenant, nil)
+	if err != nil {
+		t.Fatalf("SelectUpstreamWithReason() error = %v", err)
+	}
+	if !strings.Contains(selection.Reason, "熔断中: a") {
+		t.Errorf("选择依据应记录熔断跳过, got %q", selection.Reason)
+	}
+
+	// 冷却结束后半开：只放行一个探测请求
+	time.Sleep(60 * time.Millisecond)
+	_, counts := selectN(t, r, 6)
+	if counts["a"] != 1 {
+		t.Fatalf("半开状态应只放行一个探测请求, counts = %v", counts)
+	}
+
+	// 探测失败重新熔断
+	r.MarkUpstreamError("a", fmt.Errorf("upstream 500"))
+	if _, counts := selectN(t, r, 6); counts["a"] != 0 {
+		t.Fatalf("探测失败后应重新熔断, counts = %v", counts)
+	}
+
+	// 再次冷却后探测成功，恢复正常选择
+	time.Sleep(60 * time.Millisecond)
+	if _, counts := selectN(t, r, 3); counts["a"] != 1 {
+		t.Fatalf("冷却结束后应放行探测请求, counts = %v", counts)
+	}
+	r.MarkUpstreamSuccess("a", time.Millisecond, 10)
+	if _, counts := selectN(t, r, 6); counts["a"] != 2 {
+		t.Errorf("探测成功后应恢复轮询, counts = %v", counts)
+	}
+}
+
+func TestCircuitBreaker_CancelUpstreamEndsProbe(t *testing.T) {
+	r := newTestRouter(t, StrategyRoundRobin)
+	r.SetCircuitBreaker(types.CircuitBreakerConfig{ErrorThreshold: 1})
+	r.breaker.cooldown = 50 * time.Millisecond
+
+	r.MarkUpstreamError("a", fmt.Errorf("upstream 500"))
+	time.Sleep(60 * time.Millisecond)
+
+	// 半开状态下选中a作为探测，但最终没有向a发出请求（如换账号时类型不一致被跳过）
+	selectProbe := func() bool {
+		for i := 0; i < 3; i++ {
+			account, err := r.SelectUpstream(types.ProviderOpenAI)
+			if err != nil {
+				t.Fatalf("SelectUpstream() error = %v", err)
+			}
+			if account.ID == "a" {
+				return true
+			}
+			r.ReleaseUpstream(account.ID)
+		}
+		return false
+	}
+	if !selectProbe() {
+		t.Fatal("冷却结束后应放行探测请求")
+	}
+	r.CancelUpstream("a")
+
+	// 撤销后探测名额立即可用，而不是等待探测超时
+	if !selectProbe() {
+		t.Error("撤销未使用的探测后，账号应能再次被选作探测")
+	}
+	r.CancelUpstream("a")
+	if got := r.inFlight["a"]; got != 0 {
+		t.Errorf("撤销后进行中请求数 = %d, want 0", got)
+	}
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	r := newTestRouter(t, StrategyRoundRobin)
+	r.SetCircuitBreaker(types.CircuitBreakerConfig{ErrorThreshold: -1})
+
+	for i := 0; i < DefaultCircuitErrorThreshold*2; i++ {
+		r.MarkUpstreamError("a", fmt.Errorf("upstream 500"))
+	}
+	if _, counts := selectN(t, r, 6); counts["a"] == 0 {
+		t.Errorf("关闭熔断时账号应继续参与选择, counts = %v", counts)
+	}
+}
+
+func TestCircuitBreaker_AllOpen(t *testing.T) {
+	r := newTestRouter(t, StrategyHealthFirst)
+	r.SetCircuitBreaker(types.CircuitBreakerConfig{ErrorThreshold: 1})
+
+	for _, id := range []string{"a", "b", "c"} {
+		r.MarkUpstreamError(id, fmt.Errorf("upstream 500"))
+	}
+	if _, err := r.SelectUpstream(types.ProviderOpenAI); err == nil {
+		t.Error("全部账号熔断时应返回错误")
+	}
+}
+
+func TestSelectUpstream_MaxInFlight(t *testing.T) {
+	configMgr := config.NewConfigManager(filepath.Join(t.TempDir(), "config.yaml"))
+	if _, err := configMgr.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for id, maxInFlight := range map[string]int{"limited": 1, "unlimited": 0} {
+		err := configMgr.CreateUpstreamAccount(&types.UpstreamAccount{
+			ID:          id,
+			Name:        id,
+			Type:        types.UpstreamTypeAPIKey,
+			Provider:    types.ProviderOpenAI,
+			APIKey:      "sk-" + id,
+			Status:      "active",
+			MaxInFlight: maxInFlight,
+		})
+		if err != nil {
+			t.Fatalf("CreateUpstreamAccount() error = %v", err)
+		}
+	}
+	r := NewRequestRouter(upstream.NewUpstreamManager(configMgr), StrategyRoundRobin)
+
+	// 选中即预留名额：名额释放前，并发已满的账号不再被选中，不限制并发的账号不受影响
+	var held []string
+	counts := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		account, err := r.SelectUpstream(types.ProviderOpenAI)
+		if err != nil {
+			t.Fatalf("SelectUpstream() error = %v", err)
+		}
+		held = append(held, account.ID)
+		counts[account.ID]++
+	}
+	if counts["limited"] != 1 || counts["unlimited"] != 3 {
+		t.Errorf("并发已满的账号不应被选中, counts = %v", counts)
+	}
+
+	for _, id := range held {
+		r.ReleaseUpstream(id)
+	}
+	if _, counts := selectN(t, r, 4); counts["limited"] != 2 {
+		t.Errorf("请求结束后账号应恢复参与选择, counts = %v", counts)
+	}
+
+	// 并发选择时名额在选择的同时预留，不会有多个请求同时选中已满的账号
+	var wg sync.WaitGroup
+	var limited int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			account, err := r.SelectUpstream(types.ProviderOpenAI)
+			if err == nil && account.ID == "limited" {
+				atomic.AddInt32(&limited, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if limited > 1 {
+		t.Errorf("并发选择时max_in_flight=1的账号被选中%d次", limited)
+	}
+}
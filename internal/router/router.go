@@ -3,6 +3,7 @@ package router
 import (
 	"fmt"
 	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,112 +16,261 @@ import (
 type BalanceStrategy string
 
 const (
-	StrategyRoundRobin  BalanceStrategy = "round_robin"
-	StrategyRandom      BalanceStrategy = "random"
-	StrategyHealthFirst BalanceStrategy = "health_first"
+	StrategyRoundRobin  BalanceStrategy = types.LoadBalanceRoundRobin
+	StrategyRandom      BalanceStrategy = types.LoadBalanceRandom
+	StrategyHealthFirst BalanceStrategy = types.LoadBalanceHealthFirst
+	StrategyWeighted    BalanceStrategy = types.LoadBalanceWeighted
 )
 
 // RequestRouter 请求路由器
 type RequestRouter struct {
-	upstreamMgr *upstream.UpstreamManager
-	strategy    BalanceStrategy
-	rrIndex     map[types.Provider]int // Round Robin索引
-	mutex       sync.Mutex
+	upstreamMgr    *upstream.UpstreamManager
+	strategy       BalanceStrategy
+	rrIndex        map[string]int         // Round Robin索引，按租户和提供商区分
+	currentWeights map[string]int         // 平滑加权轮询的当前权重，按账号ID
+	inFlight       map[string]int         // 进行中的上游请求数，按账号ID
+	breaker        *circuitBreaker        // 上游账号熔断状态
+	mutex          sync.Mutex
 }
 
-// NewRequestRouter 创建新的请求路由器
+// NewRequestRouter 创建新的请求路由器，策略为空时使用health_first
 func NewRequestRouter(upstreamMgr *upstream.UpstreamManager, strategy BalanceStrategy) *RequestRouter {
+	if strategy == "" {
+		strategy = StrategyHealthFirst
+	}
 	return &RequestRouter{
-		upstreamMgr: upstreamMgr,
-		strategy:    strategy,
-		rrIndex:     make(map[types.Provider]int),
+		upstreamMgr:    upstreamMgr,
+		strategy:       strategy,
+		rrIndex:        make(map[string]int),
+		currentWeights: make(map[string]int),
+		inFlight:       make(map[string]int),
+		breaker:        newCircuitBreaker(),
 	}
 }
 
-// SelectUpstream 选择上游账号
+// SelectUpstream 选择默认租户的上游账号
 func (r *RequestRouter) SelectUpstream(provider types.Provider) (*types.UpstreamAccount, error) {
+	return r.SelectUpstreamForTenant(provider, types.DefaultTenant)
+}
+
+// SelectUpstreamForTenant 在指定租户的活跃账号中选择上游账号，其他租户的账号不参与选择
+func (r *RequestRouter) SelectUpstreamForTenant(provider types.Provider, tenant string) (*types.UpstreamAccount, error) {
+	return r.SelectUpstreamExcluding(provider, tenant, nil)
+}
+
+// Selection 一次上游选择的决策信息，用于调试跟踪
+type Selection struct {
+	Strategy   BalanceStrategy
+	Candidates []string // 本租户参与选择的活跃账号ID
+	Chosen     string
+	Reason     string // 选中原因，包括被跳过的不健康账号
+}
+
+// SelectUpstreamExcluding 在指定租户的活跃账号中选择上游账号，跳过exclude中的账号ID（用于失败后换账号重试）
+func (r *RequestRouter) SelectUpstreamExcluding(provider types.Provider, tenant string, exclude map[string]bool) (*types.UpstreamAccount, error) {
+	account, _, err := r.SelectUpstreamWithReason(provider, tenant, exclude)
+	return account, err
+}
+
+// SelectUpstreamWithReason 与SelectUpstreamExcluding相同，同时返回候选账号与选择依据。
+// 选中的账号计入进行中请求数，调用方必须在请求结束后调用ReleaseUpstream
+func (r *RequestRouter) SelectUpstreamWithReason(provider types.Provider, tenant string, exclude map[string]bool) (*types.UpstreamAccount, *Selection, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	// 获取活跃的上游账号列表
-	accounts := r.upstreamMgr.ListActiveAccounts(provider)
+	// 获取本租户活跃的上游账号列表
+	tenant = types.NormalizeTenant(tenant)
+	accounts := filterTenantAccounts(r.upstreamMgr.ListActiveAccounts(provider), tenant, exclude)
+	selection := &Selection{Strategy: r.strategy, Candidates: accountIDs(accounts)}
 	if len(accounts) == 0 {
-		return nil, fmt.Errorf("没有可用的%s上游账号", provider)
+		if tenant != types.DefaultTenant {
+			return nil, selection, fmt.Errorf("租户%s没有可用的%s上游账号", tenant, provider)
+		}
+		return nil, selection, fmt.Errorf("没有可用的%s上游账号", provider)
+	}
+
+	// 跳过熔断中和并发已满的账号
+	now := time.Now()
+	accounts, skipNote := r.filterAvailableAccounts(accounts, now)
+	if len(accounts) == 0 {
+		return nil, selection, fmt.Errorf("%s上游账号暂不可用: %s", provider, skipNote)
 	}
 
+	poolKey := tenant + "/" + string(provider)
+	var selected *types.UpstreamAccount
+	var reason string
 	switch r.strategy {
 	case StrategyRoundRobin:
-		return r.selectRoundRobin(provider, accounts)
-	case StrategyRandom:
-		return r.selectRandom(accounts)
+		selected, reason = r.selectRoundRobin(poolKey, accounts)
 	case StrategyHealthFirst:
-		return r.selectHealthFirst(accounts)
+		selected, reason = r.selectHealthFirst(poolKey, accounts)
+	case StrategyWeighted:
+		selected, reason = r.selectWeighted(accounts)
 	default:
-		return r.selectRandom(accounts)
+		selected, reason = r.selectRandom(accounts)
 	}
+
+	if len(exclude) > 0 {
+		reason += fmt.Sprintf("; 已排除失败账号: %s", strings.Join(excludedIDs(exclude), ","))
+	}
+	if skipNote != "" {
+		reason += "; " + skipNote
+	}
+	r.breaker.onSelected(selected, now)
+	// 在同一把锁内预留进行中请求名额，避免并发请求在计数前选中同一个已满的账号
+	r.inFlight[selected.ID]++
+	selection.Chosen = selected.ID
+	selection.Reason = reason
+	return selected, selection, nil
 }
 
 // selectRoundRobin 轮询选择
-func (r *RequestRouter) selectRoundRobin(provider types.Provider, accounts []*types.UpstreamAccount) (*types.UpstreamAccount, error) {
-	index := r.rrIndex[provider]
+func (r *RequestRouter) selectRoundRobin(poolKey string, accounts []*types.UpstreamAccount) (*types.UpstreamAccount, string) {
+	index := r.rrIndex[poolKey]
 	if index >= len(accounts) {
 		index = 0
 	}
 
 	selected := accounts[index]
-	r.rrIndex[provider] = (index + 1) % len(accounts)
+	r.rrIndex[poolKey] = (index + 1) % len(accounts)
 
-	return selected, nil
+	return selected, fmt.Sprintf("轮询: 第%d/%d个候选", index+1, len(accounts))
 }
 
 // selectRandom 随机选择
-func (r *RequestRouter) selectRandom(accounts []*types.UpstreamAccount) (*types.UpstreamAccount, error) {
+func (r *RequestRouter) selectRandom(accounts []*types.UpstreamAccount) (*types.UpstreamAccount, string) {
 	index := rand.Intn(len(accounts))
-	return accounts[index], nil
+	return accounts[index], fmt.Sprintf("随机: 第%d/%d个候选", index+1, len(accounts))
 }
 
 // selectHealthFirst 优先选择健康的账号，在所有可用账号间轮询
-func (r *RequestRouter) selectHealthFirst(accounts []*types.UpstreamAccount) (*types.UpstreamAccount, error) {
-	// 过滤出可用的账号（非unhealthy状态）
-	availableAccounts := make([]*types.UpstreamAccount, 0)
-	
+func (r *RequestRouter) selectHealthFirst(poolKey string, accounts []*types.UpstreamAccount) (*types.UpstreamAccount, string) {
+	availableAccounts := filterHealthyAccounts(accounts)
+
+	// 在可用账号中轮询选择
+	index := r.rrIndex[poolKey]
+	if index >= len(availableAccounts) {
+		index = 0
+	}
+	selected := availableAccounts[index]
+	r.rrIndex[poolKey] = (index + 1) % len(availableAccounts)
+
+	reason := fmt.Sprintf("健康优先轮询: 第%d/%d个可用账号", index+1, len(availableAccounts))
+	return selected, reason + healthSkipNote(accounts)
+}
+
+// selectWeighted 平滑加权轮询：每轮各账号累加自身权重，选出当前权重最大者并减去总权重，
+// 使选择次数与权重成正比且分布均匀（不会连续集中在高权重账号上）
+func (r *RequestRouter) selectWeighted(accounts []*types.UpstreamAccount) (*types.UpstreamAccount, string) {
+	availableAccounts := filterHealthyAccounts(accounts)
+
+	var selected *types.UpstreamAccount
+	totalWeight := 0
+	for _, account := range availableAccounts {
+		weight := account.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		totalWeight += weight
+		r.currentWeights[account.ID] += weight
+		if selected == nil || r.currentWeights[account.ID] > r.currentWeights[selected.ID] {
+			selected = account
+		}
+	}
+
+	r.currentWeights[selected.ID] -= totalWeight
+	weight := selected.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	reason := fmt.Sprintf("加权轮询: 权重%d/总权重%d", weight, totalWeight)
+	return selected, reason + healthSkipNote(accounts)
+}
+
+// healthSkipNote 描述健康检查对候选账号的影响，没有不健康账号时返回空字符串
+func healthSkipNote(accounts []*types.UpstreamAccount) string {
+	var unhealthy []string
 	for _, account := range accounts {
-		// 接受 healthy, unknown, 空状态，拒绝 unhealthy
-		if account.HealthStatus != "unhealthy" {
-			availableAccounts = append(availableAccounts, account)
+		if account.HealthStatus == "unhealthy" {
+			unhealthy = append(unhealthy, account.ID)
 		}
 	}
+	switch {
+	case len(unhealthy) == 0:
+		return ""
+	case len(unhealthy) == len(accounts):
+		return "; 全部账号不健康，在所有账号中选择"
+	default:
+		return "; 跳过不健康账号: " + strings.Join(unhealthy, ",")
+	}
+}
 
-	// 如果没有可用账号，使用所有账号（包括unhealthy）
-	if len(availableAccounts) == 0 {
-		availableAccounts = accounts
+// accountIDs 返回账号ID列表
+func accountIDs(accounts []*types.UpstreamAccount) []string {
+	ids := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		ids = append(ids, account.ID)
 	}
+	return ids
+}
 
-	// 在可用账号中轮询选择
-	if len(availableAccounts) > 0 {
-		provider := availableAccounts[0].Provider
-		index := r.rrIndex[provider]
-		if index >= len(availableAccounts) {
-			index = 0
+// excludedIDs 返回排除集合中的账号ID，按字典序排列
+func excludedIDs(exclude map[string]bool) []string {
+	ids := make([]string, 0, len(exclude))
+	for id, excluded := range exclude {
+		if excluded {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// filterTenantAccounts 过滤出属于指定租户且不在exclude中的账号
+func filterTenantAccounts(accounts []*types.UpstreamAccount, tenant string, exclude map[string]bool) []*types.UpstreamAccount {
+	tenantAccounts := make([]*types.UpstreamAccount, 0, len(accounts))
+	for _, account := range accounts {
+		if account.TenantID() == tenant && !exclude[account.ID] {
+			tenantAccounts = append(tenantAccounts, account)
 		}
-		selected := availableAccounts[index]
-		r.rrIndex[provider] = (index + 1) % len(availableAccounts)
-		return selected, nil
 	}
+	return tenantAccounts
+}
 
-	return nil, fmt.Errorf("没有可用的上游账号")
+// filterHealthyAccounts 过滤掉unhealthy状态的账号（healthy、unknown、空状态均视为可用），全部不健康时返回所有账号
+func filterHealthyAccounts(accounts []*types.UpstreamAccount) []*types.UpstreamAccount {
+	availableAccounts := make([]*types.UpstreamAccount, 0, len(accounts))
+	for _, account := range accounts {
+		if account.HealthStatus != "unhealthy" {
+			availableAccounts = append(availableAccounts, account)
+		}
+	}
+	if len(availableAccounts) == 0 {
+		return accounts
+	}
+	return availableAccounts
 }
 
 // MarkUpstreamError 标记上游账号错误
 func (r *RequestRouter) MarkUpstreamError(upstreamID string, err error) {
 	_ = r.upstreamMgr.UpdateAccountHealth(upstreamID, false)
 	_ = r.upstreamMgr.RecordError(upstreamID, err)
+	r.endProbe(upstreamID)
 }
 
 // MarkUpstreamSuccess 标记上游账号成功
 func (r *RequestRouter) MarkUpstreamSuccess(upstreamID string, latency time.Duration, tokensUsed int64) {
 	_ = r.upstreamMgr.UpdateAccountHealth(upstreamID, true)
 	_ = r.upstreamMgr.RecordSuccess(upstreamID, latency, tokensUsed)
+	r.endProbe(upstreamID)
+}
+
+// endProbe 账号统计更新后结束半开状态的探测，之后按新的连续错误数判断熔断状态
+func (r *RequestRouter) endProbe(upstreamID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.breaker.onResult(upstreamID)
 }
 
 // GetUpstreamStats 获取上游账号统计信息
@@ -137,6 +287,14 @@ func (r *RequestRouter) GetUpstreamStats() map[string]*types.UpstreamUsageStats
 	return stats
 }
 
+// Strategy 获取当前负载均衡策略
+func (r *RequestRouter) Strategy() BalanceStrategy {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.strategy
+}
+
 // SetStrategy 设置负载均衡策略
 func (r *RequestRouter) SetStrategy(strategy BalanceStrategy) {
 	r.mutex.Lock()
@@ -165,6 +323,10 @@ func (r *RequestRouter) DetermineProvider(model string) types.Provider {
 	if strings.Contains(model, "qwen") {
 		return types.ProviderQwen
 	}
+	// OpenAI向量嵌入模型，如text-embedding-3-small、text-embedding-ada-002
+	if strings.HasPrefix(model, "text-embedding-") {
+		return types.ProviderOpenAI
+	}
 
 	// 默认使用Anthropic
 	return types.ProviderAnthropic
@@ -0,0 +1,176 @@
+package router
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/internal/config"
+	"github.com/iBreaker/llm-gateway/internal/upstream"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// newTestRouter 创建包含三个同提供商账号（权重 1/2/3）的路由器
+func newTestRouter(t *testing.T, strategy BalanceStrategy) *RequestRouter {
+	t.Helper()
+	configMgr := config.NewConfigManager(filepath.Join(t.TempDir(), "config.yaml"))
+	if _, err := configMgr.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	for i, id := range []string{"a", "b", "c"} {
+		err := configMgr.CreateUpstreamAccount(&types.UpstreamAccount{
+			ID:       id,
+			Name:     id,
+			Type:     types.UpstreamTypeAPIKey,
+			Provider: types.ProviderOpenAI,
+			APIKey:   "sk-" + id,
+			Status:   "active",
+			Weight:   i + 1,
+		})
+		if err != nil {
+			t.Fatalf("CreateUpstreamAccount() error = %v", err)
+		}
+	}
+	return NewRequestRouter(upstream.NewUpstreamManager(configMgr), strategy)
+}
+
+// selectN 连续选择n次，返回选择序列和各账号被选中次数
+func selectN(t *testing.T, r *RequestRouter, n int) ([]string, map[string]int) {
+	t.Helper()
+	var sequence []string
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		account, err := r.SelectUpstream(types.ProviderOpenAI)
+		if err != nil {
+			t.Fatalf("SelectUpstream() error = %v", err)
+		}
+		sequence = append(sequence, account.ID)
+		counts[account.ID]++
+		r.ReleaseUpstream(account.ID)
+	}
+	return sequence, counts
+}
+
+func TestSelectUpstream_RoundRobin(t *testing.T) {
+	r := newTestRouter(t, StrategyRoundRobin)
+
+	sequence, counts := selectN(t, r, 6)
+	if got := sequence[:3]; got[0] == got[1] || got[1] == got[2] || got[0] == got[2] {
+		t.Errorf("一轮内应依次选中不同账号, got %v", sequence)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if counts[id] != 2 {
+			t.Errorf("counts[%s] = %d, want 2 (分布: %v)", id, counts[id], counts)
+		}
+	}
+}
+
+func TestSelectUpstream_HealthFirst(t *testing.T) {
+	r := newTestRouter(t, StrategyHealthFirst)
+	_ = r.upstreamMgr.UpdateAccountHealth("b", false)
+
+	_, counts := selectN(t, r, 6)
+	if counts["b"] != 0 || counts["a"] != 3 || counts["c"] != 3 {
+		t.Errorf("应在健康账号间均匀轮询并跳过不健康账号, got %v", counts)
+	}
+}
+
+func TestSelectUpstream_Weighted(t *testing.T) {
+	r := newTestRouter(t, StrategyWeighted)
+
+	sequence, counts := selectN(t, r, 60)
+	if counts["a"] != 10 || counts["b"] != 20 || counts["c"] != 30 {
+		t.Errorf("选择次数应与权重1:2:3成正比, got %v", counts)
+	}
+	// 平滑加权：权重最高的账号也不会连续被选中超过两次
+	for i := 2; i < len(sequence); i++ {
+		if sequence[i] == sequence[i-1] && sequence[i] == sequence[i-2] {
+			t.Fatalf("选择序列不够平滑: %v", sequence[:6])
+		}
+	}
+}
+
+func TestSelectUpstream_WeightedSkipsUnhealthy(t *testing.T) {
+	r := newTestRouter(t, StrategyWeighted)
+	_ = r.upstreamMgr.UpdateAccountHealth("c", false)
+
+	_, counts := selectN(t, r, 30)
+	if counts["c"] != 0 || counts["a"] != 10 || counts["b"] != 20 {
+		t.Errorf("不健康账号不应被选中, got %v", counts)
+	}
+}
+
+func TestNewRequestRouter_DefaultStrategy(t *testing.T) {
+	if got := NewRequestRouter(nil, "").Strategy(); got != StrategyHealthFirst {
+		t.Errorf("Strategy() = %s, want %s", got, StrategyHealthFirst)
+	}
+}
+
+func TestSelectUpstreamForTenant_Isolation(t *testing.T) {
+	r := newTestRouter(t, StrategyRoundRobin)
+	for _, id := range []string{"t1", "t2"} {
+		err := r.upstreamMgr.AddAccount(&types.UpstreamAccount{
+			ID:       id,
+			Name:     id,
+			Type:     types.UpstreamTypeAPIKey,
+			Provider: types.ProviderOpenAI,
+			APIKey:   "sk-" + id,
+			Tenant:   "acme",
+		})
+		if err != nil {
+			t.Fatalf("AddAccount() error = %v", err)
+		}
+	}
+
+	for i := 0; i < 6; i++ {
+		account, err := r.SelectUpstreamForTenant(types.ProviderOpenAI, "acme")
+		if err != nil {
+			t.Fatalf("SelectUpstreamForTenant() error = %v", err)
+		}
+		if account.Tenant != "acme" {
+			t.Errorf("租户acme选中了其他租户的账号 %s", account.ID)
+		}
+	}
+
+	// 默认租户不会选到acme的账号
+	_, counts := selectN(t, r, 6)
+	if counts["t1"] != 0 || counts["t2"] != 0 {
+		t.Errorf("默认租户不应选中acme的账号, got %v", counts)
+	}
+
+	if _, err := r.SelectUpstreamForTenant(types.ProviderOpenAI, "other"); err == nil {
+		t.Error("没有账号的租户应返回错误，而不是借用其他租户的账号")
+	}
+}
+
+func TestSelectUpstreamWithReason_RecordsUnhealthySkip(t *testing.T) {
+	r := newTestRouter(t, StrategyHealthFirst)
+	r.upstreamMgr.UpdateAccountHealth("b", false)
+
+	account, selection, err := r.SelectUpstreamWithReason(types.ProviderOpenAI, "", nil)
+	if err != nil {
+		t.Fatalf("SelectUpstreamWithReason() error = %v", err)
+	}
+	if selection.Strategy != StrategyHealthFirst {
+		t.Errorf("Strategy = %q, want %q", selection.Strategy, StrategyHealthFirst)
+	}
+	if strings.Join(selection.Candidates, ",") != "a,b,c" {
+		t.Errorf("Candidates = %v, want [a b c]", selection.Candidates)
+	}
+	if selection.Chosen != account.ID || account.ID == "b" {
+		t.Errorf("Chosen = %q, account = %q, 不应选中不健康账号b", selection.Chosen, account.ID)
+	}
+	if !strings.Contains(selection.Reason, "跳过不健康账号: b") {
+		t.Errorf("Reason = %q, 应记录跳过的不健康账号", selection.Reason)
+	}
+
+	// 失败重试时记录被排除的账号
+	_, selection, err = r.SelectUpstreamWithReason(types.ProviderOpenAI, "", map[string]bool{account.ID: true})
+	if err != nil {
+		t.Fatalf("SelectUpstreamWithReason() error = %v", err)
+	}
+	if !strings.Contains(selection.Reason, "已排除失败账号: "+account.ID) {
+		t.Errorf("Reason = %q, 应记录排除的失败账号", selection.Reason)
+	}
+}
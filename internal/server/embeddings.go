@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/pkg/logger"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// embeddingsRequest OpenAI格式的向量嵌入请求中网关关心的字段，其余字段原样转发
+type embeddingsRequest struct {
+	Model          string          `json:"model"`
+	Input          json.RawMessage `json:"input"`
+	EncodingFormat string          `json:"encoding_format,omitempty"`
+}
+
+// validate 校验模型和输入：input为字符串、字符串数组或token数组
+func (r *embeddingsRequest) validate() error {
+	if r.Model == "" {
+		return fmt.Errorf("model is required")
+	}
+
+	var input interface{}
+	if len(r.Input) == 0 || json.Unmarshal(r.Input, &input) != nil {
+		return fmt.Errorf("input is required")
+	}
+	switch v := input.(type) {
+	case string:
+		if v == "" {
+			return fmt.Errorf("input must not be empty")
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return fmt.Errorf("input must not be empty")
+		}
+	default:
+		return fmt.Errorf("input must be a string or an array")
+	}
+
+	switch r.EncodingFormat {
+	case "", "float", "base64":
+	default:
+		return fmt.Errorf("encoding_format must be float or base64")
+	}
+	return nil
+}
+
+// HandleEmbeddings 处理向量嵌入请求: POST /v1/embeddings，
+// 路由到OpenAI兼容的上游，上游响应原样返回
+func (h *ProxyHandler) HandleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	if r.Method != http.MethodPost {
+		h.rejectRequest(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+	if err := checkRequestContentType(r.Header.Get("Content-Type")); err != nil {
+		h.rejectRequest(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", err.Error())
+		return
+	}
+
+	// 1. 读取并校验请求体
+	requestBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.metrics.recordRejected(requestTenant(r), r.Header.Get("X-Gateway-Key-ID"), http.StatusRequestEntityTooLarge)
+			writeRequestTooLarge(w, maxBytesErr.Limit)
+			return
+		}
+		h.rejectRequest(w, r, http.StatusBadRequest, "invalid_request_body", "Failed to read request body")
+		return
+	}
+	defer func() { _ = r.Body.Close() }()
+	h.sizeStats.recordRequest(len(requestBody))
+
+	var request embeddingsRequest
+	if err := json.Unmarshal(requestBody, &request); err != nil {
+		h.rejectRequest(w, r, http.StatusBadRequest, "request_parse_error", fmt.Sprintf("Failed to parse request: %v", err))
+		return
+	}
+	if err := request.validate(); err != nil {
+		h.rejectRequest(w, r, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	// 2. 模型访问控制与模型路由
+	gatewayKey, _ := r.Context().Value("gatewayKey").(*types.GatewayAPIKey)
+	if err := h.modelRouteConfig.CheckModelAccessWithKey(request.Model, gatewayKey); err != nil {
+		h.rejectRequest(w, r, http.StatusForbidden, "model_not_allowed", fmt.Sprintf("Model %s is not allowed for this API key: %v", request.Model, err))
+		return
+	}
+
+	model := request.Model
+	providerModel := request.Model
+	var targetProvider types.Provider
+	if h.modelRouteConfig != nil {
+		routeContext := h.modelRouteConfig.CreateContextWithKey(request.Model, gatewayKey)
+		if routeContext != nil && routeContext.Rejected {
+			h.rejectRequest(w, r, http.StatusBadRequest, "model_not_allowed", fmt.Sprintf("Model %s is not allowed: no matching model route", request.Model))
+			return
+		}
+		if routeContext != nil && routeContext.Enabled {
+			if routeContext.TargetModel != "" {
+				model = routeContext.TargetModel
+			}
+			// 只改写模型名的规则不改变提供商选择
+			if !routeContext.Rewrite {
+				providerModel = model
+			}
+			targetProvider = routeContext.TargetProvider
+		}
+	}
+	if targetProvider == "" {
+		targetProvider = h.router.DetermineProvider(providerModel)
+	}
+
+	// 3. 只有OpenAI兼容的提供商支持embeddings
+	upstreamPath, err := h.converter.GetEmbeddingsPath(targetProvider)
+	if err != nil {
+		h.rejectRequest(w, r, http.StatusBadRequest, "embeddings_not_supported", fmt.Sprintf("Provider %s does not support embeddings", targetProvider))
+		return
+	}
+
+	// 4. 选择上游账号（只在Key所属租户的账号中选择）
+	tenant := types.DefaultTenant
+	if gatewayKey != nil {
+		tenant = gatewayKey.TenantID()
+	}
+	account, err := h.router.SelectUpstreamForTenant(targetProvider, tenant)
+	if err != nil {
+		h.rejectRequest(w, r, http.StatusServiceUnavailable, "no_upstream_available", fmt.Sprintf("No available upstream for provider %s: %v", targetProvider, err))
+		return
+	}
+	defer h.router.ReleaseUpstream(account.ID)
+
+	upstreamBody, err := embeddingsUpstreamBody(requestBody, model)
+	if err != nil {
+		h.rejectRequest(w, r, http.StatusBadRequest, "request_parse_error", fmt.Sprintf("Failed to parse request: %v", err))
+		return
+	}
+
+	// 5. 调用上游（按重试策略重试）
+	keyID := r.Header.Get("X-Gateway-Key-ID")
+	ctx, cancel := h.upstreamContext(r.Context(), gatewayKey.RequestTimeout(), false)
+	defer cancel()
+	responseBody, err := h.callEmbeddingsUpstream(ctx, h.upstreamClient(gatewayKey.RequestTimeout()), account, model, upstreamPath, upstreamBody)
+	if err != nil {
+		h.handleUpstreamError(w, account, converter.FormatOpenAI, keyID, startTime, err)
+		return
+	}
+
+	// 6. 记录用量（embeddings只有输入token）
+	inputTokens, outputTokens := extractUsage(converter.FormatOpenAI, responseBody)
+	go h.recordSuccess(keyID, account, time.Since(startTime), int(inputTokens+outputTokens))
+	go h.recordCost(keyID, model, inputTokens, outputTokens)
+	h.sizeStats.recordResponse(len(responseBody), inputTokens, outputTokens)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(responseBody)
+}
+
+// embeddingsUpstreamBody 模型路由改写了模型名时替换请求中的model，其余字段原样保留
+func embeddingsUpstreamBody(requestBody []byte, model string) ([]byte, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(requestBody, &body); err != nil {
+		return nil, err
+	}
+	modelJSON, _ := json.Marshal(model)
+	body["model"] = modelJSON
+	return json.Marshal(body)
+}
+
+// callEmbeddingsUpstream 发送向量嵌入请求并返回上游原始响应
+func (h *ProxyHandler) callEmbeddingsUpstream(ctx context.Context, client *http.Client, account *types.UpstreamAccount, model, upstreamPath string, body []byte) ([]byte, error) {
+	if account.Provider == types.ProviderAzure {
+		upstreamPath = converter.ResolveAzurePath(upstreamPath, account.AzureDeployment(model), account.APIVersion)
+	}
+	url := h.upstreamMgr.GetBaseURL(account) + upstreamPath
+
+	var buildErr error
+	resp, err := h.retryPolicy.do(client, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			buildErr = err
+			return nil, err
+		}
+		if _, err := h.setUpstreamHeaders(req, account); err != nil {
+			buildErr = err
+			return nil, err
+		}
+		return req, nil
+	})
+	if buildErr != nil {
+		return nil, fmt.Errorf("failed to build upstream request: %w", buildErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("upstream request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	responseBody, err := readLimitedBody(resp.Body, h.maxResponseBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upstream response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		logger.Debug("上游embeddings请求失败，上游ID: %s, 状态码: %d", account.ID, resp.StatusCode)
+		return nil, parseUpstreamError(resp.StatusCode, responseBody)
+	}
+	return responseBody, nil
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestHandleEmbeddings(t *testing.T) {
+	var upstreamPath string
+	var upstreamBody map[string]interface{}
+	upstreamResponse := `{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]},` +
+		`{"object":"embedding","index":1,"embedding":[0.3,0.4]}],"model":"text-embedding-3-small",` +
+		`"usage":{"prompt_tokens":8,"total_tokens":8}}`
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(upstreamResponse))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"model":"text-embedding-3-small","input":["hello","world"],"encoding_format":"float","dimensions":2}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Body.String() != upstreamResponse {
+		t.Errorf("响应应原样返回上游内容, got %s", rec.Body.String())
+	}
+	if upstreamPath != "/v1/embeddings" {
+		t.Errorf("上游路径 = %s, want /v1/embeddings", upstreamPath)
+	}
+	if upstreamBody["encoding_format"] != "float" || upstreamBody["dimensions"] != float64(2) {
+		t.Errorf("上游请求应保留encoding_format和其他字段: %v", upstreamBody)
+	}
+	if input, _ := upstreamBody["input"].([]interface{}); len(input) != 2 {
+		t.Errorf("上游请求input = %v, want 2项", upstreamBody["input"])
+	}
+
+	// 成功统计异步记录，等待上游账号用量更新
+	deadline := time.Now().Add(2 * time.Second)
+	var tokensUsed int64
+	for time.Now().Before(deadline) {
+		account, _ := s.upstreamMgr.GetAccount("up-openai")
+		if account != nil && account.Usage != nil && account.Usage.TokensUsed > 0 {
+			tokensUsed = account.Usage.TokensUsed
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if tokensUsed != 8 {
+		t.Errorf("上游账号TokensUsed = %d, want 8", tokensUsed)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantType   string
+	}{
+		{"字符串input", `{"model":"text-embedding-3-small","input":"hello"}`, http.StatusOK, ""},
+		{"缺少input", `{"model":"text-embedding-3-small"}`, http.StatusBadRequest, "invalid_request_error"},
+		{"input类型错误", `{"model":"text-embedding-3-small","input":{"text":"hi"}}`, http.StatusBadRequest, "invalid_request_error"},
+		{"提供商不支持embeddings", `{"model":"claude-3-5-sonnet","input":"hello"}`, http.StatusBadRequest, "embeddings_not_supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantType != "" && !strings.Contains(rec.Body.String(), tt.wantType) {
+				t.Errorf("错误类型应为%s: %s", tt.wantType, rec.Body.String())
+			}
+		})
+	}
+}
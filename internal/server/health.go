@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// readinessStatus 就绪探针的响应体
+type readinessStatus struct {
+	Status             string   `json:"status"` // ready, not_ready
+	ConfigLoaded       bool     `json:"config_loaded"`
+	HealthyProviders   []string `json:"healthy_providers"`
+	UnhealthyProviders []string `json:"unhealthy_providers"`
+	Reason             string   `json:"reason,omitempty"`
+}
+
+// handleLiveness 存活探针：进程能处理HTTP请求即返回200，不检查上游
+func (s *HTTPServer) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, map[string]string{
+		"status":  "alive",
+		"service": "llm-gateway",
+	})
+}
+
+// handleReadiness 就绪探针：配置已加载且至少一个提供商有可用的健康上游账号时返回200，否则返回503
+func (s *HTTPServer) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := s.readiness()
+	statusCode := http.StatusOK
+	if status.Status != "ready" {
+		statusCode = http.StatusServiceUnavailable
+	}
+	s.writeJSONResponse(w, statusCode, status)
+}
+
+// readiness 按提供商汇总上游账号状态：有启用、凭据有效且未被标记为unhealthy的账号即视为健康
+func (s *HTTPServer) readiness() *readinessStatus {
+	status := &readinessStatus{
+		Status:             "not_ready",
+		ConfigLoaded:       s.configMgr != nil && s.configMgr.Get() != nil,
+		HealthyProviders:   []string{},
+		UnhealthyProviders: []string{},
+	}
+	if !status.ConfigLoaded {
+		status.Reason = "configuration not loaded"
+		return status
+	}
+
+	providers := make(map[types.Provider]bool)
+	for _, account := range s.upstreamMgr.ListAccounts() {
+		providers[account.Provider] = true
+	}
+	for provider := range providers {
+		healthy := false
+		for _, account := range s.upstreamMgr.ListActiveAccounts(provider) {
+			if account.HealthStatus != "unhealthy" {
+				healthy = true
+				break
+			}
+		}
+		if healthy {
+			status.HealthyProviders = append(status.HealthyProviders, string(provider))
+		} else {
+			status.UnhealthyProviders = append(status.UnhealthyProviders, string(provider))
+		}
+	}
+	sort.Strings(status.HealthyProviders)
+	sort.Strings(status.UnhealthyProviders)
+
+	if len(status.HealthyProviders) == 0 {
+		status.Reason = "no healthy active upstream account"
+		return status
+	}
+	status.Status = "ready"
+	return status
+}
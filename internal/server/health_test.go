@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// unloadedConfigManager 模拟配置尚未加载的配置管理器
+type unloadedConfigManager struct {
+	ConfigManager
+}
+
+func (unloadedConfigManager) Get() *types.Config { return nil }
+
+func TestHealthProbes(t *testing.T) {
+	s, _ := newTestGateway(t, "http://127.0.0.1:1", types.MetricsConfig{})
+	if err := s.upstreamMgr.AddAccount(&types.UpstreamAccount{
+		ID:           "up-anthropic",
+		Name:         "anthropic",
+		Type:         types.UpstreamTypeAPIKey,
+		Provider:     types.ProviderAnthropic,
+		APIKey:       "sk-ant-test",
+		HealthStatus: "unhealthy",
+	}); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+
+	probe := func(path string) (int, readinessStatus) {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var status readinessStatus
+		_ = json.Unmarshal(rec.Body.Bytes(), &status)
+		return rec.Code, status
+	}
+
+	tests := []struct {
+		name          string
+		setup         func(t *testing.T)
+		wantReady     int
+		wantHealthy   []string
+		wantUnhealthy []string
+	}{
+		{
+			name:          "存在健康的上游账号",
+			setup:         func(t *testing.T) {},
+			wantReady:     http.StatusOK,
+			wantHealthy:   []string{"openai"},
+			wantUnhealthy: []string{"anthropic"},
+		},
+		{
+			name: "所有上游账号不健康",
+			setup: func(t *testing.T) {
+				if err := s.upstreamMgr.UpdateAccountHealth("up-openai", false); err != nil {
+					t.Fatalf("UpdateAccountHealth() error = %v", err)
+				}
+			},
+			wantReady:     http.StatusServiceUnavailable,
+			wantHealthy:   []string{},
+			wantUnhealthy: []string{"anthropic", "openai"},
+		},
+		{
+			name: "健康账号被禁用",
+			setup: func(t *testing.T) {
+				if err := s.upstreamMgr.UpdateAccountHealth("up-openai", true); err != nil {
+					t.Fatalf("UpdateAccountHealth() error = %v", err)
+				}
+				if err := s.upstreamMgr.UpdateAccountStatus("up-openai", "disabled"); err != nil {
+					t.Fatalf("UpdateAccountStatus() error = %v", err)
+				}
+			},
+			wantReady:     http.StatusServiceUnavailable,
+			wantHealthy:   []string{},
+			wantUnhealthy: []string{"anthropic", "openai"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(t)
+
+			if code, _ := probe("/healthz"); code != http.StatusOK {
+				t.Errorf("/healthz status = %d, want 200", code)
+			}
+			code, status := probe("/readyz")
+			if code != tt.wantReady {
+				t.Errorf("/readyz status = %d, want %d (%+v)", code, tt.wantReady, status)
+			}
+			if !reflect.DeepEqual(status.HealthyProviders, tt.wantHealthy) || !reflect.DeepEqual(status.UnhealthyProviders, tt.wantUnhealthy) {
+				t.Errorf("healthy = %v, unhealthy = %v, want %v, %v", status.HealthyProviders, status.UnhealthyProviders, tt.wantHealthy, tt.wantUnhealthy)
+			}
+		})
+	}
+
+	// 配置未加载时不就绪
+	s.configMgr = unloadedConfigManager{}
+	code, status := probe("/readyz")
+	if code != http.StatusServiceUnavailable || status.ConfigLoaded {
+		t.Errorf("配置未加载 /readyz status = %d, config_loaded = %v, want 503, false", code, status.ConfigLoaded)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/cache"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// 幂等请求相关头部
+const (
+	headerIdempotencyKey      = "Idempotency-Key"
+	headerIdempotentReplayed  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	defaultIdempotencyTTL     = time.Hour
+	defaultIdempotencyEntries = 1000
+)
+
+// 幂等请求无法执行的原因
+var (
+	errIdempotencyMismatch = errors.New("Idempotency-Key was already used with a different request body")
+	errIdempotencyInFlight = errors.New("a request with this Idempotency-Key is still being processed")
+)
+
+// idempotencyStore 幂等请求状态：已完成请求的成功响应，以及正在处理的请求。
+// 两者都记录请求指纹，相同Idempotency-Key携带不同请求体时拒绝，而不是重放无关的响应
+type idempotencyStore struct {
+	responses *cache.ResponseCache // 值为请求指纹（定长）+ 响应体
+
+	mutex   sync.Mutex
+	pending map[string]string // 正在处理的请求，幂等键 -> 请求指纹
+}
+
+// newIdempotencyStore 创建幂等请求状态，成功响应复用响应缓存的内存LRU实现
+func newIdempotencyStore(config *types.IdempotencyConfig) *idempotencyStore {
+	ttl := defaultIdempotencyTTL
+	maxEntries := defaultIdempotencyEntries
+	if config != nil {
+		if config.TTLSeconds > 0 {
+			ttl = time.Duration(config.TTLSeconds) * time.Second
+		}
+		if config.MaxEntries > 0 {
+			maxEntries = config.MaxEntries
+		}
+	}
+	return &idempotencyStore{
+		responses: cache.NewResponseCache(maxEntries, ttl),
+		pending:   make(map[string]string),
+	}
+}
+
+// begin 开始处理幂等请求。相同请求已成功完成时返回其响应；请求指纹不一致时返回errIdempotencyMismatch；
+// 相同键的请求仍在处理时返回errIdempotencyInFlight（如客户端超时后重试，而首次调用仍在进行）。
+// 返回nil响应和nil错误时请求被标记为处理中，调用方必须在结束时调用finish
+func (s *idempotencyStore) begin(key, fingerprint string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if entry, ok := s.responses.Get(key); ok {
+		if string(entry[:len(fingerprint)]) != fingerprint {
+			return nil, errIdempotencyMismatch
+		}
+		return entry[len(fingerprint):], nil
+	}
+	if pending, ok := s.pending[key]; ok {
+		if pending != fingerprint {
+			return nil, errIdempotencyMismatch
+		}
+		return nil, errIdempotencyInFlight
+	}
+	s.pending[key] = fingerprint
+	return nil, nil
+}
+
+// finish 结束处理中的幂等请求，response非nil时保存成功响应供重试重放；失败的请求不保存，可以重试
+func (s *idempotencyStore) finish(key, fingerprint string, response []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.pending, key)
+	if response != nil {
+		entry := make([]byte, 0, len(fingerprint)+len(response))
+		s.responses.Set(key, append(append(entry, fingerprint...), response...))
+	}
+}
+
+// parseIdempotencyKey 读取客户端的Idempotency-Key，未携带时返回空串
+func parseIdempotencyKey(r *http.Request) (string, error) {
+	key := strings.TrimSpace(r.Header.Get(headerIdempotencyKey))
+	if len(key) > maxIdempotencyKeyLength {
+		return "", fmt.Errorf("%s must be at most %d characters", headerIdempotencyKey, maxIdempotencyKeyLength)
+	}
+	return key, nil
+}
+
+// idempotencyCacheKey 幂等缓存键：按Gateway Key隔离，不同Key使用相同Idempotency-Key互不影响。
+// 流式请求不缓存，返回空串
+func idempotencyCacheKey(request *types.UnifiedRequest) string {
+	if request.IdempotencyKey == "" || (request.Stream != nil && *request.Stream) {
+		return ""
+	}
+	return request.GatewayKeyID + "\x00" + request.IdempotencyKey
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestProxy_IdempotencyKey(t *testing.T) {
+	var upstreamCalls int32
+	var failNext atomic.Bool
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		if failNext.Swap(false) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"bad request"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	_, otherKey, err := s.clientMgr.CreateKey("other", []types.Permission{types.PermissionRead, types.PermissionWrite})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+
+	const defaultBody = `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	sendBody := func(key, idempotencyKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		if idempotencyKey != "" {
+			req.Header.Set(headerIdempotencyKey, idempotencyKey)
+		}
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec
+	}
+	send := func(key, idempotencyKey string) *httptest.ResponseRecorder {
+		return sendBody(key, idempotencyKey, defaultBody)
+	}
+
+	t.Run("相同Idempotency-Key只调用一次上游", func(t *testing.T) {
+		atomic.StoreInt32(&upstreamCalls, 0)
+		first := send(rawKey, "retry-1")
+		second := send(rawKey, "retry-1")
+		if first.Code != http.StatusOK || second.Code != http.StatusOK {
+			t.Fatalf("status = %d, %d", first.Code, second.Code)
+		}
+		if calls := atomic.LoadInt32(&upstreamCalls); calls != 1 {
+			t.Errorf("上游调用次数 = %d, want 1", calls)
+		}
+		if second.Body.String() != first.Body.String() {
+			t.Errorf("重放的响应应与首次一致:\n%s\n%s", first.Body.String(), second.Body.String())
+		}
+		if first.Header().Get(headerIdempotentReplayed) != "" || second.Header().Get(headerIdempotentReplayed) != "true" {
+			t.Errorf("只有重放的响应应带 %s 头", headerIdempotentReplayed)
+		}
+	})
+
+	t.Run("不同Gateway Key互不影响", func(t *testing.T) {
+		atomic.StoreInt32(&upstreamCalls, 0)
+		send(rawKey, "retry-2")
+		send(otherKey, "retry-2")
+		if calls := atomic.LoadInt32(&upstreamCalls); calls != 2 {
+			t.Errorf("上游调用次数 = %d, want 2", calls)
+		}
+	})
+
+	t.Run("失败的响应不缓存", func(t *testing.T) {
+		atomic.StoreInt32(&upstreamCalls, 0)
+		failNext.Store(true)
+		if rec := send(rawKey, "retry-3"); rec.Code == http.StatusOK {
+			t.Fatalf("首次请求应失败, status = %d", rec.Code)
+		}
+		if rec := send(rawKey, "retry-3"); rec.Code != http.StatusOK {
+			t.Fatalf("重试应成功, status = %d: %s", rec.Code, rec.Body.String())
+		}
+		if calls := atomic.LoadInt32(&upstreamCalls); calls != 2 {
+			t.Errorf("上游调用次数 = %d, want 2", calls)
+		}
+	})
+
+	t.Run("相同Idempotency-Key携带不同请求体", func(t *testing.T) {
+		atomic.StoreInt32(&upstreamCalls, 0)
+		if rec := send(rawKey, "retry-4"); rec.Code != http.StatusOK {
+			t.Fatalf("首次请求 status = %d", rec.Code)
+		}
+		rec := sendBody(rawKey, "retry-4", `{"model":"gpt-4o","messages":[{"role":"user","content":"something else"}]}`)
+		if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "idempotency_key_mismatch") {
+			t.Errorf("不同请求体应返回422, status = %d: %s", rec.Code, rec.Body.String())
+		}
+		if calls := atomic.LoadInt32(&upstreamCalls); calls != 1 {
+			t.Errorf("上游调用次数 = %d, want 1", calls)
+		}
+	})
+
+	t.Run("未携带Idempotency-Key时不缓存", func(t *testing.T) {
+		atomic.StoreInt32(&upstreamCalls, 0)
+		send(rawKey, "")
+		send(rawKey, "")
+		if calls := atomic.LoadInt32(&upstreamCalls); calls != 2 {
+			t.Errorf("上游调用次数 = %d, want 2", calls)
+		}
+	})
+
+	t.Run("Idempotency-Key过长", func(t *testing.T) {
+		if rec := send(rawKey, strings.Repeat("k", maxIdempotencyKeyLength+1)); rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", rec.Code)
+		}
+	})
+}
+
+func TestProxy_IdempotencyKeyInFlight(t *testing.T) {
+	var upstreamCalls int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		started <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		req.Header.Set(headerIdempotencyKey, "slow-1")
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec
+	}
+	const body = `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- send(body) }()
+	<-started
+
+	// 首次调用仍在进行时，客户端超时后的重试不再调用上游
+	if rec := send(body); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "idempotency_key_in_use") {
+		t.Errorf("处理中的重试应返回409, status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(`{"model":"gpt-4o","messages":[{"role":"user","content":"other"}]}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("处理中且请求体不同应返回422, status = %d", rec.Code)
+	}
+
+	close(release)
+	if rec := <-first; rec.Code != http.StatusOK {
+		t.Fatalf("首次请求 status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(body); rec.Code != http.StatusOK || rec.Header().Get(headerIdempotentReplayed) != "true" {
+		t.Errorf("完成后的重试应重放响应, status = %d", rec.Code)
+	}
+	if calls := atomic.LoadInt32(&upstreamCalls); calls != 1 {
+		t.Errorf("上游调用次数 = %d, want 1", calls)
+	}
+}
+
+func TestIdempotencyCacheKey(t *testing.T) {
+	stream := true
+	tests := []struct {
+		name    string
+		request *types.UnifiedRequest
+		want    string
+	}{
+		{"未携带", &types.UnifiedRequest{GatewayKeyID: "gw_1"}, ""},
+		{"非流式", &types.UnifiedRequest{GatewayKeyID: "gw_1", IdempotencyKey: "abc"}, "gw_1\x00abc"},
+		{"流式请求不缓存", &types.UnifiedRequest{GatewayKeyID: "gw_1", IdempotencyKey: "abc", Stream: &stream}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idempotencyCacheKey(tt.request); got != tt.want {
+				t.Errorf("idempotencyCacheKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// defaultLatencyBuckets 请求耗时桶上界（毫秒），导出时换算为秒
+var defaultLatencyBuckets = []int64{100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 120000}
+
+// requestLabels 请求计数的标签组合
+type requestLabels struct {
+	tenant   string
+	key      string
+	upstream string
+	provider string
+	status   int
+}
+
+// upstreamLabels 上游错误计数的标签组合
+type upstreamLabels struct {
+	tenant   string
+	upstream string
+	provider string
+}
+
+// latencyLabels 请求耗时的标签组合，按租户分开记录以便只导出调用方租户的数据，导出时按提供商汇总
+type latencyLabels struct {
+	tenant   string
+	provider types.Provider
+}
+
+// gatewayMetrics Prometheus指标（进程内存，重启后清零）
+type gatewayMetrics struct {
+	mutex          sync.Mutex
+	requests       map[requestLabels]int64
+	upstreamErrors map[upstreamLabels]int64
+	latency        map[latencyLabels]*sizeHistogram
+}
+
+// newGatewayMetrics 创建指标集合
+func newGatewayMetrics() *gatewayMetrics {
+	return &gatewayMetrics{
+		requests:       make(map[requestLabels]int64),
+		upstreamErrors: make(map[upstreamLabels]int64),
+		latency:        make(map[latencyLabels]*sizeHistogram),
+	}
+}
+
+// recordRequest 记录一次已转发到上游的请求及其返回给客户端的状态码和耗时
+func (m *gatewayMetrics) recordRequest(keyID string, account *types.UpstreamAccount, statusCode int, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	labels := requestLabels{tenant: account.TenantID(), key: keyID, upstream: account.ID, provider: string(account.Provider), status: statusCode}
+	m.requests[labels]++
+	latencyKey := latencyLabels{tenant: account.TenantID(), provider: account.Provider}
+	histogram, ok := m.latency[latencyKey]
+	if !ok {
+		histogram = newSizeHistogram(defaultLatencyBuckets)
+		m.latency[latencyKey] = histogram
+	}
+	histogram.observe(latency.Milliseconds())
+}
+
+// recordRejected 记录一次未转发到上游即被拒绝的请求（参数错误、无权限、无可用上游等），upstream和provider标签为空，不计入耗时
+func (m *gatewayMetrics) recordRejected(tenant, keyID string, statusCode int) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests[requestLabels{tenant: tenant, key: keyID, status: statusCode}]++
+}
+
+// recordUpstreamError 记录一次上游错误
+func (m *gatewayMetrics) recordUpstreamError(account *types.UpstreamAccount) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.upstreamErrors[upstreamLabels{tenant: account.TenantID(), upstream: account.ID, provider: string(account.Provider)}]++
+}
+
+// writeTo 以Prometheus文本格式输出指标，accounts用于计算上游账号数量。
+// tenant非空时只输出该租户的请求、错误、耗时和上游账号数量，为空时输出全部租户
+func (m *gatewayMetrics) writeTo(w io.Writer, accounts []*types.UpstreamAccount, tenant string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	visible := func(labelTenant string) bool { return tenant == "" || labelTenant == tenant }
+
+	fmt.Fprintln(w, "# HELP llm_gateway_requests_total Requests handled by the gateway, by tenant, gateway key, upstream, provider and response status. upstream is empty for requests rejected before reaching an upstream.")
+	fmt.Fprintln(w, "# TYPE llm_gateway_requests_total counter")
+	requestKeys := make([]requestLabels, 0, len(m.requests))
+	for labels := range m.requests {
+		if visible(labels.tenant) {
+			requestKeys = append(requestKeys, labels)
+		}
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.tenant != b.tenant {
+			return a.tenant < b.tenant
+		}
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		if a.upstream != b.upstream {
+			return a.upstream < b.upstream
+		}
+		return a.status < b.status
+	})
+	for _, labels := range requestKeys {
+		fmt.Fprintf(w, "llm_gateway_requests_total{tenant=%s,key=%s,upstream=%s,provider=%s,status=\"%d\"} %d\n",
+			quoteLabel(labels.tenant), quoteLabel(labels.key), quoteLabel(labels.upstream), quoteLabel(labels.provider), labels.status, m.requests[labels])
+	}
+
+	fmt.Fprintln(w, "# HELP llm_gateway_upstream_errors_total Upstream errors, by tenant, upstream and provider.")
+	fmt.Fprintln(w, "# TYPE llm_gateway_upstream_errors_total counter")
+	errorKeys := make([]upstreamLabels, 0, len(m.upstreamErrors))
+	for labels := range m.upstreamErrors {
+		if visible(labels.tenant) {
+			errorKeys = append(errorKeys, labels)
+		}
+	}
+	sort.Slice(errorKeys, func(i, j int) bool { return errorKeys[i].upstream < errorKeys[j].upstream })
+	for _, labels := range errorKeys {
+		fmt.Fprintf(w, "llm_gateway_upstream_errors_total{tenant=%s,upstream=%s,provider=%s} %d\n",
+			quoteLabel(labels.tenant), quoteLabel(labels.upstream), quoteLabel(labels.provider), m.upstreamErrors[labels])
+	}
+
+	fmt.Fprintln(w, "# HELP llm_gateway_request_duration_seconds Request latency, by provider.")
+	fmt.Fprintln(w, "# TYPE llm_gateway_request_duration_seconds histogram")
+	latency := make(map[string]*sizeHistogram)
+	for labels, histogram := range m.latency {
+		if !visible(labels.tenant) {
+			continue
+		}
+		merged, ok := latency[string(labels.provider)]
+		if !ok {
+			merged = newSizeHistogram(defaultLatencyBuckets)
+			latency[string(labels.provider)] = merged
+		}
+		merged.merge(histogram)
+	}
+	providers := make([]string, 0, len(latency))
+	for provider := range latency {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	for _, provider := range providers {
+		histogram := latency[provider]
+		var cumulative int64
+		for i, bound := range histogram.bounds {
+			cumulative += histogram.counts[i]
+			fmt.Fprintf(w, "llm_gateway_request_duration_seconds_bucket{provider=%s,le=\"%s\"} %d\n",
+				quoteLabel(provider), formatSeconds(bound), cumulative)
+		}
+		fmt.Fprintf(w, "llm_gateway_request_duration_seconds_bucket{provider=%s,le=\"+Inf\"} %d\n", quoteLabel(provider), histogram.count)
+		fmt.Fprintf(w, "llm_gateway_request_duration_seconds_sum{provider=%s} %s\n", quoteLabel(provider), formatSeconds(histogram.sum))
+		fmt.Fprintf(w, "llm_gateway_request_duration_seconds_count{provider=%s} %d\n", quoteLabel(provider), histogram.count)
+	}
+
+	total, active, healthy := 0, 0, 0
+	for _, account := range accounts {
+		if !visible(account.TenantID()) {
+			continue
+		}
+		total++
+		if account.Status == "active" {
+			active++
+			if account.HealthStatus == "healthy" {
+				healthy++
+			}
+		}
+	}
+	fmt.Fprintln(w, "# HELP llm_gateway_upstreams Upstream accounts, by state.")
+	fmt.Fprintln(w, "# TYPE llm_gateway_upstreams gauge")
+	fmt.Fprintf(w, "llm_gateway_upstreams{state=\"total\"} %d\n", total)
+	fmt.Fprintf(w, "llm_gateway_upstreams{state=\"active\"} %d\n", active)
+	fmt.Fprintf(w, "llm_gateway_upstreams{state=\"healthy\"} %d\n", healthy)
+}
+
+// quoteLabel 按Prometheus文本格式转义并加引号
+func quoteLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+// formatSeconds 将毫秒数格式化为秒
+func formatSeconds(ms int64) string {
+	return strconv.FormatFloat(float64(ms)/1000, 'f', -1, 64)
+}
+
+// HandleMetrics 以Prometheus文本格式返回网关指标
+func (h *ProxyHandler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	if h.metrics == nil {
+		h.writeErrorResponse(w, http.StatusNotFound, "metrics_disabled", "Metrics are not available")
+		return
+	}
+
+	var accounts []*types.UpstreamAccount
+	if h.upstreamMgr != nil {
+		accounts = h.upstreamMgr.ListAccounts()
+	}
+
+	// 非public模式下普通Key只能看到所属租户的指标，admin Key可以看到全部租户
+	tenant := ""
+	if gatewayKey, ok := r.Context().Value("gatewayKey").(*types.GatewayAPIKey); ok && !hasPermission(gatewayKey, types.PermissionAdmin) {
+		tenant = gatewayKey.TenantID()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	h.metrics.writeTo(w, accounts, tenant)
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/client"
+	"github.com/iBreaker/llm-gateway/internal/config"
+	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/internal/router"
+	"github.com/iBreaker/llm-gateway/internal/upstream"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// newTestGateway 创建只有一个OpenAI上游账号（指向upstreamURL）的网关，返回网关及可用的Gateway Key
+func newTestGateway(t *testing.T, upstreamURL string, metrics types.MetricsConfig) (*HTTPServer, string) {
+	t.Helper()
+	configMgr := config.NewConfigManager(filepath.Join(testConfigDir(t), "config.yaml"))
+	cfg, err := configMgr.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	cfg.Server.Metrics = metrics
+
+	keyMgr := client.NewGatewayKeyManager(configMgr)
+	_, rawKey, err := keyMgr.CreateKey("metrics", []types.Permission{types.PermissionRead, types.PermissionWrite})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	upstreamMgr := upstream.NewUpstreamManager(configMgr)
+	if err := upstreamMgr.AddAccount(&types.UpstreamAccount{
+		ID:           "up-openai",
+		Name:         "openai",
+		Type:         types.UpstreamTypeAPIKey,
+		Provider:     types.ProviderOpenAI,
+		BaseURL:      upstreamURL,
+		APIKey:       "sk-test",
+		HealthStatus: "healthy",
+	}); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+
+	requestRouter := router.NewRequestRouter(upstreamMgr, router.StrategyRoundRobin)
+	return NewServer(cfg, keyMgr, upstreamMgr, requestRouter, converter.NewManager(), configMgr, nil), rawKey
+}
+
+// testConfigDir 创建测试用的配置目录。请求统计在后台goroutine中异步写入配置，
+// 测试结束时可能仍在保存，t.TempDir的清理会因目录非空而失败，因此清理时稍后重试删除
+func testConfigDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "llm-gateway-test")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	t.Cleanup(func() {
+		for i := 0; i < 20; i++ {
+			if err := os.RemoveAll(dir); err == nil {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+	return dir
+}
+
+// scrapeMetrics 抓取指标端点
+func scrapeMetrics(s *HTTPServer, rawKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if rawKey != "" {
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+	}
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// waitForMetric 成功统计异步记录，等待指标出现
+func waitForMetric(t *testing.T, s *HTTPServer, rawKey, line string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		body := scrapeMetrics(s, rawKey).Body.String()
+		if strings.Contains(body, line) || time.Now().After(deadline) {
+			return body
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMetricsEndpoint_CountsRequests(t *testing.T) {
+	var fail bool
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":{"message":"unavailable","type":"server_error"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{Enabled: true})
+	keyID := s.clientMgr.ListKeys()[0].ID
+
+	if rec := scrapeMetrics(s, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("未认证抓取 status = %d, want 401", rec.Code)
+	}
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("代理请求 status = %d", code)
+	}
+	okLine := `llm_gateway_requests_total{tenant="default",key="` + keyID + `",upstream="up-openai",provider="openai",status="200"} 1`
+	body := waitForMetric(t, s, rawKey, okLine)
+	for _, want := range []string{
+		okLine,
+		`llm_gateway_request_duration_seconds_count{provider="openai"} 1`,
+		`llm_gateway_upstreams{state="active"} 1`,
+		`llm_gateway_upstreams{state="healthy"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("指标缺少 %q:\n%s", want, body)
+		}
+	}
+
+	fail = true
+	if code := send(); code != http.StatusBadGateway {
+		t.Fatalf("上游失败时 status = %d, want 502", code)
+	}
+	body = scrapeMetrics(s, rawKey).Body.String()
+	for _, want := range []string{
+		`llm_gateway_requests_total{tenant="default",key="` + keyID + `",upstream="up-openai",provider="openai",status="502"} 1`,
+		`llm_gateway_upstream_errors_total{tenant="default",upstream="up-openai",provider="openai"} 1`,
+		`llm_gateway_request_duration_seconds_count{provider="openai"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("指标缺少 %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsEndpoint_ClientErrorsAndRejections(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"bad","type":"invalid_request_error"}}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{Enabled: true})
+	keyID := s.clientMgr.ListKeys()[0].ID
+
+	send := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`); code != http.StatusBadRequest {
+		t.Fatalf("上游参数错误 status = %d, want 400", code)
+	}
+	if code := send(`{"model":`); code != http.StatusBadRequest {
+		t.Fatalf("请求体无法解析 status = %d, want 400", code)
+	}
+
+	body := scrapeMetrics(s, rawKey).Body.String()
+	for _, want := range []string{
+		`llm_gateway_requests_total{tenant="default",key="` + keyID + `",upstream="up-openai",provider="openai",status="400"} 1`,
+		`llm_gateway_requests_total{tenant="default",key="` + keyID + `",upstream="",provider="",status="400"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("指标缺少 %q:\n%s", want, body)
+		}
+	}
+	// 客户端请求错误与上游账号无关，不计入上游错误
+	if strings.Contains(body, "llm_gateway_upstream_errors_total{") {
+		t.Errorf("客户端请求错误不应计入上游错误:\n%s", body)
+	}
+}
+
+func TestMetricsEndpoint_DisabledAndPublic(t *testing.T) {
+	s, _ := newTestGateway(t, "http://127.0.0.1:0", types.MetricsConfig{})
+	if rec := scrapeMetrics(s, ""); rec.Code == http.StatusOK && strings.Contains(rec.Body.String(), "llm_gateway_requests_total") {
+		t.Error("未开启时不应暴露指标端点")
+	}
+
+	s, _ = newTestGateway(t, "http://127.0.0.1:0", types.MetricsConfig{Enabled: true, Public: true})
+	if rec := scrapeMetrics(s, ""); rec.Code != http.StatusOK {
+		t.Errorf("public模式无需认证, status = %d", rec.Code)
+	}
+}
+
+func TestMetricsEndpoint_TenantIsolation(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, defaultKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{Enabled: true})
+	defaultKeyID := s.clientMgr.ListKeys()[0].ID
+	acmeKey, acmeRawKey, err := s.clientMgr.CreateKey("acme-key", []types.Permission{types.PermissionRead, types.PermissionWrite})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	if err := s.clientMgr.UpdateKeyTenant(acmeKey.ID, "acme"); err != nil {
+		t.Fatalf("UpdateKeyTenant() error = %v", err)
+	}
+	_, adminRawKey, err := s.clientMgr.CreateKey("admin", []types.Permission{types.PermissionAdmin})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	if err := s.upstreamMgr.AddAccount(&types.UpstreamAccount{
+		ID:           "up-acme",
+		Name:         "acme",
+		Type:         types.UpstreamTypeAPIKey,
+		Provider:     types.ProviderOpenAI,
+		BaseURL:      upstreamServer.URL,
+		APIKey:       "sk-acme",
+		Tenant:       "acme",
+		HealthStatus: "healthy",
+	}); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+
+	for _, rawKey := range []string{defaultKey, acmeRawKey} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("代理请求 status = %d", rec.Code)
+		}
+	}
+
+	defaultLine := `llm_gateway_requests_total{tenant="default",key="` + defaultKeyID + `",upstream="up-openai",provider="openai",status="200"} 1`
+	acmeLine := `llm_gateway_requests_total{tenant="acme",key="` + acmeKey.ID + `",upstream="up-acme",provider="openai",status="200"} 1`
+	allBody := waitForMetric(t, s, adminRawKey, acmeLine)
+
+	tests := []struct {
+		name      string
+		body      string
+		want      []string
+		forbidden []string
+	}{
+		{"默认租户只看到自己的指标", scrapeMetrics(s, defaultKey).Body.String(),
+			[]string{defaultLine, `llm_gateway_request_duration_seconds_count{provider="openai"} 1`, `llm_gateway_upstreams{state="total"} 1`},
+			[]string{acmeKey.ID, "up-acme"}},
+		{"acme租户只看到自己的指标", scrapeMetrics(s, acmeRawKey).Body.String(),
+			[]string{acmeLine, `llm_gateway_request_duration_seconds_count{provider="openai"} 1`, `llm_gateway_upstreams{state="total"} 1`},
+			[]string{defaultKeyID, "up-openai"}},
+		{"admin Key看到全部租户", allBody,
+			[]string{defaultLine, acmeLine, `llm_gateway_request_duration_seconds_count{provider="openai"} 2`, `llm_gateway_upstreams{state="total"} 2`},
+			nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, want := range tt.want {
+				if !strings.Contains(tt.body, want) {
+					t.Errorf("指标缺少 %q:\n%s", want, tt.body)
+				}
+			}
+			for _, forbidden := range tt.forbidden {
+				if strings.Contains(tt.body, forbidden) {
+					t.Errorf("指标不应包含其他租户的 %q:\n%s", forbidden, tt.body)
+				}
+			}
+		})
+	}
+}
@@ -3,11 +3,16 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/iBreaker/llm-gateway/internal/client"
+	"github.com/iBreaker/llm-gateway/internal/ratelimit"
+	"github.com/iBreaker/llm-gateway/pkg/logger"
 	"github.com/iBreaker/llm-gateway/pkg/types"
 )
 
@@ -65,12 +70,18 @@ func (m *AuthMiddleware) Authenticate(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// 检查权限（这里简单检查，后续可以根据具体API端点细化）
-		if !m.hasRequiredPermission(gatewayKey, r.Method) {
+		// 检查权限：调用模型的端点需要write，只读端点需要read
+		if !hasPermission(gatewayKey, requiredPermission(r)) {
 			m.writeErrorResponse(w, http.StatusForbidden, "insufficient_permissions", "API key does not have required permissions")
 			return
 		}
 
+		// 检查Key的可用时间窗口
+		if !gatewayKey.IsWithinAccessWindow(time.Now()) {
+			m.writeErrorResponse(w, http.StatusForbidden, "outside_access_window", "API key is not allowed to be used at this time")
+			return
+		}
+
 		// 在请求上下文中保存Gateway Key信息，供后续处理使用
 		r.Header.Set("X-Gateway-Key-ID", gatewayKey.ID)
 		r.Header.Set("X-Gateway-Key-Name", gatewayKey.Name)
@@ -95,33 +106,38 @@ func (m *AuthMiddleware) Authenticate(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// hasRequiredPermission 检查权限
-func (m *AuthMiddleware) hasRequiredPermission(key *types.GatewayAPIKey, method string) bool {
-	// Admin权限可以访问所有接口
-	for _, perm := range key.Permissions {
-		if perm == types.PermissionAdmin {
-			return true
-		}
+// routePermissions 代理端点所需的权限：调用模型（产生上游费用）需要write，查询类端点需要read
+var routePermissions = map[string]types.Permission{
+	"/v1/chat/completions": types.PermissionWrite,
+	"/v1/completions":      types.PermissionWrite,
+	"/v1/messages":         types.PermissionWrite,
+	"/v1/embeddings":       types.PermissionWrite,
+	"/v1/models":           types.PermissionRead,
+	"/metrics":             types.PermissionRead,
+}
+
+// requiredPermission 请求所需的权限，异步任务查询（/v1/tasks/{id}）需要read，
+// 其余未在routePermissions中列出的端点按HTTP方法判断：GET/HEAD需要read，其余需要write
+func requiredPermission(r *http.Request) types.Permission {
+	if perm, ok := routePermissions[r.URL.Path]; ok {
+		return perm
+	}
+	if strings.HasPrefix(r.URL.Path, "/v1/tasks/") {
+		return types.PermissionRead
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return types.PermissionRead
 	}
+	return types.PermissionWrite
+}
 
-	// 根据HTTP方法检查权限
-	switch method {
-	case "GET":
-		// GET请求需要read权限
-		for _, perm := range key.Permissions {
-			if perm == types.PermissionRead {
-				return true
-			}
-		}
-	case "POST", "PUT", "DELETE", "PATCH":
-		// 写操作需要write权限
-		for _, perm := range key.Permissions {
-			if perm == types.PermissionWrite {
-				return true
-			}
+// hasPermission 检查Key是否拥有指定权限，admin权限可以访问所有接口
+func hasPermission(key *types.GatewayAPIKey, required types.Permission) bool {
+	for _, perm := range key.Permissions {
+		if perm == types.PermissionAdmin || perm == required {
+			return true
 		}
 	}
-
 	return false
 }
 
@@ -141,15 +157,17 @@ func (m *AuthMiddleware) writeErrorResponse(w http.ResponseWriter, statusCode in
 	_ = json.NewEncoder(w).Encode(errorResp)
 }
 
-// RateLimitMiddleware 限流中间件（简化版本）
+// RateLimitMiddleware 限流中间件
 type RateLimitMiddleware struct {
 	gatewayKeyMgr *client.GatewayKeyManager
+	limiter       ratelimit.RateLimiter
 }
 
 // NewRateLimitMiddleware 创建限流中间件
-func NewRateLimitMiddleware(gatewayKeyMgr *client.GatewayKeyManager) *RateLimitMiddleware {
+func NewRateLimitMiddleware(gatewayKeyMgr *client.GatewayKeyManager, limiter ratelimit.RateLimiter) *RateLimitMiddleware {
 	return &RateLimitMiddleware{
 		gatewayKeyMgr: gatewayKeyMgr,
+		limiter:       limiter,
 	}
 }
 
@@ -157,7 +175,7 @@ func NewRateLimitMiddleware(gatewayKeyMgr *client.GatewayKeyManager) *RateLimitM
 func (m *RateLimitMiddleware) RateLimit(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		keyID := r.Header.Get("X-Gateway-Key-ID")
-		if keyID == "" {
+		if keyID == "" || m.limiter == nil {
 			// 如果没有key ID，说明认证失败，直接跳过限流
 			next(w, r)
 			return
@@ -165,30 +183,91 @@ func (m *RateLimitMiddleware) RateLimit(next http.HandlerFunc) http.HandlerFunc
 
 		// 获取Gateway Key信息
 		gatewayKey, err := m.gatewayKeyMgr.GetKey(keyID)
+		if err != nil || gatewayKey.RateLimit == nil {
+			next(w, r)
+			return
+		}
+
+		result, err := m.limiter.Allow(r.Context(), keyID, gatewayKey.RateLimit)
 		if err != nil {
+			// 计数后端不可用时放行，避免限流组件故障导致整体不可用
+			logger.Warn("限流检查失败，放行请求 (key: %s): %v", keyID, err)
 			next(w, r)
 			return
 		}
 
-		// 简单的限流检查（这里是简化版本，实际应该使用更复杂的限流算法）
-		if gatewayKey.RateLimit != nil {
-			// 这里可以实现令牌桶或滑动窗口算法
-			// 暂时跳过具体实现，后续可以优化
-			_ = gatewayKey.RateLimit // 显式使用限流配置
+		if result.Limit > 0 {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		}
+
+		if !result.Allowed {
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			m.writeErrorResponse(w, http.StatusTooManyRequests, "rate_limit_exceeded",
+				fmt.Sprintf("Rate limit exceeded: %d requests per %s", result.Limit, result.Window))
+			return
 		}
 
 		next(w, r)
 	}
 }
 
-// CORSMiddleware CORS中间件
-func CORSMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// writeErrorResponse 写入错误响应
+func (m *RateLimitMiddleware) writeErrorResponse(w http.ResponseWriter, statusCode int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	errorResp := map[string]interface{}{
+		"error": map[string]string{
+			"type":    errorType,
+			"message": message,
+		},
+		"timestamp": time.Now().Unix(),
+	}
+
+	_ = json.NewEncoder(w).Encode(errorResp)
+}
+
+// 未配置时使用的CORS默认值，与引入CORS配置前的行为一致
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization", "traceparent", "tracestate", "Prefer", "X-Stream-Events"}
+)
+
+// CORSMiddleware CORS中间件：按配置设置跨域响应头并处理OPTIONS预检请求。
+// 来源不在允许列表中时不设置跨域头，预检请求返回403
+func CORSMiddleware(config types.CORSConfig, next http.HandlerFunc) http.HandlerFunc {
+	methods := strings.Join(defaultCORSMethods, ", ")
+	if len(config.AllowedMethods) > 0 {
+		methods = strings.Join(config.AllowedMethods, ", ")
+	}
+	headers := strings.Join(defaultCORSHeaders, ", ")
+	if len(config.AllowedHeaders) > 0 {
+		headers = strings.Join(config.AllowedHeaders, ", ")
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		origin := r.Header.Get("Origin")
+		allowOrigin, allowed := corsAllowOrigin(config, origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			if config.AllowCredentials && allowOrigin != "*" {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		if allowOrigin != "*" {
+			// 响应随请求来源变化，避免缓存把一个来源的响应返回给另一个来源
+			w.Header().Add("Vary", "Origin")
+		}
 
 		if r.Method == "OPTIONS" {
+			if origin != "" && !allowed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -197,6 +276,62 @@ func CORSMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// corsAllowOrigin 计算Access-Control-Allow-Origin的取值。
+// 允许任意来源时返回"*"，即使开启了allow_credentials也不回显来源（浏览器不会对"*"发送凭据），
+// 避免任意网站携带Web会话Cookie发起请求；明确列出的来源回显请求来源
+func corsAllowOrigin(config types.CORSConfig, origin string) (string, bool) {
+	anyOrigin := len(config.AllowedOrigins) == 0
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" {
+			anyOrigin = true
+			break
+		}
+	}
+
+	if anyOrigin {
+		return "*", true
+	}
+
+	if origin == "" {
+		return "", false
+	}
+	for _, allowed := range config.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// MaxBytesMiddleware 限制请求体大小：声明的Content-Length超限时直接返回413，
+// 否则由http.MaxBytesReader在读取超限时返回*http.MaxBytesError，由处理器转换为413
+func MaxBytesMiddleware(limit int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			writeRequestTooLarge(w, limit)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next(w, r)
+	}
+}
+
+// writeRequestTooLarge 写入请求体超限的413响应
+func writeRequestTooLarge(w http.ResponseWriter, limit int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+
+	errorResp := map[string]interface{}{
+		"error": map[string]string{
+			"type":    "request_too_large",
+			"message": fmt.Sprintf("Request body exceeds the limit of %d bytes", limit),
+		},
+		"timestamp": time.Now().Unix(),
+	}
+
+	_ = json.NewEncoder(w).Encode(errorResp)
+}
+
 // LoggingMiddleware 日志中间件
 func LoggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -234,6 +369,11 @@ func (rw *responseWriter) WriteHeader(statusCode int) {
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap 返回底层ResponseWriter，供http.ResponseController设置写超时等
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Flush 实现http.Flusher接口，支持流式响应
 func (rw *responseWriter) Flush() {
 	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
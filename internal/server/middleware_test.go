@@ -0,0 +1,157 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	restricted := types.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+	}
+
+	tests := []struct {
+		name            string
+		config          types.CORSConfig
+		method          string
+		origin          string
+		wantStatus      int
+		wantAllowOrigin string
+		wantCredentials string
+		wantNextCalled  bool
+	}{
+		{"默认配置允许任意来源", types.CORSConfig{}, http.MethodPost, "https://any.example.com", http.StatusOK, "*", "", true},
+		{"允许的来源回显", restricted, http.MethodPost, "https://app.example.com", http.StatusOK, "https://app.example.com", "true", true},
+		{"不允许的来源不设置跨域头", restricted, http.MethodPost, "https://evil.example.com", http.StatusOK, "", "", true},
+		{"预检请求-允许的来源", restricted, http.MethodOptions, "https://app.example.com", http.StatusOK, "https://app.example.com", "true", false},
+		{"预检请求-不允许的来源", restricted, http.MethodOptions, "https://evil.example.com", http.StatusForbidden, "", "", false},
+		{"任意来源时不回显来源也不允许凭据", types.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, http.MethodGet, "https://any.example.com", http.StatusOK, "*", "", true},
+		{"未配置来源时不允许凭据", types.CORSConfig{AllowCredentials: true}, http.MethodGet, "https://any.example.com", http.StatusOK, "*", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextCalled := false
+			handler := CORSMiddleware(tt.config, func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, "/v1/chat/completions", nil)
+			req.Header.Set("Origin", tt.origin)
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllowOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+			if nextCalled != tt.wantNextCalled {
+				t.Errorf("是否调用下游处理器 = %v, want %v", nextCalled, tt.wantNextCalled)
+			}
+		})
+	}
+
+	// 预检响应应返回配置的请求头
+	handler := CORSMiddleware(restricted, func(w http.ResponseWriter, r *http.Request) {})
+	req := httptest.NewRequest(http.MethodOptions, "/v1/messages", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, Authorization" {
+		t.Errorf("Access-Control-Allow-Headers = %q", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+}
+
+func TestAuthenticate_ExpiredKey(t *testing.T) {
+	s, rawKey := newTestGateway(t, "http://127.0.0.1:0", types.MetricsConfig{Enabled: true})
+
+	if rec := scrapeMetrics(s, rawKey); rec.Code != http.StatusOK {
+		t.Fatalf("未过期的Key status = %d, want 200", rec.Code)
+	}
+
+	key := s.clientMgr.ListKeys()[0]
+	past := time.Now().Add(-time.Second)
+	if err := s.clientMgr.UpdateKeyExpiresAt(key.ID, &past); err != nil {
+		t.Fatalf("UpdateKeyExpiresAt() error = %v", err)
+	}
+
+	if rec := scrapeMetrics(s, rawKey); rec.Code != http.StatusUnauthorized {
+		t.Errorf("过期的Key status = %d, want 401", rec.Code)
+	}
+}
+
+func TestAuthenticate_Permissions(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, _ := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	rawKeys := make(map[string]string)
+	for name, perms := range map[string][]types.Permission{
+		"read":  {types.PermissionRead},
+		"write": {types.PermissionWrite},
+		"admin": {types.PermissionAdmin},
+	} {
+		_, rawKey, err := s.clientMgr.CreateKey(name, perms)
+		if err != nil {
+			t.Fatalf("CreateKey() error = %v", err)
+		}
+		rawKeys[name] = rawKey
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"只读Key不能调用chat", "read", http.MethodPost, "/v1/chat/completions", http.StatusForbidden},
+		{"只读Key不能调用messages", "read", http.MethodPost, "/v1/messages", http.StatusForbidden},
+		{"只读Key可以查询模型列表", "read", http.MethodGet, "/v1/models", http.StatusOK},
+		{"只写Key可以调用chat", "write", http.MethodPost, "/v1/chat/completions", http.StatusOK},
+		{"只写Key不能查询模型列表", "write", http.MethodGet, "/v1/models", http.StatusForbidden},
+		{"只写Key不能查询异步任务", "write", http.MethodGet, "/v1/tasks/task_1", http.StatusForbidden},
+		{"admin Key可以调用chat", "admin", http.MethodPost, "/v1/chat/completions", http.StatusOK},
+		{"admin Key可以查询模型列表", "admin", http.MethodGet, "/v1/models", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.method == http.MethodPost {
+				body = strings.NewReader(`{"model":"gpt-4o","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`)
+			}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+rawKeys[tt.key])
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
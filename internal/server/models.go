@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// modelOwnerGateway 无法确定提供商时模型的owned_by
+const modelOwnerGateway = "llm-gateway"
+
+// modelEntry OpenAI模型列表中的单个模型
+type modelEntry struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// modelList OpenAI格式的模型列表响应
+type modelList struct {
+	Object string       `json:"object"`
+	Data   []modelEntry `json:"data"`
+}
+
+// HandleModels 以OpenAI列表格式返回当前Key可用的模型
+func (h *ProxyHandler) HandleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	gatewayKey, _ := r.Context().Value("gatewayKey").(*types.GatewayAPIKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(modelList{Object: "list", Data: h.availableModels(gatewayKey)})
+}
+
+// availableModels 汇总Key所属租户内上游账号探测到的模型和路由规则的源模型名，
+// 剔除按路由配置或允许/禁止列表会被拒绝的模型，结果按ID排序
+func (h *ProxyHandler) availableModels(gatewayKey *types.GatewayAPIKey) []modelEntry {
+	models := make(map[string]modelEntry)
+	add := func(id, owner string, created int64) {
+		if id == "" || strings.HasSuffix(id, "*") {
+			return
+		}
+		if _, exists := models[id]; exists {
+			return
+		}
+		if owner == "" {
+			owner = modelOwnerGateway
+		}
+		models[id] = modelEntry{ID: id, Object: "model", Created: created, OwnedBy: owner}
+	}
+
+	tenant := types.DefaultTenant
+	if gatewayKey != nil {
+		tenant = gatewayKey.TenantID()
+	}
+	if h.upstreamMgr != nil {
+		for _, account := range h.upstreamMgr.ListAccounts() {
+			if account.Status != "active" || account.TenantID() != tenant || account.Capabilities == nil {
+				continue
+			}
+			for _, model := range account.Capabilities.Models {
+				add(model, string(account.Provider), account.Capabilities.DiscoveredAt.Unix())
+			}
+		}
+	}
+
+	// 路由规则的源模型名（通配符规则无法枚举，跳过），Key级别规则优先
+	var routes []types.ModelRoute
+	if gatewayKey != nil && gatewayKey.ModelRoutes != nil {
+		routes = append(routes, gatewayKey.ModelRoutes.Routes...)
+	}
+	if h.modelRouteConfig != nil {
+		routes = append(routes, h.modelRouteConfig.Routes...)
+	}
+	for _, route := range routes {
+		if route.Enabled {
+			add(route.SourceModel, string(route.TargetProvider), 0)
+		}
+	}
+
+	result := make([]modelEntry, 0, len(models))
+	for id, entry := range models {
+		// 默认行为为reject时，未匹配路由规则的模型不可用
+		if ctx := h.modelRouteConfig.CreateContextWithKey(id, gatewayKey); ctx != nil && ctx.Rejected {
+			continue
+		}
+		// 允许/禁止列表限制的模型不可用
+		if h.modelRouteConfig.CheckModelAccessWithKey(id, gatewayKey) != nil {
+			continue
+		}
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
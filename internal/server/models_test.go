@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/config"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// listModels 使用rawKey请求模型列表
+func listModels(t *testing.T, s *HTTPServer, rawKey string) modelList {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer "+rawKey)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var list modelList
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return list
+}
+
+func TestHandleModels(t *testing.T) {
+	s, rawKey := newTestGateway(t, "http://127.0.0.1:0", types.MetricsConfig{})
+	if err := s.upstreamMgr.AddAccount(&types.UpstreamAccount{
+		ID:       "up-anthropic",
+		Name:     "anthropic",
+		Type:     types.UpstreamTypeAPIKey,
+		Provider: types.ProviderAnthropic,
+		APIKey:   "sk-ant",
+		Capabilities: &types.UpstreamCapabilities{
+			Models:       []string{"claude-3-5-sonnet-20241022", "claude-3-haiku-20240307"},
+			DiscoveredAt: time.Unix(1700000000, 0),
+		},
+	}); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+	s.proxyHandler.modelRouteConfig = &types.ModelRouteConfig{
+		Routes: []types.ModelRoute{
+			{ID: "gpt4", SourceModel: "gpt-4", TargetModel: "claude-3-5-sonnet-20241022", TargetProvider: types.ProviderAnthropic, Enabled: true},
+			{ID: "all-claude", SourceModel: "claude-*", TargetModel: "claude-3-haiku-20240307", Enabled: false},
+		},
+	}
+
+	list := listModels(t, s, rawKey)
+	if list.Object != "list" {
+		t.Errorf("object = %q, want list", list.Object)
+	}
+	want := []modelEntry{
+		{ID: "claude-3-5-sonnet-20241022", Object: "model", Created: 1700000000, OwnedBy: "anthropic"},
+		{ID: "claude-3-haiku-20240307", Object: "model", Created: 1700000000, OwnedBy: "anthropic"},
+		{ID: "gpt-4", Object: "model", OwnedBy: "anthropic"},
+	}
+	if len(list.Data) != len(want) {
+		t.Fatalf("data = %+v, want %+v", list.Data, want)
+	}
+	for i := range want {
+		if list.Data[i] != want[i] {
+			t.Errorf("data[%d] = %+v, want %+v", i, list.Data[i], want[i])
+		}
+	}
+
+	// 默认行为为reject的Key只能看到路由规则（Key级别与全局）匹配的模型
+	key, restrictedKey, err := s.clientMgr.CreateKey("restricted", []types.Permission{types.PermissionRead})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	configMgr := s.configMgr.(*config.ConfigManager)
+	if err := configMgr.UpdateGatewayKey(key.ID, func(k *types.GatewayAPIKey) error {
+		k.ModelRoutes = &types.ModelRouteConfig{
+			DefaultBehavior: types.DefaultBehaviorReject,
+			Routes: []types.ModelRoute{
+				{ID: "haiku", SourceModel: "claude-3-haiku*", TargetModel: "claude-3-haiku-20240307", Enabled: true},
+				{ID: "fast", SourceModel: "fast", TargetModel: "claude-3-haiku-20240307", Enabled: true},
+			},
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateGatewayKey() error = %v", err)
+	}
+
+	list = listModels(t, s, restrictedKey)
+	var ids []string
+	for _, model := range list.Data {
+		ids = append(ids, model.ID)
+	}
+	if len(ids) != 3 || ids[0] != "claude-3-haiku-20240307" || ids[1] != "fast" || ids[2] != "gpt-4" {
+		t.Errorf("受限Key可见模型 = %v, want [claude-3-haiku-20240307 fast gpt-4]", ids)
+	}
+}
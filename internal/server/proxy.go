@@ -2,18 +2,23 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/iBreaker/llm-gateway/internal/cache"
 	"github.com/iBreaker/llm-gateway/internal/client"
 	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/internal/moderation"
 	"github.com/iBreaker/llm-gateway/internal/router"
 	"github.com/iBreaker/llm-gateway/internal/upstream"
 	"github.com/iBreaker/llm-gateway/pkg/debug"
@@ -23,20 +28,74 @@ import (
 
 // ProxyHandler 代理处理器
 type ProxyHandler struct {
-	gatewayKeyMgr    *client.GatewayKeyManager
-	upstreamMgr      *upstream.UpstreamManager
-	router           *router.RequestRouter
-	converter        *converter.Manager
-	httpClient       *http.Client
-	modelRouteConfig *types.ModelRouteConfig
+	gatewayKeyMgr      *client.GatewayKeyManager
+	upstreamMgr        *upstream.UpstreamManager
+	router             *router.RequestRouter
+	converter          *converter.Manager
+	httpClient         *http.Client
+	modelRouteConfig   *types.ModelRouteConfig
+	pricingConfig      *types.PricingConfig
+	jsonRepair         bool
+	moderator          *moderation.Checker
+	capabilities       types.ModelCapabilities
+	streamWriteTimeout time.Duration
+	maxStreamDuration  time.Duration // 0表示不限制
+	truncateReason     string
+	maxResponseBytes   int64 // 非流式响应体上限
+	maxStreamBytes     int64 // 流式响应累计字节上限
+	retryPolicy        *retryPolicy
+	responseCache      *cache.ResponseCache // 未启用时为nil
+	idempotency        *idempotencyStore    // 按(Gateway Key, Idempotency-Key)保存的成功响应和处理中的请求
+	sizeStats          *sizeStats           // 未启用时为nil
+	metrics            *gatewayMetrics
+	maxFailovers       int // 上游失败时最多换用其他账号的次数
+	maxTokensLimit     types.MaxTokensLimitConfig
+	tasks              *TaskManager
+	streamSlots        *streamConcurrency // 按Key限制并发流式连接数
+	streams            *streamDrain       // 进行中的流式响应，优雅关闭时通知其结束
+	userAgent          string             // 上游请求的User-Agent，为空时按提供商使用默认值
 }
 
 // httpStreamWriter HTTP流式写入器
+//
+// 上游读取与客户端写入在同一goroutine中串行进行：写客户端阻塞时不会继续读上游，
+// 积压由TCP窗口反压到上游，网关内不会无限缓冲。为避免慢客户端长期占用连接，
+// 每次写入设置写超时，超时或写失败时返回错误以终止上游读取。
 type httpStreamWriter struct {
-	writer      http.ResponseWriter
-	flusher     http.Flusher
-	totalTokens *int
-	trace       *debug.RequestTrace
+	writer       http.ResponseWriter
+	flusher      http.Flusher
+	controller   *http.ResponseController
+	writeTimeout time.Duration
+	usage        converter.StreamUsage // 上游报告的累计token用量
+	trace        *debug.RequestTrace
+	content      strings.Builder // 启用trace时累积的完整响应文本
+	events       map[string]bool // 客户端需要的事件类型，nil表示全部发送
+	bytes        int             // 已写入客户端的字节数
+}
+
+// write 在写超时限制下写入并刷新一段SSE数据
+func (w *httpStreamWriter) write(data []byte) error {
+	if w.controller != nil && w.writeTimeout > 0 {
+		// 底层连接不支持写超时时（如测试用的ResponseRecorder）退化为普通写入
+		if err := w.controller.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return fmt.Errorf("设置写超时失败: %w", err)
+		}
+	}
+
+	n, err := w.writer.Write(data)
+	w.bytes += n
+	if err != nil {
+		return fmt.Errorf("写入客户端失败（客户端断开或消费过慢）: %w", err)
+	}
+
+	if w.controller != nil {
+		if err := w.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return fmt.Errorf("刷新客户端失败（客户端断开或消费过慢）: %w", err)
+		}
+	} else {
+		w.flusher.Flush()
+	}
+	return nil
 }
 
 // WriteChunk 写入数据块
@@ -47,14 +106,16 @@ func (w *httpStreamWriter) WriteChunk(chunk *converter.StreamChunk) error {
 
 	if chunk.IsDone {
 		rawData = []byte("[DONE]")
-		_, _ = fmt.Fprintf(w.writer, "data: [DONE]\n\n")
 		convertedData = []byte("data: [DONE]\n\n")
+		if err := w.write(convertedData); err != nil {
+			return err
+		}
 
 		// 记录流式响应结束
 		if w.trace != nil {
 			w.trace.AddStreamChunk("done", rawData, convertedData, time.Since(chunkStart))
 		}
-	} else {
+	} else if chunk.Data != nil && allowStreamEvent(w.events, chunk.EventType) {
 		data, err := json.Marshal(chunk.Data)
 		if err != nil {
 			return err
@@ -63,10 +124,11 @@ func (w *httpStreamWriter) WriteChunk(chunk *converter.StreamChunk) error {
 
 		if chunk.EventType != "" {
 			convertedData = []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", chunk.EventType, string(data)))
-			_, _ = fmt.Fprintf(w.writer, "event: %s\ndata: %s\n\n", chunk.EventType, string(data))
 		} else {
 			convertedData = []byte(fmt.Sprintf("data: %s\n\n", string(data)))
-			_, _ = fmt.Fprintf(w.writer, "data: %s\n\n", string(data))
+		}
+		if err := w.write(convertedData); err != nil {
+			return err
 		}
 
 		// 记录流式响应块
@@ -76,19 +138,18 @@ func (w *httpStreamWriter) WriteChunk(chunk *converter.StreamChunk) error {
 				eventType = "chunk"
 			}
 			w.trace.AddStreamChunk(eventType, rawData, convertedData, time.Since(chunkStart))
+			w.content.WriteString(streamChunkText(rawData))
 		}
 	}
 
-	w.flusher.Flush()
-	*w.totalTokens += chunk.Tokens
+	// 仅携带用量的数据块（Data为nil）不写给客户端，只合并用量
+	w.usage.Merge(chunk.Usage)
 	return nil
 }
 
 // WriteDone 写入完成信号
 func (w *httpStreamWriter) WriteDone() error {
-	_, _ = fmt.Fprintf(w.writer, "data: [DONE]\n\n")
-	w.flusher.Flush()
-	return nil
+	return w.write([]byte("data: [DONE]\n\n"))
 }
 
 // NewProxyHandler 创建代理处理器
@@ -99,6 +160,9 @@ func NewProxyHandler(
 	converter *converter.Manager,
 	proxyConfig *types.ProxyConfig,
 	modelRouteConfig *types.ModelRouteConfig,
+	pricingConfig *types.PricingConfig,
+	moderator *moderation.Checker,
+	capabilities types.ModelCapabilities,
 ) *ProxyHandler {
 	// 验证模型路由配置
 	if modelRouteConfig != nil {
@@ -130,22 +194,127 @@ func NewProxyHandler(
 		responseTimeout = time.Duration(proxyConfig.ResponseTimeout) * time.Second
 	}
 
-	return &ProxyHandler{
-		gatewayKeyMgr:    gatewayKeyMgr,
-		upstreamMgr:      upstreamMgr,
-		router:           router,
-		converter:        converter,
-		modelRouteConfig: modelRouteConfig,
+	streamWriteTimeout := 30 * time.Second // 默认30秒
+	if proxyConfig != nil && proxyConfig.StreamWriteTimeout > 0 {
+		streamWriteTimeout = time.Duration(proxyConfig.StreamWriteTimeout) * time.Second
+	}
+
+	// 上游连接池：默认每个主机保留的空闲连接数（Go默认为2）在高并发下会导致频繁建连
+	maxIdleConns, maxIdleConnsPerHost, maxConnsPerHost := 100, 32, 0
+	if proxyConfig != nil {
+		if proxyConfig.MaxIdleConns > 0 {
+			maxIdleConns = proxyConfig.MaxIdleConns
+		}
+		if proxyConfig.MaxIdleConnsPerHost > 0 {
+			maxIdleConnsPerHost = proxyConfig.MaxIdleConnsPerHost
+		}
+		maxConnsPerHost = proxyConfig.MaxConnsPerHost
+	}
+
+	var maxStreamDuration time.Duration
+	var truncateReason string
+	if proxyConfig != nil {
+		maxStreamDuration = time.Duration(proxyConfig.MaxStreamDuration) * time.Second
+		truncateReason = proxyConfig.StreamTruncateReason
+		if truncateReason != "" && !validTruncateReason(truncateReason) {
+			logger.Warn("stream_truncate_reason %q 不是OpenAI或Anthropic格式的结束原因，将使用各格式的默认值", truncateReason)
+		}
+	}
+
+	maxResponseBytes := int64(defaultMaxResponseBytes)
+	maxStreamBytes := int64(defaultMaxStreamResponseBytes)
+	if proxyConfig != nil && proxyConfig.MaxResponseBytes > 0 {
+		maxResponseBytes = proxyConfig.MaxResponseBytes
+	}
+	if proxyConfig != nil && proxyConfig.MaxStreamResponseBytes > 0 {
+		maxStreamBytes = proxyConfig.MaxStreamResponseBytes
+	}
+
+	maxFailovers := defaultMaxFailovers
+	if proxyConfig != nil && proxyConfig.MaxFailovers != 0 {
+		maxFailovers = proxyConfig.MaxFailovers
+		if maxFailovers < 0 {
+			maxFailovers = 0
+		}
+	}
+
+	var responseCache *cache.ResponseCache
+	if proxyConfig != nil && proxyConfig.Cache.Enabled {
+		ttl := 300 * time.Second // 默认5分钟
+		if proxyConfig.Cache.TTLSeconds > 0 {
+			ttl = time.Duration(proxyConfig.Cache.TTLSeconds) * time.Second
+		}
+		maxEntries := 1000
+		if proxyConfig.Cache.MaxEntries > 0 {
+			maxEntries = proxyConfig.Cache.MaxEntries
+		}
+		responseCache = cache.NewResponseCache(maxEntries, ttl)
+		logger.Info("响应缓存已启用，TTL: %v, 最大条目数: %d", ttl, maxEntries)
+	}
+
+	var idempotencyConfig *types.IdempotencyConfig
+	var asyncTaskConfig *types.AsyncTaskConfig
+	if proxyConfig != nil {
+		idempotencyConfig = &proxyConfig.Idempotency
+		asyncTaskConfig = &proxyConfig.AsyncTasks
+	}
+
+	var userAgent string
+	var maxTokensLimit types.MaxTokensLimitConfig
+	if proxyConfig != nil {
+		userAgent = proxyConfig.UserAgent
+		maxTokensLimit = proxyConfig.MaxTokensLimit
+	}
+
+	var stats *sizeStats
+	if proxyConfig != nil {
+		stats = newSizeStats(&proxyConfig.SizeStats)
+		if stats != nil {
+			logger.Info("请求/响应体积分布统计已启用")
+		}
+	}
+
+	h := &ProxyHandler{
+		gatewayKeyMgr:      gatewayKeyMgr,
+		upstreamMgr:        upstreamMgr,
+		router:             router,
+		converter:          converter,
+		modelRouteConfig:   modelRouteConfig,
+		pricingConfig:      pricingConfig,
+		jsonRepair:         proxyConfig != nil && proxyConfig.JSONRepair,
+		moderator:          moderator,
+		capabilities:       capabilities,
+		streamWriteTimeout: streamWriteTimeout,
+		maxStreamDuration:  maxStreamDuration,
+		truncateReason:     truncateReason,
+		maxResponseBytes:   maxResponseBytes,
+		maxStreamBytes:     maxStreamBytes,
+		retryPolicy:        newRetryPolicy(proxyConfig),
+		responseCache:      responseCache,
+		idempotency:        newIdempotencyStore(idempotencyConfig),
+		sizeStats:          stats,
+		metrics:            newGatewayMetrics(),
+		maxFailovers:       maxFailovers,
+		maxTokensLimit:     maxTokensLimit,
+		tasks:              NewTaskManager(asyncTaskConfig),
+		streamSlots:        newStreamConcurrency(),
+		streams:            newStreamDrain(),
+		userAgent:          userAgent,
 		httpClient: &http.Client{
 			Timeout: streamTimeout,
 			Transport: &http.Transport{
 				Proxy:                 http.ProxyFromEnvironment,
+				MaxIdleConns:          maxIdleConns,
+				MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+				MaxConnsPerHost:       maxConnsPerHost,
 				IdleConnTimeout:       idleTimeout,
 				TLSHandshakeTimeout:   tlsTimeout,
 				ResponseHeaderTimeout: responseTimeout,
 			},
 		},
 	}
+	h.retryPolicy.onRateLimited = h.rotateRateLimitedKey
+	return h
 }
 
 // HandleChatCompletions 处理聊天完成请求
@@ -163,6 +332,48 @@ func (h *ProxyHandler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 	h.handleProxyRequest(w, r, "/v1/messages")
 }
 
+// HandleTask 查询异步任务状态与结果: GET /v1/tasks/{id}
+func (h *ProxyHandler) HandleTask(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	taskID := strings.TrimPrefix(r.URL.Path, "/v1/tasks/")
+	task, ok := h.tasks.Get(taskID)
+	// 任务只对提交它的Gateway Key可见
+	if taskID == "" || !ok || task.KeyID != r.Header.Get("X-Gateway-Key-ID") {
+		h.writeErrorResponse(w, http.StatusNotFound, "task_not_found", fmt.Sprintf("Task %s not found", taskID))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(task)
+}
+
+// checkRequestContentType 校验请求体类型：接受 application/json 及 +json 结构化后缀类型，
+// 未设置Content-Type时按JSON处理以兼容简单客户端。multipart等类型预留给后续的文件上传端点。
+func checkRequestContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q", contentType)
+	}
+
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return nil
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return fmt.Errorf("Content-Type %s is not supported on this endpoint yet, use application/json", mediaType)
+	default:
+		return fmt.Errorf("unsupported Content-Type %s, expected application/json", mediaType)
+	}
+}
+
 // generateRequestID 生成请求ID
 func (h *ProxyHandler) generateRequestID() string {
 	bytes := make([]byte, 8)
@@ -180,6 +391,24 @@ func (h *ProxyHandler) handleProxyRequest(w http.ResponseWriter, r *http.Request
 	// 初始化调试跟踪
 	trace := debug.NewRequestTrace(requestID)
 
+	// 提取或生成W3C Trace Context，并回写给客户端便于关联
+	traceCtx := extractTraceContext(r)
+	w.Header().Set(headerTraceParent, traceCtx.TraceParent())
+	if trace != nil {
+		trace.SetTraceContext(traceCtx.TraceID, traceCtx.ParentID, traceCtx.SpanID)
+	}
+	logger.Debug("请求 %s 关联trace: trace_id=%s span_id=%s parent_id=%s", requestID, traceCtx.TraceID, traceCtx.SpanID, traceCtx.ParentID)
+
+	// 0. 校验Content-Type
+	if err := checkRequestContentType(r.Header.Get("Content-Type")); err != nil {
+		if trace != nil {
+			trace.SetError(err, "content_type")
+			trace.SaveAsync()
+		}
+		h.rejectRequest(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", err.Error())
+		return
+	}
+
 	// 1. 读取请求体
 	requestBody, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -187,10 +416,17 @@ func (h *ProxyHandler) handleProxyRequest(w http.ResponseWriter, r *http.Request
 			trace.SetError(err, "read_request_body")
 			trace.SaveAsync()
 		}
-		h.writeErrorResponse(w, http.StatusBadRequest, "invalid_request_body", "Failed to read request body")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.metrics.recordRejected(requestTenant(r), r.Header.Get("X-Gateway-Key-ID"), http.StatusRequestEntityTooLarge)
+			writeRequestTooLarge(w, maxBytesErr.Limit)
+			return
+		}
+		h.rejectRequest(w, r, http.StatusBadRequest, "invalid_request_body", "Failed to read request body")
 		return
 	}
 	defer func() { _ = r.Body.Close() }()
+	h.sizeStats.recordRequest(len(requestBody))
 
 	// 记录原始客户端请求
 	if trace != nil {
@@ -204,16 +440,34 @@ func (h *ProxyHandler) handleProxyRequest(w http.ResponseWriter, r *http.Request
 			trace.SetError(err, "parse_request")
 			trace.SaveAsync()
 		}
-		h.writeErrorResponse(w, http.StatusBadRequest, "request_parse_error", fmt.Sprintf("Failed to parse request: %v", err))
+		h.rejectRequest(w, r, http.StatusBadRequest, "request_parse_error", fmt.Sprintf("Failed to parse request: %v", err))
 		return
 	}
 
-	// 3. 模型路由处理（优先使用Key级别配置）
+	// 3. 模型访问控制：全局和Key级别的允许/禁止列表
+	gatewayKey, _ := r.Context().Value("gatewayKey").(*types.GatewayAPIKey)
+	if err := h.modelRouteConfig.CheckModelAccessWithKey(tempReq.Model, gatewayKey); err != nil {
+		if trace != nil {
+			trace.SetError(err, "model_access")
+			trace.SaveAsync()
+		}
+		h.rejectRequest(w, r, http.StatusForbidden, "model_not_allowed", fmt.Sprintf("Model %s is not allowed for this API key: %v", tempReq.Model, err))
+		return
+	}
+
+	// 3.1 模型路由处理（优先使用Key级别配置）
 	var modelRouteContext *types.ModelRouteContext
 	if h.modelRouteConfig != nil {
-		gatewayKey, _ := r.Context().Value("gatewayKey").(*types.GatewayAPIKey)
 		modelRouteContext = h.modelRouteConfig.CreateContextWithKey(tempReq.Model, gatewayKey)
 	}
+	if modelRouteContext != nil && modelRouteContext.Rejected {
+		if trace != nil {
+			trace.SetError(fmt.Errorf("model %s has no matching route", tempReq.Model), "model_route")
+			trace.SaveAsync()
+		}
+		h.rejectRequest(w, r, http.StatusBadRequest, "model_not_allowed", fmt.Sprintf("Model %s is not allowed: no matching model route", tempReq.Model))
+		return
+	}
 
 	// 4. 重新解析请求并应用模型路由
 	proxyReq, _, err := h.converter.ParseRequestWithModelRoute(requestBody, clientEndpoint, modelRouteContext)
@@ -222,26 +476,77 @@ func (h *ProxyHandler) handleProxyRequest(w http.ResponseWriter, r *http.Request
 			trace.SetError(err, "parse_request_with_route")
 			trace.SaveAsync()
 		}
-		h.writeErrorResponse(w, http.StatusBadRequest, "request_parse_error", fmt.Sprintf("Failed to parse request with model route: %v", err))
+		h.rejectRequest(w, r, http.StatusBadRequest, "request_parse_error", fmt.Sprintf("Failed to parse request with model route: %v", err))
 		return
 	}
 
 	// 5. 设置请求上下文信息
 	keyID := r.Header.Get("X-Gateway-Key-ID")
 	proxyReq.GatewayKeyID = keyID
+	proxyReq.TraceParent = traceCtx.TraceParent()
+	proxyReq.TraceState = traceCtx.State
+	proxyReq.RepairJSON = h.jsonRepair && converter.WantsStructuredOutput(requestBody)
+	proxyReq.StreamEvents = parseStreamEvents(r)
+	proxyReq.UpstreamTimeout = gatewayKey.RequestTimeout()
+	upstreamCtx, cancelUpstream := h.upstreamContext(r.Context(), proxyReq.UpstreamTimeout, proxyReq.Stream != nil && *proxyReq.Stream)
+	defer cancelUpstream()
+	proxyReq.Context = upstreamCtx
+	proxyReq.IdempotencyKey, err = parseIdempotencyKey(r)
+	if err != nil {
+		h.rejectRequest(w, r, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
 
 	// 记录模型路由后的请求
 	if trace != nil {
 		trace.SetUnifiedRequest(proxyReq)
 	}
 
-	// 6. 确定目标提供商（根据模型路由上下文或模型名称）
+	// 5.1 模型能力预校验（按路由后的目标模型）
+	if err := h.capabilities.CheckRequest(proxyReq); err != nil {
+		if trace != nil {
+			trace.SetError(err, "model_capability")
+			trace.SaveAsync()
+		}
+		h.rejectRequest(w, r, http.StatusBadRequest, "unsupported_feature", err.Error())
+		return
+	}
+
+	// 5.2 内容安全预检
+	if h.moderator != nil {
+		decision := h.moderator.CheckRequest(r.Context(), proxyReq)
+		if decision.Err != nil {
+			logger.Warn("请求 %s 内容审核失败: %v", requestID, decision.Err)
+		} else if decision.Result.Flagged {
+			logger.Warn("请求 %s 内容审核命中 (key: %s): %v", requestID, keyID, decision.Result.Categories)
+		}
+		if decision.Blocked {
+			if trace != nil {
+				trace.SetError(fmt.Errorf("moderation blocked request"), "moderation")
+				trace.SaveAsync()
+			}
+			if decision.Err != nil {
+				h.rejectRequest(w, r, http.StatusServiceUnavailable, "moderation_unavailable", "Content moderation is unavailable")
+			} else {
+				h.rejectRequest(w, r, http.StatusBadRequest, "content_policy_violation", "Request content was rejected by content moderation")
+			}
+			return
+		}
+	}
+
+	// 6. 确定目标提供商（根据模型路由上下文或模型名称；仅补全别名时按补全后的模型名判断）
 	var targetProvider types.Provider
-	if modelRouteContext != nil && modelRouteContext.Enabled {
+	if modelRouteContext != nil && modelRouteContext.Enabled && modelRouteContext.TargetProvider != "" {
 		targetProvider = modelRouteContext.TargetProvider
+	} else if modelRouteContext != nil && modelRouteContext.Enabled && modelRouteContext.Rewrite {
+		// 只改写模型名的规则不改变提供商选择
+		targetProvider = h.router.DetermineProvider(modelRouteContext.OriginalModel)
 	} else {
 		targetProvider = h.router.DetermineProvider(proxyReq.Model)
 	}
+	if modelRouteContext != nil && modelRouteContext.Rewrite && h.modelRouteLogging(gatewayKey) {
+		logger.Info("请求 %s 模型改写: %s -> %s (规则ID: %s, 提供商: %s)", requestID, modelRouteContext.OriginalModel, modelRouteContext.TargetModel, modelRouteContext.RouteRuleID, targetProvider)
+	}
 
 	// 5.1. 通过 converter 获取上游路径
 	upstreamPath, err := h.converter.GetUpstreamPath(targetProvider, clientEndpoint)
@@ -250,21 +555,55 @@ func (h *ProxyHandler) handleProxyRequest(w http.ResponseWriter, r *http.Request
 			trace.SetError(err, "get_upstream_path")
 			trace.SaveAsync()
 		}
-		h.writeErrorResponse(w, http.StatusInternalServerError, "upstream_path_error", fmt.Sprintf("Failed to get upstream path: %v", err))
+		h.rejectRequest(w, r, http.StatusInternalServerError, "upstream_path_error", fmt.Sprintf("Failed to get upstream path: %v", err))
 		return
 	}
 
-	// 6. 选择上游账号
-	upstreamAccount, err := h.router.SelectUpstream(targetProvider)
+	// 6. 选择上游账号（只在Key所属租户的账号中选择）
+	tenant := requestTenant(r)
+	upstreamAccount, selection, err := h.router.SelectUpstreamWithReason(targetProvider, tenant, nil)
+	// 6.1 目标提供商没有可用上游时，改用配置的回退模型重新路由一次
+	if fallbackModel := h.modelRouteConfig.FallbackModelWithKey(gatewayKey); err != nil && fallbackModel != "" && fallbackModel != proxyReq.Model {
+		fallbackProvider := h.router.DetermineProvider(fallbackModel)
+		fallbackPath, pathErr := h.converter.GetUpstreamPath(fallbackProvider, clientEndpoint)
+		if checkErr := h.checkFallbackModel(fallbackModel, proxyReq, gatewayKey); checkErr != nil {
+			logger.Warn("请求 %s 不能回退到模型 %s: %v", requestID, fallbackModel, checkErr)
+		} else if pathErr == nil {
+			fallbackAccount, fallbackSelection, fallbackErr := h.router.SelectUpstreamWithReason(fallbackProvider, tenant, nil)
+			if fallbackErr == nil {
+				logger.Info("请求 %s 模型 %s 没有可用上游(提供商: %s)，回退到模型 %s (提供商: %s)", requestID, proxyReq.Model, targetProvider, fallbackModel, fallbackProvider)
+				proxyReq.Model = fallbackModel
+				targetProvider, upstreamPath = fallbackProvider, fallbackPath
+				upstreamAccount, selection, err = fallbackAccount, fallbackSelection, nil
+			} else {
+				logger.Warn("请求 %s 回退模型 %s 同样没有可用上游(提供商: %s): %v", requestID, fallbackModel, fallbackProvider, fallbackErr)
+			}
+		}
+	}
+	trace.SetUpstreamSelection(string(selection.Strategy), selection.Candidates, selection.Chosen, selection.Reason)
 	if err != nil {
 		if trace != nil {
 			trace.SetError(err, "select_upstream")
 			trace.SaveAsync()
 		}
-		h.writeErrorResponse(w, http.StatusServiceUnavailable, "no_upstream_available", fmt.Sprintf("No available upstream for provider %s: %v", targetProvider, err))
+		h.rejectRequest(w, r, http.StatusServiceUnavailable, "no_upstream_available", fmt.Sprintf("No available upstream for provider %s: %v", targetProvider, err))
 		return
 	}
 	proxyReq.UpstreamID = upstreamAccount.ID
+	// 选择账号时已预留进行中请求名额，请求结束（流式请求为输出结束）时释放；
+	// 换账号时名额随UpstreamID转移（见callWithFailover）
+	releaseUpstream := true
+	defer func() {
+		if releaseUpstream {
+			h.router.ReleaseUpstream(proxyReq.UpstreamID)
+		}
+	}()
+
+	// 6.2 max_tokens超过上游提供商的上限时截断，而不是转发上游会拒绝的值
+	if limit := h.maxTokensLimit.LimitFor(upstreamAccount.Provider); limit > 0 && proxyReq.MaxTokens > limit {
+		logger.Info("请求 %s max_tokens %d 超过%s上限，截断为 %d", requestID, proxyReq.MaxTokens, upstreamAccount.Provider, limit)
+		proxyReq.MaxTokens = limit
+	}
 
 	// 记录上下文信息
 	if trace != nil {
@@ -274,8 +613,70 @@ func (h *ProxyHandler) handleProxyRequest(w http.ResponseWriter, r *http.Request
 	// 7. 根据上游账号类型注入特殊处理
 	h.converter.InjectSystemPrompt(proxyReq, upstreamAccount.Provider, upstreamAccount.Type)
 
-	// 8. 根据stream参数选择处理方式
+	// 8. 异步模式：立即返回任务ID，后台完成请求供客户端轮询
+	if wantsAsync(r) {
+		if proxyReq.Stream != nil && *proxyReq.Stream {
+			h.rejectRequest(w, r, http.StatusBadRequest, "async_stream_not_supported", "Async mode does not support streaming requests")
+			return
+		}
+
+		task, err := h.tasks.Create(keyID)
+		if err != nil {
+			logger.Warn("请求 %s 异步任务创建失败: %v", requestID, err)
+			if trace != nil {
+				trace.SetError(err, "async_task_limit")
+				trace.SaveAsync()
+			}
+			// 请求没有发往上游，撤销选择账号时记录的熔断探测
+			releaseUpstream = false
+			h.router.CancelUpstream(proxyReq.UpstreamID)
+			w.Header().Set("Retry-After", "1")
+			h.rejectRequest(w, r, http.StatusTooManyRequests, "async_task_limit_exceeded", "Too many pending async tasks: "+err.Error())
+			return
+		}
+		logger.Info("请求 %s 以异步模式提交，任务ID: %s", requestID, task.ID)
+		releaseUpstream = false
+		// 客户端收到任务ID后即断开，后台请求不随其取消，Key超时从后台请求开始计算
+		taskCtx, cancelTask := h.upstreamContext(context.WithoutCancel(r.Context()), proxyReq.UpstreamTimeout, false)
+		proxyReq.Context = taskCtx
+		go func() {
+			defer cancelTask()
+			defer h.router.ReleaseUpstream(proxyReq.UpstreamID)
+			recorder := newTaskResponseWriter()
+			h.handleNonStreamResponse(recorder, upstreamAccount, proxyReq, upstreamPath, requestFormat, keyID, startTime, trace)
+			h.tasks.Complete(task.ID, recorder.statusCode, recorder.body.Bytes())
+		}()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/v1/tasks/"+task.ID)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(task)
+		return
+	}
+
+	// 9. 流式请求占用Key的并发流式连接名额，超出上限时拒绝
 	if proxyReq.Stream != nil && *proxyReq.Stream {
+		gatewayKey, _ := r.Context().Value("gatewayKey").(*types.GatewayAPIKey)
+		if !h.streamSlots.acquire(gatewayKey) {
+			if trace != nil {
+				trace.SetError(fmt.Errorf("too many concurrent streams"), "stream_concurrency")
+				trace.SaveAsync()
+			}
+			releaseUpstream = false
+			h.router.CancelUpstream(proxyReq.UpstreamID)
+			w.Header().Set("Retry-After", "1")
+			h.rejectRequest(w, r, http.StatusTooManyRequests, "concurrent_stream_limit_exceeded",
+				fmt.Sprintf("Too many concurrent streaming requests: limit is %d per key", maxConcurrentStreams(gatewayKey)))
+			return
+		}
+		defer h.streamSlots.release(gatewayKey)
+	}
+
+	// 10. 根据stream参数选择处理方式
+	if proxyReq.Stream != nil && *proxyReq.Stream && wantsStreamAggregate(r) {
+		// 调试：流式请求上游，聚合为完整JSON返回
+		h.handleAggregatedStreamResponse(w, upstreamAccount, proxyReq, upstreamPath, requestFormat, keyID, startTime, trace, modelRouteContext)
+	} else if proxyReq.Stream != nil && *proxyReq.Stream {
 		// 流式响应处理
 		h.handleStreamResponse(w, upstreamAccount, proxyReq, upstreamPath, requestFormat, keyID, startTime, trace, modelRouteContext)
 	} else {
@@ -284,13 +685,98 @@ func (h *ProxyHandler) handleProxyRequest(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// modelRouteLogging 全局或Key级别的模型路由配置启用了路由日志
+func (h *ProxyHandler) modelRouteLogging(gatewayKey *types.GatewayAPIKey) bool {
+	if h.modelRouteConfig != nil && h.modelRouteConfig.EnableLogging {
+		return true
+	}
+	return gatewayKey != nil && gatewayKey.ModelRoutes != nil && gatewayKey.ModelRoutes.EnableLogging
+}
+
+// checkFallbackModel 回退模型与原模型一样需要通过模型访问控制和能力校验，否则Key被禁止的模型可以借回退被使用
+func (h *ProxyHandler) checkFallbackModel(model string, request *types.UnifiedRequest, gatewayKey *types.GatewayAPIKey) error {
+	if err := h.modelRouteConfig.CheckModelAccessWithKey(model, gatewayKey); err != nil {
+		return err
+	}
+	fallbackRequest := *request
+	fallbackRequest.Model = model
+	return h.capabilities.CheckRequest(&fallbackRequest)
+}
+
 // handleNonStreamResponse 处理非流式响应
 func (h *ProxyHandler) handleNonStreamResponse(w http.ResponseWriter, account *types.UpstreamAccount, request *types.UnifiedRequest, upstreamPath string, requestFormat converter.Format, keyID string, startTime time.Time, trace *debug.RequestTrace) {
+	// 可复现请求（带seed或temperature=0）优先命中响应缓存
+	var cacheKey string
+	if h.responseCache != nil && cache.IsCacheable(request) {
+		if key, err := cache.Key(string(requestFormat), request); err == nil {
+			cacheKey = key
+			if cached, ok := h.responseCache.Get(cacheKey); ok {
+				logger.Debug("响应缓存命中: %s", cacheKey)
+				if trace != nil {
+					trace.SetClientResponse(cached)
+					trace.SetDurations(time.Since(startTime), 0, 0)
+					trace.SaveAsync()
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(cached)
+				h.sizeStats.recordResponse(len(cached), 0, 0)
+				return
+			}
+		}
+	}
+
+	// 相同Idempotency-Key的重试直接返回首次成功的响应，不再调用上游，避免重复计费；
+	// 请求指纹复用响应缓存键，覆盖请求内容与Gateway Key
+	idempotencyKey := idempotencyCacheKey(request)
+	var idempotentResponse []byte // 成功时保存供重放，为nil表示请求失败，允许重试
+	if idempotencyKey != "" {
+		fingerprint, err := cache.Key(string(requestFormat), request)
+		if err != nil {
+			h.metrics.recordRejected(account.TenantID(), keyID, http.StatusInternalServerError)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "internal_error", fmt.Sprintf("Failed to fingerprint request: %v", err))
+			return
+		}
+		cached, err := h.idempotency.begin(idempotencyKey, fingerprint)
+		switch {
+		case errors.Is(err, errIdempotencyMismatch):
+			h.metrics.recordRejected(account.TenantID(), keyID, http.StatusUnprocessableEntity)
+			h.writeErrorResponse(w, http.StatusUnprocessableEntity, "idempotency_key_mismatch", err.Error())
+			return
+		case errors.Is(err, errIdempotencyInFlight):
+			h.metrics.recordRejected(account.TenantID(), keyID, http.StatusConflict)
+			w.Header().Set("Retry-After", "1")
+			h.writeErrorResponse(w, http.StatusConflict, "idempotency_key_in_use", err.Error())
+			return
+		case cached == nil:
+			defer func() { h.idempotency.finish(idempotencyKey, fingerprint, idempotentResponse) }()
+		default:
+			logger.Info("Idempotency-Key命中，重放已完成的响应 (key: %s)", keyID)
+			if trace != nil {
+				trace.SetClientResponse(cached)
+				trace.SetDurations(time.Since(startTime), 0, 0)
+				trace.SaveAsync()
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set(headerIdempotentReplayed, "true")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(cached)
+			h.sizeStats.recordResponse(len(cached), 0, 0)
+			return
+		}
+	}
+
 	conversionStart := time.Now()
 
 	// 调用上游API获取原始响应
 	upstreamStart := time.Now()
-	responseBytes, err := h.callUpstreamAPIRaw(account, request, upstreamPath, trace)
+	var responseBytes []byte
+	account, err := h.callWithFailover(account, request, func(candidate *types.UpstreamAccount) error {
+		var callErr error
+		responseBytes, callErr = h.callUpstreamAPIRaw(candidate, request, upstreamPath, trace)
+		return callErr
+	})
 	upstreamDuration := time.Since(upstreamStart)
 
 	if err != nil {
@@ -299,7 +785,7 @@ func (h *ProxyHandler) handleNonStreamResponse(w http.ResponseWriter, account *t
 			trace.SetDurations(time.Since(startTime), upstreamDuration, 0)
 			trace.SaveAsync()
 		}
-		h.handleUpstreamError(w, account, err)
+		h.handleUpstreamError(w, account, requestFormat, keyID, startTime, err)
 		return
 	}
 
@@ -310,6 +796,8 @@ func (h *ProxyHandler) handleNonStreamResponse(w http.ResponseWriter, account *t
 		upstreamFormat = converter.FormatAnthropic
 	case types.ProviderOpenAI, types.ProviderQwen:
 		upstreamFormat = converter.FormatOpenAI
+	case types.ProviderGoogle:
+		upstreamFormat = converter.FormatGemini
 	default:
 		upstreamFormat = converter.FormatOpenAI
 	}
@@ -327,6 +815,11 @@ func (h *ProxyHandler) handleNonStreamResponse(w http.ResponseWriter, account *t
 		return
 	}
 
+	// 可选：修复结构化输出中的JSON瑕疵
+	if request.RepairJSON {
+		transformedBytes = converter.RepairResponseJSON(requestFormat, transformedBytes)
+	}
+
 	// 记录转换后的客户端响应
 	if trace != nil {
 		trace.SetClientResponse(transformedBytes)
@@ -334,25 +827,32 @@ func (h *ProxyHandler) handleNonStreamResponse(w http.ResponseWriter, account *t
 		trace.SaveAsync()
 	}
 
-	// 记录成功统计
+	// 从转换后的客户端响应中提取token用量，记录成功统计和用量成本
 	duration := time.Since(startTime)
-	// TODO: 从transformedBytes中提取token使用信息
-	go h.recordSuccess(keyID, account.ID, duration, 0)
+	inputTokens, outputTokens := extractUsage(requestFormat, transformedBytes)
+	go h.recordSuccess(keyID, account, duration, int(inputTokens+outputTokens))
+	go h.recordCost(keyID, request.Model, inputTokens, outputTokens)
+
+	if cacheKey != "" {
+		h.responseCache.Set(cacheKey, transformedBytes)
+		w.Header().Set("X-Cache", "MISS")
+	}
+	if idempotencyKey != "" {
+		idempotentResponse = transformedBytes
+	}
 
 	// 返回响应
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write(transformedBytes)
+	h.sizeStats.recordResponse(len(transformedBytes), inputTokens, outputTokens)
 }
 
 // handleStreamResponse 处理流式响应
+//
+// 先建立上游连接并确认上游返回合法的200流式响应，再切换到SSE输出：连接失败、
+// 上游错误状态码、上游返回非流式响应等情况都以普通HTTP错误响应返回给客户端
 func (h *ProxyHandler) handleStreamResponse(w http.ResponseWriter, account *types.UpstreamAccount, request *types.UnifiedRequest, upstreamPath string, requestFormat converter.Format, keyID string, startTime time.Time, trace *debug.RequestTrace, modelRouteContext *types.ModelRouteContext) {
-	// 设置SSE响应头
-	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
 	// 获取Flusher确保实时推送
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -364,46 +864,103 @@ func (h *ProxyHandler) handleStreamResponse(w http.ResponseWriter, account *type
 		return
 	}
 
-	// 调用上游流式API
-	err := h.callUpstreamStreamAPI(w, flusher, account, request, upstreamPath, requestFormat, keyID, startTime, trace, modelRouteContext)
+	// 建立上游流式连接，此时尚未向客户端写入任何数据
+	resp, account, err := h.openStreamWithFailover(account, request, upstreamPath, trace)
 	if err != nil {
 		if trace != nil {
-			trace.SetError(err, "stream_processing")
+			trace.SetError(err, "stream_open")
 			trace.SaveAsync()
 		}
-		// 流式响应中的错误处理
-		h.writeStreamError(w, flusher, err)
+		h.handleUpstreamError(w, account, requestFormat, keyID, startTime, err)
 		return
 	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// 设置SSE响应头：不设置Content-Length，HTTP/1.1下按chunked逐块传输，HTTP/2下按数据帧发送
+	// （Connection为逐跳头部，HTTP/2下由net/http忽略）。no-transform和X-Accel-Buffering
+	// 禁止中间代理压缩或缓冲整个响应，每个事件写入后立即flush（见httpStreamWriter.write）
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-transform")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// 不需要显式调用WriteHeader，让Go在第一次写入时自动发送200状态码
+	// 这样可以避免与中间件包装器的WriteHeader冲突
+	flusher.Flush()
+
+	logger.Debug("开始处理流式响应")
+	err = h.processStreamResponse(w, flusher, newLimitedStreamBody(resp.Body, h.maxStreamBytes), account, requestFormat, keyID, request.Model, startTime, trace, modelRouteContext, request.StreamEvents)
+	if err != nil {
+		if trace != nil {
+			trace.SetError(err, "stream_processing")
+			trace.SaveAsync()
+		}
+		// SSE已开始输出，只能在流中通知错误
+		h.writeStreamError(w, flusher, requestFormat, err)
+	}
 }
 
-// callUpstreamStreamAPI 调用上游流式API
-func (h *ProxyHandler) callUpstreamStreamAPI(w http.ResponseWriter, flusher http.Flusher, account *types.UpstreamAccount, request *types.UnifiedRequest, path string, requestFormat converter.Format, keyID string, startTime time.Time, trace *debug.RequestTrace, modelRouteContext *types.ModelRouteContext) error {
-	logger.Debug("开始流式请求，上游ID: %s, Provider: %s", account.ID, account.Provider)
+// callUpstreamStreamAPI 调用上游流式API并将转换后的流写入w，返回最终使用的上游账号
+func (h *ProxyHandler) callUpstreamStreamAPI(w http.ResponseWriter, flusher http.Flusher, account *types.UpstreamAccount, request *types.UnifiedRequest, path string, requestFormat converter.Format, keyID string, startTime time.Time, trace *debug.RequestTrace, modelRouteContext *types.ModelRouteContext) (*types.UpstreamAccount, error) {
+	resp, account, err := h.openStreamWithFailover(account, request, path, trace)
+	if err != nil {
+		return account, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	flusher.Flush()
+
+	logger.Debug("开始处理流式响应")
+	// 开始处理流式响应
+	return account, h.processStreamResponse(w, flusher, newLimitedStreamBody(resp.Body, h.maxStreamBytes), account, requestFormat, keyID, request.Model, startTime, trace, modelRouteContext, request.StreamEvents)
+}
 
-	// 构建上游请求
-	upstreamReq, err := h.buildUpstreamRequest(account, request, path, trace)
+// openStreamWithFailover 建立上游流式连接，返回响应及最终使用的上游账号，调用方负责关闭响应体。
+// 向客户端写入任何数据之前建立上游流失败时，可换用其他账号重试
+func (h *ProxyHandler) openStreamWithFailover(account *types.UpstreamAccount, request *types.UnifiedRequest, path string, trace *debug.RequestTrace) (*http.Response, *types.UpstreamAccount, error) {
+	var resp *http.Response
+	account, err := h.callWithFailover(account, request, func(candidate *types.UpstreamAccount) error {
+		var openErr error
+		resp, openErr = h.openUpstreamStream(candidate, request, path, trace)
+		return openErr
+	})
 	if err != nil {
-		logger.Debug("构建上游请求失败: %v", err)
-		return fmt.Errorf("failed to build upstream request: %w", err)
+		return nil, account, err
 	}
+	return resp, account, nil
+}
 
-	logger.Debug("发送流式请求到: %s", upstreamReq.URL.String())
+// openUpstreamStream 向上游发起流式请求，确认状态码和Content-Type后返回响应，调用方负责关闭响应体
+func (h *ProxyHandler) openUpstreamStream(account *types.UpstreamAccount, request *types.UnifiedRequest, path string, trace *debug.RequestTrace) (*http.Response, error) {
+	logger.Debug("开始流式请求，上游ID: %s, Provider: %s", account.ID, account.Provider)
 
-	// 发送流式请求
-	resp, err := h.httpClient.Do(upstreamReq)
+	// 构建并发送流式请求（按重试策略重试）
+	var buildErr error
+	resp, err := h.retryPolicy.do(h.upstreamClient(request.UpstreamTimeout), func() (*http.Request, error) {
+		upstreamReq, err := h.buildUpstreamRequest(account, request, path, trace)
+		if err != nil {
+			buildErr = err
+			return nil, err
+		}
+		logger.Debug("发送流式请求到: %s", upstreamReq.URL.String())
+		return upstreamReq, nil
+	})
+	if buildErr != nil {
+		logger.Debug("构建上游请求失败: %v", buildErr)
+		return nil, fmt.Errorf("failed to build upstream request: %w", buildErr)
+	}
 	if err != nil {
 		logger.Debug("上游请求失败: %v", err)
-		return fmt.Errorf("upstream request failed: %w", err)
+		return nil, fmt.Errorf("upstream request failed: %w", err)
 	}
-	defer func() { _ = resp.Body.Close() }()
 
 	logger.Debug("收到上游响应，状态码: %d", resp.StatusCode)
 
 	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
 		logger.Debug("上游API返回错误状态码: %d", resp.StatusCode)
-		return fmt.Errorf("upstream API error: status=%d", resp.StatusCode)
+		return nil, readUpstreamError(resp)
 	}
 
 	// 验证Content-Type是否为流式响应
@@ -411,34 +968,50 @@ func (h *ProxyHandler) callUpstreamStreamAPI(w http.ResponseWriter, flusher http
 	logger.Debug("响应Content-Type: %s", contentType)
 	if !strings.HasPrefix(contentType, "text/event-stream") {
 		logger.Debug("非流式响应Content-Type: %s", contentType)
-		return fmt.Errorf("unexpected content type: %s", contentType)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected content type: %s", contentType)
 	}
-
-	// 不需要显式调用WriteHeader，让Go在第一次写入时自动发送200状态码
-	// 这样可以避免与中间件包装器的WriteHeader冲突
-	flusher.Flush()
-
-	logger.Debug("开始处理流式响应")
-	// 开始处理流式响应
-	return h.processStreamResponse(w, flusher, resp.Body, account.Provider, requestFormat, keyID, account.ID, startTime, trace, modelRouteContext)
+	return resp, nil
 }
 
 // processStreamResponse 处理流式响应
-func (h *ProxyHandler) processStreamResponse(w http.ResponseWriter, flusher http.Flusher, responseBody io.Reader, provider types.Provider, requestFormat converter.Format, keyID, upstreamID string, startTime time.Time, trace *debug.RequestTrace, modelRouteContext *types.ModelRouteContext) error {
-	var totalTokens int
-	logger.Debug("开始处理流式响应，Provider: %s, RequestFormat: %v", provider, requestFormat)
+func (h *ProxyHandler) processStreamResponse(w http.ResponseWriter, flusher http.Flusher, responseBody io.Reader, account *types.UpstreamAccount, requestFormat converter.Format, keyID, model string, startTime time.Time, trace *debug.RequestTrace, modelRouteContext *types.ModelRouteContext, streamEvents map[string]bool) error {
+	logger.Debug("开始处理流式响应，Provider: %s, RequestFormat: %v", account.Provider, requestFormat)
 
 	// 使用新的Manager处理流式响应
 
 	// 创建流写入器
 	writer := &httpStreamWriter{
-		writer:      w,
-		flusher:     flusher,
-		totalTokens: &totalTokens,
-		trace:       trace,
+		writer:       w,
+		flusher:      flusher,
+		controller:   http.NewResponseController(w),
+		writeTimeout: h.streamWriteTimeout,
+		trace:        trace,
+		events:       streamEvents,
 	}
+	// 流结束后清除写超时，避免影响同一连接上的后续请求
+	defer func() { _ = writer.controller.SetWriteDeadline(time.Time{}) }()
 
-	err := h.converter.ProcessStreamWithModelRoute(responseBody, provider, requestFormat, writer, modelRouteContext)
+	guard := startStreamDurationGuard(responseBody, h.maxStreamDuration)
+	stopDrain := h.streams.watch(responseBody)
+	err := h.converter.ProcessStreamWithModelRoute(responseBody, account.Provider, requestFormat, writer, modelRouteContext)
+	drained := stopDrain()
+
+	// 超过最大生成时长被截断：上游读取错误是主动关闭导致的，改为向客户端发送截断标记
+	if guard.stop() && err != nil {
+		logger.Warn("流式请求超过最大生成时长 %v，已截断，上游ID: %s", h.maxStreamDuration, account.ID)
+		if trace != nil {
+			trace.SetError(fmt.Errorf("stream truncated after %v", h.maxStreamDuration), "max_stream_duration")
+		}
+		err = writeStreamTruncation(writer, requestFormat, h.truncateReason)
+	} else if drained && err != nil {
+		// 服务器关闭的宽限期已过：同样以截断标记正常结束流
+		logger.Warn("服务器正在关闭，流式请求已提前结束，上游ID: %s", account.ID)
+		if trace != nil {
+			trace.SetError(fmt.Errorf("stream ended by server shutdown"), "shutdown")
+		}
+		err = writeStreamTruncation(writer, requestFormat, h.truncateReason)
+	}
 
 	if err != nil {
 		logger.Debug("流式处理出现错误: %v", err)
@@ -446,51 +1019,72 @@ func (h *ProxyHandler) processStreamResponse(w http.ResponseWriter, flusher http
 			trace.SetError(err, "stream_processing")
 		}
 	} else {
-		logger.Debug("流式处理完成，总tokens: %d", totalTokens)
+		logger.Debug("流式处理完成，输入tokens: %d，输出tokens: %d", writer.usage.InputTokens, writer.usage.OutputTokens)
 	}
 
 	// 记录成功统计和调试信息
 	duration := time.Since(startTime)
 	if trace != nil {
+		trace.SetStreamContent(writer.content.String())
 		trace.SetDurations(duration, 0, 0)
 		trace.SaveAsync()
 	}
-	go h.recordSuccess(keyID, upstreamID, duration, totalTokens)
+	inputTokens, outputTokens := int64(writer.usage.InputTokens), int64(writer.usage.OutputTokens)
+	go h.recordSuccess(keyID, account, duration, writer.usage.InputTokens+writer.usage.OutputTokens)
+	go h.recordCost(keyID, model, inputTokens, outputTokens)
+	h.sizeStats.recordResponse(writer.bytes, inputTokens, outputTokens)
 
 	return err
 }
 
-// writeStreamError 写入流式错误
-func (h *ProxyHandler) writeStreamError(w http.ResponseWriter, flusher http.Flusher, err error) {
-	errorEvent := map[string]interface{}{
-		"error": map[string]string{
-			"type":    "stream_error",
-			"message": err.Error(),
-		},
+// writeStreamError 在已开始输出的SSE流中写入错误：Anthropic格式按其SDK能识别的error事件写入，
+// 其余格式写入带error字段的data行
+func (h *ProxyHandler) writeStreamError(w http.ResponseWriter, flusher http.Flusher, requestFormat converter.Format, err error) {
+	switch requestFormat {
+	case converter.FormatAnthropic:
+		errorEvent := map[string]interface{}{
+			"type": "error",
+			"error": map[string]string{
+				"type":    "api_error",
+				"message": err.Error(),
+			},
+		}
+		errorBytes, _ := json.Marshal(errorEvent)
+		_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", string(errorBytes))
+	default:
+		errorEvent := map[string]interface{}{
+			"error": map[string]string{
+				"type":    "stream_error",
+				"message": err.Error(),
+			},
+		}
+		errorBytes, _ := json.Marshal(errorEvent)
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", string(errorBytes))
 	}
-
-	errorBytes, _ := json.Marshal(errorEvent)
-	_, _ = fmt.Fprintf(w, "data: %s\n\n", string(errorBytes))
 	flusher.Flush()
 }
 
 // callUpstreamAPIRaw 调用上游API并返回原始响应字节
 func (h *ProxyHandler) callUpstreamAPIRaw(account *types.UpstreamAccount, request *types.UnifiedRequest, path string, trace *debug.RequestTrace) ([]byte, error) {
-	// 1. 构建上游请求
-	upstreamReq, err := h.buildUpstreamRequest(account, request, path, trace)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build upstream request: %w", err)
+	// 1. 构建并发送请求（按重试策略重试）
+	var buildErr error
+	resp, err := h.retryPolicy.do(h.upstreamClient(request.UpstreamTimeout), func() (*http.Request, error) {
+		upstreamReq, err := h.buildUpstreamRequest(account, request, path, trace)
+		if err != nil {
+			buildErr = err
+		}
+		return upstreamReq, err
+	})
+	if buildErr != nil {
+		return nil, fmt.Errorf("failed to build upstream request: %w", buildErr)
 	}
-
-	// 2. 发送请求
-	resp, err := h.httpClient.Do(upstreamReq)
 	if err != nil {
 		return nil, fmt.Errorf("upstream request failed: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	// 3. 读取响应
-	responseBody, err := io.ReadAll(resp.Body)
+	// 2. 读取响应（限制大小，防止异常大的响应耗尽内存）
+	responseBody, err := readLimitedBody(resp.Body, h.maxResponseBytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read upstream response: %w", err)
 	}
@@ -500,14 +1094,37 @@ func (h *ProxyHandler) callUpstreamAPIRaw(account *types.UpstreamAccount, reques
 		trace.SetUpstreamResponse(responseBody)
 	}
 
-	// 4. 检查HTTP状态码
+	// 3. 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("upstream API error: status=%d, body=%s", resp.StatusCode, string(responseBody))
+		return nil, parseUpstreamError(resp.StatusCode, responseBody)
 	}
 
 	return responseBody, nil
 }
 
+// upstreamContext 为本次请求的全部上游调用（含重试、退避和换账号）设置Key级别的截止时间，
+// 未设置Key超时时原样返回parent。流式请求取Key超时与全局超时中的较大者，避免长时间生成被提前截断
+func (h *ProxyHandler) upstreamContext(parent context.Context, timeout time.Duration, stream bool) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return parent, func() {}
+	}
+	if stream && h.httpClient.Timeout > timeout {
+		timeout = h.httpClient.Timeout
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// upstreamClient 返回本次上游调用使用的HTTP客户端。Key配置了请求超时时由请求上下文的截止时间
+// （见upstreamContext）约束整个请求，不再叠加对每次尝试生效的全局超时；共用同一Transport以复用连接池
+func (h *ProxyHandler) upstreamClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		return h.httpClient
+	}
+	client := *h.httpClient
+	client.Timeout = 0
+	return &client
+}
+
 // buildUpstreamRequest 构建上游请求
 func (h *ProxyHandler) buildUpstreamRequest(account *types.UpstreamAccount, request *types.UnifiedRequest, path string, trace *debug.RequestTrace) (*http.Request, error) {
 	// 1. 根据上游提供商转换请求格式
@@ -524,55 +1141,271 @@ func (h *ProxyHandler) buildUpstreamRequest(account *types.UpstreamAccount, requ
 
 	// 2. 构建URL
 	baseURL := h.upstreamMgr.GetBaseURL(account)
-	url := baseURL + path
+	upstreamPath := converter.ResolveUpstreamPath(path, request.Model, request.Stream != nil && *request.Stream)
+	if account.Provider == types.ProviderAzure {
+		upstreamPath = converter.ResolveAzurePath(upstreamPath, account.AzureDeployment(request.Model), account.APIVersion)
+	}
+	url := baseURL + upstreamPath
 
 	// 3. 创建HTTP请求
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	ctx := request.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// 4. 设置通用头部
+	// 4. 传播W3C Trace Context
+	if request.TraceParent != "" {
+		req.Header.Set(headerTraceParent, request.TraceParent)
+		if request.TraceState != "" {
+			req.Header.Set(headerTraceState, request.TraceState)
+		}
+	}
+
+	// 5. 设置通用头部、认证头部和账号自定义头部
+	apiKey, err := h.setUpstreamHeaders(req, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// 记录本次使用的key，被限流时用于在轮换池内换key
+	if apiKey != "" {
+		req = req.WithContext(context.WithValue(req.Context(), pooledKeyContextKey{}, pooledKey{upstreamID: account.ID, apiKey: apiKey}))
+	}
+
+	return req, nil
+}
+
+// setUpstreamHeaders 设置上游请求的通用头部、认证头部和账号自定义头部，返回本次从轮换池选用的API Key
+func (h *ProxyHandler) setUpstreamHeaders(req *http.Request, account *types.UpstreamAccount) (string, error) {
 	req.Header.Set("Content-Type", "application/json")
 
-	// 对Anthropic使用Claude Code User-Agent，其他提供商使用通用User-Agent
-	if account.Provider == types.ProviderAnthropic {
+	// 优先使用配置的User-Agent；未配置时对Anthropic使用Claude Code User-Agent，其他提供商使用通用User-Agent
+	switch {
+	case h.userAgent != "":
+		req.Header.Set("User-Agent", h.userAgent)
+	case account.Provider == types.ProviderAnthropic:
 		req.Header.Set("User-Agent", "claude-cli/1.0.56 (external, cli)")
-	} else {
+	default:
 		req.Header.Set("User-Agent", "LLM-Gateway/1.0")
 	}
 
-	// 5. 设置认证头部 - 调用Upstream模块处理
-	authHeaders, err := h.upstreamMgr.GetAuthHeaders(account.ID)
+	// 认证头部由Upstream模块处理
+	authHeaders, apiKey, err := h.upstreamMgr.GetAuthHeadersWithKey(account.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get auth headers: %w", err)
+		return "", fmt.Errorf("failed to get auth headers: %w", err)
 	}
-
 	for key, value := range authHeaders {
 		req.Header.Set(key, value)
 	}
 
-	return req, nil
+	// 最后附加账号配置的自定义头部
+	applyExtraHeaders(req, account)
+	return apiKey, nil
+}
+
+// protectedUpstreamHeaders 自定义头部不能覆盖的头部：各提供商的认证头部和请求体类型
+var protectedUpstreamHeaders = map[string]bool{
+	"Authorization":  true,
+	"X-Api-Key":      true,
+	"X-Goog-Api-Key": true,
+	"Api-Key":        true,
+	"Content-Type":   true,
+}
+
+// applyExtraHeaders 在默认头部之后合并账号的自定义头部，跳过认证等受保护的头部
+func applyExtraHeaders(req *http.Request, account *types.UpstreamAccount) {
+	for key, value := range account.ExtraHeaders {
+		if protectedUpstreamHeaders[http.CanonicalHeaderKey(key)] {
+			logger.Warn("上游账号 %s 的自定义头部 %s 会覆盖认证头部，已忽略", account.ID, key)
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+}
+
+// pooledKeyContextKey 上游请求上下文中记录所用API Key的键
+type pooledKeyContextKey struct{}
+
+// pooledKey 上游请求所用的账号及API Key
+type pooledKey struct {
+	upstreamID string
+	apiKey     string
+}
+
+// rotateRateLimitedKey 上游返回429时冷却本次使用的key，返回轮换池中是否还有其他可用key
+func (h *ProxyHandler) rotateRateLimitedKey(req *http.Request, retryAfter time.Duration) bool {
+	used, ok := req.Context().Value(pooledKeyContextKey{}).(pooledKey)
+	if !ok {
+		return false
+	}
+	return h.upstreamMgr.MarkAPIKeyRateLimited(used.upstreamID, used.apiKey, retryAfter)
+}
+
+// callWithFailover 使用account调用上游，失败且换账号可能恢复时（见isFailoverError），
+// 依次换用其他账号重试，最多maxFailovers次。返回最终使用的账号及其调用结果。
+// 换账号时释放失败账号的进行中请求名额，request.UpstreamID指向当前持有名额的账号，由调用方在请求结束时释放
+func (h *ProxyHandler) callWithFailover(account *types.UpstreamAccount, request *types.UnifiedRequest, call func(*types.UpstreamAccount) error) (*types.UpstreamAccount, error) {
+	err := call(account)
+	tried := map[string]bool{account.ID: true}
+	for attempt := 0; err != nil && attempt < h.maxFailovers; attempt++ {
+		// 请求已超时或客户端已断开时不再换账号，也不把当前账号标记为异常
+		if request.Context != nil && request.Context.Err() != nil {
+			break
+		}
+		next := h.failoverAccount(account, err, tried)
+		if next == nil {
+			break
+		}
+		h.router.ReleaseUpstream(account.ID)
+		account = next
+		request.UpstreamID = account.ID
+		err = call(account)
+	}
+	return account, err
+}
+
+// failoverAccount 上游错误可通过换账号恢复时，选出同租户、同提供商、同类型且未尝试过的另一个账号
+// （已预留进行中请求名额），并标记当前账号异常；无需或无法切换时返回nil。tried记录已尝试或不符合条件的账号
+func (h *ProxyHandler) failoverAccount(account *types.UpstreamAccount, err error, tried map[string]bool) *types.UpstreamAccount {
+	if !isFailoverError(err) {
+		return nil
+	}
+
+	for {
+		next, selectErr := h.router.SelectUpstreamExcluding(account.Provider, account.TenantID(), tried)
+		if selectErr != nil {
+			return nil
+		}
+		tried[next.ID] = true
+		// 账号类型决定了注入的系统提示词等请求内容，只在同类型账号间切换
+		if next.Type != account.Type {
+			h.router.CancelUpstream(next.ID)
+			continue
+		}
+
+		h.router.MarkUpstreamError(account.ID, err)
+		h.metrics.recordUpstreamError(account)
+		logger.Warn("上游账号 %s 请求失败，切换到账号 %s 重试: %v", account.ID, next.ID, err)
+		return next
+	}
 }
 
 // handleUpstreamError 处理上游错误
-func (h *ProxyHandler) handleUpstreamError(w http.ResponseWriter, account *types.UpstreamAccount, err error) {
+func (h *ProxyHandler) handleUpstreamError(w http.ResponseWriter, account *types.UpstreamAccount, requestFormat converter.Format, keyID string, startTime time.Time, err error) {
+	// 请求内容无法转换为上游格式（如上游不接受的图片），属于客户端错误
+	var contentErr *converter.UnsupportedContentError
+	if errors.As(err, &contentErr) {
+		h.metrics.recordRequest(keyID, account, http.StatusBadRequest, time.Since(startTime))
+		h.writeErrorResponse(w, http.StatusBadRequest, "unsupported_content", contentErr.Error())
+		return
+	}
+
+	// 客户端请求本身的错误（如参数无效）与账号无关：不计入上游错误、不标记账号异常，按上游状态码原样返回
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) && upstreamErr.Action() == upstreamErrorFatal {
+		h.metrics.recordRequest(keyID, account, upstreamErr.StatusCode, time.Since(startTime))
+		h.writeClientError(w, requestFormat, upstreamErr.StatusCode, upstreamErr.Body)
+		return
+	}
+
 	// 记录错误到上游账号统计
+	h.metrics.recordUpstreamError(account)
 	go h.router.MarkUpstreamError(account.ID, err)
 
+	// 重试和换账号后仍失败：限流保留429以便客户端退避，其余按网关错误返回502，错误体转换为客户端格式
+	if upstreamErr != nil {
+		statusCode := http.StatusBadGateway
+		if upstreamErr.Kind == upstreamErrorRateLimit {
+			statusCode = upstreamErr.StatusCode
+		}
+		h.metrics.recordRequest(keyID, account, statusCode, time.Since(startTime))
+		h.writeClientError(w, requestFormat, statusCode, upstreamErr.Body)
+		return
+	}
+
 	// 返回错误响应
+	h.metrics.recordRequest(keyID, account, http.StatusBadGateway, time.Since(startTime))
 	h.writeErrorResponse(w, http.StatusBadGateway, "upstream_error", fmt.Sprintf("Upstream API error: %v", err))
 }
 
 // recordSuccess 记录成功请求统计
-func (h *ProxyHandler) recordSuccess(keyID, upstreamID string, latency time.Duration, tokensUsed int) {
+func (h *ProxyHandler) recordSuccess(keyID string, account *types.UpstreamAccount, latency time.Duration, tokensUsed int) {
+	h.metrics.recordRequest(keyID, account, http.StatusOK, latency)
+
 	// 更新Gateway Key统计
 	if keyID != "" {
 		_ = h.gatewayKeyMgr.UpdateKeyUsage(keyID, true, latency)
 	}
 
 	// 更新上游账号统计
-	h.router.MarkUpstreamSuccess(upstreamID, latency, int64(tokensUsed))
+	h.router.MarkUpstreamSuccess(account.ID, latency, int64(tokensUsed))
+}
+
+// recordCost 按定价表计算成本并记录到Gateway Key（价格系数由Key管理器应用）
+func (h *ProxyHandler) recordCost(keyID, model string, inputTokens, outputTokens int64) {
+	if keyID == "" || (inputTokens == 0 && outputTokens == 0) {
+		return
+	}
+
+	baseCost := h.pricingConfig.CalculateCost(model, inputTokens, outputTokens)
+	if err := h.gatewayKeyMgr.RecordKeyCost(keyID, inputTokens, outputTokens, baseCost); err != nil {
+		logger.Warn("记录Key %s 成本失败: %v", keyID, err)
+	}
+}
+
+// extractUsage 从上游响应中提取输入/输出token数
+func extractUsage(format converter.Format, body []byte) (inputTokens, outputTokens int64) {
+	var resp struct {
+		Usage struct {
+			InputTokens      int64 `json:"input_tokens"`
+			OutputTokens     int64 `json:"output_tokens"`
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+		} `json:"usage"`
+		UsageMetadata struct {
+			PromptTokenCount     int64 `json:"promptTokenCount"`
+			CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+		} `json:"usageMetadata"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0, 0
+	}
+
+	switch format {
+	case converter.FormatAnthropic:
+		return resp.Usage.InputTokens, resp.Usage.OutputTokens
+	case converter.FormatGemini:
+		return resp.UsageMetadata.PromptTokenCount, resp.UsageMetadata.CandidatesTokenCount
+	}
+	return resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+}
+
+// writeClientError 将上游错误体转换为客户端格式后返回
+func (h *ProxyHandler) writeClientError(w http.ResponseWriter, requestFormat converter.Format, statusCode int, upstreamBody []byte) {
+	body := h.converter.BuildClientError(requestFormat, statusCode, upstreamBody)
+	log.Printf("[ERROR] HTTP %d - upstream: %s", statusCode, string(body))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
+}
+
+// rejectRequest 返回转发到上游之前的拒绝响应，并以空upstream标签计入请求数
+func (h *ProxyHandler) rejectRequest(w http.ResponseWriter, r *http.Request, statusCode int, errorType, message string) {
+	h.metrics.recordRejected(requestTenant(r), r.Header.Get("X-Gateway-Key-ID"), statusCode)
+	h.writeErrorResponse(w, statusCode, errorType, message)
+}
+
+// requestTenant 返回发起请求的Gateway Key所属租户，未认证时为默认租户
+func requestTenant(r *http.Request) string {
+	if gatewayKey, ok := r.Context().Value("gatewayKey").(*types.GatewayAPIKey); ok {
+		return gatewayKey.TenantID()
+	}
+	return types.DefaultTenant
 }
 
 // writeErrorResponse 写入错误响应
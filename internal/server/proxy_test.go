@@ -0,0 +1,1246 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/config"
+	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// failingResponseWriter 模拟客户端已断开的ResponseWriter
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w *failingResponseWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestHTTPStreamWriter_WriteErrorStopsStream(t *testing.T) {
+	rec := &failingResponseWriter{httptest.NewRecorder()}
+	writer := &httpStreamWriter{
+		writer:       rec,
+		flusher:      rec,
+		controller:   http.NewResponseController(rec),
+		writeTimeout: time.Second,
+	}
+
+	err := writer.WriteChunk(&converter.StreamChunk{Data: map[string]string{"text": "hi"}, Usage: &converter.StreamUsage{OutputTokens: 1}})
+	if err == nil {
+		t.Fatal("写入失败时应返回错误以终止上游读取")
+	}
+	if writer.usage.OutputTokens != 0 {
+		t.Errorf("写入失败的块不应计入tokens, got %d", writer.usage.OutputTokens)
+	}
+	if err := writer.WriteDone(); err == nil {
+		t.Error("WriteDone 写入失败时应返回错误")
+	}
+}
+
+func TestHTTPStreamWriter_SlowClientTimeout(t *testing.T) {
+	result := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writer := &httpStreamWriter{
+			writer:       w,
+			flusher:      w.(http.Flusher),
+			controller:   http.NewResponseController(w),
+			writeTimeout: 100 * time.Millisecond,
+		}
+
+		// 客户端不读取数据，持续写入直到socket缓冲区写满触发写超时
+		payload := strings.Repeat("x", 64*1024)
+		for i := 0; i < 4096; i++ {
+			if err := writer.WriteChunk(&converter.StreamChunk{Data: payload}); err != nil {
+				result <- err
+				return
+			}
+		}
+		result <- nil
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Fatal("慢客户端应触发写超时")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("写入阻塞未超时")
+	}
+}
+
+func TestCheckRequestContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		wantErr     bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/json; charset=utf-8", false},
+		{"application/vnd.api+json", false},
+		{"text/plain", true},
+		{"application/x-www-form-urlencoded", true},
+		{"multipart/form-data; boundary=abc", true},
+		{"invalid;;", true},
+	}
+
+	for _, tt := range tests {
+		if err := checkRequestContentType(tt.contentType); (err != nil) != tt.wantErr {
+			t.Errorf("checkRequestContentType(%q) error = %v, wantErr %v", tt.contentType, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHandleProxyRequest_UnsupportedMediaType(t *testing.T) {
+	h := &ProxyHandler{}
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader("model=gpt-4o"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	h.HandleChatCompletions(w, r)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %d, want 415", w.Code)
+	}
+}
+
+func TestProxy_TenantIsolation(t *testing.T) {
+	var gotAuth string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, _ := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	key, rawKey, err := s.clientMgr.CreateKey("acme-key", []types.Permission{types.PermissionWrite})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	if err := s.clientMgr.UpdateKeyTenant(key.ID, "acme"); err != nil {
+		t.Fatalf("UpdateKeyTenant() error = %v", err)
+	}
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// 只有默认租户的上游账号时，acme的Key不能借用
+	if code := send(); code != http.StatusServiceUnavailable {
+		t.Fatalf("跨租户请求 status = %d, want 503", code)
+	}
+	if gotAuth != "" {
+		t.Errorf("请求不应到达其他租户的上游账号")
+	}
+
+	if err := s.upstreamMgr.AddAccount(&types.UpstreamAccount{
+		ID:       "up-acme",
+		Name:     "acme",
+		Type:     types.UpstreamTypeAPIKey,
+		Provider: types.ProviderOpenAI,
+		BaseURL:  upstreamServer.URL,
+		APIKey:   "sk-acme",
+		Tenant:   "acme",
+	}); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("同租户请求 status = %d, want 200", code)
+	}
+	if gotAuth != "Bearer sk-acme" {
+		t.Errorf("Authorization = %q, 应使用acme租户的上游账号", gotAuth)
+	}
+}
+
+func TestProxy_FailoverOnTransientError(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		badStatus    int
+		wantStatus   int
+		wantFailover bool
+	}{
+		{"非流式5xx换账号", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`, http.StatusInternalServerError, http.StatusOK, true},
+		{"流式5xx换账号", `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`, http.StatusBadGateway, http.StatusOK, true},
+		{"4xx不换账号", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`, http.StatusBadRequest, http.StatusBadGateway, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var badCalls, goodCalls int
+			badServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				badCalls++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.badStatus)
+				_, _ = w.Write([]byte(`{"error":{"message":"flaky","type":"server_error"}}`))
+			}))
+			defer badServer.Close()
+			goodServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				goodCalls++
+				if strings.Contains(readBody(r), `"stream":true`) {
+					w.Header().Set("Content-Type", "text/event-stream")
+					_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+			}))
+			defer goodServer.Close()
+
+			s, rawKey := newTestGateway(t, badServer.URL, types.MetricsConfig{})
+			if err := s.upstreamMgr.AddAccount(&types.UpstreamAccount{
+				ID:           "up-openai-2",
+				Name:         "openai-2",
+				Type:         types.UpstreamTypeAPIKey,
+				Provider:     types.ProviderOpenAI,
+				BaseURL:      goodServer.URL,
+				APIKey:       "sk-test-2",
+				HealthStatus: "healthy",
+			}); err != nil {
+				t.Fatalf("AddAccount() error = %v", err)
+			}
+
+			// 轮询可能先选中任一账号，连续发送两次保证故障账号至少被选中一次
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+rawKey)
+				rec := httptest.NewRecorder()
+				s.mux.ServeHTTP(rec, req)
+				if badCalls > 0 {
+					if rec.Code != tt.wantStatus {
+						t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+					}
+					break
+				}
+			}
+
+			if badCalls != 1 {
+				t.Fatalf("故障账号被调用 %d 次, want 1", badCalls)
+			}
+			if tt.wantFailover && goodCalls == 0 {
+				t.Error("应切换到另一个账号重试")
+			}
+			if !tt.wantFailover && goodCalls > 0 {
+				t.Errorf("4xx不应切换账号, 正常账号被调用 %d 次", goodCalls)
+			}
+		})
+	}
+}
+
+func TestProxy_StreamErrorsBeforeFirstByte(t *testing.T) {
+	closedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closedServer.Close()
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantType   string
+	}{
+		{"上游返回错误状态码", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"bad max_tokens","type":"invalid_request_error"}}`))
+		}, http.StatusBadRequest, "invalid_request_error"},
+		{"上游返回非流式响应", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"chatcmpl-1","choices":[]}`))
+		}, http.StatusBadGateway, "upstream_error"},
+		{"上游连接失败", nil, http.StatusBadGateway, "upstream_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamURL := closedServer.URL
+			if tt.handler != nil {
+				upstreamServer := httptest.NewServer(tt.handler)
+				defer upstreamServer.Close()
+				upstreamURL = upstreamServer.URL
+			}
+
+			s, rawKey := newTestGateway(t, upstreamURL, types.MetricsConfig{})
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+rawKey)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type = %q, 首字节前的错误不应切换到SSE", contentType)
+			}
+			var body struct {
+				Error struct {
+					Type string `json:"type"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error.Type != tt.wantType {
+				t.Errorf("错误体 = %s, want type %s", rec.Body.String(), tt.wantType)
+			}
+		})
+	}
+}
+
+func TestProxy_UpstreamErrorInClientFormat(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"bad max_tokens","type":"invalid_request_error","param":"max_tokens","code":null}}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"gpt-4o","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+rawKey)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("错误体不是合法JSON: %s", rec.Body.String())
+	}
+	if body.Type != "error" || body.Error.Type != "invalid_request_error" || body.Error.Message != "bad max_tokens" {
+		t.Errorf("Anthropic客户端应收到Anthropic格式的错误, got %s", rec.Body.String())
+	}
+}
+
+func TestProxy_MultipleCompletions(t *testing.T) {
+	var upstreamN interface{}
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		upstreamN = body["n"]
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[` +
+			`{"index":0,"message":{"role":"assistant","content":"one"},"finish_reason":"stop"},` +
+			`{"index":1,"message":{"role":"assistant","content":"two"},"finish_reason":"stop"},` +
+			`{"index":2,"message":{"role":"assistant","content":"three"},"finish_reason":"length"}],` +
+			`"usage":{"prompt_tokens":3,"completion_tokens":3,"total_tokens":6}}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","n":3,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+rawKey)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if upstreamN != float64(3) {
+		t.Errorf("上游收到的n = %v, want 3", upstreamN)
+	}
+	var resp types.UnifiedResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(resp.Choices) != 3 {
+		t.Fatalf("choices数量 = %d, want 3: %s", len(resp.Choices), rec.Body.String())
+	}
+	for i, want := range []string{"one", "two", "three"} {
+		if resp.Choices[i].Index != i || resp.Choices[i].Message.Content != want {
+			t.Errorf("choices[%d] = %+v, want content %q", i, resp.Choices[i], want)
+		}
+	}
+	if resp.Choices[2].FinishReason != "length" {
+		t.Errorf("choices[2].finish_reason = %q, want length", resp.Choices[2].FinishReason)
+	}
+}
+
+func TestBuildUpstreamRequest_Azure(t *testing.T) {
+	s, _ := newTestGateway(t, "http://unused", types.MetricsConfig{})
+	account := &types.UpstreamAccount{
+		ID:            "up-azure",
+		Name:          "azure",
+		Type:          types.UpstreamTypeAPIKey,
+		Provider:      types.ProviderAzure,
+		BaseURL:       "https://acme.openai.azure.com",
+		APIKey:        "azure-secret",
+		DeploymentMap: map[string]string{"gpt-4o": "prod-gpt4o"},
+		APIVersion:    "2024-10-21",
+	}
+	if err := s.upstreamMgr.AddAccount(account); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+
+	path, err := s.converter.GetUpstreamPath(types.ProviderAzure, "/v1/chat/completions")
+	if err != nil {
+		t.Fatalf("GetUpstreamPath() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		model   string
+		wantURL string
+	}{
+		{"映射到部署名", "gpt-4o", "https://acme.openai.azure.com/openai/deployments/prod-gpt4o/chat/completions?api-version=2024-10-21"},
+		{"未映射时使用模型名", "gpt-4o-mini", "https://acme.openai.azure.com/openai/deployments/gpt-4o-mini/chat/completions?api-version=2024-10-21"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &types.UnifiedRequest{
+				Model:    tt.model,
+				Messages: []types.Message{{Role: "user", Content: "hi"}},
+			}
+			req, err := s.proxyHandler.buildUpstreamRequest(account, request, path, nil)
+			if err != nil {
+				t.Fatalf("buildUpstreamRequest() error = %v", err)
+			}
+			if got := req.URL.String(); got != tt.wantURL {
+				t.Errorf("URL = %s, want %s", got, tt.wantURL)
+			}
+			if got := req.Header.Get("api-key"); got != "azure-secret" {
+				t.Errorf("api-key = %q, want azure-secret", got)
+			}
+			if got := req.Header.Get("Authorization"); got != "" {
+				t.Errorf("Azure不应使用Bearer认证, Authorization = %q", got)
+			}
+		})
+	}
+}
+
+func TestBuildUpstreamRequest_ExtraHeaders(t *testing.T) {
+	s, _ := newTestGateway(t, "http://unused", types.MetricsConfig{})
+	s.proxyHandler.userAgent = "acme-gateway/2.0"
+
+	account := &types.UpstreamAccount{
+		ID:       "up-anthropic",
+		Name:     "anthropic",
+		Type:     types.UpstreamTypeAPIKey,
+		Provider: types.ProviderAnthropic,
+		BaseURL:  "https://api.anthropic.com",
+		APIKey:   "sk-ant-secret",
+		ExtraHeaders: map[string]string{
+			"anthropic-version": "2024-01-01",
+			"X-Org-ID":          "org-42",
+			"x-api-key":         "attacker-key",
+		},
+	}
+	if err := s.upstreamMgr.AddAccount(account); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+
+	request := &types.UnifiedRequest{
+		Model:    "claude-3-5-haiku",
+		Messages: []types.Message{{Role: "user", Content: "hi"}},
+	}
+	req, err := s.proxyHandler.buildUpstreamRequest(account, request, "/v1/messages", nil)
+	if err != nil {
+		t.Fatalf("buildUpstreamRequest() error = %v", err)
+	}
+
+	wantHeaders := map[string]string{
+		"User-Agent":        "acme-gateway/2.0",
+		"anthropic-version": "2024-01-01",    // 自定义头部覆盖默认值
+		"X-Org-ID":          "org-42",        // 新增的自定义头部
+		"x-api-key":         "sk-ant-secret", // 认证头部不被覆盖
+	}
+	for key, want := range wantHeaders {
+		if got := req.Header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// readBody 读取请求体
+func readBody(r *http.Request) string {
+	data, _ := io.ReadAll(r.Body)
+	return string(data)
+}
+
+func TestProxy_ModelAccessDenied(t *testing.T) {
+	upstreamCalled := false
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	s.proxyHandler.modelRouteConfig = &types.ModelRouteConfig{DeniedModels: []string{"gpt-4*"}}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+rawKey)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "model_not_allowed") {
+		t.Errorf("响应应包含model_not_allowed: %s", rec.Body.String())
+	}
+	if upstreamCalled {
+		t.Error("被禁止的模型不应转发到上游")
+	}
+}
+
+func TestProxy_RecordsTokenUsage(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Stream bool `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hello\"},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":\"gpt-4o\",\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":7,\"total_tokens\":19}}\n\n" +
+				"data: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[` +
+			`{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],` +
+			`"usage":{"prompt_tokens":12,"completion_tokens":7,"total_tokens":19}}`))
+	}))
+	defer upstreamServer.Close()
+
+	// Anthropic客户端经OpenAI上游：用量从转换后的usage.input_tokens/output_tokens中提取，
+	// 流式与非流式请求的TokensUsed都是输入与输出token之和
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"非流式", `{"model":"gpt-4o","max_tokens":64,"messages":[{"role":"user","content":"hi"}]}`},
+		{"流式", `{"model":"gpt-4o","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"hi"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+rawKey)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+
+			// 成功统计异步记录，等待上游账号用量更新
+			var tokensUsed int64
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				account, err := s.upstreamMgr.GetAccount("up-openai")
+				if err != nil {
+					t.Fatalf("GetAccount() error = %v", err)
+				}
+				if account.Usage != nil && account.Usage.TokensUsed > 0 {
+					tokensUsed = account.Usage.TokensUsed
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if tokensUsed != 19 {
+				t.Errorf("上游账号TokensUsed = %d, want 19", tokensUsed)
+			}
+		})
+	}
+}
+
+func TestProxy_KeyRequestTimeout(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(1500 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, defaultKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	key, shortKey, err := s.clientMgr.CreateKey("fail-fast", []types.Permission{types.PermissionWrite})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	if err := s.clientMgr.UpdateKeyRequestTimeout(key.ID, 1); err != nil {
+		t.Fatalf("UpdateKeyRequestTimeout() error = %v", err)
+	}
+	// Key超时约束整个请求，超时后不再按重试策略逐次等待
+	s.proxyHandler.retryPolicy.maxRetries = 3
+	s.proxyHandler.retryPolicy.baseDelay = 10 * time.Millisecond
+
+	send := func(rawKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	start := time.Now()
+	if rec := send(shortKey); rec.Code != http.StatusBadGateway {
+		t.Fatalf("短超时Key status = %d, want 502: %s", rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed >= 1500*time.Millisecond {
+		t.Errorf("短超时Key应在上游返回前中止, 耗时 %v", elapsed)
+	}
+
+	if rec := send(defaultKey); rec.Code != http.StatusOK {
+		t.Fatalf("默认Key status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProxyHandler_UpstreamContextTimeout(t *testing.T) {
+	h := &ProxyHandler{httpClient: &http.Client{Timeout: time.Minute}}
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		stream  bool
+		want    time.Duration // 0表示不设置截止时间
+	}{
+		{"未设置Key超时不设截止时间", 0, false, 0},
+		{"非流式使用Key超时", 5 * time.Second, false, 5 * time.Second},
+		{"非流式Key超时可大于全局超时", 10 * time.Minute, false, 10 * time.Minute},
+		{"流式取较大的全局超时", 5 * time.Second, true, time.Minute},
+		{"流式取较大的Key超时", 10 * time.Minute, true, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := h.upstreamContext(context.Background(), tt.timeout, tt.stream)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if tt.want == 0 {
+				if ok {
+					t.Errorf("不应设置截止时间: %v", deadline)
+				}
+				return
+			}
+			if remaining := time.Until(deadline); !ok || remaining > tt.want || remaining < tt.want-time.Second {
+				t.Errorf("截止时间剩余 %v, want %v", remaining, tt.want)
+			}
+		})
+	}
+
+	// 设置了Key超时时客户端不再对每次尝试单独计时，且不修改共享客户端
+	if client := h.upstreamClient(0); client != h.httpClient {
+		t.Error("未设置Key超时应使用共享客户端")
+	}
+	if client := h.upstreamClient(5 * time.Second); client.Timeout != 0 {
+		t.Errorf("Timeout = %v, want 0", client.Timeout)
+	}
+	if h.httpClient.Timeout != time.Minute {
+		t.Errorf("不应修改共享客户端的超时: %v", h.httpClient.Timeout)
+	}
+}
+
+func TestProxy_ReasoningParamsPassthrough(t *testing.T) {
+	var upstreamBody map[string]json.RawMessage
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/messages" {
+			_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-3-5-sonnet","content":[` +
+				`{"type":"thinking","thinking":"let me think","signature":"sig"},{"type":"text","text":"hi"}],` +
+				`"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":5}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-5-mini","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	if err := s.upstreamMgr.AddAccount(&types.UpstreamAccount{
+		ID:           "up-anthropic",
+		Name:         "anthropic",
+		Type:         types.UpstreamTypeAPIKey,
+		Provider:     types.ProviderAnthropic,
+		BaseURL:      upstreamServer.URL,
+		APIKey:       "sk-ant-test",
+		HealthStatus: "healthy",
+	}); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		wantParam string
+		wantValue string
+		wantResp  string
+	}{
+		{
+			name:      "Anthropic到Anthropic保留thinking",
+			path:      "/v1/messages",
+			body:      `{"model":"claude-3-5-sonnet","max_tokens":2048,"thinking":{"type":"enabled","budget_tokens":1024},"messages":[{"role":"user","content":"hi"}]}`,
+			wantParam: "thinking",
+			wantValue: `{"type":"enabled","budget_tokens":1024}`,
+			wantResp:  `"thinking":"let me think"`,
+		},
+		{
+			name:      "OpenAI到OpenAI保留reasoning_effort",
+			path:      "/v1/chat/completions",
+			body:      `{"model":"gpt-5-mini","reasoning_effort":"high","messages":[{"role":"user","content":"hi"}]}`,
+			wantParam: "reasoning_effort",
+			wantValue: `"high"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamBody = nil
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+rawKey)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+			var got, want interface{}
+			_ = json.Unmarshal(upstreamBody[tt.wantParam], &got)
+			_ = json.Unmarshal([]byte(tt.wantValue), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("上游收到的%s = %s, want %s", tt.wantParam, upstreamBody[tt.wantParam], tt.wantValue)
+			}
+			if tt.wantResp != "" && !strings.Contains(rec.Body.String(), tt.wantResp) {
+				t.Errorf("响应应保留thinking内容块: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxy_RewriteModel(t *testing.T) {
+	var upstreamPath, upstreamModel string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		upstreamPath, upstreamModel = r.URL.Path, body.Model
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/messages" {
+			_, _ = w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"` + body.Model + `","content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"` + body.Model + `","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	if err := s.upstreamMgr.AddAccount(&types.UpstreamAccount{
+		ID:           "up-anthropic",
+		Name:         "anthropic",
+		Type:         types.UpstreamTypeAPIKey,
+		Provider:     types.ProviderAnthropic,
+		BaseURL:      upstreamServer.URL,
+		APIKey:       "sk-ant-test",
+		HealthStatus: "healthy",
+	}); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+	s.proxyHandler.modelRouteConfig = &types.ModelRouteConfig{
+		EnableLogging: true,
+		Routes: []types.ModelRoute{
+			{ID: "alias", SourceModel: "gpt-4", RewriteModel: "claude-3-5-sonnet", Enabled: true},
+			{ID: "alias-anthropic", SourceModel: "gpt-3.5-turbo", RewriteModel: "claude-3-haiku", TargetProvider: types.ProviderAnthropic, Enabled: true},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		model     string
+		wantPath  string
+		wantModel string
+	}{
+		{"只改写模型名仍使用原提供商", "gpt-4", "/v1/chat/completions", "claude-3-5-sonnet"},
+		{"改写模型名并切换提供商", "gpt-3.5-turbo", "/v1/messages", "claude-3-haiku"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+tt.model+`","messages":[{"role":"user","content":"hi"}]}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+rawKey)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+			if upstreamPath != tt.wantPath || upstreamModel != tt.wantModel {
+				t.Errorf("上游收到 %s model=%s, want %s model=%s", upstreamPath, upstreamModel, tt.wantPath, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestNewProxyHandler_ConnectionPool(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *types.ProxyConfig
+		wantIdle    int
+		wantPerHost int
+		wantMax     int
+	}{
+		{"未配置使用默认值", &types.ProxyConfig{}, 100, 32, 0},
+		{"使用配置值", &types.ProxyConfig{MaxIdleConns: 500, MaxIdleConnsPerHost: 64, MaxConnsPerHost: 128}, 500, 64, 128},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewProxyHandler(nil, nil, nil, nil, tt.config, nil, nil, nil, nil)
+			transport := h.httpClient.Transport.(*http.Transport)
+			if transport.MaxIdleConns != tt.wantIdle || transport.MaxIdleConnsPerHost != tt.wantPerHost || transport.MaxConnsPerHost != tt.wantMax {
+				t.Errorf("连接池 = (%d, %d, %d), want (%d, %d, %d)", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost,
+					tt.wantIdle, tt.wantPerHost, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestProxy_ReusesUpstreamConnections(t *testing.T) {
+	var newConns int64
+	upstreamServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	upstreamServer.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&newConns, 1)
+		}
+	}
+	upstreamServer.Start()
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+
+	// 分两轮各发出一批并发请求：第二轮应复用第一轮留在连接池中的空闲连接
+	const concurrency = 20
+	for round := 0; round < 2; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+rawKey)
+				rec := httptest.NewRecorder()
+				s.mux.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Errorf("status = %d: %s", rec.Code, rec.Body.String())
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	if got := atomic.LoadInt64(&newConns); got > concurrency {
+		t.Errorf("上游新建连接数 = %d, 期望不超过单轮并发数 %d", got, concurrency)
+	}
+}
+
+func TestProxy_QwenResourceURL(t *testing.T) {
+	var upstreamPath, upstreamAuth string
+	qwenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath, upstreamAuth = r.URL.Path, r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"qwen3-coder-plus","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer qwenServer.Close()
+
+	s, rawKey := newTestGateway(t, "http://127.0.0.1:1", types.MetricsConfig{})
+	expiresAt := time.Now().Add(time.Hour)
+	if err := s.upstreamMgr.AddAccount(&types.UpstreamAccount{
+		ID:           "up-qwen",
+		Name:         "qwen",
+		Type:         types.UpstreamTypeOAuth,
+		Provider:     types.ProviderQwen,
+		AccessToken:  "qwen-access-token",
+		ExpiresAt:    &expiresAt,
+		ResourceURL:  qwenServer.URL + "/v1",
+		HealthStatus: "healthy",
+	}); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"qwen3-coder-plus","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+rawKey)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if upstreamPath != "/v1/chat/completions" {
+		t.Errorf("上游路径 = %q, want /v1/chat/completions", upstreamPath)
+	}
+	if upstreamAuth != "Bearer qwen-access-token" {
+		t.Errorf("Authorization = %q, want Bearer qwen-access-token", upstreamAuth)
+	}
+}
+
+func TestProxy_FallbackModel(t *testing.T) {
+	var upstreamModel string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		upstreamModel = body.Model
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"` + body.Model + `","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	// 只有OpenAI上游账号，claude模型路由到Anthropic时没有可用上游
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+
+	noTools := false
+	tests := []struct {
+		name          string
+		fallbackModel string
+		allowed       []string
+		denied        []string
+		capabilities  types.ModelCapabilities
+		withTools     bool
+		wantStatus    int
+		wantModel     string
+	}{
+		{"未配置回退模型", "", nil, nil, nil, false, http.StatusServiceUnavailable, ""},
+		{"回退到有可用上游的模型", "gpt-4o-mini", nil, nil, nil, false, http.StatusOK, "gpt-4o-mini"},
+		{"回退模型同样没有可用上游", "gemini-1.5-pro", nil, nil, nil, false, http.StatusServiceUnavailable, ""},
+		{"回退模型在禁止列表中", "gpt-4o-mini", nil, []string{"gpt-4o-mini"}, nil, false, http.StatusServiceUnavailable, ""},
+		{"回退模型不在允许列表中", "gpt-4o-mini", []string{"claude-*"}, nil, nil, false, http.StatusServiceUnavailable, ""},
+		{"回退模型不支持请求的工具调用", "gpt-4o-mini", nil, nil, types.ModelCapabilities{{Model: "gpt-4o-mini", Tools: &noTools}}, true, http.StatusServiceUnavailable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamModel = ""
+			s.proxyHandler.modelRouteConfig = &types.ModelRouteConfig{FallbackModel: tt.fallbackModel, AllowedModels: tt.allowed, DeniedModels: tt.denied}
+			s.proxyHandler.capabilities = tt.capabilities
+
+			body := `{"model":"claude-3-5-sonnet","messages":[{"role":"user","content":"hi"}]}`
+			if tt.withTools {
+				body = `{"model":"claude-3-5-sonnet","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"lookup","parameters":{"type":"object"}}}]}`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+rawKey)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), "no_upstream_available") {
+					t.Errorf("错误类型应为no_upstream_available: %s", rec.Body.String())
+				}
+				return
+			}
+			if upstreamModel != tt.wantModel {
+				t.Errorf("上游收到的模型 = %q, want %q", upstreamModel, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestWriteStreamError(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    converter.Format
+		wantEvent string // 为空表示不应有event行
+		wantData  string
+	}{
+		{"Anthropic格式使用error事件", converter.FormatAnthropic, "error", `{"type":"error","error":{"type":"api_error","message":"upstream stream broken"}}`},
+		{"OpenAI格式", converter.FormatOpenAI, "", `{"error":{"type":"stream_error","message":"upstream stream broken"}}`},
+		{"Gemini格式", converter.FormatGemini, "", `{"error":{"type":"stream_error","message":"upstream stream broken"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			(&ProxyHandler{}).writeStreamError(rec, rec, tt.format, errors.New("upstream stream broken"))
+
+			body := rec.Body.String()
+			if !strings.HasSuffix(body, "\n\n") {
+				t.Errorf("错误帧应以空行结束: %q", body)
+			}
+			var event, data string
+			for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+				switch {
+				case strings.HasPrefix(line, "event: "):
+					event = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					data = strings.TrimPrefix(line, "data: ")
+				}
+			}
+			if event != tt.wantEvent {
+				t.Errorf("event = %q, want %q", event, tt.wantEvent)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal([]byte(data), &got); err != nil {
+				t.Fatalf("错误帧data不是合法JSON: %q", data)
+			}
+			_ = json.Unmarshal([]byte(tt.wantData), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("data = %s, want %s", data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestProxy_MaxTokensLimit(t *testing.T) {
+	var upstreamMaxTokens int
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			MaxTokens int `json:"max_tokens"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		upstreamMaxTokens = body.MaxTokens
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+
+	tests := []struct {
+		name      string
+		limit     types.MaxTokensLimitConfig
+		maxTokens int
+		want      int
+	}{
+		{"超过全局上限时截断", types.MaxTokensLimitConfig{Default: 4096}, 999999, 4096},
+		{"未超过上限时不变", types.MaxTokensLimitConfig{Default: 4096}, 1000, 1000},
+		{"等于上限时不变", types.MaxTokensLimitConfig{Default: 4096}, 4096, 4096},
+		{"提供商上限优先于全局上限", types.MaxTokensLimitConfig{Default: 4096, Providers: map[types.Provider]int{types.ProviderOpenAI: 16384}}, 999999, 16384},
+		{"其他提供商的上限不生效", types.MaxTokensLimitConfig{Providers: map[types.Provider]int{types.ProviderAnthropic: 8192}}, 999999, 999999},
+		{"未配置时不截断", types.MaxTokensLimitConfig{}, 999999, 999999},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamMaxTokens = 0
+			s.proxyHandler.maxTokensLimit = tt.limit
+
+			body := fmt.Sprintf(`{"model":"gpt-4o","max_tokens":%d,"messages":[{"role":"user","content":"hi"}]}`, tt.maxTokens)
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+rawKey)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+			if upstreamMaxTokens != tt.want {
+				t.Errorf("上游收到的max_tokens = %d, want %d", upstreamMaxTokens, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxy_StreamFlushesEachChunk(t *testing.T) {
+	tests := []struct {
+		name      string
+		http2     bool
+		path      string
+		body      string
+		firstPart string // 第一个上游块转换后客户端应收到的内容
+	}{
+		{"HTTP/1.1 OpenAI格式", false, "/v1/chat/completions", `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`, `"content":"Hel"`},
+		{"HTTP/2 OpenAI格式", true, "/v1/chat/completions", `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`, `"content":"Hel"`},
+		{"HTTP/1.1 Anthropic格式", false, "/v1/messages", `{"model":"gpt-4o","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"hi"}]}`, `"text":"Hel"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 上游发出第一个块后等待客户端确认收到，网关缓冲整个响应时客户端收不到第一个块，上游等待超时
+			release := make(chan struct{})
+			var timedOut atomic.Bool
+			upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hel\"}}]}\n\n"))
+				w.(http.Flusher).Flush()
+				select {
+				case <-release:
+				case <-time.After(2 * time.Second):
+					timedOut.Store(true)
+				}
+				_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+			}))
+			defer upstreamServer.Close()
+
+			s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+			gateway := httptest.NewUnstartedServer(s.mux)
+			if tt.http2 {
+				gateway.EnableHTTP2 = true
+				gateway.StartTLS()
+			} else {
+				gateway.Start()
+			}
+			defer gateway.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, gateway.URL+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+rawKey)
+			resp, err := gateway.Client().Do(req)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			if tt.http2 && resp.ProtoMajor != 2 {
+				t.Errorf("Proto = %s, want HTTP/2", resp.Proto)
+			}
+			if !tt.http2 && (len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked") {
+				t.Errorf("TransferEncoding = %v, want [chunked]", resp.TransferEncoding)
+			}
+			if resp.ContentLength != -1 {
+				t.Errorf("流式响应不应设置Content-Length, got %d", resp.ContentLength)
+			}
+			if got := resp.Header.Get("X-Accel-Buffering"); got != "no" {
+				t.Errorf("X-Accel-Buffering = %q, want no", got)
+			}
+			if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/event-stream") {
+				t.Errorf("Content-Type = %q", got)
+			}
+
+			// 读到第一个块后才放行上游发送剩余内容
+			reader := bufio.NewReader(resp.Body)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatalf("读取第一个块失败: %v", err)
+				}
+				if strings.Contains(line, tt.firstPart) {
+					break
+				}
+			}
+			close(release)
+
+			rest, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("读取剩余响应失败: %v", err)
+			}
+			if timedOut.Load() {
+				t.Fatal("第一个块被缓冲到响应结束才发送")
+			}
+			if !strings.Contains(string(rest), "lo") {
+				t.Errorf("缺少第二个块: %s", rest)
+			}
+		})
+	}
+}
+
+func TestProxy_MaxInFlightHeldForStream(t *testing.T) {
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Stream bool `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if !body.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hel\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-time.After(2 * time.Second):
+		}
+		_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	if err := s.configMgr.(*config.ConfigManager).UpdateUpstreamAccount("up-openai", func(account *types.UpstreamAccount) error {
+		account.MaxInFlight = 1
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateUpstreamAccount() error = %v", err)
+	}
+	gateway := httptest.NewServer(s.mux)
+	defer gateway.Close()
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, gateway.URL+"/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+rawKey)
+	resp, err := gateway.Client().Do(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || !strings.Contains(line, `"content":"Hel"`) {
+		t.Fatalf("应先收到第一个流式块, got %q, err = %v", line, err)
+	}
+
+	// 流式输出进行中，账号的并发名额仍被占用
+	if code := send(); code != http.StatusServiceUnavailable {
+		t.Errorf("流式输出期间 status = %d, want 503", code)
+	}
+
+	close(release)
+	_, _ = io.Copy(io.Discard, reader)
+	deadline := time.Now().Add(2 * time.Second)
+	code := send()
+	for code != http.StatusOK && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		code = send()
+	}
+	if code != http.StatusOK {
+		t.Errorf("流式请求结束后应释放并发名额, status = %d", code)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	defaultMaxRequestBytes        = 32 << 20  // 请求体默认上限 32MiB
+	defaultMaxResponseBytes       = 32 << 20  // 非流式响应默认上限 32MiB
+	defaultMaxStreamResponseBytes = 256 << 20 // 流式响应默认累计上限 256MiB
+)
+
+// errResponseTooLarge 上游响应超过大小限制
+var errResponseTooLarge = errors.New("upstream response too large")
+
+// readLimitedBody 读取响应体，超过limit字节时返回errResponseTooLarge
+func readLimitedBody(body io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", errResponseTooLarge, limit)
+	}
+	return data, nil
+}
+
+// limitedStreamBody 限制流式响应累计读取字节数，超过后读取返回errResponseTooLarge
+type limitedStreamBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+// newLimitedStreamBody 包装流式响应体
+func newLimitedStreamBody(body io.ReadCloser, limit int64) *limitedStreamBody {
+	return &limitedStreamBody{ReadCloser: body, limit: limit, remaining: limit}
+}
+
+// Read 读取数据并扣减剩余额度
+func (b *limitedStreamBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, fmt.Errorf("%w: stream exceeds %d bytes", errResponseTooLarge, b.limit)
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
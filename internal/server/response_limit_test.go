@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestReadLimitedBody(t *testing.T) {
+	data, err := readLimitedBody(strings.NewReader("hello"), 5)
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("readLimitedBody() = %q, %v", data, err)
+	}
+
+	if _, err := readLimitedBody(strings.NewReader("hello!"), 5); !errors.Is(err, errResponseTooLarge) {
+		t.Errorf("超过上限应返回errResponseTooLarge, got %v", err)
+	}
+}
+
+func TestLimitedStreamBody_StopsStream(t *testing.T) {
+	chunk := `data: {"choices":[{"index":0,"delta":{"content":"x"}}]}` + "\n\n"
+	body := newLimitedStreamBody(io.NopCloser(strings.NewReader(strings.Repeat(chunk, 100))), int64(len(chunk)*3))
+
+	writer := &countingStreamWriter{}
+	err := converter.NewManager().ProcessStream(body, types.ProviderOpenAI, converter.FormatOpenAI, writer)
+	if !errors.Is(err, errResponseTooLarge) {
+		t.Fatalf("累计字节超限应终止流, got %v", err)
+	}
+	if writer.chunks > 3 {
+		t.Errorf("超限后不应继续转发, 已转发 %d 个chunk", writer.chunks)
+	}
+}
+
+// countingStreamWriter 统计写入chunk数量
+type countingStreamWriter struct {
+	chunks int
+}
+
+func (w *countingStreamWriter) WriteChunk(*converter.StreamChunk) error {
+	w.chunks++
+	return nil
+}
+
+func (w *countingStreamWriter) WriteDone() error {
+	return nil
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	upstreamCalled := false
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	s.config.MaxRequestBytes = 64
+	s.mux = http.NewServeMux()
+	s.setupRoutes()
+
+	oversized := `{"model":"gpt-4o","messages":[{"role":"user","content":"` + strings.Repeat("x", 100) + `"}]}`
+	tests := []struct {
+		name    string
+		chunked bool // 不声明Content-Length，读取时才发现超限
+	}{
+		{"声明的Content-Length超限", false},
+		{"分块传输读取时超限", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(oversized))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+rawKey)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("status = %d, want 413: %s", rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), `"request_too_large"`) {
+				t.Errorf("错误体 = %s, want type request_too_large", rec.Body.String())
+			}
+		})
+	}
+	if upstreamCalled {
+		t.Error("超限请求不应转发到上游")
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/logger"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// defaultMaxFailovers 上游失败时默认最多换用其他账号的次数
+const defaultMaxFailovers = 1
+
+// retryPolicy 上游请求重试退避策略
+type retryPolicy struct {
+	maxRetries int
+	backoff    string
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	jitter     float64
+	sleep      func(ctx context.Context, d time.Duration) error // 测试中可替换
+
+	// onRateLimited 上游返回429时回调，返回true表示已切换到轮换池中的其他key，立即重试且不计入重试次数
+	onRateLimited func(req *http.Request, retryAfter time.Duration) bool
+}
+
+// newRetryPolicy 根据代理配置创建重试策略，未配置的字段使用默认值
+func newRetryPolicy(cfg *types.ProxyConfig) *retryPolicy {
+	policy := &retryPolicy{
+		backoff:   types.RetryBackoffExponential,
+		baseDelay: 500 * time.Millisecond,
+		maxDelay:  10 * time.Second,
+		sleep:     sleepContext,
+	}
+	if cfg == nil {
+		return policy
+	}
+
+	policy.maxRetries = cfg.MaxRetries
+	if cfg.RetryBackoff != "" {
+		policy.backoff = cfg.RetryBackoff
+	}
+	if cfg.RetryBaseDelayMs > 0 {
+		policy.baseDelay = time.Duration(cfg.RetryBaseDelayMs) * time.Millisecond
+	}
+	if cfg.RetryMaxDelayMs > 0 {
+		policy.maxDelay = time.Duration(cfg.RetryMaxDelayMs) * time.Millisecond
+	}
+	policy.jitter = cfg.RetryJitter
+	return policy
+}
+
+// sleepContext 等待d，ctx先结束时提前返回其错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoffDelay 计算第attempt次重试（从1开始）的退避时间
+func (p *retryPolicy) backoffDelay(attempt int) time.Duration {
+	delay := p.baseDelay
+	if p.backoff == types.RetryBackoffExponential {
+		for i := 1; i < attempt && delay < p.maxDelay; i++ {
+			delay *= 2
+		}
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+
+	if p.jitter > 0 {
+		// 在 [delay*(1-jitter), delay*(1+jitter)] 区间内随机
+		factor := 1 + p.jitter*(2*rand.Float64()-1)
+		delay = time.Duration(float64(delay) * factor)
+		if delay > p.maxDelay {
+			delay = p.maxDelay
+		}
+	}
+	return delay
+}
+
+// isRetryableStatus 判断上游状态码是否值得重试
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter 解析Retry-After头（秒数或HTTP日期）
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		delay := t.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// do 发送上游请求并按策略重试。newRequest 每次重试重新构建请求（请求体不可复用）。
+// 非2xx响应按解析出的错误类别决定是否重试：请求错误、过载等不在同一账号上重试。
+// 返回最后一次的响应或错误；重试耗尽后的非2xx响应原样返回由调用方处理。
+// 退避等待期间请求上下文结束（如客户端断开）时停止重试并返回上下文的错误。
+func (p *retryPolicy) do(client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests && p.onRateLimited != nil {
+			retryAfter, _ := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			if p.onRateLimited(req, retryAfter) {
+				logger.Warn("上游API Key被限流，换用轮换池中的其他key重试")
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+				attempt--
+				continue
+			}
+		}
+		if attempt >= p.maxRetries {
+			return resp, err
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil:
+			delay = p.backoffDelay(attempt + 1)
+			logger.Warn("上游请求失败，%v 后进行第 %d 次重试: %v", delay, attempt+1, err)
+		case resp.StatusCode >= http.StatusMultipleChoices && readUpstreamError(resp).Action() == upstreamErrorRetry:
+			delay = p.backoffDelay(attempt + 1)
+			if resp.StatusCode == http.StatusTooManyRequests {
+				// 429优先遵循上游给出的Retry-After；要求等待超过最大延迟时不再重试
+				if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+					if retryAfter > p.maxDelay {
+						return resp, nil
+					}
+					delay = retryAfter
+				}
+			}
+			logger.Warn("上游返回状态码 %d，%v 后进行第 %d 次重试", resp.StatusCode, delay, attempt+1)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		if err := p.sleep(req.Context(), delay); err != nil {
+			logger.Warn("请求已取消，停止重试: %v", err)
+			return nil, err
+		}
+	}
+}
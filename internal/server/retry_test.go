@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestRetryPolicy_BackoffDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *types.ProxyConfig
+		attempt int
+		want    time.Duration
+	}{
+		{"固定延迟", &types.ProxyConfig{RetryBackoff: types.RetryBackoffFixed, RetryBaseDelayMs: 200}, 3, 200 * time.Millisecond},
+		{"指数首次", &types.ProxyConfig{RetryBaseDelayMs: 100}, 1, 100 * time.Millisecond},
+		{"指数第三次", &types.ProxyConfig{RetryBaseDelayMs: 100}, 3, 400 * time.Millisecond},
+		{"指数封顶", &types.ProxyConfig{RetryBaseDelayMs: 100, RetryMaxDelayMs: 300}, 5, 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRetryPolicy(tt.cfg).backoffDelay(tt.attempt); got != tt.want {
+				t.Errorf("backoffDelay(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Jitter(t *testing.T) {
+	policy := newRetryPolicy(&types.ProxyConfig{RetryBackoff: types.RetryBackoffFixed, RetryBaseDelayMs: 1000, RetryJitter: 0.2})
+	for i := 0; i < 100; i++ {
+		delay := policy.backoffDelay(1)
+		if delay < 800*time.Millisecond || delay > 1200*time.Millisecond {
+			t.Fatalf("抖动后延迟超出范围: %v", delay)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if d, ok := parseRetryAfter("3", now); !ok || d != 3*time.Second {
+		t.Errorf("秒数格式: %v %v", d, ok)
+	}
+	if d, ok := parseRetryAfter(now.Add(5*time.Second).Format(http.TimeFormat), now); !ok || d != 5*time.Second {
+		t.Errorf("HTTP日期格式: %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Error("非法值应解析失败")
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	policy := newRetryPolicy(&types.ProxyConfig{MaxRetries: 3, RetryBaseDelayMs: 100})
+	policy.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	resp, err := policy.do(server.Client(), func() (*http.Request, error) {
+		return http.NewRequest("POST", server.URL, nil)
+	})
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Errorf("status=%d calls=%d", resp.StatusCode, calls)
+	}
+	// 429使用Retry-After，503使用指数退避第二次延迟
+	if len(delays) != 2 || delays[0] != 2*time.Second || delays[1] != 200*time.Millisecond {
+		t.Errorf("delays = %v", delays)
+	}
+}
+
+func TestRetryPolicy_DoRetryAfterExceedsMax(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	policy := newRetryPolicy(&types.ProxyConfig{MaxRetries: 3, RetryMaxDelayMs: 1000})
+	policy.sleep = func(context.Context, time.Duration) error {
+		t.Error("Retry-After超过最大延迟时不应等待重试")
+		return nil
+	}
+
+	resp, err := policy.do(server.Client(), func() (*http.Request, error) {
+		return http.NewRequest("POST", server.URL, nil)
+	})
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests || calls != 1 {
+		t.Errorf("status=%d calls=%d", resp.StatusCode, calls)
+	}
+}
+
+func TestRetryPolicy_DoStopsWhenCanceled(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// 退避时间远大于测试超时，只有等待随上下文取消才能及时返回
+	policy := newRetryPolicy(&types.ProxyConfig{MaxRetries: 3, RetryBaseDelayMs: 60000, RetryMaxDelayMs: 60000})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := policy.do(server.Client(), func() (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, "POST", server.URL, nil)
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("do() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("请求取消后仍在等待重试")
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryPolicy_DoRotatesRateLimitedKey(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "Bearer limited" {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// 未配置重试时，池内换key的重试不受重试次数限制
+	policy := newRetryPolicy(&types.ProxyConfig{})
+	policy.sleep = func(context.Context, time.Duration) error {
+		t.Error("换key重试不应等待")
+		return nil
+	}
+
+	current := "limited"
+	var cooldown time.Duration
+	policy.onRateLimited = func(req *http.Request, retryAfter time.Duration) bool {
+		cooldown = retryAfter
+		current = "spare"
+		return true
+	}
+
+	resp, err := policy.do(server.Client(), func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", server.URL, nil)
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+current)
+		}
+		return req, err
+	})
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(keys) != 2 || keys[1] != "Bearer spare" {
+		t.Errorf("status = %d, 请求使用的key = %v", resp.StatusCode, keys)
+	}
+	if cooldown != 30*time.Second {
+		t.Errorf("冷却时长 = %v, want 30s", cooldown)
+	}
+}
@@ -5,13 +5,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/iBreaker/llm-gateway/internal/client"
 	"github.com/iBreaker/llm-gateway/internal/config"
 	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/internal/moderation"
+	"github.com/iBreaker/llm-gateway/internal/ratelimit"
 	"github.com/iBreaker/llm-gateway/internal/router"
 	"github.com/iBreaker/llm-gateway/internal/upstream"
+	"github.com/iBreaker/llm-gateway/pkg/debug"
+	"github.com/iBreaker/llm-gateway/pkg/logger"
 	"github.com/iBreaker/llm-gateway/pkg/types"
 )
 
@@ -39,6 +46,9 @@ type HTTPServer struct {
 	proxyHandler *ProxyHandler
 	configMgr    ConfigManager
 	oauthMgr     *upstream.OAuthManager
+	webHandler   *WebHandler
+	stopCh       chan struct{} // 关闭时通知后台任务退出
+	mu           sync.Mutex    // 保护server和stopCh
 }
 
 // NewServer 创建新的HTTP服务器
@@ -55,10 +65,22 @@ func NewServer(
 
 	// 创建中间件
 	authMW := NewAuthMiddleware(clientMgr)
-	rateLimitMW := NewRateLimitMiddleware(clientMgr)
+	quotaStore, err := ratelimit.NewStoreFromConfig(&config.RateLimit)
+	if err != nil {
+		logger.Warn("限流后端配置无效，回退到内存计数: %v", err)
+		quotaStore = ratelimit.NewMemoryStore()
+	}
+	rateLimitMW := NewRateLimitMiddleware(clientMgr, ratelimit.NewWindowLimiter(quotaStore, config.RateLimit.KeyPrefix))
+
+	// 创建内容审核器（默认关闭）
+	moderator, err := moderation.NewChecker(&config.Moderation)
+	if err != nil {
+		logger.Warn("内容审核配置无效，已禁用内容审核: %v", err)
+		moderator = nil
+	}
 
 	// 创建代理处理器
-	proxyHandler := NewProxyHandler(clientMgr, upstreamMgr, router, converter, &config.Proxy, &config.ModelRoutes)
+	proxyHandler := NewProxyHandler(clientMgr, upstreamMgr, router, converter, &config.Proxy, &config.ModelRoutes, &config.Pricing, moderator, config.Capabilities)
 
 	s := &HTTPServer{
 		mux:          mux,
@@ -82,12 +104,28 @@ func NewServer(
 // setupRoutes 设置路由
 func (s *HTTPServer) setupRoutes() {
 	// 健康检查路由（无需认证）
-	s.mux.HandleFunc("/health", CORSMiddleware(LoggingMiddleware(s.handleHealth)))
+	s.mux.HandleFunc("/health", CORSMiddleware(s.config.CORS, LoggingMiddleware(s.handleHealth)))
+	// 存活/就绪探针（无需认证；探针调用频繁，不记录访问日志）
+	s.mux.HandleFunc("/healthz", s.handleLiveness)
+	s.mux.HandleFunc("/readyz", s.handleReadiness)
 
 	// API代理路由（需要完整的中间件链）
 	s.mux.HandleFunc("/v1/chat/completions", s.withMiddleware(s.proxyHandler.HandleChatCompletions))
 	s.mux.HandleFunc("/v1/completions", s.withMiddleware(s.proxyHandler.HandleCompletions))
 	s.mux.HandleFunc("/v1/messages", s.withMiddleware(s.proxyHandler.HandleMessages)) // Anthropic原生端点
+	s.mux.HandleFunc("/v1/models", s.withMiddleware(s.proxyHandler.HandleModels))     // 可用模型列表
+	s.mux.HandleFunc("/v1/tasks/", s.withMiddleware(s.proxyHandler.HandleTask))       // 异步任务查询
+	// 向量嵌入（仅OpenAI兼容上游）
+	s.mux.HandleFunc("/v1/embeddings", s.withMiddleware(s.proxyHandler.HandleEmbeddings))
+
+	// Prometheus指标（默认关闭；开启后默认需要Gateway Key认证，不计入限流）
+	if s.config.Metrics.Enabled {
+		if s.config.Metrics.Public {
+			s.mux.HandleFunc("/metrics", LoggingMiddleware(s.proxyHandler.HandleMetrics))
+		} else {
+			s.mux.HandleFunc("/metrics", LoggingMiddleware(s.authMW.Authenticate(s.proxyHandler.HandleMetrics)))
+		}
+	}
 }
 
 // setupWebRoutes 设置Web管理界面路由
@@ -96,6 +134,7 @@ func (s *HTTPServer) setupWebRoutes() {
 	// 这个方法需要在调用方传入具体的类型
 	if configMgr, ok := s.configMgr.(*config.ConfigManager); ok {
 		webHandler := NewWebHandler(configMgr, s.upstreamMgr, s.clientMgr, s.oauthMgr)
+		s.webHandler = webHandler
 		
 		// 根路径提供web管理界面
 		s.mux.HandleFunc("/", webHandler.ServeStatic)
@@ -104,55 +143,140 @@ func (s *HTTPServer) setupWebRoutes() {
 		s.mux.HandleFunc("/static/", webHandler.ServeStatic)
 		
 		// 公开的认证端点（不需要认证）
-		s.mux.HandleFunc("/api/v1/login", CORSMiddleware(LoggingMiddleware(webHandler.HandleLogin)))
-		s.mux.HandleFunc("/api/v1/logout", CORSMiddleware(LoggingMiddleware(webHandler.HandleLogout)))
-		s.mux.HandleFunc("/api/v1/change-password", CORSMiddleware(LoggingMiddleware(webHandler.HandleChangePassword)))
+		s.mux.HandleFunc("/api/v1/login", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.HandleLogin)))
+		s.mux.HandleFunc("/api/v1/logout", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.HandleLogout)))
+		s.mux.HandleFunc("/api/v1/change-password", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.HandleChangePassword)))
 		
-		// 受保护的Web API 端点（需要认证）
-		s.mux.HandleFunc("/api/v1/health", CORSMiddleware(LoggingMiddleware(webHandler.requireAuth(webHandler.HandleAPIHealth))))
-		s.mux.HandleFunc("/api/v1/config", CORSMiddleware(LoggingMiddleware(webHandler.requireAuth(webHandler.HandleAPIConfig))))
-		s.mux.HandleFunc("/api/v1/upstream", CORSMiddleware(LoggingMiddleware(webHandler.requireAuth(webHandler.HandleAPIUpstream))))
-		s.mux.HandleFunc("/api/v1/upstream/", CORSMiddleware(LoggingMiddleware(webHandler.requireAuth(webHandler.HandleAPIUpstreamDelete))))
-		s.mux.HandleFunc("/api/v1/apikeys", CORSMiddleware(LoggingMiddleware(webHandler.requireAuth(webHandler.HandleAPIKeys))))
-		s.mux.HandleFunc("/api/v1/apikeys/", CORSMiddleware(LoggingMiddleware(webHandler.requireAuth(webHandler.HandleAPIKeyActions))))
+		// 受保护的Web API 端点（需要admin权限的登录会话）
+		s.mux.HandleFunc("/api/v1/health", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleAPIHealth))))
+		s.mux.HandleFunc("/api/v1/config", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleAPIConfig))))
+		s.mux.HandleFunc("/api/v1/upstream", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleAPIUpstream))))
+		s.mux.HandleFunc("/api/v1/upstream/", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleAPIUpstreamDelete))))
+		s.mux.HandleFunc("/api/v1/upstream/batch", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleAPIUpstreamBatch))))
+		s.mux.HandleFunc("/api/v1/upstream/discover", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleAPIUpstreamDiscover))))
+		s.mux.HandleFunc("/api/v1/apikeys", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleAPIKeys))))
+		s.mux.HandleFunc("/api/v1/apikeys/", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleAPIKeyActions))))
+		s.mux.HandleFunc("/api/v1/stats/sizes", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(s.proxyHandler.HandleSizeStats))))
 		
-		// 受保护的OAuth API 端点（需要认证）
-		s.mux.HandleFunc("/api/v1/oauth/start", CORSMiddleware(LoggingMiddleware(webHandler.requireAuth(webHandler.HandleOAuthStart))))
-		s.mux.HandleFunc("/api/v1/oauth/callback", CORSMiddleware(LoggingMiddleware(webHandler.requireAuth(webHandler.HandleOAuthCallback))))
-		s.mux.HandleFunc("/api/v1/oauth/status/", CORSMiddleware(LoggingMiddleware(webHandler.requireAuth(webHandler.HandleOAuthStatus))))
+		// 受保护的OAuth API 端点（需要admin权限的登录会话）
+		s.mux.HandleFunc("/api/v1/oauth/start", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleOAuthStart))))
+		s.mux.HandleFunc("/api/v1/oauth/callback", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleOAuthCallback))))
+		s.mux.HandleFunc("/api/v1/oauth/status/", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleOAuthStatus))))
+		s.mux.HandleFunc("/api/v1/oauth/cancel", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleOAuthCancel))))
+		s.mux.HandleFunc("/api/v1/oauth/reauthorize", CORSMiddleware(s.config.CORS, LoggingMiddleware(webHandler.requireAdmin(webHandler.HandleOAuthReauthorize))))
 	}
 }
 
 // withMiddleware 应用中间件链
 func (s *HTTPServer) withMiddleware(handler http.HandlerFunc) http.HandlerFunc {
-	// 中间件链：CORS -> 日志 -> 认证 -> 限流 -> 处理器
-	return CORSMiddleware(
+	// 中间件链：CORS -> 日志 -> 请求体大小限制 -> 认证 -> 限流 -> 处理器
+	return CORSMiddleware(s.config.CORS,
 		LoggingMiddleware(
-			s.authMW.Authenticate(
-				s.rateLimitMW.RateLimit(handler),
+			MaxBytesMiddleware(s.maxRequestBytes(),
+				s.authMW.Authenticate(
+					s.rateLimitMW.RateLimit(handler),
+				),
 			),
 		),
 	)
 }
 
-// Start 启动服务器
+// maxRequestBytes API请求体上限
+func (s *HTTPServer) maxRequestBytes() int64 {
+	if s.config.MaxRequestBytes > 0 {
+		return s.config.MaxRequestBytes
+	}
+	return defaultMaxRequestBytes
+}
+
+// Start 启动服务器，阻塞直到服务器关闭。调用Stop后返回http.ErrServerClosed
 func (s *HTTPServer) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("启动 LLM Gateway 服务器，地址: %s\n", addr)
+	return s.serve(ln)
+}
+
+// serve 在指定监听器上提供服务
+func (s *HTTPServer) serve(ln net.Listener) error {
+	s.mu.Lock()
 	s.server = &http.Server{
-		Addr:    addr,
 		Handler: s.loggingMiddleware(s.mux),
 	}
 
-	fmt.Printf("启动 LLM Gateway 服务器，地址: %s\n", addr)
-	return s.server.ListenAndServe()
+	// 启动时及之后每小时检查上游凭据到期情况
+	s.stopCh = make(chan struct{})
+	go s.watchCredentialExpiry(time.Hour, s.stopCh)
+	if s.webHandler != nil {
+		go s.webHandler.sessions.sweepExpired(sessionSweepInterval, s.stopCh)
+	}
+	// 后台刷新即将过期的OAuth token，Stop时停止
+	if s.oauthMgr != nil {
+		s.oauthMgr.StartAutoRefresh(time.Duration(s.config.OAuthRefreshInterval) * time.Second)
+	}
+	server := s.server
+	s.mu.Unlock()
+
+	return server.Serve(ln)
 }
 
-// Stop 停止服务器
+// ShutdownGracePeriod 优雅关闭时等待进行中请求完成的时长
+func (s *HTTPServer) ShutdownGracePeriod() time.Duration {
+	if s.config.ShutdownGracePeriod > 0 {
+		return time.Duration(s.config.ShutdownGracePeriod) * time.Second
+	}
+	return defaultShutdownGracePeriod
+}
+
+// Stop 优雅关闭服务器：停止接受新连接，在ctx到期前等待进行中的请求完成。
+// ctx到期后通知流式响应发送结束标记，再强制关闭剩余连接，并返回ctx的错误
 func (s *HTTPServer) Stop(ctx context.Context) error {
-	if s.server != nil {
-		return s.server.Shutdown(ctx)
+	s.mu.Lock()
+	if s.stopCh != nil {
+		close(s.stopCh)
+		s.stopCh = nil
+	}
+	server := s.server
+	s.mu.Unlock()
+
+	if s.oauthMgr != nil {
+		s.oauthMgr.StopAutoRefresh()
+	}
+
+	var err error
+	if server != nil {
+		if err = server.Shutdown(ctx); err != nil {
+			s.proxyHandler.streams.cancel()
+			if !s.proxyHandler.streams.wait(streamDrainTimeout) {
+				logger.Warn("部分流式请求未能在%v内结束，将强制关闭连接", streamDrainTimeout)
+			}
+			_ = server.Close()
+		}
+	}
+
+	// 写出尚未保存的调试跟踪
+	debug.Flush()
+	return err
+}
+
+// watchCredentialExpiry 定期检查上游API Key凭据到期情况并记录提醒日志
+func (s *HTTPServer) watchCredentialExpiry(interval time.Duration, stopCh <-chan struct{}) {
+	s.upstreamMgr.CheckCredentialExpiry(time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.upstreamMgr.CheckCredentialExpiry(time.Now())
+		case <-stopCh:
+			return
+		}
 	}
-	return nil
 }
 
 // loggingMiddleware 日志中间件
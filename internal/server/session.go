@@ -0,0 +1,220 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/logger"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// DefaultSessionTTL Web会话默认有效期
+const DefaultSessionTTL = 24 * time.Hour
+
+// sessionSweepInterval 过期会话清理间隔
+const sessionSweepInterval = 10 * time.Minute
+
+// Session 会话信息
+type Session struct {
+	Token     string    `json:"-"` // 明文token只保存在内存中，持久化文件仅记录其哈希
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	// Permissions 会话拥有的权限，使用Web管理密码登录的会话拥有admin权限
+	Permissions []types.Permission `json:"permissions,omitempty"`
+}
+
+// HasPermission 判断会话是否拥有指定权限
+func (s *Session) HasPermission(permission types.Permission) bool {
+	for _, p := range s.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionStore Web会话存储，按token哈希索引；设置了持久化文件时会话变更后写入文件，重启后可恢复
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	ttl      time.Duration
+	path     string // 持久化文件路径，为空时仅保存在内存中
+}
+
+// NewSessionStore 创建会话存储，path非空时从文件加载未过期的会话
+func NewSessionStore(path string, ttl time.Duration) *SessionStore {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	s := &SessionStore{
+		sessions: make(map[string]*Session),
+		ttl:      ttl,
+		path:     path,
+	}
+	if path != "" {
+		if err := s.load(); err != nil {
+			logger.Warn("加载Web会话文件失败，已忽略: %v", err)
+		}
+	}
+	return s
+}
+
+// Create 创建拥有指定权限的新会话
+func (s *SessionStore) Create(permissions ...types.Permission) (*Session, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		Token:       base64.URLEncoding.EncodeToString(bytes),
+		ExpiresAt:   now.Add(s.ttl),
+		CreatedAt:   now,
+		Permissions: permissions,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[hashSessionToken(session.Token)] = session
+	s.persistLocked()
+	return session, nil
+}
+
+// Get 获取未过期的会话，已过期的会话会被顺带删除
+func (s *SessionStore) Get(token string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hashSessionToken(token)
+	session, exists := s.sessions[key]
+	if !exists {
+		return nil, false
+	}
+	if time.Now().After(session.ExpiresAt) {
+		delete(s.sessions, key)
+		s.persistLocked()
+		return nil, false
+	}
+	return session, true
+}
+
+// Delete 删除会话
+func (s *SessionStore) Delete(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hashSessionToken(token)
+	if _, exists := s.sessions[key]; exists {
+		delete(s.sessions, key)
+		s.persistLocked()
+	}
+}
+
+// Len 当前保存的会话数（含尚未清理的过期会话）
+func (s *SessionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Sweep 清理在now之前过期的会话，返回清理数量
+func (s *SessionStore) Sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted := 0
+	for key, session := range s.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.sessions, key)
+			evicted++
+		}
+	}
+	if evicted > 0 {
+		s.persistLocked()
+	}
+	return evicted
+}
+
+// sweepExpired 定期清理过期会话直到stopCh关闭
+func (s *SessionStore) sweepExpired(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if evicted := s.Sweep(time.Now()); evicted > 0 {
+				logger.Debug("已清理 %d 个过期Web会话", evicted)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// load 从持久化文件加载未过期的会话
+func (s *SessionStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取会话文件失败: %w", err)
+	}
+
+	var stored map[string]*Session
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("解析会话文件失败: %w", err)
+	}
+
+	now := time.Now()
+	for key, session := range stored {
+		if session != nil && now.Before(session.ExpiresAt) {
+			// 引入会话权限之前持久化的会话都由管理密码登录创建
+			if session.Permissions == nil {
+				session.Permissions = []types.Permission{types.PermissionAdmin}
+			}
+			s.sessions[key] = session
+		}
+	}
+	return nil
+}
+
+// persistLocked 将会话写入持久化文件，调用方需持有锁；写入失败只记录日志，不影响内存中的会话
+func (s *SessionStore) persistLocked() {
+	if s.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(s.sessions)
+	if err != nil {
+		logger.Warn("序列化Web会话失败: %v", err)
+		return
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致文件损坏
+	tmp := s.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err == nil {
+		err = os.WriteFile(tmp, data, 0600)
+		if err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		logger.Warn("保存Web会话文件失败: %v", err)
+	}
+}
+
+// hashSessionToken 计算会话token的哈希，持久化文件中不保存明文token
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
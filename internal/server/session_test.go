@@ -0,0 +1,111 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestSessionStore_SweepEvictsExpired(t *testing.T) {
+	store := NewSessionStore("", time.Hour)
+
+	expired, _ := store.Create()
+	active, _ := store.Create()
+	store.sessions[hashSessionToken(expired.Token)].ExpiresAt = time.Now().Add(-time.Minute)
+
+	if evicted := store.Sweep(time.Now()); evicted != 1 {
+		t.Errorf("Sweep() = %d, want 1", evicted)
+	}
+	if store.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", store.Len())
+	}
+	if _, ok := store.Get(expired.Token); ok {
+		t.Error("过期会话应被清理")
+	}
+	if _, ok := store.Get(active.Token); !ok {
+		t.Error("未过期会话不应被清理")
+	}
+}
+
+func TestSessionStore_SurvivesReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web_sessions.json")
+
+	store := NewSessionStore(path, time.Hour)
+	kept, _ := store.Create()
+	loggedOut, _ := store.Create()
+	store.Delete(loggedOut.Token)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取会话文件失败: %v", err)
+	}
+	if strings.Contains(string(data), kept.Token) {
+		t.Error("会话文件不应包含明文token")
+	}
+
+	// 模拟重启：用同一文件创建新的存储
+	reloaded := NewSessionStore(path, time.Hour)
+	session, ok := reloaded.Get(kept.Token)
+	if !ok {
+		t.Fatal("重启后会话应仍然有效")
+	}
+	if !session.ExpiresAt.Equal(store.sessions[hashSessionToken(kept.Token)].ExpiresAt) {
+		t.Errorf("ExpiresAt = %v, 重启前后应一致", session.ExpiresAt)
+	}
+	if _, ok := reloaded.Get(loggedOut.Token); ok {
+		t.Error("已登出的会话不应在重启后恢复")
+	}
+}
+
+func TestSessionStore_ReloadSkipsExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web_sessions.json")
+
+	store := NewSessionStore(path, time.Hour)
+	session, _ := store.Create()
+	store.mu.Lock()
+	store.sessions[hashSessionToken(session.Token)].ExpiresAt = time.Now().Add(-time.Second)
+	store.persistLocked()
+	store.mu.Unlock()
+
+	if reloaded := NewSessionStore(path, time.Hour); reloaded.Len() != 0 {
+		t.Errorf("加载时应跳过已过期会话, Len() = %d", reloaded.Len())
+	}
+}
+
+func TestSessionStore_Permissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web_sessions.json")
+
+	store := NewSessionStore(path, time.Hour)
+	admin, _ := store.Create(types.PermissionAdmin)
+	readOnly, _ := store.Create(types.PermissionRead)
+	legacy, _ := store.Create()
+
+	if !admin.HasPermission(types.PermissionAdmin) || readOnly.HasPermission(types.PermissionAdmin) {
+		t.Error("会话权限应与创建时指定的一致")
+	}
+
+	// 引入会话权限之前持久化的会话没有权限字段，重启后视为管理员会话
+	reloaded := NewSessionStore(path, time.Hour)
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"admin会话", admin.Token, true},
+		{"只读会话", readOnly.Token, false},
+		{"旧版本持久化的会话", legacy.Token, true},
+	}
+	for _, tt := range tests {
+		session, ok := reloaded.Get(tt.token)
+		if !ok {
+			t.Fatalf("%s: 重启后应恢复", tt.name)
+		}
+		if got := session.HasPermission(types.PermissionAdmin); got != tt.want {
+			t.Errorf("%s: HasPermission(admin) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
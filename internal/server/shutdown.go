@@ -0,0 +1,73 @@
+package server
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultShutdownGracePeriod 优雅关闭时等待进行中请求完成的默认时长
+const defaultShutdownGracePeriod = 30 * time.Second
+
+// streamDrainTimeout 宽限期结束后，等待流式响应发送结束标记的时长
+const streamDrainTimeout = 5 * time.Second
+
+// streamDrain 跟踪进行中的流式响应。优雅关闭的宽限期结束后通知它们中断上游读取，
+// 向客户端发送结束标记后正常退出，而不是直接断开连接
+type streamDrain struct {
+	active   atomic.Int64
+	cancelCh chan struct{}
+	once     sync.Once
+}
+
+func newStreamDrain() *streamDrain {
+	return &streamDrain{cancelCh: make(chan struct{})}
+}
+
+// watch 登记一个流式响应，取消时关闭上游响应体以中断读取。
+// 返回的stop函数在流结束时调用，报告流是否因关闭而被截断
+func (d *streamDrain) watch(body io.Reader) func() bool {
+	d.active.Add(1)
+	closer, ok := body.(io.Closer)
+	if !ok {
+		return func() bool {
+			d.active.Add(-1)
+			return false
+		}
+	}
+
+	var cancelled atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-d.cancelCh:
+			cancelled.Store(true)
+			_ = closer.Close()
+		case <-done:
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		d.active.Add(-1)
+		return cancelled.Load()
+	}
+}
+
+// cancel 通知所有进行中的流式响应尽快结束，可重复调用
+func (d *streamDrain) cancel() {
+	d.once.Do(func() { close(d.cancelCh) })
+}
+
+// wait 等待所有流式响应结束，超时返回false
+func (d *streamDrain) wait(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for d.active.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// startTestListener 在随机端口上启动网关，返回基础URL和serve的返回值通道
+func startTestListener(t *testing.T, s *HTTPServer) (string, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.serve(ln) }()
+	return "http://" + ln.Addr().String(), serveErr
+}
+
+// postChat 发送聊天请求并读取完整响应体
+func postChat(baseURL, rawKey, body string) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/v1/chat/completions", strings.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+rawKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data), err
+}
+
+type chatResult struct {
+	status int
+	body   string
+	err    error
+}
+
+func TestHTTPServer_StopWaitsForInFlightRequest(t *testing.T) {
+	started := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	baseURL, serveErr := startTestListener(t, s)
+
+	result := make(chan chatResult, 1)
+	go func() {
+		status, body, err := postChat(baseURL, rawKey, `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+		result <- chatResult{status, body, err}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	got := <-result
+	if got.err != nil {
+		t.Fatalf("进行中的请求不应因关闭而失败: %v", got.err)
+	}
+	if got.status != http.StatusOK || !strings.Contains(got.body, `"hi"`) {
+		t.Errorf("status = %d, body = %s", got.status, got.body)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("serve() error = %v, want http.ErrServerClosed", err)
+	}
+
+	// 关闭后不再接受新请求
+	if _, _, err := postChat(baseURL, rawKey, `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`); err == nil {
+		t.Error("关闭后的新请求应失败")
+	}
+}
+
+func TestHTTPServer_StopEndsStreamAfterGracePeriod(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		close(started)
+		// 上游一直不结束，直到网关断开连接
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer upstreamServer.Close()
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	baseURL, _ := startTestListener(t, s)
+
+	result := make(chan chatResult, 1)
+	go func() {
+		status, body, err := postChat(baseURL, rawKey, `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+		result <- chatResult{status, body, err}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	got := <-result
+	if got.err != nil {
+		t.Fatalf("流式请求应收到结束标记后正常结束: %v", got.err)
+	}
+	if !strings.Contains(got.body, `"hi"`) {
+		t.Errorf("已生成的内容丢失: %s", got.body)
+	}
+	if !strings.Contains(got.body, `"finish_reason":"length"`) || !strings.Contains(got.body, "data: [DONE]") {
+		t.Errorf("缺少截断结束标记: %s", got.body)
+	}
+}
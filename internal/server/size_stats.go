@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+var (
+	// defaultByteBuckets 默认字节数桶上界：1KiB ~ 16MiB，按4倍递增
+	defaultByteBuckets = []int64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+	// defaultTokenBuckets 默认token数桶上界
+	defaultTokenBuckets = []int64{100, 500, 1000, 4000, 16000, 32000, 64000, 128000}
+)
+
+// sizeHistogram 累积直方图，记录落在各桶上界以内的样本数，超过最大上界的计入溢出桶
+type sizeHistogram struct {
+	bounds []int64
+	counts []int64 // len(bounds)+1，最后一个为溢出桶
+	count  int64
+	sum    int64
+	max    int64
+}
+
+// newSizeHistogram 创建直方图
+func newSizeHistogram(bounds []int64) *sizeHistogram {
+	return &sizeHistogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// observe 记录一个样本
+func (h *sizeHistogram) observe(value int64) {
+	index := len(h.bounds)
+	for i, bound := range h.bounds {
+		if value <= bound {
+			index = i
+			break
+		}
+	}
+	h.counts[index]++
+	h.count++
+	h.sum += value
+	if value > h.max {
+		h.max = value
+	}
+}
+
+// merge 将另一个桶上界相同的直方图累加到h
+func (h *sizeHistogram) merge(other *sizeHistogram) {
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.count += other.count
+	h.sum += other.sum
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// histogramBucket 直方图单个桶，LE为空表示溢出桶
+type histogramBucket struct {
+	LE    *int64 `json:"le,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// histogramSnapshot 直方图快照
+type histogramSnapshot struct {
+	Count   int64             `json:"count"`
+	Sum     int64             `json:"sum"`
+	Avg     float64           `json:"avg"`
+	Max     int64             `json:"max"`
+	Buckets []histogramBucket `json:"buckets"`
+}
+
+// snapshot 生成直方图快照
+func (h *sizeHistogram) snapshot() histogramSnapshot {
+	snapshot := histogramSnapshot{
+		Count:   h.count,
+		Sum:     h.sum,
+		Max:     h.max,
+		Buckets: make([]histogramBucket, 0, len(h.counts)),
+	}
+	if h.count > 0 {
+		snapshot.Avg = float64(h.sum) / float64(h.count)
+	}
+	for i, count := range h.counts {
+		bucket := histogramBucket{Count: count}
+		if i < len(h.bounds) {
+			bound := h.bounds[i]
+			bucket.LE = &bound
+		}
+		snapshot.Buckets = append(snapshot.Buckets, bucket)
+	}
+	return snapshot
+}
+
+// sizeStats 请求体、响应体和token数的分布统计（进程内存，重启后清零）
+type sizeStats struct {
+	mutex         sync.Mutex
+	since         time.Time
+	requestBytes  *sizeHistogram
+	responseBytes *sizeHistogram
+	inputTokens   *sizeHistogram
+	outputTokens  *sizeHistogram
+}
+
+// newSizeStats 根据配置创建分布统计，未启用时返回nil
+func newSizeStats(cfg *types.SizeStatsConfig) *sizeStats {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	byteBuckets := defaultByteBuckets
+	if len(cfg.ByteBuckets) > 0 {
+		byteBuckets = cfg.ByteBuckets
+	}
+	tokenBuckets := defaultTokenBuckets
+	if len(cfg.TokenBuckets) > 0 {
+		tokenBuckets = cfg.TokenBuckets
+	}
+
+	return &sizeStats{
+		since:         time.Now(),
+		requestBytes:  newSizeHistogram(byteBuckets),
+		responseBytes: newSizeHistogram(byteBuckets),
+		inputTokens:   newSizeHistogram(tokenBuckets),
+		outputTokens:  newSizeHistogram(tokenBuckets),
+	}
+}
+
+// recordRequest 记录客户端请求体大小
+func (s *sizeStats) recordRequest(bytes int) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requestBytes.observe(int64(bytes))
+}
+
+// recordResponse 记录返回给客户端的响应体大小及token数，token数未知（为0）时不计入token分布
+func (s *sizeStats) recordResponse(bytes int, inputTokens, outputTokens int64) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responseBytes.observe(int64(bytes))
+	if inputTokens > 0 {
+		s.inputTokens.observe(inputTokens)
+	}
+	if outputTokens > 0 {
+		s.outputTokens.observe(outputTokens)
+	}
+}
+
+// sizeStatsSnapshot 分布统计快照
+type sizeStatsSnapshot struct {
+	Since         time.Time         `json:"since"`
+	RequestBytes  histogramSnapshot `json:"request_bytes"`
+	ResponseBytes histogramSnapshot `json:"response_bytes"`
+	InputTokens   histogramSnapshot `json:"input_tokens"`
+	OutputTokens  histogramSnapshot `json:"output_tokens"`
+}
+
+// snapshot 生成分布统计快照
+func (s *sizeStats) snapshot() sizeStatsSnapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sizeStatsSnapshot{
+		Since:         s.since,
+		RequestBytes:  s.requestBytes.snapshot(),
+		ResponseBytes: s.responseBytes.snapshot(),
+		InputTokens:   s.inputTokens.snapshot(),
+		OutputTokens:  s.outputTokens.snapshot(),
+	}
+}
+
+// HandleSizeStats 返回请求/响应体积及token数分布统计
+func (h *ProxyHandler) HandleSizeStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeErrorResponse(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+	if h.sizeStats == nil {
+		h.writeErrorResponse(w, http.StatusNotFound, "size_stats_disabled", "Size statistics are disabled (proxy.size_stats.enabled)")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(h.sizeStats.snapshot())
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestSizeHistogram_Observe(t *testing.T) {
+	h := newSizeHistogram([]int64{10, 100})
+	for _, v := range []int64{1, 10, 11, 100, 1000} {
+		h.observe(v)
+	}
+
+	snapshot := h.snapshot()
+	if snapshot.Count != 5 || snapshot.Sum != 1122 || snapshot.Max != 1000 {
+		t.Errorf("count/sum/max = %d/%d/%d, want 5/1122/1000", snapshot.Count, snapshot.Sum, snapshot.Max)
+	}
+	wantCounts := []int64{2, 2, 1}
+	if len(snapshot.Buckets) != len(wantCounts) {
+		t.Fatalf("len(buckets) = %d, want %d", len(snapshot.Buckets), len(wantCounts))
+	}
+	for i, want := range wantCounts {
+		if snapshot.Buckets[i].Count != want {
+			t.Errorf("bucket[%d] = %d, want %d", i, snapshot.Buckets[i].Count, want)
+		}
+	}
+	if snapshot.Buckets[2].LE != nil {
+		t.Errorf("溢出桶不应有上界, got %d", *snapshot.Buckets[2].LE)
+	}
+}
+
+func TestSizeStats_Disabled(t *testing.T) {
+	stats := newSizeStats(&types.SizeStatsConfig{})
+	if stats != nil {
+		t.Fatal("未启用时应返回nil")
+	}
+	// nil统计对象上的记录应为空操作
+	stats.recordRequest(10)
+	stats.recordResponse(10, 1, 1)
+
+	h := &ProxyHandler{}
+	rec := httptest.NewRecorder()
+	h.HandleSizeStats(rec, httptest.NewRequest(http.MethodGet, "/api/v1/stats/sizes", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandleSizeStats(t *testing.T) {
+	h := &ProxyHandler{sizeStats: newSizeStats(&types.SizeStatsConfig{
+		Enabled:      true,
+		ByteBuckets:  []int64{100},
+		TokenBuckets: []int64{10},
+	})}
+	h.sizeStats.recordRequest(50)
+	h.sizeStats.recordResponse(500, 5, 0)
+
+	rec := httptest.NewRecorder()
+	h.HandleSizeStats(rec, httptest.NewRequest(http.MethodGet, "/api/v1/stats/sizes", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var snapshot sizeStatsSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if snapshot.RequestBytes.Buckets[0].Count != 1 {
+		t.Errorf("request_bytes首个桶 = %d, want 1", snapshot.RequestBytes.Buckets[0].Count)
+	}
+	if snapshot.ResponseBytes.Buckets[1].Count != 1 {
+		t.Errorf("response_bytes溢出桶 = %d, want 1", snapshot.ResponseBytes.Buckets[1].Count)
+	}
+	if snapshot.InputTokens.Count != 1 || snapshot.OutputTokens.Count != 0 {
+		t.Errorf("input/output token样本数 = %d/%d, want 1/0", snapshot.InputTokens.Count, snapshot.OutputTokens.Count)
+	}
+
+	rec = httptest.NewRecorder()
+	h.HandleSizeStats(rec, httptest.NewRequest(http.MethodPost, "/api/v1/stats/sizes", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
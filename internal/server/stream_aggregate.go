@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/pkg/debug"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// streamAggregateHeader 调试用请求头：值为true时流式请求在网关内消费完整个流，返回聚合后的JSON响应
+const streamAggregateHeader = "X-Gateway-Stream-Aggregate"
+
+// wantsStreamAggregate 判断客户端是否要求将流式响应聚合为完整JSON
+func wantsStreamAggregate(r *http.Request) bool {
+	value := strings.TrimSpace(r.Header.Get(streamAggregateHeader))
+	return strings.EqualFold(value, "true") || value == "1"
+}
+
+// handleAggregatedStreamResponse 按流式请求上游，将转换后的客户端格式流聚合为非流式响应返回。
+// 流经过的转换、用量统计与正常流式请求完全一致，便于对比流式与非流式结果
+func (h *ProxyHandler) handleAggregatedStreamResponse(w http.ResponseWriter, account *types.UpstreamAccount, request *types.UnifiedRequest, upstreamPath string, requestFormat converter.Format, keyID string, startTime time.Time, trace *debug.RequestTrace, modelRouteContext *types.ModelRouteContext) {
+	recorder := newTaskResponseWriter()
+	account, err := h.callUpstreamStreamAPI(recorder, recorder, account, request, upstreamPath, requestFormat, keyID, startTime, trace, modelRouteContext)
+	if err != nil {
+		if trace != nil {
+			trace.SetError(err, "stream_processing")
+			trace.SaveAsync()
+		}
+		h.handleUpstreamError(w, account, requestFormat, keyID, startTime, err)
+		return
+	}
+
+	body, err := converter.AggregateStream(requestFormat, &recorder.body)
+	if err != nil {
+		h.writeErrorResponse(w, http.StatusBadGateway, "stream_aggregate_failed", "Failed to aggregate stream response: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(streamAggregateHeader, "true")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
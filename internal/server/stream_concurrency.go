@@ -0,0 +1,58 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// streamConcurrency 按Gateway Key统计进行中的流式请求数（进程内存）
+type streamConcurrency struct {
+	mutex  sync.Mutex
+	active map[string]int
+}
+
+// newStreamConcurrency 创建流式并发计数器
+func newStreamConcurrency() *streamConcurrency {
+	return &streamConcurrency{active: make(map[string]int)}
+}
+
+// acquire 占用一个流式连接名额，已达Key的max_concurrent_streams上限时返回false；
+// 成功后调用方必须在流结束时调用release
+func (c *streamConcurrency) acquire(key *types.GatewayAPIKey) bool {
+	limit := maxConcurrentStreams(key)
+	if limit <= 0 {
+		return true
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.active[key.ID] >= limit {
+		return false
+	}
+	c.active[key.ID]++
+	return true
+}
+
+// release 归还acquire占用的名额
+func (c *streamConcurrency) release(key *types.GatewayAPIKey) {
+	if maxConcurrentStreams(key) <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.active[key.ID] <= 1 {
+		delete(c.active, key.ID)
+		return
+	}
+	c.active[key.ID]--
+}
+
+// maxConcurrentStreams 返回Key的流式并发上限，未配置时为0
+func maxConcurrentStreams(key *types.GatewayAPIKey) int {
+	if key == nil || key.RateLimit == nil {
+		return 0
+	}
+	return key.RateLimit.MaxConcurrentStreams
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestStreamConcurrency_PerKeyLimit(t *testing.T) {
+	slots := newStreamConcurrency()
+	limited := &types.GatewayAPIKey{ID: "k1", RateLimit: &types.RateLimitConfig{MaxConcurrentStreams: 2}}
+	other := &types.GatewayAPIKey{ID: "k2", RateLimit: &types.RateLimitConfig{MaxConcurrentStreams: 1}}
+
+	if !slots.acquire(limited) || !slots.acquire(limited) {
+		t.Fatal("未达上限时应允许流式请求")
+	}
+	if slots.acquire(limited) {
+		t.Error("超出上限时应拒绝新的流式请求")
+	}
+	if !slots.acquire(other) {
+		t.Error("不同Key的计数应相互独立")
+	}
+
+	slots.release(limited)
+	if !slots.acquire(limited) {
+		t.Error("释放名额后应允许新的流式请求")
+	}
+
+	slots.release(limited)
+	slots.release(limited)
+	slots.release(other)
+	if len(slots.active) != 0 {
+		t.Errorf("全部释放后不应残留计数: %v", slots.active)
+	}
+}
+
+func TestStreamConcurrency_Unlimited(t *testing.T) {
+	slots := newStreamConcurrency()
+	keys := []*types.GatewayAPIKey{
+		nil,
+		{ID: "no-rate-limit"},
+		{ID: "zero", RateLimit: &types.RateLimitConfig{}},
+	}
+
+	for _, key := range keys {
+		for i := 0; i < 10; i++ {
+			if !slots.acquire(key) {
+				t.Fatalf("未配置上限时不应拒绝: %+v", key)
+			}
+		}
+		slots.release(key)
+	}
+	if len(slots.active) != 0 {
+		t.Errorf("未配置上限时不应计数: %v", slots.active)
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import "encoding/json"
+
+// streamTextPayload 从客户端格式的流式数据块中提取文本增量所需的字段
+type streamTextPayload struct {
+	// Anthropic: content_block_delta 的 text_delta
+	Type  string `json:"type"`
+	Delta *struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+
+	// OpenAI: choices[].delta.content
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// streamChunkText 提取单个流式数据块中的文本增量，多choice时只取index为0的choice
+func streamChunkText(data []byte) string {
+	var payload streamTextPayload
+	// 字段类型不匹配时仍会填充其余字段，这里忽略错误尽量提取
+	_ = json.Unmarshal(data, &payload)
+
+	if payload.Type == "content_block_delta" && payload.Delta != nil && payload.Delta.Type == "text_delta" {
+		return payload.Delta.Text
+	}
+	for _, choice := range payload.Choices {
+		if choice.Index == 0 {
+			return choice.Delta.Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/pkg/debug"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestHTTPStreamWriter_AccumulatesContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []*converter.StreamChunk
+	}{
+		{
+			name: "openai",
+			chunks: []*converter.StreamChunk{
+				{Data: map[string]interface{}{"choices": []interface{}{map[string]interface{}{"index": 0, "delta": map[string]interface{}{"role": "assistant"}}}}},
+				{Data: map[string]interface{}{"choices": []interface{}{map[string]interface{}{"index": 0, "delta": map[string]interface{}{"content": "Hello, "}}}}},
+				{Data: map[string]interface{}{"choices": []interface{}{map[string]interface{}{"index": 1, "delta": map[string]interface{}{"content": "ignored"}}}}},
+				{Data: map[string]interface{}{"choices": []interface{}{map[string]interface{}{"index": 0, "delta": map[string]interface{}{"content": "world"}}}}},
+				{IsDone: true},
+			},
+		},
+		{
+			name: "anthropic",
+			chunks: []*converter.StreamChunk{
+				{EventType: "message_start", Data: map[string]interface{}{"type": "message_start"}},
+				{EventType: "content_block_delta", Data: map[string]interface{}{"type": "content_block_delta", "delta": map[string]interface{}{"type": "text_delta", "text": "Hello, "}}},
+				{EventType: "content_block_delta", Data: map[string]interface{}{"type": "content_block_delta", "delta": map[string]interface{}{"type": "input_json_delta", "partial_json": "{}"}}},
+				{EventType: "content_block_delta", Data: map[string]interface{}{"type": "content_block_delta", "delta": map[string]interface{}{"type": "text_delta", "text": "world"}}},
+				{EventType: "message_stop", Data: map[string]interface{}{"type": "message_stop"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			trace := &debug.RequestTrace{RequestID: "req-1"}
+			writer := &httpStreamWriter{writer: rec, flusher: rec, trace: trace}
+
+			for _, chunk := range tt.chunks {
+				if err := writer.WriteChunk(chunk); err != nil {
+					t.Fatalf("WriteChunk() error = %v", err)
+				}
+			}
+			trace.SetStreamContent(writer.content.String())
+
+			if trace.StreamContent != "Hello, world" {
+				t.Errorf("StreamContent = %q, want %q", trace.StreamContent, "Hello, world")
+			}
+		})
+	}
+}
+
+func TestHTTPStreamWriter_NoContentWithoutTrace(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writer := &httpStreamWriter{writer: rec, flusher: rec}
+
+	chunk := &converter.StreamChunk{Data: map[string]interface{}{"choices": []interface{}{map[string]interface{}{"index": 0, "delta": map[string]interface{}{"content": "hi"}}}}}
+	if err := writer.WriteChunk(chunk); err != nil {
+		t.Fatalf("WriteChunk() error = %v", err)
+	}
+	if writer.content.Len() != 0 {
+		t.Error("未启用trace时不应累积响应内容")
+	}
+}
+
+func TestHTTPStreamWriter_RecordsUpstreamUsage(t *testing.T) {
+	data, err := os.ReadFile("../converter/testdata/stream/stream_anthropic_basic.txt")
+	if err != nil {
+		t.Fatalf("读取测试数据失败: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	writer := &httpStreamWriter{writer: rec, flusher: rec}
+	if err := converter.NewManager().ProcessStream(strings.NewReader(string(data)), types.ProviderAnthropic, converter.FormatOpenAI, writer); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	// 上游message_start报告 input_tokens=25，message_delta报告 output_tokens=15
+	if writer.usage != (converter.StreamUsage{InputTokens: 25, OutputTokens: 15}) {
+		t.Errorf("usage = %+v, want input 25 / output 15", writer.usage)
+	}
+	if strings.Contains(rec.Body.String(), "data: null") {
+		t.Errorf("仅携带用量的数据块不应写给客户端: %s", rec.Body.String())
+	}
+}
+
+func TestHTTPStreamWriter_UsageMatchesNonStream(t *testing.T) {
+	data, err := os.ReadFile("../converter/testdata/stream/stream_anthropic_usage.txt")
+	if err != nil {
+		t.Fatalf("读取测试数据失败: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	writer := &httpStreamWriter{writer: rec, flusher: rec}
+	if err := converter.NewManager().ProcessStream(strings.NewReader(string(data)), types.ProviderAnthropic, converter.FormatAnthropic, writer); err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	// 同一回复的非流式响应体
+	body := []byte(`{"id":"msg_014p7gG3wDgGV9EUtLvnow3U","type":"message","role":"assistant","content":[],"stop_reason":"tool_use","usage":{"input_tokens":472,"output_tokens":89}}`)
+	inputTokens, outputTokens := extractUsage(converter.FormatAnthropic, body)
+	if int64(writer.usage.InputTokens) != inputTokens || int64(writer.usage.OutputTokens) != outputTokens {
+		t.Errorf("流式usage = %+v, 非流式 = %d/%d", writer.usage, inputTokens, outputTokens)
+	}
+}
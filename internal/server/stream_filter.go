@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// headerStreamEvents 客户端声明需要的流式事件类型（逗号分隔），未设置时发送全部事件
+const headerStreamEvents = "X-Stream-Events"
+
+// parseStreamEvents 解析客户端声明的流式事件类型，未声明时返回nil表示不过滤
+func parseStreamEvents(r *http.Request) map[string]bool {
+	var events map[string]bool
+	for _, value := range r.Header.Values(headerStreamEvents) {
+		for _, eventType := range strings.Split(value, ",") {
+			eventType = strings.TrimSpace(eventType)
+			if eventType == "" {
+				continue
+			}
+			if events == nil {
+				events = make(map[string]bool)
+			}
+			events[eventType] = true
+		}
+	}
+	return events
+}
+
+// allowStreamEvent 判断事件是否发送给客户端。
+// 只过滤命名事件（Anthropic格式）；OpenAI格式的chunk没有事件名，error事件始终发送。
+func allowStreamEvent(events map[string]bool, eventType string) bool {
+	return events == nil || eventType == "" || eventType == "error" || events[eventType]
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/internal/converter"
+)
+
+func TestParseStreamEvents(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/messages", nil)
+	if events := parseStreamEvents(r); events != nil {
+		t.Errorf("未设置请求头时应不过滤, got %v", events)
+	}
+
+	r.Header.Add(headerStreamEvents, "content_block_delta, message_stop")
+	r.Header.Add(headerStreamEvents, ",message_start")
+	want := map[string]bool{"content_block_delta": true, "message_stop": true, "message_start": true}
+	if events := parseStreamEvents(r); !reflect.DeepEqual(events, want) {
+		t.Errorf("parseStreamEvents() = %v, want %v", events, want)
+	}
+}
+
+func TestHTTPStreamWriter_FiltersEvents(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writer := &httpStreamWriter{
+		writer:  rec,
+		flusher: rec,
+		events:  map[string]bool{"content_block_delta": true, "message_stop": true},
+	}
+
+	chunks := []*converter.StreamChunk{
+		{EventType: "message_start", Data: map[string]interface{}{"type": "message_start"}},
+		{EventType: "ping", Data: map[string]interface{}{"type": "ping"}},
+		{EventType: "content_block_start", Data: map[string]interface{}{"type": "content_block_start"}},
+		{EventType: "content_block_delta", Data: map[string]interface{}{"type": "content_block_delta"}, Usage: &converter.StreamUsage{OutputTokens: 2}},
+		{EventType: "content_block_stop", Data: map[string]interface{}{"type": "content_block_stop"}},
+		{EventType: "error", Data: map[string]interface{}{"type": "error"}},
+		{EventType: "message_stop", Data: map[string]interface{}{"type": "message_stop"}},
+		{IsDone: true},
+	}
+	for _, chunk := range chunks {
+		if err := writer.WriteChunk(chunk); err != nil {
+			t.Fatalf("WriteChunk() error = %v", err)
+		}
+	}
+
+	var sent []string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			sent = append(sent, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	if want := []string{"content_block_delta", "error", "message_stop"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("发送的事件 = %v, want %v", sent, want)
+	}
+	if !strings.Contains(rec.Body.String(), "data: [DONE]") {
+		t.Error("结束标记不应被过滤")
+	}
+	if writer.usage.OutputTokens != 2 {
+		t.Errorf("output tokens = %d, want 2", writer.usage.OutputTokens)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/converter"
+)
+
+// streamDurationGuard 流式请求总时长护栏
+//
+// 区别于连接空闲超时：无论上游是否持续输出，到达上限后都关闭上游响应体，
+// 使流式转换因读取失败而结束，再由调用方向客户端补发截断标记。
+type streamDurationGuard struct {
+	timer     *time.Timer
+	truncated atomic.Bool
+}
+
+// startStreamDurationGuard 启动时长护栏，未设置上限或响应体不可关闭时返回nil
+func startStreamDurationGuard(body io.Reader, limit time.Duration) *streamDurationGuard {
+	closer, ok := body.(io.Closer)
+	if limit <= 0 || !ok {
+		return nil
+	}
+
+	guard := &streamDurationGuard{}
+	guard.timer = time.AfterFunc(limit, func() {
+		guard.truncated.Store(true)
+		_ = closer.Close()
+	})
+	return guard
+}
+
+// stop 停止护栏，返回流是否因超时被截断
+func (g *streamDurationGuard) stop() bool {
+	if g == nil {
+		return false
+	}
+	g.timer.Stop()
+	return g.truncated.Load()
+}
+
+// 截断时各客户端格式默认的结束原因
+const (
+	defaultOpenAITruncateReason    = "length"
+	defaultAnthropicTruncateReason = "max_tokens"
+)
+
+// 各客户端格式合法的结束原因。配置的截断原因不属于请求格式时使用该格式的默认值，
+// 避免向OpenAI客户端发送Anthropic的stop_reason（或相反）
+var (
+	openAIFinishReasons  = map[string]bool{"stop": true, "length": true, "content_filter": true, "tool_calls": true, "function_call": true}
+	anthropicStopReasons = map[string]bool{"end_turn": true, "max_tokens": true, "stop_sequence": true, "tool_use": true, "pause_turn": true, "refusal": true}
+)
+
+// streamTruncateReason 返回请求格式下的截断原因，未配置或不属于该格式时返回该格式的默认值
+func streamTruncateReason(format converter.Format, configured string) string {
+	if format == converter.FormatAnthropic {
+		if anthropicStopReasons[configured] {
+			return configured
+		}
+		return defaultAnthropicTruncateReason
+	}
+	if openAIFinishReasons[configured] {
+		return configured
+	}
+	return defaultOpenAITruncateReason
+}
+
+// validTruncateReason 判断截断原因是否至少属于一种客户端格式
+func validTruncateReason(reason string) bool {
+	return openAIFinishReasons[reason] || anthropicStopReasons[reason]
+}
+
+// writeStreamTruncation 按客户端格式发送截断结束标记，reason按请求格式校验
+func writeStreamTruncation(writer converter.StreamWriter, format converter.Format, reason string) error {
+	var chunks []*converter.StreamChunk
+	reason = streamTruncateReason(format, reason)
+
+	switch format {
+	case converter.FormatAnthropic:
+		chunks = []*converter.StreamChunk{
+			{
+				EventType: "message_delta",
+				Data: map[string]interface{}{
+					"type":  "message_delta",
+					"delta": map[string]interface{}{"stop_reason": reason, "stop_sequence": nil},
+				},
+			},
+			{
+				EventType: "message_stop",
+				Data:      map[string]interface{}{"type": "message_stop"},
+			},
+		}
+	default:
+		chunks = []*converter.StreamChunk{
+			{
+				Data: map[string]interface{}{
+					"choices": []interface{}{
+						map[string]interface{}{
+							"index":         0,
+							"delta":         map[string]interface{}{},
+							"finish_reason": reason,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	for _, chunk := range chunks {
+		if err := writer.WriteChunk(chunk); err != nil {
+			return err
+		}
+	}
+	return writer.WriteDone()
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestStreamDurationGuard_TruncatesEndlessStream(t *testing.T) {
+	reader, upstream := io.Pipe()
+	go func() {
+		// 上游输出一个chunk后持续不结束，模拟陷入循环生成
+		_, _ = upstream.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"loop"}}]}` + "\n\n"))
+	}()
+
+	rec := httptest.NewRecorder()
+	writer := &httpStreamWriter{writer: rec, flusher: rec}
+
+	guard := startStreamDurationGuard(reader, 50*time.Millisecond)
+	start := time.Now()
+	err := converter.NewManager().ProcessStream(reader, types.ProviderOpenAI, converter.FormatOpenAI, writer)
+
+	if !guard.stop() || err == nil {
+		t.Fatalf("超时后应截断上游读取, truncated=%v err=%v", guard.truncated.Load(), err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("截断耗时过长: %v", elapsed)
+	}
+
+	if err := writeStreamTruncation(writer, converter.FormatOpenAI, ""); err != nil {
+		t.Fatalf("writeStreamTruncation() error = %v", err)
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, `"content":"loop"`) {
+		t.Errorf("截断前的内容应已发送: %s", body)
+	}
+	if !strings.Contains(body, `"finish_reason":"length"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("缺少截断标记: %s", body)
+	}
+}
+
+func TestStreamDurationGuard_Disabled(t *testing.T) {
+	if guard := startStreamDurationGuard(io.NopCloser(strings.NewReader("")), 0); guard != nil {
+		t.Error("未设置上限时不应启动护栏")
+	}
+	if guard := startStreamDurationGuard(strings.NewReader(""), time.Second); guard != nil {
+		t.Error("不可关闭的响应体不应启动护栏")
+	}
+
+	var guard *streamDurationGuard
+	if guard.stop() {
+		t.Error("nil护栏不应报告截断")
+	}
+}
+
+func TestWriteStreamTruncation_Anthropic(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writer := &httpStreamWriter{writer: rec, flusher: rec}
+
+	if err := writeStreamTruncation(writer, converter.FormatAnthropic, "end_turn"); err != nil {
+		t.Fatalf("writeStreamTruncation() error = %v", err)
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "event: message_delta\n") || !strings.Contains(body, `"stop_reason":"end_turn"`) {
+		t.Errorf("缺少message_delta截断标记: %s", body)
+	}
+	if !strings.Contains(body, "event: message_stop\n") {
+		t.Errorf("缺少message_stop: %s", body)
+	}
+}
+
+func TestStreamTruncateReason(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     converter.Format
+		configured string
+		want       string
+	}{
+		{"OpenAI默认", converter.FormatOpenAI, "", "length"},
+		{"Anthropic默认", converter.FormatAnthropic, "", "max_tokens"},
+		{"OpenAI配置值", converter.FormatOpenAI, "stop", "stop"},
+		{"Anthropic配置值", converter.FormatAnthropic, "end_turn", "end_turn"},
+		{"Anthropic原因用于OpenAI请求", converter.FormatOpenAI, "max_tokens", "length"},
+		{"OpenAI原因用于Anthropic请求", converter.FormatAnthropic, "length", "max_tokens"},
+		{"未知原因", converter.FormatAnthropic, "custom_limit", "max_tokens"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := streamTruncateReason(tt.format, tt.configured); got != tt.want {
+				t.Errorf("streamTruncateReason(%s, %q) = %q, want %q", tt.format, tt.configured, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// 异步任务状态
+const (
+	TaskStatusPending   = "pending"
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusFailed    = "failed"
+)
+
+// 异步任务数量的默认上限
+const (
+	defaultTaskRetention         = time.Hour
+	defaultMaxPendingTasksPerKey = 10
+	defaultMaxPendingTasks       = 100
+	defaultMaxTaskResults        = 1000
+)
+
+// 无法创建异步任务的原因
+var (
+	errTooManyKeyTasks = errors.New("too many pending async tasks for this key")
+	errTooManyTasks    = errors.New("too many pending async tasks")
+)
+
+// AsyncTask 单个请求异步化后的任务
+type AsyncTask struct {
+	ID         string          `json:"task_id"`
+	KeyID      string          `json:"-"` // 提交任务的Gateway Key，只允许同一Key查询
+	Status     string          `json:"status"`
+	StatusCode int             `json:"status_code,omitempty"` // 完成后的HTTP状态码
+	Result     json.RawMessage `json:"result,omitempty"`      // 完成后的响应体（客户端请求格式）
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// TaskManager 内存异步任务存储，限制处理中的任务数，已完成的任务在保留期后或超过保留数量时清理
+type TaskManager struct {
+	mutex     sync.RWMutex
+	tasks     map[string]*AsyncTask
+	pending   map[string]int // Gateway Key -> 处理中的任务数
+	retention time.Duration
+	now       func() time.Time
+
+	maxPendingPerKey int
+	maxPending       int
+	maxResults       int
+}
+
+// NewTaskManager 创建异步任务管理器，config为nil或字段为0时使用默认值
+func NewTaskManager(config *types.AsyncTaskConfig) *TaskManager {
+	m := &TaskManager{
+		tasks:            make(map[string]*AsyncTask),
+		pending:          make(map[string]int),
+		retention:        defaultTaskRetention,
+		now:              time.Now,
+		maxPendingPerKey: defaultMaxPendingTasksPerKey,
+		maxPending:       defaultMaxPendingTasks,
+		maxResults:       defaultMaxTaskResults,
+	}
+	if config != nil {
+		if config.RetentionSeconds > 0 {
+			m.retention = time.Duration(config.RetentionSeconds) * time.Second
+		}
+		if config.MaxPendingPerKey > 0 {
+			m.maxPendingPerKey = config.MaxPendingPerKey
+		}
+		if config.MaxPending > 0 {
+			m.maxPending = config.MaxPending
+		}
+		if config.MaxResults > 0 {
+			m.maxResults = config.MaxResults
+		}
+	}
+	return m
+}
+
+// Create 创建待处理任务，Key或全局处理中的任务数已达上限时返回错误
+func (m *TaskManager) Create(keyID string) (*AsyncTask, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.pending[keyID] >= m.maxPendingPerKey {
+		return nil, errTooManyKeyTasks
+	}
+	total := 0
+	for _, count := range m.pending {
+		total += count
+	}
+	if total >= m.maxPending {
+		return nil, errTooManyTasks
+	}
+
+	m.cleanupLocked()
+
+	now := m.now()
+	task := &AsyncTask{
+		ID:        generateTaskID(),
+		KeyID:     keyID,
+		Status:    TaskStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.tasks[task.ID] = task
+	m.pending[keyID]++
+
+	taskCopy := *task
+	return &taskCopy, nil
+}
+
+// Get 获取任务副本
+func (m *TaskManager) Get(taskID string) (*AsyncTask, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	task, ok := m.tasks[taskID]
+	if !ok {
+		return nil, false
+	}
+	taskCopy := *task
+	return &taskCopy, true
+}
+
+// Complete 记录任务结果，2xx视为成功
+func (m *TaskManager) Complete(taskID string, statusCode int, body []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	task, ok := m.tasks[taskID]
+	if !ok || task.Status != TaskStatusPending {
+		return
+	}
+
+	if m.pending[task.KeyID] <= 1 {
+		delete(m.pending, task.KeyID)
+	} else {
+		m.pending[task.KeyID]--
+	}
+
+	task.StatusCode = statusCode
+	task.UpdatedAt = m.now()
+	if statusCode >= 200 && statusCode < 300 {
+		task.Status = TaskStatusSucceeded
+	} else {
+		task.Status = TaskStatusFailed
+	}
+	if json.Valid(body) {
+		task.Result = json.RawMessage(body)
+	} else {
+		task.Result, _ = json.Marshal(string(body))
+	}
+
+	m.cleanupLocked()
+}
+
+// cleanupLocked 清理超过保留期的已完成任务，已完成任务仍超过保留数量时淘汰最早完成的（调用方需持有写锁）
+func (m *TaskManager) cleanupLocked() {
+	cutoff := m.now().Add(-m.retention)
+	var completed []*AsyncTask
+	for id, task := range m.tasks {
+		if task.Status == TaskStatusPending {
+			continue
+		}
+		if task.UpdatedAt.Before(cutoff) {
+			delete(m.tasks, id)
+			continue
+		}
+		completed = append(completed, task)
+	}
+
+	if len(completed) <= m.maxResults {
+		return
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return completed[i].UpdatedAt.Before(completed[j].UpdatedAt)
+	})
+	for _, task := range completed[:len(completed)-m.maxResults] {
+		delete(m.tasks, task.ID)
+	}
+}
+
+// generateTaskID 生成任务ID
+func generateTaskID() string {
+	bytes := make([]byte, 12)
+	_, _ = rand.Read(bytes)
+	return "task_" + hex.EncodeToString(bytes)
+}
+
+// wantsAsync 判断客户端是否请求异步模式（RFC 7240: Prefer: respond-async）
+func wantsAsync(r *http.Request) bool {
+	for _, value := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// taskResponseWriter 在内存中缓冲异步任务的响应
+type taskResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newTaskResponseWriter() *taskResponseWriter {
+	return &taskResponseWriter{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (w *taskResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *taskResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+// Flush 缓冲在内存中，无需刷新；使其可作为流式响应的写入目标
+func (w *taskResponseWriter) Flush() {}
+
+func (w *taskResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestWantsAsync(t *testing.T) {
+	tests := []struct {
+		prefer string
+		want   bool
+	}{
+		{"", false},
+		{"respond-async", true},
+		{"wait=10, respond-async", true},
+		{"return=minimal", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		if tt.prefer != "" {
+			r.Header.Set("Prefer", tt.prefer)
+		}
+		if got := wantsAsync(r); got != tt.want {
+			t.Errorf("wantsAsync(%q) = %v, want %v", tt.prefer, got, tt.want)
+		}
+	}
+}
+
+func TestTaskManager_Lifecycle(t *testing.T) {
+	now := time.Now()
+	mgr := NewTaskManager(nil)
+	mgr.now = func() time.Time { return now }
+
+	task, _ := mgr.Create("key-1")
+	if task.Status != TaskStatusPending {
+		t.Fatalf("新任务状态 = %s, want pending", task.Status)
+	}
+
+	mgr.Complete(task.ID, 200, []byte(`{"id":"chatcmpl-1"}`))
+	got, ok := mgr.Get(task.ID)
+	if !ok || got.Status != TaskStatusSucceeded || string(got.Result) != `{"id":"chatcmpl-1"}` {
+		t.Fatalf("完成后任务 = %+v", got)
+	}
+
+	failed, _ := mgr.Create("key-1")
+	mgr.Complete(failed.ID, 502, []byte("bad gateway"))
+	if got, _ := mgr.Get(failed.ID); got.Status != TaskStatusFailed || string(got.Result) != `"bad gateway"` {
+		t.Errorf("失败任务 = %+v", got)
+	}
+
+	// 超过保留期的已完成任务在下次创建时清理，进行中的任务保留
+	pending, _ := mgr.Create("key-1")
+	now = now.Add(2 * time.Hour)
+	mgr.Create("key-1")
+	if _, ok := mgr.Get(task.ID); ok {
+		t.Error("过期的已完成任务应被清理")
+	}
+	if _, ok := mgr.Get(pending.ID); !ok {
+		t.Error("进行中的任务不应被清理")
+	}
+}
+
+func TestTaskManager_Limits(t *testing.T) {
+	now := time.Now()
+	mgr := NewTaskManager(&types.AsyncTaskConfig{MaxPendingPerKey: 2, MaxPending: 3, MaxResults: 2})
+	mgr.now = func() time.Time { return now }
+
+	// 每个Key的处理中任务上限
+	first, _ := mgr.Create("key-1")
+	if _, err := mgr.Create("key-1"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := mgr.Create("key-1"); err != errTooManyKeyTasks {
+		t.Errorf("超过Key上限 Create() error = %v, want %v", err, errTooManyKeyTasks)
+	}
+
+	// 全局处理中任务上限
+	if _, err := mgr.Create("key-2"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := mgr.Create("key-3"); err != errTooManyTasks {
+		t.Errorf("超过全局上限 Create() error = %v, want %v", err, errTooManyTasks)
+	}
+
+	// 任务完成后释放名额
+	mgr.Complete(first.ID, 200, []byte(`{}`))
+	if _, err := mgr.Create("key-1"); err != nil {
+		t.Errorf("任务完成后 Create() error = %v", err)
+	}
+
+	// 已完成任务超过保留数量时淘汰最早完成的
+	mgr = NewTaskManager(&types.AsyncTaskConfig{MaxResults: 2})
+	mgr.now = func() time.Time { return now }
+	var ids []string
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		task, _ := mgr.Create("key-1")
+		mgr.Complete(task.ID, 200, []byte(`{}`))
+		ids = append(ids, task.ID)
+	}
+	if _, ok := mgr.Get(ids[0]); ok {
+		t.Error("超过保留数量时最早完成的任务应被淘汰")
+	}
+	for _, id := range ids[1:] {
+		if _, ok := mgr.Get(id); !ok {
+			t.Errorf("任务 %s 不应被淘汰", id)
+		}
+	}
+}
+
+func TestProxyHandler_HandleTaskKeyIsolation(t *testing.T) {
+	h := &ProxyHandler{tasks: NewTaskManager(nil)}
+	task, _ := h.tasks.Create("key-1")
+
+	for keyID, wantStatus := range map[string]int{"key-1": 200, "key-2": 404} {
+		r := httptest.NewRequest("GET", "/v1/tasks/"+task.ID, nil)
+		r.Header.Set("X-Gateway-Key-ID", keyID)
+		w := httptest.NewRecorder()
+		h.HandleTask(w, r)
+		if w.Code != wantStatus {
+			t.Errorf("key %s 查询任务状态码 = %d, want %d", keyID, w.Code, wantStatus)
+		}
+	}
+}
+
+func TestProxy_AsyncTaskLimit(t *testing.T) {
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+	defer close(release)
+
+	s, rawKey := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+	s.proxyHandler.tasks = NewTaskManager(&types.AsyncTaskConfig{MaxPendingPerKey: 1})
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+rawKey)
+		req.Header.Set("Prefer", "respond-async")
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(); rec.Code != http.StatusAccepted {
+		t.Fatalf("第一个异步请求状态码 = %d, want 202: %s", rec.Code, rec.Body.String())
+	}
+	rec := send()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("超过处理中任务上限状态码 = %d, want 429: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "async_task_limit_exceeded") {
+		t.Errorf("错误类型应为async_task_limit_exceeded: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context 相关头部
+const (
+	headerTraceParent = "traceparent"
+	headerTraceState  = "tracestate"
+)
+
+// TraceContext W3C Trace Context 信息
+type TraceContext struct {
+	TraceID  string // 32位十六进制，整条链路共享
+	ParentID string // 上游调用方的span ID（客户端未携带时为空）
+	SpanID   string // Gateway 本次处理的span ID
+	Flags    string // trace-flags，默认 01（sampled）
+	State    string // tracestate 原样透传
+}
+
+// TraceParent 生成向上游传播的 traceparent 头（以 Gateway 的 span 作为父级）
+func (tc *TraceContext) TraceParent() string {
+	if tc == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%s", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// extractTraceContext 从客户端请求中提取 trace context，无效或缺失时生成新的 trace ID
+func extractTraceContext(r *http.Request) *TraceContext {
+	tc := &TraceContext{
+		SpanID: randomHex(8),
+		Flags:  "01",
+	}
+
+	if traceID, parentID, flags, ok := parseTraceParent(r.Header.Get(headerTraceParent)); ok {
+		tc.TraceID = traceID
+		tc.ParentID = parentID
+		tc.Flags = flags
+		tc.State = r.Header.Get(headerTraceState)
+	} else {
+		tc.TraceID = randomHex(16)
+	}
+
+	return tc
+}
+
+// parseTraceParent 解析 traceparent 头，格式: version-traceid-parentid-flags
+func parseTraceParent(value string) (traceID, parentID, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return "", "", "", false
+	}
+
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+
+	// 版本 ff 无效；版本 00 必须恰好4段
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", "", "", false
+	}
+	if !isLowerHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return "", "", "", false
+	}
+	if !isLowerHex(parentID, 16) || parentID == strings.Repeat("0", 16) {
+		return "", "", "", false
+	}
+	if !isLowerHex(flags, 2) {
+		return "", "", "", false
+	}
+
+	return traceID, parentID, flags, true
+}
+
+// isLowerHex 检查字符串是否为指定长度的小写十六进制
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, c := range s {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex 生成指定字节数的随机十六进制字符串
+func randomHex(n int) string {
+	bytes := make([]byte, n)
+	_, _ = rand.Read(bytes) // crypto/rand.Read never fails
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"合法头部", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"未来版本允许附加字段", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"空值", "", false},
+		{"版本ff无效", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"版本00多余字段", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"全零trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"全零parent id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"大写十六进制", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"长度错误", "00-4bf92f3577b34da6-00f067aa0ba902b7-01", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, ok := parseTraceParent(tt.value)
+			if ok != tt.valid {
+				t.Errorf("parseTraceParent(%q) ok = %v, want %v", tt.value, ok, tt.valid)
+			}
+		})
+	}
+}
+
+func TestExtractTraceContext(t *testing.T) {
+	t.Run("沿用客户端trace id", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		req.Header.Set("tracestate", "vendor=value")
+
+		tc := extractTraceContext(req)
+		if tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("TraceID = %s", tc.TraceID)
+		}
+		if tc.ParentID != "00f067aa0ba902b7" {
+			t.Errorf("ParentID = %s", tc.ParentID)
+		}
+		if tc.SpanID == tc.ParentID || len(tc.SpanID) != 16 {
+			t.Errorf("SpanID 应为新生成的16位十六进制, got %s", tc.SpanID)
+		}
+		if tc.State != "vendor=value" {
+			t.Errorf("State = %s", tc.State)
+		}
+
+		// 传播给上游的traceparent应以Gateway的span作为父级
+		if _, parentID, _, ok := parseTraceParent(tc.TraceParent()); !ok || parentID != tc.SpanID {
+			t.Errorf("TraceParent() = %s 无效", tc.TraceParent())
+		}
+	})
+
+	t.Run("缺失时生成新trace", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/messages", nil)
+		req.Header.Set("tracestate", "vendor=value")
+
+		tc := extractTraceContext(req)
+		if len(tc.TraceID) != 32 || tc.ParentID != "" {
+			t.Errorf("应生成新trace id, got trace=%s parent=%s", tc.TraceID, tc.ParentID)
+		}
+		if tc.State != "" {
+			t.Errorf("无有效traceparent时不应透传tracestate")
+		}
+		if _, _, _, ok := parseTraceParent(tc.TraceParent()); !ok {
+			t.Errorf("TraceParent() = %s 无效", tc.TraceParent())
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// upstreamCheckEndpoint 测试请求使用的客户端端点，按OpenAI格式构建后由converter转换为上游格式
+const upstreamCheckEndpoint = "/v1/chat/completions"
+
+// defaultUpstreamCheckModels 未指定模型时各提供商测试请求使用的模型
+var defaultUpstreamCheckModels = map[types.Provider]string{
+	types.ProviderAnthropic: "claude-3-5-haiku-latest",
+	types.ProviderOpenAI:    "gpt-4o-mini",
+	types.ProviderAzure:     "gpt-4o-mini",
+	types.ProviderGoogle:    "gemini-1.5-flash",
+	types.ProviderQwen:      "qwen-turbo",
+}
+
+// UpstreamCheckResult 单次上游测试请求的结果
+type UpstreamCheckResult struct {
+	UpstreamID string
+	Model      string
+	StatusCode int // 上游HTTP状态码，请求未到达上游时为0
+	Latency    time.Duration
+	Response   []byte // 上游原始响应体，失败时为上游错误体
+	Err        error  // 请求失败的原因，成功时为nil
+}
+
+// CheckUpstream 绕过路由，向指定上游账号发送一条最小的对话请求。请求与代理请求走相同的
+// 转换和构建路径（含OAuth token自动刷新），用于调试新添加的账号；model为空时使用提供商的默认模型
+func (s *HTTPServer) CheckUpstream(upstreamID, model string, timeout time.Duration) (*UpstreamCheckResult, error) {
+	return s.proxyHandler.checkUpstream(upstreamID, model, timeout)
+}
+
+// checkUpstream 向指定账号发送测试请求，账号不存在或无法构建请求时返回error，上游调用失败记录在结果中
+func (h *ProxyHandler) checkUpstream(upstreamID, model string, timeout time.Duration) (*UpstreamCheckResult, error) {
+	account, err := h.upstreamMgr.GetAccount(upstreamID)
+	if err != nil {
+		return nil, err
+	}
+	if model == "" {
+		model = defaultUpstreamCheckModels[account.Provider]
+	}
+	if model == "" {
+		return nil, fmt.Errorf("提供商 %s 没有默认测试模型，请指定模型", account.Provider)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":      model,
+		"max_tokens": 16,
+		"messages":   []map[string]string{{"role": "user", "content": "ping"}},
+	})
+	request, _, err := h.converter.ParseRequest(body, upstreamCheckEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("构建测试请求失败: %w", err)
+	}
+	request.UpstreamID = account.ID
+	request.UpstreamTimeout = timeout
+	ctx, cancel := h.upstreamContext(context.Background(), timeout, false)
+	defer cancel()
+	request.Context = ctx
+
+	upstreamPath, err := h.converter.GetUpstreamPath(account.Provider, upstreamCheckEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UpstreamCheckResult{UpstreamID: account.ID, Model: model}
+	start := time.Now()
+	result.Response, result.Err = h.callUpstreamAPIRaw(account, request, upstreamPath, nil)
+	result.Latency = time.Since(start)
+
+	var upstreamErr *UpstreamError
+	switch {
+	case result.Err == nil:
+		result.StatusCode = 200
+	case errors.As(result.Err, &upstreamErr):
+		result.StatusCode = upstreamErr.StatusCode
+		result.Response = upstreamErr.Body
+	}
+	return result, nil
+}
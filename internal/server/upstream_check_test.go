@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/config"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestHTTPServer_CheckUpstream(t *testing.T) {
+	var upstreamPath, upstreamModel, upstreamAuth string
+	fail := false
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		upstreamPath, upstreamModel, upstreamAuth = r.URL.Path, body.Model, r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		if fail {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"type":"invalid_api_key","message":"Incorrect API key"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"` + body.Model + `","choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, _ := newTestGateway(t, upstreamServer.URL, types.MetricsConfig{})
+
+	tests := []struct {
+		name       string
+		model      string
+		fail       bool
+		wantModel  string
+		wantStatus int
+		wantErr    bool
+	}{
+		{"默认模型", "", false, "gpt-4o-mini", http.StatusOK, false},
+		{"指定模型", "gpt-4o", false, "gpt-4o", http.StatusOK, false},
+		{"上游返回错误", "", true, "gpt-4o-mini", http.StatusUnauthorized, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fail = tt.fail
+			result, err := s.CheckUpstream("up-openai", tt.model, time.Second)
+			if err != nil {
+				t.Fatalf("CheckUpstream() error = %v", err)
+			}
+			if upstreamPath != "/v1/chat/completions" || upstreamModel != tt.wantModel || upstreamAuth != "Bearer sk-test" {
+				t.Errorf("上游收到 %s model=%s auth=%s", upstreamPath, upstreamModel, upstreamAuth)
+			}
+			if result.Model != tt.wantModel || result.StatusCode != tt.wantStatus {
+				t.Errorf("result = model %s status %d, want %s %d", result.Model, result.StatusCode, tt.wantModel, tt.wantStatus)
+			}
+			if (result.Err != nil) != tt.wantErr {
+				t.Errorf("result.Err = %v, wantErr %v", result.Err, tt.wantErr)
+			}
+			if len(result.Response) == 0 {
+				t.Error("结果中应包含上游响应体")
+			}
+		})
+	}
+
+	if _, err := s.CheckUpstream("unknown", "", time.Second); err == nil {
+		t.Error("不存在的账号应返回错误")
+	}
+}
+
+func TestHTTPServer_CheckUpstreamCustomBaseURL(t *testing.T) {
+	var upstreamPath string
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o-mini","choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstreamServer.Close()
+
+	s, _ := newTestGateway(t, "https://api.openai.invalid", types.MetricsConfig{})
+	h := NewWebHandler(s.configMgr.(*config.ConfigManager), s.upstreamMgr, nil, nil)
+
+	// 通过Web接口创建的账号，自定义Base URL（含路径前缀和末尾的/）用于实际的上游调用
+	rec := postJSON(h.handleCreateUpstream, `{"name":"custom","provider":"openai","type":"api-key","api_key":"sk-test","base_url":"`+upstreamServer.URL+`/openai/"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("创建账号失败, status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var created map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+
+	result, err := s.CheckUpstream(created["id"], "", time.Second)
+	if err != nil {
+		t.Fatalf("CheckUpstream() error = %v", err)
+	}
+	if result.Err != nil {
+		t.Fatalf("上游调用失败: %v", result.Err)
+	}
+	if upstreamPath != "/openai/v1/chat/completions" {
+		t.Errorf("上游请求路径 = %q, 应使用自定义Base URL", upstreamPath)
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/iBreaker/llm-gateway/internal/converter"
+)
+
+// maxUpstreamErrorBody 读取上游错误响应体的上限，错误体通常很小
+const maxUpstreamErrorBody = 64 << 10
+
+// upstreamErrorKind 归一化后的上游错误类别，与转换器构建客户端错误时使用的类别一致
+type upstreamErrorKind = converter.ErrorCategory
+
+const (
+	upstreamErrorInvalidRequest = converter.ErrorInvalidRequest
+	upstreamErrorAuthentication = converter.ErrorAuthentication
+	upstreamErrorPermission     = converter.ErrorPermission
+	upstreamErrorNotFound       = converter.ErrorNotFound
+	upstreamErrorRateLimit      = converter.ErrorRateLimit
+	upstreamErrorQuota          = converter.ErrorQuota
+	upstreamErrorOverloaded     = converter.ErrorOverloaded
+	upstreamErrorServer         = converter.ErrorServer
+)
+
+// upstreamErrorUnknown 错误体与状态码均无法归类，按状态码决定是否重试
+const upstreamErrorUnknown upstreamErrorKind = "unknown"
+
+// upstreamErrorAction 针对上游错误的重试决策
+type upstreamErrorAction int
+
+const (
+	// upstreamErrorFatal 客户端请求本身有误，不重试，直接返回给客户端
+	upstreamErrorFatal upstreamErrorAction = iota
+	// upstreamErrorRetry 临时性错误，退避后在同一账号上重试
+	upstreamErrorRetry
+	// upstreamErrorFailover 当前账号不可用（过载、额度耗尽、凭证失效），换其他账号重试
+	upstreamErrorFailover
+)
+
+// UpstreamError 上游返回的非2xx响应，统一解析Anthropic/OpenAI/Gemini的错误体
+type UpstreamError struct {
+	StatusCode int
+	Kind       upstreamErrorKind
+	Type       string // 上游原始错误类型（如 overloaded_error、insufficient_quota、RESOURCE_EXHAUSTED）
+	Message    string
+	Body       []byte
+}
+
+// Error 实现error接口
+func (e *UpstreamError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("upstream API error: status=%d, body=%s", e.StatusCode, string(e.Body))
+	}
+	return fmt.Sprintf("upstream API error: status=%d, type=%s, message=%s", e.StatusCode, e.Type, e.Message)
+}
+
+// Action 根据错误类别决定重试方式，无法识别错误体时按状态码判断
+func (e *UpstreamError) Action() upstreamErrorAction {
+	switch e.Kind {
+	case upstreamErrorInvalidRequest, upstreamErrorNotFound:
+		return upstreamErrorFatal
+	case upstreamErrorOverloaded, upstreamErrorQuota, upstreamErrorAuthentication, upstreamErrorPermission:
+		return upstreamErrorFailover
+	case upstreamErrorRateLimit, upstreamErrorServer:
+		return upstreamErrorRetry
+	}
+	if isRetryableStatus(e.StatusCode) {
+		return upstreamErrorRetry
+	}
+	return upstreamErrorFatal
+}
+
+// isFailoverError 判断上游调用失败后是否值得换用其他账号重试：账号不可用（过载、额度耗尽、凭证失效）、
+// 5xx服务端错误、超时或连接错误。请求本身的错误（4xx、内容无法转换、响应过大）换账号也无法恢复
+func isFailoverError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		if upstreamErr.Action() == upstreamErrorFailover {
+			return true
+		}
+		// 5xx中明确为请求错误的（如500携带invalid_request_error）不切换
+		return upstreamErr.StatusCode >= http.StatusInternalServerError &&
+			upstreamErr.Kind != upstreamErrorInvalidRequest && upstreamErr.Kind != upstreamErrorNotFound
+	}
+
+	var contentErr *converter.UnsupportedContentError
+	if errors.As(err, &contentErr) || errors.Is(err, errResponseTooLarge) {
+		return false
+	}
+	return true
+}
+
+// statusOverloaded Anthropic过载时使用的非标准状态码
+const statusOverloaded = 529
+
+// parseUpstreamError 解析上游错误响应体，错误体无法识别时按状态码推断类别
+func parseUpstreamError(statusCode int, body []byte) *UpstreamError {
+	detail := converter.ParseErrorBody(body)
+	upstreamErr := &UpstreamError{
+		StatusCode: statusCode,
+		Kind:       detail.Category,
+		Type:       detail.Code,
+		Message:    detail.Message,
+		Body:       body,
+	}
+	if upstreamErr.Type == "" {
+		upstreamErr.Type = detail.Type
+	}
+	if upstreamErr.Kind == "" {
+		upstreamErr.Kind = classifyUpstreamStatus(statusCode)
+	}
+	return upstreamErr
+}
+
+// classifyUpstreamStatus 错误体无法识别时按HTTP状态码推断类别
+func classifyUpstreamStatus(statusCode int) upstreamErrorKind {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return upstreamErrorInvalidRequest
+	case http.StatusUnauthorized:
+		return upstreamErrorAuthentication
+	case http.StatusForbidden:
+		return upstreamErrorPermission
+	case http.StatusNotFound:
+		return upstreamErrorNotFound
+	case http.StatusTooManyRequests:
+		return upstreamErrorRateLimit
+	case statusOverloaded:
+		return upstreamErrorOverloaded
+	}
+	return upstreamErrorUnknown
+}
+
+// readUpstreamError 读取非2xx响应的错误体并解析，读取后恢复resp.Body以便调用方继续使用
+func readUpstreamError(resp *http.Response) *UpstreamError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamErrorBody))
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return parseUpstreamError(resp.StatusCode, body)
+}
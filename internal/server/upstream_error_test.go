@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/converter"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func TestParseUpstreamError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		wantKind   upstreamErrorKind
+		wantType   string
+		wantAction upstreamErrorAction
+	}{
+		{
+			name:       "Anthropic过载",
+			statusCode: statusOverloaded,
+			body:       `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			wantKind:   upstreamErrorOverloaded,
+			wantType:   "overloaded_error",
+			wantAction: upstreamErrorFailover,
+		},
+		{
+			name:       "Anthropic请求无效",
+			statusCode: http.StatusBadRequest,
+			body:       `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: field required"}}`,
+			wantKind:   upstreamErrorInvalidRequest,
+			wantType:   "invalid_request_error",
+			wantAction: upstreamErrorFatal,
+		},
+		{
+			name:       "OpenAI额度耗尽优先看code",
+			statusCode: http.StatusTooManyRequests,
+			body:       `{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`,
+			wantKind:   upstreamErrorQuota,
+			wantType:   "insufficient_quota",
+			wantAction: upstreamErrorFailover,
+		},
+		{
+			name:       "OpenAI限流",
+			statusCode: http.StatusTooManyRequests,
+			body:       `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`,
+			wantKind:   upstreamErrorRateLimit,
+			wantType:   "rate_limit_exceeded",
+			wantAction: upstreamErrorRetry,
+		},
+		{
+			name:       "OpenAI数字code",
+			statusCode: http.StatusInternalServerError,
+			body:       `{"error":{"message":"boom","type":"server_error","code":500}}`,
+			wantKind:   upstreamErrorServer,
+			wantType:   "server_error",
+			wantAction: upstreamErrorRetry,
+		},
+		{
+			name:       "Gemini参数无效",
+			statusCode: http.StatusBadRequest,
+			body:       `{"error":{"code":400,"message":"Invalid value","status":"INVALID_ARGUMENT"}}`,
+			wantKind:   upstreamErrorInvalidRequest,
+			wantType:   "INVALID_ARGUMENT",
+			wantAction: upstreamErrorFatal,
+		},
+		{
+			name:       "无法解析按状态码判断",
+			statusCode: http.StatusBadGateway,
+			body:       `<html>bad gateway</html>`,
+			wantKind:   upstreamErrorUnknown,
+			wantAction: upstreamErrorRetry,
+		},
+		{
+			name:       "无法解析的401",
+			statusCode: http.StatusUnauthorized,
+			body:       ``,
+			wantKind:   upstreamErrorAuthentication,
+			wantAction: upstreamErrorFailover,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseUpstreamError(tt.statusCode, []byte(tt.body))
+			if got.Kind != tt.wantKind || got.Type != tt.wantType {
+				t.Errorf("kind/type = %s/%s, want %s/%s", got.Kind, got.Type, tt.wantKind, tt.wantType)
+			}
+			if action := got.Action(); action != tt.wantAction {
+				t.Errorf("Action() = %d, want %d", action, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_DoSkipsNonRetryableErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+	}{
+		{"500但请求无效", http.StatusInternalServerError, `{"error":{"message":"bad","type":"invalid_request_error"}}`},
+		{"过载换账号", statusOverloaded, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			policy := newRetryPolicy(&types.ProxyConfig{MaxRetries: 3})
+			policy.sleep = func(context.Context, time.Duration) error {
+				t.Error("不应在同一账号上重试")
+				return nil
+			}
+
+			resp, err := policy.do(server.Client(), func() (*http.Request, error) {
+				return http.NewRequest("POST", server.URL, nil)
+			})
+			if err != nil {
+				t.Fatalf("do() error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			if calls != 1 {
+				t.Errorf("calls = %d, want 1", calls)
+			}
+			// 解析错误体后响应体仍可被调用方读取
+			if upstreamErr := readUpstreamError(resp); string(upstreamErr.Body) != tt.body {
+				t.Errorf("body = %q, want %q", upstreamErr.Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestIsFailoverError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"500", &UpstreamError{StatusCode: http.StatusInternalServerError, Kind: upstreamErrorServer}, true},
+		{"500但请求无效", &UpstreamError{StatusCode: http.StatusInternalServerError, Kind: upstreamErrorInvalidRequest}, false},
+		{"过载", &UpstreamError{StatusCode: statusOverloaded, Kind: upstreamErrorOverloaded}, true},
+		{"400", &UpstreamError{StatusCode: http.StatusBadRequest, Kind: upstreamErrorInvalidRequest}, false},
+		{"连接错误", fmt.Errorf("upstream request failed: %w", errors.New("connection refused")), true},
+		{"内容无法转换", &converter.UnsupportedContentError{Format: converter.FormatGemini, Reason: "pdf"}, false},
+		{"响应过大", fmt.Errorf("read: %w", errResponseTooLarge), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFailoverError(tt.err); got != tt.want {
+				t.Errorf("isFailoverError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
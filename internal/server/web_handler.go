@@ -1,9 +1,8 @@
 package server
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
@@ -23,14 +22,7 @@ type WebHandler struct {
 	upstreamMgr *upstream.UpstreamManager
 	keyMgr      *client.GatewayKeyManager
 	oauthMgr    *upstream.OAuthManager
-	sessions    map[string]*Session // 简单的内存session存储
-}
-
-// Session 会话信息
-type Session struct {
-	Token     string
-	ExpiresAt time.Time
-	CreatedAt time.Time
+	sessions    *SessionStore
 }
 
 // NewWebHandler 创建 Web 处理器
@@ -40,8 +32,22 @@ func NewWebHandler(configMgr *config.ConfigManager, upstreamMgr *upstream.Upstre
 		upstreamMgr: upstreamMgr,
 		keyMgr:      keyMgr,
 		oauthMgr:    oauthMgr,
-		sessions:    make(map[string]*Session),
+		sessions:    newWebSessionStore(configMgr),
+	}
+}
+
+// newWebSessionStore 根据Web配置创建会话存储，开启持久化时会话文件保存在配置文件同目录下
+func newWebSessionStore(configMgr *config.ConfigManager) *SessionStore {
+	var webConfig types.WebConfig
+	if cfg := configMgr.Get(); cfg != nil {
+		webConfig = cfg.Server.Web
+	}
+
+	path := ""
+	if webConfig.PersistSessions {
+		path = filepath.Join(filepath.Dir(configMgr.GetConfigPath()), "web_sessions.json")
 	}
+	return NewSessionStore(path, time.Duration(webConfig.SessionTTL)*time.Second)
 }
 
 // ServeStatic 处理静态文件请求
@@ -204,14 +210,34 @@ func (h *WebHandler) handleListUpstream(w http.ResponseWriter, r *http.Request)
 		typeCounts[string(account.Type)]++
 		
 		safeAccounts[i] = map[string]interface{}{
-			"id":            account.ID,
-			"name":          account.Name,
-			"provider":      account.Provider,
-			"type":          account.Type,
-			"status":        account.Status,
-			"health_status": account.HealthStatus,
-			"created_at":    account.CreatedAt,
-			"usage":         account.Usage, // 包含使用统计
+			"id":                 account.ID,
+			"name":               account.Name,
+			"provider":           account.Provider,
+			"type":               account.Type,
+			"status":             account.Status,
+			"health_status":      account.HealthStatus,
+			"description":        account.Description,
+			"api_key":            types.MaskKey(account.APIKey),
+			"api_key_expires_at": account.APIKeyExpiresAt,
+			"api_key_pool_size":  len(account.APIKeyPool()),
+			"created_by":         account.CreatedBy,
+			"tags":               account.Tags,
+			"weight":             account.Weight,
+			"health_probe":       account.HealthProbe,
+			"tenant":             account.TenantID(),
+			"capabilities":       account.Capabilities,
+			"created_at":         account.CreatedAt,
+			"usage":              account.Usage, // 包含使用统计
+		}
+
+		// OAuth账号附带授权状态，便于界面提示重新授权
+		if account.Type == types.UpstreamTypeOAuth {
+			if detail, err := h.upstreamMgr.GetOAuthStatusDetail(account.ID); err == nil {
+				safeAccounts[i]["oauth_status"] = detail.Status
+				safeAccounts[i]["oauth_reason"] = detail.Reason
+				safeAccounts[i]["needs_reauth"] = detail.NeedsReauth
+			}
+			safeAccounts[i]["access_token"] = types.MaskKey(account.AccessToken)
 		}
 	}
 	
@@ -225,11 +251,19 @@ func (h *WebHandler) handleListUpstream(w http.ResponseWriter, r *http.Request)
 
 func (h *WebHandler) handleCreateUpstream(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name     string `json:"name"`
-		Provider string `json:"provider"`
-		Type     string `json:"type"`
-		APIKey   string `json:"api_key,omitempty"`
-		BaseURL  string `json:"base_url,omitempty"`
+		Name            string     `json:"name"`
+		Provider        string     `json:"provider"`
+		Type            string     `json:"type"`
+		APIKey          string     `json:"api_key,omitempty"`
+		APIKeys         []string   `json:"api_keys,omitempty"`
+		APIKeyExpiresAt *time.Time `json:"api_key_expires_at,omitempty"`
+		BaseURL         string     `json:"base_url,omitempty"`
+		Description     string     `json:"description,omitempty"`
+		CreatedBy       string            `json:"created_by,omitempty"`
+		Tags            map[string]string `json:"tags,omitempty"`
+		Weight          int               `json:"weight,omitempty"`
+		HealthProbe     *types.HealthProbe `json:"health_probe,omitempty"`
+		Tenant          string             `json:"tenant,omitempty"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -242,6 +276,26 @@ func (h *WebHandler) handleCreateUpstream(w http.ResponseWriter, r *http.Request
 		h.writeError(w, http.StatusBadRequest, "Missing required fields")
 		return
 	}
+	if req.Weight < 0 {
+		h.writeError(w, http.StatusBadRequest, "Weight must not be negative")
+		return
+	}
+	if req.HealthProbe != nil {
+		if err := req.HealthProbe.Validate(); err != nil {
+			h.writeError(w, http.StatusBadRequest, "Invalid health probe: "+err.Error())
+			return
+		}
+	}
+	if err := types.ValidateTenant(req.Tenant); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.BaseURL != "" {
+		if _, err := types.NormalizeBaseURL(req.BaseURL); err != nil {
+			h.writeError(w, http.StatusBadRequest, "Invalid base URL: "+err.Error())
+			return
+		}
+	}
 	
 	// 创建上游账号
 	account := &types.UpstreamAccount{
@@ -251,20 +305,29 @@ func (h *WebHandler) handleCreateUpstream(w http.ResponseWriter, r *http.Request
 		Type:          types.UpstreamType(req.Type),
 		Status:        "active",
 		HealthStatus:  "unknown",
+		Description:   req.Description,
+		CreatedBy:     req.CreatedBy,
+		Tags:          req.Tags,
+		Weight:        req.Weight,
+		HealthProbe:   req.HealthProbe,
+		Tenant:        req.Tenant,
 		CreatedAt:     time.Now(),
 	}
-	
-	// Set base URL if provided
-	if req.BaseURL != "" {
-		account.ResourceURL = req.BaseURL
+	if account.CreatedBy == "" {
+		account.CreatedBy = "web"
 	}
 	
+	// 自定义Base URL覆盖提供商默认地址；ResourceURL仅用于Qwen OAuth返回的区域端点
+	account.BaseURL = req.BaseURL
+	
 	if req.Type == "api-key" {
 		if req.APIKey == "" {
 			h.writeError(w, http.StatusBadRequest, "API key is required for api-key type")
 			return
 		}
 		account.APIKey = req.APIKey
+		account.APIKeys = req.APIKeys
+		account.APIKeyExpiresAt = req.APIKeyExpiresAt
 	} else if req.Type == "oauth" {
 		// Validate OAuth provider support
 		if req.Provider != "anthropic" && req.Provider != "qwen" {
@@ -278,6 +341,10 @@ func (h *WebHandler) handleCreateUpstream(w http.ResponseWriter, r *http.Request
 	// 通过UpstreamManager添加账号（包含业务逻辑初始化）
 	if err := h.upstreamMgr.AddAccount(account); err != nil {
 		logger.Error("Failed to create upstream account: %v", err)
+		if errors.Is(err, config.ErrQuotaExceeded) {
+			h.writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
 		h.writeError(w, http.StatusInternalServerError, "Failed to create upstream account")
 		return
 	}
@@ -286,6 +353,99 @@ func (h *WebHandler) handleCreateUpstream(w http.ResponseWriter, r *http.Request
 	h.writeJSON(w, http.StatusCreated, map[string]string{"id": account.ID})
 }
 
+// API Batch Upstream Operations
+// 按标签批量启用/禁用/健康检查上游账号
+func (h *WebHandler) HandleAPIUpstreamBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Tags   map[string]string `json:"tags"`
+		Action string            `json:"action"` // enable, disable, health
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Tags) == 0 {
+		h.writeError(w, http.StatusBadRequest, "At least one tag is required")
+		return
+	}
+
+	var results []upstream.BatchResult
+	var err error
+	switch req.Action {
+	case "enable":
+		results, err = h.upstreamMgr.BatchUpdateStatus(req.Tags, "active")
+	case "disable":
+		results, err = h.upstreamMgr.BatchUpdateStatus(req.Tags, "disabled")
+	case "health":
+		results, err = h.upstreamMgr.BatchCheckHealth(req.Tags, upstream.DefaultProbeTimeout)
+	default:
+		h.writeError(w, http.StatusBadRequest, "Invalid action, must be one of: enable, disable, health")
+		return
+	}
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	failed := 0
+	items := make([]map[string]interface{}, len(results))
+	for i, result := range results {
+		items[i] = map[string]interface{}{
+			"id":      result.UpstreamID,
+			"name":    result.Name,
+			"success": result.Err == nil,
+		}
+		if result.Err != nil {
+			failed++
+			items[i]["error"] = result.Err.Error()
+		}
+	}
+
+	logger.Info("Batch %s upstream accounts by tags %s: %d total, %d failed", req.Action, types.FormatTags(req.Tags), len(results), failed)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"action":  req.Action,
+		"results": items,
+		"total":   len(results),
+		"failed":  failed,
+	})
+}
+
+// API Discover Upstream Capabilities
+func (h *WebHandler) HandleAPIUpstreamDiscover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		ID    string `json:"id"`
+		Model string `json:"model,omitempty"` // 探测使用的模型，默认取模型列表中的第一个
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.ID == "" {
+		h.writeError(w, http.StatusBadRequest, "Upstream ID is required")
+		return
+	}
+
+	capabilities, err := h.upstreamMgr.DiscoverCapabilities(req.ID, req.Model, upstream.DefaultProbeTimeout)
+	if err != nil {
+		logger.Error("Failed to discover capabilities for upstream %s: %v", req.ID, err)
+		h.writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	logger.Info("Discovered capabilities for upstream %s: %d models, endpoints %v", req.ID, len(capabilities.Models), capabilities.Endpoints)
+	h.writeJSON(w, http.StatusOK, capabilities)
+}
+
 // API Delete Upstream Account
 func (h *WebHandler) HandleAPIUpstreamDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
@@ -340,7 +500,7 @@ func (h *WebHandler) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 	safeKeys := make([]map[string]interface{}, len(keys))
 	for i, key := range keys {
 		// 统计计算
-		if key.Status == "active" {
+		if key.IsActive(time.Now()) {
 			stats["active"] = stats["active"].(int) + 1
 		}
 		
@@ -363,6 +523,7 @@ func (h *WebHandler) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
 			"id":            key.ID,
 			"name":          key.Name,
 			"permissions":   key.Permissions,
+			"tenant":        key.TenantID(),
 			"status":        key.Status,
 			"created_at":    key.CreatedAt,
 			"usage":         key.Usage,
@@ -381,6 +542,7 @@ func (h *WebHandler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request)
 	var req struct {
 		Name        string   `json:"name"`
 		Permissions []string `json:"permissions"`
+		Tenant      string   `json:"tenant,omitempty"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -397,6 +559,10 @@ func (h *WebHandler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request)
 	if len(req.Permissions) == 0 {
 		req.Permissions = []string{"read", "write"}
 	}
+	if err := types.ValidateTenant(req.Tenant); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	
 	// 将字符串权限转换为types.Permission类型
 	perms := make([]types.Permission, len(req.Permissions))
@@ -408,9 +574,19 @@ func (h *WebHandler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request)
 	key, plainKey, err := h.keyMgr.CreateKey(req.Name, perms)
 	if err != nil {
 		logger.Error("Failed to generate API key: %v", err)
+		if errors.Is(err, config.ErrQuotaExceeded) {
+			h.writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
 		h.writeError(w, http.StatusInternalServerError, "Failed to generate API key")
 		return
 	}
+	if req.Tenant != "" {
+		if err := h.keyMgr.UpdateKeyTenant(key.ID, req.Tenant); err != nil {
+			h.writeError(w, http.StatusInternalServerError, "Failed to set API key tenant")
+			return
+		}
+	}
 	
 	logger.Info("Generated new API key: %s (%s)", key.Name, key.ID)
 	h.writeJSON(w, http.StatusCreated, map[string]string{
@@ -437,6 +613,11 @@ func (h *WebHandler) HandleAPIKeyActions(w http.ResponseWriter, r *http.Request)
 	} else if len(pathParts) == 5 && pathParts[4] == "model-routes" {
 		// /api/v1/apikeys/{id}/model-routes - Model Routes operations
 		h.handleAPIKeyModelRoutes(w, r, keyID)
+	} else if len(pathParts) == 5 && pathParts[4] == "reset-usage" {
+		// /api/v1/apikeys/{id}/reset-usage - Reset usage stats (admin only)
+		h.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			h.handleAPIKeyResetUsage(w, r, keyID)
+		})(w, r)
 	} else {
 		h.writeError(w, http.StatusNotFound, "API endpoint not found")
 	}
@@ -458,6 +639,32 @@ func (h *WebHandler) handleAPIKeyDelete(w http.ResponseWriter, r *http.Request,
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleAPIKeyResetUsage 清零Key的使用统计，Key本身保留，返回清零后的统计
+func (h *WebHandler) handleAPIKeyResetUsage(w http.ResponseWriter, r *http.Request, keyID string) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if _, err := h.keyMgr.GetKey(keyID); err != nil {
+		h.writeError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	usage, err := h.keyMgr.ResetKeyUsage(keyID)
+	if err != nil {
+		logger.Error("Failed to reset usage for API key %s: %v", keyID, err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to reset API key usage")
+		return
+	}
+
+	logger.Info("Reset usage for API key: %s", keyID)
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"key_id": keyID,
+		"usage":  usage,
+	})
+}
+
 func (h *WebHandler) handleAPIKeyModelRoutes(w http.ResponseWriter, r *http.Request, keyID string) {
 	switch r.Method {
 	case http.MethodGet:
@@ -489,7 +696,10 @@ func (h *WebHandler) getAPIKeyModelRoutes(w http.ResponseWriter, r *http.Request
 	if gatewayKey.ModelRoutes != nil {
 		response["routes"] = gatewayKey.ModelRoutes.Routes
 		response["default_behavior"] = gatewayKey.ModelRoutes.DefaultBehavior
+		response["default_route"] = gatewayKey.ModelRoutes.DefaultRoute
 		response["enable_logging"] = gatewayKey.ModelRoutes.EnableLogging
+		response["allowed_models"] = gatewayKey.ModelRoutes.AllowedModels
+		response["denied_models"] = gatewayKey.ModelRoutes.DeniedModels
 	}
 	
 	h.writeJSON(w, http.StatusOK, response)
@@ -500,7 +710,11 @@ func (h *WebHandler) updateAPIKeyModelRoutes(w http.ResponseWriter, r *http.Requ
 	var req struct {
 		Routes          []types.ModelRoute `json:"routes"`
 		DefaultBehavior string            `json:"default_behavior"`
+		DefaultRoute    *types.DefaultRouteTarget `json:"default_route"`
 		EnableLogging   bool              `json:"enable_logging"`
+		ModelAliases    map[string]string `json:"model_aliases"`
+		AllowedModels   []string          `json:"allowed_models"`
+		DeniedModels    []string          `json:"denied_models"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -512,7 +726,11 @@ func (h *WebHandler) updateAPIKeyModelRoutes(w http.ResponseWriter, r *http.Requ
 	modelRoutes := &types.ModelRouteConfig{
 		Routes:          req.Routes,
 		DefaultBehavior: req.DefaultBehavior,
+		DefaultRoute:    req.DefaultRoute,
 		EnableLogging:   req.EnableLogging,
+		ModelAliases:    req.ModelAliases,
+		AllowedModels:   req.AllowedModels,
+		DeniedModels:    req.DeniedModels,
 	}
 	
 	// 验证配置
@@ -586,22 +804,28 @@ func (h *WebHandler) HandleOAuthStart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 根据提供商类型启动不同的OAuth流程
+	h.startOAuthFlow(w, account, nil)
+}
+
+// startOAuthFlow 根据提供商类型启动不同的OAuth流程，extra中的字段会合并到响应中
+func (h *WebHandler) startOAuthFlow(w http.ResponseWriter, account *types.UpstreamAccount, extra map[string]interface{}) {
+	var response map[string]interface{}
+
 	switch account.Provider {
 	case "anthropic":
-		authURL, err := h.oauthMgr.StartOAuthFlow(req.UpstreamID)
+		authURL, err := h.oauthMgr.StartOAuthFlow(account.ID)
 		if err != nil {
 			logger.Error("Failed to start Anthropic OAuth: %v", err)
 			h.writeError(w, http.StatusInternalServerError, "Failed to start OAuth flow")
 			return
 		}
-		h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		response = map[string]interface{}{
 			"flow_type": "authorization_code",
 			"auth_url":  authURL,
 			"message":   "Please visit the URL and authorize the application, then return the authorization code.",
-		})
+		}
 	case "qwen":
-		result, err := h.upstreamMgr.StartQwenOAuth(req.UpstreamID)
+		result, err := h.upstreamMgr.StartQwenOAuth(account.ID)
 		if err != nil {
 			logger.Error("Failed to start Qwen OAuth: %v", err)
 			h.writeError(w, http.StatusInternalServerError, "Failed to start OAuth flow")
@@ -609,20 +833,75 @@ func (h *WebHandler) HandleOAuthStart(w http.ResponseWriter, r *http.Request) {
 		}
 		// 构造完整的授权链接，包含user_code参数
 		fullVerificationURI := fmt.Sprintf("https://chat.qwen.ai/authorize?user_code=%s&client=llm-gateway", result.UserCode)
-		
-		h.writeJSON(w, http.StatusOK, map[string]interface{}{
-			"flow_type":         "device_code",
-			"device_code":       result.DeviceCode,
-			"user_code":         result.UserCode,
-			"verification_uri":  fullVerificationURI,
-			"expires_in":        result.ExpiresIn,
-			"interval":          result.Interval,
-			"message":           fmt.Sprintf("Please visit %s to authorize", fullVerificationURI),
-		})
+
+		response = map[string]interface{}{
+			"flow_type":        "device_code",
+			"device_code":      result.DeviceCode,
+			"user_code":        result.UserCode,
+			"verification_uri": fullVerificationURI,
+			"expires_in":       result.ExpiresIn,
+			"interval":         result.Interval,
+			"message":          fmt.Sprintf("Please visit %s to authorize", fullVerificationURI),
+		}
 	default:
 		h.writeError(w, http.StatusBadRequest, "OAuth not supported for this provider")
 		return
 	}
+
+	for key, value := range extra {
+		response[key] = value
+	}
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// HandleOAuthReauthorize 为已存在的OAuth账号重新发起授权（token失效或被撤销时使用）
+func (h *WebHandler) HandleOAuthReauthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		UpstreamID string `json:"upstream_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if req.UpstreamID == "" {
+		h.writeError(w, http.StatusBadRequest, "upstream_id is required")
+		return
+	}
+
+	account, err := h.configMgr.GetUpstreamAccount(req.UpstreamID)
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, "Upstream account not found")
+		return
+	}
+
+	if account.Type != types.UpstreamTypeOAuth {
+		h.writeError(w, http.StatusBadRequest, "Upstream account is not an OAuth account")
+		return
+	}
+
+	// 记录重授权前的状态，便于界面展示失效原因
+	detail, err := h.upstreamMgr.GetOAuthStatusDetail(req.UpstreamID)
+	if err != nil {
+		logger.Error("Failed to get OAuth status: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to get OAuth status")
+		return
+	}
+
+	// 已有的设备码轮询作废，避免旧流程覆盖新授权
+	h.upstreamMgr.CancelQwenPoll(req.UpstreamID)
+
+	logger.Info("Re-authorizing OAuth upstream: %s (previous status: %s)", req.UpstreamID, detail.Status)
+	h.startOAuthFlow(w, account, map[string]interface{}{
+		"previous_status": detail.Status,
+		"previous_reason": detail.Reason,
+	})
 }
 
 // HandleOAuthCallback 处理OAuth回调
@@ -695,7 +974,7 @@ func (h *WebHandler) HandleOAuthStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 检查OAuth状态
-	status, err := h.upstreamMgr.GetOAuthStatus(upstreamID)
+	detail, err := h.upstreamMgr.GetOAuthStatusDetail(upstreamID)
 	if err != nil {
 		logger.Error("Failed to get OAuth status: %v", err)
 		h.writeError(w, http.StatusInternalServerError, "Failed to get OAuth status")
@@ -703,9 +982,46 @@ func (h *WebHandler) HandleOAuthStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"upstream_id": upstreamID,
-		"provider":    account.Provider,
-		"status":      status,
+		"upstream_id":       upstreamID,
+		"provider":          account.Provider,
+		"status":            detail.Status,
+		"reason":            detail.Reason,
+		"expires_at":        detail.ExpiresAt,
+		"has_refresh_token": detail.HasRefreshToken,
+		"needs_reauth":      detail.NeedsReauth,
+		"polling":           h.upstreamMgr.IsQwenPolling(upstreamID),
+	})
+}
+
+// HandleOAuthCancel 取消进行中的Qwen Device Flow授权轮询
+func (h *WebHandler) HandleOAuthCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		UpstreamID string `json:"upstream_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if req.UpstreamID == "" {
+		h.writeError(w, http.StatusBadRequest, "upstream_id is required")
+		return
+	}
+
+	if !h.upstreamMgr.CancelQwenPoll(req.UpstreamID) {
+		h.writeError(w, http.StatusNotFound, "No pending OAuth polling for this upstream")
+		return
+	}
+
+	logger.Info("Cancelled Qwen OAuth polling for upstream: %s", req.UpstreamID)
+	h.writeJSON(w, http.StatusOK, map[string]string{
+		"message": "OAuth polling cancelled",
 	})
 }
 
@@ -726,33 +1042,26 @@ func (h *WebHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 获取配置
-	config, err := h.configMgr.Load()
+	cfg, err := h.configMgr.Load()
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "Failed to load configuration")
 		return
 	}
 
 	// 验证密码
-	if req.Password != config.Server.Web.Password {
+	if !config.CheckPassword(cfg.Server.Web.Password, req.Password) {
 		h.writeError(w, http.StatusUnauthorized, "Invalid password")
 		return
 	}
 
-	// 生成会话token
-	token, err := h.generateSessionToken()
+	// 创建会话
+	// Web管理密码即管理员凭据，登录会话拥有admin权限
+	session, err := h.sessions.Create(types.PermissionAdmin)
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "Failed to generate session")
 		return
 	}
-
-	// 创建会话
-	session := &Session{
-		Token:     token,
-		ExpiresAt: time.Now().Add(24 * time.Hour), // 24小时过期
-		CreatedAt: time.Now(),
-	}
-
-	h.sessions[token] = session
+	token := session.Token
 
 	// 设置cookie
 	http.SetCookie(w, &http.Cookie{
@@ -782,7 +1091,7 @@ func (h *WebHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	token := h.getTokenFromRequest(r)
 	if token != "" {
 		// 删除会话
-		delete(h.sessions, token)
+		h.sessions.Delete(token)
 	}
 
 	// 清除cookie
@@ -823,21 +1132,26 @@ func (h *WebHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request
 	}
 
 	// 获取配置
-	config, err := h.configMgr.Load()
+	cfg, err := h.configMgr.Load()
 	if err != nil {
 		h.writeError(w, http.StatusInternalServerError, "Failed to load configuration")
 		return
 	}
 
 	// 验证旧密码
-	if req.OldPassword != config.Server.Web.Password {
+	if !config.CheckPassword(cfg.Server.Web.Password, req.OldPassword) {
 		h.writeError(w, http.StatusUnauthorized, "Invalid old password")
 		return
 	}
 
-	// 更新密码
-	config.Server.Web.Password = req.NewPassword
-	if err := h.configMgr.Save(config); err != nil {
+	// 更新密码，只保存哈希
+	hash, err := config.HashPassword(req.NewPassword)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid new password: "+err.Error())
+		return
+	}
+	cfg.Server.Web.Password = hash
+	if err := h.configMgr.Save(cfg); err != nil {
 		h.writeError(w, http.StatusInternalServerError, "Failed to save configuration")
 		return
 	}
@@ -849,15 +1163,6 @@ func (h *WebHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// generateSessionToken 生成会话token
-func (h *WebHandler) generateSessionToken() (string, error) {
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return base64.URLEncoding.EncodeToString(bytes), nil
-}
-
 // getTokenFromRequest 从请求中获取token
 func (h *WebHandler) getTokenFromRequest(r *http.Request) string {
 	// 先从cookie中获取
@@ -882,18 +1187,25 @@ func (h *WebHandler) isAuthenticated(r *http.Request) bool {
 		return false
 	}
 
-	session, exists := h.sessions[token]
-	if !exists {
-		return false
-	}
+	// 过期会话在查询时即被删除
+	_, exists := h.sessions.Get(token)
+	return exists
+}
 
-	// 检查是否过期
-	if time.Now().After(session.ExpiresAt) {
-		delete(h.sessions, token)
-		return false
+// requireAdmin 管理接口认证中间件：未登录返回401，会话没有admin权限返回403
+func (h *WebHandler) requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, exists := h.sessions.Get(h.getTokenFromRequest(r))
+		if !exists {
+			h.writeError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		if !session.HasPermission(types.PermissionAdmin) {
+			h.writeError(w, http.StatusForbidden, "Admin permission required")
+			return
+		}
+		handler(w, r)
 	}
-
-	return true
 }
 
 // requireAuth 认证中间件
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/internal/client"
+	"github.com/iBreaker/llm-gateway/internal/config"
+	"github.com/iBreaker/llm-gateway/internal/upstream"
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func newTestWebHandler(t *testing.T, password string) (*WebHandler, string) {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	legacy := "server:\n  host: 127.0.0.1\n  port: 3847\n  web:\n    enabled: true\n    password: " + password + "\n"
+	if err := os.WriteFile(configPath, []byte(legacy), 0600); err != nil {
+		t.Fatalf("写入配置失败: %v", err)
+	}
+
+	configMgr := config.NewConfigManager(configPath)
+	if _, err := configMgr.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return NewWebHandler(configMgr, nil, nil, nil), configPath
+}
+
+func postJSON(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return rec
+}
+
+func TestWebHandler_LoginAfterPasswordMigration(t *testing.T) {
+	h, _ := newTestWebHandler(t, "legacy-plain")
+
+	if rec := postJSON(h.HandleLogin, `{"password":"legacy-plain"}`); rec.Code != http.StatusOK {
+		t.Errorf("迁移后使用原密码登录应成功, status = %d", rec.Code)
+	}
+	if rec := postJSON(h.HandleLogin, `{"password":"wrong"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("错误密码应被拒绝, status = %d", rec.Code)
+	}
+	// 存储的哈希本身不能用来登录
+	stored := h.configMgr.Get().Server.Web.Password
+	if rec := postJSON(h.HandleLogin, `{"password":"`+stored+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("使用哈希值登录应被拒绝, status = %d", rec.Code)
+	}
+}
+
+func TestWebHandler_ChangePasswordStoresHash(t *testing.T) {
+	h, configPath := newTestWebHandler(t, "old-pass")
+
+	if rec := postJSON(h.HandleChangePassword, `{"old_password":"old-pass","new_password":"brand-new-pass"}`); rec.Code != http.StatusOK {
+		t.Fatalf("修改密码失败, status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	data, _ := os.ReadFile(configPath)
+	if strings.Contains(string(data), "brand-new-pass") || strings.Contains(string(data), "old-pass") {
+		t.Errorf("配置文件中不应出现明文密码:\n%s", data)
+	}
+	if rec := postJSON(h.HandleLogin, `{"password":"brand-new-pass"}`); rec.Code != http.StatusOK {
+		t.Errorf("使用新密码登录应成功, status = %d", rec.Code)
+	}
+	if rec := postJSON(h.HandleLogin, `{"password":"old-pass"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("旧密码应失效, status = %d", rec.Code)
+	}
+}
+
+func TestWebHandler_ResetAPIKeyUsage(t *testing.T) {
+	h, _ := newTestWebHandler(t, "admin-pass")
+	h.keyMgr = client.NewGatewayKeyManager(h.configMgr)
+
+	key, _, err := h.keyMgr.CreateKey("usage", []types.Permission{types.PermissionRead})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	for _, success := range []bool{true, true, false} {
+		if err := h.keyMgr.UpdateKeyUsage(key.ID, success, 120*time.Millisecond); err != nil {
+			t.Fatalf("UpdateKeyUsage() error = %v", err)
+		}
+	}
+
+	adminSession, _ := h.sessions.Create(types.PermissionAdmin)
+	readOnlySession, _ := h.sessions.Create(types.PermissionRead)
+	handler := h.requireAuth(h.HandleAPIKeyActions)
+	resetUsage := func(method, keyID, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/apikeys/"+keyID+"/reset-usage", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		keyID      string
+		token      string
+		wantStatus int
+	}{
+		{"未登录", http.MethodPost, key.ID, "", http.StatusUnauthorized},
+		{"非admin会话被拒绝", http.MethodPost, key.ID, readOnlySession.Token, http.StatusForbidden},
+		{"不支持GET", http.MethodGet, key.ID, adminSession.Token, http.StatusMethodNotAllowed},
+		{"Key不存在", http.MethodPost, "gw_missing", adminSession.Token, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := resetUsage(tt.method, tt.keyID, tt.token); rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	stored, _ := h.keyMgr.GetKey(key.ID)
+	if stored.Usage.TotalRequests != 3 {
+		t.Fatalf("被拒绝的请求不应清零统计, TotalRequests = %d", stored.Usage.TotalRequests)
+	}
+
+	rec := resetUsage(http.MethodPost, key.ID, adminSession.Token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		KeyID string              `json:"key_id"`
+		Usage types.KeyUsageStats `json:"usage"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.KeyID != key.ID || resp.Usage.TotalRequests != 0 || resp.Usage.SuccessfulRequests != 0 || resp.Usage.ErrorRequests != 0 || resp.Usage.AvgLatency != 0 {
+		t.Errorf("响应中的统计应已清零: %s", rec.Body.String())
+	}
+
+	stored, _ = h.keyMgr.GetKey(key.ID)
+	if stored.Usage.TotalRequests != 0 || stored.Usage.SuccessfulRequests != 0 || stored.Usage.ErrorRequests != 0 || stored.Usage.AvgLatency != 0 {
+		t.Errorf("Key的统计应已清零: %+v", stored.Usage)
+	}
+	if stored.Status != "active" {
+		t.Errorf("清零统计不应影响Key本身, Status = %s", stored.Status)
+	}
+}
+
+func TestWebHandler_CreateUpstreamBaseURL(t *testing.T) {
+	h, _ := newTestWebHandler(t, "admin-pass")
+	h.upstreamMgr = upstream.NewUpstreamManager(h.configMgr)
+
+	rec := postJSON(h.handleCreateUpstream, `{"name":"bad","provider":"openai","type":"api-key","api_key":"sk-test","base_url":"api.example.com"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("无效的base_url应被拒绝, status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if accounts := h.upstreamMgr.ListAccounts(); len(accounts) != 0 {
+		t.Fatalf("被拒绝的请求不应创建账号, got %d", len(accounts))
+	}
+
+	rec = postJSON(h.handleCreateUpstream, `{"name":"custom","provider":"openai","type":"api-key","api_key":"sk-test","base_url":"https://proxy.example.com/openai/"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("创建账号失败, status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var created map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	account, err := h.upstreamMgr.GetAccount(created["id"])
+	if err != nil {
+		t.Fatalf("GetAccount() error = %v", err)
+	}
+	if account.BaseURL != "https://proxy.example.com/openai" || account.ResourceURL != "" {
+		t.Errorf("base_url应保存到BaseURL, BaseURL = %q, ResourceURL = %q", account.BaseURL, account.ResourceURL)
+	}
+	if got := h.upstreamMgr.GetBaseURL(account); got != "https://proxy.example.com/openai" {
+		t.Errorf("GetBaseURL() = %q, 应使用自定义Base URL", got)
+	}
+}
@@ -0,0 +1,209 @@
+package upstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// probeOutcome 单项能力探测结论
+type probeOutcome int
+
+const (
+	probeUnknown     probeOutcome = iota // 网络错误或非预期状态码，无法判断
+	probeSupported                       // 2xx
+	probeUnsupported                     // 明确拒绝（404/405），或要求流式却返回了非流式响应
+)
+
+// DiscoverCapabilities 探测上游账号的模型列表、可用端点、流式与工具调用支持并记录到账号
+//
+// model 为空时使用模型列表中的第一个模型发送探测请求；探测请求限制 max_tokens=1，
+// 尽量减少对上游额度的消耗。单项探测失败不会中断其余探测。
+func (m *UpstreamManager) DiscoverCapabilities(upstreamID, model string, timeout time.Duration) (*types.UpstreamCapabilities, error) {
+	account, err := m.configMgr.GetUpstreamAccount(upstreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := m.GetAuthHeaders(upstreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	prober := &capabilityProber{
+		client:    &http.Client{Timeout: timeout},
+		baseURL:   m.GetBaseURL(account),
+		headers:   headers,
+		anthropic: account.Provider == types.ProviderAnthropic,
+	}
+
+	capabilities := &types.UpstreamCapabilities{DiscoveredAt: time.Now()}
+
+	models, outcome := prober.listModels()
+	if outcome == probeSupported {
+		capabilities.Models = models
+		capabilities.Endpoints = append(capabilities.Endpoints, "/v1/models")
+	}
+
+	if model == "" && len(models) > 0 {
+		model = models[0]
+	}
+	if model != "" {
+		capabilities.ProbeModel = model
+		chatPath := prober.chatPath()
+
+		if prober.probeChat(model, false, false) == probeSupported {
+			capabilities.Endpoints = append(capabilities.Endpoints, chatPath)
+		}
+		capabilities.Streaming = outcomeToBool(prober.probeChat(model, true, false))
+		capabilities.Tools = outcomeToBool(prober.probeChat(model, false, true))
+	}
+
+	if err := m.configMgr.UpdateUpstreamAccount(upstreamID, func(account *types.UpstreamAccount) error {
+		account.Capabilities = capabilities
+		account.UpdatedAt = time.Now()
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("保存能力信息失败: %w", err)
+	}
+	return capabilities, nil
+}
+
+// capabilityProber 能力探测请求发送器
+type capabilityProber struct {
+	client    *http.Client
+	baseURL   string
+	headers   map[string]string
+	anthropic bool
+}
+
+// chatPath 对话端点，Anthropic使用 /v1/messages，其余按OpenAI兼容处理
+func (p *capabilityProber) chatPath() string {
+	if p.anthropic {
+		return "/v1/messages"
+	}
+	return "/v1/chat/completions"
+}
+
+// listModels 请求模型列表端点，解析 {"data":[{"id":...}]} 格式
+func (p *capabilityProber) listModels() ([]string, probeOutcome) {
+	resp, err := p.do(http.MethodGet, modelsURL(p.baseURL), nil)
+	if err != nil {
+		return nil, probeUnknown
+	}
+	defer resp.Body.Close()
+
+	outcome := classifyProbeStatus(resp.StatusCode)
+	if outcome != probeSupported {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, outcome
+	}
+
+	var payload struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, probeUnknown
+	}
+
+	models := make([]string, 0, len(payload.Data))
+	for _, item := range payload.Data {
+		if item.ID != "" {
+			models = append(models, item.ID)
+		}
+	}
+	return models, probeSupported
+}
+
+// probeChat 发送最小对话请求，可选开启流式或携带一个工具定义
+func (p *capabilityProber) probeChat(model string, stream, withTools bool) probeOutcome {
+	body := map[string]interface{}{
+		"model":      model,
+		"max_tokens": 1,
+		"messages":   []map[string]interface{}{{"role": "user", "content": "ping"}},
+	}
+	if stream {
+		body["stream"] = true
+	}
+	if withTools {
+		body["tools"] = []interface{}{p.probeTool()}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return probeUnknown
+	}
+
+	resp, err := p.do(http.MethodPost, endpointURL(p.baseURL, p.chatPath()), data)
+	if err != nil {
+		return probeUnknown
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	outcome := classifyProbeStatus(resp.StatusCode)
+	if outcome == probeSupported && stream && !strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// 忽略stream参数直接返回完整响应，视为不支持流式
+		return probeUnsupported
+	}
+	return outcome
+}
+
+// probeTool 探测用的无参数工具定义
+func (p *capabilityProber) probeTool() map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	if p.anthropic {
+		return map[string]interface{}{"name": "ping", "description": "probe", "input_schema": schema}
+	}
+	return map[string]interface{}{
+		"type":     "function",
+		"function": map[string]interface{}{"name": "ping", "description": "probe", "parameters": schema},
+	}
+}
+
+func (p *capabilityProber) do(method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range p.headers {
+		req.Header.Set(key, value)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return p.client.Do(req)
+}
+
+// classifyProbeStatus 根据状态码判断探测结论，鉴权失败、限流、服务端错误均视为无法判断。
+// 400/422通常是探测请求本身被拒绝（模型不可用、max_tokens=1被拒、OAuth账号要求特定系统提示词等），
+// 并不说明端点或能力不存在，同样视为无法判断
+func classifyProbeStatus(statusCode int) probeOutcome {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return probeSupported
+	case statusCode == http.StatusNotFound, statusCode == http.StatusMethodNotAllowed:
+		return probeUnsupported
+	default:
+		return probeUnknown
+	}
+}
+
+func outcomeToBool(outcome probeOutcome) *bool {
+	if outcome == probeUnknown {
+		return nil
+	}
+	supported := outcome == probeSupported
+	return &supported
+}
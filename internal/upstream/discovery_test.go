@@ -0,0 +1,128 @@
+package upstream
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpstreamManager_DiscoverCapabilities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/models":
+			_, _ = w.Write([]byte(`{"data":[{"id":"qwen-plus"},{"id":"qwen-max"}]}`))
+		case "/v1/chat/completions":
+			var body map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["model"] != "qwen-plus" {
+				t.Errorf("探测模型 = %v", body["model"])
+			}
+			if _, ok := body["tools"]; ok {
+				// 模拟忽略tools参数的兼容服务
+				_, _ = w.Write([]byte(`{"choices":[]}`))
+				return
+			}
+			if body["stream"] == true {
+				// 模拟忽略stream参数、直接返回完整响应的兼容服务
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"choices":[]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"choices":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	mgr := newTaggedManager(t, server.URL)
+
+	capabilities, err := mgr.DiscoverCapabilities("a1", "", time.Second)
+	if err != nil {
+		t.Fatalf("DiscoverCapabilities() error = %v", err)
+	}
+
+	if want := []string{"qwen-plus", "qwen-max"}; !reflect.DeepEqual(capabilities.Models, want) {
+		t.Errorf("Models = %v, want %v", capabilities.Models, want)
+	}
+	if want := []string{"/v1/models", "/v1/chat/completions"}; !reflect.DeepEqual(capabilities.Endpoints, want) {
+		t.Errorf("Endpoints = %v, want %v", capabilities.Endpoints, want)
+	}
+	if capabilities.Streaming == nil || *capabilities.Streaming {
+		t.Errorf("Streaming = %v, want false", capabilities.Streaming)
+	}
+	if capabilities.Tools == nil || !*capabilities.Tools {
+		t.Errorf("Tools = %v, want true", capabilities.Tools)
+	}
+
+	account, _ := mgr.GetAccount("a1")
+	if account.Capabilities == nil || account.Capabilities.ProbeModel != "qwen-plus" {
+		t.Errorf("能力信息未记录到账号: %+v", account.Capabilities)
+	}
+}
+
+func TestUpstreamManager_DiscoverCapabilities_ProbeRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.URL.Path != "/v1/chat/completions":
+			w.WriteHeader(http.StatusNotFound)
+		case body["stream"] == true:
+			// 探测请求本身被拒绝（如max_tokens=1不被接受），不能说明不支持流式
+			w.WriteHeader(http.StatusBadRequest)
+		case body["tools"] != nil:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		default:
+			_, _ = w.Write([]byte(`{"choices":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	mgr := newTaggedManager(t, server.URL)
+
+	capabilities, err := mgr.DiscoverCapabilities("a1", "gpt-4o", time.Second)
+	if err != nil {
+		t.Fatalf("DiscoverCapabilities() error = %v", err)
+	}
+	if capabilities.Streaming != nil {
+		t.Errorf("400时Streaming = %v, want nil", *capabilities.Streaming)
+	}
+	if capabilities.Tools != nil {
+		t.Errorf("422时Tools = %v, want nil", *capabilities.Tools)
+	}
+}
+
+func TestUpstreamManager_DiscoverCapabilities_Unauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	mgr := newTaggedManager(t, server.URL)
+
+	capabilities, err := mgr.DiscoverCapabilities("a1", "gpt-4o", time.Second)
+	if err != nil {
+		t.Fatalf("DiscoverCapabilities() error = %v", err)
+	}
+	if len(capabilities.Endpoints) != 0 || capabilities.Streaming != nil || capabilities.Tools != nil {
+		t.Errorf("鉴权失败时不应得出能力结论: %+v", capabilities)
+	}
+}
+
+func TestEndpointURL(t *testing.T) {
+	tests := map[string]string{
+		"https://api.example.com":     "https://api.example.com/v1/chat/completions",
+		"https://api.example.com/":    "https://api.example.com/v1/chat/completions",
+		"https://api.example.com/v1":  "https://api.example.com/v1/chat/completions",
+		"https://api.example.com/v1/": "https://api.example.com/v1/chat/completions",
+	}
+	for baseURL, want := range tests {
+		if got := endpointURL(baseURL, "/v1/chat/completions"); got != want {
+			t.Errorf("endpointURL(%q) = %q, want %q", baseURL, got, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package upstream
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// DefaultProbeTimeout 健康探测默认超时时间
+const DefaultProbeTimeout = 10 * time.Second
+
+// BatchResult 批量操作中单个账号的执行结果
+type BatchResult struct {
+	UpstreamID string
+	Name       string
+	Err        error
+}
+
+// ProbeAccount 对账号做一次轻量探测：OAuth账号检查token有效性，API Key账号请求模型列表端点。
+// 账号配置了HealthProbe时按其发送探测请求（OAuth账号在token有效后同样发送）
+func (m *UpstreamManager) ProbeAccount(account *types.UpstreamAccount, timeout time.Duration) error {
+	if account.Type == types.UpstreamTypeOAuth {
+		if !NewOAuthManager(m).IsTokenValid(account.ID) {
+			return fmt.Errorf("OAuth token无效或已过期")
+		}
+		if account.HealthProbe == nil {
+			return nil
+		}
+	}
+
+	if account.IsAPIKeyExpired(time.Now()) {
+		return fmt.Errorf("API Key已过期")
+	}
+
+	headers, err := m.GetAuthHeaders(account.ID)
+	if err != nil {
+		return err
+	}
+
+	req, err := newProbeRequest(account.HealthProbe, m.GetBaseURL(account))
+	if err != nil {
+		return fmt.Errorf("创建探测请求失败: %w", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return fmt.Errorf("探测请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if !account.HealthProbe.Accepts(resp.StatusCode) {
+		return fmt.Errorf("探测返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newProbeRequest 按探测配置构造请求，probe为nil时请求模型列表端点
+func newProbeRequest(probe *types.HealthProbe, baseURL string) (*http.Request, error) {
+	if probe == nil {
+		return http.NewRequest(http.MethodGet, modelsURL(baseURL), nil)
+	}
+
+	method := strings.ToUpper(probe.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	target := modelsURL(baseURL)
+	switch {
+	case strings.HasPrefix(probe.Path, "http://"), strings.HasPrefix(probe.Path, "https://"):
+		// 探测请求携带账号凭据，完整URL只能指向BaseURL所在的主机
+		if err := checkProbeHost(probe.Path, baseURL); err != nil {
+			return nil, err
+		}
+		target = probe.Path
+	case probe.Path != "":
+		target = endpointURL(baseURL, probe.Path)
+	}
+
+	var body io.Reader
+	if probe.Body != "" {
+		body = strings.NewReader(probe.Body)
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if probe.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// checkProbeHost 校验完整URL形式的探测地址与BaseURL的协议和主机一致
+func checkProbeHost(target, baseURL string) error {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(targetURL.Scheme, base.Scheme) || !strings.EqualFold(targetURL.Host, base.Host) {
+		return fmt.Errorf("探测URL %s 与上游BaseURL %s 的主机不一致", target, baseURL)
+	}
+	return nil
+}
+
+// modelsURL 根据BaseURL拼接模型列表端点
+func modelsURL(baseURL string) string {
+	return endpointURL(baseURL, "/v1/models")
+}
+
+// endpointURL 拼接 /v1 开头的端点路径，兼容已包含 /v1 的BaseURL
+func endpointURL(baseURL, path string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if strings.HasSuffix(baseURL, "/v1") {
+		return baseURL + strings.TrimPrefix(path, "/v1")
+	}
+	return baseURL + path
+}
+
+// CheckAccountHealth 探测账号并记录健康状态，返回探测错误
+func (m *UpstreamManager) CheckAccountHealth(upstreamID string, timeout time.Duration) error {
+	account, err := m.configMgr.GetUpstreamAccount(upstreamID)
+	if err != nil {
+		return err
+	}
+
+	probeErr := m.ProbeAccount(account, timeout)
+	if err := m.UpdateAccountHealth(upstreamID, probeErr == nil); err != nil {
+		return fmt.Errorf("更新健康状态失败: %w", err)
+	}
+	return probeErr
+}
+
+// FindAccountsByTags 查找包含全部指定标签的账号，按ID排序
+func (m *UpstreamManager) FindAccountsByTags(selector map[string]string) []*types.UpstreamAccount {
+	var matched []*types.UpstreamAccount
+	for _, account := range m.configMgr.ListUpstreamAccounts() {
+		if account.MatchTags(selector) {
+			matched = append(matched, account)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+	return matched
+}
+
+// UpdateAccountTags 设置账号标签，值为空的key表示删除该标签
+func (m *UpstreamManager) UpdateAccountTags(upstreamID string, tags map[string]string) error {
+	return m.configMgr.UpdateUpstreamAccount(upstreamID, func(account *types.UpstreamAccount) error {
+		if account.Tags == nil {
+			account.Tags = make(map[string]string)
+		}
+		for key, value := range tags {
+			if value == "" {
+				delete(account.Tags, key)
+			} else {
+				account.Tags[key] = value
+			}
+		}
+		if len(account.Tags) == 0 {
+			account.Tags = nil
+		}
+		account.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// BatchUpdateStatus 按标签批量启用/禁用账号
+func (m *UpstreamManager) BatchUpdateStatus(selector map[string]string, status string) ([]BatchResult, error) {
+	return m.batch(selector, func(account *types.UpstreamAccount) error {
+		return m.UpdateAccountStatus(account.ID, status)
+	})
+}
+
+// BatchCheckHealth 按标签批量健康检查账号
+func (m *UpstreamManager) BatchCheckHealth(selector map[string]string, timeout time.Duration) ([]BatchResult, error) {
+	return m.batch(selector, func(account *types.UpstreamAccount) error {
+		return m.CheckAccountHealth(account.ID, timeout)
+	})
+}
+
+// batch 对匹配标签的账号逐个执行操作，单个失败不影响其余账号
+func (m *UpstreamManager) batch(selector map[string]string, op func(*types.UpstreamAccount) error) ([]BatchResult, error) {
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("批量操作需要至少指定一个标签")
+	}
+
+	accounts := m.FindAccountsByTags(selector)
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("没有匹配标签 %s 的上游账号", types.FormatTags(selector))
+	}
+
+	results := make([]BatchResult, 0, len(accounts))
+	for _, account := range accounts {
+		results = append(results, BatchResult{
+			UpstreamID: account.ID,
+			Name:       account.Name,
+			Err:        op(account),
+		})
+	}
+	return results, nil
+}
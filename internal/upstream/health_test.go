@@ -0,0 +1,163 @@
+package upstream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func newTaggedManager(t *testing.T, baseURL string) *UpstreamManager {
+	t.Helper()
+	configMgr := NewMockUpstreamConfigManager()
+	accounts := []*types.UpstreamAccount{
+		{ID: "a1", Name: "us-1", Type: types.UpstreamTypeAPIKey, Provider: types.ProviderOpenAI, APIKey: "sk-good", BaseURL: baseURL, Status: "active", Tags: map[string]string{"region": "us-east", "tier": "gold"}},
+		{ID: "a2", Name: "us-2", Type: types.UpstreamTypeAPIKey, Provider: types.ProviderOpenAI, APIKey: "sk-bad", BaseURL: baseURL + "/v1", Status: "active", Tags: map[string]string{"region": "us-east"}},
+		{ID: "a3", Name: "eu-1", Type: types.UpstreamTypeAPIKey, Provider: types.ProviderOpenAI, APIKey: "sk-good", BaseURL: baseURL, Status: "active", Tags: map[string]string{"region": "eu-west"}},
+	}
+	for _, account := range accounts {
+		_ = configMgr.CreateUpstreamAccount(account)
+	}
+	return NewUpstreamManager(configMgr)
+}
+
+func TestUpstreamManager_BatchUpdateStatus(t *testing.T) {
+	mgr := newTaggedManager(t, "http://127.0.0.1")
+
+	results, err := mgr.BatchUpdateStatus(map[string]string{"region": "us-east"}, "disabled")
+	if err != nil {
+		t.Fatalf("BatchUpdateStatus() error = %v", err)
+	}
+	if len(results) != 2 || results[0].UpstreamID != "a1" || results[1].UpstreamID != "a2" {
+		t.Fatalf("results = %+v", results)
+	}
+
+	for id, want := range map[string]string{"a1": "disabled", "a2": "disabled", "a3": "active"} {
+		account, _ := mgr.GetAccount(id)
+		if account.Status != want {
+			t.Errorf("%s status = %s, want %s", id, account.Status, want)
+		}
+	}
+
+	if _, err := mgr.BatchUpdateStatus(nil, "disabled"); err == nil {
+		t.Error("未指定标签时应拒绝批量操作")
+	}
+	if _, err := mgr.BatchUpdateStatus(map[string]string{"region": "ap-south"}, "disabled"); err == nil {
+		t.Error("没有匹配账号时应返回错误")
+	}
+}
+
+func TestUpstreamManager_BatchCheckHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer sk-good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	defer server.Close()
+
+	mgr := newTaggedManager(t, server.URL)
+
+	results, err := mgr.BatchCheckHealth(map[string]string{"region": "us-east"}, time.Second)
+	if err != nil {
+		t.Fatalf("BatchCheckHealth() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Err != nil || results[1].Err == nil {
+		t.Fatalf("results = %+v", results)
+	}
+
+	healthy, _ := mgr.GetAccount("a1")
+	unhealthy, _ := mgr.GetAccount("a2")
+	untouched, _ := mgr.GetAccount("a3")
+	if healthy.HealthStatus != "healthy" || unhealthy.HealthStatus != "unhealthy" || untouched.LastHealthCheck != nil {
+		t.Errorf("health = %s/%s/%v", healthy.HealthStatus, unhealthy.HealthStatus, untouched.LastHealthCheck)
+	}
+}
+
+func TestUpstreamManager_UpdateAccountTags(t *testing.T) {
+	mgr := newTaggedManager(t, "http://127.0.0.1")
+
+	if err := mgr.UpdateAccountTags("a1", map[string]string{"tier": "", "team": "search"}); err != nil {
+		t.Fatalf("UpdateAccountTags() error = %v", err)
+	}
+	account, _ := mgr.GetAccount("a1")
+	if got := types.FormatTags(account.Tags); got != "region=us-east,team=search" {
+		t.Errorf("tags = %s", got)
+	}
+}
+
+func TestUpstreamManager_CheckAccountHealth_CustomProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/messages" || string(body) != `{"max_tokens":1}` ||
+			r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// 上游对探测请求返回400也说明服务可达、凭据有效
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	mgr := newTaggedManager(t, server.URL)
+	_ = mgr.configMgr.UpdateUpstreamAccount("a1", func(account *types.UpstreamAccount) error {
+		account.HealthProbe = &types.HealthProbe{Path: "/v1/messages", Method: "post", Body: `{"max_tokens":1}`, ExpectStatus: []int{200, 400}}
+		return nil
+	})
+	_ = mgr.configMgr.UpdateUpstreamAccount("a3", func(account *types.UpstreamAccount) error {
+		account.HealthProbe = &types.HealthProbe{Path: "/v1/messages", Method: "POST", Body: `{"max_tokens":1}`}
+		return nil
+	})
+
+	if err := mgr.CheckAccountHealth("a1", time.Second); err != nil {
+		t.Errorf("期望状态码命中时应视为健康, err = %v", err)
+	}
+	if err := mgr.CheckAccountHealth("a3", time.Second); err == nil {
+		t.Error("未配置期望状态码时400不应视为健康")
+	}
+}
+
+func TestNewProbeRequest_AbsoluteURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"相对路径", "/v1/messages", false},
+		{"同主机完整URL", "https://api.example.com/status", false},
+		{"主机大小写不敏感", "https://API.example.com/status", false},
+		{"其他主机", "https://status.example.com/ping", true},
+		{"端口不同", "https://api.example.com:8443/status", true},
+		{"协议降级", "http://api.example.com/status", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newProbeRequest(&types.HealthProbe{Path: tt.path}, "https://api.example.com/v1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newProbeRequest(%s) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthProbe_Validate(t *testing.T) {
+	tests := []struct {
+		probe   types.HealthProbe
+		wantErr bool
+	}{
+		{types.HealthProbe{}, false},
+		{types.HealthProbe{Path: "https://status.example.com/ping", Method: "head"}, false},
+		{types.HealthProbe{Method: "DELETE"}, true},
+		{types.HealthProbe{Path: "v1/models"}, true},
+		{types.HealthProbe{ExpectStatus: []int{42}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.probe.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.probe, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/logger"
+)
+
+// DefaultKeyCooldown 上游未给出Retry-After时，被限流的API Key暂停使用的时长
+const DefaultKeyCooldown = time.Minute
+
+// keyPool 记录各上游账号API Key轮换池的轮换位置和限流冷却状态（仅内存）
+type keyPool struct {
+	mutex    sync.Mutex
+	next     map[string]int       // upstreamID -> 下一次轮换的起始位置
+	cooldown map[string]time.Time // upstreamID + key -> 冷却结束时间
+}
+
+// newKeyPool 创建API Key轮换池状态
+func newKeyPool() *keyPool {
+	return &keyPool{
+		next:     make(map[string]int),
+		cooldown: make(map[string]time.Time),
+	}
+}
+
+// pick 按轮换顺序选出下一个未在冷却中的key；全部冷却时选最早结束冷却的key
+func (p *keyPool) pick(upstreamID string, keys []string, now time.Time) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	if len(keys) == 1 {
+		return keys[0]
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	start := p.next[upstreamID] % len(keys)
+	chosen := -1
+	for i := 0; i < len(keys); i++ {
+		index := (start + i) % len(keys)
+		if !p.coolingLocked(upstreamID, keys[index], now) {
+			chosen = index
+			break
+		}
+	}
+	if chosen < 0 {
+		chosen = start
+		for i, key := range keys {
+			if p.cooldown[upstreamID+"\x00"+key].Before(p.cooldown[upstreamID+"\x00"+keys[chosen]]) {
+				chosen = i
+			}
+		}
+	}
+
+	p.next[upstreamID] = chosen + 1
+	return keys[chosen]
+}
+
+// markRateLimited 将key置为冷却状态，返回池中是否还有其他可用key
+func (p *keyPool) markRateLimited(upstreamID, key string, keys []string, until time.Time) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.cooldown[upstreamID+"\x00"+key] = until
+
+	now := time.Now()
+	for _, other := range keys {
+		if other != key && !p.coolingLocked(upstreamID, other, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// coolingLocked 判断key是否处于冷却中，过期的冷却记录顺带清理（调用方需持有锁）
+func (p *keyPool) coolingLocked(upstreamID, key string, now time.Time) bool {
+	entry := upstreamID + "\x00" + key
+	until, exists := p.cooldown[entry]
+	if !exists {
+		return false
+	}
+	if !now.Before(until) {
+		delete(p.cooldown, entry)
+		return false
+	}
+	return true
+}
+
+// MarkAPIKeyRateLimited 记录上游账号的某个API Key被限流，冷却期内轮换时跳过该key。
+// 返回轮换池中是否还有其他可用key，调用方可据此立即换key重试。
+func (m *UpstreamManager) MarkAPIKeyRateLimited(upstreamID, apiKey string, cooldown time.Duration) bool {
+	account, err := m.configMgr.GetUpstreamAccount(upstreamID)
+	if err != nil || apiKey == "" {
+		return false
+	}
+
+	keys := account.APIKeyPool()
+	if len(keys) < 2 {
+		return false
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultKeyCooldown
+	}
+
+	logger.Warn("上游账号 %s 的API Key %s 被限流，冷却 %v", upstreamID, maskValue(apiKey), cooldown)
+	return m.keyPool.markRateLimited(upstreamID, apiKey, keys, time.Now().Add(cooldown))
+}
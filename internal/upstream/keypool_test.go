@@ -0,0 +1,88 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+func newPooledManager(t *testing.T) *UpstreamManager {
+	t.Helper()
+	configMgr := NewMockUpstreamConfigManager()
+	_ = configMgr.CreateUpstreamAccount(&types.UpstreamAccount{
+		ID:       "pool",
+		Type:     types.UpstreamTypeAPIKey,
+		Provider: types.ProviderOpenAI,
+		APIKey:   "sk-key-one",
+		APIKeys:  []string{"sk-key-two", "sk-key-one", "", "sk-key-three"},
+		Status:   "active",
+	})
+	return NewUpstreamManager(configMgr)
+}
+
+func TestUpstreamAccount_APIKeyPool(t *testing.T) {
+	account := &types.UpstreamAccount{APIKey: "a", APIKeys: []string{"b", "a", "", "c"}}
+	pool := account.APIKeyPool()
+	if len(pool) != 3 || pool[0] != "a" || pool[1] != "b" || pool[2] != "c" {
+		t.Errorf("APIKeyPool() = %v, want [a b c]", pool)
+	}
+}
+
+func TestUpstreamManager_KeyPoolRotation(t *testing.T) {
+	mgr := newPooledManager(t)
+
+	var used []string
+	for i := 0; i < 4; i++ {
+		headers, key, err := mgr.GetAuthHeadersWithKey("pool")
+		if err != nil {
+			t.Fatalf("GetAuthHeadersWithKey() error = %v", err)
+		}
+		if headers["Authorization"] != "Bearer "+key {
+			t.Errorf("Authorization = %s, 与选用的key %s 不一致", headers["Authorization"], key)
+		}
+		used = append(used, key)
+	}
+
+	want := []string{"sk-key-one", "sk-key-two", "sk-key-three", "sk-key-one"}
+	for i := range want {
+		if used[i] != want[i] {
+			t.Fatalf("轮换顺序 = %v, want %v", used, want)
+		}
+	}
+}
+
+func TestUpstreamManager_KeyPoolSkipsRateLimited(t *testing.T) {
+	mgr := newPooledManager(t)
+
+	if !mgr.MarkAPIKeyRateLimited("pool", "sk-key-one", time.Minute) {
+		t.Fatal("池中还有其他key时应返回true")
+	}
+	if !mgr.MarkAPIKeyRateLimited("pool", "sk-key-two", time.Minute) {
+		t.Fatal("池中还有其他key时应返回true")
+	}
+	for i := 0; i < 3; i++ {
+		if _, key, _ := mgr.GetAuthHeadersWithKey("pool"); key != "sk-key-three" {
+			t.Fatalf("应跳过冷却中的key, 实际选用 %s", key)
+		}
+	}
+
+	// 全部冷却时返回false，并选用最早结束冷却的key
+	if mgr.MarkAPIKeyRateLimited("pool", "sk-key-three", 2*time.Minute) {
+		t.Error("全部key冷却时应返回false")
+	}
+	if _, key, _ := mgr.GetAuthHeadersWithKey("pool"); key != "sk-key-one" {
+		t.Errorf("全部冷却时应选用最早结束冷却的key, 实际选用 %s", key)
+	}
+}
+
+func TestUpstreamManager_KeyPoolSingleKey(t *testing.T) {
+	mgr := newTaggedManager(t, "http://127.0.0.1")
+
+	if mgr.MarkAPIKeyRateLimited("a1", "sk-good", time.Minute) {
+		t.Error("单key账号不应切换key")
+	}
+	if _, key, _ := mgr.GetAuthHeadersWithKey("a1"); key != "sk-good" {
+		t.Errorf("单key账号应始终使用该key, 实际选用 %s", key)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/iBreaker/llm-gateway/pkg/logger"
 	"github.com/iBreaker/llm-gateway/pkg/types"
 )
 
@@ -21,17 +22,29 @@ type ConfigManager interface {
 // UpstreamManager 上游账号业务管理器
 type UpstreamManager struct {
 	configMgr ConfigManager
+	qwenPolls *pollRegistry // 进行中的Qwen Device Flow轮询
+	keyPool   *keyPool      // API Key轮换池状态
 }
 
 // NewUpstreamManager 创建新的上游账号管理器
 func NewUpstreamManager(configMgr ConfigManager) *UpstreamManager {
 	return &UpstreamManager{
 		configMgr: configMgr,
+		qwenPolls: newPollRegistry(),
+		keyPool:   newKeyPool(),
 	}
 }
 
 // AddAccount 添加上游账号（业务逻辑）
 func (m *UpstreamManager) AddAccount(account *types.UpstreamAccount) error {
+	if account.BaseURL != "" {
+		baseURL, err := types.NormalizeBaseURL(account.BaseURL)
+		if err != nil {
+			return err
+		}
+		account.BaseURL = baseURL
+	}
+
 	// 业务逻辑：设置默认值
 	if account.ID == "" {
 		account.ID = generateUpstreamID()
@@ -97,6 +110,49 @@ func (m *UpstreamManager) UpdateAccountStatus(upstreamID string, status string)
 	})
 }
 
+// AccountUpdate 上游账号的可修改字段，nil表示不修改
+type AccountUpdate struct {
+	Name    *string
+	BaseURL *string
+	APIKey  *string
+}
+
+// UpdateAccount 只修改update中指定的字段，保留使用统计等其余信息（业务逻辑）
+func (m *UpstreamManager) UpdateAccount(upstreamID string, update AccountUpdate) error {
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return fmt.Errorf("账号名称不能为空")
+	}
+	if update.APIKey != nil && *update.APIKey == "" {
+		return fmt.Errorf("API Key不能为空")
+	}
+	// 空字符串表示清除自定义Base URL，恢复提供商默认地址
+	if update.BaseURL != nil && *update.BaseURL != "" {
+		baseURL, err := types.NormalizeBaseURL(*update.BaseURL)
+		if err != nil {
+			return err
+		}
+		update.BaseURL = &baseURL
+	}
+
+	return m.configMgr.UpdateUpstreamAccount(upstreamID, func(account *types.UpstreamAccount) error {
+		if update.APIKey != nil && account.Type != types.UpstreamTypeAPIKey {
+			return fmt.Errorf("%s类型账号不支持设置API Key", account.Type)
+		}
+
+		if update.Name != nil {
+			account.Name = *update.Name
+		}
+		if update.BaseURL != nil {
+			account.BaseURL = *update.BaseURL
+		}
+		if update.APIKey != nil {
+			account.APIKey = *update.APIKey
+		}
+		account.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
 // UpdateAccountHealth 更新上游账号健康状态（业务逻辑）
 func (m *UpstreamManager) UpdateAccountHealth(upstreamID string, healthy bool) error {
 	return m.configMgr.UpdateUpstreamAccount(upstreamID, func(account *types.UpstreamAccount) error {
@@ -124,6 +180,7 @@ func (m *UpstreamManager) RecordSuccess(upstreamID string, latency time.Duration
 		usage := account.Usage
 		usage.TotalRequests++
 		usage.SuccessfulRequests++
+		usage.ConsecutiveErrors = 0
 		usage.TokensUsed += tokensUsed
 		usage.LastUsedAt = time.Now()
 
@@ -151,6 +208,7 @@ func (m *UpstreamManager) RecordError(upstreamID string, err error) error {
 		usage := account.Usage
 		usage.TotalRequests++
 		usage.ErrorRequests++
+		usage.ConsecutiveErrors++
 
 		now := time.Now()
 		usage.LastErrorAt = &now
@@ -189,6 +247,24 @@ func (m *UpstreamManager) UpdateOAuthTokensWithResourceURL(upstreamID, accessTok
 	})
 }
 
+// RevokeOAuthTokens 清除OAuth账号的token并将状态置为needs_auth，账号不再被选用，
+// 重新完成授权（UpdateOAuthTokens）后恢复为active
+func (m *UpstreamManager) RevokeOAuthTokens(upstreamID string) error {
+	return m.configMgr.UpdateUpstreamAccount(upstreamID, func(account *types.UpstreamAccount) error {
+		if account.Type != types.UpstreamTypeOAuth {
+			return fmt.Errorf("账号类型不是OAuth: %s", upstreamID)
+		}
+
+		account.AccessToken = ""
+		account.RefreshToken = ""
+		account.ExpiresAt = nil
+		account.UpdatedAt = time.Now()
+		account.Status = "needs_auth"
+
+		return nil
+	})
+}
+
 // IsTokenExpired 检查OAuth token是否过期（业务逻辑）
 func (m *UpstreamManager) IsTokenExpired(upstreamID string) (bool, error) {
 	account, err := m.configMgr.GetUpstreamAccount(upstreamID)
@@ -209,29 +285,43 @@ func (m *UpstreamManager) IsTokenExpired(upstreamID string) (bool, error) {
 
 // GetAuthHeaders 获取上游账号的认证头部（业务逻辑）
 func (m *UpstreamManager) GetAuthHeaders(upstreamID string) (map[string]string, error) {
+	headers, _, err := m.GetAuthHeadersWithKey(upstreamID)
+	return headers, err
+}
+
+// GetAuthHeadersWithKey 获取认证头部，同时返回本次从轮换池选用的API Key（OAuth账号为空）
+func (m *UpstreamManager) GetAuthHeadersWithKey(upstreamID string) (map[string]string, string, error) {
 	account, err := m.configMgr.GetUpstreamAccount(upstreamID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	headers := make(map[string]string)
+	var apiKey string
 
 	switch account.Type {
 	case types.UpstreamTypeAPIKey:
+		// 在轮换池内轮换，跳过限流冷却中的key
+		apiKey = m.keyPool.pick(upstreamID, account.APIKeyPool(), time.Now())
+
 		switch account.Provider {
 		case types.ProviderAnthropic:
-			headers["x-api-key"] = account.APIKey
+			headers["x-api-key"] = apiKey
 			headers["anthropic-version"] = "2023-06-01"
 			// Claude Code必需的beta标识
 			headers["anthropic-beta"] = "claude-code-20250219,oauth-2025-04-20,interleaved-thinking-2025-05-14,fine-grained-tool-streaming-2025-05-14"
 		case types.ProviderOpenAI:
-			headers["Authorization"] = "Bearer " + account.APIKey
+			headers["Authorization"] = "Bearer " + apiKey
+		case types.ProviderGoogle:
+			headers["x-goog-api-key"] = apiKey
+		case types.ProviderAzure:
+			headers["api-key"] = apiKey
 		default:
-			headers["Authorization"] = "Bearer " + account.APIKey
+			headers["Authorization"] = "Bearer " + apiKey
 		}
 
 	case types.UpstreamTypeOAuth:
 		if account.AccessToken == "" {
-			return nil, fmt.Errorf("OAuth account missing access token")
+			return nil, "", fmt.Errorf("OAuth account missing access token")
 		}
 
 		// 1. 提前5分钟刷新token，避免在请求过程中过期
@@ -248,18 +338,18 @@ func (m *UpstreamManager) GetAuthHeaders(upstreamID string) (map[string]string,
 
 		// 如果没有refresh token，也无法刷新
 		if needRefresh && account.RefreshToken == "" {
-			return nil, fmt.Errorf("OAuth token已过期且无refresh token，需要重新授权: ./llm-gateway oauth start %s", upstreamID)
+			return nil, "", fmt.Errorf("OAuth token已过期且无refresh token，需要重新授权: ./llm-gateway oauth start %s", upstreamID)
 		}
 
 		// 2. 如果需要刷新，调用自动刷新逻辑
 		if needRefresh {
 			if err := m.autoRefreshToken(account); err != nil {
-				return nil, fmt.Errorf("auto refresh token failed: %w", err)
+				return nil, "", fmt.Errorf("auto refresh token failed: %w", err)
 			}
 			// 3. 刷新成功后，重新获取更新后的account信息
 			account, err = m.configMgr.GetUpstreamAccount(upstreamID)
 			if err != nil {
-				return nil, fmt.Errorf("failed to get updated account after refresh: %w", err)
+				return nil, "", fmt.Errorf("failed to get updated account after refresh: %w", err)
 			}
 		}
 
@@ -282,10 +372,10 @@ func (m *UpstreamManager) GetAuthHeaders(upstreamID string) (map[string]string,
 		}
 
 	default:
-		return nil, fmt.Errorf("unsupported upstream auth type: %s", account.Type)
+		return nil, "", fmt.Errorf("unsupported upstream auth type: %s", account.Type)
 	}
 
-	return headers, nil
+	return headers, apiKey, nil
 }
 
 // autoRefreshToken 自动刷新OAuth token（业务逻辑）
@@ -308,21 +398,25 @@ func (m *UpstreamManager) GetBaseURL(account *types.UpstreamAccount) string {
 		return account.BaseURL
 	}
 
-	// 2. Qwen OAuth特殊处理 - 使用resource_url
-	if account.Provider == types.ProviderQwen && account.Type == types.UpstreamTypeOAuth {
-		if account.ResourceURL != "" {
-			// 确保URL包含协议前缀
-			if !strings.HasPrefix(account.ResourceURL, "http://") && !strings.HasPrefix(account.ResourceURL, "https://") {
-				return "https://" + account.ResourceURL
-			}
-			return account.ResourceURL
-		}
+	// 2. Qwen特殊处理 - 使用设备授权token返回的resource_url（区域端点）
+	if account.Provider == types.ProviderQwen && account.ResourceURL != "" {
+		return qwenBaseURL(account.ResourceURL)
 	}
 
 	// 3. 根据提供商返回默认BaseURL
 	return m.getDefaultBaseURL(account.Provider)
 }
 
+// qwenBaseURL 规范化Qwen的resource_url：补全协议前缀，去掉末尾的/v1，
+// 因为上游路径（如/v1/chat/completions）已包含版本前缀
+func qwenBaseURL(resourceURL string) string {
+	baseURL := strings.TrimRight(strings.TrimSpace(resourceURL), "/")
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "https://" + baseURL
+	}
+	return strings.TrimSuffix(baseURL, "/v1")
+}
+
 // getDefaultBaseURL 获取提供商的默认BaseURL
 func (m *UpstreamManager) getDefaultBaseURL(provider types.Provider) string {
 	switch provider {
@@ -335,7 +429,7 @@ func (m *UpstreamManager) getDefaultBaseURL(provider types.Provider) string {
 	case types.ProviderAzure:
 		return "https://your-resource.openai.azure.com" // 需要配置
 	case types.ProviderQwen:
-		return "https://dashscope.aliyuncs.com/compatible-mode/v1"
+		return "https://dashscope.aliyuncs.com/compatible-mode"
 	default:
 		return "https://api.anthropic.com"
 	}
@@ -446,6 +540,70 @@ func (m *UpstreamManager) GetOAuthStatus(upstreamID string) (string, error) {
 	return "authorized", nil
 }
 
+// CheckCredentialExpiry 检查API Key凭据到期情况并记录日志，返回即将到期和已过期的账号
+func (m *UpstreamManager) CheckCredentialExpiry(now time.Time) (expiring, expired []*types.UpstreamAccount) {
+	for _, account := range m.configMgr.ListUpstreamAccounts() {
+		switch {
+		case account.IsAPIKeyExpired(now):
+			expired = append(expired, account)
+			logger.Error("上游账号 %s (%s) 的API Key已于 %s 过期，账号将不再被选用", account.Name, account.ID, account.APIKeyExpiresAt.Format("2006-01-02 15:04:05"))
+		case account.IsAPIKeyExpiringSoon(now, types.CredentialExpiryWarning):
+			expiring = append(expiring, account)
+			logger.Warn("上游账号 %s (%s) 的API Key将于 %s 到期，请及时更换", account.Name, account.ID, account.APIKeyExpiresAt.Format("2006-01-02 15:04:05"))
+		}
+	}
+	return expiring, expired
+}
+
+// OAuthStatusDetail OAuth账号授权状态详情，用于提示失效原因并引导重新授权
+type OAuthStatusDetail struct {
+	Status          string     `json:"status"`
+	Reason          string     `json:"reason,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	HasRefreshToken bool       `json:"has_refresh_token"`
+	NeedsReauth     bool       `json:"needs_reauth"`
+}
+
+// GetOAuthStatusDetail 获取OAuth授权状态及失效原因
+func (m *UpstreamManager) GetOAuthStatusDetail(upstreamID string) (*OAuthStatusDetail, error) {
+	status, err := m.GetOAuthStatus(upstreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := m.configMgr.GetUpstreamAccount(upstreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &OAuthStatusDetail{
+		Status:          status,
+		ExpiresAt:       account.ExpiresAt,
+		HasRefreshToken: account.RefreshToken != "",
+	}
+
+	switch status {
+	case "not_authorized":
+		detail.Reason = "尚未完成授权"
+		detail.NeedsReauth = true
+	case "expired":
+		if account.RefreshToken == "" {
+			detail.Reason = fmt.Sprintf("access token已于 %s 过期，且没有可用的refresh token", account.ExpiresAt.Format("2006-01-02 15:04:05"))
+			detail.NeedsReauth = true
+		} else {
+			detail.Reason = fmt.Sprintf("access token已于 %s 过期，下次请求时将尝试自动刷新", account.ExpiresAt.Format("2006-01-02 15:04:05"))
+		}
+	case "authorized":
+		// 最近的请求失败导致账号不健康时，提示可能需要重新授权
+		if account.HealthStatus == "unhealthy" {
+			detail.Reason = "账号健康检查失败，token可能已被撤销，建议重新授权"
+			detail.NeedsReauth = true
+		}
+	}
+
+	return detail, nil
+}
+
 // AnthropicOAuthResult Anthropic OAuth授权结果
 type AnthropicOAuthResult struct {
 	AuthURL string `json:"auth_url"`
@@ -2,14 +2,16 @@ package upstream
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/iBreaker/llm-gateway/pkg/types"
 )
 
-// MockUpstreamConfigManager 实现ConfigManager接口用于测试
+// MockUpstreamConfigManager 实现ConfigManager接口用于测试，与真实的配置管理器一样加锁并返回副本
 type MockUpstreamConfigManager struct {
+	mutex    sync.Mutex
 	accounts map[string]*types.UpstreamAccount
 }
 
@@ -20,37 +22,50 @@ func NewMockUpstreamConfigManager() *MockUpstreamConfigManager {
 }
 
 func (m *MockUpstreamConfigManager) CreateUpstreamAccount(account *types.UpstreamAccount) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.accounts[account.ID] = account
 	return nil
 }
 
 func (m *MockUpstreamConfigManager) GetUpstreamAccount(accountID string) (*types.UpstreamAccount, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	account, exists := m.accounts[accountID]
 	if !exists {
 		return nil, fmt.Errorf("account not found: %s", accountID)
 	}
-	return account, nil
+	accountCopy := *account
+	return &accountCopy, nil
 }
 
 func (m *MockUpstreamConfigManager) ListUpstreamAccounts() []*types.UpstreamAccount {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	accounts := make([]*types.UpstreamAccount, 0, len(m.accounts))
 	for _, account := range m.accounts {
-		accounts = append(accounts, account)
+		accountCopy := *account
+		accounts = append(accounts, &accountCopy)
 	}
 	return accounts
 }
 
 func (m *MockUpstreamConfigManager) ListActiveUpstreamAccounts(provider types.Provider) []*types.UpstreamAccount {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	accounts := make([]*types.UpstreamAccount, 0)
 	for _, account := range m.accounts {
 		if account.Provider == provider && account.Status == "active" {
-			accounts = append(accounts, account)
+			accountCopy := *account
+			accounts = append(accounts, &accountCopy)
 		}
 	}
 	return accounts
 }
 
 func (m *MockUpstreamConfigManager) UpdateUpstreamAccount(accountID string, updater func(*types.UpstreamAccount) error) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	account, exists := m.accounts[accountID]
 	if !exists {
 		return fmt.Errorf("account not found: %s", accountID)
@@ -59,6 +74,8 @@ func (m *MockUpstreamConfigManager) UpdateUpstreamAccount(accountID string, upda
 }
 
 func (m *MockUpstreamConfigManager) DeleteUpstreamAccount(accountID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	_, exists := m.accounts[accountID]
 	if !exists {
 		return fmt.Errorf("account not found: %s", accountID)
@@ -107,6 +124,28 @@ func TestUpstreamManager_AddAccount(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "custom_base_url",
+			account: &types.UpstreamAccount{
+				Name:     "test-base-url",
+				Type:     types.UpstreamTypeAPIKey,
+				Provider: types.ProviderOpenAI,
+				APIKey:   "sk-test",
+				BaseURL:  " https://proxy.example.com/openai/ ",
+			},
+			wantErr: false,
+		},
+		{
+			name: "base_url_without_scheme",
+			account: &types.UpstreamAccount{
+				Name:     "test-bad-base-url",
+				Type:     types.UpstreamTypeAPIKey,
+				Provider: types.ProviderOpenAI,
+				APIKey:   "sk-test",
+				BaseURL:  "api.example.com",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -138,6 +177,9 @@ func TestUpstreamManager_AddAccount(t *testing.T) {
 				if account.Name != tt.account.Name {
 					t.Errorf("GetAccount() name = %v, want %v", account.Name, tt.account.Name)
 				}
+				if tt.account.BaseURL != "" && account.BaseURL != "https://proxy.example.com/openai" {
+					t.Errorf("BaseURL应去掉首尾空白和末尾的/, got %q", account.BaseURL)
+				}
 			}
 		})
 	}
@@ -418,6 +460,62 @@ func TestUpstreamManager_UpdateOAuthTokens(t *testing.T) {
 	}
 }
 
+func TestUpstreamManager_RevokeOAuthTokens(t *testing.T) {
+	configMgr := NewMockUpstreamConfigManager()
+	mgr := NewUpstreamManager(configMgr)
+
+	account := &types.UpstreamAccount{
+		Name:     "test-oauth",
+		Type:     types.UpstreamTypeOAuth,
+		Provider: types.ProviderAnthropic,
+	}
+	_ = mgr.AddAccount(account)
+	if err := mgr.UpdateOAuthTokens(account.ID, "access-token", "refresh-token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("UpdateOAuthTokens() error = %v", err)
+	}
+
+	if err := mgr.RevokeOAuthTokens(account.ID); err != nil {
+		t.Fatalf("RevokeOAuthTokens() error = %v", err)
+	}
+	revoked, _ := mgr.GetAccount(account.ID)
+	if revoked.AccessToken != "" || revoked.RefreshToken != "" || revoked.ExpiresAt != nil {
+		t.Errorf("token应被清除: access=%q refresh=%q expires=%v", revoked.AccessToken, revoked.RefreshToken, revoked.ExpiresAt)
+	}
+	if revoked.Status != "needs_auth" {
+		t.Errorf("Status = %v, want needs_auth", revoked.Status)
+	}
+	if len(mgr.ListActiveAccounts(types.ProviderAnthropic)) != 0 {
+		t.Error("清除token后账号不应再被选用")
+	}
+	detail, err := mgr.GetOAuthStatusDetail(account.ID)
+	if err != nil {
+		t.Fatalf("GetOAuthStatusDetail() error = %v", err)
+	}
+	if detail.Status != "not_authorized" || !detail.NeedsReauth {
+		t.Errorf("GetOAuthStatusDetail() = %+v, want not_authorized且需要重新授权", detail)
+	}
+
+	// 重新授权后恢复可用
+	if err := mgr.UpdateOAuthTokens(account.ID, "new-access-token", "new-refresh-token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("UpdateOAuthTokens() error = %v", err)
+	}
+	reauthed, _ := mgr.GetAccount(account.ID)
+	if reauthed.Status != "active" || reauthed.AccessToken != "new-access-token" {
+		t.Errorf("重新授权后 Status = %v, AccessToken = %v", reauthed.Status, reauthed.AccessToken)
+	}
+
+	apiKeyAccount := &types.UpstreamAccount{
+		Name:     "test-api-key",
+		Type:     types.UpstreamTypeAPIKey,
+		Provider: types.ProviderAnthropic,
+		APIKey:   "sk-ant-test",
+	}
+	_ = mgr.AddAccount(apiKeyAccount)
+	if err := mgr.RevokeOAuthTokens(apiKeyAccount.ID); err == nil {
+		t.Error("RevokeOAuthTokens() should fail for non-OAuth account")
+	}
+}
+
 func TestUpstreamManager_IsTokenExpired(t *testing.T) {
 	configMgr := NewMockUpstreamConfigManager()
 	mgr := NewUpstreamManager(configMgr)
@@ -485,3 +583,199 @@ func TestUpstreamManager_IsTokenExpired(t *testing.T) {
 		t.Error("IsTokenExpired() should fail for non-OAuth account")
 	}
 }
+
+func TestUpstreamManager_QwenPollCancel(t *testing.T) {
+	mgr := NewUpstreamManager(NewMockUpstreamConfigManager())
+
+	// 启动第一次轮询
+	firstCtx, firstDone := mgr.qwenPolls.start("qwen-1")
+	if !mgr.IsQwenPolling("qwen-1") {
+		t.Fatal("启动后应处于轮询状态")
+	}
+
+	// 重新授权时旧轮询被取消
+	secondCtx, secondDone := mgr.qwenPolls.start("qwen-1")
+	select {
+	case <-firstCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("新授权应取消旧轮询")
+	}
+
+	// 旧轮询结束清理时不应影响新轮询
+	firstDone()
+	if !mgr.IsQwenPolling("qwen-1") {
+		t.Error("旧轮询清理不应移除新轮询")
+	}
+
+	// 显式取消
+	if !mgr.CancelQwenPoll("qwen-1") {
+		t.Error("CancelQwenPoll() 应返回true")
+	}
+	select {
+	case <-secondCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("显式取消后轮询上下文应结束")
+	}
+	secondDone()
+
+	if mgr.IsQwenPolling("qwen-1") {
+		t.Error("取消后不应处于轮询状态")
+	}
+	if mgr.CancelQwenPoll("qwen-1") {
+		t.Error("没有轮询时 CancelQwenPoll() 应返回false")
+	}
+}
+
+func TestUpstreamManager_GetOAuthStatusDetail(t *testing.T) {
+	configMgr := NewMockUpstreamConfigManager()
+	mgr := NewUpstreamManager(configMgr)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name            string
+		account         *types.UpstreamAccount
+		wantStatus      string
+		wantNeedsReauth bool
+	}{
+		{"未授权", &types.UpstreamAccount{ID: "o1", Type: types.UpstreamTypeOAuth}, "not_authorized", true},
+		{"过期可刷新", &types.UpstreamAccount{ID: "o2", Type: types.UpstreamTypeOAuth, AccessToken: "a", RefreshToken: "r", ExpiresAt: &past}, "expired", false},
+		{"过期不可刷新", &types.UpstreamAccount{ID: "o3", Type: types.UpstreamTypeOAuth, AccessToken: "a", ExpiresAt: &past}, "expired", true},
+		{"已授权但不健康", &types.UpstreamAccount{ID: "o4", Type: types.UpstreamTypeOAuth, AccessToken: "a", ExpiresAt: &future, HealthStatus: "unhealthy"}, "authorized", true},
+		{"正常", &types.UpstreamAccount{ID: "o5", Type: types.UpstreamTypeOAuth, AccessToken: "a", ExpiresAt: &future, HealthStatus: "healthy"}, "authorized", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = configMgr.CreateUpstreamAccount(tt.account)
+
+			detail, err := mgr.GetOAuthStatusDetail(tt.account.ID)
+			if err != nil {
+				t.Fatalf("GetOAuthStatusDetail() error = %v", err)
+			}
+			if detail.Status != tt.wantStatus || detail.NeedsReauth != tt.wantNeedsReauth {
+				t.Errorf("status=%s needs_reauth=%v, want %s/%v", detail.Status, detail.NeedsReauth, tt.wantStatus, tt.wantNeedsReauth)
+			}
+			if detail.NeedsReauth && detail.Reason == "" {
+				t.Error("需要重新授权时应给出原因")
+			}
+		})
+	}
+}
+
+func TestUpstreamManager_UpdateAccount(t *testing.T) {
+	configMgr := NewMockUpstreamConfigManager()
+	mgr := NewUpstreamManager(configMgr)
+
+	account := &types.UpstreamAccount{
+		Name:     "test-account",
+		Type:     types.UpstreamTypeAPIKey,
+		Provider: types.ProviderOpenAI,
+		BaseURL:  "https://old.example.com",
+		APIKey:   "sk-old",
+		Usage:    &types.UpstreamUsageStats{TotalRequests: 42},
+	}
+	_ = mgr.AddAccount(account)
+	before := account.UpdatedAt
+
+	// 只修改base-url，其余字段保持不变
+	newURL := "https://new.example.com"
+	if err := mgr.UpdateAccount(account.ID, AccountUpdate{BaseURL: &newURL}); err != nil {
+		t.Fatalf("UpdateAccount() error = %v", err)
+	}
+	updated, _ := mgr.GetAccount(account.ID)
+	if updated.BaseURL != newURL || updated.Name != "test-account" || updated.APIKey != "sk-old" {
+		t.Errorf("部分更新结果不正确: name=%s base_url=%s key=%s", updated.Name, updated.BaseURL, updated.APIKey)
+	}
+	if updated.Usage.TotalRequests != 42 {
+		t.Errorf("更新不应丢失使用统计, TotalRequests = %d", updated.Usage.TotalRequests)
+	}
+	if !updated.UpdatedAt.After(before) {
+		t.Error("UpdatedAt应被更新")
+	}
+
+	// 修改名称和key
+	newName, newKey := "renamed", "sk-new"
+	if err := mgr.UpdateAccount(account.ID, AccountUpdate{Name: &newName, APIKey: &newKey}); err != nil {
+		t.Fatalf("UpdateAccount() error = %v", err)
+	}
+	updated, _ = mgr.GetAccount(account.ID)
+	if updated.Name != "renamed" || updated.APIKey != "sk-new" || updated.BaseURL != newURL {
+		t.Errorf("部分更新结果不正确: name=%s base_url=%s key=%s", updated.Name, updated.BaseURL, updated.APIKey)
+	}
+
+	// 空名称被拒绝
+	empty := ""
+	if err := mgr.UpdateAccount(account.ID, AccountUpdate{Name: &empty}); err == nil {
+		t.Error("空名称应被拒绝")
+	}
+
+	// OAuth账号不能设置API Key
+	oauthAccount := &types.UpstreamAccount{
+		Name:        "oauth-account",
+		Type:        types.UpstreamTypeOAuth,
+		Provider:    types.ProviderAnthropic,
+		AccessToken: "token",
+	}
+	_ = mgr.AddAccount(oauthAccount)
+	if err := mgr.UpdateAccount(oauthAccount.ID, AccountUpdate{APIKey: &newKey}); err == nil {
+		t.Error("OAuth账号设置API Key应被拒绝")
+	}
+	if got, _ := mgr.GetAccount(oauthAccount.ID); got.APIKey != "" {
+		t.Errorf("被拒绝的更新不应生效, APIKey = %q", got.APIKey)
+	}
+
+	if err := mgr.UpdateAccount("non-existent", AccountUpdate{Name: &newName}); err == nil {
+		t.Error("UpdateAccount() should fail for non-existent account")
+	}
+}
+
+func TestUpstreamManager_GetBaseURL(t *testing.T) {
+	mgr := NewUpstreamManager(NewMockUpstreamConfigManager())
+
+	tests := []struct {
+		name    string
+		account *types.UpstreamAccount
+		want    string
+	}{
+		{
+			name:    "自定义BaseURL优先",
+			account: &types.UpstreamAccount{Provider: types.ProviderQwen, BaseURL: "https://custom.example.com", ResourceURL: "portal.qwen.ai"},
+			want:    "https://custom.example.com",
+		},
+		{
+			name:    "Qwen resource_url补全https前缀",
+			account: &types.UpstreamAccount{Provider: types.ProviderQwen, Type: types.UpstreamTypeOAuth, ResourceURL: "portal.qwen.ai"},
+			want:    "https://portal.qwen.ai",
+		},
+		{
+			name:    "Qwen resource_url去掉末尾的/v1",
+			account: &types.UpstreamAccount{Provider: types.ProviderQwen, Type: types.UpstreamTypeOAuth, ResourceURL: "https://portal.qwen.ai/v1/"},
+			want:    "https://portal.qwen.ai",
+		},
+		{
+			name:    "Qwen API Key账号同样使用resource_url",
+			account: &types.UpstreamAccount{Provider: types.ProviderQwen, Type: types.UpstreamTypeAPIKey, ResourceURL: "http://127.0.0.1:8080"},
+			want:    "http://127.0.0.1:8080",
+		},
+		{
+			name:    "Qwen没有resource_url时使用DashScope兼容端点",
+			account: &types.UpstreamAccount{Provider: types.ProviderQwen, Type: types.UpstreamTypeAPIKey},
+			want:    "https://dashscope.aliyuncs.com/compatible-mode",
+		},
+		{
+			name:    "其他提供商忽略resource_url",
+			account: &types.UpstreamAccount{Provider: types.ProviderOpenAI, ResourceURL: "portal.qwen.ai"},
+			want:    "https://api.openai.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mgr.GetBaseURL(tt.account); got != tt.want {
+				t.Errorf("GetBaseURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package upstream
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
@@ -11,6 +12,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/iBreaker/llm-gateway/pkg/logger"
@@ -21,9 +23,24 @@ import (
 type OAuthManager struct {
 	upstreamMgr   *UpstreamManager
 	httpClient    *http.Client
+	flowMu        sync.Mutex        // 保护pkceVerifiers和oauthStates，Web界面的授权请求可能并发
 	pkceVerifiers map[string]string // 存储每个OAuth流程的code_verifier
+	oauthStates   map[string]string // 存储每个授权码流程的state，回调时校验以防CSRF
+	tokenURL      string            // 非空时覆盖各提供商的token端点（测试用）
+
+	refreshLocks sync.Map // upstreamID -> *sync.Mutex，防止同一账号被并发刷新
+
+	autoRefreshMu   sync.Mutex
+	autoRefreshStop context.CancelFunc
+	autoRefreshWG   sync.WaitGroup
 }
 
+// DefaultOAuthRefreshInterval 后台OAuth token刷新的默认扫描间隔
+const DefaultOAuthRefreshInterval = time.Minute
+
+// oauthRefreshWindow token距离过期小于该时长时提前刷新
+const oauthRefreshWindow = 5 * time.Minute
+
 // NewOAuthManager 创建新的OAuth管理器
 func NewOAuthManager(upstreamMgr *UpstreamManager) *OAuthManager {
 	// 创建支持代理的HTTP客户端
@@ -34,6 +51,7 @@ func NewOAuthManager(upstreamMgr *UpstreamManager) *OAuthManager {
 	return &OAuthManager{
 		upstreamMgr:   upstreamMgr,
 		pkceVerifiers: make(map[string]string),
+		oauthStates:   make(map[string]string),
 		httpClient: &http.Client{
 			Timeout:   30 * time.Second,
 			Transport: transport,
@@ -43,12 +61,124 @@ func NewOAuthManager(upstreamMgr *UpstreamManager) *OAuthManager {
 
 // StorePKCEVerifier 存储PKCE验证码 (公开方法)
 func (m *OAuthManager) StorePKCEVerifier(upstreamID, verifier string) {
+	m.flowMu.Lock()
+	defer m.flowMu.Unlock()
+	m.pkceVerifiers[upstreamID] = verifier
+}
+
+// storeAuthorizationFlow 存储授权码流程的code_verifier和state，覆盖同一账号未完成的旧流程
+func (m *OAuthManager) storeAuthorizationFlow(upstreamID, verifier, state string) {
+	m.flowMu.Lock()
+	defer m.flowMu.Unlock()
 	m.pkceVerifiers[upstreamID] = verifier
+	m.oauthStates[upstreamID] = state
+}
+
+// takeAuthorizationFlow 取出并清除授权码流程的code_verifier和state，每个流程只能被回调使用一次
+func (m *OAuthManager) takeAuthorizationFlow(upstreamID string) (verifier, state string, ok bool) {
+	m.flowMu.Lock()
+	defer m.flowMu.Unlock()
+	verifier, ok = m.pkceVerifiers[upstreamID]
+	state = m.oauthStates[upstreamID]
+	delete(m.pkceVerifiers, upstreamID)
+	delete(m.oauthStates, upstreamID)
+	return verifier, state, ok
+}
+
+// clearPKCEVerifier 清除账号存储的验证信息
+func (m *OAuthManager) clearPKCEVerifier(upstreamID string) {
+	m.flowMu.Lock()
+	defer m.flowMu.Unlock()
+	delete(m.pkceVerifiers, upstreamID)
 }
 
 // PollQwenToken 启动Qwen Token轮询 (公开方法)
+// 同一upstreamID已有轮询时先取消旧轮询，避免重复轮询冲突
 func (m *OAuthManager) PollQwenToken(upstreamID, deviceCode, codeVerifier string, interval, expiresIn int) {
-	go m.pollQwenToken(upstreamID, deviceCode, codeVerifier, interval, expiresIn)
+	ctx, done := m.upstreamMgr.qwenPolls.start(upstreamID)
+	go func() {
+		defer done()
+		m.pollQwenToken(ctx, upstreamID, deviceCode, codeVerifier, interval, expiresIn)
+	}()
+}
+
+// CancelQwenPoll 取消指定上游账号正在进行的Qwen授权轮询，返回是否存在轮询
+func (m *OAuthManager) CancelQwenPoll(upstreamID string) bool {
+	return m.upstreamMgr.CancelQwenPoll(upstreamID)
+}
+
+// CancelQwenPoll 取消指定上游账号正在进行的Qwen授权轮询，返回是否存在轮询
+func (m *UpstreamManager) CancelQwenPoll(upstreamID string) bool {
+	return m.qwenPolls.cancel(upstreamID)
+}
+
+// IsQwenPolling 检查指定上游账号是否有进行中的Qwen授权轮询
+func (m *UpstreamManager) IsQwenPolling(upstreamID string) bool {
+	return m.qwenPolls.active(upstreamID)
+}
+
+// pollRegistry 记录每个upstreamID的轮询取消函数
+type pollRegistry struct {
+	mutex   sync.Mutex
+	cancels map[string]*pollHandle
+}
+
+// pollHandle 单次轮询的取消句柄
+type pollHandle struct {
+	cancel context.CancelFunc
+}
+
+// newPollRegistry 创建轮询注册表
+func newPollRegistry() *pollRegistry {
+	return &pollRegistry{
+		cancels: make(map[string]*pollHandle),
+	}
+}
+
+// start 注册新轮询（取消同ID的旧轮询），返回轮询上下文和结束时的清理函数
+func (r *pollRegistry) start(upstreamID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handle := &pollHandle{cancel: cancel}
+
+	r.mutex.Lock()
+	if old, exists := r.cancels[upstreamID]; exists {
+		logger.Info("取消旧的Qwen授权轮询: upstream_id=%s", upstreamID)
+		old.cancel()
+	}
+	r.cancels[upstreamID] = handle
+	r.mutex.Unlock()
+
+	return ctx, func() {
+		cancel()
+		r.mutex.Lock()
+		// 仅清理自己的句柄，避免误删新启动的轮询
+		if r.cancels[upstreamID] == handle {
+			delete(r.cancels, upstreamID)
+		}
+		r.mutex.Unlock()
+	}
+}
+
+// cancel 取消指定ID的轮询
+func (r *pollRegistry) cancel(upstreamID string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	handle, exists := r.cancels[upstreamID]
+	if !exists {
+		return false
+	}
+	handle.cancel()
+	delete(r.cancels, upstreamID)
+	return true
+}
+
+// active 检查指定ID是否有进行中的轮询
+func (r *pollRegistry) active(upstreamID string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, exists := r.cancels[upstreamID]
+	return exists
 }
 
 // AnthropicOAuthConfig Anthropic OAuth配置
@@ -108,7 +238,7 @@ func GeneratePKCE() (codeVerifier, codeChallenge string, err error) {
 func (m *OAuthManager) getAnthropicConfig() AnthropicOAuthConfig {
 	return AnthropicOAuthConfig{
 		AuthURL:     "https://claude.ai/oauth/authorize",
-		TokenURL:    "https://console.anthropic.com/v1/oauth/token",
+		TokenURL:    m.tokenEndpoint("https://console.anthropic.com/v1/oauth/token"),
 		ClientID:    AnthropicClientID,
 		RedirectURI: "https://console.anthropic.com/oauth/code/callback", // 使用官方回调地址，会显示code
 		Scope:       ScopesFull,                                          // 使用完整scope
@@ -119,12 +249,20 @@ func (m *OAuthManager) getAnthropicConfig() AnthropicOAuthConfig {
 func (m *OAuthManager) GetQwenConfig() QwenOAuthConfig {
 	return QwenOAuthConfig{
 		DeviceAuthURL: "https://chat.qwen.ai/api/v1/oauth2/device/code",
-		TokenURL:      "https://chat.qwen.ai/api/v1/oauth2/token",
+		TokenURL:      m.tokenEndpoint("https://chat.qwen.ai/api/v1/oauth2/token"),
 		ClientID:      QwenClientID,
 		Scope:         QwenScope,
 	}
 }
 
+// tokenEndpoint 返回实际使用的token端点，设置了覆盖地址时优先使用
+func (m *OAuthManager) tokenEndpoint(defaultURL string) string {
+	if m.tokenURL != "" {
+		return m.tokenURL
+	}
+	return defaultURL
+}
+
 // StartOAuthFlow 启动OAuth授权流程
 func (m *OAuthManager) StartOAuthFlow(upstreamID string) (string, error) {
 	account, err := m.upstreamMgr.GetAccount(upstreamID)
@@ -164,8 +302,7 @@ func (m *OAuthManager) startAnthropicOAuth(upstreamID string, account *types.Ups
 	}
 
 	// 存储code_verifier和state用于后续验证
-	m.pkceVerifiers[upstreamID] = codeVerifier
-	// TODO: 也需要存储state用于验证
+	m.storeAuthorizationFlow(upstreamID, codeVerifier, state)
 
 	// 构建授权URL - 按照工作示例的确切顺序
 	params := url.Values{}
@@ -207,10 +344,10 @@ func (m *OAuthManager) startQwenOAuth(upstreamID string, account *types.Upstream
 	}
 
 	// 存储device_code和code_verifier用于后续轮询
-	m.pkceVerifiers[upstreamID] = fmt.Sprintf("%s|%s", deviceResp.DeviceCode, codeVerifier)
+	m.StorePKCEVerifier(upstreamID, fmt.Sprintf("%s|%s", deviceResp.DeviceCode, codeVerifier))
 
 	// 启动自动轮询
-	go m.pollQwenToken(upstreamID, deviceResp.DeviceCode, codeVerifier, deviceResp.Interval, deviceResp.ExpiresIn)
+	m.PollQwenToken(upstreamID, deviceResp.DeviceCode, codeVerifier, deviceResp.Interval, deviceResp.ExpiresIn)
 
 	// 返回Device Flow的授权指引
 	return fmt.Sprintf("请访问: https://chat.qwen.ai/authorize?user_code=%s&client=llm-gateway\n正在等待授权完成...",
@@ -243,19 +380,16 @@ func (m *OAuthManager) HandleCallback(upstreamID string, code string) error {
 func (m *OAuthManager) handleAnthropicCallback(upstreamID string, code string, account *types.UpstreamAccount) error {
 	config := m.getAnthropicConfig()
 
-	// 获取存储的code_verifier
-	codeVerifier, exists := m.pkceVerifiers[upstreamID]
+	// 取出存储的code_verifier和state，同时清理 (无论成功还是失败都要清理)
+	codeVerifier, expectedState, exists := m.takeAuthorizationFlow(upstreamID)
 	if !exists {
 		return fmt.Errorf("未找到对应的code_verifier，请重新启动OAuth流程")
 	}
 
-	// 清理授权码 - 移除URL片段和其他参数
-	cleanedCode := code
-	if idx := strings.Index(code, "#"); idx != -1 {
-		cleanedCode = code[:idx]
-	}
-	if idx := strings.Index(cleanedCode, "&"); idx != -1 {
-		cleanedCode = cleanedCode[:idx]
+	// 授权页面显示的授权码格式为 code#state，拆分后校验state
+	cleanedCode, state := splitAuthorizationCode(code)
+	if expectedState == "" || state != expectedState {
+		return fmt.Errorf("state参数不匹配，请重新启动OAuth流程")
 	}
 
 	// 交换authorization code获取access token
@@ -265,7 +399,7 @@ func (m *OAuthManager) handleAnthropicCallback(upstreamID string, code string, a
 		"code":          cleanedCode,
 		"redirect_uri":  config.RedirectURI,
 		"code_verifier": codeVerifier,
-		"state":         upstreamID,
+		"state":         state,
 	}
 
 	tokenResp, err := m.exchangeCodeForToken(config.TokenURL, tokenReq, types.ProviderAnthropic)
@@ -277,17 +411,27 @@ func (m *OAuthManager) handleAnthropicCallback(upstreamID string, code string, a
 	expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
 
 	// 更新账号token信息
-	err = m.upstreamMgr.UpdateOAuthTokens(
+	return m.upstreamMgr.UpdateOAuthTokens(
 		upstreamID,
 		tokenResp.AccessToken,
 		tokenResp.RefreshToken,
 		expiresAt,
 	)
+}
 
-	// 清理存储的code_verifier (无论成功还是失败都要清理)
-	delete(m.pkceVerifiers, upstreamID)
-
-	return err
+// splitAuthorizationCode 将 code#state 形式的授权码拆分为授权码和state，并去除授权码后附带的其他参数
+func splitAuthorizationCode(raw string) (code, state string) {
+	code = strings.TrimSpace(raw)
+	if idx := strings.Index(code, "#"); idx != -1 {
+		code, state = code[:idx], code[idx+1:]
+	}
+	if idx := strings.Index(code, "&"); idx != -1 {
+		code = code[:idx]
+	}
+	if idx := strings.Index(state, "&"); idx != -1 {
+		state = state[:idx]
+	}
+	return code, state
 }
 
 // handleQwenCallback 处理Qwen OAuth回调 (Device Flow)
@@ -298,6 +442,21 @@ func (m *OAuthManager) handleQwenCallback(upstreamID string, code string, accoun
 
 // RefreshToken 刷新OAuth token
 func (m *OAuthManager) RefreshToken(upstreamID string) error {
+	lock := m.refreshLock(upstreamID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	return m.refreshToken(upstreamID)
+}
+
+// refreshLock 获取账号的刷新锁
+func (m *OAuthManager) refreshLock(upstreamID string) *sync.Mutex {
+	lock, _ := m.refreshLocks.LoadOrStore(upstreamID, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// refreshToken 刷新OAuth token，调用方需持有该账号的刷新锁
+func (m *OAuthManager) refreshToken(upstreamID string) error {
 	account, err := m.upstreamMgr.GetAccount(upstreamID)
 	if err != nil {
 		return err
@@ -415,6 +574,11 @@ func (m *OAuthManager) IsTokenValid(upstreamID string) bool {
 
 // AutoRefreshIfNeeded 如果需要则自动刷新token
 func (m *OAuthManager) AutoRefreshIfNeeded(upstreamID string) error {
+	// 持锁后再读取账号，其他调用方刚完成刷新时这里会看到新的过期时间而跳过
+	lock := m.refreshLock(upstreamID)
+	lock.Lock()
+	defer lock.Unlock()
+
 	account, err := m.upstreamMgr.GetAccount(upstreamID)
 	if err != nil {
 		return err
@@ -427,14 +591,75 @@ func (m *OAuthManager) AutoRefreshIfNeeded(upstreamID string) error {
 	// 检查是否即将过期（提前5分钟刷新）
 	if account.ExpiresAt != nil {
 		timeUntilExpiry := time.Until(*account.ExpiresAt)
-		if timeUntilExpiry < 5*time.Minute {
-			return m.RefreshToken(upstreamID)
+		if timeUntilExpiry < oauthRefreshWindow {
+			return m.refreshToken(upstreamID)
 		}
 	}
 
 	return nil
 }
 
+// StartAutoRefresh 启动后台任务，按interval扫描所有OAuth账号并刷新即将过期的token。
+// 重复调用会先停止之前的任务
+func (m *OAuthManager) StartAutoRefresh(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultOAuthRefreshInterval
+	}
+
+	m.StopAutoRefresh()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.autoRefreshMu.Lock()
+	m.autoRefreshStop = cancel
+	m.autoRefreshMu.Unlock()
+
+	m.autoRefreshWG.Add(1)
+	go func() {
+		defer m.autoRefreshWG.Done()
+
+		m.refreshExpiringTokens()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.refreshExpiringTokens()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// StopAutoRefresh 停止后台刷新任务并等待其退出
+func (m *OAuthManager) StopAutoRefresh() {
+	m.autoRefreshMu.Lock()
+	stop := m.autoRefreshStop
+	m.autoRefreshStop = nil
+	m.autoRefreshMu.Unlock()
+
+	if stop != nil {
+		stop()
+		m.autoRefreshWG.Wait()
+	}
+}
+
+// refreshExpiringTokens 刷新所有即将过期的OAuth token，失败的账号标记为不健康以提示重新授权
+func (m *OAuthManager) refreshExpiringTokens() {
+	for _, account := range m.upstreamMgr.ListAccounts() {
+		// 没有refresh token的账号无法自动刷新，需要用户重新授权
+		if account.Type != types.UpstreamTypeOAuth || account.RefreshToken == "" {
+			continue
+		}
+
+		if err := m.AutoRefreshIfNeeded(account.ID); err != nil {
+			logger.Warn("自动刷新OAuth token失败 [%s]: %v", account.ID, err)
+			_ = m.upstreamMgr.UpdateAccountHealth(account.ID, false)
+		}
+	}
+}
+
 // TokenResponse OAuth token响应结构
 type TokenResponse struct {
 	AccessToken  string `json:"access_token"`
@@ -500,7 +725,7 @@ func (m *OAuthManager) RequestQwenDeviceCode(deviceAuthURL string, deviceReq map
 }
 
 // pollQwenToken 轮询Qwen token状态 (Device Flow)
-func (m *OAuthManager) pollQwenToken(upstreamID, deviceCode, codeVerifier string, interval, expiresIn int) {
+func (m *OAuthManager) pollQwenToken(ctx context.Context, upstreamID, deviceCode, codeVerifier string, interval, expiresIn int) {
 	config := m.GetQwenConfig()
 
 	// 设置轮询间隔，默认5秒
@@ -522,7 +747,14 @@ func (m *OAuthManager) pollQwenToken(upstreamID, deviceCode, codeVerifier string
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Qwen授权轮询已取消: upstream_id=%s", upstreamID)
+			return
+		case <-ticker.C:
+		}
+
 		// 检查是否超时
 		if time.Since(startTime) > timeout {
 			logger.Error("Qwen授权轮询超时: upstream_id=%s", upstreamID)
@@ -569,7 +801,7 @@ func (m *OAuthManager) pollQwenToken(upstreamID, deviceCode, codeVerifier string
 		}
 
 		// 清理存储的验证信息
-		delete(m.pkceVerifiers, upstreamID)
+		m.clearPKCEVerifier(upstreamID)
 
 		logger.Info("Qwen OAuth授权完成: upstream_id=%s", upstreamID)
 		fmt.Printf("\n✅ Qwen OAuth授权成功完成！\n")
@@ -0,0 +1,207 @@
+package upstream
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// newFakeTokenServer 创建模拟token端点，每次刷新返回递增编号的access token
+func newFakeTokenServer(t *testing.T, calls *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" {
+			http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(calls, 1)
+		// 放慢响应，让并发刷新有机会重叠
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"refresh-%d","expires_in":3600}`, n, n)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newOAuthTestManager 创建包含一个即将过期的Anthropic OAuth账号的OAuth管理器
+func newOAuthTestManager(t *testing.T, tokenURL string) (*OAuthManager, *MockUpstreamConfigManager) {
+	t.Helper()
+	configMgr := NewMockUpstreamConfigManager()
+	expiresAt := time.Now().Add(time.Minute)
+	_ = configMgr.CreateUpstreamAccount(&types.UpstreamAccount{
+		ID:           "oauth-1",
+		Name:         "claude",
+		Type:         types.UpstreamTypeOAuth,
+		Provider:     types.ProviderAnthropic,
+		AccessToken:  "access-old",
+		RefreshToken: "refresh-old",
+		ExpiresAt:    &expiresAt,
+		Status:       "active",
+	})
+
+	oauthMgr := NewOAuthManager(NewUpstreamManager(configMgr))
+	oauthMgr.tokenURL = tokenURL
+	return oauthMgr, configMgr
+}
+
+func TestOAuthManager_StartAutoRefresh(t *testing.T) {
+	var calls int32
+	server := newFakeTokenServer(t, &calls)
+	oauthMgr, configMgr := newOAuthTestManager(t, server.URL)
+
+	oauthMgr.StartAutoRefresh(10 * time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&calls) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	oauthMgr.StopAutoRefresh()
+
+	account, _ := configMgr.GetUpstreamAccount("oauth-1")
+	if account.AccessToken != "access-1" || account.RefreshToken != "refresh-1" {
+		t.Fatalf("token未被后台刷新: access=%s refresh=%s", account.AccessToken, account.RefreshToken)
+	}
+	if time.Until(*account.ExpiresAt) < 30*time.Minute {
+		t.Errorf("过期时间未更新: %v", account.ExpiresAt)
+	}
+	// 刷新后token已远离过期窗口，后续扫描不应重复刷新
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("token端点调用次数 = %d, want 1", got)
+	}
+}
+
+func TestOAuthManager_AutoRefreshIfNeeded_Concurrent(t *testing.T) {
+	var calls int32
+	server := newFakeTokenServer(t, &calls)
+	oauthMgr, _ := newOAuthTestManager(t, server.URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := oauthMgr.AutoRefreshIfNeeded("oauth-1"); err != nil {
+				t.Errorf("AutoRefreshIfNeeded() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("同一账号被并发刷新 %d 次, want 1", got)
+	}
+}
+
+func TestOAuthManager_HandleCallback_ValidatesState(t *testing.T) {
+	var exchanges int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		atomic.AddInt32(&exchanges, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"access-new","refresh_token":"refresh-new","expires_in":3600,"state":%q}`, r.PostForm.Get("state"))
+	}))
+	t.Cleanup(server.Close)
+	oauthMgr, configMgr := newOAuthTestManager(t, server.URL)
+
+	start := func() string {
+		t.Helper()
+		authURL, err := oauthMgr.StartOAuthFlow("oauth-1")
+		if err != nil {
+			t.Fatalf("StartOAuthFlow() error = %v", err)
+		}
+		parsed, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatalf("解析授权URL失败: %v", err)
+		}
+		return parsed.Query().Get("state")
+	}
+
+	tests := []struct {
+		name  string
+		state func(real string) string
+	}{
+		{"state不匹配", func(string) string { return "forged-state" }},
+		{"缺少state", func(string) string { return "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := start()
+			code := "auth-code"
+			if s := tt.state(state); s != "" {
+				code += "#" + s
+			}
+			if err := oauthMgr.HandleCallback("oauth-1", code); err == nil {
+				t.Fatal("state不匹配的回调应被拒绝")
+			}
+			if _, exists := oauthMgr.pkceVerifiers["oauth-1"]; exists {
+				t.Error("失败后应清理code_verifier")
+			}
+			if _, exists := oauthMgr.oauthStates["oauth-1"]; exists {
+				t.Error("失败后应清理state")
+			}
+		})
+	}
+	if got := atomic.LoadInt32(&exchanges); got != 0 {
+		t.Errorf("state校验失败时不应请求token端点, 调用次数 = %d", got)
+	}
+
+	// state匹配时完成授权
+	state := start()
+	if err := oauthMgr.HandleCallback("oauth-1", "auth-code#"+state); err != nil {
+		t.Fatalf("HandleCallback() error = %v", err)
+	}
+	account, _ := configMgr.GetUpstreamAccount("oauth-1")
+	if account.AccessToken != "access-new" {
+		t.Errorf("AccessToken = %q, want access-new", account.AccessToken)
+	}
+	if _, exists := oauthMgr.oauthStates["oauth-1"]; exists {
+		t.Error("成功后应清理state")
+	}
+}
+
+func TestOAuthManager_ConcurrentStartAndCallback(t *testing.T) {
+	var exchanges int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		atomic.AddInt32(&exchanges, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"access-new","refresh_token":"refresh-new","expires_in":3600,"state":%q}`, r.PostForm.Get("state"))
+	}))
+	t.Cleanup(server.Close)
+	oauthMgr, _ := newOAuthTestManager(t, server.URL)
+
+	var succeeded int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			authURL, err := oauthMgr.StartOAuthFlow("oauth-1")
+			if err != nil {
+				t.Errorf("StartOAuthFlow() error = %v", err)
+				return
+			}
+			parsed, _ := url.Parse(authURL)
+			// 其他流程可能覆盖state，回调失败是预期行为，只要求不发生数据竞争
+			if err := oauthMgr.HandleCallback("oauth-1", "auth-code#"+parsed.Query().Get("state")); err == nil {
+				atomic.AddInt32(&succeeded, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 每个state只能被回调使用一次，只有校验通过的回调会请求token端点
+	if got, want := atomic.LoadInt32(&exchanges), atomic.LoadInt32(&succeeded); got != want {
+		t.Errorf("token端点调用次数 = %d, want %d", got, want)
+	}
+	if atomic.LoadInt32(&succeeded) == 0 {
+		t.Error("至少应有一个回调完成授权")
+	}
+}
@@ -17,11 +17,16 @@ var (
 	enabled bool
 	mu      sync.RWMutex
 	logDir  string
+
+	pendingSaves sync.WaitGroup // 尚未写完的异步保存
 )
 
 // RequestTrace 请求跟踪信息
 type RequestTrace struct {
 	RequestID      string         `json:"request_id"`
+	TraceID        string         `json:"trace_id,omitempty"`
+	ParentSpanID   string         `json:"parent_span_id,omitempty"`
+	SpanID         string         `json:"span_id,omitempty"`
 	Timestamp      time.Time      `json:"timestamp"`
 	GatewayKeyID   string         `json:"gateway_key_id"`
 	UpstreamID     string         `json:"upstream_id"`
@@ -33,6 +38,9 @@ type RequestTrace struct {
 	ResponseFormat string         `json:"response_format"`
 	IsStreaming    bool           `json:"is_streaming"`
 
+	// 上游账号选择过程
+	UpstreamSelection *UpstreamSelectionTrace `json:"upstream_selection,omitempty"`
+
 	// 原始请求
 	RawClientRequest json.RawMessage `json:"raw_client_request"`
 
@@ -54,6 +62,9 @@ type RequestTrace struct {
 	// 流式响应记录
 	StreamChunks []StreamChunkTrace `json:"stream_chunks,omitempty"`
 
+	// 流式响应组装后的完整文本，便于审计时直接查看
+	StreamContent string `json:"stream_content,omitempty"`
+
 	// 统计信息
 	TotalDuration      time.Duration `json:"total_duration"`
 	UpstreamDuration   time.Duration `json:"upstream_duration"`
@@ -64,6 +75,14 @@ type RequestTrace struct {
 	ErrorAt string `json:"error_at,omitempty"`
 }
 
+// UpstreamSelectionTrace 上游账号选择跟踪：负载均衡策略、候选账号及选中原因
+type UpstreamSelectionTrace struct {
+	Strategy   string   `json:"strategy"`
+	Candidates []string `json:"candidates"`
+	Chosen     string   `json:"chosen"`
+	Reason     string   `json:"reason"`
+}
+
 // StreamChunkTrace 流式响应块跟踪
 type StreamChunkTrace struct {
 	Timestamp      time.Time       `json:"timestamp"`
@@ -128,12 +147,22 @@ func NewRequestTrace(requestID string) *RequestTrace {
 	}
 }
 
-// SetClientRequest 设置原始客户端请求
+// SetTraceContext 设置W3C Trace Context信息
+func (t *RequestTrace) SetTraceContext(traceID, parentSpanID, spanID string) {
+	if t == nil {
+		return
+	}
+	t.TraceID = traceID
+	t.ParentSpanID = parentSpanID
+	t.SpanID = spanID
+}
+
+// SetClientRequest 设置原始客户端请求，内容按脱敏级别处理
 func (t *RequestTrace) SetClientRequest(data []byte) {
 	if t == nil {
 		return
 	}
-	t.RawClientRequest = json.RawMessage(data)
+	t.RawClientRequest = json.RawMessage(redactPayload(data))
 }
 
 // SetProxyRequest 设置中间格式请求
@@ -143,6 +172,10 @@ func (t *RequestTrace) SetUnifiedRequest(req *types.UnifiedRequest) {
 	}
 	t.UnifiedRequest = req
 	if req != nil {
+		var redacted types.UnifiedRequest
+		if redactStruct(req, &redacted) {
+			t.UnifiedRequest = &redacted
+		}
 		t.GatewayKeyID = req.GatewayKeyID
 		t.UpstreamID = req.UpstreamID
 		t.Model = req.Model
@@ -157,7 +190,7 @@ func (t *RequestTrace) SetUpstreamRequest(data []byte) {
 	if t == nil {
 		return
 	}
-	t.UpstreamRequest = json.RawMessage(data)
+	t.UpstreamRequest = json.RawMessage(redactPayload(data))
 }
 
 // SetUpstreamResponse 设置原始上游响应
@@ -165,7 +198,7 @@ func (t *RequestTrace) SetUpstreamResponse(data []byte) {
 	if t == nil {
 		return
 	}
-	t.RawUpstreamResponse = json.RawMessage(data)
+	t.RawUpstreamResponse = json.RawMessage(redactPayload(data))
 }
 
 // SetProxyResponse 设置中间格式响应
@@ -174,6 +207,12 @@ func (t *RequestTrace) SetUnifiedResponse(resp *types.UnifiedResponse) {
 		return
 	}
 	t.UnifiedResponse = resp
+	if resp != nil {
+		var redacted types.UnifiedResponse
+		if redactStruct(resp, &redacted) {
+			t.UnifiedResponse = &redacted
+		}
+	}
 }
 
 // SetClientResponse 设置转换后的客户端响应
@@ -181,7 +220,7 @@ func (t *RequestTrace) SetClientResponse(data []byte) {
 	if t == nil {
 		return
 	}
-	t.ClientResponse = json.RawMessage(data)
+	t.ClientResponse = json.RawMessage(redactPayload(data))
 }
 
 // AddStreamChunk 添加流式响应块
@@ -196,6 +235,9 @@ func (t *RequestTrace) AddStreamChunk(eventType string, rawData, convertedData [
 		ProcessingTime: processingTime,
 	}
 
+	rawData = redactPayload(rawData)
+	convertedData = redactPayload(convertedData)
+
 	// 安全地处理原始数据 - 如果是有效JSON则直接使用，否则转换为字符串
 	if len(rawData) > 0 {
 		if json.Valid(rawData) {
@@ -221,6 +263,17 @@ func (t *RequestTrace) AddStreamChunk(eventType string, rawData, convertedData [
 	t.StreamChunks = append(t.StreamChunks, chunk)
 }
 
+// SetStreamContent 设置流式响应组装后的完整文本
+func (t *RequestTrace) SetStreamContent(content string) {
+	if t == nil {
+		return
+	}
+	if level := RedactionLevel(); level != types.TraceRedactionFull {
+		content = redactString("content", content, level)
+	}
+	t.StreamContent = content
+}
+
 // SetContextInfo 设置上下文信息
 func (t *RequestTrace) SetContextInfo(provider types.Provider, clientEndpoint, upstreamPath, requestFormat, responseFormat string) {
 	if t == nil {
@@ -234,6 +287,20 @@ func (t *RequestTrace) SetContextInfo(provider types.Provider, clientEndpoint, u
 	t.ResponseFormat = responseFormat
 }
 
+// SetUpstreamSelection 设置上游账号选择过程
+func (t *RequestTrace) SetUpstreamSelection(strategy string, candidates []string, chosen, reason string) {
+	if t == nil {
+		return
+	}
+
+	t.UpstreamSelection = &UpstreamSelectionTrace{
+		Strategy:   strategy,
+		Candidates: candidates,
+		Chosen:     chosen,
+		Reason:     reason,
+	}
+}
+
 // SetDurations 设置耗时统计
 func (t *RequestTrace) SetDurations(total, upstream, conversion time.Duration) {
 	if t == nil {
@@ -301,13 +368,20 @@ func (t *RequestTrace) SaveAsync() {
 		return
 	}
 
+	pendingSaves.Add(1)
 	go func() {
+		defer pendingSaves.Done()
 		if err := t.Save(); err != nil {
 			fmt.Printf("保存调试信息失败: %v\n", err)
 		}
 	}()
 }
 
+// Flush 等待所有异步保存完成，服务器关闭前调用以免丢失跟踪记录
+func Flush() {
+	pendingSaves.Wait()
+}
+
 // EnableFromConfig 从配置启用调试模式
 func EnableFromConfig(level string, file string) error {
 	// 统一使用 logger 模块的调试级别判断
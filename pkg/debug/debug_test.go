@@ -0,0 +1,33 @@
+package debug
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSetUpstreamSelection(t *testing.T) {
+	trace := &RequestTrace{RequestID: "req-1"}
+	trace.SetUpstreamSelection("health_first", []string{"a", "b"}, "a", "跳过不健康账号: b")
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded struct {
+		UpstreamSelection *UpstreamSelectionTrace `json:"upstream_selection"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	got := decoded.UpstreamSelection
+	if got == nil {
+		t.Fatal("跟踪JSON中缺少upstream_selection")
+	}
+	if got.Strategy != "health_first" || got.Chosen != "a" || len(got.Candidates) != 2 || got.Reason != "跳过不健康账号: b" {
+		t.Errorf("upstream_selection = %+v", got)
+	}
+
+	// nil跟踪（调试关闭）不应panic
+	var nilTrace *RequestTrace
+	nilTrace.SetUpstreamSelection("random", nil, "", "")
+}
@@ -0,0 +1,152 @@
+package debug
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+// redactionLevel trace内容脱敏级别，默认全记录
+var redactionLevel = types.TraceRedactionFull
+
+// metadataKeys metadata级别下仍保留原值的结构性字段
+var metadataKeys = map[string]bool{
+	"id":            true,
+	"object":        true,
+	"model":         true,
+	"role":          true,
+	"type":          true,
+	"name":          true,
+	"finish_reason": true,
+	"stop_reason":   true,
+	"tool_call_id":  true,
+	"tool_use_id":   true,
+}
+
+// secretKeys pii级别下整体打码的字段
+var secretKeys = map[string]bool{
+	"api_key":       true,
+	"apikey":        true,
+	"x-api-key":     true,
+	"authorization": true,
+	"access_token":  true,
+	"refresh_token": true,
+	"client_secret": true,
+	"password":      true,
+	"secret":        true,
+}
+
+// piiPatterns pii级别下在文本中识别并替换的内容，按顺序匹配
+var piiPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)bearer\s+[a-z0-9._\-]+`), "Bearer [SECRET]"},
+	{regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_\-]{16,}`), "[SECRET]"},
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`), "[CARD]"},
+	{regexp.MustCompile(`\+\d{1,3}[ \-]?\d{6,14}\b|\b1[3-9]\d{9}\b`), "[PHONE]"},
+}
+
+// SetRedactionLevel 设置trace内容脱敏级别，空字符串表示全记录
+func SetRedactionLevel(level string) error {
+	switch level {
+	case "":
+		level = types.TraceRedactionFull
+	case types.TraceRedactionFull, types.TraceRedactionPII, types.TraceRedactionMetadata:
+	default:
+		return fmt.Errorf("不支持的trace脱敏级别: %s", level)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	redactionLevel = level
+	return nil
+}
+
+// RedactionLevel 返回当前trace内容脱敏级别
+func RedactionLevel() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return redactionLevel
+}
+
+// redactPayload 按当前脱敏级别处理一段请求/响应数据，非JSON数据按纯文本处理
+func redactPayload(data []byte) []byte {
+	level := RedactionLevel()
+	if level == types.TraceRedactionFull || len(data) == 0 {
+		return data
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		redacted, _ := json.Marshal(redactString("", string(data), level))
+		return redacted
+	}
+
+	redacted, err := json.Marshal(redactValue("", value, level))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+// redactStruct 将结构体序列化后脱敏，再反序列化到dst；全记录级别时返回false，由调用方直接使用原值
+func redactStruct(src, dst interface{}) bool {
+	if RedactionLevel() == types.TraceRedactionFull {
+		return false
+	}
+
+	data, err := json.Marshal(src)
+	if err != nil {
+		return true
+	}
+	_ = json.Unmarshal(redactPayload(data), dst)
+	return true
+}
+
+// redactValue 递归处理JSON值，key为该值所在的字段名
+func redactValue(key string, value interface{}, level string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = redactValue(k, item, level)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(key, item, level)
+		}
+		return v
+	case string:
+		return redactString(key, v, level)
+	default:
+		return v
+	}
+}
+
+// redactString 处理单个字符串值
+func redactString(key, value, level string) string {
+	if value == "" {
+		return value
+	}
+
+	if level == types.TraceRedactionMetadata {
+		if metadataKeys[key] {
+			return value
+		}
+		return fmt.Sprintf("[REDACTED %d chars]", utf8.RuneCountInString(value))
+	}
+
+	if secretKeys[strings.ToLower(key)] {
+		return "[SECRET]"
+	}
+	for _, pattern := range piiPatterns {
+		value = pattern.re.ReplaceAllString(value, pattern.replacement)
+	}
+	return value
+}
@@ -0,0 +1,96 @@
+package debug
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/iBreaker/llm-gateway/pkg/types"
+)
+
+const sampleRequest = `{"model":"gpt-4o","api_key":"abc","messages":[{"role":"user","content":"我的邮箱是 alice@example.com，手机 13812345678，卡号 4111 1111 1111 1111，key sk-abcdefghijklmnopqrstuvwx"}],"temperature":0.5}`
+
+func withRedactionLevel(t *testing.T, level string) {
+	t.Helper()
+	if err := SetRedactionLevel(level); err != nil {
+		t.Fatalf("SetRedactionLevel(%q) error = %v", level, err)
+	}
+	t.Cleanup(func() { _ = SetRedactionLevel("") })
+}
+
+func TestRedactPayload_Full(t *testing.T) {
+	withRedactionLevel(t, types.TraceRedactionFull)
+
+	if got := string(redactPayload([]byte(sampleRequest))); got != sampleRequest {
+		t.Errorf("full级别不应修改内容, got %s", got)
+	}
+}
+
+func TestRedactPayload_PII(t *testing.T) {
+	withRedactionLevel(t, types.TraceRedactionPII)
+
+	got := string(redactPayload([]byte(sampleRequest)))
+	for _, leaked := range []string{"alice@example.com", "13812345678", "4111 1111 1111 1111", "sk-abcdefghijklmnopqrstuvwx", `"abc"`} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("pii级别未脱敏 %q: %s", leaked, got)
+		}
+	}
+	for _, kept := range []string{"我的邮箱是", "[EMAIL]", "[PHONE]", "[CARD]", "[SECRET]", `"gpt-4o"`} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("pii级别结果缺少 %q: %s", kept, got)
+		}
+	}
+}
+
+func TestRedactPayload_Metadata(t *testing.T) {
+	withRedactionLevel(t, types.TraceRedactionMetadata)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(redactPayload([]byte(sampleRequest)), &got); err != nil {
+		t.Fatalf("脱敏结果应为合法JSON: %v", err)
+	}
+
+	if got["model"] != "gpt-4o" || got["temperature"] != 0.5 {
+		t.Errorf("元数据应保留: %v", got)
+	}
+	message := got["messages"].([]interface{})[0].(map[string]interface{})
+	if message["role"] != "user" {
+		t.Errorf("role应保留: %v", message)
+	}
+	if content, _ := message["content"].(string); !strings.HasPrefix(content, "[REDACTED") {
+		t.Errorf("内容不应记录: %v", message["content"])
+	}
+
+	// 非JSON数据（如SSE文本）同样不记录内容
+	if text := string(redactPayload([]byte("data: hello\n\n"))); strings.Contains(text, "hello") {
+		t.Errorf("非JSON内容未脱敏: %s", text)
+	}
+}
+
+func TestRequestTrace_SetUnifiedRequestRedacted(t *testing.T) {
+	withRedactionLevel(t, types.TraceRedactionMetadata)
+
+	req := &types.UnifiedRequest{
+		Model:        "gpt-4o",
+		GatewayKeyID: "key-1",
+		Messages:     []types.Message{{Role: "user", Content: "secret plan"}},
+	}
+	trace := &RequestTrace{}
+	trace.SetUnifiedRequest(req)
+
+	if trace.GatewayKeyID != "key-1" || trace.Model != "gpt-4o" {
+		t.Errorf("元数据 = %s/%s", trace.GatewayKeyID, trace.Model)
+	}
+	if trace.UnifiedRequest == req || trace.UnifiedRequest.Messages[0].Content == "secret plan" {
+		t.Error("trace中的请求内容应被脱敏")
+	}
+	if req.Messages[0].Content != "secret plan" {
+		t.Error("不应修改原始请求")
+	}
+}
+
+func TestSetRedactionLevel_Invalid(t *testing.T) {
+	if err := SetRedactionLevel("partial"); err == nil {
+		t.Error("未知级别应返回错误")
+	}
+}
@@ -0,0 +1,156 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// weekdayNames 星期缩写到time.Weekday的映射
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// AccessWindow - Gateway Key可用时间窗口
+type AccessWindow struct {
+	Days      []string `json:"days,omitempty" yaml:"days,omitempty"`             // 允许的星期（mon..sun），为空表示每天
+	StartTime string   `json:"start_time,omitempty" yaml:"start_time,omitempty"` // 开始时间 HH:MM，与结束时间均为空表示全天
+	EndTime   string   `json:"end_time,omitempty" yaml:"end_time,omitempty"`     // 结束时间 HH:MM，早于开始时间表示跨越午夜
+	Timezone  string   `json:"timezone,omitempty" yaml:"timezone,omitempty"`     // IANA时区，默认服务器本地时区
+}
+
+// Validate 验证时间窗口配置
+func (w *AccessWindow) Validate() error {
+	for _, day := range w.Days {
+		if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("无效的星期: %s (支持: mon, tue, wed, thu, fri, sat, sun)", day)
+		}
+	}
+	if _, err := w.location(); err != nil {
+		return err
+	}
+	if w.allDay() {
+		if len(w.Days) == 0 {
+			return fmt.Errorf("时间窗口至少需要指定星期或时间段")
+		}
+		return nil
+	}
+	if _, err := parseClock(w.StartTime); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.EndTime); err != nil {
+		return err
+	}
+	if w.StartTime == w.EndTime {
+		return fmt.Errorf("时间窗口开始与结束时间不能相同: %s", w.StartTime)
+	}
+	return nil
+}
+
+// Contains 判断时间点是否在窗口内。跨午夜的窗口以开始当天的星期为准。
+func (w *AccessWindow) Contains(now time.Time) (bool, error) {
+	loc, err := w.location()
+	if err != nil {
+		return false, err
+	}
+
+	local := now.In(loc)
+	if w.allDay() {
+		return w.allowsDay(local.Weekday()), nil
+	}
+
+	start, err := parseClock(w.StartTime)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(w.EndTime)
+	if err != nil {
+		return false, err
+	}
+
+	minute := local.Hour()*60 + local.Minute()
+
+	if start < end {
+		return minute >= start && minute < end && w.allowsDay(local.Weekday()), nil
+	}
+
+	// 跨午夜：开始当天的晚段，或次日的早段（按前一天的星期判断）
+	if minute >= start {
+		return w.allowsDay(local.Weekday()), nil
+	}
+	if minute < end {
+		return w.allowsDay(local.AddDate(0, 0, -1).Weekday()), nil
+	}
+	return false, nil
+}
+
+// String 返回窗口的可读描述
+func (w *AccessWindow) String() string {
+	days := "每天"
+	if len(w.Days) > 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	desc := days
+	if !w.allDay() {
+		desc += fmt.Sprintf(" %s-%s", w.StartTime, w.EndTime)
+	}
+	if w.Timezone != "" {
+		desc += " (" + w.Timezone + ")"
+	}
+	return desc
+}
+
+func (w *AccessWindow) allDay() bool {
+	return w.StartTime == "" && w.EndTime == ""
+}
+
+func (w *AccessWindow) allowsDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, name := range w.Days {
+		if weekdayNames[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *AccessWindow) location() (*time.Location, error) {
+	if w.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区 %s: %w", w.Timezone, err)
+	}
+	return loc, nil
+}
+
+// parseClock 解析 HH:MM 为当天的分钟数
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间 %q，格式应为 HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// IsWithinAccessWindow 判断Key当前是否可用，未配置时间窗口时始终可用，配置多个窗口时命中任一即可
+func (k *GatewayAPIKey) IsWithinAccessWindow(now time.Time) bool {
+	if len(k.AccessWindows) == 0 {
+		return true
+	}
+	for i := range k.AccessWindows {
+		if ok, err := k.AccessWindows[i].Contains(now); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
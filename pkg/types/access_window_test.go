@@ -0,0 +1,80 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccessWindow_Contains(t *testing.T) {
+	// 2024-01-01 为周一
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		window AccessWindow
+		now    time.Time
+		want   bool
+	}{
+		{"工作日窗口内", AccessWindow{Days: []string{"mon", "fri"}, StartTime: "09:00", EndTime: "18:00", Timezone: "UTC"}, at(1, 10, 0), true},
+		{"结束时间不含", AccessWindow{StartTime: "09:00", EndTime: "18:00", Timezone: "UTC"}, at(1, 18, 0), false},
+		{"星期不匹配", AccessWindow{Days: []string{"mon"}, StartTime: "09:00", EndTime: "18:00", Timezone: "UTC"}, at(2, 10, 0), false},
+		{"全天仅限星期", AccessWindow{Days: []string{"Sat", "sun"}, Timezone: "UTC"}, at(7, 23, 59), true},
+		{"跨午夜当晚", AccessWindow{Days: []string{"mon"}, StartTime: "22:00", EndTime: "06:00", Timezone: "UTC"}, at(1, 23, 0), true},
+		{"跨午夜次日凌晨按前一天", AccessWindow{Days: []string{"mon"}, StartTime: "22:00", EndTime: "06:00", Timezone: "UTC"}, at(2, 5, 0), true},
+		{"跨午夜前一天不允许", AccessWindow{Days: []string{"tue"}, StartTime: "22:00", EndTime: "06:00", Timezone: "UTC"}, at(2, 5, 0), false},
+		{"时区换算", AccessWindow{StartTime: "09:00", EndTime: "18:00", Timezone: "Asia/Shanghai"}, at(1, 2, 0), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.window.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			got, err := tt.window.Contains(tt.now)
+			if err != nil {
+				t.Fatalf("Contains() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessWindow_Validate(t *testing.T) {
+	invalid := []AccessWindow{
+		{},
+		{Days: []string{"monday"}},
+		{StartTime: "9am", EndTime: "18:00"},
+		{StartTime: "09:00", EndTime: "09:00"},
+		{Days: []string{"mon"}, Timezone: "Mars/Base"},
+	}
+	for _, window := range invalid {
+		if err := window.Validate(); err == nil {
+			t.Errorf("Validate(%+v) 应返回错误", window)
+		}
+	}
+}
+
+func TestGatewayAPIKey_IsWithinAccessWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+
+	key := &GatewayAPIKey{}
+	if !key.IsWithinAccessWindow(now) {
+		t.Error("未配置时间窗口时应始终可用")
+	}
+
+	key.AccessWindows = []AccessWindow{
+		{StartTime: "09:00", EndTime: "18:00", Timezone: "UTC"},
+	}
+	if key.IsWithinAccessWindow(now) {
+		t.Error("窗口外不应可用")
+	}
+
+	key.AccessWindows = append(key.AccessWindows, AccessWindow{StartTime: "19:00", EndTime: "23:00", Timezone: "UTC"})
+	if !key.IsWithinAccessWindow(now) {
+		t.Error("命中任一窗口即应可用")
+	}
+}
@@ -2,15 +2,16 @@ package types
 
 // AnthropicRequest - Anthropic API请求格式
 type AnthropicRequest struct {
-	Model       string                   `json:"model"`
-	Messages    []FlexibleMessage        `json:"messages"`
-	MaxTokens   int                      `json:"max_tokens,omitempty"`
-	Temperature float64                  `json:"temperature,omitempty"`
-	Stream      *bool                    `json:"stream,omitempty"`
-	System      *SystemField             `json:"system,omitempty"`
-	Metadata    map[string]interface{}   `json:"metadata,omitempty"`
-	Tools       []map[string]interface{} `json:"tools,omitempty"`
-	ToolChoice  interface{}              `json:"tool_choice,omitempty"`
+	Model         string                   `json:"model"`
+	Messages      []FlexibleMessage        `json:"messages"`
+	MaxTokens     int                      `json:"max_tokens,omitempty"`
+	Temperature   *float64                 `json:"temperature,omitempty"`
+	Stream        *bool                    `json:"stream,omitempty"`
+	System        *SystemField             `json:"system,omitempty"`
+	Metadata      map[string]interface{}   `json:"metadata,omitempty"`
+	Tools         []map[string]interface{} `json:"tools,omitempty"`
+	ToolChoice    interface{}              `json:"tool_choice,omitempty"`
+	StopSequences []string                 `json:"stop_sequences,omitempty"`
 }
 
 // AnthropicContentBlock - Anthropic响应中的内容块
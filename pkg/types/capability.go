@@ -0,0 +1,95 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 请求特性，用于模型能力校验
+const (
+	FeatureVision = "vision" // 图片输入
+	FeatureTools  = "tools"  // 工具调用
+)
+
+// ModelCapability - 模型能力声明，未声明（nil）的能力不做校验
+type ModelCapability struct {
+	Model  string `json:"model" yaml:"model"`                       // 模型名称，以 * 结尾表示前缀匹配
+	Vision *bool  `json:"vision,omitempty" yaml:"vision,omitempty"` // 是否支持图片输入
+	Tools  *bool  `json:"tools,omitempty" yaml:"tools,omitempty"`   // 是否支持工具调用
+}
+
+// ModelCapabilities - 模型能力表
+type ModelCapabilities []ModelCapability
+
+// UnsupportedFeatureError 请求使用了模型不支持的特性
+type UnsupportedFeatureError struct {
+	Model   string
+	Feature string
+}
+
+func (e *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("model %s does not support %s", e.Model, e.Feature)
+}
+
+// Find 查找模型能力声明，精确匹配优先，其次最长前缀匹配
+func (c ModelCapabilities) Find(model string) *ModelCapability {
+	var best *ModelCapability
+	bestLen := -1
+	for i := range c {
+		capability := &c[i]
+		if capability.Model == model {
+			return capability
+		}
+		if prefix, ok := strings.CutSuffix(capability.Model, "*"); ok && strings.HasPrefix(model, prefix) && len(prefix) > bestLen {
+			best = capability
+			bestLen = len(prefix)
+		}
+	}
+	return best
+}
+
+// CheckRequest 校验请求使用的特性是否被目标模型支持，未在能力表中的模型不做限制
+func (c ModelCapabilities) CheckRequest(req *UnifiedRequest) error {
+	capability := c.Find(req.Model)
+	if capability == nil {
+		return nil
+	}
+
+	if capability.Tools != nil && !*capability.Tools && len(req.Tools) > 0 {
+		return &UnsupportedFeatureError{Model: req.Model, Feature: FeatureTools}
+	}
+	if capability.Vision != nil && !*capability.Vision && requestHasImage(req) {
+		return &UnsupportedFeatureError{Model: req.Model, Feature: FeatureVision}
+	}
+	return nil
+}
+
+// Validate 验证模型能力表
+func (c ModelCapabilities) Validate() error {
+	for i, capability := range c {
+		if capability.Model == "" {
+			return fmt.Errorf("模型能力[%d] 模型名称不能为空", i)
+		}
+	}
+	return nil
+}
+
+// requestHasImage 判断请求消息中是否包含图片内容块（Anthropic image / OpenAI image_url）
+func requestHasImage(req *UnifiedRequest) bool {
+	for _, msg := range req.Messages {
+		blocks, ok := msg.Content.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range blocks {
+			block, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if blockType, _ := block["type"].(string); blockType == "image" || blockType == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
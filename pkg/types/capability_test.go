@@ -0,0 +1,49 @@
+package types
+
+import (
+	"errors"
+	"testing"
+)
+
+func boolPtr(v bool) *bool { return &v }
+
+func TestModelCapabilities_CheckRequest(t *testing.T) {
+	capabilities := ModelCapabilities{
+		{Model: "text-only-*", Vision: boolPtr(false), Tools: boolPtr(false)},
+		{Model: "text-only-vision", Vision: boolPtr(true)},
+	}
+
+	imageMessage := Message{Role: "user", Content: []interface{}{
+		map[string]interface{}{"type": "text", "text": "describe"},
+		map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/a.png"}},
+	}}
+	tools := []map[string]interface{}{{"name": "get_weather"}}
+
+	tests := []struct {
+		name        string
+		req         *UnifiedRequest
+		wantFeature string
+	}{
+		{"未声明模型不校验", &UnifiedRequest{Model: "gpt-4o", Messages: []Message{imageMessage}, Tools: tools}, ""},
+		{"纯文本请求", &UnifiedRequest{Model: "text-only-1", Messages: []Message{{Role: "user", Content: "hi"}}}, ""},
+		{"不支持图片", &UnifiedRequest{Model: "text-only-1", Messages: []Message{imageMessage}}, FeatureVision},
+		{"不支持工具", &UnifiedRequest{Model: "text-only-1", Tools: tools}, FeatureTools},
+		{"精确匹配优先", &UnifiedRequest{Model: "text-only-vision", Messages: []Message{imageMessage}, Tools: tools}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := capabilities.CheckRequest(tt.req)
+			if tt.wantFeature == "" {
+				if err != nil {
+					t.Errorf("CheckRequest() error = %v", err)
+				}
+				return
+			}
+			var featureErr *UnsupportedFeatureError
+			if !errors.As(err, &featureErr) || featureErr.Feature != tt.wantFeature {
+				t.Errorf("CheckRequest() error = %v, want feature %s", err, tt.wantFeature)
+			}
+		})
+	}
+}
@@ -1,30 +1,114 @@
 package types
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Config - 全局配置
 type Config struct {
-	Server           ServerConfig      `yaml:"server"`
-	Proxy            ProxyConfig       `yaml:"proxy"`
-	GatewayKeys      []GatewayAPIKey   `yaml:"gateway_keys"`
-	UpstreamAccounts []UpstreamAccount `yaml:"upstream_accounts"`
-	ModelRoutes      ModelRouteConfig  `yaml:"model_routes"`
-	Logging          LoggingConfig     `yaml:"logging"`
-	Environment      EnvironmentConfig `yaml:"environment"`
+	Server           ServerConfig           `yaml:"server"`
+	Proxy            ProxyConfig            `yaml:"proxy"`
+	GatewayKeys      []GatewayAPIKey        `yaml:"gateway_keys"`
+	UpstreamAccounts []UpstreamAccount      `yaml:"upstream_accounts"`
+	ModelRoutes      ModelRouteConfig       `yaml:"model_routes"`
+	Logging          LoggingConfig          `yaml:"logging"`
+	Environment      EnvironmentConfig      `yaml:"environment"`
+	Pricing          PricingConfig          `yaml:"pricing"`
+	RateLimit        RateLimitBackendConfig `yaml:"rate_limit"`
+	Moderation       ModerationConfig       `yaml:"moderation"`
+	Capabilities     ModelCapabilities      `yaml:"model_capabilities"`
+	Quotas           QuotaConfig            `yaml:"quotas"`
+}
+
+// QuotaConfig - 资源创建配额，0表示不限制
+// 当前为单管理员模型，按创建人（created_by）的限制为将来多租户化预留
+type QuotaConfig struct {
+	MaxGatewayKeys                int `yaml:"max_gateway_keys"`                  // Gateway API Key总数上限
+	MaxUpstreamAccounts           int `yaml:"max_upstream_accounts"`             // 上游账号总数上限
+	MaxUpstreamAccountsPerCreator int `yaml:"max_upstream_accounts_per_creator"` // 单个创建人的上游账号数上限
+}
+
+// Validate 验证配额不为负数
+func (c *QuotaConfig) Validate() error {
+	if c.MaxGatewayKeys < 0 || c.MaxUpstreamAccounts < 0 || c.MaxUpstreamAccountsPerCreator < 0 {
+		return fmt.Errorf("quotas配额不能为负数")
+	}
+	return nil
 }
 
 // ServerConfig - 服务器配置
 type ServerConfig struct {
-	Host    string    `yaml:"host"`
-	Port    int       `yaml:"port"`
-	Timeout int       `yaml:"timeout_seconds"`
-	Web     WebConfig `yaml:"web"`
+	Host                 string        `yaml:"host"`
+	Port                 int           `yaml:"port"`
+	Timeout              int           `yaml:"timeout_seconds"`
+	LoadBalanceStrategy  string        `yaml:"load_balance_strategy,omitempty"`          // 上游负载均衡策略，默认health_first
+	OAuthRefreshInterval int           `yaml:"oauth_refresh_interval_seconds,omitempty"` // 后台OAuth token刷新扫描间隔（秒），0使用默认值60秒
+	ShutdownGracePeriod  int           `yaml:"shutdown_grace_seconds,omitempty"`         // 优雅关闭时等待进行中请求完成的时长（秒），0使用默认值30秒
+	MaxRequestBytes      int64         `yaml:"max_request_bytes,omitempty"`              // API请求体上限（字节），0使用默认值32MiB
+	Web                  WebConfig     `yaml:"web"`
+	Metrics              MetricsConfig `yaml:"metrics,omitempty"`
+	CORS                 CORSConfig    `yaml:"cors,omitempty"`
+}
+
+// CORSConfig - 跨域访问配置，应用于代理端点和Web管理接口。未配置allowed_origins时允许任意来源
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins,omitempty"`   // 允许的来源，如https://app.example.com；"*"表示任意来源
+	AllowedMethods   []string `yaml:"allowed_methods,omitempty"`   // 允许的方法，为空使用默认值
+	AllowedHeaders   []string `yaml:"allowed_headers,omitempty"`   // 允许的请求头，为空使用默认值
+	AllowCredentials bool     `yaml:"allow_credentials,omitempty"` // 是否允许携带凭据，开启后回显请求来源而不是返回"*"，需配置明确的allowed_origins
+}
+
+// Validate 校验跨域配置：允许携带凭据时必须列出明确的来源，否则任意网站都能带着Web会话Cookie发起跨域请求
+func (c *CORSConfig) Validate() error {
+	if !c.AllowCredentials {
+		return nil
+	}
+	if len(c.AllowedOrigins) == 0 {
+		return fmt.Errorf("cors.allow_credentials需要配置明确的allowed_origins")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			return fmt.Errorf("cors.allow_credentials不能与allowed_origins中的\"*\"同时使用")
+		}
+	}
+	return nil
 }
 
+// MetricsConfig - Prometheus指标端点配置
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`          // 是否开放 /metrics 端点
+	Public  bool `yaml:"public,omitempty"` // 为true时无需Gateway Key即可抓取，默认需要认证
+}
+
+// 上游负载均衡策略
+const (
+	LoadBalanceHealthFirst = "health_first" // 排除不健康账号后轮询（默认）
+	LoadBalanceRoundRobin  = "round_robin"  // 在所有活跃账号间轮询
+	LoadBalanceRandom      = "random"       // 随机选择
+	LoadBalanceWeighted    = "weighted"     // 排除不健康账号后按账号权重分配
+)
+
 // WebConfig - Web 管理界面配置
 type WebConfig struct {
-	Enabled  bool   `yaml:"enabled"`
-	Password string `yaml:"password"`
+	Enabled         bool   `yaml:"enabled"`
+	Password        string `yaml:"password"`
+	SessionTTL      int    `yaml:"session_ttl_seconds,omitempty"` // 登录会话有效期（秒），0使用默认值24小时
+	PersistSessions bool   `yaml:"persist_sessions,omitempty"`    // 是否将会话持久化到配置目录，重启后无需重新登录
 }
 
+// 上游重试退避算法
+const (
+	RetryBackoffFixed       = "fixed"       // 固定延迟
+	RetryBackoffExponential = "exponential" // 指数退避
+)
+
+// 未知消息role的处理策略
+const (
+	UnknownRolePassthrough = "passthrough" // 原样透传给上游（默认）
+	UnknownRoleReject      = "reject"      // 拒绝请求并返回400
+)
+
 // ProxyConfig - 代理配置
 type ProxyConfig struct {
 	RequestTimeout  int `yaml:"request_timeout_seconds"`   // 普通请求超时
@@ -33,13 +117,149 @@ type ProxyConfig struct {
 	TLSTimeout      int `yaml:"tls_timeout_seconds"`       // TLS握手超时
 	IdleConnTimeout int `yaml:"idle_conn_timeout_seconds"` // 空闲连接超时
 	ResponseTimeout int `yaml:"response_timeout_seconds"`  // 响应头超时
+	// StreamWriteTimeout 流式响应单次写客户端的超时（秒），客户端消费过慢超过该时间则断开，默认30秒
+	StreamWriteTimeout int `yaml:"stream_write_timeout_seconds"`
+	// MaxStreamDuration 单个流式请求的最大生成时长（秒），超过后主动截断并发送结束标记，0表示不限制
+	MaxStreamDuration int `yaml:"max_stream_duration_seconds"`
+	// MaxResponseBytes 非流式上游响应体的最大字节数，超过则报错，默认32MiB
+	MaxResponseBytes int64 `yaml:"max_response_bytes"`
+	// MaxStreamResponseBytes 流式上游响应累计的最大字节数，超过则终止流，默认256MiB
+	MaxStreamResponseBytes int64 `yaml:"max_stream_response_bytes"`
+	// StreamTruncateReason 截断时返回的结束原因，默认OpenAI格式为length、Anthropic格式为max_tokens；
+	// 配置值只用于其所属格式的请求（如stop只用于OpenAI格式），其他格式使用该格式的默认值
+	StreamTruncateReason string `yaml:"stream_truncate_reason"`
+	// 上游请求重试与退避
+	MaxRetries       int     `yaml:"max_retries"`         // 最大重试次数，0表示不重试
+	RetryBackoff     string  `yaml:"retry_backoff"`       // 退避算法: fixed, exponential（默认）
+	RetryBaseDelayMs int     `yaml:"retry_base_delay_ms"` // 基础延迟（毫秒），默认500
+	RetryMaxDelayMs  int     `yaml:"retry_max_delay_ms"`  // 最大延迟（毫秒），默认10000
+	RetryJitter      float64 `yaml:"retry_jitter"`        // 抖动比例 0~1，实际延迟在 delay*(1±jitter) 之间
+	// MaxFailovers 上游5xx、超时、连接错误或账号不可用时，最多换用同提供商其他账号重试的次数，0使用默认值1，-1表示不切换
+	MaxFailovers int `yaml:"max_failovers,omitempty"`
+	// MaxTokensLimit 请求max_tokens的上限，超过上限时截断后转发，避免上游拒绝过大的值
+	MaxTokensLimit MaxTokensLimitConfig `yaml:"max_tokens_limit,omitempty"`
+	// CircuitBreaker 上游账号熔断：连续错误过多的账号暂停参与选择
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+	// Cache 非流式响应缓存
+	Cache ResponseCacheConfig `yaml:"cache"`
+	// Idempotency 带Idempotency-Key请求头的非流式请求的响应重放缓存
+	Idempotency IdempotencyConfig `yaml:"idempotency,omitempty"`
+	// AsyncTasks 异步模式（Prefer: respond-async）任务的数量上限与结果保留
+	AsyncTasks AsyncTaskConfig `yaml:"async_tasks,omitempty"`
+	// UnknownRolePolicy 消息role不在 system/user/assistant/tool 且无已知映射时的处理策略: passthrough（默认）, reject
+	UnknownRolePolicy string `yaml:"unknown_role_policy"`
+	// JSONRepair 客户端要求JSON输出（response_format）时，尝试去除代码块/多余文本修复为纯JSON
+	JSONRepair bool `yaml:"json_repair"`
+	// SizeStats 请求/响应体积及token数分布统计
+	SizeStats SizeStatsConfig `yaml:"size_stats"`
+	// UserAgent 上游请求的User-Agent，为空时Anthropic使用Claude Code的User-Agent，其他提供商使用LLM-Gateway/1.0
+	UserAgent string `yaml:"user_agent,omitempty"`
+	// 上游连接池，0使用默认值
+	MaxIdleConns        int `yaml:"max_idle_conns,omitempty"`          // 所有上游主机的空闲连接总数，默认100
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host,omitempty"` // 每个上游主机保留的空闲连接数，默认32
+	MaxConnsPerHost     int `yaml:"max_conns_per_host,omitempty"`      // 每个上游主机的最大连接数（含使用中），默认不限制
+}
+
+// SizeStatsConfig - 请求/响应体积及token数分布直方图配置
+type SizeStatsConfig struct {
+	Enabled      bool    `yaml:"enabled"`
+	ByteBuckets  []int64 `yaml:"byte_buckets"`  // 字节数桶上界（升序），未配置时使用默认值
+	TokenBuckets []int64 `yaml:"token_buckets"` // token数桶上界（升序），未配置时使用默认值
+}
+
+// Validate 验证直方图桶上界为严格递增的正数
+func (c *SizeStatsConfig) Validate() error {
+	if !isAscendingBuckets(c.ByteBuckets) {
+		return fmt.Errorf("size_stats.byte_buckets必须为严格递增的正数: %v", c.ByteBuckets)
+	}
+	if !isAscendingBuckets(c.TokenBuckets) {
+		return fmt.Errorf("size_stats.token_buckets必须为严格递增的正数: %v", c.TokenBuckets)
+	}
+	return nil
 }
 
+// isAscendingBuckets 判断桶上界是否为严格递增的正数
+func isAscendingBuckets(buckets []int64) bool {
+	for i, bound := range buckets {
+		if bound <= 0 || (i > 0 && bound <= buckets[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResponseCacheConfig - 响应缓存配置
+// 仅缓存输出可复现的非流式请求：带seed，或temperature为0
+type ResponseCacheConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	TTLSeconds int  `yaml:"ttl_seconds"` // 缓存有效期，默认300秒
+	MaxEntries int  `yaml:"max_entries"` // 最大条目数，默认1000
+}
+
+// MaxTokensLimitConfig - 请求max_tokens上限配置，0或未设置表示不限制
+type MaxTokensLimitConfig struct {
+	Default   int              `yaml:"default,omitempty"`   // 全局上限
+	Providers map[Provider]int `yaml:"providers,omitempty"` // 按提供商覆盖全局上限，如 anthropic: 8192
+}
+
+// LimitFor 返回发往指定提供商的max_tokens上限，提供商级别的配置优先，0表示不限制
+func (c *MaxTokensLimitConfig) LimitFor(provider Provider) int {
+	if limit := c.Providers[provider]; limit > 0 {
+		return limit
+	}
+	return c.Default
+}
+
+// Validate 校验上限不能为负数
+func (c *MaxTokensLimitConfig) Validate() error {
+	if c.Default < 0 {
+		return fmt.Errorf("max_tokens_limit.default不能为负数: %d", c.Default)
+	}
+	for provider, limit := range c.Providers {
+		if limit < 0 {
+			return fmt.Errorf("max_tokens_limit.providers.%s不能为负数: %d", provider, limit)
+		}
+	}
+	return nil
+}
+
+// CircuitBreakerConfig - 上游账号熔断配置
+// 账号连续错误数达到阈值后熔断，冷却期内不参与选择；冷却结束后放行一个探测请求，成功则恢复，失败则重新熔断
+type CircuitBreakerConfig struct {
+	ErrorThreshold  int `yaml:"error_threshold,omitempty"`  // 连续错误阈值，0使用默认值5，-1表示不熔断
+	CooldownSeconds int `yaml:"cooldown_seconds,omitempty"` // 熔断冷却时长，默认30秒
+}
+
+// IdempotencyConfig - 幂等请求配置
+// 客户端携带Idempotency-Key请求头时，同一Gateway Key下相同Idempotency-Key的重试直接返回首次成功的响应
+type IdempotencyConfig struct {
+	TTLSeconds int `yaml:"ttl_seconds,omitempty"` // 响应保留时长，默认3600秒
+	MaxEntries int `yaml:"max_entries,omitempty"` // 最大条目数，默认1000
+}
+
+// AsyncTaskConfig - 异步任务配置
+// 处理中的任务超过上限时以429拒绝新任务；已完成任务超过保留数量时淘汰最早完成的
+type AsyncTaskConfig struct {
+	MaxPendingPerKey int `yaml:"max_pending_per_key,omitempty"` // 每个Gateway Key处理中的任务数上限，默认10
+	MaxPending       int `yaml:"max_pending,omitempty"`         // 所有Key处理中的任务总数上限，默认100
+	MaxResults       int `yaml:"max_results,omitempty"`         // 保留的已完成任务数上限，默认1000
+	RetentionSeconds int `yaml:"retention_seconds,omitempty"`   // 已完成任务的保留时长，默认3600秒
+}
+
+// 请求跟踪日志的脱敏级别
+const (
+	TraceRedactionFull     = "full"     // 全记录（默认）
+	TraceRedactionPII      = "pii"      // 脱敏PII（邮箱、手机号、卡号、密钥等）
+	TraceRedactionMetadata = "metadata" // 只记录请求结构与元数据，不记录内容
+)
+
 // LoggingConfig - 日志配置
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
 	File   string `yaml:"file"`
+	// TraceRedaction 调试trace中请求/响应内容的脱敏级别: full（默认）, pii, metadata
+	TraceRedaction string `yaml:"trace_redaction"`
 }
 
 // EnvironmentConfig - 环境变量配置
@@ -47,4 +267,62 @@ type EnvironmentConfig struct {
 	HTTPProxy  string `yaml:"http_proxy"`
 	HTTPSProxy string `yaml:"https_proxy"`
 	NoProxy    string `yaml:"no_proxy"`
+	// Extra 额外的环境变量（如ALL_PROXY、SSL_CERT_FILE），启动时与代理变量一同设置
+	Extra map[string]string `yaml:"extra,omitempty"`
+}
+
+// builtinEnvNames 已由EnvironmentConfig单独建模的环境变量，不能通过Extra设置
+var builtinEnvNames = map[string]bool{
+	"HTTP_PROXY":  true,
+	"HTTPS_PROXY": true,
+	"NO_PROXY":    true,
+}
+
+// ValidateEnvName 校验额外环境变量名：由字母、数字和下划线组成且不以数字开头，
+// 不能是http_proxy、https_proxy、no_proxy（使用对应的专用配置项）
+func ValidateEnvName(name string) error {
+	if name == "" {
+		return fmt.Errorf("环境变量名不能为空")
+	}
+	for i, ch := range name {
+		isLetter := ch == '_' || (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z')
+		if !isLetter && (i == 0 || ch < '0' || ch > '9') {
+			return fmt.Errorf("无效的环境变量名: %s (只能包含字母、数字和下划线，且不能以数字开头)", name)
+		}
+	}
+	if builtinEnvNames[strings.ToUpper(name)] {
+		return fmt.Errorf("环境变量 %s 请使用专用配置项设置", name)
+	}
+	return nil
+}
+
+// Validate 校验额外环境变量名
+func (e *EnvironmentConfig) Validate() error {
+	for name := range e.Extra {
+		if err := ValidateEnvName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RateLimitBackendConfig - 限流/配额计数后端配置
+type RateLimitBackendConfig struct {
+	Backend       string `yaml:"backend"`        // memory（默认）或 redis
+	RedisAddr     string `yaml:"redis_addr"`     // 如 127.0.0.1:6379
+	RedisPassword string `yaml:"redis_password"` // 可选
+	RedisDB       int    `yaml:"redis_db"`
+	KeyPrefix     string `yaml:"key_prefix"` // 计数key前缀，多套Gateway共用Redis时区分
+}
+
+// ModerationConfig - 请求内容安全预检配置（默认关闭）
+type ModerationConfig struct {
+	Enabled         bool     `yaml:"enabled"`
+	Backend         string   `yaml:"backend"`          // keywords（默认，本地关键词规则）或 openai
+	Action          string   `yaml:"action"`           // reject（默认，命中拒绝）或 log（仅记录）
+	FailOpen        bool     `yaml:"fail_open"`        // 审核后端出错时是否放行
+	BlockedKeywords []string `yaml:"blocked_keywords"` // keywords 后端的屏蔽词
+	OpenAIAPIKey    string   `yaml:"openai_api_key"`
+	OpenAIBaseURL   string   `yaml:"openai_base_url"`
+	Model           string   `yaml:"model"` // openai 后端使用的审核模型
 }
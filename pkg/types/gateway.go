@@ -4,17 +4,43 @@ import "time"
 
 // GatewayAPIKey - Gateway API Key结构 (用于客户端访问Gateway)
 type GatewayAPIKey struct {
-	ID          string           `json:"id" yaml:"id"`
-	Name        string           `json:"name" yaml:"name"`
-	KeyHash     string           `json:"key_hash" yaml:"key_hash"`
-	Permissions []Permission     `json:"permissions" yaml:"permissions"`
-	Status      string           `json:"status" yaml:"status"` // active, disabled
-	RateLimit   *RateLimitConfig `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	ID          string            `json:"id" yaml:"id"`
+	Name        string            `json:"name" yaml:"name"`
+	KeyHash     string            `json:"key_hash" yaml:"key_hash"`
+	Permissions []Permission      `json:"permissions" yaml:"permissions"`
+	Status      string            `json:"status" yaml:"status"` // active, disabled
+	RateLimit   *RateLimitConfig  `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
 	ModelRoutes *ModelRouteConfig `json:"model_routes,omitempty" yaml:"model_routes,omitempty"`
-	Usage       *KeyUsageStats   `json:"usage,omitempty" yaml:"usage,omitempty"`
-	CreatedAt   time.Time        `json:"created_at" yaml:"created_at"`
-	UpdatedAt   time.Time        `json:"updated_at" yaml:"updated_at"`
-	ExpiresAt   *time.Time       `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	Usage       *KeyUsageStats    `json:"usage,omitempty" yaml:"usage,omitempty"`
+	// PriceMultiplier 价格系数：<1 为折扣，>1 为加价，未设置时按 1 计算
+	PriceMultiplier float64    `json:"price_multiplier,omitempty" yaml:"price_multiplier,omitempty"`
+	CreatedAt       time.Time  `json:"created_at" yaml:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" yaml:"updated_at"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	// AccessWindows 可用时间窗口，为空表示不限制，配置多个时命中任一即可
+	AccessWindows []AccessWindow `json:"access_windows,omitempty" yaml:"access_windows,omitempty"`
+	// Tenant 所属租户，请求只会路由到同租户的上游账号，为空表示默认租户
+	Tenant string `json:"tenant,omitempty" yaml:"tenant,omitempty"`
+	// RequestTimeoutSeconds 上游请求超时（秒），设置后替换全局的stream_timeout，0表示使用全局配置
+	RequestTimeoutSeconds int `json:"request_timeout_seconds,omitempty" yaml:"request_timeout_seconds,omitempty"`
+}
+
+// IsExpired 判断Key是否已过期（未设置过期时间视为永不过期）
+func (k *GatewayAPIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// IsActive 判断Key是否处于可用状态：状态为active且未过期
+func (k *GatewayAPIKey) IsActive(now time.Time) bool {
+	return k.Status == "active" && !k.IsExpired(now)
+}
+
+// RequestTimeout 获取Key级别的上游请求超时，未设置时返回0
+func (k *GatewayAPIKey) RequestTimeout() time.Duration {
+	if k == nil || k.RequestTimeoutSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(k.RequestTimeoutSeconds) * time.Second
 }
 
 // RateLimitConfig - 限流配置
@@ -22,9 +48,10 @@ type RateLimitConfig struct {
 	RequestsPerMinute int `json:"requests_per_minute" yaml:"requests_per_minute"`
 	RequestsPerHour   int `json:"requests_per_hour" yaml:"requests_per_hour"`
 	RequestsPerDay    int `json:"requests_per_day" yaml:"requests_per_day"`
+	// MaxConcurrentStreams 同时进行中的流式请求上限，超出时拒绝新的流式请求，0表示不限制
+	MaxConcurrentStreams int `json:"max_concurrent_streams,omitempty" yaml:"max_concurrent_streams,omitempty"`
 }
 
-
 // KeyUsageStats - Gateway API Key使用统计
 type KeyUsageStats struct {
 	TotalRequests      int64      `json:"total_requests" yaml:"total_requests"`
@@ -33,4 +60,15 @@ type KeyUsageStats struct {
 	LastUsedAt         time.Time  `json:"last_used_at" yaml:"last_used_at"`
 	LastErrorAt        *time.Time `json:"last_error_at,omitempty" yaml:"last_error_at,omitempty"`
 	AvgLatency         float64    `json:"avg_latency_ms" yaml:"avg_latency_ms"`
+	InputTokens        int64      `json:"input_tokens" yaml:"input_tokens"`
+	OutputTokens       int64      `json:"output_tokens" yaml:"output_tokens"`
+	TotalCost          float64    `json:"total_cost" yaml:"total_cost"` // 已按价格系数计算后的成本
+}
+
+// EffectivePriceMultiplier 获取生效的价格系数
+func (k *GatewayAPIKey) EffectivePriceMultiplier() float64 {
+	if k == nil || k.PriceMultiplier <= 0 {
+		return 1
+	}
+	return k.PriceMultiplier
 }
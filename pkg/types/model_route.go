@@ -18,6 +18,12 @@ type ModelRouteContext struct {
 
 	// Enabled 是否启用模型替换
 	Enabled bool
+
+	// Rejected 未匹配任何路由且默认行为为 reject，请求应被拒绝
+	Rejected bool
+
+	// Rewrite 命中的规则只改写模型名：TargetProvider为空时提供商仍按原始模型名确定
+	Rewrite bool
 }
 
 // HasModelRoute 检查是否需要进行模型替换
@@ -39,6 +45,10 @@ type ModelRoute struct {
 	// TargetProvider 目标提供商
 	TargetProvider Provider `yaml:"target_provider" json:"target_provider"`
 
+	// RewriteModel 改写后的模型名，设置后优先于TargetModel；未设置TargetProvider时不改变提供商选择，
+	// 用于在同一提供商上将模型别名改写为实际模型（如 gpt-4 -> claude-3-5-sonnet）
+	RewriteModel string `yaml:"rewrite_model,omitempty" json:"rewrite_model,omitempty"`
+
 	// Priority 路由优先级，数字越小优先级越高
 	Priority int `yaml:"priority" json:"priority"`
 
@@ -57,6 +67,22 @@ func (route *ModelRoute) Matches(model string) bool {
 	return matchPattern(route.SourceModel, model)
 }
 
+// context 为命中此规则的模型创建路由上下文
+func (route *ModelRoute) context(originalModel string) *ModelRouteContext {
+	ctx := &ModelRouteContext{
+		OriginalModel:  originalModel,
+		TargetModel:    route.TargetModel,
+		TargetProvider: route.TargetProvider,
+		RouteRuleID:    route.ID,
+		Enabled:        true,
+	}
+	if route.RewriteModel != "" {
+		ctx.TargetModel = route.RewriteModel
+		ctx.Rewrite = true
+	}
+	return ctx
+}
+
 // matchPattern 安全的通配符匹配，带输入验证
 func matchPattern(pattern, str string) bool {
 	// 输入验证
@@ -92,17 +118,54 @@ func matchPattern(pattern, str string) bool {
 	return false
 }
 
+// 未匹配路由时的默认行为
+const (
+	DefaultBehaviorPassthrough  = "passthrough"   // 原样透传
+	DefaultBehaviorReject       = "reject"        // 拒绝请求
+	DefaultBehaviorDefaultRoute = "default_route" // 路由到指定的默认目标
+)
+
+// DefaultRouteRuleID 默认路由在上下文中使用的规则ID
+const DefaultRouteRuleID = "default_route"
+
+// ModelAliasRuleID 仅补全模型别名（未匹配路由规则）时在上下文中使用的规则ID
+const ModelAliasRuleID = "model_alias"
+
+// DefaultRouteTarget 默认路由目标
+type DefaultRouteTarget struct {
+	// TargetModel 目标模型名
+	TargetModel string `yaml:"target_model" json:"target_model"`
+
+	// TargetProvider 目标提供商
+	TargetProvider Provider `yaml:"target_provider" json:"target_provider"`
+}
+
 // ModelRouteConfig 模型路由配置
 type ModelRouteConfig struct {
 	// Routes 路由规则列表
 	Routes []ModelRoute `yaml:"routes" json:"routes"`
 
-	// DefaultBehavior 默认行为：passthrough（透传）或 reject（拒绝）
+	// DefaultBehavior 默认行为：passthrough（透传）、reject（拒绝）或 default_route（路由到默认目标）
 	DefaultBehavior string `yaml:"default_behavior" json:"default_behavior"`
 
+	// DefaultRoute 默认行为为 default_route 时的目标
+	DefaultRoute *DefaultRouteTarget `yaml:"default_route,omitempty" json:"default_route,omitempty"`
+
 	// EnableLogging 是否启用路由日志
 	EnableLogging bool `yaml:"enable_logging" json:"enable_logging"`
 
+	// ModelAliases 模型别名到完整版本的映射（如 claude-3-5-sonnet -> claude-3-5-sonnet-20241022），在匹配路由前补全
+	ModelAliases map[string]string `yaml:"model_aliases,omitempty" json:"model_aliases,omitempty"`
+
+	// AllowedModels 允许使用的模型（支持通配符），为空表示不限制
+	AllowedModels []string `yaml:"allowed_models,omitempty" json:"allowed_models,omitempty"`
+
+	// DeniedModels 禁止使用的模型（支持通配符），优先于AllowedModels
+	DeniedModels []string `yaml:"denied_models,omitempty" json:"denied_models,omitempty"`
+
+	// FallbackModel 回退模型：请求的模型没有可用上游时改用此模型重新路由一次，为空表示不回退
+	FallbackModel string `yaml:"fallback_model,omitempty" json:"fallback_model,omitempty"`
+
 	// 内部优化索引（不序列化）
 	exactMatches   map[string]*ModelRoute `yaml:"-" json:"-"`
 	prefixMatches  []*prefixEntry         `yaml:"-" json:"-"`
@@ -213,18 +276,13 @@ func (config *ModelRouteConfig) CreateContext(originalModel string) *ModelRouteC
 		return nil
 	}
 
-	route := config.FindRoute(originalModel)
+	model := config.ResolveAlias(originalModel)
+	route := config.FindRoute(model)
 	if route == nil {
-		return nil
+		return config.unmatchedContext(originalModel, model)
 	}
 
-	return &ModelRouteContext{
-		OriginalModel:  originalModel,
-		TargetModel:    route.TargetModel,
-		TargetProvider: route.TargetProvider,
-		RouteRuleID:    route.ID,
-		Enabled:        true,
-	}
+	return route.context(originalModel)
 }
 
 // CreateContextWithKey 根据 GatewayKey 和全局配置创建模型路由上下文
@@ -256,22 +314,141 @@ func (config *ModelRouteConfig) CreateContextWithKey(originalModel string, gatew
 		}
 	}
 	
-	// 3. 在合并的规则中查找匹配的路由
+	// 3. 补全模型别名后在合并的规则中查找匹配的路由
+	model := resolveModelAlias(originalModel, gatewayKey, config)
 	for _, route := range mergedRoutes {
-		if route.Matches(originalModel) {
-			return &ModelRouteContext{
-				OriginalModel:  originalModel,
-				TargetModel:    route.TargetModel,
-				TargetProvider: route.TargetProvider,
-				RouteRuleID:    route.ID,
-				Enabled:        true,
-			}
+		if route.Matches(model) {
+			return route.context(originalModel)
+		}
+	}
+
+	// 4. 未匹配时应用默认行为：Key级别显式配置优先，否则使用全局配置
+	if gatewayKey != nil && gatewayKey.ModelRoutes != nil && gatewayKey.ModelRoutes.DefaultBehavior != "" {
+		return gatewayKey.ModelRoutes.unmatchedContext(originalModel, model)
+	}
+	return config.unmatchedContext(originalModel, model)
+}
+
+// ResolveAlias 将模型别名补全为完整版本，未配置别名时原样返回
+func (config *ModelRouteConfig) ResolveAlias(model string) string {
+	if config == nil {
+		return model
+	}
+	if target, ok := config.ModelAliases[model]; ok {
+		return target
+	}
+	return model
+}
+
+// resolveModelAlias 按Key级别优先、全局次之的顺序补全模型别名
+func resolveModelAlias(model string, gatewayKey *GatewayAPIKey, config *ModelRouteConfig) string {
+	if gatewayKey != nil && gatewayKey.ModelRoutes != nil {
+		if target, ok := gatewayKey.ModelRoutes.ModelAliases[model]; ok {
+			return target
 		}
 	}
+	return config.ResolveAlias(model)
+}
+
+// CheckModelAccessWithKey 按全局和Key级别的允许/禁止列表检查模型是否可用，
+// 别名补全前后的模型名都参与检查，避免通过别名绕过限制
+func (config *ModelRouteConfig) CheckModelAccessWithKey(model string, gatewayKey *GatewayAPIKey) error {
+	models := []string{model}
+	if resolved := resolveModelAlias(model, gatewayKey, config); resolved != model {
+		models = append(models, resolved)
+	}
 
+	if err := config.checkModelAccess(models); err != nil {
+		return err
+	}
+	if gatewayKey != nil {
+		return gatewayKey.ModelRoutes.checkModelAccess(models)
+	}
 	return nil
 }
 
+// checkModelAccess 任一名称命中禁止列表即拒绝；配置了允许列表时，任一名称命中即可
+func (config *ModelRouteConfig) checkModelAccess(models []string) error {
+	if config == nil {
+		return nil
+	}
+
+	for _, model := range models {
+		for _, pattern := range config.DeniedModels {
+			if matchPattern(pattern, model) {
+				return fmt.Errorf("model %s is denied (matches denied_models pattern %q)", model, pattern)
+			}
+		}
+	}
+
+	if len(config.AllowedModels) == 0 {
+		return nil
+	}
+	for _, model := range models {
+		for _, pattern := range config.AllowedModels {
+			if matchPattern(pattern, model) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("model %s is not in allowed_models", models[0])
+}
+
+// FallbackModelWithKey 获取生效的回退模型，Key级别配置优先于全局配置
+func (config *ModelRouteConfig) FallbackModelWithKey(gatewayKey *GatewayAPIKey) string {
+	if gatewayKey != nil && gatewayKey.ModelRoutes != nil && gatewayKey.ModelRoutes.FallbackModel != "" {
+		return gatewayKey.ModelRoutes.FallbackModel
+	}
+	if config == nil {
+		return ""
+	}
+	return config.FallbackModel
+}
+
+// unmatchedContext 为未匹配路由的模型创建上下文；透传时若别名已补全，仍需将请求模型替换为完整版本
+func (config *ModelRouteConfig) unmatchedContext(originalModel, resolvedModel string) *ModelRouteContext {
+	if ctx := config.defaultContext(originalModel); ctx != nil {
+		return ctx
+	}
+	if resolvedModel == originalModel {
+		return nil
+	}
+	return &ModelRouteContext{
+		OriginalModel: originalModel,
+		TargetModel:   resolvedModel,
+		RouteRuleID:   ModelAliasRuleID,
+		Enabled:       true,
+	}
+}
+
+// defaultContext 根据默认行为为未匹配路由的模型创建上下文，passthrough 返回nil
+func (config *ModelRouteConfig) defaultContext(originalModel string) *ModelRouteContext {
+	if config == nil {
+		return nil
+	}
+
+	switch config.DefaultBehavior {
+	case DefaultBehaviorReject:
+		return &ModelRouteContext{
+			OriginalModel: originalModel,
+			Rejected:      true,
+		}
+	case DefaultBehaviorDefaultRoute:
+		if config.DefaultRoute == nil {
+			return nil
+		}
+		return &ModelRouteContext{
+			OriginalModel:  originalModel,
+			TargetModel:    config.DefaultRoute.TargetModel,
+			TargetProvider: config.DefaultRoute.TargetProvider,
+			RouteRuleID:    DefaultRouteRuleID,
+			Enabled:        true,
+		}
+	default:
+		return nil
+	}
+}
+
 // Validate 验证模型路由配置的完整性
 func (config *ModelRouteConfig) Validate() error {
 	if config == nil {
@@ -280,10 +457,30 @@ func (config *ModelRouteConfig) Validate() error {
 
 	// 验证默认行为
 	switch config.DefaultBehavior {
-	case "", "passthrough", "reject":
+	case "", DefaultBehaviorPassthrough, DefaultBehaviorReject:
 		// 有效值
+	case DefaultBehaviorDefaultRoute:
+		if config.DefaultRoute == nil || config.DefaultRoute.TargetModel == "" {
+			return fmt.Errorf("默认行为为 default_route 时必须配置默认目标模型")
+		}
+		if !isRoutableProvider(config.DefaultRoute.TargetProvider) {
+			return fmt.Errorf("不支持的默认路由提供商: %s", config.DefaultRoute.TargetProvider)
+		}
 	default:
-		return fmt.Errorf("无效的默认行为: %s，必须是 passthrough 或 reject", config.DefaultBehavior)
+		return fmt.Errorf("无效的默认行为: %s，必须是 passthrough、reject 或 default_route", config.DefaultBehavior)
+	}
+
+	// 验证模型别名：不允许空名称、自映射和链式别名
+	for alias, target := range config.ModelAliases {
+		if alias == "" || target == "" {
+			return fmt.Errorf("模型别名及其目标不能为空: %q -> %q", alias, target)
+		}
+		if alias == target {
+			return fmt.Errorf("模型别名不能映射到自身: %s", alias)
+		}
+		if _, chained := config.ModelAliases[target]; chained {
+			return fmt.Errorf("模型别名 %s 的目标 %s 本身也是别名，不支持链式别名", alias, target)
+		}
 	}
 
 	// 验证路由规则
@@ -322,8 +519,8 @@ func (route *ModelRoute) validate() error {
 		return fmt.Errorf("源模型不能为空")
 	}
 
-	if route.TargetModel == "" {
-		return fmt.Errorf("目标模型不能为空")
+	if route.TargetModel == "" && route.RewriteModel == "" {
+		return fmt.Errorf("目标模型和改写模型不能同时为空")
 	}
 
 	// 验证模型名长度
@@ -335,18 +532,32 @@ func (route *ModelRoute) validate() error {
 		return fmt.Errorf("目标模型名称过长 (>200字符): %s", route.TargetModel)
 	}
 
+	if len(route.RewriteModel) > 200 {
+		return fmt.Errorf("改写模型名称过长 (>200字符): %s", route.RewriteModel)
+	}
+
 	// 验证优先级范围
 	if route.Priority < 0 {
 		return fmt.Errorf("优先级不能为负数: %d", route.Priority)
 	}
 
-	// 验证提供商
-	switch route.TargetProvider {
-	case ProviderOpenAI, ProviderAnthropic, ProviderQwen:
-		// 有效提供商
-	default:
+	// 验证提供商（只改写模型名的规则可以不指定提供商）
+	if route.RewriteModel != "" && route.TargetProvider == "" {
+		return nil
+	}
+	if !isRoutableProvider(route.TargetProvider) {
 		return fmt.Errorf("不支持的目标提供商: %s", route.TargetProvider)
 	}
 
 	return nil
 }
+
+// isRoutableProvider 检查提供商是否可作为路由目标
+func isRoutableProvider(provider Provider) bool {
+	switch provider {
+	case ProviderOpenAI, ProviderAnthropic, ProviderQwen:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,308 @@
+package types
+
+import "testing"
+
+func TestModelRouteConfig_DefaultBehavior(t *testing.T) {
+	routes := []ModelRoute{
+		{ID: "r1", SourceModel: "gpt-4*", TargetModel: "claude-3-5-sonnet", TargetProvider: ProviderAnthropic, Enabled: true},
+	}
+
+	tests := []struct {
+		name         string
+		config       *ModelRouteConfig
+		model        string
+		wantNil      bool
+		wantRejected bool
+		wantTarget   string
+		wantRuleID   string
+	}{
+		{
+			name:       "匹配路由不受默认行为影响",
+			config:     &ModelRouteConfig{Routes: routes, DefaultBehavior: DefaultBehaviorReject},
+			model:      "gpt-4o",
+			wantTarget: "claude-3-5-sonnet",
+			wantRuleID: "r1",
+		},
+		{
+			name:    "未配置默认行为时透传",
+			config:  &ModelRouteConfig{Routes: routes},
+			model:   "qwen-max",
+			wantNil: true,
+		},
+		{
+			name:    "passthrough",
+			config:  &ModelRouteConfig{Routes: routes, DefaultBehavior: DefaultBehaviorPassthrough},
+			model:   "qwen-max",
+			wantNil: true,
+		},
+		{
+			name:         "reject",
+			config:       &ModelRouteConfig{Routes: routes, DefaultBehavior: DefaultBehaviorReject},
+			model:        "qwen-max",
+			wantRejected: true,
+		},
+		{
+			name: "default_route",
+			config: &ModelRouteConfig{
+				Routes:          routes,
+				DefaultBehavior: DefaultBehaviorDefaultRoute,
+				DefaultRoute:    &DefaultRouteTarget{TargetModel: "qwen-plus", TargetProvider: ProviderQwen},
+			},
+			model:      "unknown-model",
+			wantTarget: "qwen-plus",
+			wantRuleID: DefaultRouteRuleID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			for _, ctx := range []*ModelRouteContext{
+				tt.config.CreateContext(tt.model),
+				tt.config.CreateContextWithKey(tt.model, nil),
+			} {
+				if tt.wantNil {
+					if ctx != nil {
+						t.Errorf("context = %+v, want nil", ctx)
+					}
+					continue
+				}
+				if ctx == nil {
+					t.Fatal("context = nil")
+				}
+				if ctx.Rejected != tt.wantRejected {
+					t.Errorf("Rejected = %v, want %v", ctx.Rejected, tt.wantRejected)
+				}
+				if ctx.TargetModel != tt.wantTarget || ctx.RouteRuleID != tt.wantRuleID {
+					t.Errorf("target = %s/%s, want %s/%s", ctx.TargetModel, ctx.RouteRuleID, tt.wantTarget, tt.wantRuleID)
+				}
+			}
+		})
+	}
+}
+
+func TestModelRouteConfig_KeyDefaultBehaviorOverridesGlobal(t *testing.T) {
+	global := &ModelRouteConfig{DefaultBehavior: DefaultBehaviorPassthrough}
+	key := &GatewayAPIKey{
+		ModelRoutes: &ModelRouteConfig{DefaultBehavior: DefaultBehaviorReject},
+	}
+
+	ctx := global.CreateContextWithKey("gpt-4o", key)
+	if ctx == nil || !ctx.Rejected {
+		t.Errorf("Key级别 reject 应覆盖全局 passthrough, got %+v", ctx)
+	}
+
+	// Key未显式配置默认行为时沿用全局配置
+	global.DefaultBehavior = DefaultBehaviorReject
+	key.ModelRoutes.DefaultBehavior = ""
+	ctx = global.CreateContextWithKey("gpt-4o", key)
+	if ctx == nil || !ctx.Rejected {
+		t.Errorf("应沿用全局 reject, got %+v", ctx)
+	}
+}
+
+func TestModelRouteConfig_ValidateDefaultRoute(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *ModelRouteConfig
+		wantErr bool
+	}{
+		{"缺少默认目标", &ModelRouteConfig{DefaultBehavior: DefaultBehaviorDefaultRoute}, true},
+		{"默认目标提供商无效", &ModelRouteConfig{
+			DefaultBehavior: DefaultBehaviorDefaultRoute,
+			DefaultRoute:    &DefaultRouteTarget{TargetModel: "x", TargetProvider: "unknown"},
+		}, true},
+		{"未知默认行为", &ModelRouteConfig{DefaultBehavior: "fallback"}, true},
+		{"合法默认路由", &ModelRouteConfig{
+			DefaultBehavior: DefaultBehaviorDefaultRoute,
+			DefaultRoute:    &DefaultRouteTarget{TargetModel: "gpt-4o", TargetProvider: ProviderOpenAI},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModelRouteConfig_ModelAliases(t *testing.T) {
+	global := &ModelRouteConfig{
+		Routes: []ModelRoute{
+			{ID: "sonnet", SourceModel: "claude-3-5-sonnet-20241022", TargetModel: "claude-3-5-sonnet-20241022", TargetProvider: ProviderAnthropic, Enabled: true},
+		},
+		ModelAliases: map[string]string{
+			"claude-3-5-sonnet": "claude-3-5-sonnet-20241022",
+			"claude-3-5-haiku":  "claude-3-5-haiku-20241022",
+		},
+	}
+
+	// 别名补全后匹配路由规则，上下文保留客户端原始模型名
+	ctx := global.CreateContextWithKey("claude-3-5-sonnet", nil)
+	if ctx == nil || ctx.RouteRuleID != "sonnet" || ctx.OriginalModel != "claude-3-5-sonnet" || ctx.TargetModel != "claude-3-5-sonnet-20241022" {
+		t.Errorf("别名应补全后匹配路由, got %+v", ctx)
+	}
+
+	// 未匹配路由时仍替换为完整版本
+	ctx = global.CreateContextWithKey("claude-3-5-haiku", nil)
+	if ctx == nil || !ctx.HasModelRoute() || ctx.TargetModel != "claude-3-5-haiku-20241022" || ctx.RouteRuleID != ModelAliasRuleID {
+		t.Errorf("透传时应补全别名, got %+v", ctx)
+	}
+
+	// 非别名且未匹配时透传
+	if ctx = global.CreateContextWithKey("gpt-4o", nil); ctx != nil {
+		t.Errorf("非别名模型应透传, got %+v", ctx)
+	}
+
+	// Key级别别名优先
+	key := &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{
+		ModelAliases: map[string]string{"claude-3-5-haiku": "claude-3-5-haiku-latest"},
+	}}
+	ctx = global.CreateContextWithKey("claude-3-5-haiku", key)
+	if ctx == nil || ctx.TargetModel != "claude-3-5-haiku-latest" {
+		t.Errorf("Key级别别名应优先, got %+v", ctx)
+	}
+
+	// reject 默认行为下，补全后的模型仍需匹配路由
+	global.DefaultBehavior = DefaultBehaviorReject
+	if ctx = global.CreateContextWithKey("claude-3-5-haiku", nil); ctx == nil || !ctx.Rejected {
+		t.Errorf("未匹配路由应被拒绝, got %+v", ctx)
+	}
+}
+
+func TestModelRouteConfig_ValidateModelAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		wantErr bool
+	}{
+		{"合法别名", map[string]string{"claude-3-5-sonnet": "claude-3-5-sonnet-20241022"}, false},
+		{"目标为空", map[string]string{"claude-3-5-sonnet": ""}, true},
+		{"映射到自身", map[string]string{"gpt-4o": "gpt-4o"}, true},
+		{"链式别名", map[string]string{"sonnet": "claude-3-5-sonnet", "claude-3-5-sonnet": "claude-3-5-sonnet-20241022"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &ModelRouteConfig{ModelAliases: tt.aliases}
+			if err := config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModelRouteConfig_ModelAccessLists(t *testing.T) {
+	global := &ModelRouteConfig{
+		ModelAliases: map[string]string{"sonnet": "claude-3-5-sonnet-20241022"},
+	}
+
+	tests := []struct {
+		name    string
+		key     *GatewayAPIKey
+		model   string
+		allowed bool
+	}{
+		{"未配置列表不限制", &GatewayAPIKey{}, "gpt-4o", true},
+		{"仅允许列表-命中", &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{AllowedModels: []string{"gpt-4o-mini", "claude-*"}}}, "claude-3-5-haiku", true},
+		{"仅允许列表-未命中", &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{AllowedModels: []string{"gpt-4o-mini", "claude-*"}}}, "gpt-4o", false},
+		{"仅禁止列表-命中", &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{DeniedModels: []string{"gpt-4*"}}}, "gpt-4o", false},
+		{"仅禁止列表-未命中", &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{DeniedModels: []string{"gpt-4*"}}}, "claude-3-5-haiku", true},
+		{"禁止优先于允许", &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{AllowedModels: []string{"*"}, DeniedModels: []string{"o1"}}}, "o1", false},
+		{"别名补全后命中禁止列表", &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{DeniedModels: []string{"claude-3-5-sonnet-20241022"}}}, "sonnet", false},
+		{"别名补全后命中允许列表", &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{AllowedModels: []string{"claude-3-5-sonnet-*"}}}, "sonnet", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := global.CheckModelAccessWithKey(tt.model, tt.key)
+			if (err == nil) != tt.allowed {
+				t.Errorf("CheckModelAccessWithKey(%q) error = %v, allowed want %v", tt.model, err, tt.allowed)
+			}
+		})
+	}
+
+	// 全局禁止列表对所有Key生效，nil配置不限制
+	global.DeniedModels = []string{"gpt-3.5*"}
+	if err := global.CheckModelAccessWithKey("gpt-3.5-turbo", nil); err == nil {
+		t.Error("全局禁止列表应生效")
+	}
+	var nilConfig *ModelRouteConfig
+	if err := nilConfig.CheckModelAccessWithKey("gpt-4o", nil); err != nil {
+		t.Errorf("nil配置不应限制, got %v", err)
+	}
+}
+
+func TestModelRouteConfig_RewriteModel(t *testing.T) {
+	config := &ModelRouteConfig{
+		Routes: []ModelRoute{
+			{ID: "rewrite", SourceModel: "gpt-4", RewriteModel: "claude-3-5-sonnet", Enabled: true},
+			{ID: "rewrite-provider", SourceModel: "gpt-3.5*", RewriteModel: "claude-3-haiku", TargetProvider: ProviderAnthropic, Enabled: true},
+			{ID: "rewrite-over-target", SourceModel: "o1", TargetModel: "claude-3-opus", RewriteModel: "claude-3-7-sonnet", TargetProvider: ProviderAnthropic, Enabled: true},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		model        string
+		wantTarget   string
+		wantProvider Provider
+	}{
+		{"只改写模型名不指定提供商", "gpt-4", "claude-3-5-sonnet", ""},
+		{"改写模型名并切换提供商", "gpt-3.5-turbo", "claude-3-haiku", ProviderAnthropic},
+		{"改写模型名优先于目标模型", "o1", "claude-3-7-sonnet", ProviderAnthropic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, ctx := range []*ModelRouteContext{config.CreateContext(tt.model), config.CreateContextWithKey(tt.model, nil)} {
+				if ctx == nil || !ctx.Rewrite || !ctx.HasModelRoute() {
+					t.Fatalf("上下文 = %+v, want 改写模型", ctx)
+				}
+				if ctx.TargetModel != tt.wantTarget || ctx.TargetProvider != tt.wantProvider {
+					t.Errorf("TargetModel = %s, TargetProvider = %q, want %s, %q", ctx.TargetModel, ctx.TargetProvider, tt.wantTarget, tt.wantProvider)
+				}
+			}
+		})
+	}
+
+	invalid := []ModelRoute{
+		{ID: "no-target", SourceModel: "gpt-4", Enabled: true},
+		{ID: "no-provider", SourceModel: "gpt-4", TargetModel: "claude-3-5-sonnet", Enabled: true},
+		{ID: "bad-provider", SourceModel: "gpt-4", RewriteModel: "claude-3-5-sonnet", TargetProvider: "unknown", Enabled: true},
+	}
+	for _, route := range invalid {
+		if err := (&ModelRouteConfig{Routes: []ModelRoute{route}}).Validate(); err == nil {
+			t.Errorf("路由规则 %s 应校验失败", route.ID)
+		}
+	}
+}
+
+func TestModelRouteConfig_FallbackModelWithKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		global *ModelRouteConfig
+		key    *GatewayAPIKey
+		want   string
+	}{
+		{"未配置", nil, nil, ""},
+		{"全局配置", &ModelRouteConfig{FallbackModel: "gpt-4o-mini"}, nil, "gpt-4o-mini"},
+		{"Key级别优先", &ModelRouteConfig{FallbackModel: "gpt-4o-mini"}, &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{FallbackModel: "claude-3-haiku"}}, "claude-3-haiku"},
+		{"Key未配置时沿用全局", &ModelRouteConfig{FallbackModel: "gpt-4o-mini"}, &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{}}, "gpt-4o-mini"},
+		{"只有Key级别配置", nil, &GatewayAPIKey{ModelRoutes: &ModelRouteConfig{FallbackModel: "claude-3-haiku"}}, "claude-3-haiku"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.global.FallbackModelWithKey(tt.key); got != tt.want {
+				t.Errorf("FallbackModelWithKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,14 +2,18 @@ package types
 
 // OpenAIRequest - OpenAI API请求格式
 type OpenAIRequest struct {
-	Model       string                   `json:"model"`
-	Messages    []Message                `json:"messages"`
-	MaxTokens   int                      `json:"max_tokens,omitempty"`
-	Temperature float64                  `json:"temperature,omitempty"`
-	Stream      *bool                    `json:"stream,omitempty"`
-	TopP        *float64                 `json:"top_p,omitempty"`
-	Tools       []map[string]interface{} `json:"tools,omitempty"`
-	ToolChoice  interface{}              `json:"tool_choice,omitempty"`
+	Model          string                   `json:"model"`
+	Messages       []Message                `json:"messages"`
+	MaxTokens      int                      `json:"max_tokens,omitempty"`
+	Temperature    *float64                 `json:"temperature,omitempty"`
+	Stream         *bool                    `json:"stream,omitempty"`
+	TopP           *float64                 `json:"top_p,omitempty"`
+	Tools          []map[string]interface{} `json:"tools,omitempty"`
+	ToolChoice     interface{}              `json:"tool_choice,omitempty"`
+	Seed           *int64                   `json:"seed,omitempty"`
+	Stop           StopSequences            `json:"stop,omitempty"`
+	N              *int                     `json:"n,omitempty"`
+	ResponseFormat map[string]interface{}   `json:"response_format,omitempty"`
 }
 
 // OpenAI 响应结构体
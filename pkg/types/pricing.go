@@ -0,0 +1,62 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ModelPricing - 模型定价（价格单位：每百万token）
+type ModelPricing struct {
+	Model       string  `json:"model" yaml:"model"`               // 模型名称，以 * 结尾表示前缀匹配
+	InputPrice  float64 `json:"input_price" yaml:"input_price"`   // 输入token价格
+	OutputPrice float64 `json:"output_price" yaml:"output_price"` // 输出token价格
+}
+
+// PricingConfig - 定价表配置
+type PricingConfig struct {
+	Currency string         `json:"currency,omitempty" yaml:"currency,omitempty"`
+	Models   []ModelPricing `json:"models,omitempty" yaml:"models,omitempty"`
+}
+
+// FindPricing 查找模型定价，精确匹配优先，其次最长前缀匹配
+func (c *PricingConfig) FindPricing(model string) *ModelPricing {
+	if c == nil {
+		return nil
+	}
+
+	var best *ModelPricing
+	bestLen := -1
+	for i := range c.Models {
+		pricing := &c.Models[i]
+		if pricing.Model == model {
+			return pricing
+		}
+		if prefix, ok := strings.CutSuffix(pricing.Model, "*"); ok && strings.HasPrefix(model, prefix) && len(prefix) > bestLen {
+			best = pricing
+			bestLen = len(prefix)
+		}
+	}
+	return best
+}
+
+// CalculateCost 按定价表计算基础成本，未配置定价的模型返回0
+func (c *PricingConfig) CalculateCost(model string, inputTokens, outputTokens int64) float64 {
+	pricing := c.FindPricing(model)
+	if pricing == nil {
+		return 0
+	}
+	return (float64(inputTokens)*pricing.InputPrice + float64(outputTokens)*pricing.OutputPrice) / 1_000_000
+}
+
+// Validate 验证定价表
+func (c *PricingConfig) Validate() error {
+	for i, pricing := range c.Models {
+		if pricing.Model == "" {
+			return fmt.Errorf("定价[%d] 模型名称不能为空", i)
+		}
+		if pricing.InputPrice < 0 || pricing.OutputPrice < 0 {
+			return fmt.Errorf("定价[%d] 价格不能为负数", i)
+		}
+	}
+	return nil
+}
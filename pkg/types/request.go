@@ -1,9 +1,11 @@
 package types
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // UnifiedRequest - 统一的请求结构
@@ -11,16 +13,28 @@ type UnifiedRequest struct {
 	Model            string                   `json:"model"`
 	Messages         []Message                `json:"messages"`
 	MaxTokens        int                      `json:"max_tokens,omitempty"`
-	Temperature      float64                  `json:"temperature,omitempty"`
+	Temperature      *float64                 `json:"temperature,omitempty"` // nil表示未设置，与显式的0区分
 	Stream           *bool                    `json:"stream,omitempty"`
 	TopP             *float64                 `json:"top_p,omitempty"`
 	Tools            []map[string]interface{} `json:"tools,omitempty"`
 	ToolChoice       interface{}              `json:"tool_choice,omitempty"`
-	OriginalFormat   string                   `json:"-"` // 原始请求格式
-	OriginalSystem   *SystemField             `json:"-"` // 原始system字段格式
-	OriginalMetadata map[string]interface{}   `json:"-"` // 原始metadata字段
-	GatewayKeyID     string                   `json:"-"` // 发起请求的Gateway API Key ID
-	UpstreamID       string                   `json:"-"` // 选中的上游账号ID
+	Seed             *int64                   `json:"seed,omitempty"`
+	N                *int                     `json:"n,omitempty"` // 候选回复数，nil表示未设置（上游默认1）
+	StopSequences    StopSequences            `json:"stop_sequences,omitempty"`
+	ResponseFormat   map[string]interface{}   `json:"response_format,omitempty"` // OpenAI的response_format（JSON模式），nil表示未设置
+	OriginalFormat   string                   `json:"-"`                         // 原始请求格式
+	OriginalSystem   *SystemField             `json:"-"`                         // 原始system字段格式
+	OriginalMetadata map[string]interface{}   `json:"-"`                         // 原始metadata字段
+	Extra            map[string]interface{}   `json:"-"`                         // 客户端请求中未显式建模的顶层字段（provider特定参数）
+	GatewayKeyID     string                   `json:"-"`                         // 发起请求的Gateway API Key ID
+	UpstreamID       string                   `json:"-"`                         // 选中的上游账号ID
+	TraceParent      string                   `json:"-"`                         // 传播给上游的W3C traceparent
+	TraceState       string                   `json:"-"`                         // 透传给上游的W3C tracestate
+	RepairJSON       bool                     `json:"-"`                         // 是否尝试将响应文本修复为纯JSON
+	StreamEvents     map[string]bool          `json:"-"`                         // 客户端需要的流式事件类型，nil表示全部
+	UpstreamTimeout  time.Duration            `json:"-"`                         // Key级别的上游请求超时，0表示使用全局超时
+	IdempotencyKey   string                   `json:"-"`                         // 客户端的Idempotency-Key，非空时成功响应可被重放
+	Context          context.Context          `json:"-"`                         // 上游调用使用的上下文，客户端断开时取消重试，nil表示不可取消
 }
 
 // Message - 通用消息结构
@@ -30,6 +44,33 @@ type Message struct {
 	ToolCalls  []map[string]interface{} `json:"tool_calls,omitempty"`   // OpenAI工具调用
 	ToolCallID *string                  `json:"tool_call_id,omitempty"` // OpenAI工具调用ID
 	Name       *string                  `json:"name,omitempty"`         // OpenAI工具名称
+
+	// CacheControl 来源Anthropic内容块（tool_use/tool_result）的cache_control标记，
+	// 仅在转换回Anthropic时使用，其他格式忽略
+	CacheControl map[string]interface{} `json:"-"`
+}
+
+// StopSequences - 停止序列，兼容OpenAI stop字段的字符串和字符串数组两种格式
+type StopSequences []string
+
+// UnmarshalJSON 自定义反序列化方法
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single == "" {
+			*s = nil
+		} else {
+			*s = StopSequences{single}
+		}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("stop必须是字符串或字符串数组: %w", err)
+	}
+	*s = list
+	return nil
 }
 
 // SystemField - 处理Anthropic system字段的两种格式
@@ -0,0 +1,38 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultTenant 未指定租户的Gateway Key和上游账号归属的默认租户
+const DefaultTenant = "default"
+
+// tenantPattern 租户名：小写字母或数字开头，可包含小写字母、数字、-和_，最长64个字符
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// NormalizeTenant 返回租户名，为空时返回默认租户
+func NormalizeTenant(tenant string) string {
+	if tenant == "" {
+		return DefaultTenant
+	}
+	return tenant
+}
+
+// ValidateTenant 校验租户名格式，空值表示默认租户
+func ValidateTenant(tenant string) error {
+	if tenant == "" || tenantPattern.MatchString(tenant) {
+		return nil
+	}
+	return fmt.Errorf("无效的租户名: %q (仅支持小写字母、数字、-和_，最长64个字符)", tenant)
+}
+
+// TenantID 返回Key所属的租户
+func (k *GatewayAPIKey) TenantID() string {
+	return NormalizeTenant(k.Tenant)
+}
+
+// TenantID 返回上游账号所属的租户
+func (a *UpstreamAccount) TenantID() string {
+	return NormalizeTenant(a.Tenant)
+}
@@ -0,0 +1,33 @@
+package types
+
+import "testing"
+
+func TestValidateTenant(t *testing.T) {
+	tests := []struct {
+		tenant  string
+		wantErr bool
+	}{
+		{"", false},
+		{"default", false},
+		{"team-a_01", false},
+		{"Acme", true},
+		{"-acme", true},
+		{"acme corp", true},
+		{"a/b", true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateTenant(tt.tenant); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateTenant(%q) error = %v, wantErr %v", tt.tenant, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTenantID_DefaultsWhenEmpty(t *testing.T) {
+	if got := (&GatewayAPIKey{}).TenantID(); got != DefaultTenant {
+		t.Errorf("GatewayAPIKey.TenantID() = %q, want %q", got, DefaultTenant)
+	}
+	if got := (&UpstreamAccount{Tenant: "acme"}).TenantID(); got != "acme" {
+		t.Errorf("UpstreamAccount.TenantID() = %q, want acme", got)
+	}
+}
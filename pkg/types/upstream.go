@@ -1,27 +1,202 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
 
 // UpstreamAccount - 上游账号结构 (用于调用LLM服务)
 type UpstreamAccount struct {
-	ID              string              `json:"id" yaml:"id"`
-	Name            string              `json:"name" yaml:"name"`
-	Type            UpstreamType        `json:"type" yaml:"type"`
-	Status          string              `json:"status" yaml:"status"` // active, disabled, error
-	Provider        Provider            `json:"provider" yaml:"provider"`
-	BaseURL         string              `json:"base_url,omitempty" yaml:"base_url,omitempty"`
-	APIKey          string              `json:"api_key,omitempty" yaml:"api_key,omitempty"`
-	ClientID        string              `json:"client_id,omitempty" yaml:"client_id,omitempty"`
-	ClientSecret    string              `json:"client_secret,omitempty" yaml:"client_secret,omitempty"`
-	AccessToken     string              `json:"access_token,omitempty" yaml:"access_token,omitempty"`
-	RefreshToken    string              `json:"refresh_token,omitempty" yaml:"refresh_token,omitempty"`
-	ResourceURL     string              `json:"resource_url,omitempty" yaml:"resource_url,omitempty"`
-	ExpiresAt       *time.Time          `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
-	Usage           *UpstreamUsageStats `json:"usage,omitempty" yaml:"usage,omitempty"`
-	LastHealthCheck *time.Time          `json:"last_health_check,omitempty" yaml:"last_health_check,omitempty"`
-	HealthStatus    string              `json:"health_status,omitempty" yaml:"health_status,omitempty"`
-	CreatedAt       time.Time           `json:"created_at" yaml:"created_at"`
-	UpdatedAt       time.Time           `json:"updated_at" yaml:"updated_at"`
+	ID              string                `json:"id" yaml:"id"`
+	Name            string                `json:"name" yaml:"name"`
+	Type            UpstreamType          `json:"type" yaml:"type"`
+	Status          string                `json:"status" yaml:"status"` // active, disabled, error
+	Provider        Provider              `json:"provider" yaml:"provider"`
+	BaseURL         string                `json:"base_url,omitempty" yaml:"base_url,omitempty"`
+	APIKey          string                `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	APIKeys         []string              `json:"api_keys,omitempty" yaml:"api_keys,omitempty"`                     // 额外的API Key，与APIKey组成轮换池
+	APIKeyExpiresAt *time.Time            `json:"api_key_expires_at,omitempty" yaml:"api_key_expires_at,omitempty"` // API Key凭据到期时间
+	ClientID        string                `json:"client_id,omitempty" yaml:"client_id,omitempty"`
+	ClientSecret    string                `json:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+	AccessToken     string                `json:"access_token,omitempty" yaml:"access_token,omitempty"`
+	RefreshToken    string                `json:"refresh_token,omitempty" yaml:"refresh_token,omitempty"`
+	ResourceURL     string                `json:"resource_url,omitempty" yaml:"resource_url,omitempty"`
+	ExpiresAt       *time.Time            `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	Usage           *UpstreamUsageStats   `json:"usage,omitempty" yaml:"usage,omitempty"`
+	LastHealthCheck *time.Time            `json:"last_health_check,omitempty" yaml:"last_health_check,omitempty"`
+	HealthStatus    string                `json:"health_status,omitempty" yaml:"health_status,omitempty"`
+	Description     string                `json:"description,omitempty" yaml:"description,omitempty"`       // 备注：用途、来源等
+	CreatedBy       string                `json:"created_by,omitempty" yaml:"created_by,omitempty"`         // 创建人
+	Tags            map[string]string     `json:"tags,omitempty" yaml:"tags,omitempty"`                     // 标签，如 region=us-east，用于分组与批量操作
+	Capabilities    *UpstreamCapabilities `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`     // 探测得到的能力信息
+	Weight          int                   `json:"weight,omitempty" yaml:"weight,omitempty"`                 // weighted负载均衡策略下的权重，未设置按1处理
+	HealthProbe     *HealthProbe          `json:"health_probe,omitempty" yaml:"health_probe,omitempty"`     // 自定义健康探测请求，未设置时请求 /v1/models
+	Tenant          string                `json:"tenant,omitempty" yaml:"tenant,omitempty"`                 // 所属租户，只服务同租户的Gateway Key，为空表示默认租户
+	DeploymentMap   map[string]string     `json:"deployment_map,omitempty" yaml:"deployment_map,omitempty"` // Azure：模型名到部署名的映射，未映射的模型直接用作部署名
+	APIVersion      string                `json:"api_version,omitempty" yaml:"api_version,omitempty"`       // Azure：api-version查询参数，为空时使用默认版本
+	ExtraHeaders    map[string]string     `json:"extra_headers,omitempty" yaml:"extra_headers,omitempty"`   // 附加到上游请求的自定义头部，可覆盖默认头部但不能覆盖认证头部
+	MaxInFlight     int                   `json:"max_in_flight,omitempty" yaml:"max_in_flight,omitempty"`   // 最大进行中请求数，达到上限时选择其他账号，0表示不限制
+	CreatedAt       time.Time             `json:"created_at" yaml:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at" yaml:"updated_at"`
+}
+
+// CredentialExpiryWarning - 凭据到期前提前提醒的时间窗口
+const CredentialExpiryWarning = 7 * 24 * time.Hour
+
+// IsAPIKeyExpired 判断API Key类型账号的凭据是否已过期（未设置到期时间视为永不过期）
+func (a *UpstreamAccount) IsAPIKeyExpired(now time.Time) bool {
+	return a.Type == UpstreamTypeAPIKey && a.APIKeyExpiresAt != nil && !now.Before(*a.APIKeyExpiresAt)
+}
+
+// IsAPIKeyExpiringSoon 判断API Key凭据是否将在window内到期（已过期的不算）
+func (a *UpstreamAccount) IsAPIKeyExpiringSoon(now time.Time, window time.Duration) bool {
+	return a.Type == UpstreamTypeAPIKey && a.APIKeyExpiresAt != nil &&
+		now.Before(*a.APIKeyExpiresAt) && a.APIKeyExpiresAt.Sub(now) <= window
+}
+
+// APIKeyPool 返回API Key轮换池：APIKey在前，去除空值和重复项
+func (a *UpstreamAccount) APIKeyPool() []string {
+	pool := make([]string, 0, 1+len(a.APIKeys))
+	seen := make(map[string]bool, cap(pool))
+	for _, key := range append([]string{a.APIKey}, a.APIKeys...) {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		pool = append(pool, key)
+	}
+	return pool
+}
+
+// MaskKey 返回密钥的脱敏显示：最多显示前8位，且不超过密钥长度的一半，短密钥不会越界
+func MaskKey(s string) string {
+	if s == "" {
+		return ""
+	}
+	n := len(s) / 2
+	if n > 8 {
+		n = 8
+	}
+	return s[:n] + "***"
+}
+
+// AzureDeployment 返回模型对应的Azure部署名，DeploymentMap中未配置时使用模型名本身
+func (a *UpstreamAccount) AzureDeployment(model string) string {
+	if deployment, ok := a.DeploymentMap[model]; ok && deployment != "" {
+		return deployment
+	}
+	return model
+}
+
+// NormalizeBaseURL 校验账号自定义的Base URL：必须是带主机名的http(s)地址，且不能包含查询参数或片段。
+// 返回去掉首尾空白和末尾/的URL，因为上游路径（如/v1/chat/completions）以/开头
+func NormalizeBaseURL(raw string) (string, error) {
+	baseURL := strings.TrimRight(strings.TrimSpace(raw), "/")
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("无效的Base URL: %s", raw)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("Base URL必须使用http或https协议: %s", raw)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("Base URL缺少主机名: %s", raw)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("Base URL不能包含查询参数或片段: %s", raw)
+	}
+	return baseURL, nil
+}
+
+// ParseTags 解析 "key=value,key2=value2" 格式的标签
+func ParseTags(value string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" {
+			return nil, fmt.Errorf("无效的标签: %s (格式: key=value)", pair)
+		}
+		tags[key] = strings.TrimSpace(parts[1])
+	}
+	return tags, nil
+}
+
+// FormatTags 将标签格式化为 "key=value,key2=value2"，按key排序
+func FormatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for key, value := range tags {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// MatchTags 判断账号是否包含selector中的全部标签，空selector匹配所有账号
+func (a *UpstreamAccount) MatchTags(selector map[string]string) bool {
+	for key, value := range selector {
+		if actual, ok := a.Tags[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// HealthProbe - 自定义健康探测请求，未设置的字段使用默认值（GET /v1/models，期望2xx）
+type HealthProbe struct {
+	Path         string `json:"path,omitempty" yaml:"path,omitempty"`                   // 探测路径（相对BaseURL）或与BaseURL同主机的完整URL
+	Method       string `json:"method,omitempty" yaml:"method,omitempty"`               // HTTP方法，默认GET
+	Body         string `json:"body,omitempty" yaml:"body,omitempty"`                   // JSON请求体，如一次max_tokens=1的对话请求
+	ExpectStatus []int  `json:"expect_status,omitempty" yaml:"expect_status,omitempty"` // 视为健康的状态码，未设置时接受任意2xx
+}
+
+// Validate 校验探测配置
+func (p *HealthProbe) Validate() error {
+	switch strings.ToUpper(p.Method) {
+	case "", "GET", "HEAD", "POST", "PUT":
+	default:
+		return fmt.Errorf("不支持的探测方法: %s (支持: GET, HEAD, POST, PUT)", p.Method)
+	}
+	if p.Path != "" && !strings.HasPrefix(p.Path, "/") &&
+		!strings.HasPrefix(p.Path, "http://") && !strings.HasPrefix(p.Path, "https://") {
+		return fmt.Errorf("探测路径必须以/开头或为完整的http(s) URL: %s", p.Path)
+	}
+	for _, status := range p.ExpectStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("无效的期望状态码: %d", status)
+		}
+	}
+	return nil
+}
+
+// Accepts 判断探测响应状态码是否视为健康
+func (p *HealthProbe) Accepts(status int) bool {
+	if p == nil || len(p.ExpectStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, expected := range p.ExpectStatus {
+		if status == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// UpstreamCapabilities - 能力探测结果，未能探测出结论的能力为nil
+type UpstreamCapabilities struct {
+	Models       []string  `json:"models,omitempty" yaml:"models,omitempty"`       // /v1/models 返回的模型列表
+	Endpoints    []string  `json:"endpoints,omitempty" yaml:"endpoints,omitempty"` // 探测可用的端点
+	Streaming    *bool     `json:"streaming,omitempty" yaml:"streaming,omitempty"` // 是否支持流式响应
+	Tools        *bool     `json:"tools,omitempty" yaml:"tools,omitempty"`         // 是否支持工具调用
+	ProbeModel   string    `json:"probe_model,omitempty" yaml:"probe_model,omitempty"`
+	DiscoveredAt time.Time `json:"discovered_at" yaml:"discovered_at"`
 }
 
 // UpstreamUsageStats - 上游账号使用统计
@@ -34,4 +209,5 @@ type UpstreamUsageStats struct {
 	LastErrorAt        *time.Time `json:"last_error_at,omitempty" yaml:"last_error_at,omitempty"`
 	AvgLatency         float64    `json:"avg_latency_ms" yaml:"avg_latency_ms"`
 	ErrorRate          float64    `json:"error_rate" yaml:"error_rate"`
+	ConsecutiveErrors  int64      `json:"consecutive_errors" yaml:"consecutive_errors"` // 连续错误数，成功后清零，用于熔断
 }
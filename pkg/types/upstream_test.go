@@ -0,0 +1,53 @@
+package types
+
+import "testing"
+
+func TestMaskKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"空密钥", "", ""},
+		{"单字符", "a", "***"},
+		{"三字符", "abc", "a***"},
+		{"八字符只显示一半", "abcdefgh", "abcd***"},
+		{"长密钥显示前8位", "sk-ant-REDACTED", "sk-ant-a***"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaskKey(tt.key); got != tt.want {
+				t.Errorf("MaskKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"https地址", "https://api.example.com", "https://api.example.com", false},
+		{"带路径和端口", "http://127.0.0.1:8080/openai", "http://127.0.0.1:8080/openai", false},
+		{"去掉空白和末尾的/", " https://api.example.com/v1/ ", "https://api.example.com/v1", false},
+		{"缺少协议", "api.example.com", "", true},
+		{"不支持的协议", "ftp://api.example.com", "", true},
+		{"缺少主机名", "https:///v1", "", true},
+		{"包含查询参数", "https://api.example.com?key=1", "", true},
+		{"格式错误", "http://[::1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeBaseURL(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeBaseURL(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeBaseURL(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
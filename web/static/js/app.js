@@ -291,19 +291,39 @@ class LLMGatewayApp {
         
         tbody.innerHTML = accounts.map(account => `
             <tr>
-                <td><strong>${this.escapeHtml(account.name)}</strong><br><small class="text-muted">${account.id}</small></td>
+                <td><strong>${this.escapeHtml(account.name)}</strong><br><small class="text-muted">${account.id}</small>${this.renderTags(account.tags)}</td>
                 <td>${this.escapeHtml(account.provider)}</td>
                 <td>${this.escapeHtml(account.type)}</td>
-                <td><span class="status-badge ${account.status}">${account.status}</span></td>
+                <td><span class="status-badge ${account.status}">${account.status}</span>${this.renderOAuthStatus(account)}</td>
                 <td><span class="status-badge ${account.health_status || 'unknown'}">${account.health_status || 'Unknown'}</span></td>
                 <td>${this.renderUsageStats(account.usage)}</td>
                 <td>
+                    ${account.type === 'oauth' ? `<button class="btn ${account.needs_reauth ? 'btn-primary' : 'btn-secondary'} btn-small" onclick="app.reauthorizeUpstream('${account.id}', '${account.provider}')">${window.i18n.t('upstream.reauthorize')}</button>` : ''}
                     <button class="btn btn-danger btn-small" onclick="app.deleteUpstreamAccount('${account.id}')">${window.i18n.t('upstream.delete')}</button>
                 </td>
             </tr>
         `).join('');
     }
 
+    renderTags(tags) {
+        const entries = Object.entries(tags || {});
+        if (entries.length === 0) {
+            return '';
+        }
+        return '<br>' + entries.sort()
+            .map(([key, value]) => `<span class="status-badge unknown">${this.escapeHtml(key)}=${this.escapeHtml(value)}</span>`)
+            .join(' ');
+    }
+
+    renderOAuthStatus(account) {
+        if (account.type !== 'oauth' || !account.oauth_status) {
+            return '';
+        }
+        const badgeClass = account.needs_reauth ? 'unhealthy' : (account.oauth_status === 'authorized' ? 'healthy' : 'unknown');
+        const reason = account.oauth_reason ? `<br><small class="text-muted">${this.escapeHtml(account.oauth_reason)}</small>` : '';
+        return `<br><span class="status-badge ${badgeClass}" title="${this.escapeHtml(account.oauth_reason || '')}">oauth: ${account.oauth_status}</span>${reason}`;
+    }
+
     renderUpstreamStats(stats) {
         const statsContainer = document.getElementById('upstream-stats');
         if (stats.total > 0) {
@@ -514,6 +534,26 @@ class LLMGatewayApp {
         }
     }
 
+    async reauthorizeUpstream(upstreamId, provider) {
+        if (!confirm(window.i18n.t('msg.confirm_reauthorize'))) {
+            return;
+        }
+
+        try {
+            const result = await this.apiCall('/oauth/reauthorize', 'POST', {
+                upstream_id: upstreamId
+            });
+
+            if (result.flow_type === 'authorization_code') {
+                this.handleAnthropicOAuth(result, upstreamId);
+            } else if (result.flow_type === 'device_code') {
+                this.handleQwenOAuth(result, upstreamId);
+            }
+        } catch (error) {
+            this.showError('Failed to re-authorize upstream account: ' + error.message);
+        }
+    }
+
     handleAnthropicOAuth(oauthResult, upstreamId) {
         // 显示Anthropic OAuth指引模态框
         const modal = this.createOAuthModal('anthropic-oauth-modal', 'Anthropic OAuth Authorization');
@@ -527,7 +567,7 @@ class LLMGatewayApp {
                 </div>
                 <div class="form-group" style="margin-top: 20px;">
                     <label>After authorization, paste the code here:</label>
-                    <input type="text" id="oauth-code" placeholder="Enter authorization code">
+                    <input type="text" id="oauth-code" placeholder="Paste the full code shown after authorizing (code#state)">
                     <button class="btn btn-success" onclick="app.completeAnthropicOAuth('${upstreamId}')">Complete Authorization</button>
                 </div>
             </div>
@@ -686,9 +726,15 @@ class LLMGatewayApp {
         try {
             const response = await this.apiCall(`/apikeys/${keyId}/model-routes`);
             const routes = response.routes || [];
+            // 保留模型允许/禁止列表，保存路由时一并提交以免被清空
+            window.currentModelAccess = {
+                allowed_models: response.allowed_models || [],
+                denied_models: response.denied_models || []
+            };
             this.renderModelRoutes(routes);
         } catch (error) {
             // 如果没有配置或API不存在，显示空列表
+            window.currentModelAccess = {};
             this.renderModelRoutes([]);
         }
     }
@@ -776,6 +822,7 @@ class LLMGatewayApp {
             // 立即保存到服务器
             const keyId = window.currentEditingKey.id;
             await this.apiCall(`/apikeys/${keyId}/model-routes`, 'PUT', {
+                ...window.currentModelAccess,
                 routes: window.currentModelRoutes,
                 default_behavior: 'passthrough',
                 enable_logging: true
@@ -854,6 +901,7 @@ class LLMGatewayApp {
             // 立即保存到服务器
             const keyId = window.currentEditingKey.id;
             await this.apiCall(`/apikeys/${keyId}/model-routes`, 'PUT', {
+                ...window.currentModelAccess,
                 routes: window.currentModelRoutes,
                 default_behavior: 'passthrough',
                 enable_logging: true
@@ -72,6 +72,7 @@ class I18n {
                 'upstream.table.usage': 'Usage',
                 'upstream.table.actions': 'Actions',
                 'upstream.delete': 'Delete',
+                'upstream.reauthorize': 'Re-authorize',
                 'upstream.loading': 'Loading upstream accounts...',
                 
                 // API Keys
@@ -214,6 +215,7 @@ class I18n {
                 
                 // Messages
                 'msg.confirm_delete_upstream': 'Are you sure you want to delete this upstream account?',
+                'msg.confirm_reauthorize': 'Start a new OAuth authorization for this account? The current token stays in use until the new authorization completes.',
                 'msg.confirm_delete_apikey': 'Are you sure you want to delete this API key?',
                 'msg.upstream_added': 'Upstream account added successfully',
                 'msg.upstream_deleted': 'Upstream account deleted successfully',
@@ -316,6 +318,7 @@ class I18n {
                 'upstream.table.usage': '使用统计',
                 'upstream.table.actions': '操作',
                 'upstream.delete': '删除',
+                'upstream.reauthorize': '重新授权',
                 'upstream.loading': '正在加载上游账号...',
                 
                 // API Keys
@@ -458,6 +461,7 @@ class I18n {
                 
                 // Messages
                 'msg.confirm_delete_upstream': '确定要删除此上游账号吗？',
+                'msg.confirm_reauthorize': '确定要为此账号重新发起OAuth授权吗？新授权完成前仍使用当前token。',
                 'msg.confirm_delete_apikey': '确定要删除此API密钥吗？',
                 'msg.upstream_added': '上游账号添加成功',
                 'msg.upstream_deleted': '上游账号删除成功',